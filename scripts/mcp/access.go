@@ -0,0 +1,207 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// The server advertises the tools that the delegated user's effective
+// permissions allow: the user's roles intersected with the API key's
+// permissions. Some tools check roles again when executed, so a listed tool
+// can still refuse the call. toolRoles mirrors those checks. Servers that
+// report the delegated user's roles in serverInfo let capabilities and shell
+// completion hide the tools the user cannot call. With older servers the
+// required roles are shown next to the tool instead.
+
+// toolRoles lists, per tool, the roles of which the delegated user needs at
+// least one.
+var toolRoles = map[string][]string{
+	"add_user":                            {"ADMIN"},
+	"delete_user":                         {"ADMIN"},
+	"list_users":                          {"ADMIN"},
+	"list_user_mappings":                  {"ADMIN"},
+	"import_user_mappings":                {"ADMIN"},
+	"create_workgroup":                    {"ADMIN"},
+	"delete_workgroup":                    {"ADMIN"},
+	"assign_assets_to_workgroup":          {"ADMIN"},
+	"assign_users_to_workgroup":           {"ADMIN"},
+	"list_workgroup_aws_accounts":         {"ADMIN"},
+	"add_workgroup_aws_account":           {"ADMIN"},
+	"remove_workgroup_aws_account":        {"ADMIN"},
+	"list_workgroup_ad_domains":           {"ADMIN"},
+	"add_workgroup_ad_domain":             {"ADMIN"},
+	"remove_workgroup_ad_domain":          {"ADMIN"},
+	"list_aws_account_sharing":            {"ADMIN"},
+	"create_aws_account_sharing":          {"ADMIN"},
+	"delete_aws_account_sharing":          {"ADMIN"},
+	"delete_asset":                        {"ADMIN"},
+	"delete_all_assets":                   {"ADMIN"},
+	"delete_asset_not_seen":               {"ADMIN"},
+	"asset_match_clear":                   {"ADMIN"},
+	"delete_all_requirements":             {"ADMIN"},
+	"deduplicate_vulnerabilities":         {"ADMIN"},
+	"refresh_vulnerability_heatmap":       {"ADMIN"},
+	"delete_all_vulnerability_exceptions": {"ADMIN"},
+	"reconcile_exception_requests":        {"ADMIN"},
+	"send_admin_summary":                  {"ADMIN"},
+	"send_patch_notifications":            {"ADMIN"},
+	"send_outdated_notifications":         {"ADMIN"},
+	"send_vulnerability_notifications":    {"ADMIN"},
+	"send_application_register_reminders": {"ADMIN"},
+	"notify_new_accounts":                 {"ADMIN"},
+	"list_products":                       {"ADMIN", "SECCHAMPION"},
+	"get_pending_exception_requests":      {"ADMIN", "SECCHAMPION"},
+	"approve_exception_request":           {"ADMIN", "SECCHAMPION"},
+	"reject_exception_request":            {"ADMIN", "SECCHAMPION"},
+	"get_exception_request_statistics":    {"ADMIN", "SECCHAMPION"},
+	"list_vulnerability_exceptions":       {"ADMIN", "SECCHAMPION", "VULN"},
+	"add_vulnerability":                   {"ADMIN", "VULN"},
+	"get_overdue_assets":                  {"ADMIN", "VULN"},
+	"get_crowdstrike_last_import":         {"ADMIN", "VULN"},
+	"list_releases":                       {"ADMIN", "RELEASE_MANAGER"},
+	"get_release":                         {"ADMIN", "RELEASE_MANAGER"},
+	"compare_releases":                    {"ADMIN", "RELEASE_MANAGER"},
+	"set_release_status":                  {"ADMIN", "RELEASE_MANAGER"},
+	"start_alignment":                     {"ADMIN", "RELEASE_MANAGER"},
+	"finalize_alignment":                  {"ADMIN", "RELEASE_MANAGER"},
+	"create_release":                      {"ADMIN", "REQADMIN"},
+	"delete_release":                      {"ADMIN", "REQADMIN"},
+	"submit_review":                       {"ADMIN", "REQ"},
+}
+
+// userAccess is what the server reports about the delegated user.
+type userAccess struct {
+	User        string
+	Roles       []string // nil when the server does not report roles
+	Permissions []string
+}
+
+func accessFromServerInfo(info map[string]interface{}) *userAccess {
+	a := &userAccess{User: stringField(info, "delegatedUser")}
+	if roles, ok := info["delegatedUserRoles"].([]interface{}); ok {
+		a.Roles = []string{}
+		for _, r := range roles {
+			a.Roles = append(a.Roles, strings.ToUpper(fmt.Sprint(r)))
+		}
+	}
+	if perms, ok := info["effectivePermissions"].([]interface{}); ok {
+		for _, p := range perms {
+			a.Permissions = append(a.Permissions, fmt.Sprint(p))
+		}
+	}
+	return a
+}
+
+func (a *userAccess) rolesKnown() bool {
+	return a != nil && a.Roles != nil
+}
+
+// canCall reports whether the user's roles allow the tool. known is false
+// when the tool needs a role and the server did not report the user's roles.
+func (a *userAccess) canCall(tool string) (allowed, known bool) {
+	need := toolRoles[tool]
+	if len(need) == 0 {
+		return true, true
+	}
+	if !a.rolesKnown() {
+		return true, false
+	}
+	for _, r := range need {
+		for _, have := range a.Roles {
+			if r == have {
+				return true, true
+			}
+		}
+	}
+	return false, true
+}
+
+// Access returns what the server reported about the delegated user along
+// with the tool list.
+func (c *McpClient) Access() (*userAccess, error) {
+	if _, err := c.toolCache(); err != nil {
+		return nil, err
+	}
+	c.toolsMu.Lock()
+	defer c.toolsMu.Unlock()
+	return c.access, nil
+}
+
+// CallableToolNames returns the advertised tools without those the
+// delegated user's roles are known not to allow, sorted.
+func (c *McpClient) CallableToolNames() ([]string, error) {
+	names, err := c.ToolNames()
+	if err != nil {
+		return nil, err
+	}
+	access, err := c.Access()
+	if err != nil {
+		return nil, err
+	}
+	callable := names[:0:0]
+	for _, name := range names {
+		if ok, _ := access.canCall(name); ok {
+			callable = append(callable, name)
+		}
+	}
+	return callable, nil
+}
+
+func rolesText(roles []string) string {
+	return strings.Join(roles, " or ")
+}
+
+func cmdCapabilities(client *McpClient, osArgs []string) {
+	if len(osArgs) > 0 && osArgs[0] == "diff" {
+		cmdCapabilitiesDiff(client, osArgs[1:])
+		return
+	}
+	fs := flag.NewFlagSet("capabilities", flag.ContinueOnError)
+	all := fs.Bool("all", false, "Also list tools the delegated user's roles do not allow, marked")
+	parseFlags(fs, osArgs)
+
+	caps, err := client.GetCapabilities()
+	if err != nil {
+		fatal(err)
+	}
+	access := accessFromServerInfo(caps.ServerInfo)
+
+	fmt.Printf("Server: %v\n", caps.ServerInfo["name"])
+	if access.User != "" {
+		roles := "not reported by the server"
+		if access.rolesKnown() {
+			roles = orNone(strings.Join(access.Roles, ", "))
+		}
+		fmt.Printf("Delegated user: %s (roles: %s)\n", access.User, roles)
+	}
+	if len(access.Permissions) > 0 {
+		fmt.Printf("Effective permissions: %s\n", strings.Join(access.Permissions, ", "))
+	}
+	fmt.Println()
+
+	var shown []string
+	hidden := 0
+	for _, tool := range caps.Capabilities.Tools {
+		allowed, known := access.canCall(tool.Name)
+		mark := ""
+		switch {
+		case !allowed && !*all:
+			hidden++
+			continue
+		case !allowed:
+			mark = paint(styleFail, "[denied: needs "+rolesText(toolRoles[tool.Name])+"] ")
+		case !known:
+			mark = paint(styleMedium, "[needs "+rolesText(toolRoles[tool.Name])+"] ")
+		}
+		shown = append(shown, fmt.Sprintf("  %-35s %s%s", tool.Name, mark, tool.Description))
+	}
+
+	fmt.Printf("Available tools (%d):\n", len(shown))
+	for _, line := range shown {
+		fmt.Println(line)
+	}
+	if hidden > 0 {
+		fmt.Printf("\n%d tool(s) hidden that the delegated user's roles do not allow (--all lists them)\n", hidden)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+func cmdAdmin(client *McpClient, osArgs []string) {
+	if len(osArgs) < 1 {
+		fmt.Fprintln(os.Stderr, "Error: admin subcommand required")
+		fmt.Fprintf(os.Stderr, "Usage: %s admin <email-test> ...\n", progName())
+		exit(ExitUsage)
+	}
+
+	switch osArgs[0] {
+	case "email-test":
+		cmdAdminEmailTest(client, osArgs[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown admin subcommand: %s\n", osArgs[0])
+		exit(ExitUsage)
+	}
+}
+
+// cmdAdminEmailTest runs the server's email configuration test and prints
+// the SMTP conversation so mail setup can be debugged on headless installs.
+func cmdAdminEmailTest(client *McpClient, osArgs []string) {
+	fs := flag.NewFlagSet("admin email-test", flag.ContinueOnError)
+	to := fs.String("to", "", "Recipient address for the test message (required)")
+	configID := fs.Int64("config", 0, "Email configuration id (default: the active configuration)")
+	asJSON := fs.Bool("json", false, "Print the raw tool result as JSON")
+	parseFlags(fs, osArgs)
+
+	if *to == "" || !strings.Contains(*to, "@") {
+		fmt.Fprintln(os.Stderr, "Error: --to <address> is required")
+		exit(ExitUsage)
+	}
+	if err := client.requireTool("test_email_configuration"); err != nil {
+		fatal(err)
+	}
+
+	args := map[string]interface{}{"recipient": *to}
+	if *configID > 0 {
+		args["configId"] = *configID
+	}
+
+	// A failed handshake is reported as isError with details, so the raw
+	// result is used rather than callToolMap to keep those details.
+	result, err := client.CallTool("test_email_configuration", args)
+	if err != nil {
+		fatal(err)
+	}
+	if rawOutput(*asJSON) {
+		printResult(result)
+		if result.IsError {
+			exit(ExitGateFailed)
+		}
+		return
+	}
+
+	content, _ := result.Content.(map[string]interface{})
+	if content == nil {
+		content = map[string]interface{}{"message": fmt.Sprint(result.Content)}
+	}
+
+	for _, key := range []string{"smtpHost", "smtpPort", "security", "authenticated", "fromAddress", "durationMs"} {
+		if v := stringField(content, key); v != "" {
+			status(nil, "  %-14s %s\n", key+":", v)
+		}
+	}
+
+	if transcript, ok := content["transcript"].([]interface{}); ok && len(transcript) > 0 {
+		status(nil, "\nSMTP transcript:\n")
+		for _, line := range transcript {
+			status(nil, "  %v\n", line)
+		}
+	}
+
+	success, _ := content["success"].(bool)
+	if result.IsError || !success {
+		fmt.Fprintf(os.Stderr, "\n%s: %s\n", paintErr(styleFail, "Email test FAILED"), stringField(content, "message"))
+		exit(ExitGateFailed)
+	}
+	status(nil, "\n%s to %s\n", paint(styleOK, "Test message sent"), *to)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+// Findings are aged by days open: the server's daysOpen, or the days since
+// createdAt (scanTimestamp for older servers). vulnerabilities adds ageDays
+// and ageBucket to each finding, and --age-bucket on vulnerabilities, stats
+// and report send counts the open findings per bucket and severity.
+
+// vulnAgeBuckets are the buckets by their upper bound in days; the last
+// one is open-ended.
+var vulnAgeBuckets = []struct {
+	name    string
+	maxDays int
+}{
+	{"0-7d", 7},
+	{"8-30d", 30},
+	{"31-90d", 90},
+	{">90d", -1},
+}
+
+// ageBucketCount is the number of open findings in one bucket.
+type ageBucketCount struct {
+	Bucket   string `json:"bucket"`
+	Total    int    `json:"total"`
+	Critical int    `json:"critical"`
+	High     int    `json:"high"`
+	Medium   int    `json:"medium"`
+	Low      int    `json:"low"`
+}
+
+// findingAge is the number of days a finding has been open.
+func findingAge(f map[string]interface{}, now time.Time) (int, bool) {
+	if days, ok := parseDays(stringField(f, "daysOpen")); ok {
+		return days, true
+	}
+	for _, field := range []string{"createdAt", "scanTimestamp"} {
+		if t, ok := parseServerTime(stringField(f, field)); ok {
+			if days := int(now.Sub(t).Hours() / 24); days > 0 {
+				return days, true
+			}
+			return 0, true
+		}
+	}
+	return 0, false
+}
+
+func ageBucket(days int) string {
+	for _, b := range vulnAgeBuckets {
+		if b.maxDays < 0 || days <= b.maxDays {
+			return b.name
+		}
+	}
+	return ""
+}
+
+// addAgeFields sets ageDays and ageBucket on findings whose age is known.
+func addAgeFields(findings []map[string]interface{}, now time.Time) {
+	for _, f := range findings {
+		if days, ok := findingAge(f, now); ok {
+			f["ageDays"] = days
+			f["ageBucket"] = ageBucket(days)
+		}
+	}
+}
+
+// countAgeBuckets counts findings per bucket and severity. Every bucket is
+// listed, empty ones too, so weekly numbers line up.
+func countAgeBuckets(findings []map[string]interface{}, now time.Time) []ageBucketCount {
+	counts := make([]ageBucketCount, len(vulnAgeBuckets))
+	index := map[string]int{}
+	for i, b := range vulnAgeBuckets {
+		counts[i].Bucket = b.name
+		index[b.name] = i
+	}
+	for _, f := range findings {
+		days, ok := findingAge(f, now)
+		if !ok {
+			continue
+		}
+		c := &counts[index[ageBucket(days)]]
+		c.Total++
+		switch strings.ToUpper(stringField(f, "cvssSeverity")) {
+		case "CRITICAL":
+			c.Critical++
+		case "HIGH":
+			c.High++
+		case "MEDIUM":
+			c.Medium++
+		case "LOW":
+			c.Low++
+		}
+	}
+	return counts
+}
+
+// collectAgeBuckets counts every open finding the server returns.
+func collectAgeBuckets(client *McpClient) ([]ageBucketCount, error) {
+	findings, err := listAll(client, "get_vulnerabilities", "vulnerabilities", map[string]interface{}{}, 500)
+	if err != nil {
+		return nil, err
+	}
+	return countAgeBuckets(findings, time.Now()), nil
+}
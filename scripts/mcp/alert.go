@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Alert sinks page on-call through PagerDuty (Events API v2, routing key in
+// SECMAN_PAGERDUTY_ROUTING_KEY) or Opsgenie (Alert API, key in
+// SECMAN_OPSGENIE_API_KEY). Every alert carries a dedup key: PagerDuty
+// folds triggers with the same dedup_key into one open incident, Opsgenie
+// does the same for the alias, so a repeated trigger never pages twice.
+
+// alert is one page about a vulnerability.
+type alert struct {
+	DedupKey string
+	Summary  string
+	Severity string // CRITICAL, HIGH, MEDIUM or LOW
+	CVE      string
+	Assets   []string
+	Details  map[string]interface{}
+}
+
+type alertSink interface {
+	Name() string
+	Trigger(a alert) error
+	Resolve(dedupKey string) error
+}
+
+// alertSinkNames lists the supported sinks.
+var alertSinkNames = []string{"pagerduty", "opsgenie"}
+
+// newAlertSinks builds the named sinks, or every configured one when names
+// is empty.
+func newAlertSinks(client *McpClient, names []string) ([]alertSink, error) {
+	explicit := len(names) > 0
+	if !explicit {
+		names = alertSinkNames
+	}
+	httpClient := externalHTTPClient(client, 30*time.Second)
+	var sinks []alertSink
+	for _, name := range names {
+		switch strings.ToLower(name) {
+		case "pagerduty":
+			key := setting("SECMAN_PAGERDUTY_ROUTING_KEY")
+			if key == "" {
+				if explicit {
+					return nil, fmt.Errorf("SECMAN_PAGERDUTY_ROUTING_KEY is required for the pagerduty sink")
+				}
+				continue
+			}
+			registerSecret(key)
+			sinks = append(sinks, &pagerDutySink{
+				url:        settingOr("SECMAN_PAGERDUTY_URL", "https://events.pagerduty.com/v2/enqueue"),
+				routingKey: key,
+				http:       httpClient,
+			})
+		case "opsgenie":
+			key := setting("SECMAN_OPSGENIE_API_KEY")
+			if key == "" {
+				if explicit {
+					return nil, fmt.Errorf("SECMAN_OPSGENIE_API_KEY is required for the opsgenie sink")
+				}
+				continue
+			}
+			registerSecret(key)
+			sinks = append(sinks, &opsgenieSink{
+				baseURL: strings.TrimRight(settingOr("SECMAN_OPSGENIE_URL", "https://api.opsgenie.com"), "/"),
+				apiKey:  key,
+				http:    httpClient,
+			})
+		default:
+			return nil, fmt.Errorf("unknown alert sink %q (supported: %s)", name, strings.Join(alertSinkNames, ", "))
+		}
+	}
+	if len(sinks) == 0 {
+		return nil, fmt.Errorf("no alert sink configured (set SECMAN_PAGERDUTY_ROUTING_KEY or SECMAN_OPSGENIE_API_KEY)")
+	}
+	if client.dryRun {
+		for i, s := range sinks {
+			sinks[i] = &dryRunSink{sink: s, client: client}
+		}
+	}
+	return sinks, nil
+}
+
+// dryRunSink prints alerts under --dry-run instead of paging anyone.
+type dryRunSink struct {
+	sink   alertSink
+	client *McpClient
+}
+
+func (s *dryRunSink) Name() string { return s.sink.Name() }
+
+func (s *dryRunSink) Trigger(a alert) error {
+	s.client.dryRunCalls.Add(1)
+	fmt.Printf("DRY RUN %s trigger %s\n    summary = %q\n", s.sink.Name(), a.DedupKey, a.Summary)
+	return nil
+}
+
+func (s *dryRunSink) Resolve(dedupKey string) error {
+	s.client.dryRunCalls.Add(1)
+	fmt.Printf("DRY RUN %s resolve %s\n", s.sink.Name(), dedupKey)
+	return nil
+}
+
+// externalHTTPClient returns a client for services other than the Secman
+// server. It shares --debug output with the Secman client but not its TLS
+// pins, which belong to the Secman server.
+func externalHTTPClient(client *McpClient, timeout time.Duration) *http.Client {
+	var transport http.RoundTripper = http.DefaultTransport
+	if d, ok := client.HTTP.Transport.(*debugTransport); ok {
+		transport = &debugTransport{base: transport, w: d.w}
+	}
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// postJSON sends body and fails on any non-2xx status, quoting the
+// response so the service's reason shows.
+func postJSON(httpClient *http.Client, u string, header http.Header, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, u, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("http request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &HTTPError{StatusCode: resp.StatusCode, Body: req.URL.Host + ": " + strings.TrimSpace(string(msg))}
+	}
+	return nil
+}
+
+type pagerDutySink struct {
+	url        string
+	routingKey string
+	http       *http.Client
+}
+
+func (s *pagerDutySink) Name() string { return "pagerduty" }
+
+var pagerDutySeverity = map[string]string{
+	"CRITICAL": "critical",
+	"HIGH":     "error",
+	"MEDIUM":   "warning",
+	"LOW":      "info",
+}
+
+func (s *pagerDutySink) Trigger(a alert) error {
+	severity := pagerDutySeverity[a.Severity]
+	if severity == "" {
+		severity = "warning"
+	}
+	details := map[string]interface{}{"cve": a.CVE, "assets": a.Assets}
+	for k, v := range a.Details {
+		details[k] = v
+	}
+	return postJSON(s.http, s.url, nil, map[string]interface{}{
+		"routing_key":  s.routingKey,
+		"event_action": "trigger",
+		"dedup_key":    a.DedupKey,
+		"client":       "Secman",
+		"payload": map[string]interface{}{
+			"summary":        truncate(a.Summary, 1024),
+			"source":         "secman",
+			"severity":       severity,
+			"class":          "vulnerability",
+			"custom_details": details,
+		},
+	})
+}
+
+func (s *pagerDutySink) Resolve(dedupKey string) error {
+	return postJSON(s.http, s.url, nil, map[string]interface{}{
+		"routing_key":  s.routingKey,
+		"event_action": "resolve",
+		"dedup_key":    dedupKey,
+	})
+}
+
+type opsgenieSink struct {
+	baseURL string
+	apiKey  string
+	http    *http.Client
+}
+
+func (s *opsgenieSink) Name() string { return "opsgenie" }
+
+var opsgeniePriority = map[string]string{
+	"CRITICAL": "P1",
+	"HIGH":     "P2",
+	"MEDIUM":   "P3",
+	"LOW":      "P4",
+}
+
+func (s *opsgenieSink) header() http.Header {
+	return http.Header{"Authorization": {"GenieKey " + s.apiKey}}
+}
+
+func (s *opsgenieSink) Trigger(a alert) error {
+	priority := opsgeniePriority[a.Severity]
+	if priority == "" {
+		priority = "P3"
+	}
+	// Opsgenie details only take string values.
+	details := map[string]string{"cve": a.CVE, "assets": strings.Join(a.Assets, ", ")}
+	for k, v := range a.Details {
+		details[k] = fmt.Sprint(v)
+	}
+	return postJSON(s.http, s.baseURL+"/v2/alerts", s.header(), map[string]interface{}{
+		"message":     truncate(a.Summary, 130),
+		"alias":       a.DedupKey,
+		"description": fmt.Sprintf("%s on %s", a.CVE, strings.Join(a.Assets, ", ")),
+		"priority":    priority,
+		"source":      "secman",
+		"tags":        []string{"secman", a.CVE},
+		"details":     details,
+	})
+}
+
+func (s *opsgenieSink) Resolve(dedupKey string) error {
+	u := s.baseURL + "/v2/alerts/" + url.PathEscape(dedupKey) + "/close?identifierType=alias"
+	return postJSON(s.http, u, s.header(), map[string]interface{}{"source": "secman"})
+}
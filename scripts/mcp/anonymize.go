@@ -0,0 +1,231 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Anonymizer replaces hostnames, IP addresses, user emails and asset owners
+// with pseudonyms derived from an HMAC-SHA256 of the original value. The
+// same key always yields the same pseudonym, so datasets exported with one
+// key can still be joined. The key comes from SECMAN_ANONYMIZE_KEY; without
+// it a random per-run key is used.
+type Anonymizer struct {
+	key   []byte
+	known map[string]string // lower-cased original -> pseudonym
+	re    *regexp.Regexp    // built lazily from known
+}
+
+var (
+	ipv4Pattern  = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+)
+
+// Field names whose values are replaced when anonymizing JSON records.
+var anonymizeFields = map[string]string{
+	"hostname":    "host",
+	"assetName":   "host",
+	"host":        "host",
+	"fqdn":        "host",
+	"netbiosName": "host",
+	"ip":          "ip",
+	"ipAddress":   "ip",
+	"ips":         "ip",
+	"owner":       "owner",
+	"assetOwner":  "owner",
+	"email":       "email",
+	"userEmail":   "email",
+	"uploadedBy":  "email",
+	"createdBy":   "email",
+	"requestedBy": "email",
+	"approvedBy":  "email",
+	"reviewedBy":  "email",
+	"assignee":    "email",
+}
+
+func newAnonymizer() (*Anonymizer, error) {
+	key := []byte(setting("SECMAN_ANONYMIZE_KEY"))
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		warnf("Warning: SECMAN_ANONYMIZE_KEY not set; pseudonyms will not match other exports\n")
+	}
+	return &Anonymizer{key: key, known: map[string]string{}}, nil
+}
+
+func (a *Anonymizer) digest(kind, value string) []byte {
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(kind + "\x00" + strings.ToLower(value)))
+	return mac.Sum(nil)
+}
+
+// Pseudonym returns the replacement for value of the given kind (host, ip,
+// email or owner) and remembers it for later text replacement.
+func (a *Anonymizer) Pseudonym(kind, value string) string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return value
+	}
+	if p, ok := a.known[strings.ToLower(value)]; ok {
+		return p
+	}
+	if kind == "owner" && strings.Contains(value, "@") {
+		kind = "email"
+	}
+
+	sum := a.digest(kind, value)
+	var p string
+	switch kind {
+	case "ip":
+		if ip := net.ParseIP(value); ip != nil && ip.To4() == nil {
+			p = fmt.Sprintf("fd00::%x:%x", uint16(sum[0])<<8|uint16(sum[1]), uint16(sum[2])<<8|uint16(sum[3]))
+		} else {
+			p = fmt.Sprintf("10.%d.%d.%d", sum[0], sum[1], sum[2])
+		}
+	case "email":
+		p = "user-" + hex.EncodeToString(sum[:5]) + "@example.invalid"
+	case "owner":
+		p = "owner-" + hex.EncodeToString(sum[:5])
+	default:
+		p = "host-" + hex.EncodeToString(sum[:5])
+	}
+	a.known[strings.ToLower(value)] = p
+	a.re = nil
+	return p
+}
+
+// Records anonymizes JSON records in place. Known fields are replaced
+// first; free-text fields then have every value seen so far, and any IPv4
+// address or email, replaced as well. Set nameIsHost for asset lists, where
+// "name" is the hostname.
+func (a *Anonymizer) Records(items []map[string]interface{}, nameIsHost bool) {
+	for _, item := range items {
+		a.walk(item, nameIsHost, false)
+	}
+	for _, item := range items {
+		a.walk(item, nameIsHost, true)
+	}
+}
+
+func (a *Anonymizer) walk(m map[string]interface{}, nameIsHost, text bool) {
+	for k, v := range m {
+		kind := anonymizeFields[k]
+		if k == "name" && nameIsHost {
+			kind = "host"
+		}
+		if kind != "" {
+			if !text {
+				m[k] = a.value(kind, v)
+			}
+			continue
+		}
+		m[k] = a.nested(v, nameIsHost, text)
+	}
+}
+
+func (a *Anonymizer) value(kind string, v interface{}) interface{} {
+	switch t := v.(type) {
+	case string:
+		return a.Pseudonym(kind, t)
+	case []interface{}:
+		for i := range t {
+			t[i] = a.value(kind, t[i])
+		}
+	}
+	return v
+}
+
+func (a *Anonymizer) nested(v interface{}, nameIsHost, text bool) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		a.walk(t, nameIsHost, text)
+	case []interface{}:
+		for i := range t {
+			t[i] = a.nested(t[i], nameIsHost, text)
+		}
+	case string:
+		if text {
+			return a.Text(t)
+		}
+	}
+	return v
+}
+
+// Text replaces every IPv4 address and email address, and every hostname
+// or owner pseudonymized so far, in free text.
+func (a *Anonymizer) Text(s string) string {
+	s = ipv4Pattern.ReplaceAllStringFunc(s, func(ip string) string {
+		if net.ParseIP(ip) == nil {
+			return ip
+		}
+		return a.Pseudonym("ip", ip)
+	})
+	s = emailPattern.ReplaceAllStringFunc(s, func(e string) string {
+		if strings.HasSuffix(e, "@example.invalid") {
+			return e
+		}
+		return a.Pseudonym("email", e)
+	})
+	if re := a.knownPattern(); re != nil {
+		s = re.ReplaceAllStringFunc(s, func(m string) string {
+			if p, ok := a.known[strings.ToLower(m)]; ok {
+				return p
+			}
+			return m
+		})
+	}
+	return s
+}
+
+// knownPattern matches any remembered original value as a whole word,
+// preferring the longest match.
+func (a *Anonymizer) knownPattern() *regexp.Regexp {
+	if a.re != nil || len(a.known) == 0 {
+		return a.re
+	}
+	originals := make([]string, 0, len(a.known))
+	for o := range a.known {
+		originals = append(originals, regexp.QuoteMeta(o))
+	}
+	sort.Slice(originals, func(i, j int) bool { return len(originals[i]) > len(originals[j]) })
+	a.re = regexp.MustCompile(`(?i)\b(?:` + strings.Join(originals, "|") + `)\b`)
+	return a.re
+}
+
+// anonymizeFile rewrites a downloaded text artifact in place. Binary
+// formats cannot be rewritten safely and are rejected.
+func anonymizeFile(path string, a *Anonymizer) error {
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".csv", ".json", ".xml", ".html", ".htm", ".txt", ".md", ".nessus":
+	default:
+		os.Remove(path)
+		return fmt.Errorf("cannot anonymize %q files; request a text format (csv, json, xml, html)", ext)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(a.Text(string(data))), 0o644)
+}
+
+// learnAssets seeds the anonymizer with the inventory so hostnames and
+// owners are also replaced where they appear in free text.
+func (a *Anonymizer) learnAssets(client *McpClient) error {
+	assets, err := listAll(client, "get_assets", "assets", nil, 500)
+	if err != nil {
+		return err
+	}
+	a.Records(assets, true)
+	return nil
+}
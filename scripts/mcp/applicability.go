@@ -0,0 +1,396 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/schmalle/secman/scripts/mcp/config"
+)
+
+// Requirement applicability records which assets a requirement applies to,
+// by asset type and tag. The server has no place for it, so it is kept in
+// a JSON file next to the config file, or in SECMAN_APPLICABILITY_FILE,
+// which a compliance team can keep in version control.
+//
+// report applicability-gaps joins it with the assessments: a requirement
+// is evaluated for an asset when an assessment of that asset has answered
+// the requirement's question. Every applicable pair without an answer is
+// a gap.
+
+// applicabilityRule limits a requirement to assets of one of Types that
+// carry one of Tags (key=value, or key for any value). An empty list does
+// not limit.
+type applicabilityRule struct {
+	Shortreq string   `json:"shortreq,omitempty"`
+	Types    []string `json:"types,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+}
+
+// applicabilityFile maps requirement ids to their rules.
+type applicabilityFile struct {
+	BaseURL      string                        `json:"baseUrl,omitempty"`
+	Requirements map[string]*applicabilityRule `json:"requirements"`
+}
+
+func applicabilityPath() string {
+	if path := setting("SECMAN_APPLICABILITY_FILE"); path != "" {
+		return path
+	}
+	dir, err := config.Dir()
+	if err != nil {
+		return "secman-applicability.json"
+	}
+	return filepath.Join(dir, "applicability.json")
+}
+
+func loadApplicability() (*applicabilityFile, error) {
+	a := &applicabilityFile{Requirements: map[string]*applicabilityRule{}}
+	data, err := readTextFile(applicabilityPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return a, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, a); err != nil {
+		return nil, fmt.Errorf("%s: %w", applicabilityPath(), err)
+	}
+	if a.Requirements == nil {
+		a.Requirements = map[string]*applicabilityRule{}
+	}
+	return a, nil
+}
+
+// saveApplicability writes the file through a temporary file.
+func saveApplicability(a *applicabilityFile) error {
+	path := applicabilityPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeStateFile(path, append(data, '\n'), 0o644)
+}
+
+// applies reports whether the rule covers the asset.
+func (r *applicabilityRule) applies(asset map[string]interface{}) bool {
+	if len(r.Types) > 0 && !containsFold(r.Types, stringField(asset, "type")) {
+		return false
+	}
+	if len(r.Tags) == 0 {
+		return true
+	}
+	for _, t := range r.Tags {
+		key, value, withValue := strings.Cut(t, "=")
+		have := assetTag(asset, key)
+		if have != "" && (!withValue || strings.EqualFold(have, value)) {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedRequirementIDs lists the requirement ids of the file in numeric
+// order.
+func (a *applicabilityFile) sortedRequirementIDs() []string {
+	ids := make([]string, 0, len(a.Requirements))
+	for id := range a.Requirements {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		x, _ := strconv.ParseInt(ids[i], 10, 64)
+		y, _ := strconv.ParseInt(ids[j], 10, 64)
+		return x < y
+	})
+	return ids
+}
+
+func cmdRequirementApplicability(client *McpClient, osArgs []string) {
+	if len(osArgs) < 1 {
+		fmt.Fprintln(os.Stderr, "Error: requirement applicability subcommand required")
+		fmt.Fprintf(os.Stderr, "Usage: %s requirement applicability <set|list> ...\n", progName())
+		exit(ExitUsage)
+	}
+	switch osArgs[0] {
+	case "set":
+		cmdRequirementApplicabilitySet(client, osArgs[1:])
+	case "list":
+		cmdRequirementApplicabilityList(client, osArgs[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown requirement applicability subcommand: %s\n", osArgs[0])
+		exit(ExitUsage)
+	}
+}
+
+func cmdRequirementApplicabilitySet(client *McpClient, osArgs []string) {
+	fs := flag.NewFlagSet("requirement applicability set", flag.ContinueOnError)
+	var types, tags stringList
+	fs.Var(&types, "type", "Asset type the requirements apply to (repeatable)")
+	fs.Var(&tags, "tag", "Asset tag the requirements apply to, key=value or key (repeatable)")
+	clear := fs.Bool("clear", false, "Remove the requirements' applicability, so they apply to no asset")
+	args := parseInterspersed(fs, osArgs)
+
+	usage := "Usage: " + progName() + " requirement applicability set <requirementId>... (--type T | --tag k=v ... | --clear)"
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: requirement id required")
+		fmt.Fprintln(os.Stderr, usage)
+		exit(ExitUsage)
+	}
+	if *clear == (len(types)+len(tags) > 0) {
+		fmt.Fprintln(os.Stderr, "Error: pass --type and --tag, or --clear")
+		fmt.Fprintln(os.Stderr, usage)
+		exit(ExitUsage)
+	}
+	var ids []int64
+	for _, arg := range args {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid requirement id %q\n", arg)
+			exit(ExitUsage)
+		}
+		ids = append(ids, id)
+	}
+	for _, t := range tags {
+		if key, _, _ := strings.Cut(t, "="); strings.TrimSpace(key) == "" {
+			fmt.Fprintf(os.Stderr, "Error: --tag takes key=value or key, not %q\n", t)
+			exit(ExitUsage)
+		}
+	}
+
+	a, err := loadApplicability()
+	if err != nil {
+		fatal(err)
+	}
+	if *clear {
+		for _, id := range ids {
+			delete(a.Requirements, strconv.FormatInt(id, 10))
+		}
+		if err := saveApplicability(a); err != nil {
+			fatal(err)
+		}
+		status(len(ids), "Cleared the applicability of %d requirement(s)\n", len(ids))
+		return
+	}
+
+	// The short text is stored so the file can be read without the server.
+	reqs, err := listRequirements(client, map[string]interface{}{})
+	if err != nil {
+		fatal(err)
+	}
+	shortreqs := map[int64]string{}
+	for _, r := range reqs {
+		shortreqs[int64(numberField(r, "id"))] = stringField(r, "shortreq")
+	}
+	for _, id := range ids {
+		shortreq, ok := shortreqs[id]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Error: requirement %d not found\n", id)
+			exit(ExitUsage)
+		}
+		rule := &applicabilityRule{Shortreq: shortreq}
+		for _, t := range types {
+			rule.Types = append(rule.Types, strings.ToUpper(strings.TrimSpace(t)))
+		}
+		for _, t := range tags {
+			rule.Tags = append(rule.Tags, strings.TrimSpace(t))
+		}
+		a.Requirements[strconv.FormatInt(id, 10)] = rule
+	}
+	a.BaseURL = client.BaseURL
+	if err := saveApplicability(a); err != nil {
+		fatal(err)
+	}
+	status(len(ids), "Set the applicability of %d requirement(s) in %s\n", len(ids), applicabilityPath())
+}
+
+// applicabilityEntry is a requirement's rule with the number of assets it
+// covers.
+type applicabilityEntry struct {
+	RequirementID int64    `json:"requirementId"`
+	Shortreq      string   `json:"shortreq"`
+	Types         []string `json:"types"`
+	Tags          []string `json:"tags"`
+	Assets        int      `json:"assets"`
+}
+
+func cmdRequirementApplicabilityList(client *McpClient, osArgs []string) {
+	fs := flag.NewFlagSet("requirement applicability list", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "Print the rules as JSON")
+	parseFlags(fs, osArgs)
+
+	a, err := loadApplicability()
+	if err != nil {
+		fatal(err)
+	}
+	assets, err := listAll(client, "get_assets", "assets", map[string]interface{}{}, 500)
+	if err != nil {
+		fatal(err)
+	}
+	entries := []applicabilityEntry{}
+	for _, id := range a.sortedRequirementIDs() {
+		rule := a.Requirements[id]
+		e := applicabilityEntry{Shortreq: rule.Shortreq, Types: rule.Types, Tags: rule.Tags}
+		e.RequirementID, _ = strconv.ParseInt(id, 10, 64)
+		for _, asset := range assets {
+			if !isDecommissioned(asset) && rule.applies(asset) {
+				e.Assets++
+			}
+		}
+		entries = append(entries, e)
+	}
+	if rawOutput(*asJSON) {
+		printResult(entries)
+		return
+	}
+	if len(entries) == 0 {
+		fmt.Printf("No applicability rules in %s\n", applicabilityPath())
+		return
+	}
+	fmt.Printf("%6s  %-40s %-24s %-24s %6s\n", "ID", "REQUIREMENT", "TYPES", "TAGS", "ASSETS")
+	for _, e := range entries {
+		types, tags := strings.Join(e.Types, ","), strings.Join(e.Tags, ",")
+		if types == "" {
+			types = "(any)"
+		}
+		if tags == "" {
+			tags = "(any)"
+		}
+		fmt.Printf("%6d  %-40s %-24s %-24s %6d\n", e.RequirementID, truncate(e.Shortreq, 40), truncate(types, 24), truncate(tags, 24), e.Assets)
+	}
+}
+
+// assessmentAssetID is the asset an assessment is about, or 0 when it is
+// about something else, such as a demand.
+func assessmentAssetID(a map[string]interface{}) int64 {
+	if id := int64(numberField(a, "assetId")); id != 0 {
+		return id
+	}
+	if asset, ok := a["asset"].(map[string]interface{}); ok {
+		return int64(numberField(asset, "id"))
+	}
+	if strings.EqualFold(stringField(a, "assessmentBasisType"), "ASSET") {
+		return int64(numberField(a, "assessmentBasisId"))
+	}
+	return 0
+}
+
+// evaluatedRequirements returns, per asset id, the requirements some
+// assessment of the asset has answered.
+func evaluatedRequirements(client *McpClient) (map[int64]map[int64]bool, error) {
+	content, err := client.callToolMap("get_assessments", map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
+	evaluated := map[int64]map[int64]bool{}
+	for _, a := range mapsField(content, "assessments") {
+		assetID := assessmentAssetID(a)
+		if assetID == 0 {
+			continue
+		}
+		questions, err := client.callToolMap("get_assessment_questions", map[string]interface{}{"assessmentId": a["id"]})
+		if err != nil {
+			return nil, fmt.Errorf("assessment %v: %w", a["id"], err)
+		}
+		for _, q := range mapsField(questions, "questions") {
+			if stringField(q, "answer") == "" {
+				continue
+			}
+			if evaluated[assetID] == nil {
+				evaluated[assetID] = map[int64]bool{}
+			}
+			evaluated[assetID][int64(numberField(q, "requirementId"))] = true
+		}
+	}
+	return evaluated, nil
+}
+
+// applicabilityGap is an asset that has not been evaluated against a
+// requirement that applies to it.
+type applicabilityGap struct {
+	AssetID       int64  `json:"assetId"`
+	AssetName     string `json:"assetName"`
+	AssetType     string `json:"assetType"`
+	Owner         string `json:"owner"`
+	RequirementID int64  `json:"requirementId"`
+	Shortreq      string `json:"shortreq"`
+}
+
+func cmdReportApplicabilityGaps(client *McpClient, osArgs []string) {
+	fs := flag.NewFlagSet("report applicability-gaps", flag.ContinueOnError)
+	requirement := fs.Int64("requirement", 0, "Only check this requirement id")
+	owner := fs.String("owner", "", "Only check assets of this owner")
+	failOnGaps := fs.Bool("fail-on-gaps", false, "Exit with 5 when there are gaps")
+	asJSON := fs.Bool("json", false, "Print the gaps as JSON")
+	parseFlags(fs, osArgs)
+
+	a, err := loadApplicability()
+	if err != nil {
+		fatal(err)
+	}
+	if len(a.Requirements) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: no applicability rules in %s (use requirement applicability set)\n", applicabilityPath())
+		exit(ExitUsage)
+	}
+	filter := map[string]interface{}{}
+	if *owner != "" {
+		filter["owner"] = *owner
+	}
+	assets, err := listAll(client, "get_assets", "assets", filter, 500)
+	if err != nil {
+		fatal(err)
+	}
+	evaluated, err := evaluatedRequirements(client)
+	if err != nil {
+		fatal(err)
+	}
+
+	gaps := []applicabilityGap{}
+	pairs := 0
+	for _, id := range a.sortedRequirementIDs() {
+		reqID, _ := strconv.ParseInt(id, 10, 64)
+		if *requirement != 0 && reqID != *requirement {
+			continue
+		}
+		rule := a.Requirements[id]
+		for _, asset := range assets {
+			if isDecommissioned(asset) || !rule.applies(asset) {
+				continue
+			}
+			pairs++
+			assetID := int64(numberField(asset, "id"))
+			if evaluated[assetID][reqID] {
+				continue
+			}
+			gaps = append(gaps, applicabilityGap{
+				AssetID: assetID, AssetName: stringField(asset, "name"), AssetType: stringField(asset, "type"),
+				Owner: stringField(asset, "owner"), RequirementID: reqID, Shortreq: rule.Shortreq,
+			})
+		}
+	}
+
+	if rawOutput(*asJSON) {
+		printResult(map[string]interface{}{"gaps": gaps, "applicable": pairs, "totalElements": len(gaps)})
+	} else {
+		fmt.Printf("%d of %d applicable requirement/asset pair(s) not evaluated\n", len(gaps), pairs)
+		if len(gaps) > 0 {
+			fmt.Printf("\n%8s  %-30s %-12s %-20s %6s  %s\n", "ASSET", "NAME", "TYPE", "OWNER", "REQ", "REQUIREMENT")
+		}
+		for _, g := range gaps {
+			fmt.Printf("%8d  %-30s %-12s %-20s %6d  %s\n", g.AssetID, truncate(g.AssetName, 30), truncate(g.AssetType, 12),
+				truncate(g.Owner, 20), g.RequirementID, truncate(g.Shortreq, 50))
+		}
+	}
+	if *failOnGaps && len(gaps) > 0 {
+		exit(ExitGateFailed)
+	}
+}
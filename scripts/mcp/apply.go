@@ -0,0 +1,777 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// apply reconciles the server with manifests kept under version control.
+// A manifest is a YAML or JSON file with any of these sections:
+//
+//	workgroups:
+//	  - name: payments
+//	    description: Payments platform
+//	assets:
+//	  - name: web-01
+//	    type: SERVER
+//	    owner: alice
+//	    criticality: HIGH
+//	    environment: prod
+//	    workgroups: [payments]
+//	requirements:
+//	  - shortreq: Administrative access uses MFA
+//	    chapter: Access control
+//	exceptions:
+//	  - subject: CVE
+//	    subjectValue: CVE-2024-1234
+//	    scope: ASSET
+//	    asset: web-01
+//	    reason: ...
+//	    expirationDate: 2026-12-31
+//
+// Records are matched by name (workgroups, assets), shortreq (requirements)
+// or subject and scope (exceptions). Only the fields a manifest sets are
+// compared, so fields it leaves out stay as they are. With --prune, records
+// of a kind the manifests declare (an empty list counts) but do not list
+// are deleted. Asset workgroups are only added: there is no tool to take
+// an asset out of a workgroup.
+//
+// Some changes need tools the server may not have yet. apply checks for
+// them before changing anything, and only for the changes it plans:
+//
+//	list_workgroups                -> workgroups [{id, name, description}]
+//	update_workgroup               workgroupId, description
+//	update_requirement             requirementId, shortreq, details, ...
+//	delete_requirement             requirementId
+//	create_vulnerability_exception subject, subjectValue, scope, scopeValue, assetId, reason, expirationDate
+//	update_vulnerability_exception exceptionId, reason, expirationDate
+//	delete_vulnerability_exception exceptionId
+//
+// Without list_workgroups, workgroups are read from get_all_assets_detail,
+// which does not see workgroups without assets.
+
+// applyKind is a manifest section.
+type applyKind struct {
+	section, noun string
+	fields        []string
+	required      []string
+}
+
+// applyKinds are in the order changes are made; deletions run in reverse.
+var applyKinds = []applyKind{
+	{"workgroups", "workgroup", []string{"name", "description"}, []string{"name"}},
+	{"assets", "asset", []string{"name", "type", "owner", "ip", "uri", "description", "criticality", "adDomain", "cloudAccountId",
+		"environment", "dataClassification", "businessOwner", "tags", "workgroups"}, []string{"name"}},
+	{"requirements", "requirement", []string{"shortreq", "details", "motivation", "example", "norm", "usecase", "chapter"}, []string{"shortreq"}},
+	{"exceptions", "exception", []string{"subject", "subjectValue", "scope", "scopeValue", "asset", "reason", "expirationDate"},
+		[]string{"subject", "scope", "reason", "expirationDate"}},
+}
+
+func applyKindOf(section string) applyKind {
+	for _, k := range applyKinds {
+		if k.section == section {
+			return k
+		}
+	}
+	panic("unknown apply kind " + section)
+}
+
+// applyManifests holds the desired records by section, and which sections
+// some manifest declares.
+type applyManifests struct {
+	records  map[string][]map[string]interface{}
+	declared map[string]bool
+	origin   map[string]string // section/key -> file
+}
+
+// applyKey identifies a record of a section, on both sides.
+func applyKey(section string, rec map[string]interface{}) string {
+	switch section {
+	case "requirements":
+		return strings.TrimSpace(stringField(rec, "shortreq"))
+	case "exceptions":
+		asset := stringField(rec, "asset")
+		if asset == "" {
+			asset = stringField(rec, "assetName")
+		}
+		return strings.ToLower(strings.Join([]string{
+			stringField(rec, "subject"), stringField(rec, "subjectValue"),
+			stringField(rec, "scope"), stringField(rec, "scopeValue"), asset,
+		}, "|"))
+	}
+	return strings.ToLower(strings.TrimSpace(stringField(rec, "name")))
+}
+
+// applyLabel names a record in the plan.
+func applyLabel(section string, rec map[string]interface{}) string {
+	switch section {
+	case "requirements":
+		return fmt.Sprintf("%q", stringField(rec, "shortreq"))
+	case "workgroups", "assets":
+		return fmt.Sprintf("%q", stringField(rec, "name"))
+	}
+	label := stringField(rec, "subject")
+	if v := stringField(rec, "subjectValue"); v != "" {
+		label += " " + v
+	}
+	label += " @ " + stringField(rec, "scope")
+	for _, k := range []string{"scopeValue", "asset", "assetName"} {
+		if v := stringField(rec, k); v != "" {
+			label += " " + v
+			break
+		}
+	}
+	return label
+}
+
+// manifestFiles expands the -f arguments into files; "-" is stdin.
+func manifestFiles(paths []string, recursive bool) ([]string, error) {
+	var files []string
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if p == "-" {
+			files = append(files, p)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, p)
+			continue
+		}
+		err = filepath.WalkDir(p, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if path != p && !recursive {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			switch strings.ToLower(filepath.Ext(path)) {
+			case ".yaml", ".yml", ".json":
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+func loadApplyManifests(files []string) (*applyManifests, error) {
+	m := &applyManifests{records: map[string][]map[string]interface{}{}, declared: map[string]bool{}, origin: map[string]string{}}
+	for _, file := range files {
+		var data []byte
+		var err error
+		if file == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = readTextFile(file)
+		}
+		if err != nil {
+			return nil, err
+		}
+		var doc interface{}
+		if strings.EqualFold(filepath.Ext(file), ".json") {
+			err = json.Unmarshal(data, &doc)
+		} else {
+			doc, err = parseYAML(data)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		if doc == nil {
+			continue
+		}
+		sections, ok := doc.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: a manifest is a mapping of sections (workgroups, assets, requirements, exceptions)", file)
+		}
+		for section, raw := range sections {
+			if err := m.add(file, section, raw); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return m, nil
+}
+
+func (m *applyManifests) add(file, section string, raw interface{}) error {
+	var kind *applyKind
+	for i := range applyKinds {
+		if applyKinds[i].section == section {
+			kind = &applyKinds[i]
+		}
+	}
+	if kind == nil {
+		return fmt.Errorf("%s: unknown section %q (use workgroups, assets, requirements or exceptions)", file, section)
+	}
+	m.declared[section] = true
+	if raw == nil {
+		return nil
+	}
+	items, ok := raw.([]interface{})
+	if !ok {
+		return fmt.Errorf("%s: %s must be a list", file, section)
+	}
+	for i, item := range items {
+		rec, ok := item.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: %s[%d] must be a mapping", file, section, i)
+		}
+		for field := range rec {
+			if !containsFold(kind.fields, field) {
+				return fmt.Errorf("%s: %s[%d]: unknown field %q (use %s)", file, section, i, field, strings.Join(kind.fields, ", "))
+			}
+		}
+		for _, field := range kind.required {
+			if stringField(rec, field) == "" {
+				return fmt.Errorf("%s: %s[%d]: %s is required", file, section, i, field)
+			}
+		}
+		if c := stringField(rec, "criticality"); section == "assets" && c != "" && !containsFold(criticalityLevels, c) {
+			return fmt.Errorf("%s: %s[%d]: criticality must be one of %s", file, section, i, strings.Join(criticalityLevels, ", "))
+		}
+		key := section + "/" + applyKey(section, rec)
+		if prev, dup := m.origin[key]; dup {
+			return fmt.Errorf("%s: %s %s is also defined in %s", file, kind.noun, applyLabel(section, rec), prev)
+		}
+		m.origin[key] = file
+		m.records[section] = append(m.records[section], rec)
+	}
+	return nil
+}
+
+// applyAction is one planned change.
+type applyAction struct {
+	op      string // create, update or delete
+	section string
+	desired map[string]interface{}
+	current map[string]interface{}
+	changes []string
+	tools   []string
+}
+
+func (a *applyAction) String() string {
+	kind := applyKindOf(a.section)
+	rec := a.desired
+	if rec == nil {
+		rec = a.current
+	}
+	sign := map[string]string{"create": "+", "update": "~", "delete": "-"}[a.op]
+	line := fmt.Sprintf("%s %s %s", sign, kind.noun, applyLabel(a.section, rec))
+	if len(a.changes) > 0 {
+		line += " (" + strings.Join(a.changes, "; ") + ")"
+	}
+	return line
+}
+
+// applyState is the server side: current records by section and key, and
+// the ids of workgroups and assets by lower-case name.
+type applyState struct {
+	records         map[string]map[string]map[string]interface{}
+	workgroupIDs    map[string]interface{}
+	assetWorkgroups map[string][]string
+	assetIDs        map[string]interface{}
+}
+
+// loadApplyState reads what the manifests need from the server.
+func loadApplyState(client *McpClient, m *applyManifests) (*applyState, error) {
+	sections := map[string]bool{}
+	for section := range m.declared {
+		sections[section] = true
+	}
+	if len(m.records["exceptions"]) > 0 {
+		sections["assets"] = true
+	}
+	withWorkgroups := false
+	for _, a := range m.records["assets"] {
+		withWorkgroups = withWorkgroups || a["workgroups"] != nil
+	}
+	return readApplyState(client, sections, withWorkgroups)
+}
+
+// readApplyState reads the records of the sections, and with
+// withWorkgroups the workgroups of each asset.
+func readApplyState(client *McpClient, sections map[string]bool, withWorkgroups bool) (*applyState, error) {
+	s := &applyState{
+		records:         map[string]map[string]map[string]interface{}{},
+		workgroupIDs:    map[string]interface{}{},
+		assetWorkgroups: map[string][]string{},
+		assetIDs:        map[string]interface{}{},
+	}
+	needAssets := sections["assets"]
+	needDetail := withWorkgroups || sections["workgroups"]
+
+	var workgroups []map[string]interface{}
+	if needDetail {
+		details, err := listAll(client, "get_all_assets_detail", "assets", map[string]interface{}{}, 500)
+		if err != nil {
+			return nil, fmt.Errorf("asset workgroups: %w", err)
+		}
+		seen := map[string]bool{}
+		for _, a := range details {
+			list, _ := a["workgroups"].([]interface{})
+			for _, w := range list {
+				wg, ok := w.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				name := stringField(wg, "name")
+				key := strings.ToLower(stringField(a, "name"))
+				s.assetWorkgroups[key] = append(s.assetWorkgroups[key], name)
+				if !seen[strings.ToLower(name)] {
+					seen[strings.ToLower(name)] = true
+					workgroups = append(workgroups, wg)
+				}
+			}
+		}
+	}
+	if sections["workgroups"] {
+		if ok, _ := client.HasTool("list_workgroups"); ok {
+			content, err := client.callToolMap("list_workgroups", map[string]interface{}{})
+			if err != nil {
+				return nil, err
+			}
+			workgroups = mapsField(content, "workgroups")
+		}
+	}
+	s.index("workgroups", workgroups)
+	for key, wg := range s.records["workgroups"] {
+		s.workgroupIDs[key] = wg["id"]
+	}
+
+	if needAssets {
+		assets, err := listAll(client, "get_assets", "assets", nil, 500)
+		if err != nil {
+			return nil, err
+		}
+		s.index("assets", assets)
+		for key, a := range s.records["assets"] {
+			s.assetIDs[key] = a["id"]
+		}
+	}
+	if sections["requirements"] {
+		reqs, err := listRequirements(client, map[string]interface{}{"detailed": true})
+		if err != nil {
+			return nil, err
+		}
+		s.index("requirements", reqs)
+	}
+	if sections["exceptions"] {
+		content, err := client.callToolMap("list_vulnerability_exceptions", map[string]interface{}{"includeAffectedCount": false})
+		if err != nil {
+			return nil, err
+		}
+		s.index("exceptions", mapsField(content, "exceptions"))
+	}
+	return s, nil
+}
+
+func (s *applyState) index(section string, recs []map[string]interface{}) {
+	byKey := map[string]map[string]interface{}{}
+	for _, r := range recs {
+		byKey[applyKey(section, r)] = r
+	}
+	s.records[section] = byKey
+}
+
+// currentValue reads a manifest field from a server record.
+func currentValue(section, field string, rec map[string]interface{}) string {
+	switch {
+	case section == "assets" && (field == "environment" || field == "dataClassification" || field == "businessOwner"):
+		return assetContext(rec)[field]
+	case section == "requirements" && field == "details":
+		return stringField(rec, "description")
+	case section == "exceptions" && field == "asset":
+		return stringField(rec, "assetName")
+	}
+	return stringField(rec, field)
+}
+
+// desiredValue normalizes a manifest field for comparison and for calls.
+func desiredValue(field string, rec map[string]interface{}) string {
+	v := strings.TrimSpace(stringField(rec, field))
+	switch field {
+	case "criticality", "subject", "scope":
+		return strings.ToUpper(v)
+	case "environment":
+		return normalizeEnvironment(v)
+	}
+	return v
+}
+
+// fieldChange is one field a record would change.
+type fieldChange struct {
+	Field, Before, After string
+}
+
+// recordChanges lists the fields where the server record differs from the
+// desired one. Tags are compared per desired key; workgroups are left to
+// diffRecord.
+func recordChanges(section string, desired, current map[string]interface{}) []fieldChange {
+	var changes []fieldChange
+	for _, field := range applyKindOf(section).fields {
+		if _, set := desired[field]; !set {
+			continue
+		}
+		switch field {
+		case "tags":
+			tags, _ := desired["tags"].(map[string]interface{})
+			keys := make([]string, 0, len(tags))
+			for k := range tags {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				if want, have := stringField(tags, k), assetTag(current, k); want != have {
+					changes = append(changes, fieldChange{"tag " + k, have, want})
+				}
+			}
+		case "workgroups":
+		default:
+			want, have := desiredValue(field, desired), currentValue(section, field, current)
+			if field == "expirationDate" && len(want) == 10 && len(have) > 10 {
+				have = have[:10]
+			}
+			if field == "criticality" || field == "subject" || field == "scope" {
+				have = strings.ToUpper(have)
+			}
+			if want != have && !(field == "name" && strings.EqualFold(want, have)) {
+				changes = append(changes, fieldChange{field, have, want})
+			}
+		}
+	}
+	return changes
+}
+
+// diffRecord lists the fields where the server differs from the manifest.
+func diffRecord(section string, desired, current map[string]interface{}, wgs []string) []string {
+	var changes []string
+	for _, c := range recordChanges(section, desired, current) {
+		changes = append(changes, fmt.Sprintf("%s: %q -> %q", c.Field, c.Before, c.After))
+	}
+	for _, wg := range stringsField(desired, "workgroups") {
+		if !containsFold(wgs, wg) {
+			changes = append(changes, "workgroup + "+wg)
+		}
+	}
+	return changes
+}
+
+// planApply compares manifests and server and returns the changes in the
+// order they are made.
+func planApply(m *applyManifests, s *applyState, prune bool) ([]*applyAction, error) {
+	var plan, deletes []*applyAction
+	for _, kind := range applyKinds {
+		wanted := map[string]bool{}
+		for _, rec := range m.records[kind.section] {
+			key := applyKey(kind.section, rec)
+			wanted[key] = true
+			current := s.records[kind.section][key]
+			if current == nil {
+				a := &applyAction{op: "create", section: kind.section, desired: rec, tools: createTools[kind.section]}
+				if kind.section == "assets" && (stringField(rec, "type") == "" || stringField(rec, "owner") == "") {
+					return nil, fmt.Errorf("asset %q does not exist; type and owner are needed to create it", stringField(rec, "name"))
+				}
+				plan = append(plan, a)
+				continue
+			}
+			changes := diffRecord(kind.section, rec, current, s.assetWorkgroups[key])
+			if len(changes) > 0 {
+				plan = append(plan, &applyAction{op: "update", section: kind.section, desired: rec, current: current,
+					changes: changes, tools: updateTools(kind.section, changes)})
+			}
+		}
+		if !prune || !m.declared[kind.section] {
+			continue
+		}
+		keys := make([]string, 0, len(s.records[kind.section]))
+		for key := range s.records[kind.section] {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if !wanted[key] {
+				deletes = append(deletes, &applyAction{op: "delete", section: kind.section, current: s.records[kind.section][key],
+					tools: []string{deleteTools[kind.section]}})
+			}
+		}
+	}
+	for i := len(deletes) - 1; i >= 0; i-- {
+		plan = append(plan, deletes[i])
+	}
+	return plan, nil
+}
+
+var createTools = map[string][]string{
+	"workgroups":   {"create_workgroup"},
+	"assets":       {"create_asset"},
+	"requirements": {"add_requirement"},
+	"exceptions":   {"create_vulnerability_exception"},
+}
+
+var deleteTools = map[string]string{
+	"workgroups":   "delete_workgroup",
+	"assets":       "delete_asset",
+	"requirements": "delete_requirement",
+	"exceptions":   "delete_vulnerability_exception",
+}
+
+func updateTools(section string, changes []string) []string {
+	switch section {
+	case "workgroups":
+		return []string{"update_workgroup"}
+	case "requirements":
+		return []string{"update_requirement"}
+	case "exceptions":
+		return []string{"update_vulnerability_exception"}
+	}
+	var tools []string
+	for _, c := range changes {
+		tool := "update_asset"
+		if strings.HasPrefix(c, "workgroup + ") {
+			tool = "assign_assets_to_workgroup"
+		}
+		if !containsFold(tools, tool) {
+			tools = append(tools, tool)
+		}
+	}
+	return tools
+}
+
+// assetApplyArgs are the asset fields of a manifest record for
+// create_asset or update_asset; tags holds the tag-backed ones.
+func assetApplyArgs(rec map[string]interface{}) (args map[string]interface{}, tags map[string]interface{}) {
+	args, tags = map[string]interface{}{}, map[string]interface{}{}
+	for _, k := range []string{"name", "type", "owner", "ip", "uri", "description", "criticality", "adDomain", "cloudAccountId"} {
+		if _, set := rec[k]; set {
+			args[k] = desiredValue(k, rec)
+		}
+	}
+	for _, t := range assetContextTags {
+		if _, set := rec[t.field]; set {
+			tags[t.key] = desiredValue(t.field, rec)
+		}
+	}
+	extra, _ := rec["tags"].(map[string]interface{})
+	for k := range extra {
+		tags[k] = stringField(extra, k)
+	}
+	return args, tags
+}
+
+// recordApplyArgs copies the manifest fields a tool takes as they are.
+func recordApplyArgs(rec map[string]interface{}, fields ...string) map[string]interface{} {
+	args := map[string]interface{}{}
+	for _, k := range fields {
+		if _, set := rec[k]; set {
+			args[k] = desiredValue(k, rec)
+		}
+	}
+	return args
+}
+
+// runApplyAction makes one change; ids of created workgroups and assets are
+// added to the state for the changes that follow.
+func runApplyAction(client *McpClient, s *applyState, a *applyAction) error {
+	rec := a.desired
+	switch a.section + "/" + a.op {
+	case "workgroups/create":
+		content, err := client.callToolMap("create_workgroup", recordApplyArgs(rec, "name", "description"))
+		if err == nil {
+			s.workgroupIDs[applyKey(a.section, rec)] = content["id"]
+		}
+		return err
+	case "workgroups/update":
+		_, err := client.callUpdate("update_workgroup", map[string]interface{}{
+			"workgroupId": a.current["id"], "description": stringField(rec, "description"),
+		}, a.current)
+		return err
+
+	case "assets/create", "assets/update":
+		args, tags := assetApplyArgs(rec)
+		key := applyKey(a.section, rec)
+		if a.op == "create" {
+			content, err := client.callToolMap("create_asset", args)
+			if err != nil {
+				return err
+			}
+			s.assetIDs[key] = content["id"]
+			args = map[string]interface{}{}
+		}
+		id := s.assetIDs[key]
+		if len(tags) > 0 {
+			args["tags"] = tags
+		}
+		if containsFold(a.tools, "update_asset") || (a.op == "create" && len(tags) > 0) {
+			if id != nil {
+				args["assetId"] = id
+			}
+			if _, err := client.callUpdate("update_asset", args, a.current); err != nil {
+				return err
+			}
+		}
+		for _, wg := range stringsField(rec, "workgroups") {
+			if containsFold(s.assetWorkgroups[key], wg) {
+				continue
+			}
+			wgID := s.workgroupIDs[strings.ToLower(wg)]
+			if wgID == nil && !client.dryRun {
+				return fmt.Errorf("workgroup %q does not exist (declare it under workgroups)", wg)
+			}
+			if _, err := client.callToolMap("assign_assets_to_workgroup", map[string]interface{}{
+				"workgroupId": wgID, "assetIds": []interface{}{id},
+			}); err != nil {
+				return fmt.Errorf("workgroup %s: %w", wg, err)
+			}
+		}
+		return nil
+
+	case "requirements/create":
+		_, err := client.callToolMap("add_requirement", recordApplyArgs(rec, applyKindOf(a.section).fields...))
+		return err
+	case "requirements/update":
+		args := recordApplyArgs(rec, applyKindOf(a.section).fields...)
+		args["requirementId"] = a.current["id"]
+		_, err := client.callUpdate("update_requirement", args, a.current)
+		return err
+
+	case "exceptions/create":
+		args := recordApplyArgs(rec, "subject", "subjectValue", "scope", "scopeValue", "reason", "expirationDate")
+		if asset := stringField(rec, "asset"); asset != "" {
+			id := s.assetIDs[strings.ToLower(asset)]
+			if id == nil && !client.dryRun {
+				return fmt.Errorf("asset %q does not exist", asset)
+			}
+			args["assetId"] = id
+		}
+		_, err := client.callToolMap("create_vulnerability_exception", args)
+		return err
+	case "exceptions/update":
+		args := recordApplyArgs(rec, "reason", "expirationDate")
+		args["exceptionId"] = a.current["id"]
+		_, err := client.callUpdate("update_vulnerability_exception", args, a.current)
+		return err
+	}
+
+	if a.op == "delete" {
+		idArg := map[string]string{
+			"workgroups": "workgroupId", "assets": "assetId", "requirements": "requirementId", "exceptions": "exceptionId",
+		}[a.section]
+		_, err := client.callToolMap(deleteTools[a.section], map[string]interface{}{idArg: a.current["id"]})
+		return err
+	}
+	return fmt.Errorf("cannot %s %s", a.op, a.section)
+}
+
+func cmdApply(client *McpClient, osArgs []string) {
+	fs := flag.NewFlagSet("apply", flag.ContinueOnError)
+	var paths stringList
+	fs.Var(&paths, "f", "Manifest file or directory, - for stdin (repeatable)")
+	fs.Var(&paths, "filename", "Same as -f")
+	recursive := fs.Bool("R", false, "Also read manifests in subdirectories")
+	prune := fs.Bool("prune", false, "Delete records of the declared kinds that no manifest lists")
+	diff := fs.Bool("diff", false, "Only print the changes; exit 5 when there are any")
+	yes := addYesFlag(fs)
+	parseFlags(fs, osArgs)
+
+	if len(paths) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: -f required")
+		fmt.Fprintf(os.Stderr, "Usage: %s apply -f <file|dir>... [-R] [--prune] [--diff] [--yes]\n", progName())
+		exit(ExitUsage)
+	}
+	files, err := manifestFiles(paths, *recursive)
+	if err != nil {
+		fatal(err)
+	}
+	manifests, err := loadApplyManifests(files)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(ExitUsage)
+	}
+	if len(manifests.declared) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: no manifests found")
+		exit(ExitUsage)
+	}
+
+	state, err := loadApplyState(client, manifests)
+	if err != nil {
+		fatal(err)
+	}
+	plan, err := planApply(manifests, state, *prune)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(ExitUsage)
+	}
+	if len(plan) == 0 {
+		status(0, "No changes: the server matches the manifests\n")
+		return
+	}
+
+	if *diff {
+		for _, a := range plan {
+			fmt.Println(a)
+		}
+		exit(ExitGateFailed)
+	}
+	runApplyPlan(client, state, plan, *yes)
+}
+
+// runApplyPlan checks that the server has the tools the plan needs,
+// confirms deletions and makes the changes in order.
+func runApplyPlan(client *McpClient, s *applyState, plan []*applyAction, yes bool) {
+	var summary, needed []string
+	deletes := 0
+	for _, a := range plan {
+		summary = append(summary, a.String())
+		if a.op == "delete" {
+			deletes++
+		}
+		for _, tool := range a.tools {
+			if !containsFold(needed, tool) {
+				needed = append(needed, tool)
+			}
+		}
+	}
+	sort.Strings(needed)
+	for _, tool := range needed {
+		if err := client.requireTool(tool); err != nil {
+			fatal(fmt.Errorf("%w; the planned changes need it", err))
+		}
+	}
+	if deletes > 0 {
+		if err := confirm(client, yes, fmt.Sprintf("apply %d change(s), %d of them deletions", len(plan), deletes), summary); err != nil {
+			fatal(err)
+		}
+	}
+
+	counts := map[string]int{}
+	failed := 0
+	for _, a := range plan {
+		if err := runApplyAction(client, s, a); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", a, err)
+			failed++
+			continue
+		}
+		status(nil, "%s\n", a)
+		counts[a.op]++
+	}
+	status(nil, "%d created, %d updated, %d deleted\n", counts["create"], counts["update"], counts["delete"])
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d change(s) failed\n", failed)
+		exit(ExitPartial)
+	}
+}
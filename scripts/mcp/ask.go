@@ -0,0 +1,338 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// ask answers a question in plain language, such as "which prod servers
+// have critical vulns older than 30 days?". The LLM at SECMAN_LLM_URL gets
+// the question and the server's tools with their inputSchema, and answers
+// with a plan: tool calls, or queries in the language of the query command
+// where the answer needs a join the tools cannot do. The plan is checked
+// against the schemas, shown, and run once confirmed; the results are
+// printed here. Only the question and the tool list leave the host, never
+// the results.
+//
+// The plan may only use read tools; --allow-writes lets it change records
+// too, still after confirmation.
+
+const askSystemPrompt = `You translate questions about a vulnerability
+management system into a plan of steps. Each step is either a call of one
+of the tools listed below, with arguments that follow its inputSchema, or a
+query. Prefer a query when the question filters on fields a tool cannot
+filter on, or joins findings with their assets.
+
+A query is "vulnerabilities" or "assets", then optionally "where
+<condition>", "order by <field> [asc|desc]" and "limit <n>". Conditions
+combine comparisons with and, or, not and parentheses. Comparisons are
+field = value, !=, <, <=, >, >= (numbers, dates or text), field ~ value
+(contains), field in (a, b) and field exists. A date compared with a time
+expression such as 30d means longer ago than that, so lastSeen < 30d is
+"last seen over 30 days ago".
+Vulnerability fields: severity (CRITICAL, HIGH, MEDIUM, LOW), cve, ageDays,
+overdueStatus, and asset.<field> of the finding's asset.
+Asset fields: name, type (SERVER, WORKSTATION, ...), owner, ip,
+criticality, lastSeen, groups, tag.<key> such as tag.environment
+(production, staging, test, development), and the open finding counts
+open, open.critical, open.high, open.medium, open.low and open.overdue.
+A step with a query may list "fields" to show, dotted like asset.name.
+
+Answer with one JSON object and nothing else:
+{"steps": [{"tool": "<name>", "arguments": {...}, "why": "<short reason>"},
+           {"query": "<query>", "fields": ["..."], "why": "<short reason>"}],
+ "explanation": "<one sentence on how the results answer the question>"}
+Use as few steps as answer the question. If no tool or query can answer
+it, return no steps and say why in the explanation.`
+
+// askStep is one step of a plan.
+type askStep struct {
+	Tool      string                 `json:"tool,omitempty"`
+	Arguments map[string]interface{} `json:"arguments,omitempty"`
+	Query     string                 `json:"query,omitempty"`
+	Fields    []string               `json:"fields,omitempty"`
+	Why       string                 `json:"why,omitempty"`
+	Result    interface{}            `json:"result,omitempty"`
+	Error     string                 `json:"error,omitempty"`
+
+	parsed *parsedQuery
+}
+
+func (s *askStep) String() string {
+	if s.Query != "" {
+		text := "query " + s.Query
+		if len(s.Fields) > 0 {
+			text += " --fields " + strings.Join(s.Fields, ",")
+		}
+		return text
+	}
+	args, _ := json.Marshal(s.Arguments)
+	return s.Tool + " " + string(args)
+}
+
+// askPlan is the LLM's answer.
+type askPlan struct {
+	Question    string     `json:"question"`
+	Steps       []*askStep `json:"steps"`
+	Explanation string     `json:"explanation"`
+	Model       string     `json:"model"`
+}
+
+// askTools lists the tools the plan may use, with their schemas.
+func askTools(client *McpClient, allowWrites bool) (string, error) {
+	names, err := client.ToolNames()
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for _, name := range names {
+		if isMutatingTool(name) && !allowWrites {
+			continue
+		}
+		def, _, _ := client.Tool(name)
+		schema, _ := json.Marshal(def.InputSchema)
+		fmt.Fprintf(&b, "- %s: %s\n  inputSchema: %s\n", name, strings.TrimSpace(def.Description), schema)
+	}
+	return b.String(), nil
+}
+
+// parseAskPlan reads the plan from an answer, which some models wrap in a
+// code fence or in prose.
+func parseAskPlan(answer string) (*askPlan, error) {
+	start, end := strings.Index(answer, "{"), strings.LastIndex(answer, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("the answer holds no JSON plan: %s", truncate(strings.TrimSpace(answer), 200))
+	}
+	var plan askPlan
+	if err := json.Unmarshal([]byte(answer[start:end+1]), &plan); err != nil {
+		return nil, fmt.Errorf("the plan is not valid JSON: %w", err)
+	}
+	return &plan, nil
+}
+
+// checkAskPlan validates every step, returning what is wrong.
+func checkAskPlan(client *McpClient, plan *askPlan, allowWrites bool) []string {
+	var problems []string
+	for i, s := range plan.Steps {
+		prefix := fmt.Sprintf("step %d: ", i+1)
+		switch {
+		case s.Query != "" && s.Tool != "":
+			problems = append(problems, prefix+"has both a tool and a query")
+		case s.Query != "":
+			q, err := parseQuery(s.Query)
+			if err != nil {
+				problems = append(problems, prefix+"query: "+err.Error())
+				continue
+			}
+			for _, f := range s.Fields {
+				q.fields = append(q.fields, strings.Split(f, "."))
+			}
+			s.parsed = q
+		case s.Tool != "":
+			def, ok, err := client.Tool(s.Tool)
+			if err != nil {
+				problems = append(problems, prefix+err.Error())
+				continue
+			}
+			if !ok {
+				problems = append(problems, prefix+fmt.Sprintf("no tool %q", s.Tool))
+				continue
+			}
+			if isMutatingTool(s.Tool) && !allowWrites {
+				problems = append(problems, prefix+fmt.Sprintf("%s changes records and --allow-writes is not set", s.Tool))
+				continue
+			}
+			if s.Arguments == nil {
+				s.Arguments = map[string]interface{}{}
+			}
+			p, _ := validateArgs(def, s.Arguments)
+			for _, msg := range p {
+				problems = append(problems, prefix+s.Tool+": "+msg)
+			}
+		default:
+			problems = append(problems, prefix+"has neither a tool nor a query")
+		}
+	}
+	return problems
+}
+
+func cmdAsk(client *McpClient, osArgs []string) {
+	fs := flag.NewFlagSet("ask", flag.ContinueOnError)
+	model := fs.String("model", setting("SECMAN_LLM_MODEL"), "Model to ask (default: SECMAN_LLM_MODEL)")
+	allowWrites := fs.Bool("allow-writes", false, "Let the plan call tools that change records")
+	planOnly := fs.Bool("plan", false, "Print the plan without running it")
+	asJSON := fs.Bool("json", false, "Print the plan and the results as JSON")
+	yes := addYesFlag(fs)
+	words := parseInterspersed(fs, osArgs)
+	usage := "Usage: " + progName() + ` ask "which prod servers have critical vulns older than 30 days?" [--plan] [--yes]`
+	if len(words) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: question required")
+		fmt.Fprintln(os.Stderr, usage)
+		exit(ExitUsage)
+	}
+	question := strings.Join(words, " ")
+	endpoint := strings.TrimRight(setting("SECMAN_LLM_URL"), "/")
+	if endpoint == "" || *model == "" {
+		fmt.Fprintln(os.Stderr, "Error: ask needs an LLM: set SECMAN_LLM_URL and SECMAN_LLM_MODEL (or --model)")
+		fmt.Fprintln(os.Stderr, "Without one, use query for questions like this")
+		exit(ExitUsage)
+	}
+
+	tools, err := askTools(client, *allowWrites)
+	if err != nil {
+		fatal(err)
+	}
+	messages := []llmMessage{
+		{Role: "system", Content: askSystemPrompt + "\n\nTools:\n" + tools},
+		{Role: "user", Content: question},
+	}
+	// A plan that does not fit the schemas goes back once with the
+	// problems; models usually fix it then.
+	var plan *askPlan
+	for attempt := 0; ; attempt++ {
+		answer, err := llmChat(client, endpoint, *model, messages, true)
+		if err != nil {
+			fatal(err)
+		}
+		plan, err = parseAskPlan(answer)
+		var problems []string
+		if err != nil {
+			problems = []string{err.Error()}
+		} else {
+			problems = checkAskPlan(client, plan, *allowWrites)
+		}
+		if len(problems) == 0 {
+			break
+		}
+		if attempt == 1 {
+			fmt.Fprintln(os.Stderr, "Error: the plan does not fit the tools:")
+			for _, p := range problems {
+				fmt.Fprintf(os.Stderr, "  %s\n", p)
+			}
+			exit(ExitUsage)
+		}
+		messages = append(messages, llmMessage{Role: "assistant", Content: answer},
+			llmMessage{Role: "user", Content: "The plan has problems:\n- " + strings.Join(problems, "\n- ") + "\nAnswer with a corrected plan."})
+	}
+	plan.Question, plan.Model = question, *model
+
+	if len(plan.Steps) == 0 {
+		fmt.Fprintf(os.Stderr, "No plan: %s\n", orNone(plan.Explanation))
+		exit(ExitNotFound)
+	}
+	writes := 0
+	lines := make([]string, len(plan.Steps))
+	for i, s := range plan.Steps {
+		lines[i] = fmt.Sprintf("%d. %s", i+1, s)
+		if s.Tool != "" && isMutatingTool(s.Tool) {
+			lines[i] += "  " + paint(styleFail, "(changes records)")
+			writes++
+		}
+		if s.Why != "" {
+			lines[i] += "\n     " + s.Why
+		}
+	}
+	if *planOnly {
+		if rawOutput(*asJSON) {
+			printResult(plan)
+			return
+		}
+		fmt.Println(strings.Join(lines, "\n"))
+		if plan.Explanation != "" {
+			fmt.Printf("\n%s\n", plan.Explanation)
+		}
+		return
+	}
+	action := "run this plan"
+	if writes > 0 {
+		action = fmt.Sprintf("run this plan, which changes records in %d step(s)", writes)
+	}
+	if err := confirm(client, *yes, action, lines); err != nil {
+		fatal(err)
+	}
+
+	now := time.Now()
+	failed := 0
+	for _, s := range plan.Steps {
+		var err error
+		if s.parsed != nil {
+			var matched []map[string]interface{}
+			if matched, err = runQuery(client, s.parsed, now); err == nil {
+				if len(s.Fields) > 0 {
+					fields := make([][]string, len(s.Fields))
+					for i, f := range s.Fields {
+						fields[i] = strings.Split(f, ".")
+					}
+					projectQueryFields(s.parsed, matched, fields, now)
+				}
+				s.Result = map[string]interface{}{s.parsed.entity: matched, "totalElements": len(matched)}
+			}
+		} else {
+			s.Result, err = client.callToolMap(s.Tool, s.Arguments)
+		}
+		if err != nil {
+			s.Error = err.Error()
+			failed++
+		}
+	}
+
+	if rawOutput(*asJSON) {
+		printResult(plan)
+	} else {
+		for i, s := range plan.Steps {
+			if len(plan.Steps) > 1 {
+				fmt.Printf("%d. %s\n", i+1, s)
+			}
+			if s.Error != "" {
+				fmt.Fprintf(os.Stderr, "Error: %s\n", s.Error)
+			} else if err := (tableRenderer{}).Render(os.Stdout, askTable(s)); err != nil {
+				fatal(err)
+			}
+			fmt.Println()
+		}
+		if plan.Explanation != "" {
+			status(0, "%s\n", plan.Explanation)
+		}
+	}
+	if failed > 0 {
+		exit(ExitPartial)
+	}
+}
+
+// askTable trims a tool result for the table: columns with nested values,
+// which tabulate prints as JSON, are dropped, except tags and groups.
+func askTable(s *askStep) interface{} {
+	if s.parsed != nil {
+		return s.Result
+	}
+	data, err := normalize(s.Result)
+	if err != nil {
+		return s.Result
+	}
+	var list []interface{}
+	if m, ok := data.(map[string]interface{}); ok {
+		for _, k := range objectKeys(m) {
+			if l, ok := m[k].([]interface{}); ok && len(l) > len(list) && isObjectList(l) {
+				list = l
+			}
+		}
+	}
+	if list == nil {
+		return s.Result
+	}
+	for _, item := range list {
+		for k, v := range item.(map[string]interface{}) {
+			switch v.(type) {
+			case map[string]interface{}, []interface{}:
+				if k != "tags" && k != "groups" {
+					delete(item.(map[string]interface{}), k)
+				}
+			}
+		}
+	}
+	return list
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// AssessmentAnswer is one questionnaire answer. Questions in a risk
+// assessment are the requirements in its scope, so answers are keyed by
+// requirement id.
+type AssessmentAnswer struct {
+	RequirementID int64  `json:"requirementId"`
+	Answer        string `json:"answer"`
+	Comment       string `json:"comment,omitempty"`
+}
+
+func cmdAssessment(client *McpClient, osArgs []string) {
+	if len(osArgs) < 1 {
+		fmt.Fprintln(os.Stderr, "Error: assessment subcommand required")
+		fmt.Fprintf(os.Stderr, "Usage: %s assessment <list|questions|answer|submit> ...\n", progName())
+		exit(ExitUsage)
+	}
+
+	switch osArgs[0] {
+	case "list":
+		cmdAssessmentList(client)
+	case "questions":
+		cmdAssessmentQuestions(client, osArgs[1:])
+	case "answer":
+		cmdAssessmentAnswer(client, osArgs[1:])
+	case "submit":
+		cmdAssessmentSubmit(client, osArgs[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown assessment subcommand: %s\n", osArgs[0])
+		exit(ExitUsage)
+	}
+}
+
+func parseAssessmentID(osArgs []string, usageLine string) int64 {
+	if len(osArgs) < 1 {
+		fmt.Fprintln(os.Stderr, "Error: assessment id required")
+		fmt.Fprintln(os.Stderr, "Usage: "+usageLine)
+		exit(ExitUsage)
+	}
+	id, err := strconv.ParseInt(osArgs[0], 10, 64)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid assessment id: %v\n", err)
+		exit(ExitUsage)
+	}
+	return id
+}
+
+func cmdAssessmentList(client *McpClient) {
+	result, err := client.CallTool("get_assessments", map[string]interface{}{})
+	if err != nil {
+		fatal(err)
+	}
+
+	printResult(result)
+}
+
+func cmdAssessmentQuestions(client *McpClient, osArgs []string) {
+	id := parseAssessmentID(osArgs, progName()+" assessment questions <assessmentId> [--unanswered] [--json]")
+
+	fs := flag.NewFlagSet("assessment questions", flag.ContinueOnError)
+	unanswered := fs.Bool("unanswered", false, "Only show questions without an answer")
+	asJSON := fs.Bool("json", false, "Print the raw tool result as JSON")
+	parseFlags(fs, osArgs[1:])
+
+	content, err := client.callToolMap("get_assessment_questions", map[string]interface{}{
+		"assessmentId": id,
+	})
+	if err != nil {
+		fatal(err)
+	}
+	if rawOutput(*asJSON) {
+		printResult(content)
+		return
+	}
+
+	questions, _ := content["questions"].([]interface{})
+	shown := 0
+	for _, item := range questions {
+		q, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		answer, _ := q["answer"].(string)
+		if *unanswered && answer != "" {
+			continue
+		}
+		if answer == "" {
+			answer = "-"
+		}
+		fmt.Printf("%6v  %-4s  %v\n", q["requirementId"], answer, q["shortreq"])
+		shown++
+	}
+	fmt.Printf("\n%d of %d question(s)\n", shown, len(questions))
+}
+
+func cmdAssessmentAnswer(client *McpClient, osArgs []string) {
+	id := parseAssessmentID(osArgs, progName()+" assessment answer <assessmentId> (--requirement <id> --answer YES|NO|N_A [--comment text] | --file answers.yaml|csv)")
+
+	fs := flag.NewFlagSet("assessment answer", flag.ContinueOnError)
+	requirementID := fs.Int64("requirement", 0, "Requirement (question) id")
+	answer := fs.String("answer", "", "Answer: YES, NO or N_A")
+	comment := fs.String("comment", "", "Optional comment")
+	file := fs.String("file", "", "Import answers from a YAML or CSV file")
+	parseFlags(fs, osArgs[1:])
+
+	var answers []AssessmentAnswer
+	switch {
+	case *file != "":
+		loaded, err := loadAssessmentAnswers(*file)
+		if err != nil {
+			fatal(err)
+		}
+		answers = loaded
+	case *requirementID > 0 && *answer != "":
+		answers = []AssessmentAnswer{{RequirementID: *requirementID, Answer: *answer, Comment: *comment}}
+	default:
+		fmt.Fprintln(os.Stderr, "Error: either --file or --requirement and --answer are required")
+		exit(ExitUsage)
+	}
+
+	// Validate everything before sending anything, so a typo on line 40 of
+	// an answer file doesn't leave the questionnaire half-filled.
+	for i := range answers {
+		normalized, err := normalizeAnswer(answers[i].Answer)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: requirement %d: %v\n", answers[i].RequirementID, err)
+			exit(ExitUsage)
+		}
+		answers[i].Answer = normalized
+	}
+
+	failed := 0
+	for _, a := range answers {
+		_, err := client.callToolMap("answer_assessment_question", map[string]interface{}{
+			"assessmentId":  id,
+			"requirementId": a.RequirementID,
+			"answer":        a.Answer,
+			"comment":       a.Comment,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: requirement %d: %v\n", a.RequirementID, err)
+			failed++
+		}
+	}
+
+	status(len(answers)-failed, "Answered %d of %d question(s)\n", len(answers)-failed, len(answers))
+	if failed > 0 {
+		exit(ExitPartial)
+	}
+}
+
+func cmdAssessmentSubmit(client *McpClient, osArgs []string) {
+	id := parseAssessmentID(osArgs, progName()+" assessment submit <assessmentId>")
+
+	result, err := client.CallTool("submit_assessment", map[string]interface{}{
+		"assessmentId": id,
+	})
+	if err != nil {
+		fatal(err)
+	}
+
+	printResult(result)
+}
+
+// normalizeAnswer maps common spellings onto the server's answer enum.
+func normalizeAnswer(answer string) (string, error) {
+	switch strings.ToUpper(strings.TrimSpace(answer)) {
+	case "YES", "Y", "TRUE":
+		return "YES", nil
+	case "NO", "N", "FALSE":
+		return "NO", nil
+	case "N_A", "N/A", "NA", "NOT_APPLICABLE":
+		return "N_A", nil
+	}
+	return "", fmt.Errorf("invalid answer %q (expected YES, NO or N_A)", answer)
+}
+
+// loadAssessmentAnswers reads answers from a CSV file with a
+// requirementId,answer,comment header, or from YAML containing a list of
+// answers (optionally under an "answers" key).
+func loadAssessmentAnswers(path string) ([]AssessmentAnswer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return readAnswersCSV(f)
+	case ".yaml", ".yml":
+		data, err := io.ReadAll(f)
+		if err != nil {
+			return nil, err
+		}
+		return readAnswersYAML(data)
+	}
+	return nil, fmt.Errorf("unsupported answer file %s (use .csv, .yaml or .yml)", path)
+}
+
+func readAnswersCSV(r io.Reader) ([]AssessmentAnswer, error) {
+	cr := csv.NewReader(skipBOM(r))
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read csv header: %w", err)
+	}
+
+	cols := map[string]int{}
+	for i, h := range header {
+		cols[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	reqCol, ok1 := cols["requirementid"]
+	ansCol, ok2 := cols["answer"]
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf("csv header must contain requirementId and answer columns")
+	}
+	commentCol, hasComment := cols["comment"]
+
+	var answers []AssessmentAnswer
+	for line := 2; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return answers, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if reqCol >= len(rec) || ansCol >= len(rec) {
+			return nil, fmt.Errorf("csv line %d: missing columns", line)
+		}
+		id, err := strconv.ParseInt(strings.TrimSpace(rec[reqCol]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("csv line %d: invalid requirementId: %w", line, err)
+		}
+		a := AssessmentAnswer{RequirementID: id, Answer: rec[ansCol]}
+		if hasComment && commentCol < len(rec) {
+			a.Comment = rec[commentCol]
+		}
+		answers = append(answers, a)
+	}
+}
+
+func readAnswersYAML(data []byte) ([]AssessmentAnswer, error) {
+	doc, err := parseYAML(data)
+	if err != nil {
+		return nil, err
+	}
+	if m, ok := doc.(map[string]interface{}); ok {
+		doc = m["answers"]
+	}
+	items, ok := doc.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("yaml must be a list of answers or contain an answers list")
+	}
+
+	answers := make([]AssessmentAnswer, 0, len(items))
+	for i, item := range items {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("answer %d: expected a mapping", i+1)
+		}
+		id, ok := m["requirementId"].(float64)
+		if !ok {
+			return nil, fmt.Errorf("answer %d: requirementId must be a number", i+1)
+		}
+		a := AssessmentAnswer{RequirementID: int64(id)}
+		a.Answer = fmt.Sprint(m["answer"])
+		if c, ok := m["comment"].(string); ok {
+			a.Comment = strings.TrimRight(c, "\n")
+		}
+		answers = append(answers, a)
+	}
+	return answers, nil
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+func cmdAsset(client *McpClient, osArgs []string) {
+	if len(osArgs) < 1 {
+		fmt.Fprintln(os.Stderr, "Error: asset subcommand required")
+		fmt.Fprintf(os.Stderr, "Usage: %s asset <delete|assign|set|update|decommission|decommission-candidates> ...\n", progName())
+		exit(ExitUsage)
+	}
+
+	switch osArgs[0] {
+	case "delete":
+		cmdAssetDelete(client, osArgs[1:])
+	case "assign":
+		cmdAssetAssign(client, osArgs[1:])
+	case "set":
+		cmdAssetSet(client, osArgs[1:])
+	case "update":
+		cmdAssetUpdate(client, osArgs[1:])
+	case "decommission":
+		cmdAssetDecommission(client, osArgs[1:])
+	case "decommission-candidates":
+		cmdAssetDecommissionCandidates(client, osArgs[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown asset subcommand: %s\n", osArgs[0])
+		exit(ExitUsage)
+	}
+}
+
+// assetSelection holds the ways a bulk asset command can pick its targets:
+// ids as arguments, a get_assets filter, or records on stdin. context, if
+// set, adds business context filters.
+type assetSelection struct {
+	name, assetType, ip, owner *string
+	stdin                      *bool
+	context                    *assetContextFilter
+}
+
+func addAssetSelectionFlags(fs *flag.FlagSet, verb string) *assetSelection {
+	return &assetSelection{
+		name:      fs.String("name", "", verb+" assets whose name matches (partial match)"),
+		assetType: fs.String("type", "", verb+" assets of this type"),
+		ip:        fs.String("ip", "", verb+" assets whose IP matches (partial match)"),
+		owner:     fs.String("owner", "", verb+" assets of this owner"),
+		stdin:     fs.Bool("stdin", false, "Read asset ids or asset JSON from stdin"),
+	}
+}
+
+// resolve returns the selected assets. Records from ids carry only "id".
+func (s *assetSelection) resolve(client *McpClient, ids []string, usageLine string) []map[string]interface{} {
+	filter := map[string]interface{}{}
+	for key, value := range map[string]string{"name": *s.name, "type": *s.assetType, "ip": *s.ip, "owner": *s.owner} {
+		if value != "" {
+			filter[key] = value
+		}
+	}
+
+	byContext := s.context != nil && s.context.active()
+	sources := 0
+	for _, used := range []bool{len(ids) > 0, len(filter) > 0 || byContext, *s.stdin} {
+		if used {
+			sources++
+		}
+	}
+	if sources > 1 {
+		fmt.Fprintln(os.Stderr, "Error: pass asset ids, filters or --stdin, not several")
+		exit(ExitUsage)
+	}
+
+	switch {
+	case len(ids) > 0:
+		var targets []map[string]interface{}
+		for _, arg := range ids {
+			id, err := strconv.ParseInt(arg, 10, 64)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: invalid asset id %q\n", arg)
+				exit(ExitUsage)
+			}
+			targets = append(targets, map[string]interface{}{"id": float64(id)})
+		}
+		return targets
+	case len(filter) > 0 || byContext:
+		assets, err := listAll(client, "get_assets", "assets", filter, 500)
+		if err != nil {
+			fatal(err)
+		}
+		if byContext {
+			assets = s.context.filter(assets)
+		}
+		return assets
+	case *s.stdin:
+		items, err := readStdinItems(os.Stdin)
+		if err != nil {
+			fatal(err)
+		}
+		ids, err := recordIDs(items, "assetId", "id")
+		if err != nil {
+			fatal(err)
+		}
+		for i, id := range ids {
+			items[i]["id"] = float64(id)
+		}
+		return items
+	}
+
+	fmt.Fprintln(os.Stderr, "Error: asset ids, a filter or --stdin required")
+	fmt.Fprintln(os.Stderr, "Usage: "+usageLine)
+	exit(ExitUsage)
+	return nil
+}
+
+// assetSummary lists up to 20 assets for a confirmation prompt.
+func assetSummary(headline string, targets []map[string]interface{}) []string {
+	summary := []string{headline}
+	for i, a := range targets {
+		if i == 20 {
+			summary = append(summary, fmt.Sprintf("... and %d more", len(targets)-20))
+			break
+		}
+		if stringField(a, "name") == "" {
+			summary = append(summary, fmt.Sprintf("id %v", a["id"]))
+			continue
+		}
+		summary = append(summary, fmt.Sprintf("%-8v %-30s %-15s %s", a["id"], stringField(a, "name"), stringField(a, "ip"), stringField(a, "owner")))
+	}
+	return summary
+}
+
+// cmdAssetDelete deletes assets by id, get_assets filter or stdin. Matches
+// are listed and confirmed before anything is deleted.
+func cmdAssetDelete(client *McpClient, osArgs []string) {
+	fs := flag.NewFlagSet("asset delete", flag.ContinueOnError)
+	sel := addAssetSelectionFlags(fs, "Delete")
+	sel.context = addAssetContextFlags(fs, "criticality")
+	yes := addYesFlag(fs)
+	ids := parseInterspersed(fs, osArgs)
+
+	targets := sel.resolve(client, ids, progName()+" asset delete <id>... | --name/--type/--ip/--owner/--criticality/--environment ... | --stdin [--yes]")
+	if len(targets) == 0 {
+		status(0, "No matching assets\n")
+		return
+	}
+	if err := client.requireTool("delete_asset"); err != nil {
+		fatal(err)
+	}
+
+	summary := assetSummary(fmt.Sprintf("%d asset(s) and their vulnerabilities", len(targets)), targets)
+	if err := confirm(client, *yes, "delete assets", summary); err != nil {
+		fatal(err)
+	}
+
+	deleted, failed := 0, 0
+	progress := startProgress("Deleting assets", "assets", int64(len(targets)))
+	defer progress.Finish()
+	for _, a := range targets {
+		_, err := client.callToolMap("delete_asset", map[string]interface{}{"assetId": int64(numberField(a, "id"))})
+		progress.Add(1)
+		if err != nil {
+			progress.Warnf("  asset %v: %v\n", a["id"], err)
+			failed++
+			continue
+		}
+		deleted++
+	}
+	progress.Finish()
+
+	status(deleted, "Deleted %d asset(s)\n", deleted)
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d deletion(s) failed\n", failed)
+		exit(ExitPartial)
+	}
+}
+
+// cmdAssetAssign sets the owner of assets (update_asset) or adds them to a
+// workgroup (assign_assets_to_workgroup).
+func cmdAssetAssign(client *McpClient, osArgs []string) {
+	fs := flag.NewFlagSet("asset assign", flag.ContinueOnError)
+	to := fs.String("to", "", "New owner of the assets")
+	workgroup := fs.Int64("workgroup", 0, "Add the assets to this workgroup id")
+	sel := addAssetSelectionFlags(fs, "Assign")
+	sel.context = addAssetContextFlags(fs, "criticality")
+	yes := addYesFlag(fs)
+	ids := parseInterspersed(fs, osArgs)
+
+	if (*to == "") == (*workgroup == 0) {
+		fmt.Fprintln(os.Stderr, "Error: exactly one of --to or --workgroup is required")
+		exit(ExitUsage)
+	}
+
+	targets := sel.resolve(client, ids, progName()+" asset assign --to <owner>|--workgroup <id> <id>... | --name/--type/--ip/--owner/--criticality/--environment ... | --stdin [--yes]")
+	if len(targets) == 0 {
+		status(0, "No matching assets\n")
+		return
+	}
+
+	if *workgroup != 0 {
+		if err := client.requireTool("assign_assets_to_workgroup"); err != nil {
+			fatal(err)
+		}
+		if err := confirm(client, *yes, fmt.Sprintf("add assets to workgroup %d", *workgroup),
+			assetSummary(fmt.Sprintf("%d asset(s)", len(targets)), targets)); err != nil {
+			fatal(err)
+		}
+		assetIDs := make([]int64, len(targets))
+		for i, a := range targets {
+			assetIDs[i] = int64(numberField(a, "id"))
+		}
+		if _, err := client.callToolMap("assign_assets_to_workgroup", map[string]interface{}{
+			"workgroupId": *workgroup,
+			"assetIds":    assetIDs,
+		}); err != nil {
+			fatal(err)
+		}
+		status(len(targets), "Added %d asset(s) to workgroup %d\n", len(targets), *workgroup)
+		return
+	}
+
+	if err := client.requireTool("update_asset"); err != nil {
+		fatal(err)
+	}
+	if err := confirm(client, *yes, "change the owner to "+*to,
+		assetSummary(fmt.Sprintf("%d asset(s)", len(targets)), targets)); err != nil {
+		fatal(err)
+	}
+
+	updated, failed := 0, 0
+	progress := startProgress("Assigning assets", "assets", int64(len(targets)))
+	defer progress.Finish()
+	for _, a := range targets {
+		args := map[string]interface{}{"assetId": int64(numberField(a, "id")), "owner": *to}
+		current := a
+		if stringField(a, "owner") == "" {
+			current = nil
+		}
+		_, err := client.callUpdate("update_asset", args, current)
+		progress.Add(1)
+		if err != nil {
+			progress.Warnf("  asset %v: %v\n", a["id"], err)
+			failed++
+			continue
+		}
+		updated++
+	}
+	progress.Finish()
+
+	status(updated, "Assigned %d asset(s) to %s\n", updated, *to)
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d update(s) failed\n", failed)
+		exit(ExitPartial)
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Prioritization starts with business context: how critical an asset is,
+// whether it is production, what data it holds and who answers for it.
+// Criticality is an asset field; the others are asset tags under fixed
+// keys, so they also work with --tag filters elsewhere:
+//
+//	environment=production   (prod, stage and dev are accepted on input)
+//	data-classification=confidential
+//	business-owner=alice@example.com
+
+// assetContextTags are the tag-backed context fields, by flag name.
+var assetContextTags = []struct{ flag, key, field string }{
+	{"environment", "environment", "environment"},
+	{"classification", "data-classification", "dataClassification"},
+	{"business-owner", "business-owner", "businessOwner"},
+}
+
+// criticalityLevels are the values of the asset criticality field.
+var criticalityLevels = []string{"CRITICAL", "HIGH", "MEDIUM", "LOW", "NA"}
+
+// environmentNames maps accepted environment names to the stored one.
+var environmentNames = map[string]string{
+	"prod": "production", "production": "production", "prd": "production",
+	"stage": "staging", "staging": "staging", "stg": "staging",
+	"dev": "development", "development": "development",
+	"test": "test", "qa": "test",
+}
+
+// environmentOrder ranks environments for sorting, production first.
+var environmentOrder = []string{"production", "staging", "test", "development"}
+
+func normalizeEnvironment(s string) string {
+	if name, ok := environmentNames[strings.ToLower(strings.TrimSpace(s))]; ok {
+		return name
+	}
+	return strings.ToLower(strings.TrimSpace(s))
+}
+
+// assetTag returns the value of the asset's tag key, or "".
+func assetTag(asset map[string]interface{}, key string) string {
+	for _, t := range stringsField(asset, "tags") {
+		if k, v, ok := strings.Cut(t, "="); ok && strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return ""
+}
+
+// assetContext returns the business context of an asset by output field.
+func assetContext(asset map[string]interface{}) map[string]string {
+	ctx := map[string]string{"criticality": strings.ToUpper(stringField(asset, "criticality"))}
+	for _, t := range assetContextTags {
+		ctx[t.field] = assetTag(asset, t.key)
+	}
+	ctx["environment"] = normalizeEnvironment(ctx["environment"])
+	return ctx
+}
+
+// assetContextFilter selects assets by business context. Each flag takes
+// a comma-separated list of accepted values.
+type assetContextFilter struct {
+	criticality *string
+	tags        map[string]*string
+}
+
+// addAssetContextFlags registers the context filters; critFlag names the
+// criticality flag, which vulnerability views call --asset-criticality.
+func addAssetContextFlags(fs *flag.FlagSet, critFlag string) *assetContextFilter {
+	f := &assetContextFilter{
+		criticality: fs.String(critFlag, "", "Only assets of this criticality (CRITICAL, HIGH, MEDIUM, LOW, NA; comma-separated)"),
+		tags:        map[string]*string{},
+	}
+	f.tags["environment"] = fs.String("environment", "", "Only assets in this environment (prod, stage, dev, ...; comma-separated)")
+	f.tags["classification"] = fs.String("classification", "", "Only assets with this data classification (comma-separated)")
+	f.tags["business-owner"] = fs.String("business-owner", "", "Only assets of this business owner (comma-separated)")
+	return f
+}
+
+func (f *assetContextFilter) active() bool {
+	if *f.criticality != "" {
+		return true
+	}
+	for _, v := range f.tags {
+		if *v != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *assetContextFilter) matches(asset map[string]interface{}) bool {
+	ctx := assetContext(asset)
+	if *f.criticality != "" && !containsFold(splitList(*f.criticality), ctx["criticality"]) {
+		return false
+	}
+	for _, t := range assetContextTags {
+		want := *f.tags[t.flag]
+		if want == "" {
+			continue
+		}
+		accepted := splitList(want)
+		if t.key == "environment" {
+			for i := range accepted {
+				accepted[i] = normalizeEnvironment(accepted[i])
+			}
+		}
+		if !containsFold(accepted, ctx[t.field]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *assetContextFilter) filter(assets []map[string]interface{}) []map[string]interface{} {
+	out := make([]map[string]interface{}, 0, len(assets))
+	for _, a := range assets {
+		if f.matches(a) {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// vulnSortKeys are the --sort keys of vulnerability views.
+var vulnSortKeys = []string{"criticality", "environment", "classification", "business-owner", "severity", "days-open"}
+
+// sortFindings orders findings annotated by annotateFindings by key, most
+// important first, then by severity.
+func sortFindings(findings []map[string]interface{}, key string) {
+	rank := func(f map[string]interface{}) int {
+		switch key {
+		case "criticality":
+			for i, c := range criticalityLevels {
+				if strings.EqualFold(stringField(f, "assetCriticality"), c) {
+					return len(criticalityLevels) - i
+				}
+			}
+		case "environment":
+			for i, e := range environmentOrder {
+				if stringField(f, "environment") == e {
+					return len(environmentOrder) - i
+				}
+			}
+		case "days-open":
+			days, _ := parseDays(stringField(f, "daysOpen"))
+			return days
+		}
+		return 0
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		switch key {
+		case "classification", "business-owner":
+			field := "dataClassification"
+			if key == "business-owner" {
+				field = "businessOwner"
+			}
+			va, vb := stringField(a, field), stringField(b, field)
+			if va != vb {
+				// Findings without a value go last.
+				return vb == "" || (va != "" && va < vb)
+			}
+		case "severity":
+		default:
+			if ra, rb := rank(a), rank(b); ra != rb {
+				return ra > rb
+			}
+		}
+		return severityRank(strings.ToUpper(stringField(a, "cvssSeverity"))) > severityRank(strings.ToUpper(stringField(b, "cvssSeverity")))
+	})
+}
+
+// annotateFindings adds the business context of each finding's asset,
+// from assets by id.
+func annotateFindings(findings []map[string]interface{}, assets map[int64]map[string]interface{}) {
+	for _, f := range findings {
+		ctx := assetContext(assets[findingAssetID(f)])
+		f["assetCriticality"] = ctx["criticality"]
+		for _, t := range assetContextTags {
+			f[t.field] = ctx[t.field]
+		}
+	}
+}
+
+// assetsByID fetches every asset, keyed by id.
+func assetsByID(client *McpClient) (map[int64]map[string]interface{}, error) {
+	assets, err := listAll(client, "get_assets", "assets", map[string]interface{}{}, 500)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[int64]map[string]interface{}, len(assets))
+	for _, a := range assets {
+		out[int64(numberField(a, "id"))] = a
+	}
+	return out, nil
+}
+
+// cmdAssetSet sets the criticality and business context of assets with
+// update_asset.
+func cmdAssetSet(client *McpClient, osArgs []string) {
+	fs := flag.NewFlagSet("asset set", flag.ContinueOnError)
+	criticality := fs.String("criticality", "", "Criticality (CRITICAL, HIGH, MEDIUM, LOW, NA)")
+	environment := fs.String("environment", "", "Environment (prod, stage, dev, test or another name)")
+	classification := fs.String("classification", "", "Data classification (e.g. public, internal, confidential)")
+	businessOwner := fs.String("business-owner", "", "Business owner")
+	var clear stringList
+	fs.Var(&clear, "clear", "Remove a context field: environment, classification or business-owner (repeatable)")
+	sel := addAssetSelectionFlags(fs, "Update")
+	yes := addYesFlag(fs)
+	ids := parseInterspersed(fs, osArgs)
+
+	args := map[string]interface{}{}
+	tags := map[string]interface{}{}
+	if *criticality != "" {
+		if !containsFold(criticalityLevels, *criticality) {
+			fmt.Fprintf(os.Stderr, "Error: --criticality must be one of %s\n", strings.Join(criticalityLevels, ", "))
+			exit(ExitUsage)
+		}
+		args["criticality"] = strings.ToUpper(*criticality)
+	}
+	values := map[string]string{"environment": normalizeEnvironment(*environment), "classification": *classification, "business-owner": *businessOwner}
+	for _, t := range assetContextTags {
+		if v := strings.TrimSpace(values[t.flag]); v != "" {
+			tags[t.key] = v
+		}
+	}
+	for _, name := range clear {
+		key := ""
+		for _, t := range assetContextTags {
+			if t.flag == name {
+				key = t.key
+			}
+		}
+		if key == "" {
+			fmt.Fprintf(os.Stderr, "Error: --clear takes environment, classification or business-owner, not %q\n", name)
+			exit(ExitUsage)
+		}
+		if _, set := tags[key]; set {
+			fmt.Fprintf(os.Stderr, "Error: --%s and --clear %s conflict\n", name, name)
+			exit(ExitUsage)
+		}
+		tags[key] = ""
+	}
+	if len(tags) > 0 {
+		args["tags"] = tags
+	}
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: nothing to set (use --criticality, --environment, --classification, --business-owner or --clear)")
+		exit(ExitUsage)
+	}
+
+	targets := sel.resolve(client, ids, progName()+" asset set <id>... | --name/--type/--ip/--owner ... | --stdin --criticality/--environment/--classification/--business-owner ... [--yes]")
+	if len(targets) == 0 {
+		status(0, "No matching assets\n")
+		return
+	}
+	if err := client.requireTool("update_asset"); err != nil {
+		fatal(err)
+	}
+	if len(tags) > 0 {
+		if ok, _ := client.toolAccepts("update_asset", "tags"); !ok {
+			fatal(fmt.Errorf("update_asset on %s does not take tags; the server needs updating to set environment, classification or business owner", client.BaseURL))
+		}
+	}
+	if err := confirm(client, *yes, "update the business context", assetSummary(fmt.Sprintf("%d asset(s)", len(targets)), targets)); err != nil {
+		fatal(err)
+	}
+
+	updated, failed := 0, 0
+	progress := startProgress("Updating assets", "assets", int64(len(targets)))
+	defer progress.Finish()
+	for _, a := range targets {
+		call := map[string]interface{}{"assetId": int64(numberField(a, "id"))}
+		for k, v := range args {
+			call[k] = v
+		}
+		current := a
+		if stringField(a, "name") == "" {
+			current = nil
+		}
+		_, err := client.callUpdate("update_asset", call, current)
+		progress.Add(1)
+		if err != nil {
+			progress.Warnf("  asset %v: %v\n", a["id"], err)
+			failed++
+			continue
+		}
+		updated++
+	}
+	progress.Finish()
+
+	status(updated, "Updated %d asset(s)\n", updated)
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d update(s) failed\n", failed)
+		exit(ExitPartial)
+	}
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Every mutating tool call sent to the server is recorded in a local
+// append-only JSONL file, one entry per call. Each entry carries the hash
+// of the previous one and its own hash over its content, so editing,
+// removing or reordering entries breaks the chain and is reported by
+// `audit-log verify`. Arguments are stored only as a hash; the log says who
+// changed what, not the data that was sent.
+//
+// The log is audit.jsonl in the state directory (~/.secman_audit.jsonl if
+// that exists from an earlier version) unless SECMAN_AUDIT_LOG names
+// another file; SECMAN_AUDIT_LOG=off disables it.
+
+// auditGenesis is the previous hash of the first entry.
+var auditGenesis = strings.Repeat("0", 64)
+
+type auditEntry struct {
+	Seq       int64  `json:"seq"`
+	Time      string `json:"time"`
+	OSUser    string `json:"osUser"`
+	UserEmail string `json:"userEmail,omitempty"`
+	APIKey    string `json:"apiKey"`
+	Tenant    string `json:"tenant,omitempty"`
+	BaseURL   string `json:"baseUrl"`
+	Command   string `json:"command,omitempty"`
+	Tool      string `json:"tool"`
+	ArgsHash  string `json:"argsSha256"`
+	Result    string `json:"result"`
+	Error     string `json:"error,omitempty"`
+	Prev      string `json:"prev"`
+	Hash      string `json:"hash"`
+}
+
+// Audit results.
+const (
+	auditOK        = "ok"
+	auditToolError = "tool-error"
+	auditError     = "error"
+)
+
+// currentCommand is the CLI command being run, recorded with each entry.
+var currentCommand string
+
+// auditMu serializes appends within the process; lockFile covers other
+// processes writing the same log.
+var auditMu sync.Mutex
+
+// auditLogPath returns the configured log file, or "" when it is disabled.
+func auditLogPath() string {
+	path := setting("SECMAN_AUDIT_LOG")
+	switch {
+	case strings.EqualFold(path, "off"):
+		return ""
+	case path != "":
+		return path
+	}
+	return statePath(".secman_audit.jsonl", "audit.jsonl")
+}
+
+// recordAudit logs a mutating call. A log that cannot be written is
+// reported but does not fail the call, which has already been sent.
+func (c *McpClient) recordAudit(tool string, args map[string]interface{}, result *ToolCallResult, callErr error) {
+	if c.auditLog == "" {
+		return
+	}
+	argsJSON, _ := json.Marshal(args)
+	argsSum := sha256.Sum256(argsJSON)
+	keySum := sha256.Sum256([]byte(c.APIKey))
+	entry := auditEntry{
+		Time:      time.Now().UTC().Format(time.RFC3339Nano),
+		OSUser:    osUserName(),
+		UserEmail: c.UserEmail,
+		APIKey:    "sha256:" + hex.EncodeToString(keySum[:6]),
+		Tenant:    c.Tenant,
+		BaseURL:   c.BaseURL,
+		Command:   currentCommand,
+		Tool:      tool,
+		ArgsHash:  hex.EncodeToString(argsSum[:]),
+		Result:    auditOK,
+	}
+	switch {
+	case callErr != nil:
+		entry.Result, entry.Error = auditError, redactString(callErr.Error())
+	case result != nil && result.IsError:
+		entry.Result = auditToolError
+	}
+	if err := appendAudit(c.auditLog, &entry); err != nil {
+		pauseProgress(func() { fmt.Fprintf(os.Stderr, "Warning: audit log: %v\n", err) })
+	}
+}
+
+func osUserName() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// appendAudit chains entry to the last entry of the log and appends it.
+func appendAudit(path string, entry *auditEntry) error {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := lockFile(f); err != nil {
+		return err
+	}
+	defer unlockFile(f)
+
+	last, err := lastAuditEntry(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w (run audit-log verify)", path, err)
+	}
+	entry.Seq, entry.Prev = 1, auditGenesis
+	if last != nil {
+		entry.Seq, entry.Prev = last.Seq+1, last.Hash
+	}
+	line, err := sealAudit(entry)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// sealAudit sets the entry's hash and returns its JSON line.
+func sealAudit(entry *auditEntry) ([]byte, error) {
+	entry.Hash = ""
+	unsealed, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(unsealed)
+	entry.Hash = hex.EncodeToString(sum[:])
+	return json.Marshal(entry)
+}
+
+// lastAuditEntry reads the final entry from the tail of the log.
+func lastAuditEntry(f *os.File) (*auditEntry, error) {
+	info, err := f.Stat()
+	if err != nil || info.Size() == 0 {
+		return nil, err
+	}
+	const tail = 64 << 10
+	offset := info.Size() - tail
+	if offset < 0 {
+		offset = 0
+	}
+	buf := make([]byte, info.Size()-offset)
+	if _, err := f.ReadAt(buf, offset); err != nil && err != io.EOF {
+		return nil, err
+	}
+	buf = bytes.TrimRight(buf, "\n")
+	if i := bytes.LastIndexByte(buf, '\n'); i >= 0 {
+		buf = buf[i+1:]
+	} else if offset > 0 {
+		return nil, errors.New("last entry is too long")
+	}
+	var entry auditEntry
+	if err := json.Unmarshal(buf, &entry); err != nil || entry.Hash == "" {
+		return nil, errors.New("last entry is not a valid audit record")
+	}
+	return &entry, nil
+}
+
+func cmdAuditLog(osArgs []string) {
+	if len(osArgs) < 1 {
+		fmt.Fprintln(os.Stderr, "Error: audit-log subcommand required")
+		fmt.Fprintf(os.Stderr, "Usage: %s audit-log <verify|show> [--file <path>] [--since <time>]\n", progName())
+		exit(ExitUsage)
+	}
+
+	fs := flag.NewFlagSet("audit-log "+osArgs[0], flag.ContinueOnError)
+	file := fs.String("file", auditLogPath(), "Audit log file (default: SECMAN_AUDIT_LOG or audit.jsonl in the state directory)")
+	last := fs.Int("last", 20, "Number of entries to show (0 for all)")
+	timeFlags := addTimeRangeFlags(fs, "created", "entries written", true)
+	parseFlags(fs, osArgs[1:])
+	within := timeFlags.resolve()
+	if *file == "" {
+		fmt.Fprintln(os.Stderr, "Error: the audit log is disabled (SECMAN_AUDIT_LOG=off); pass --file")
+		exit(ExitUsage)
+	}
+
+	switch osArgs[0] {
+	case "verify":
+		n, head, err := verifyAuditLog(*file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s %s: %v\n", paintErr(styleFail, "FAILED"), *file, err)
+			exit(ExitGateFailed)
+		}
+		status(n, "%s %s: %d entries, chain intact (head %s)\n", paint(styleOK, "OK"), *file, n, shortHash(head))
+	case "show":
+		entries, err := readAuditLog(*file)
+		if err != nil {
+			fatal(err)
+		}
+		if within.set() {
+			kept := entries[:0]
+			for _, e := range entries {
+				if t, err := time.Parse(time.RFC3339Nano, e.Time); err == nil && within.contains(t) {
+					kept = append(kept, e)
+				}
+			}
+			entries = kept
+		}
+		if *last > 0 && len(entries) > *last {
+			entries = entries[len(entries)-*last:]
+		}
+		printResult(entries)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown audit-log subcommand: %s\n", osArgs[0])
+		exit(ExitUsage)
+	}
+}
+
+func shortHash(h string) string {
+	if len(h) > 12 {
+		return h[:12]
+	}
+	return h
+}
+
+// readAuditLog parses every entry without checking the chain.
+func readAuditLog(path string) ([]auditEntry, error) {
+	entries := []auditEntry{}
+	err := scanAuditLog(path, func(n int, line []byte) error {
+		var entry auditEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return fmt.Errorf("line %d: %w", n, err)
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	return entries, err
+}
+
+// verifyAuditLog checks every entry: it must be exactly the JSON its fields
+// produce, its hash must match its content, and it must follow the
+// previous entry. It returns the entry count and the last hash.
+func verifyAuditLog(path string) (int, string, error) {
+	prev, seq, count := auditGenesis, int64(0), 0
+	err := scanAuditLog(path, func(n int, line []byte) error {
+		var entry auditEntry
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&entry); err != nil {
+			return fmt.Errorf("line %d: not an audit record: %w", n, err)
+		}
+		hash := entry.Hash
+		sealed, err := sealAudit(&entry)
+		if err != nil {
+			return err
+		}
+		switch {
+		case entry.Hash != hash || !bytes.Equal(sealed, line):
+			return fmt.Errorf("line %d (seq %d): content does not match its hash", n, entry.Seq)
+		case entry.Prev != prev:
+			return fmt.Errorf("line %d (seq %d): chain broken, previous entry missing or altered", n, entry.Seq)
+		case entry.Seq != seq+1:
+			return fmt.Errorf("line %d: sequence %d follows %d", n, entry.Seq, seq)
+		}
+		prev, seq = hash, entry.Seq
+		count++
+		return nil
+	})
+	return count, prev, err
+}
+
+func scanAuditLog(path string, fn func(n int, line []byte) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for n := 1; scanner.Scan(); n++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		if err := fn(n, scanner.Bytes()); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Azure DevOps is reached through its REST API. SECMAN_AZURE_DEVOPS_URL is
+// the organization (https://dev.azure.com/example) or, on Azure DevOps
+// Server, the collection URL; SECMAN_AZURE_DEVOPS_PROJECT is the project
+// and SECMAN_AZURE_DEVOPS_TOKEN a personal access token with the Work
+// Items (Read & write) scope.
+//
+// Work items are tagged secman and with their correlation id, so running
+// `ticket azure-devops` again skips findings that already have an open
+// work item.
+
+type adoClient struct {
+	baseURL string
+	project string
+	token   string
+	http    *http.Client
+}
+
+// adoAPIVersion is the REST API version; 7.0 is served by Azure DevOps
+// Services and Azure DevOps Server 2022.
+const adoAPIVersion = "7.0"
+
+// adoClosedStates are the states of finished work items across the Basic,
+// Agile, Scrum and CMMI processes. A finding whose work item is in one of
+// them gets a new work item.
+var adoClosedStates = []string{"Closed", "Done", "Removed"}
+
+func newADOClient(client *McpClient) (*adoClient, error) {
+	a := &adoClient{
+		baseURL: strings.TrimRight(setting("SECMAN_AZURE_DEVOPS_URL"), "/"),
+		project: setting("SECMAN_AZURE_DEVOPS_PROJECT"),
+		token:   setting("SECMAN_AZURE_DEVOPS_TOKEN"),
+	}
+	if a.baseURL == "" || a.project == "" {
+		return nil, fmt.Errorf("SECMAN_AZURE_DEVOPS_URL and SECMAN_AZURE_DEVOPS_PROJECT are required")
+	}
+	if a.token == "" {
+		return nil, fmt.Errorf("SECMAN_AZURE_DEVOPS_TOKEN is required")
+	}
+	registerSecret(a.token)
+
+	a.http = externalHTTPClient(client, 60*time.Second)
+	return a, nil
+}
+
+// do calls path under the organization, or under the project when
+// inProject is set.
+func (a *adoClient) do(method, path string, inProject bool, contentType string, body interface{}) (map[string]interface{}, error) {
+	u := a.baseURL
+	if inProject {
+		u += "/" + url.PathEscape(a.project)
+	}
+	u += path + "?api-version=" + adoAPIVersion
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, u, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.SetBasicAuth("", a.token)
+
+	resp, err := a.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("azure devops: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("azure devops: read response: %w", err)
+	}
+
+	var out map[string]interface{}
+	jsonErr := json.Unmarshal(data, &out)
+	// An expired or wrong token gets a 203 with the sign-in page.
+	if resp.StatusCode == http.StatusNonAuthoritativeInfo {
+		return nil, &HTTPError{StatusCode: http.StatusUnauthorized, Body: "azure devops: the token was not accepted"}
+	}
+	if resp.StatusCode/100 != 2 {
+		msg := http.StatusText(resp.StatusCode)
+		if m := stringField(out, "message"); m != "" {
+			msg = m
+		}
+		return nil, &HTTPError{StatusCode: resp.StatusCode, Body: "azure devops: " + msg}
+	}
+	if jsonErr != nil {
+		return nil, fmt.Errorf("azure devops: invalid response: %w", jsonErr)
+	}
+	return out, nil
+}
+
+// openWorkItems maps the correlation ids of open Secman work items to
+// their ids.
+func (a *adoClient) openWorkItems() (map[string]string, error) {
+	closed := make([]string, len(adoClosedStates))
+	for i, s := range adoClosedStates {
+		closed[i] = "'" + s + "'"
+	}
+	wiql := "SELECT [System.Id] FROM WorkItems WHERE [System.TeamProject] = @project" +
+		" AND [System.Tags] CONTAINS 'secman' AND [System.State] NOT IN (" + strings.Join(closed, ", ") + ")"
+	out, err := a.do(http.MethodPost, "/_apis/wit/wiql", true, "application/json", map[string]string{"query": wiql})
+	if err != nil {
+		return nil, err
+	}
+	var ids []int64
+	for _, w := range mapsField(out, "workItems") {
+		ids = append(ids, int64(numberField(w, "id")))
+	}
+
+	existing := map[string]string{}
+	// workitemsbatch takes at most 200 ids.
+	for start := 0; start < len(ids); start += 200 {
+		end := start + 200
+		if end > len(ids) {
+			end = len(ids)
+		}
+		out, err := a.do(http.MethodPost, "/_apis/wit/workitemsbatch", false, "application/json", map[string]interface{}{
+			"ids":    ids[start:end],
+			"fields": []string{"System.Id", "System.Tags"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, w := range mapsField(out, "value") {
+			fields, _ := w["fields"].(map[string]interface{})
+			for _, tag := range strings.Split(stringField(fields, "System.Tags"), ";") {
+				if tag = strings.TrimSpace(tag); strings.HasPrefix(tag, "secman:") {
+					existing[tag] = fmt.Sprint(int64(numberField(w, "id")))
+				}
+			}
+		}
+	}
+	return existing, nil
+}
+
+// create adds a work item of type from a JSON Patch document.
+func (a *adoClient) create(workItemType string, patch []map[string]interface{}) (map[string]interface{}, error) {
+	return a.do(http.MethodPost, "/_apis/wit/workitems/$"+url.PathEscape(workItemType), true, "application/json-patch+json", patch)
+}
+
+// adoSeverity and adoPriority map a severity onto the Severity field of
+// bugs and the Priority field of every work item type.
+var adoSeverity = map[string]string{
+	"CRITICAL": "1 - Critical",
+	"HIGH":     "2 - High",
+	"MEDIUM":   "3 - Medium",
+	"LOW":      "4 - Low",
+}
+
+var adoPriority = map[string]int{"CRITICAL": 1, "HIGH": 2, "MEDIUM": 3, "LOW": 4}
+
+// parseADOFields reads Field=template mappings. Templates may use {cve},
+// {severity}, {asset}, {assetId}, {findingId} and {count}.
+func parseADOFields(mappings []string) (map[string]string, error) {
+	fields := map[string]string{}
+	for _, m := range mappings {
+		name, value, ok := strings.Cut(m, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid field mapping %q (use Field.Reference=value)", m)
+		}
+		fields[name] = value
+	}
+	return fields, nil
+}
+
+func (t *findingTicket) expand(template string) string {
+	first := t.Findings[0]
+	cve, findingID := stringField(first, "vulnerabilityId"), fmt.Sprint(int64(numberField(first, "id")))
+	if len(t.Findings) > 1 {
+		findingID = ""
+		cves := make([]string, 0, len(t.Findings))
+		for _, f := range t.Findings {
+			if c := stringField(f, "vulnerabilityId"); !containsString(cves, c) {
+				cves = append(cves, c)
+			}
+		}
+		cve = strings.Join(cves, ", ")
+	}
+	return strings.NewReplacer(
+		"{cve}", cve,
+		"{severity}", t.Severity,
+		"{asset}", t.AssetName,
+		"{assetId}", fmt.Sprint(int64(numberField(first, "assetId"))),
+		"{findingId}", findingID,
+		"{count}", fmt.Sprint(len(t.Findings)),
+	).Replace(template)
+}
+
+// workItem builds the JSON Patch document that creates the work item.
+// Mapped fields override the defaults.
+func (t *findingTicket) workItem(workItemType, areaPath, iteration string, mapped map[string]string) []map[string]interface{} {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<p>Reported by Secman for asset <b>%s</b>.</p><ul>", html.EscapeString(t.AssetName))
+	for _, f := range t.Findings {
+		days, _ := parseDays(stringField(f, "daysOpen"))
+		fmt.Fprintf(&b, "<li>%s %s, open %d day(s)", html.EscapeString(stringField(f, "vulnerabilityId")),
+			html.EscapeString(strings.ToUpper(stringField(f, "cvssSeverity"))), days)
+		if products := stringField(f, "vulnerableProductVersions"); products != "" {
+			fmt.Fprintf(&b, ": %s", html.EscapeString(products))
+		}
+		b.WriteString("</li>")
+	}
+	b.WriteString("</ul>")
+
+	fields := map[string]interface{}{
+		"System.Title": truncate("Secman: "+t.shortDescription(), 255),
+		"System.Tags":  "secman; " + t.CorrelationID,
+	}
+	// Bugs show repro steps instead of the description.
+	if strings.EqualFold(workItemType, "Bug") {
+		fields["Microsoft.VSTS.TCM.ReproSteps"] = b.String()
+		if sev, ok := adoSeverity[t.Severity]; ok {
+			fields["Microsoft.VSTS.Common.Severity"] = sev
+		}
+	} else {
+		fields["System.Description"] = b.String()
+	}
+	if p, ok := adoPriority[t.Severity]; ok {
+		fields["Microsoft.VSTS.Common.Priority"] = p
+	}
+	if areaPath != "" {
+		fields["System.AreaPath"] = areaPath
+	}
+	if iteration != "" {
+		fields["System.IterationPath"] = iteration
+	}
+	for name, template := range mapped {
+		value := t.expand(template)
+		// Mapped tags are added to the correlation tag, which must stay.
+		if name == "System.Tags" {
+			value = fields["System.Tags"].(string) + "; " + value
+		}
+		fields[name] = value
+	}
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	patch := make([]map[string]interface{}, 0, len(names))
+	for _, name := range names {
+		patch = append(patch, map[string]interface{}{"op": "add", "path": "/fields/" + name, "value": fields[name]})
+	}
+	return patch
+}
+
+func cmdTicketAzureDevOps(client *McpClient, osArgs []string) {
+	fs := flag.NewFlagSet("ticket azure-devops", flag.ContinueOnError)
+	severity := fs.String("severity", "", "Only findings of this severity (CRITICAL, HIGH, MEDIUM, LOW)")
+	cve := fs.String("cve", "", "Only findings whose CVE id contains this text")
+	assetID := fs.Int64("asset-id", 0, "Only findings on this asset")
+	per := fs.String("per", "finding", "One work item per finding or per asset: finding or asset")
+	workItemType := fs.String("type", settingOr("SECMAN_AZURE_DEVOPS_TYPE", "Bug"), "Work item type")
+	areaPath := fs.String("area-path", setting("SECMAN_AZURE_DEVOPS_AREA_PATH"), `Area path (e.g. Project\Security)`)
+	iteration := fs.String("iteration", setting("SECMAN_AZURE_DEVOPS_ITERATION"), `Iteration path (e.g. Project\Sprint 42)`)
+	var fieldFlags stringList
+	fs.Var(&fieldFlags, "field", "Set a field: Field.Reference=value, with {cve}, {severity}, {asset}, {assetId}, {findingId}, {count} (repeatable)")
+	asJSON := fs.Bool("json", false, "Print the created and skipped work items as JSON")
+	yes := addYesFlag(fs)
+	parseFlags(fs, osArgs)
+
+	if *per != "finding" && *per != "asset" {
+		fmt.Fprintf(os.Stderr, "Error: --per must be finding or asset, got %q\n", *per)
+		exit(ExitUsage)
+	}
+	// SECMAN_AZURE_DEVOPS_FIELDS holds mappings separated by ";", applied
+	// before the --field flags.
+	var mappings []string
+	for _, m := range strings.Split(setting("SECMAN_AZURE_DEVOPS_FIELDS"), ";") {
+		if strings.TrimSpace(m) != "" {
+			mappings = append(mappings, m)
+		}
+	}
+	mapped, err := parseADOFields(append(mappings, fieldFlags...))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(ExitUsage)
+	}
+	ado, err := newADOClient(client)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(ExitUsage)
+	}
+
+	findings, err := ticketFindings(client, *severity, *cve, *assetID)
+	if err != nil {
+		fatal(err)
+	}
+	tickets := findingTickets(findings, *per)
+	if len(tickets) == 0 {
+		status(0, "No matching findings\n")
+		return
+	}
+
+	// Skip findings that already have an open work item.
+	existing, err := ado.openWorkItems()
+	if err != nil {
+		fatal(err)
+	}
+	var pending []*findingTicket
+	for _, t := range tickets {
+		if id, ok := existing[t.CorrelationID]; ok {
+			t.Status, t.Number = "exists", id
+			continue
+		}
+		pending = append(pending, t)
+	}
+
+	if len(pending) > 0 {
+		summary := []string{fmt.Sprintf("%d %s work item(s) in %s/%s", len(pending), *workItemType, ado.baseURL, ado.project)}
+		for i, t := range pending {
+			if i == 20 {
+				summary = append(summary, fmt.Sprintf("... and %d more", len(pending)-20))
+				break
+			}
+			summary = append(summary, t.shortDescription())
+		}
+		if err := confirm(client, *yes, "create Azure DevOps work items", summary); err != nil {
+			fatal(err)
+		}
+	}
+
+	created, failed := 0, 0
+	progress := startProgress("Creating work items", "work items", int64(len(pending)))
+	defer progress.Finish()
+	for _, t := range pending {
+		patch := t.workItem(*workItemType, *areaPath, *iteration, mapped)
+		if client.dryRun {
+			client.dryRunCalls.Add(1)
+			pauseProgress(func() {
+				fmt.Printf("DRY RUN azure-devops %s %s\n", *workItemType, t.CorrelationID)
+				for _, op := range patch {
+					fmt.Printf("    %s = %s\n", strings.TrimPrefix(op["path"].(string), "/fields/"), dryRunValue(op["value"]))
+				}
+			})
+			t.Status = "dry-run"
+			progress.Add(1)
+			continue
+		}
+		result, err := ado.create(*workItemType, patch)
+		progress.Add(1)
+		if err != nil {
+			progress.Warnf("  %s: %v\n", t.CorrelationID, err)
+			t.Status, t.Error = "failed", err.Error()
+			failed++
+			continue
+		}
+		t.Status, t.Number = "created", fmt.Sprint(int64(numberField(result, "id")))
+		if links, ok := result["_links"].(map[string]interface{}); ok {
+			if h, ok := links["html"].(map[string]interface{}); ok {
+				t.URL = stringField(h, "href")
+			}
+		}
+		created++
+	}
+	progress.Finish()
+
+	if rawOutput(*asJSON) {
+		printResult(tickets)
+	} else if !quiet {
+		for _, t := range tickets {
+			if t.Status == "created" || t.Status == "exists" {
+				fmt.Printf("  #%-8s %-8s %s\n", t.Number, t.Status, t.shortDescription())
+			}
+		}
+	}
+	status(created, "Created %d work item(s), %d already open\n", created, len(tickets)-len(pending))
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d work item(s) could not be created\n", failed)
+		exit(ExitPartial)
+	}
+}
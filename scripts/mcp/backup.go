@@ -0,0 +1,502 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// A backup is a gzip-compressed tar archive:
+//
+//	manifest.json          format version, source server, creation time, counts
+//	<section>.json         one JSON array per section (assets, vulnerabilities, ...)
+//	attachments/<id>-<name> evidence files referenced from evidence.json
+//
+// Sections are fetched with the regular paginated read tools, so a backup
+// contains exactly what the delegated user can see.
+const backupFormatVersion = 1
+
+type BackupManifest struct {
+	FormatVersion int            `json:"formatVersion"`
+	CreatedAt     time.Time      `json:"createdAt"`
+	Source        string         `json:"source"`
+	CreatedBy     string         `json:"createdBy,omitempty"`
+	Sections      map[string]int `json:"sections"`
+	Skipped       []string       `json:"skipped,omitempty"`
+}
+
+// backupSection describes how one entity type is read and, if the server
+// has a suitable tool, restored.
+type backupSection struct {
+	name  string
+	tool  string
+	fetch func(client *McpClient) ([]map[string]interface{}, error)
+}
+
+var backupSections = []backupSection{
+	{"requirements", "get_requirements", func(c *McpClient) ([]map[string]interface{}, error) {
+		return listRequirements(c, map[string]interface{}{"detailed": true})
+	}},
+	{"assets", "get_assets", func(c *McpClient) ([]map[string]interface{}, error) {
+		return listAll(c, "get_assets", "assets", nil, 500)
+	}},
+	{"vulnerabilities", "get_vulnerabilities", func(c *McpClient) ([]map[string]interface{}, error) {
+		return listAll(c, "get_vulnerabilities", "vulnerabilities", map[string]interface{}{"includeExcepted": true}, 500)
+	}},
+	{"assessments", "get_assessments", func(c *McpClient) ([]map[string]interface{}, error) {
+		content, err := c.callToolMap("get_assessments", map[string]interface{}{})
+		if err != nil {
+			return nil, err
+		}
+		return mapsField(content, "assessments"), nil
+	}},
+	{"exceptions", "list_vulnerability_exceptions", func(c *McpClient) ([]map[string]interface{}, error) {
+		content, err := c.callToolMap("list_vulnerability_exceptions", map[string]interface{}{})
+		if err != nil {
+			return nil, err
+		}
+		return mapsField(content, "exceptions"), nil
+	}},
+	{"releases", "list_releases", func(c *McpClient) ([]map[string]interface{}, error) {
+		content, err := c.callToolMap("list_releases", map[string]interface{}{})
+		if err != nil {
+			return nil, err
+		}
+		return mapsField(content, "releases"), nil
+	}},
+	{"user_mappings", "list_user_mappings", func(c *McpClient) ([]map[string]interface{}, error) {
+		return listAll(c, "list_user_mappings", "mappings", nil, 100)
+	}},
+}
+
+func cmdBackup(client *McpClient, osArgs []string) {
+	if len(osArgs) < 1 {
+		fmt.Fprintln(os.Stderr, "Error: backup subcommand required")
+		fmt.Fprintf(os.Stderr, "Usage: %s backup <create|restore|inspect> ...\n", progName())
+		exit(ExitUsage)
+	}
+
+	// Backups hold the severities the server has, not mapped ones.
+	client.severityMap = nil
+	switch osArgs[0] {
+	case "create":
+		cmdBackupCreate(client, osArgs[1:])
+	case "restore":
+		cmdBackupRestore(client, osArgs[1:])
+	case "inspect":
+		cmdBackupInspect(osArgs[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown backup subcommand: %s\n", osArgs[0])
+		exit(ExitUsage)
+	}
+}
+
+func cmdBackupCreate(client *McpClient, osArgs []string) {
+	fs := flag.NewFlagSet("backup create", flag.ContinueOnError)
+	output := fs.String("output", "", "Archive path (default: secman-backup-<timestamp>.tar.gz)")
+	sections := fs.String("sections", "", "Comma-separated sections to include (default: all)")
+	noAttachments := fs.Bool("no-attachments", false, "Skip evidence attachments")
+	sign := addSignFlag(fs)
+	dest := addDestinationFlags(fs)
+	parseFlags(fs, osArgs)
+
+	path := *output
+	if path == "" {
+		path = fmt.Sprintf("secman-backup-%s.tar.gz", time.Now().UTC().Format("20060102-150405"))
+	}
+
+	manifest, err := createBackup(client, path, splitList(*sections), !*noAttachments)
+	if err != nil {
+		fatal(err)
+	}
+
+	signOutput(client, path, *sign)
+	uploadOutput(client, path, *sign != "", dest)
+	status(path, "Backup written to %s\n", path)
+	for name, n := range manifest.Sections {
+		fmt.Printf("  %-18s %d\n", name, n)
+	}
+	for _, s := range manifest.Skipped {
+		fmt.Printf("  %-18s skipped (tool not available)\n", s)
+	}
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries.
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+func createBackup(client *McpClient, path string, only []string, attachments bool) (*BackupManifest, error) {
+	want := map[string]bool{}
+	for _, s := range only {
+		want[s] = true
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	manifest := &BackupManifest{
+		FormatVersion: backupFormatVersion,
+		CreatedAt:     time.Now().UTC(),
+		Source:        client.BaseURL,
+		CreatedBy:     client.UserEmail,
+		Sections:      map[string]int{},
+	}
+
+	err = func() error {
+		for _, section := range backupSections {
+			if len(want) > 0 && !want[section.name] {
+				continue
+			}
+			if ok, err := client.HasTool(section.tool); err != nil {
+				return err
+			} else if !ok {
+				manifest.Skipped = append(manifest.Skipped, section.name)
+				continue
+			}
+
+			if !quiet {
+				fmt.Fprintf(os.Stderr, "Backing up %s...\n", section.name)
+			}
+			items, err := section.fetch(client)
+			if err != nil {
+				return fmt.Errorf("%s: %w", section.name, err)
+			}
+			if err := writeTarJSON(tw, section.name+".json", items); err != nil {
+				return err
+			}
+			manifest.Sections[section.name] = len(items)
+
+			if section.name == "assessments" && attachments {
+				n, err := backupEvidence(client, tw, items)
+				if err != nil {
+					return err
+				}
+				manifest.Sections["attachments"] = n
+			}
+		}
+		return writeTarJSON(tw, "manifest.json", manifest)
+	}()
+
+	for _, c := range []io.Closer{tw, gz, f} {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// backupEvidence stores the evidence files attached to the given
+// assessments, plus an evidence.json index.
+func backupEvidence(client *McpClient, tw *tar.Writer, assessments []map[string]interface{}) (int, error) {
+	if ok, err := client.HasTool("list_evidence"); err != nil || !ok {
+		return 0, err
+	}
+
+	var index []map[string]interface{}
+	for _, a := range assessments {
+		content, err := client.callToolMap("list_evidence", map[string]interface{}{
+			"entityType": "RISK_ASSESSMENT",
+			"entityId":   numberField(a, "id"),
+		})
+		if err != nil {
+			return 0, err
+		}
+		for _, ev := range mapsField(content, "evidence") {
+			id := int64(numberField(ev, "id"))
+			var buf bytes.Buffer
+			if _, err := chunkedDownload(client, "get_evidence_chunk", map[string]interface{}{"evidenceId": id}, defaultEvidenceChunkSize, &buf); err != nil {
+				return 0, fmt.Errorf("evidence %d: %w", id, err)
+			}
+			name := fmt.Sprintf("attachments/%d-%s", id, path.Base(stringField(ev, "fileName")))
+			if err := writeTarFile(tw, name, buf.Bytes()); err != nil {
+				return 0, err
+			}
+			ev["archivePath"] = name
+			ev["entityType"] = "RISK_ASSESSMENT"
+			ev["entityId"] = numberField(a, "id")
+			index = append(index, ev)
+		}
+	}
+	if err := writeTarJSON(tw, "evidence.json", index); err != nil {
+		return 0, err
+	}
+	return len(index), nil
+}
+
+func writeTarJSON(tw *tar.Writer, name string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeTarFile(tw, name, data)
+}
+
+func writeTarFile(tw *tar.Writer, name string, data []byte) error {
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0o644,
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	}); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// readTarGz loads every regular file of a gzip-compressed tar archive.
+func readTarGz(path string) (map[string][]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("open archive: %w", err)
+	}
+	tr := tar.NewReader(gz)
+
+	files := map[string][]byte{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		files[hdr.Name] = data
+	}
+}
+
+// decodeSections decodes the top-level <section>.json arrays of an archive,
+// skipping the named metadata files.
+func decodeSections(files map[string][]byte, skip ...string) (map[string][]map[string]interface{}, error) {
+	sections := map[string][]map[string]interface{}{}
+outer:
+	for name, data := range files {
+		if !strings.HasSuffix(name, ".json") || strings.Contains(name, "/") {
+			continue
+		}
+		for _, s := range skip {
+			if name == s {
+				continue outer
+			}
+		}
+		var items []map[string]interface{}
+		if err := json.Unmarshal(data, &items); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		sections[strings.TrimSuffix(name, ".json")] = items
+	}
+	return sections, nil
+}
+
+// readBackup loads the manifest, the section arrays and the raw files
+// (attachments) of a backup archive.
+func readBackup(path string) (*BackupManifest, map[string][]map[string]interface{}, map[string][]byte, error) {
+	files, err := readTarGz(path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	data, ok := files["manifest.json"]
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("%s is not a secman backup (manifest.json missing)", path)
+	}
+	var manifest BackupManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, nil, nil, fmt.Errorf("manifest.json: %w", err)
+	}
+	if manifest.FormatVersion > backupFormatVersion {
+		return nil, nil, nil, fmt.Errorf("backup format %d is newer than supported (%d)", manifest.FormatVersion, backupFormatVersion)
+	}
+
+	sections, err := decodeSections(files, "manifest.json")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return &manifest, sections, files, nil
+}
+
+func cmdBackupInspect(osArgs []string) {
+	if len(osArgs) < 1 {
+		fmt.Fprintln(os.Stderr, "Error: archive path required")
+		exit(ExitUsage)
+	}
+	manifest, _, _, err := readBackup(osArgs[0])
+	if err != nil {
+		fatal(err)
+	}
+	printResult(manifest)
+}
+
+func cmdBackupRestore(client *McpClient, osArgs []string) {
+	if len(osArgs) < 1 {
+		fmt.Fprintln(os.Stderr, "Error: archive path required")
+		fmt.Fprintf(os.Stderr, "Usage: %s backup restore <archive.tar.gz> [--sections a,b] [--no-bulk] [--yes]\n", progName())
+		exit(ExitUsage)
+	}
+	archive := osArgs[0]
+
+	fs := flag.NewFlagSet("backup restore", flag.ContinueOnError)
+	sections := fs.String("sections", "", "Comma-separated sections to restore (default: all restorable)")
+	noBulk := fs.Bool("no-bulk", false, "Restore records one by one even when the server has bulk tools")
+	yes := addYesFlag(fs)
+	parseFlags(fs, osArgs[1:])
+
+	manifest, data, _, err := readBackup(archive)
+	if err != nil {
+		fatal(err)
+	}
+	status(nil, "Restoring backup of %s taken %s\n", manifest.Source, manifest.CreatedAt.Format(time.RFC3339))
+
+	want := map[string]bool{}
+	for _, s := range splitList(*sections) {
+		want[s] = true
+	}
+
+	counts := map[string]int{}
+	var order []string
+	for _, step := range restoreSteps {
+		if len(want) == 0 || want[step.section] {
+			counts[step.section] = len(data[step.section])
+			order = append(order, step.section)
+		}
+	}
+	if err := confirm(client, *yes, "restore into "+client.BaseURL, countSummary(order, counts)); err != nil {
+		fatal(err)
+	}
+
+	failed := 0
+	for _, step := range restoreSteps {
+		items := data[step.section]
+		if len(items) == 0 || (len(want) > 0 && !want[step.section]) {
+			continue
+		}
+		if err := client.requireTool(step.tool); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %s not restored: %v\n", step.section, err)
+			continue
+		}
+
+		records := make([]map[string]interface{}, len(items))
+		for i, item := range items {
+			records[i] = step.args(item)
+		}
+		ok := 0
+		progress := startProgress("Restoring "+step.section, "items", int64(len(items)))
+		for _, err := range client.callEach(step.tool, records, !*noBulk, progress) {
+			if err != nil {
+				progress.Warnf("  %s: %v\n", step.section, err)
+				failed++
+				continue
+			}
+			ok++
+		}
+		progress.Finish()
+		status(nil, "  %-18s %d/%d restored\n", step.section, ok, len(items))
+	}
+
+	for name := range data {
+		if !isRestorable(name) && name != "evidence" {
+			status(nil, "  %-18s not restorable through MCP tools (kept in archive)\n", name)
+		}
+	}
+
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d item(s) failed to restore\n", failed)
+		exit(ExitPartial)
+	}
+}
+
+// restoreSteps run in dependency order: assets must exist before the
+// vulnerabilities that reference them by hostname.
+var restoreSteps = []struct {
+	section string
+	tool    string
+	args    func(item map[string]interface{}) map[string]interface{}
+}{
+	{"requirements", "add_requirement", func(r map[string]interface{}) map[string]interface{} {
+		args := map[string]interface{}{"shortreq": stringField(r, "shortreq")}
+		for src, dst := range map[string]string{"description": "details", "motivation": "motivation", "example": "example", "chapter": "chapter", "norm": "norm", "usecase": "usecase"} {
+			if v := stringField(r, src); v != "" {
+				args[dst] = v
+			}
+		}
+		return args
+	}},
+	{"assets", "create_asset", func(a map[string]interface{}) map[string]interface{} {
+		args := map[string]interface{}{
+			"name":  stringField(a, "name"),
+			"type":  stringField(a, "type"),
+			"owner": stringField(a, "owner"),
+		}
+		for _, k := range []string{"ip", "description", "adDomain", "cloudAccountId"} {
+			if v := stringField(a, k); v != "" {
+				args[k] = v
+			}
+		}
+		return args
+	}},
+	{"vulnerabilities", "add_vulnerability", func(v map[string]interface{}) map[string]interface{} {
+		args := map[string]interface{}{
+			"hostname":    stringField(v, "assetName"),
+			"cve":         stringField(v, "vulnerabilityId"),
+			"criticality": strings.ToUpper(stringField(v, "cvssSeverity")),
+		}
+		if days := numberField(v, "daysOpen"); days > 0 {
+			args["daysOpen"] = int(days)
+		}
+		return args
+	}},
+	{"user_mappings", "import_user_mappings", func(m map[string]interface{}) map[string]interface{} {
+		mapping := map[string]interface{}{"email": stringField(m, "email")}
+		for _, k := range []string{"awsAccountId", "domain"} {
+			if v := stringField(m, k); v != "" {
+				mapping[k] = v
+			}
+		}
+		return map[string]interface{}{"mappings": []interface{}{mapping}}
+	}},
+}
+
+func isRestorable(section string) bool {
+	for _, step := range restoreSteps {
+		if step.section == section {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestBlake2b512(t *testing.T) {
+	block := make([]byte, 129)
+	for i := range block {
+		block[i] = byte(i % 251)
+	}
+	tests := []struct {
+		name  string
+		input []byte
+		want  string
+	}{
+		// RFC 7693, Appendix A, and the digest of the empty message.
+		{"empty", nil, "786a02f742015903c6c6fd852552d272912f4740e15847618a86e217f71f5419d25e1031afee585313896444934eb04b903a685b1448b755d56f701afe9be2ce"},
+		{"abc", []byte("abc"), "ba80a53f981c4d0d6a2797b69f12f6e94c212f14685ac4b74b12bb6fdbffa2d17d87c5392aab792dc252d5de4533cc9518d38aa8dbf1925ab92386edd4009923"},
+		// One full block, which Sum compresses as the last one, and one
+		// byte more.
+		{"one block", block[:128], "2319e3789c47e2daa5fe807f61bec2a1a6537fa03f19ff32e87eecbfd64b7e0e8ccff439ac333b040f19b0c4ddd11a61e24ac1fe0f10a039806c5dcc0da3d115"},
+		{"block and a byte", block, "f59711d44a031d5f97a9413c065d1e614c417ede998590325f49bad2fd444d3e4418be19aec4e11449ac1a57207898bc57d76a1bcf3566292c20c683a5c4648f"},
+		{"1000 bytes", bytes.Repeat([]byte("a"), 1000), "d6a69459fe93fc6b9537ed4336e5099e0dcca3e97290a412500ed7a0daffb03d80cf3650a20e0591f748e10c3c534945ee83d5f2c9722f1a68d98b8c01af23fd"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newBlake2b512()
+			h.Write(tt.input)
+			if got := hex.EncodeToString(h.Sum(nil)); got != tt.want {
+				t.Errorf("digest = %s, want %s", got, tt.want)
+			}
+
+			// Written in pieces that straddle block boundaries.
+			h.Reset()
+			for rest := tt.input; len(rest) > 0; {
+				n := min(7, len(rest))
+				h.Write(rest[:n])
+				rest = rest[n:]
+			}
+			if got := hex.EncodeToString(h.Sum(nil)); got != tt.want {
+				t.Errorf("digest written in pieces = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBlake2b512SumKeepsState(t *testing.T) {
+	h := newBlake2b512()
+	h.Write([]byte("ab"))
+	h.Sum(nil)
+	h.Write([]byte("c"))
+	want := "ba80a53f981c4d0d6a2797b69f12f6e94c212f14685ac4b74b12bb6fdbffa2d17d87c5392aab792dc252d5de4533cc9518d38aa8dbf1925ab92386edd4009923"
+	if got := hex.EncodeToString(h.Sum(nil)); got != want {
+		t.Errorf("digest after an intermediate Sum = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tool budgets bound what one tool call may cost: how long it may take,
+// how large its result may be, and how many pages of a paginated tool may
+// be fetched. They protect scripts and the LLM hosts on serve-stdio from
+// tools that occasionally hang or return enormous payloads.
+//
+// SECMAN_TOOL_TIMEOUT, SECMAN_TOOL_MAX_SIZE and SECMAN_TOOL_MAX_PAGES apply
+// to every tool. SECMAN_TOOL_LIMITS overrides them per tool, as rules
+// separated by semicolons, each a tool name or pattern and its limits:
+//
+//	get_vulnerabilities: timeout=2m max-size=20MB max-pages=50; export_*: timeout=10m
+//
+// Every rule that matches applies, later ones overriding earlier ones. A
+// limit of 0 lifts it. Unset, calls keep the 30 second HTTP timeout and
+// have no size or page limit.
+
+// toolLimits are the limits of one tool; zero means none.
+type toolLimits struct {
+	Timeout  time.Duration
+	MaxSize  int64
+	MaxPages int
+}
+
+// toolLimitRule is one rule of SECMAN_TOOL_LIMITS. A nil field keeps the
+// value of the rules before it.
+type toolLimitRule struct {
+	pattern  string
+	timeout  *time.Duration
+	maxSize  *int64
+	maxPages *int
+}
+
+// toolBudget holds the defaults and the per-tool rules.
+type toolBudget struct {
+	defaults toolLimits
+	rules    []toolLimitRule
+}
+
+// BudgetError reports a call stopped by its budget.
+type BudgetError struct {
+	Tool   string
+	Limit  string
+	Detail string
+}
+
+func (e *BudgetError) Error() string {
+	return fmt.Sprintf("%s: %s (tool budget %s; see SECMAN_TOOL_LIMITS)", e.Tool, e.Detail, e.Limit)
+}
+
+// loadToolBudget reads the budget settings; nil means no limits.
+func loadToolBudget() (*toolBudget, error) {
+	b := &toolBudget{}
+	var err error
+	if v := setting("SECMAN_TOOL_TIMEOUT"); v != "" {
+		if b.defaults.Timeout, err = time.ParseDuration(v); err != nil {
+			return nil, fmt.Errorf("SECMAN_TOOL_TIMEOUT: %w", err)
+		}
+	}
+	if v := setting("SECMAN_TOOL_MAX_SIZE"); v != "" {
+		if b.defaults.MaxSize, err = parseByteSize(v); err != nil {
+			return nil, fmt.Errorf("SECMAN_TOOL_MAX_SIZE: %w", err)
+		}
+	}
+	if v := setting("SECMAN_TOOL_MAX_PAGES"); v != "" {
+		if b.defaults.MaxPages, err = strconv.Atoi(v); err != nil || b.defaults.MaxPages < 0 {
+			return nil, fmt.Errorf("SECMAN_TOOL_MAX_PAGES: %q is not a page count", v)
+		}
+	}
+	if b.rules, err = parseToolLimitRules(setting("SECMAN_TOOL_LIMITS")); err != nil {
+		return nil, fmt.Errorf("SECMAN_TOOL_LIMITS: %w", err)
+	}
+	if b.defaults == (toolLimits{}) && len(b.rules) == 0 {
+		return nil, nil
+	}
+	return b, nil
+}
+
+func parseToolLimitRules(s string) ([]toolLimitRule, error) {
+	var rules []toolLimitRule
+	for _, part := range strings.Split(s, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		pattern, spec, ok := strings.Cut(part, ":")
+		pattern = strings.TrimSpace(pattern)
+		if !ok || pattern == "" {
+			return nil, fmt.Errorf("%q: expected <tool>: <limit>=<value> ...", part)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("bad tool pattern %q: %w", pattern, err)
+		}
+		rule := toolLimitRule{pattern: pattern}
+		for _, field := range strings.FieldsFunc(spec, func(r rune) bool { return r == ' ' || r == ',' }) {
+			key, value, _ := strings.Cut(field, "=")
+			switch key {
+			case "timeout":
+				d, err := time.ParseDuration(value)
+				if err != nil {
+					return nil, fmt.Errorf("%s: timeout: %w", pattern, err)
+				}
+				rule.timeout = &d
+			case "max-size":
+				n, err := parseByteSize(value)
+				if err != nil {
+					return nil, fmt.Errorf("%s: max-size: %w", pattern, err)
+				}
+				rule.maxSize = &n
+			case "max-pages":
+				n, err := strconv.Atoi(value)
+				if err != nil || n < 0 {
+					return nil, fmt.Errorf("%s: max-pages: %q is not a page count", pattern, value)
+				}
+				rule.maxPages = &n
+			default:
+				return nil, fmt.Errorf("%s: unknown limit %q (timeout, max-size, max-pages)", pattern, key)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// limits returns the limits of a tool.
+func (b *toolBudget) limits(tool string) toolLimits {
+	if b == nil {
+		return toolLimits{}
+	}
+	l := b.defaults
+	for _, r := range b.rules {
+		if !matchTool(r.pattern, tool) {
+			continue
+		}
+		if r.timeout != nil {
+			l.Timeout = *r.timeout
+		}
+		if r.maxSize != nil {
+			l.MaxSize = *r.maxSize
+		}
+		if r.maxPages != nil {
+			l.MaxPages = *r.maxPages
+		}
+	}
+	return l
+}
+
+// checkPage refuses a page past the tool's page limit. Pages count from
+// 0, so max-pages=10 allows pages 0 to 9.
+func (l toolLimits) checkPage(tool string, args map[string]interface{}) error {
+	if l.MaxPages == 0 {
+		return nil
+	}
+	page, ok := args["page"].(int)
+	if !ok {
+		if f, isFloat := args["page"].(float64); isFloat {
+			page, ok = int(f), true
+		}
+	}
+	if ok && page >= l.MaxPages {
+		return &BudgetError{Tool: tool, Limit: "max-pages=" + strconv.Itoa(l.MaxPages),
+			Detail: fmt.Sprintf("page %d is past the limit of %d pages; narrow the filter", page+1, l.MaxPages)}
+	}
+	return nil
+}
+
+// timeoutError turns a deadline the budget set into a BudgetError. The
+// caller fills in the tool, as for sizeError.
+func (l toolLimits) timeoutError(err error) error {
+	if l.Timeout > 0 && errors.Is(err, context.DeadlineExceeded) {
+		return &BudgetError{Limit: "timeout=" + l.Timeout.String(),
+			Detail: "no result within " + l.Timeout.String()}
+	}
+	return err
+}
+
+func (l toolLimits) sizeError(size int64) error {
+	detail := "result larger than " + formatBytes(l.MaxSize)
+	if size > 0 {
+		detail = fmt.Sprintf("result of %s is larger than %s", formatBytes(size), formatBytes(l.MaxSize))
+	}
+	return &BudgetError{Limit: "max-size=" + formatBytes(l.MaxSize), Detail: detail + "; narrow the filter or use a smaller page size"}
+}
+
+// parseByteSize reads sizes like 1048576, 512KB, 20MB, 1.5GiB. KB and KiB
+// both mean 1024 bytes.
+func parseByteSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	upper := strings.ToUpper(s)
+	mult := int64(1)
+	for _, u := range []struct {
+		suffix string
+		mult   int64
+	}{{"KIB", 1 << 10}, {"MIB", 1 << 20}, {"GIB", 1 << 30}, {"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30}, {"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"B", 1}} {
+		if strings.HasSuffix(upper, u.suffix) {
+			upper, mult = strings.TrimSpace(strings.TrimSuffix(upper, u.suffix)), u.mult
+			break
+		}
+	}
+	f, err := strconv.ParseFloat(upper, 64)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("%q is not a size such as 20MB", s)
+	}
+	return int64(f * float64(mult)), nil
+}
@@ -0,0 +1,142 @@
+#!/bin/sh
+# Builds the release binaries into dist/: static secman_<os>_<arch>
+# executables, checksums.txt and, when SECMAN_RELEASE_KEY names a minisign
+# secret key, checksums.txt.minisig. Upload them as the assets of a GitHub
+# release tagged v$VERSION; self-update installs from it.
+#
+# dist/ also gets the manual page, the completion scripts, a Homebrew
+# formula (secman.rb) and a Scoop manifest (secman.json) pointing at the
+# release's binaries, for the tap and bucket repositories. REPO names the
+# GitHub repository the release is published in.
+#
+#   VERSION=1.4.0 ./build.sh
+#   PLATFORMS="linux/amd64" ./build.sh
+set -eu
+
+cd "$(dirname "$0")"
+
+VERSION=${VERSION:-$(git describe --tags --abbrev=0 2>/dev/null | sed 's/^.*v//')}
+VERSION=${VERSION:-0.0.0-dev}
+COMMIT=$(git rev-parse --short=12 HEAD 2>/dev/null || echo unknown)
+BUILD_DATE=$(date -u +%Y-%m-%dT%H:%M:%SZ)
+REPO=${REPO:-schmalle/secman}
+PLATFORMS=${PLATFORMS:-"linux/amd64 linux/arm64 darwin/amd64 darwin/arm64 windows/amd64 windows/arm64"}
+LDFLAGS="-s -w -X main.version=$VERSION -X main.commit=$COMMIT -X main.buildDate=$BUILD_DATE"
+
+rm -rf dist
+mkdir -p dist
+for platform in $PLATFORMS; do
+	os=${platform%/*}
+	arch=${platform#*/}
+	out=dist/secman_${os}_${arch}
+	if [ "$os" = windows ]; then
+		out=$out.exe
+	fi
+	echo "Building $out"
+	CGO_ENABLED=0 GOOS=$os GOARCH=$arch go build -trimpath ${TAGS:+-tags "$TAGS"} -ldflags "$LDFLAGS" -o "$out" .
+done
+
+go run -ldflags "$LDFLAGS" . man --output dist >/dev/null
+mkdir -p dist/completions
+go run . completion bash >dist/completions/secman.bash
+go run . completion zsh >dist/completions/_secman
+go run . completion fish >dist/completions/secman.fish
+go run . completion powershell >dist/completions/secman.ps1
+
+cd dist
+if command -v sha256sum >/dev/null 2>&1; then
+	sha256sum secman_* >checksums.txt
+else
+	shasum -a 256 secman_* >checksums.txt
+fi
+if [ -n "${SECMAN_RELEASE_KEY:-}" ]; then
+	minisign -S -s "$SECMAN_RELEASE_KEY" -m checksums.txt
+fi
+
+URL=https://github.com/$REPO/releases/download/v$VERSION
+sum() {
+	awk -v f="$1" '$2 == f || $2 == "*" f { print $1 }' checksums.txt
+}
+
+if [ -n "$(sum secman_darwin_arm64)" ] && [ -n "$(sum secman_darwin_amd64)" ] &&
+	[ -n "$(sum secman_linux_arm64)" ] && [ -n "$(sum secman_linux_amd64)" ]; then
+	cat >secman.rb <<FORMULA
+class Secman < Formula
+  desc "Command-line client of the Secman MCP server"
+  homepage "https://github.com/$REPO"
+  version "$VERSION"
+  license "AGPL-3.0-only"
+
+  on_macos do
+    on_arm do
+      url "$URL/secman_darwin_arm64"
+      sha256 "$(sum secman_darwin_arm64)"
+    end
+    on_intel do
+      url "$URL/secman_darwin_amd64"
+      sha256 "$(sum secman_darwin_amd64)"
+    end
+  end
+
+  on_linux do
+    on_arm do
+      url "$URL/secman_linux_arm64"
+      sha256 "$(sum secman_linux_arm64)"
+    end
+    on_intel do
+      url "$URL/secman_linux_amd64"
+      sha256 "$(sum secman_linux_amd64)"
+    end
+  end
+
+  def install
+    bin.install Dir["secman_*"].first => "secman"
+    generate_completions_from_executable(bin/"secman", "completion")
+    (man1/"secman.1").write Utils.safe_popen_read(bin/"secman", "man")
+  end
+
+  test do
+    assert_match version.to_s, shell_output("#{bin}/secman version")
+  end
+end
+FORMULA
+fi
+
+if [ -n "$(sum secman_windows_amd64.exe)" ]; then
+	arm64=
+	if [ -n "$(sum secman_windows_arm64.exe)" ]; then
+		arm64=$(printf ',\n        "arm64": {\n            "url": "%s/secman_windows_arm64.exe#/secman.exe",\n            "hash": "%s"\n        }' "$URL" "$(sum secman_windows_arm64.exe)")
+	fi
+	cat >secman.json <<MANIFEST
+{
+    "version": "$VERSION",
+    "description": "Command-line client of the Secman MCP server",
+    "homepage": "https://github.com/$REPO",
+    "license": "AGPL-3.0-only",
+    "architecture": {
+        "64bit": {
+            "url": "$URL/secman_windows_amd64.exe#/secman.exe",
+            "hash": "$(sum secman_windows_amd64.exe)"
+        }$arm64
+    },
+    "bin": "secman.exe",
+    "checkver": {
+        "github": "https://github.com/$REPO"
+    },
+    "autoupdate": {
+        "architecture": {
+            "64bit": {
+                "url": "https://github.com/$REPO/releases/download/v\$version/secman_windows_amd64.exe#/secman.exe"
+            },
+            "arm64": {
+                "url": "https://github.com/$REPO/releases/download/v\$version/secman_windows_arm64.exe#/secman.exe"
+            }
+        },
+        "hash": {
+            "url": "\$baseurl/checksums.txt"
+        }
+    }
+}
+MANIFEST
+fi
+echo "secman $VERSION ($COMMIT) in dist/"
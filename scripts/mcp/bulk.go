@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Newer servers offer bulk tools that take many records in one call, such
+// as bulk_create_assets for create_asset. import and backup restore send
+// their records through them when the server lists one, in batches of up
+// to bulkBatchSize (or the list's maxItems), and one by one otherwise.
+//
+// A bulk tool takes its records as an array property, "items" or else its
+// only array property, and reports failed records in its result as either
+//
+//	{"results": [{"index": 0, "error": "unknown host"}, ...]}
+//	{"errors":  [{"index": 3, "message": "unknown host"}, ...]}
+//
+// where index is the record's position in the batch. A batch the server
+// refused before writing anything (no such tool, invalid arguments, or a
+// tool error) is sent again record by record, so each failure is reported
+// against its own record. Any other failure, such as a timeout or a 5xx,
+// may have come after some records were written; the batch is not resent
+// and each of its records gets the error.
+
+const bulkBatchSize = 100
+
+// bulkTools are the bulk tools that stand in for a per-record tool, in
+// order of preference.
+var bulkTools = map[string][]string{
+	"add_vulnerability": {"bulk_add_vulnerabilities"},
+	"create_asset":      {"bulk_create_assets"},
+}
+
+// bulkRoute is a bulk tool found on the server.
+type bulkRoute struct {
+	single string
+	tool   string
+	param  string
+	size   int
+
+	fallback sync.Once
+}
+
+// bulkRoute returns the bulk tool to use for single, or nil when the
+// server has none.
+func (c *McpClient) bulkRoute(single string) *bulkRoute {
+	for _, name := range bulkTools[single] {
+		def, ok, err := c.Tool(name)
+		if err != nil || !ok {
+			continue
+		}
+		if param, size := bulkParam(def); param != "" {
+			return &bulkRoute{single: single, tool: name, param: param, size: size}
+		}
+	}
+	return nil
+}
+
+// bulkParam finds the array property a bulk tool takes its records in,
+// and the batch size it allows.
+func bulkParam(def ToolDefinition) (string, int) {
+	props, _ := def.InputSchema["properties"].(map[string]interface{})
+	var arrays []string
+	for name, raw := range props {
+		if prop, _ := raw.(map[string]interface{}); prop["type"] == "array" {
+			arrays = append(arrays, name)
+		}
+	}
+	sort.Strings(arrays)
+	var param string
+	switch {
+	case containsFold(arrays, "items"):
+		param = "items"
+	case len(arrays) == 1:
+		param = arrays[0]
+	default:
+		return "", 0
+	}
+	size := bulkBatchSize
+	prop, _ := props[param].(map[string]interface{})
+	if max, ok := prop["maxItems"].(float64); ok && max >= 1 && int(max) < size {
+		size = int(max)
+	}
+	return param, size
+}
+
+// callEach calls single once per record, through its bulk tool when the
+// server has one and bulk is set. It returns one error per record, nil for
+// those that went through; progress, if set, counts the records done.
+func (c *McpClient) callEach(single string, records []map[string]interface{}, bulk bool, progress *Progress) []error {
+	var route *bulkRoute
+	if bulk {
+		route = c.bulkRoute(single)
+	}
+	errs := make([]error, len(records))
+	if route == nil {
+		for i, args := range records {
+			_, errs[i] = c.callToolMap(single, args)
+			if progress != nil {
+				progress.Add(1)
+			}
+		}
+		return errs
+	}
+	for start := 0; start < len(records); start += route.size {
+		end := start + route.size
+		if end > len(records) {
+			end = len(records)
+		}
+		copy(errs[start:end], c.callBulk(context.Background(), route, records[start:end]))
+		if progress != nil {
+			progress.Add(int64(end - start))
+		}
+	}
+	return errs
+}
+
+// callBulk sends one batch through the bulk tool and returns one error per
+// record. A batch the server refused as a whole is sent record by record.
+func (c *McpClient) callBulk(ctx context.Context, route *bulkRoute, records []map[string]interface{}) []error {
+	items := make([]interface{}, len(records))
+	for i, args := range records {
+		// What CallToolContext does to a single call's arguments.
+		if c.severityMap != nil && route.single == "add_vulnerability" {
+			args = c.severityMap.importArgs(c, route.single, args)
+		}
+		items[i] = c.withTenant(route.single, args)
+	}
+	result, err := c.CallToolContext(ctx, route.tool, map[string]interface{}{route.param: items})
+	if err == nil && result.IsError {
+		err = fmt.Errorf("%s failed: %v", route.tool, result.Content)
+	}
+	if err != nil && !bulkRefused(err, result) {
+		errs := make([]error, len(records))
+		for i := range errs {
+			errs[i] = fmt.Errorf("%s: batch of %d not confirmed: %w", route.tool, len(records), err)
+		}
+		return errs
+	}
+	if err != nil {
+		route.fallback.Do(func() {
+			warnf("Warning: %v; sending its records one by one\n", err)
+		})
+		errs := make([]error, len(records))
+		for i, args := range records {
+			_, errs[i] = c.callToolMap(route.single, args)
+		}
+		return errs
+	}
+	if c.dryRun {
+		return make([]error, len(records))
+	}
+	return bulkItemErrors(result.Content, len(records))
+}
+
+// bulkRefused reports whether the server refused a bulk call before writing
+// any of its records: the tool is unknown, the arguments are invalid, or
+// the tool itself returned an error.
+func bulkRefused(err error, result *ToolCallResult) bool {
+	if result != nil && result.IsError {
+		return true
+	}
+	var toolErr *ToolNotFoundError
+	if errors.As(err, &toolErr) {
+		return true
+	}
+	var rpcErr *JSONRPCError
+	if errors.As(err, &rpcErr) {
+		switch rpcErr.Code {
+		case "TOOL_NOT_FOUND", "INVALID_ARGUMENTS", "INVALID_REQUEST", "-32005", "-32601", "-32602", "-32600":
+			return true
+		}
+	}
+	return false
+}
+
+// bulkItemErrors reads the failed records from a bulk tool's result.
+func bulkItemErrors(content interface{}, n int) []error {
+	errs := make([]error, n)
+	m, _ := content.(map[string]interface{})
+	for _, key := range []string{"results", "errors"} {
+		list, _ := m[key].([]interface{})
+		for i, raw := range list {
+			entry, _ := raw.(map[string]interface{})
+			if entry == nil {
+				continue
+			}
+			index := i
+			if f, ok := entry["index"].(float64); ok {
+				index = int(f)
+			}
+			if index < 0 || index >= n {
+				continue
+			}
+			msg := stringField(entry, "error")
+			if msg == "" {
+				msg = stringField(entry, "message")
+			}
+			failed := msg != "" || entry["success"] == false ||
+				strings.EqualFold(stringField(entry, "status"), "error") || strings.EqualFold(stringField(entry, "status"), "failed")
+			if key == "errors" || failed {
+				if msg == "" {
+					msg = "rejected by the bulk tool"
+				}
+				errs[index] = fmt.Errorf("%s", msg)
+			}
+		}
+	}
+	return errs
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestCallBulk(t *testing.T) {
+	records := []map[string]interface{}{{"name": "web-01"}, {"name": "web-02"}}
+	created := func(args map[string]interface{}) (interface{}, error) {
+		return map[string]interface{}{"id": 1}, nil
+	}
+	tests := []struct {
+		name      string
+		bulk      fakeTool
+		wantCalls []string
+		wantErrs  bool
+	}{
+		{
+			name: "server error",
+			bulk: func(map[string]interface{}) (interface{}, error) {
+				return nil, httpStatus(http.StatusInternalServerError)
+			},
+			wantCalls: []string{"bulk_create_assets"},
+			wantErrs:  true,
+		},
+		{
+			name:      "tool error",
+			bulk:      func(map[string]interface{}) (interface{}, error) { return nil, toolError("items: too many") },
+			wantCalls: []string{"bulk_create_assets", "create_asset", "create_asset"},
+		},
+		{
+			name:      "tool not found",
+			wantCalls: []string{"bulk_create_assets", "create_asset", "create_asset"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tools := map[string]fakeTool{"create_asset": created}
+			if tt.bulk != nil {
+				tools["bulk_create_assets"] = tt.bulk
+			}
+			srv := newFakeServer(t, tools)
+			c := srv.client()
+			route := &bulkRoute{single: "create_asset", tool: "bulk_create_assets", param: "items", size: bulkBatchSize}
+			errs := c.callBulk(context.Background(), route, records)
+			if got := srv.called(); !reflect.DeepEqual(got, tt.wantCalls) {
+				t.Errorf("calls = %v, want %v", got, tt.wantCalls)
+			}
+			for i, err := range errs {
+				if (err != nil) != tt.wantErrs {
+					t.Errorf("record %d: err = %v, want error %t", i, err, tt.wantErrs)
+				}
+			}
+		})
+	}
+}
+
+func TestBulkToolsAddOnly(t *testing.T) {
+	for _, name := range bulkTools["add_vulnerability"] {
+		if name == "bulk_update_vulnerabilities" {
+			t.Errorf("add_vulnerability falls back to %s, which changes existing records", name)
+		}
+	}
+}
@@ -0,0 +1,513 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Air-gapped transfer bundles carry a selection of data between networks
+// without connectivity. A bundle is a gzip-compressed tar archive with:
+//
+//	bundle.json      manifest: source, creation time, --since window and the
+//	                 SHA-256 of every section file
+//	bundle.sig       Ed25519 signature over bundle.json
+//	<section>.json   assets / vulnerabilities as JSON arrays
+//
+// Import verifies the signature and every file hash before touching the
+// target server.
+const bundleFormatVersion = 1
+
+type BundleManifest struct {
+	FormatVersion int               `json:"formatVersion"`
+	CreatedAt     time.Time         `json:"createdAt"`
+	Source        string            `json:"source"`
+	Since         *time.Time        `json:"since,omitempty"`
+	Files         map[string]string `json:"files"`
+	Counts        map[string]int    `json:"counts"`
+	Anonymized    bool              `json:"anonymized,omitempty"`
+}
+
+var bundleSections = []string{"assets", "vulnerabilities"}
+
+func cmdBundle(client *McpClient, osArgs []string) {
+	if len(osArgs) < 1 {
+		fmt.Fprintln(os.Stderr, "Error: bundle subcommand required")
+		fmt.Fprintf(os.Stderr, "Usage: %s bundle <keygen|export|import> ...\n", progName())
+		exit(ExitUsage)
+	}
+
+	// Bundles hold the severities the server has, not mapped ones.
+	client.severityMap = nil
+	switch osArgs[0] {
+	case "keygen":
+		cmdBundleKeygen(osArgs[1:])
+	case "export":
+		cmdBundleExport(client, osArgs[1:])
+	case "import":
+		cmdBundleImport(client, osArgs[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown bundle subcommand: %s\n", osArgs[0])
+		exit(ExitUsage)
+	}
+}
+
+func cmdBundleKeygen(osArgs []string) {
+	fs := flag.NewFlagSet("bundle keygen", flag.ContinueOnError)
+	name := fs.String("name", "secman-bundle", "Key file prefix (<name>.key, <name>.pub and <name>.minisign.pub)")
+	parseFlags(fs, osArgs)
+
+	if _, err := os.Stat(*name + ".key"); err == nil {
+		fmt.Fprintf(os.Stderr, "Error: %s.key already exists\n", *name)
+		exit(ExitUsage)
+	}
+	if err := generateSigningKey(*name+".key", *name+".pub"); err != nil {
+		fatal(err)
+	}
+	pub, err := loadPublicKey(*name + ".pub")
+	if err == nil {
+		err = os.WriteFile(*name+".minisign.pub", minisignPublicKey(pub), 0o644)
+	}
+	if err != nil {
+		fatal(err)
+	}
+	status(*name+".pub", "Wrote %s.key (keep on the exporting side) and %s.pub (copy to the importing side)\n", *name, *name)
+	status(nil, "Wrote %s.minisign.pub for checking --sign signatures with minisign\n", *name)
+}
+
+func cmdBundleExport(client *McpClient, osArgs []string) {
+	fs := flag.NewFlagSet("bundle export", flag.ContinueOnError)
+	since := fs.String("since", "", "Only include data created/seen since this time (YYYY-MM-DD, RFC 3339, or an age: 30d)")
+	sections := fs.String("sections", strings.Join(bundleSections, ","), "Sections to include")
+	keyPath := fs.String("key", "", "Ed25519 private key used to sign the bundle (required)")
+	output := fs.String("output", "", "Bundle path (default: secman-bundle-<timestamp>.tar.gz)")
+	anonymize := fs.Bool("anonymize", false, "Pseudonymize hostnames, IPs, emails and owners")
+	parseFlags(fs, osArgs)
+
+	if *keyPath == "" {
+		fmt.Fprintf(os.Stderr, "Error: --key is required (create one with: %s bundle keygen)\n", progName())
+		exit(ExitUsage)
+	}
+	key, err := loadPrivateKey(*keyPath)
+	if err != nil {
+		fatal(err)
+	}
+
+	manifest := &BundleManifest{
+		FormatVersion: bundleFormatVersion,
+		CreatedAt:     time.Now().UTC(),
+		Source:        client.BaseURL,
+		Files:         map[string]string{},
+		Counts:        map[string]int{},
+	}
+	if *since != "" {
+		t, err := parseTimeExpr(*since, time.Now())
+		if err != nil {
+			fatal(err)
+		}
+		manifest.Since = &t
+	}
+
+	var anon *Anonymizer
+	if *anonymize {
+		if anon, err = newAnonymizer(); err != nil {
+			fatal(err)
+		}
+		manifest.Anonymized = true
+	}
+
+	files := map[string][]byte{}
+	for _, section := range splitList(*sections) {
+		items, err := fetchBundleSection(client, section, manifest.Since)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: %v\n", section, err)
+			exit(exitCode(err))
+		}
+		if anon != nil {
+			anon.Records(items, section == "assets")
+		}
+		data, err := json.MarshalIndent(items, "", "  ")
+		if err != nil {
+			fatal(err)
+		}
+		name := section + ".json"
+		sum := sha256.Sum256(data)
+		files[name] = data
+		manifest.Files[name] = hex.EncodeToString(sum[:])
+		manifest.Counts[section] = len(items)
+	}
+
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		fatal(err)
+	}
+	files["bundle.json"] = manifestData
+	files["bundle.sig"] = []byte(hex.EncodeToString(ed25519.Sign(key, manifestData)) + "\n")
+
+	path := *output
+	if path == "" {
+		path = fmt.Sprintf("secman-bundle-%s.tar.gz", manifest.CreatedAt.Format("20060102-150405"))
+	}
+	if err := writeTarGz(path, files); err != nil {
+		fatal(err)
+	}
+
+	status(path, "Signed bundle written to %s\n", path)
+	for _, s := range sortedKeys(manifest.Counts) {
+		fmt.Printf("  %-16s %d\n", s, manifest.Counts[s])
+	}
+}
+
+func fetchBundleSection(client *McpClient, section string, since *time.Time) ([]map[string]interface{}, error) {
+	switch section {
+	case "assets":
+		assets, err := listAll(client, "get_assets", "assets", nil, 500)
+		if err != nil || since == nil {
+			return assets, err
+		}
+		var recent []map[string]interface{}
+		for _, a := range assets {
+			if changedSince(a, *since, "updatedAt", "createdAt", "lastSeen") {
+				recent = append(recent, a)
+			}
+		}
+		return recent, nil
+	case "vulnerabilities":
+		args := map[string]interface{}{}
+		if since != nil {
+			args["startDate"] = since.UTC().Format(time.RFC3339)
+		}
+		return listAll(client, "get_vulnerabilities", "vulnerabilities", args, 500)
+	}
+	return nil, fmt.Errorf("unknown section (available: %s)", strings.Join(bundleSections, ", "))
+}
+
+// changedSince reports whether any of the timestamp fields is at or after t.
+func changedSince(m map[string]interface{}, t time.Time, fields ...string) bool {
+	for _, f := range fields {
+		v := stringField(m, f)
+		if v == "" {
+			continue
+		}
+		if ts, ok := parseServerTime(v); ok && !ts.Before(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseServerTime parses a server timestamp: an ISO-8601 LocalDateTime
+// (no zone, taken as UTC) or RFC 3339.
+func parseServerTime(v string) (time.Time, bool) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999", "2006-01-02T15:04:05"} {
+		if ts, err := time.Parse(layout, v); err == nil {
+			return ts, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func writeTarGz(path string, files map[string][]byte) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err = writeTarFile(tw, name, files[name]); err != nil {
+			break
+		}
+	}
+	for _, c := range []io.Closer{tw, gz, f} {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
+
+// verifyBundle checks the manifest signature and the hash of every listed
+// file, returning the manifest and decoded sections.
+func verifyBundle(path string, pub ed25519.PublicKey) (*BundleManifest, map[string][]map[string]interface{}, error) {
+	files, err := readTarGz(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	manifestData, ok := files["bundle.json"]
+	if !ok {
+		return nil, nil, fmt.Errorf("%s is not a secman bundle (bundle.json missing)", path)
+	}
+
+	if pub != nil {
+		sig, err := hex.DecodeString(strings.TrimSpace(string(files["bundle.sig"])))
+		if err != nil || !ed25519.Verify(pub, manifestData, sig) {
+			return nil, nil, fmt.Errorf("signature verification failed: bundle was not signed by the trusted key or was modified")
+		}
+	}
+
+	var manifest BundleManifest
+	if err := json.Unmarshal(manifestData, &manifest); err != nil {
+		return nil, nil, fmt.Errorf("bundle.json: %w", err)
+	}
+	if manifest.FormatVersion > bundleFormatVersion {
+		return nil, nil, fmt.Errorf("bundle format %d is newer than supported (%d)", manifest.FormatVersion, bundleFormatVersion)
+	}
+
+	for name, want := range manifest.Files {
+		data, ok := files[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("%s listed in manifest but missing from bundle", name)
+		}
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != want {
+			return nil, nil, fmt.Errorf("%s: hash mismatch", name)
+		}
+	}
+	// Only files covered by the signed manifest are trusted.
+	signed := map[string][]byte{}
+	for name := range manifest.Files {
+		signed[name] = files[name]
+	}
+
+	sections, err := decodeSections(signed)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &manifest, sections, nil
+}
+
+func cmdBundleImport(client *McpClient, osArgs []string) {
+	if len(osArgs) < 1 {
+		fmt.Fprintln(os.Stderr, "Error: bundle path required")
+		fmt.Fprintf(os.Stderr, "Usage: %s bundle import <bundle.tar.gz> --pubkey key.pub [--on-conflict skip|update|fail] [--yes]\n", progName())
+		exit(ExitUsage)
+	}
+	path := osArgs[0]
+
+	fs := flag.NewFlagSet("bundle import", flag.ContinueOnError)
+	pubPath := fs.String("pubkey", "", "Trusted Ed25519 public key of the exporting side (required)")
+	onConflict := fs.String("on-conflict", "skip", "What to do when a record already exists: skip, update or fail")
+	insecure := fs.Bool("insecure-skip-verify", false, "Import without verifying the signature")
+	yes := addYesFlag(fs)
+	parseFlags(fs, osArgs[1:])
+
+	switch *onConflict {
+	case "skip", "update", "fail":
+	default:
+		fmt.Fprintf(os.Stderr, "Error: --on-conflict must be skip, update or fail\n")
+		exit(ExitUsage)
+	}
+
+	var pub ed25519.PublicKey
+	if !*insecure {
+		if *pubPath == "" {
+			fmt.Fprintln(os.Stderr, "Error: --pubkey is required (or --insecure-skip-verify)")
+			exit(ExitUsage)
+		}
+		var err error
+		if pub, err = loadPublicKey(*pubPath); err != nil {
+			fatal(err)
+		}
+	}
+
+	manifest, sections, err := verifyBundle(path, pub)
+	if err != nil {
+		fatal(err)
+	}
+	counts := map[string]int{}
+	for name, items := range sections {
+		counts[name] = len(items)
+	}
+	summary := append(countSummary(bundleSections, counts), "existing records: "+*onConflict)
+	if err := confirm(client, *yes, "import into "+client.BaseURL, summary); err != nil {
+		fatal(err)
+	}
+	status(nil, "Importing bundle from %s created %s\n", manifest.Source, manifest.CreatedAt.Format(time.RFC3339))
+
+	stats, err := importBundle(client, sections, *onConflict)
+	for _, s := range []string{"assets", "vulnerabilities"} {
+		if c, ok := stats[s]; ok {
+			status(nil, "  %-16s %d created, %d updated, %d skipped (existing), %d failed\n", s, c.created, c.updated, c.skipped, c.failed)
+		}
+	}
+	if err != nil {
+		fatal(err)
+	}
+	for _, c := range stats {
+		if c.failed > 0 {
+			exit(ExitPartial)
+		}
+	}
+}
+
+type importCounts struct {
+	created, updated, skipped, failed int
+}
+
+// importBundle loads assets first (vulnerabilities reference them by name)
+// and applies the conflict policy to records that already exist.
+func importBundle(client *McpClient, sections map[string][]map[string]interface{}, onConflict string) (map[string]*importCounts, error) {
+	stats := map[string]*importCounts{}
+
+	if assets := sections["assets"]; len(assets) > 0 {
+		c := &importCounts{}
+		stats["assets"] = c
+		progress := startProgress("Importing assets", "items", int64(len(assets)))
+		defer progress.Finish()
+		for _, a := range assets {
+			progress.Add(1)
+			name := stringField(a, "name")
+			existing, err := findAssetByName(client, name)
+			if err != nil {
+				return stats, err
+			}
+			if existing != nil {
+				switch onConflict {
+				case "fail":
+					return stats, fmt.Errorf("asset %q already exists (id %v)", name, existing["id"])
+				case "skip":
+					c.skipped++
+					continue
+				}
+				args := assetWriteArgs(a)
+				args["assetId"] = existing["id"]
+				if _, err := client.callUpdate("update_asset", args, existing); err != nil {
+					progress.Warnf("  asset %s: %v\n", name, err)
+					c.failed++
+					continue
+				}
+				c.updated++
+				continue
+			}
+			if _, err := client.callToolMap("create_asset", assetWriteArgs(a)); err != nil {
+				progress.Warnf("  asset %s: %v\n", name, err)
+				c.failed++
+				continue
+			}
+			c.created++
+		}
+		progress.Finish()
+	}
+
+	if vulns := sections["vulnerabilities"]; len(vulns) > 0 {
+		c := &importCounts{}
+		stats["vulnerabilities"] = c
+		progress := startProgress("Importing vulnerabilities", "items", int64(len(vulns)))
+		defer progress.Finish()
+		for _, v := range vulns {
+			progress.Add(1)
+			cve := stringField(v, "vulnerabilityId")
+			host := stringField(v, "assetName")
+			exists, err := vulnerabilityExists(client, host, cve)
+			if err != nil {
+				return stats, err
+			}
+			if exists {
+				switch onConflict {
+				case "fail":
+					return stats, fmt.Errorf("%s on %s already exists", cve, host)
+				case "skip":
+					c.skipped++
+					continue
+				}
+			}
+			args := map[string]interface{}{
+				"hostname":    host,
+				"cve":         cve,
+				"criticality": strings.ToUpper(stringField(v, "cvssSeverity")),
+			}
+			if days := numberField(v, "daysOpen"); days > 0 {
+				args["daysOpen"] = int(days)
+			}
+			if _, err := client.callToolMap("add_vulnerability", args); err != nil {
+				progress.Warnf("  %s on %s: %v\n", cve, host, err)
+				c.failed++
+				continue
+			}
+			if exists {
+				c.updated++
+			} else {
+				c.created++
+			}
+		}
+		progress.Finish()
+	}
+	return stats, nil
+}
+
+// assetWriteArgs maps an exported asset onto create_asset/update_asset arguments.
+func assetWriteArgs(a map[string]interface{}) map[string]interface{} {
+	args := map[string]interface{}{}
+	for _, k := range []string{"name", "type", "owner", "ip", "description", "adDomain", "cloudAccountId"} {
+		if v := stringField(a, k); v != "" {
+			args[k] = v
+		}
+	}
+	return args
+}
+
+// findAssetByName returns the asset with exactly this name (names are
+// unique case-insensitively), or nil.
+func findAssetByName(client *McpClient, name string) (map[string]interface{}, error) {
+	assets, err := listAll(client, "get_assets", "assets", map[string]interface{}{"name": name}, 100)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range assets {
+		if strings.EqualFold(stringField(a, "name"), name) {
+			return a, nil
+		}
+	}
+	return nil, nil
+}
+
+func vulnerabilityExists(client *McpClient, host, cve string) (bool, error) {
+	asset, err := findAssetByName(client, host)
+	if err != nil || asset == nil {
+		return false, err
+	}
+	vulns, _, err := listPage(client, "get_vulnerabilities", "vulnerabilities", map[string]interface{}{
+		"assetId":         asset["id"],
+		"cveId":           cve,
+		"includeExcepted": true,
+		"pageSize":        500,
+	})
+	if err != nil {
+		return false, err
+	}
+	for _, v := range vulns {
+		if strings.EqualFold(stringField(v, "vulnerabilityId"), cve) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,571 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/schmalle/secman/scripts/mcp/chart"
+	"github.com/schmalle/secman/scripts/mcp/config"
+)
+
+// A remediation campaign is a named set of findings, fixed when the
+// campaign is created from a filter, whose burn-down is tracked over time.
+// Each `campaign status` syncs with the server and records a snapshot of
+// how many of the campaign's findings are still reported open; a finding
+// that was fixed or excepted no longer is. Findings that appear after
+// creation are not added, so the burn-down shows the sprint's own scope.
+//
+// Campaigns are stored as JSON files in the campaigns directory next to
+// the config file, or in SECMAN_CAMPAIGN_DIR.
+
+type campaign struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	CreatedAt   time.Time              `json:"createdAt"`
+	Due         string                 `json:"due,omitempty"`
+	BaseURL     string                 `json:"baseUrl"`
+	Tenant      string                 `json:"tenant,omitempty"`
+	Filter      map[string]interface{} `json:"filter"`
+	Findings    []campaignFinding      `json:"findings"`
+	Snapshots   []campaignSnapshot     `json:"snapshots"`
+}
+
+type campaignFinding struct {
+	ID        int64  `json:"id"`
+	CVE       string `json:"cve"`
+	AssetID   int64  `json:"assetId"`
+	AssetName string `json:"assetName"`
+	Severity  string `json:"severity"`
+}
+
+type campaignSnapshot struct {
+	Time       time.Time      `json:"time"`
+	Open       int            `json:"open"`
+	BySeverity map[string]int `json:"bySeverity"`
+}
+
+var campaignNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+func campaignDir() string {
+	if dir := setting("SECMAN_CAMPAIGN_DIR"); dir != "" {
+		return dir
+	}
+	dir, err := config.Dir()
+	if err != nil {
+		return "secman-campaigns"
+	}
+	return filepath.Join(dir, "campaigns")
+}
+
+func campaignPath(name string) string {
+	return filepath.Join(campaignDir(), name+".json")
+}
+
+func loadCampaign(name string) (*campaign, error) {
+	data, err := os.ReadFile(campaignPath(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("campaign %q not found in %s", name, campaignDir())
+	}
+	if err != nil {
+		return nil, err
+	}
+	var c campaign
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("%s: %w", campaignPath(name), err)
+	}
+	return &c, nil
+}
+
+// saveCampaign writes the campaign through a temporary file, so an
+// interrupted sync does not lose its history.
+func saveCampaign(c *campaign) error {
+	if err := os.MkdirAll(campaignDir(), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeStateFile(campaignPath(c.Name), append(data, '\n'), 0o644)
+}
+
+func cmdCampaign(client *McpClient, osArgs []string) {
+	if len(osArgs) < 1 {
+		fmt.Fprintln(os.Stderr, "Error: campaign subcommand required")
+		fmt.Fprintf(os.Stderr, "Usage: %s campaign <create|status|report|list> ...\n", progName())
+		exit(ExitUsage)
+	}
+
+	switch osArgs[0] {
+	case "create":
+		cmdCampaignCreate(client, osArgs[1:])
+	case "status":
+		cmdCampaignStatus(client, osArgs[1:])
+	case "report":
+		cmdCampaignReport(client, osArgs[1:])
+	case "list":
+		cmdCampaignList(osArgs[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown campaign subcommand: %s\n", osArgs[0])
+		exit(ExitUsage)
+	}
+}
+
+// campaignName reads the campaign name argument of a subcommand.
+func campaignName(osArgs []string, usage string) string {
+	if len(osArgs) < 1 || strings.HasPrefix(osArgs[0], "-") {
+		fmt.Fprintln(os.Stderr, "Error: campaign name required")
+		fmt.Fprintln(os.Stderr, "Usage: "+usage)
+		exit(ExitUsage)
+	}
+	if !campaignNamePattern.MatchString(osArgs[0]) {
+		fmt.Fprintf(os.Stderr, "Error: invalid campaign name %q (letters, digits, '.', '_' and '-')\n", osArgs[0])
+		exit(ExitUsage)
+	}
+	return osArgs[0]
+}
+
+func cmdCampaignCreate(client *McpClient, osArgs []string) {
+	name := campaignName(osArgs, progName()+" campaign create <name> [--severity S] [--cve CVE] [--asset-id ID] [--due YYYY-MM-DD]")
+
+	fs := flag.NewFlagSet("campaign create", flag.ContinueOnError)
+	severity := fs.String("severity", "", "Only findings of this severity (CRITICAL, HIGH, MEDIUM, LOW)")
+	cve := fs.String("cve", "", "Only findings whose CVE id contains this text")
+	assetID := fs.Int64("asset-id", 0, "Only findings on this asset")
+	due := fs.String("due", "", "Target date (YYYY-MM-DD), shown against the burn-down")
+	description := fs.String("description", "", "Free-text description")
+	force := fs.Bool("force", false, "Replace an existing campaign of the same name")
+	parseFlags(fs, osArgs[1:])
+
+	if *due != "" {
+		if _, err := time.Parse("2006-01-02", *due); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --due %q (use YYYY-MM-DD)\n", *due)
+			exit(ExitUsage)
+		}
+	}
+	if _, err := os.Stat(campaignPath(name)); err == nil && !*force {
+		fmt.Fprintf(os.Stderr, "Error: campaign %q already exists (--force replaces it)\n", name)
+		exit(ExitUsage)
+	}
+
+	filter := map[string]interface{}{}
+	if *severity != "" {
+		filter["severity"] = *severity
+	}
+	if *cve != "" {
+		filter["cveId"] = *cve
+	}
+	if *assetID > 0 {
+		filter["assetId"] = *assetID
+	}
+
+	open, err := campaignOpenFindings(client, filter)
+	if err != nil {
+		fatal(err)
+	}
+	if len(open) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: no open findings match the filter")
+		exit(ExitUsage)
+	}
+
+	c := &campaign{
+		Name:        name,
+		Description: *description,
+		CreatedAt:   time.Now().UTC(),
+		Due:         *due,
+		BaseURL:     client.BaseURL,
+		Tenant:      client.Tenant,
+		Filter:      filter,
+	}
+	for _, f := range open {
+		c.Findings = append(c.Findings, campaignFindingFrom(f))
+	}
+	sort.Slice(c.Findings, func(i, j int) bool { return c.Findings[i].ID < c.Findings[j].ID })
+	c.Snapshots = []campaignSnapshot{c.snapshot(open)}
+
+	if err := saveCampaign(c); err != nil {
+		fatal(err)
+	}
+	status(name, "Created campaign %s with %d finding(s) (%s)\n", name, len(c.Findings), campaignPath(name))
+}
+
+// campaignOpenFindings returns the open findings matching the filter, by id.
+func campaignOpenFindings(client *McpClient, filter map[string]interface{}) (map[int64]map[string]interface{}, error) {
+	args := make(map[string]interface{}, len(filter))
+	for k, v := range filter {
+		args[k] = v
+	}
+	items, err := listAll(client, "get_vulnerabilities", "vulnerabilities", args, 500)
+	if err != nil {
+		return nil, err
+	}
+	open := make(map[int64]map[string]interface{}, len(items))
+	for _, f := range items {
+		open[int64(numberField(f, "id"))] = f
+	}
+	return open, nil
+}
+
+func campaignFindingFrom(f map[string]interface{}) campaignFinding {
+	return campaignFinding{
+		ID:        int64(numberField(f, "id")),
+		CVE:       stringField(f, "vulnerabilityId"),
+		AssetID:   int64(numberField(f, "assetId")),
+		AssetName: stringField(f, "assetName"),
+		Severity:  strings.ToUpper(stringField(f, "cvssSeverity")),
+	}
+}
+
+// snapshot counts which of the campaign's findings are in open.
+func (c *campaign) snapshot(open map[int64]map[string]interface{}) campaignSnapshot {
+	s := campaignSnapshot{Time: time.Now().UTC(), BySeverity: map[string]int{}}
+	for _, f := range c.Findings {
+		if open[f.ID] != nil {
+			s.Open++
+			s.BySeverity[f.Severity]++
+		}
+	}
+	return s
+}
+
+// sync records a snapshot of the campaign's findings against the server.
+func (c *campaign) sync(client *McpClient) (map[int64]map[string]interface{}, error) {
+	if c.BaseURL != client.BaseURL {
+		warnf("Warning: campaign %s was created against %s, syncing with %s\n", c.Name, c.BaseURL, client.BaseURL)
+	}
+	open, err := campaignOpenFindings(client, c.Filter)
+	if err != nil {
+		return nil, err
+	}
+	c.Snapshots = append(c.Snapshots, c.snapshot(open))
+	return open, saveCampaign(c)
+}
+
+func (c *campaign) latest() campaignSnapshot {
+	return c.Snapshots[len(c.Snapshots)-1]
+}
+
+// idealOpen is the number of findings that would still be open on day t if
+// they were closed at a steady rate until the due date.
+func (c *campaign) idealOpen(t time.Time) (int, bool) {
+	if c.Due == "" {
+		return 0, false
+	}
+	due, _ := time.Parse("2006-01-02", c.Due)
+	due = due.Add(24 * time.Hour)
+	span := due.Sub(c.CreatedAt)
+	if span <= 0 || !t.Before(due) {
+		return 0, true
+	}
+	left := float64(due.Sub(t)) / float64(span)
+	return int(float64(len(c.Findings))*left + 0.5), true
+}
+
+// campaignSummary is the machine-readable form of a campaign's progress.
+type campaignSummary struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description,omitempty"`
+	CreatedAt   time.Time          `json:"createdAt"`
+	Due         string             `json:"due,omitempty"`
+	Total       int                `json:"total"`
+	Open        int                `json:"open"`
+	Closed      int                `json:"closed"`
+	PercentDone int                `json:"percentDone"`
+	IdealOpen   *int               `json:"idealOpen,omitempty"`
+	BySeverity  map[string]int     `json:"openBySeverity"`
+	Snapshots   []campaignSnapshot `json:"snapshots"`
+	Remaining   []campaignFinding  `json:"remaining"`
+}
+
+func (c *campaign) summary(open map[int64]map[string]interface{}) campaignSummary {
+	last := c.latest()
+	s := campaignSummary{
+		Name:        c.Name,
+		Description: c.Description,
+		CreatedAt:   c.CreatedAt,
+		Due:         c.Due,
+		Total:       len(c.Findings),
+		Open:        last.Open,
+		Closed:      len(c.Findings) - last.Open,
+		BySeverity:  last.BySeverity,
+		Snapshots:   c.Snapshots,
+		Remaining:   []campaignFinding{},
+	}
+	if s.Total > 0 {
+		s.PercentDone = s.Closed * 100 / s.Total
+	}
+	if ideal, ok := c.idealOpen(last.Time); ok {
+		s.IdealOpen = &ideal
+	}
+	for _, f := range c.Findings {
+		if open == nil || open[f.ID] != nil {
+			s.Remaining = append(s.Remaining, f)
+		}
+	}
+	sort.SliceStable(s.Remaining, func(i, j int) bool {
+		return severityFactor(s.Remaining[i].Severity) > severityFactor(s.Remaining[j].Severity)
+	})
+	return s
+}
+
+func cmdCampaignStatus(client *McpClient, osArgs []string) {
+	name := campaignName(osArgs, progName()+" campaign status <name> [--no-sync] [--remaining N] [--json]")
+
+	fs := flag.NewFlagSet("campaign status", flag.ContinueOnError)
+	noSync := fs.Bool("no-sync", false, "Show the recorded snapshots without querying the server")
+	remaining := fs.Int("remaining", 10, "Number of open findings to list (0 for none)")
+	asJSON := fs.Bool("json", false, "Print the progress and snapshots as JSON")
+	parseFlags(fs, osArgs[1:])
+
+	c, err := loadCampaign(name)
+	if err != nil {
+		fatal(err)
+	}
+	var open map[int64]map[string]interface{}
+	if !*noSync {
+		if open, err = c.sync(client); err != nil {
+			fatal(err)
+		}
+	}
+	s := c.summary(open)
+
+	if rawOutput(*asJSON) {
+		printResult(s)
+		return
+	}
+
+	fmt.Printf("Campaign %s", c.Name)
+	if c.Description != "" {
+		fmt.Printf(": %s", c.Description)
+	}
+	fmt.Printf("\nCreated %s", c.CreatedAt.Format("2006-01-02"))
+	if c.Due != "" {
+		fmt.Printf(", due %s", c.Due)
+	}
+	fmt.Printf("\n\n%s %d%% done: %d of %d closed, %d open", progressBar(s.Closed, s.Total, 30), s.PercentDone, s.Closed, s.Total, s.Open)
+	if s.IdealOpen != nil {
+		if s.Open > *s.IdealOpen {
+			fmt.Printf(" (%s, plan: %d open)", paint(styleFail, "behind"), *s.IdealOpen)
+		} else {
+			fmt.Printf(" (%s, plan: %d open)", paint(styleOK, "on track"), *s.IdealOpen)
+		}
+	}
+	fmt.Println()
+	for _, sev := range severityOrder {
+		if n := s.BySeverity[sev]; n > 0 {
+			fmt.Printf("  %s %d open\n", severityCell(sev, 10), n)
+		}
+	}
+
+	fmt.Println("\nBurn-down (open findings per snapshot)")
+	for _, snap := range burnDownPoints(c.Snapshots) {
+		fmt.Printf("  %s %5d  %s\n", snap.Time.Local().Format("2006-01-02 15:04"), snap.Open, bar(snap.Open, s.Total, 40))
+	}
+
+	if *remaining > 0 && open != nil && len(s.Remaining) > 0 {
+		fmt.Printf("\nOpen findings (%d):\n", len(s.Remaining))
+		for i, f := range s.Remaining {
+			if i == *remaining {
+				fmt.Printf("  ... %d more (--remaining 0 hides this list, --json lists all)\n", len(s.Remaining)-i)
+				break
+			}
+			fmt.Printf("  %-18s %s %s\n", f.CVE, severityCell(f.Severity, 10), f.AssetName)
+		}
+	}
+}
+
+// burnDownPoints keeps the creation snapshot and the last snapshot of each
+// day, so repeated syncs on one day show as a single point.
+func burnDownPoints(snapshots []campaignSnapshot) []campaignSnapshot {
+	var points []campaignSnapshot
+	for _, s := range snapshots {
+		day := s.Time.Local().Format("2006-01-02")
+		if n := len(points); n > 1 && points[n-1].Time.Local().Format("2006-01-02") == day {
+			points[n-1] = s
+			continue
+		}
+		points = append(points, s)
+	}
+	return points
+}
+
+// progressBar renders done/total as a fixed-width bar.
+func progressBar(done, total, width int) string {
+	filled := 0
+	if total > 0 {
+		filled = done * width / total
+	}
+	return "[" + paint(styleOK, strings.Repeat("#", filled)) + strings.Repeat(".", width-filled) + "]"
+}
+
+func cmdCampaignList(osArgs []string) {
+	fs := flag.NewFlagSet("campaign list", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "Print the campaigns as JSON")
+	parseFlags(fs, osArgs)
+
+	paths, _ := filepath.Glob(filepath.Join(campaignDir(), "*.json"))
+	var campaigns []*campaign
+	summaries := []campaignSummary{}
+	for _, path := range paths {
+		c, err := loadCampaign(strings.TrimSuffix(filepath.Base(path), ".json"))
+		if err != nil {
+			warnf("Warning: %v\n", err)
+			continue
+		}
+		s := c.summary(nil)
+		s.Snapshots, s.Remaining = nil, nil
+		campaigns = append(campaigns, c)
+		summaries = append(summaries, s)
+	}
+
+	if rawOutput(*asJSON) {
+		printResult(summaries)
+		return
+	}
+	if len(summaries) == 0 {
+		fmt.Printf("No campaigns in %s\n", campaignDir())
+		return
+	}
+	fmt.Printf("  %-24s %-10s %6s %6s %5s  %s\n", "NAME", "DUE", "TOTAL", "OPEN", "DONE", "LAST SYNC")
+	for i, s := range summaries {
+		fmt.Printf("  %-24s %-10s %6d %6d %4d%%  %s\n", s.Name, orNone(s.Due), s.Total, s.Open, s.PercentDone,
+			campaigns[i].latest().Time.Local().Format("2006-01-02 15:04"))
+	}
+}
+
+func cmdCampaignReport(client *McpClient, osArgs []string) {
+	name := campaignName(osArgs, progName()+" campaign report <name> [--output file.html] [--no-sync]")
+
+	fs := flag.NewFlagSet("campaign report", flag.ContinueOnError)
+	output := fs.String("output", "", "Report file (default: campaign-<name>.html)")
+	noSync := fs.Bool("no-sync", false, "Use the recorded snapshots without querying the server")
+	sign := addSignFlag(fs)
+	dest := addDestinationFlags(fs)
+	parseFlags(fs, osArgs[1:])
+
+	c, err := loadCampaign(name)
+	if err != nil {
+		fatal(err)
+	}
+	var open map[int64]map[string]interface{}
+	if !*noSync {
+		if open, err = c.sync(client); err != nil {
+			fatal(err)
+		}
+	}
+
+	path := *output
+	if path == "" {
+		path = "campaign-" + name + ".html"
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		fatal(err)
+	}
+	summary := c.summary(open)
+	err = campaignReportTemplate.Execute(f, campaignReportData{
+		Summary:  summary,
+		Chart:    svgHTML(burnDownChart(c)),
+		Severity: svgHTML(severityChart("Open findings by severity", summary.BySeverity)),
+		Synced:   open != nil,
+	})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		fatal(err)
+	}
+
+	signOutput(client, path, *sign)
+	uploadOutput(client, path, *sign != "", dest)
+	status(path, "Wrote campaign report to %s\n", path)
+}
+
+type campaignReportData struct {
+	Summary  campaignSummary
+	Chart    template.HTML
+	Severity template.HTML
+	Synced   bool
+}
+
+// svgHTML inlines a chart in an HTML report. The markup is built by the
+// chart package, which escapes all text.
+func svgHTML(c chart.Chart) template.HTML {
+	return template.HTML(c.SVG())
+}
+
+// burnDownChart draws the open findings per day as a line, with the
+// planned steady burn-down to the due date as a dashed line.
+func burnDownChart(c *campaign) *chart.LineChart {
+	points := burnDownPoints(c.Snapshots)
+	start := c.CreatedAt
+	end := points[len(points)-1].Time
+	total := float64(len(c.Findings))
+	x := func(t time.Time) float64 { return t.Sub(start).Seconds() }
+
+	ch := &chart.LineChart{Frame: chart.Frame{Title: "Open findings"}, YMax: total}
+	if c.Due != "" {
+		if due, err := time.Parse("2006-01-02", c.Due); err == nil {
+			due = due.Add(24 * time.Hour)
+			if due.After(end) {
+				end = due
+			}
+			ch.Series = append(ch.Series, chart.Series{Name: "plan", Color: "#888888", Dashed: true,
+				Points: []chart.Point{{X: x(start), Y: total}, {X: x(due)}}})
+		}
+	}
+	open := chart.Series{Name: "open", Color: chart.Critical, Markers: true}
+	for _, p := range points {
+		open.Points = append(open.Points, chart.Point{X: x(p.Time), Y: float64(p.Open),
+			Title: fmt.Sprintf("%s: %d open", p.Time.Local().Format("2006-01-02"), p.Open)})
+	}
+	ch.Series = append(ch.Series, open)
+	ch.StartLabel = start.Local().Format("2006-01-02")
+	ch.EndLabel = end.Local().Format("2006-01-02")
+	return ch
+}
+
+var campaignReportTemplate = template.Must(template.New("campaign").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Remediation campaign {{.Summary.Name}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; }
+th, td { text-align: left; padding: 2px 12px 2px 0; }
+.bar { background: #eee; width: 320px; height: 14px; }
+.bar div { background: #27ae60; height: 14px; }
+</style>
+</head>
+<body>
+<h1>Remediation campaign {{.Summary.Name}}</h1>
+{{with .Summary.Description}}<p>{{.}}</p>{{end}}
+<p>Created {{.Summary.CreatedAt.Format "2006-01-02"}}{{with .Summary.Due}}, due {{.}}{{end}}</p>
+<div class="bar"><div style="width: {{.Summary.PercentDone}}%"></div></div>
+<p>{{.Summary.PercentDone}}% done: {{.Summary.Closed}} of {{.Summary.Total}} findings closed, {{.Summary.Open}} open{{with .Summary.IdealOpen}} (plan: {{.}} open){{end}}.</p>
+{{.Severity}}
+<h2>Burn-down</h2>
+{{.Chart}}
+<p><small>Solid: open findings per day. Dashed: steady burn-down to the due date.</small></p>
+{{if .Synced}}
+<h2>Open findings ({{len .Summary.Remaining}})</h2>
+<table>
+<tr><th>CVE</th><th>Severity</th><th>Asset</th></tr>
+{{range .Summary.Remaining}}<tr><td>{{.CVE}}</td><td>{{.Severity}}</td><td>{{.AssetName}}</td></tr>
+{{end}}</table>
+{{end}}
+</body>
+</html>
+`))
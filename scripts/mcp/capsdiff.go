@@ -0,0 +1,327 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// capabilities diff compares the tool catalogs of two deployments, named
+// by profiles of the config file, to check an upgraded server before
+// automations are pointed at it. Changes that break existing callers are
+// marked: a removed tool or property, a newly required property, a changed
+// type, a removed enum value, or a schema that stopped accepting unknown
+// arguments. Everything else (new tools, new optional properties, new enum
+// values, descriptions, defaults) is reported as compatible.
+
+// capsSide is one of the compared deployments.
+type capsSide struct {
+	Profile string `json:"profile"`
+	URL     string `json:"url"`
+	Server  string `json:"server,omitempty"`
+	Tools   int    `json:"tools"`
+}
+
+// schemaChange is one difference within a tool.
+type schemaChange struct {
+	Change   string `json:"change"`
+	Breaking bool   `json:"breaking,omitempty"`
+}
+
+// toolDiff is a tool that differs between the sides.
+type toolDiff struct {
+	Tool     string         `json:"tool"`
+	Status   string         `json:"status"`
+	Breaking bool           `json:"breaking,omitempty"`
+	Changes  []schemaChange `json:"changes,omitempty"`
+}
+
+type capsDiff struct {
+	From     capsSide   `json:"from"`
+	To       capsSide   `json:"to"`
+	Tools    []toolDiff `json:"tools"`
+	Added    int        `json:"added"`
+	Removed  int        `json:"removed"`
+	Changed  int        `json:"changed"`
+	Breaking int        `json:"breaking"`
+}
+
+const (
+	toolAdded   = "added"
+	toolRemoved = "removed"
+	toolChanged = "changed"
+)
+
+func cmdCapabilitiesDiff(client *McpClient, osArgs []string) {
+	fs := flag.NewFlagSet("capabilities diff", flag.ContinueOnError)
+	var profiles stringList
+	fs.Var(&profiles, "profile", "Profile to compare (twice: from and to; once: the active settings against it)")
+	failOn := fs.String("fail-on", "breaking", "Exit 5 on breaking changes, any change, or never")
+	asJSON := fs.Bool("json", false, "Print the differences as JSON")
+	parseFlags(fs, osArgs)
+	usage := "Usage: " + progName() + " capabilities diff --profile staging --profile prod [--fail-on breaking|any|never] [--json]"
+	if len(profiles) < 1 || len(profiles) > 2 {
+		fmt.Fprintln(os.Stderr, "Error: one or two --profile flags required")
+		fmt.Fprintln(os.Stderr, usage)
+		exit(ExitUsage)
+	}
+	switch *failOn {
+	case "breaking", "any", "never":
+	default:
+		fmt.Fprintf(os.Stderr, "Error: --fail-on must be breaking, any or never, not %q\n", *failOn)
+		exit(ExitUsage)
+	}
+
+	from, to := client, client
+	fromName, toName := "active settings", profiles[0]
+	var err error
+	if len(profiles) == 2 {
+		fromName, toName = profiles[0], profiles[1]
+		if from, err = profileClient(client, fromName); err != nil {
+			fatal(err)
+		}
+	}
+	if to, err = profileClient(client, toName); err != nil {
+		fatal(err)
+	}
+	if from.BaseURL == to.BaseURL && from.APIKey == to.APIKey && from.UserEmail == to.UserEmail {
+		warnf("Warning: %s and %s resolve to the same server and credentials (%s)\n", fromName, toName, from.BaseURL)
+	}
+
+	fromCaps, err := from.GetCapabilities()
+	if err != nil {
+		fatal(fmt.Errorf("%s: %w", fromName, err))
+	}
+	toCaps, err := to.GetCapabilities()
+	if err != nil {
+		fatal(fmt.Errorf("%s: %w", toName, err))
+	}
+	diff := diffCapabilities(fromCaps.Capabilities.Tools, toCaps.Capabilities.Tools)
+	diff.From = capsSide{Profile: fromName, URL: from.BaseURL, Server: serverVersion(fromCaps), Tools: len(fromCaps.Capabilities.Tools)}
+	diff.To = capsSide{Profile: toName, URL: to.BaseURL, Server: serverVersion(toCaps), Tools: len(toCaps.Capabilities.Tools)}
+
+	if rawOutput(*asJSON) {
+		printResult(diff)
+	} else {
+		printCapsDiff(diff)
+	}
+	if (*failOn == "breaking" && diff.Breaking > 0) || (*failOn == "any" && len(diff.Tools) > 0) {
+		exit(ExitGateFailed)
+	}
+}
+
+// serverVersion renders the server name and version from serverInfo.
+func serverVersion(caps *CapabilitiesResponse) string {
+	var parts []string
+	for _, key := range []string{"name", "version"} {
+		if v, ok := caps.ServerInfo[key]; ok && v != nil {
+			parts = append(parts, fmt.Sprint(v))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func diffCapabilities(from, to []ToolDefinition) *capsDiff {
+	fromTools, toTools := map[string]ToolDefinition{}, map[string]ToolDefinition{}
+	names := map[string]bool{}
+	for _, t := range from {
+		fromTools[t.Name], names[t.Name] = t, true
+	}
+	for _, t := range to {
+		toTools[t.Name], names[t.Name] = t, true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	diff := &capsDiff{Tools: []toolDiff{}}
+	for _, name := range sorted {
+		a, inFrom := fromTools[name]
+		b, inTo := toTools[name]
+		var d toolDiff
+		switch {
+		case !inTo:
+			d = toolDiff{Tool: name, Status: toolRemoved, Breaking: true}
+			diff.Removed++
+		case !inFrom:
+			d = toolDiff{Tool: name, Status: toolAdded}
+			diff.Added++
+		default:
+			changes := diffToolDefs(a, b)
+			if len(changes) == 0 {
+				continue
+			}
+			d = toolDiff{Tool: name, Status: toolChanged, Changes: changes}
+			for _, c := range changes {
+				d.Breaking = d.Breaking || c.Breaking
+			}
+			diff.Changed++
+		}
+		if d.Breaking {
+			diff.Breaking++
+		}
+		diff.Tools = append(diff.Tools, d)
+	}
+	return diff
+}
+
+// diffToolDefs lists the differences between two versions of a tool.
+func diffToolDefs(a, b ToolDefinition) []schemaChange {
+	var changes []schemaChange
+	add := func(breaking bool, format string, args ...interface{}) {
+		changes = append(changes, schemaChange{Change: fmt.Sprintf(format, args...), Breaking: breaking})
+	}
+	if strings.TrimSpace(a.Description) != strings.TrimSpace(b.Description) {
+		add(false, "description changed")
+	}
+	_, aProps, aRequired := schemaParams(a)
+	_, bProps, bRequired := schemaParams(b)
+
+	for _, name := range unionKeys(aProps, bProps) {
+		ap, inA := aProps[name].(map[string]interface{})
+		bp, inB := bProps[name].(map[string]interface{})
+		switch {
+		case !inB:
+			add(true, "property %s removed", name)
+			continue
+		case !inA:
+			if bRequired[name] {
+				add(true, "property %s added, required", name)
+			} else {
+				add(false, "property %s added", name)
+			}
+			continue
+		}
+		if at, bt := schemaType(ap), schemaType(bp); at != bt {
+			add(true, "%s: type %s -> %s", name, orNone(at), orNone(bt))
+		}
+		aEnum, aHas := ap["enum"].([]interface{})
+		bEnum, bHas := bp["enum"].([]interface{})
+		switch {
+		case aHas && bHas:
+			if removed := enumMinus(aEnum, bEnum); len(removed) > 0 {
+				add(true, "%s: enum values removed: %s", name, strings.Join(removed, ", "))
+			}
+			if added := enumMinus(bEnum, aEnum); len(added) > 0 {
+				add(false, "%s: enum values added: %s", name, strings.Join(added, ", "))
+			}
+		case bHas:
+			add(true, "%s: now restricted to %s", name, strings.Join(enumMinus(bEnum, nil), ", "))
+		case aHas:
+			add(false, "%s: no longer restricted to an enum", name)
+		}
+		if !reflect.DeepEqual(ap["default"], bp["default"]) {
+			add(false, "%s: default %s -> %s", name, jsonText(ap["default"]), jsonText(bp["default"]))
+		}
+		if !aRequired[name] && bRequired[name] {
+			add(true, "%s: now required", name)
+		} else if aRequired[name] && !bRequired[name] {
+			add(false, "%s: no longer required", name)
+		}
+		if rest := otherSchemaKeys(ap, bp); len(rest) > 0 {
+			add(false, "%s: %s changed", name, strings.Join(rest, ", "))
+		}
+	}
+	aExtra, _ := a.InputSchema["additionalProperties"].(bool)
+	bExtra, bSet := b.InputSchema["additionalProperties"].(bool)
+	if _, aSet := a.InputSchema["additionalProperties"].(bool); (!aSet || aExtra) && bSet && !bExtra {
+		add(true, "unknown arguments are now rejected")
+	} else if aSet && !aExtra && (!bSet || bExtra) {
+		add(false, "unknown arguments are now accepted")
+	}
+	return changes
+}
+
+func unionKeys(a, b map[string]interface{}) []string {
+	seen := map[string]bool{}
+	for k := range a {
+		seen[k] = true
+	}
+	for k := range b {
+		seen[k] = true
+	}
+	keys := make([]string, 0, len(seen))
+	for k := range seen {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// enumMinus returns the values of a that are not in b.
+func enumMinus(a, b []interface{}) []string {
+	var out []string
+	for _, v := range a {
+		if !enumContains(b, v) {
+			out = append(out, fmt.Sprint(v))
+		}
+	}
+	return out
+}
+
+// otherSchemaKeys names the keywords besides those compared above that
+// differ, such as description, minimum or format.
+func otherSchemaKeys(a, b map[string]interface{}) []string {
+	compared := map[string]bool{"type": true, "enum": true, "default": true, "items": true}
+	var keys []string
+	for _, k := range unionKeys(a, b) {
+		if !compared[k] && !reflect.DeepEqual(a[k], b[k]) {
+			keys = append(keys, k)
+		}
+	}
+	if ai, bi := a["items"], b["items"]; !reflect.DeepEqual(ai, bi) && schemaType(a) == schemaType(b) {
+		keys = append(keys, "items")
+	}
+	return keys
+}
+
+func jsonText(v interface{}) string {
+	if v == nil {
+		return "none"
+	}
+	raw, _ := json.Marshal(v)
+	return string(raw)
+}
+
+func printCapsDiff(diff *capsDiff) {
+	side := func(s capsSide) string {
+		text := fmt.Sprintf("%s (%s", s.Profile, s.URL)
+		if s.Server != "" {
+			text += ", " + s.Server
+		}
+		return text + fmt.Sprintf(", %d tools)", s.Tools)
+	}
+	fmt.Printf("From: %s\nTo:   %s\n\n", side(diff.From), side(diff.To))
+	if len(diff.Tools) == 0 {
+		fmt.Println("No differences")
+		return
+	}
+	for _, d := range diff.Tools {
+		mark, style := "~", styleMedium
+		switch d.Status {
+		case toolAdded:
+			mark, style = "+", styleOK
+		case toolRemoved:
+			mark, style = "-", styleFail
+		}
+		line := fmt.Sprintf("%s %-40s %s", mark, d.Tool, d.Status)
+		if d.Breaking {
+			line += "  " + paint(styleFail, "BREAKING")
+		}
+		fmt.Println(paint(style, line[:2]) + line[2:])
+		for _, c := range d.Changes {
+			text := c.Change
+			if c.Breaking {
+				text = paint(styleFail, text)
+			}
+			fmt.Printf("    %s\n", text)
+		}
+	}
+	fmt.Printf("\n%d added, %d removed, %d changed; %d with breaking changes\n", diff.Added, diff.Removed, diff.Changed, diff.Breaking)
+}
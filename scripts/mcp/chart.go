@@ -0,0 +1,294 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Terminal charts: sparklines of the open findings per severity over the
+// snapshots in the snapshot store, and a heatmap of risk by subnet. They
+// are drawn with Unicode block characters when stdout is a terminal, next
+// to the numbers stats and report trend print anyway.
+
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// heatShades go from no risk to the highest risk on the map.
+var heatShades = []string{"·", "░", "▒", "▓", "█"}
+
+// chartsEnabled reports whether stdout is a terminal that can show charts.
+func chartsEnabled() bool {
+	if os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// sparkline scales values between their minimum and maximum onto eight
+// block heights.
+func sparkline(values []int) string {
+	if len(values) == 0 {
+		return ""
+	}
+	lo, hi := values[0], values[0]
+	for _, v := range values {
+		lo, hi = min(lo, v), max(hi, v)
+	}
+	var b strings.Builder
+	for _, v := range values {
+		i := 0
+		if hi > lo {
+			i = (v - lo) * (len(sparkBlocks) - 1) / (hi - lo)
+		}
+		b.WriteRune(sparkBlocks[i])
+	}
+	return b.String()
+}
+
+// heatShade picks the shade of value on a scale up to hi.
+func heatShade(value, hi float64) string {
+	if value <= 0 || hi <= 0 {
+		return heatShades[0]
+	}
+	i := 1 + int(value/hi*float64(len(heatShades)-2)+0.5)
+	return heatShades[min(i, len(heatShades)-1)]
+}
+
+// trendPoint counts the open findings by severity in one snapshot.
+type trendPoint struct {
+	Taken    time.Time      `json:"taken"`
+	Counts   map[string]int `json:"counts"`
+	Total    int            `json:"total"`
+	Snapshot string         `json:"snapshot"`
+}
+
+// severityTrend reads the findings of the snapshots taken within r, at
+// most the newest maxPoints of them (0 for all).
+func severityTrend(r timeRange, maxPoints int) ([]trendPoint, error) {
+	files, err := listSnapshots(snapshotDir())
+	if err != nil {
+		return nil, err
+	}
+	var picked []snapshotFile
+	for _, f := range files {
+		if r.contains(f.Taken) {
+			picked = append(picked, f)
+		}
+	}
+	if maxPoints > 0 && len(picked) > maxPoints {
+		picked = picked[len(picked)-maxPoints:]
+	}
+	var points []trendPoint
+	for _, f := range picked {
+		_, sections, _, err := readBackup(f.Path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Path, err)
+		}
+		vulns, ok := sections["vulnerabilities"]
+		// A snapshot without the section says nothing about findings.
+		if !ok {
+			continue
+		}
+		p := trendPoint{Taken: f.Taken, Counts: map[string]int{}, Snapshot: f.Path}
+		for _, v := range vulns {
+			p.Counts[strings.ToUpper(stringField(v, "cvssSeverity"))]++
+		}
+		for _, sev := range severityOrder {
+			p.Total += p.Counts[sev]
+		}
+		points = append(points, p)
+	}
+	return points, nil
+}
+
+// printSeverityTrend draws one sparkline per severity and the total, with
+// the first and last value.
+func printSeverityTrend(points []trendPoint) {
+	fmt.Printf("Open vulnerabilities over %d snapshot(s), %s to %s\n", len(points),
+		points[0].Taken.Format("2006-01-02"), points[len(points)-1].Taken.Format("2006-01-02"))
+	series := func(sev string) []int {
+		values := make([]int, len(points))
+		for i, p := range points {
+			if sev == "" {
+				values[i] = p.Total
+			} else {
+				values[i] = p.Counts[sev]
+			}
+		}
+		return values
+	}
+	line := func(label, style string, values []int) {
+		first, last := values[0], values[len(values)-1]
+		delta := fmt.Sprintf("%+d", last-first)
+		fmt.Printf("  %s %s %6d -> %-6d %s\n", label, paint(style, sparkline(values)), first, last, delta)
+	}
+	for _, sev := range severityOrder {
+		line(severityCell(sev, 10), severityStyle(sev), series(sev))
+	}
+	line(fmt.Sprintf("%-10s", "TOTAL"), "", series(""))
+}
+
+// subnetRisk is the weighted open findings of the assets in one /24.
+type subnetRisk struct {
+	Subnet string  `json:"subnet"`
+	Assets int     `json:"assets"`
+	Risk   float64 `json:"risk"`
+}
+
+// collectSubnetRisk sums the heatmap's severity counts, weighted like the
+// risk score's severity factor, over the IPv4 /24 of each asset.
+func collectSubnetRisk(client *McpClient) ([]subnetRisk, error) {
+	heatmap, err := client.callToolMap("get_vulnerability_heatmap", map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
+	assets, err := listAll(client, "get_assets", "assets", nil, 500)
+	if err != nil {
+		return nil, err
+	}
+	subnets := map[int64]string{}
+	for _, a := range assets {
+		ip := strings.TrimSpace(strings.Split(stringField(a, "ip"), ",")[0])
+		if v4 := net.ParseIP(ip).To4(); v4 != nil && !isDecommissioned(a) {
+			subnets[int64(numberField(a, "id"))] = fmt.Sprintf("%d.%d.%d.0/24", v4[0], v4[1], v4[2])
+		}
+	}
+	bySubnet := map[string]*subnetRisk{}
+	for _, e := range mapsField(heatmap, "entries") {
+		subnet, ok := subnets[int64(numberField(e, "assetId"))]
+		if !ok {
+			continue
+		}
+		s := bySubnet[subnet]
+		if s == nil {
+			s = &subnetRisk{Subnet: subnet}
+			bySubnet[subnet] = s
+		}
+		s.Assets++
+		s.Risk += severityFactor("CRITICAL")*numberField(e, "criticalCount") + severityFactor("HIGH")*numberField(e, "highCount") +
+			severityFactor("MEDIUM")*numberField(e, "mediumCount") + severityFactor("LOW")*numberField(e, "lowCount")
+	}
+	out := make([]subnetRisk, 0, len(bySubnet))
+	for _, s := range bySubnet {
+		out = append(out, *s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Risk > out[j].Risk })
+	return out, nil
+}
+
+// printSubnetHeatmap draws a row per /16 with a cell per sixteen /24s, so
+// a row spans the /16 from .0 to .255, shaded by the riskiest /24 in the
+// cell. The riskiest /16s come first.
+func printSubnetHeatmap(subnets []subnetRisk, rows int) {
+	if len(subnets) == 0 {
+		return
+	}
+	type row struct {
+		prefix string
+		cells  [16]float64
+		risk   float64
+	}
+	byPrefix := map[string]*row{}
+	var order []*row
+	hi := 0.0
+	for _, s := range subnets {
+		ip := net.ParseIP(strings.TrimSuffix(s.Subnet, "/24")).To4()
+		prefix := fmt.Sprintf("%d.%d", ip[0], ip[1])
+		r := byPrefix[prefix]
+		if r == nil {
+			r = &row{prefix: prefix}
+			byPrefix[prefix] = r
+			order = append(order, r)
+		}
+		cell := ip[2] / 16
+		r.cells[cell] = max(r.cells[cell], s.Risk)
+		r.risk += s.Risk
+		hi = max(hi, s.Risk)
+	}
+	sort.SliceStable(order, func(i, j int) bool { return order[i].risk > order[j].risk })
+
+	fmt.Printf("Risk by subnet (%d /24s with findings; each cell is 16 /24s)\n", len(subnets))
+	fmt.Printf("  %-9s %s\n", "", ".0      .64     .128    .192")
+	for i, r := range order {
+		if i == rows {
+			fmt.Printf("  ... %d more /16s\n", len(order)-rows)
+			break
+		}
+		var b strings.Builder
+		for _, v := range r.cells {
+			shade := heatShade(v, hi)
+			b.WriteString(paint(heatStyle(v, hi), shade+shade))
+		}
+		fmt.Printf("  %-9s %s %8.1f\n", r.prefix+".x", b.String(), r.risk)
+	}
+	fmt.Printf("  %-9s %s low to high; riskiest: ", "", strings.Join(heatShades, ""))
+	for i, s := range subnets {
+		if i == 3 {
+			break
+		}
+		if i > 0 {
+			fmt.Print(", ")
+		}
+		fmt.Printf("%s (%.1f)", s.Subnet, s.Risk)
+	}
+	fmt.Println()
+}
+
+// heatStyle colors a cell like the severity of its share of the highest risk.
+func heatStyle(value, hi float64) string {
+	switch {
+	case value <= 0 || hi <= 0:
+		return ""
+	case value >= hi*0.75:
+		return styleCritical
+	case value >= hi*0.5:
+		return styleHigh
+	case value >= hi*0.25:
+		return styleMedium
+	}
+	return styleLow
+}
+
+func cmdReportTrend(osArgs []string) {
+	fs := flag.NewFlagSet("report trend", flag.ContinueOnError)
+	since := fs.String("since", "90d", "Only snapshots taken since this time (e.g. 30d, 2025-01-01)")
+	points := fs.Int("points", 0, "Use at most the newest N snapshots (default: all)")
+	asJSON := fs.Bool("json", false, "Print the counts per snapshot as JSON")
+	parseFlags(fs, osArgs)
+
+	var r timeRange
+	if *since != "" {
+		t, err := parseTimeExpr(*since, time.Now())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --since: %v\n", err)
+			exit(ExitUsage)
+		}
+		r.After = t
+	}
+	trend, err := severityTrend(r, *points)
+	if err != nil {
+		fatal(err)
+	}
+	if rawOutput(*asJSON) {
+		printResult(trend)
+		return
+	}
+	if len(trend) == 0 {
+		fmt.Printf("No snapshots with findings in %s since %s; take them with `snapshot take`\n", snapshotDir(), r.After.Format("2006-01-02"))
+		return
+	}
+	if chartsEnabled() && len(trend) > 1 {
+		printSeverityTrend(trend)
+		fmt.Println()
+	}
+	fmt.Printf("%-16s %8s %8s %8s %8s %8s\n", "SNAPSHOT", "CRITICAL", "HIGH", "MEDIUM", "LOW", "TOTAL")
+	for _, p := range trend {
+		fmt.Printf("%-16s %8d %8d %8d %8d %8d\n", p.Taken.Format("2006-01-02 15:04"), p.Counts["CRITICAL"], p.Counts["HIGH"],
+			p.Counts["MEDIUM"], p.Counts["LOW"], p.Total)
+	}
+}
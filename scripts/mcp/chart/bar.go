@@ -0,0 +1,111 @@
+package chart
+
+import "math"
+
+// Bar is one bar, or one part of a stacked bar.
+type Bar struct {
+	Label string
+	Value float64
+	Color string
+}
+
+// BarChart draws vertical bars from zero, such as findings per severity.
+type BarChart struct {
+	Frame
+	Bars []Bar
+	// Max is the top of the scale; zero scales to the largest bar.
+	Max float64
+	// Unit follows the values, e.g. "%".
+	Unit string
+}
+
+func (b *BarChart) SVG() []byte { return renderSVG(b.Frame, b.draw) }
+
+func (b *BarChart) PNG() ([]byte, error) { return renderPNG(b.Frame, b.draw) }
+
+func (b *BarChart) draw(c canvas, w, h float64) {
+	const top, left, right, below = 36.0, 40.0, 12.0, 24.0
+	bottom := h - below
+	hi := b.Max
+	for _, bar := range b.Bars {
+		hi = math.Max(hi, bar.Value)
+	}
+	if hi <= 0 {
+		hi = 1
+	}
+	c.line([]point{{left, top}, {left, bottom}, {w - right, bottom}}, Gray, 1, false)
+	c.text(left-4, top+4, formatValue(hi, b.Unit), 11, "end", "#444444")
+	c.text(left-4, bottom+4, "0", 11, "end", "#444444")
+	if len(b.Bars) == 0 {
+		return
+	}
+	slot := (w - right - left) / float64(len(b.Bars))
+	for i, bar := range b.Bars {
+		x := left + slot*float64(i)
+		height := (bottom - top) * math.Max(bar.Value, 0) / hi
+		c.rect(x+slot*0.2, bottom-height, slot*0.6, height, colorOr(bar.Color, Gray))
+		c.text(x+slot/2, bottom-height-4, formatValue(bar.Value, b.Unit), 11, "middle", "#222222")
+		c.text(x+slot/2, bottom+15, bar.Label, 11, "middle", "#444444")
+	}
+}
+
+// StackedBar is one row of a StackedBarChart.
+type StackedBar struct {
+	Label string
+	Parts []Bar
+	// Note is written after the bar, e.g. "92% within SLA".
+	Note string
+}
+
+// StackedBarChart draws a horizontal bar per row, split into the parts'
+// shares of the row's total, so rows of different totals compare as
+// percentages. The parts of the first row make the legend.
+type StackedBarChart struct {
+	Frame
+	Rows []StackedBar
+}
+
+func (s *StackedBarChart) SVG() []byte { return renderSVG(s.Frame, s.draw) }
+
+func (s *StackedBarChart) PNG() ([]byte, error) { return renderPNG(s.Frame, s.draw) }
+
+func (s *StackedBarChart) draw(c canvas, w, h float64) {
+	const top, labels, notes = 32.0, 90.0, 120.0
+	if len(s.Rows) == 0 {
+		return
+	}
+	var items []legendItem
+	for _, p := range s.Rows[0].Parts {
+		items = append(items, legendItem{p.Label, colorOr(p.Color, Gray)})
+	}
+	legend(c, w, items)
+
+	rowH := math.Min(32, (h-top-8)/float64(len(s.Rows)))
+	width := w - labels - notes
+	for i, row := range s.Rows {
+		y := top + rowH*float64(i)
+		c.text(labels-8, y+rowH*0.6, row.Label, 11, "end", "#444444")
+		total := 0.0
+		for _, p := range row.Parts {
+			total += math.Max(p.Value, 0)
+		}
+		if total == 0 {
+			c.rect(labels, y+rowH*0.15, width, rowH*0.7, "#eeeeee")
+		} else {
+			x := labels
+			for _, p := range row.Parts {
+				part := width * math.Max(p.Value, 0) / total
+				c.rect(x, y+rowH*0.15, part, rowH*0.7, colorOr(p.Color, Gray))
+				x += part
+			}
+		}
+		c.text(labels+width+8, y+rowH*0.6, row.Note, 11, "start", "#222222")
+	}
+}
+
+func colorOr(c, fallback string) string {
+	if c == "" {
+		return fallback
+	}
+	return c
+}
@@ -0,0 +1,220 @@
+// Package chart draws the charts of the CLI's HTML reports: bars, stacked
+// share bars and lines. Every chart renders as SVG, for reports opened in
+// a browser, and as PNG, for mail clients that do not show SVG.
+//
+// The PNG has no text, since the standard library has no fonts; the report
+// puts the numbers next to the image, which also serves readers whose
+// mail client blocks images.
+package chart
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Chart is a chart that can be drawn.
+type Chart interface {
+	// Size is the size in pixels the report should show the chart at.
+	Size() (width, height int)
+	SVG() []byte
+	PNG() ([]byte, error)
+}
+
+// Frame is common to all charts: the title drawn at the top and the size
+// in pixels, 640 by 240 when left zero.
+type Frame struct {
+	Title  string
+	Width  int
+	Height int
+}
+
+func (f Frame) Size() (int, int) {
+	w, h := f.Width, f.Height
+	if w <= 0 {
+		w = 640
+	}
+	if h <= 0 {
+		h = 240
+	}
+	return w, h
+}
+
+// Colors commonly used by the reports, one per severity.
+const (
+	Critical = "#c0392b"
+	High     = "#e67e22"
+	Medium   = "#f1c40f"
+	Low      = "#3498db"
+	Good     = "#27ae60"
+	Gray     = "#999999"
+)
+
+// pngScale renders PNGs at twice their size so they stay sharp on high
+// density screens.
+const pngScale = 2
+
+// canvas is what charts draw on. Coordinates are in pixels of the chart's
+// size, from the top left.
+type canvas interface {
+	rect(x, y, w, h float64, fill string)
+	line(points []point, stroke string, width float64, dashed bool)
+	dot(x, y, r float64, fill, title string)
+	text(x, y float64, s string, size float64, anchor, fill string)
+}
+
+type point struct{ x, y float64 }
+
+// render draws a chart's frame and calls draw for the rest.
+func render(c canvas, f Frame, draw func(c canvas, w, h float64)) {
+	w, h := f.Size()
+	c.rect(0, 0, float64(w), float64(h), "#ffffff")
+	if f.Title != "" {
+		c.text(8, 17, f.Title, 13, "start", "#222222")
+	}
+	draw(c, float64(w), float64(h))
+}
+
+func renderSVG(f Frame, draw func(c canvas, w, h float64)) []byte {
+	w, h := f.Size()
+	c := &svgCanvas{}
+	fmt.Fprintf(&c.b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" role="img" aria-label="%s" font-family="sans-serif">`,
+		w, h, w, h, html.EscapeString(f.Title))
+	render(c, f, draw)
+	c.b.WriteString(`</svg>`)
+	return c.b.Bytes()
+}
+
+func renderPNG(f Frame, draw func(c canvas, w, h float64)) ([]byte, error) {
+	w, h := f.Size()
+	c := &pngCanvas{img: image.NewRGBA(image.Rect(0, 0, w*pngScale, h*pngScale))}
+	render(c, f, draw)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, c.img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// legendItem is one entry of a legend.
+type legendItem struct{ name, color string }
+
+// legend draws the items right-aligned on the title line.
+func legend(c canvas, w float64, items []legendItem) {
+	x := w - 8
+	for i := len(items) - 1; i >= 0; i-- {
+		it := items[i]
+		c.text(x, 17, it.name, 11, "end", "#444444")
+		// Roughly the width of the text at 11px.
+		x -= 6*float64(len(it.name)) + 14
+		c.rect(x, 8, 10, 10, it.color)
+		x -= 8
+	}
+}
+
+// formatValue writes a value without needless decimals.
+func formatValue(v float64, unit string) string {
+	return strconv.FormatFloat(math.Round(v*10)/10, 'f', -1, 64) + unit
+}
+
+type svgCanvas struct {
+	b bytes.Buffer
+}
+
+func (c *svgCanvas) rect(x, y, w, h float64, fill string) {
+	fmt.Fprintf(&c.b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"/>`, x, y, w, h, fill)
+}
+
+func (c *svgCanvas) line(points []point, stroke string, width float64, dashed bool) {
+	coords := make([]string, len(points))
+	for i, p := range points {
+		coords[i] = fmt.Sprintf("%.1f,%.1f", p.x, p.y)
+	}
+	dash := ""
+	if dashed {
+		dash = ` stroke-dasharray="6 4"`
+	}
+	fmt.Fprintf(&c.b, `<polyline fill="none" stroke="%s" stroke-width="%.1f"%s points="%s"/>`, stroke, width, dash, strings.Join(coords, " "))
+}
+
+func (c *svgCanvas) dot(x, y, r float64, fill, title string) {
+	if title == "" {
+		fmt.Fprintf(&c.b, `<circle cx="%.1f" cy="%.1f" r="%.1f" fill="%s"/>`, x, y, r, fill)
+		return
+	}
+	fmt.Fprintf(&c.b, `<circle cx="%.1f" cy="%.1f" r="%.1f" fill="%s"><title>%s</title></circle>`, x, y, r, fill, html.EscapeString(title))
+}
+
+func (c *svgCanvas) text(x, y float64, s string, size float64, anchor, fill string) {
+	fmt.Fprintf(&c.b, `<text x="%.1f" y="%.1f" font-size="%.0f" text-anchor="%s" fill="%s">%s</text>`, x, y, size, anchor, fill, html.EscapeString(s))
+}
+
+// pngCanvas rasterizes without anti-aliasing, at pngScale.
+type pngCanvas struct {
+	img *image.RGBA
+}
+
+func (c *pngCanvas) rect(x, y, w, h float64, fill string) {
+	col := parseColor(fill)
+	x0, y0 := int(math.Round(x*pngScale)), int(math.Round(y*pngScale))
+	x1, y1 := int(math.Round((x+w)*pngScale)), int(math.Round((y+h)*pngScale))
+	for py := y0; py < y1; py++ {
+		for px := x0; px < x1; px++ {
+			c.img.SetRGBA(px, py, col)
+		}
+	}
+}
+
+func (c *pngCanvas) line(points []point, stroke string, width float64, dashed bool) {
+	col := parseColor(stroke)
+	r := width * pngScale / 2
+	travelled := 0.0
+	for i := 1; i < len(points); i++ {
+		a, b := points[i-1], points[i]
+		length := math.Hypot(b.x-a.x, b.y-a.y)
+		for d := 0.0; d <= length; d += 0.25 {
+			// The same 6 on, 4 off pattern as the SVG.
+			if dashed && math.Mod(travelled+d, 10) >= 6 {
+				continue
+			}
+			t := 0.0
+			if length > 0 {
+				t = d / length
+			}
+			c.disc((a.x+(b.x-a.x)*t)*pngScale, (a.y+(b.y-a.y)*t)*pngScale, r, col)
+		}
+		travelled += length
+	}
+}
+
+func (c *pngCanvas) dot(x, y, r float64, fill, _ string) {
+	c.disc(x*pngScale, y*pngScale, r*pngScale, parseColor(fill))
+}
+
+func (c *pngCanvas) text(float64, float64, string, float64, string, string) {}
+
+func (c *pngCanvas) disc(cx, cy, r float64, col color.RGBA) {
+	r = math.Max(r, 0.5)
+	for py := int(cy - r); py <= int(cy+r); py++ {
+		for px := int(cx - r); px <= int(cx+r); px++ {
+			if dx, dy := float64(px)+0.5-cx, float64(py)+0.5-cy; dx*dx+dy*dy <= r*r {
+				c.img.SetRGBA(px, py, col)
+			}
+		}
+	}
+}
+
+// parseColor reads #rrggbb; anything else is black.
+func parseColor(s string) color.RGBA {
+	v, err := strconv.ParseUint(strings.TrimPrefix(s, "#"), 16, 32)
+	if err != nil || len(s) != 7 {
+		return color.RGBA{A: 255}
+	}
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 255}
+}
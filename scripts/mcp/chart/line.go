@@ -0,0 +1,83 @@
+package chart
+
+import "math"
+
+// Point is a point of a line. X is any increasing measure, such as Unix
+// seconds; Title is shown on hover in SVG.
+type Point struct {
+	X, Y  float64
+	Title string
+}
+
+// Series is one line of a LineChart.
+type Series struct {
+	Name   string
+	Color  string
+	Points []Point
+	Dashed bool
+	// Markers draws a dot on every point.
+	Markers bool
+}
+
+// LineChart draws series over a shared X axis, with Y from zero. Named
+// series make the legend.
+type LineChart struct {
+	Frame
+	Series []Series
+	// YMax is the top of the scale; zero scales to the highest point.
+	YMax float64
+	// StartLabel and EndLabel are written under the ends of the X axis.
+	StartLabel, EndLabel string
+}
+
+func (l *LineChart) SVG() []byte { return renderSVG(l.Frame, l.draw) }
+
+func (l *LineChart) PNG() ([]byte, error) { return renderPNG(l.Frame, l.draw) }
+
+func (l *LineChart) draw(c canvas, w, h float64) {
+	const top, left, right, below = 32.0, 40.0, 16.0, 24.0
+	bottom := h - below
+	xmin, xmax := math.Inf(1), math.Inf(-1)
+	ymax := l.YMax
+	var items []legendItem
+	for _, s := range l.Series {
+		for _, p := range s.Points {
+			xmin, xmax = math.Min(xmin, p.X), math.Max(xmax, p.X)
+			ymax = math.Max(ymax, p.Y)
+		}
+		if s.Name != "" {
+			items = append(items, legendItem{s.Name, colorOr(s.Color, Gray)})
+		}
+	}
+	if ymax <= 0 {
+		ymax = 1
+	}
+	if xmax <= xmin {
+		xmin, xmax = xmin-1, xmin+1
+	}
+	x := func(v float64) float64 { return left + (w-left-right)*(v-xmin)/(xmax-xmin) }
+	y := func(v float64) float64 { return bottom - (bottom-top)*v/ymax }
+
+	legend(c, w, items)
+	c.line([]point{{left, top}, {left, bottom}, {w - right, bottom}}, Gray, 1, false)
+	c.text(left-4, top+4, formatValue(ymax, ""), 11, "end", "#444444")
+	c.text(left-4, bottom+4, "0", 11, "end", "#444444")
+	c.text(left, bottom+16, l.StartLabel, 11, "start", "#444444")
+	c.text(w-right, bottom+16, l.EndLabel, 11, "end", "#444444")
+	for _, s := range l.Series {
+		if len(s.Points) == 0 {
+			continue
+		}
+		points := make([]point, len(s.Points))
+		for i, p := range s.Points {
+			points[i] = point{x(p.X), y(p.Y)}
+		}
+		color := colorOr(s.Color, Gray)
+		c.line(points, color, 2, s.Dashed)
+		if s.Markers || len(points) == 1 {
+			for i, p := range points {
+				c.dot(p.x, p.y, 3, color, s.Points[i].Title)
+			}
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Table output highlights severities, overdue findings and failed checks.
+// Color is used when the stream is a terminal, NO_COLOR is unset and TERM
+// is not "dumb"; the global --color flag overrides the detection.
+
+// ANSI styles.
+const (
+	styleCritical = "1;31"     // bold red
+	styleHigh     = "38;5;208" // orange
+	styleMedium   = "33"       // yellow
+	styleLow      = "36"       // cyan
+	styleFail     = "1;31"
+	styleOK       = "32"
+)
+
+var stdoutColor, stderrColor bool
+
+// setColorMode applies the --color value: auto, always or never.
+func setColorMode(mode string) error {
+	switch mode {
+	case "auto":
+		stdoutColor = colorTerminal(os.Stdout)
+		stderrColor = colorTerminal(os.Stderr)
+	case "always":
+		stdoutColor, stderrColor = true, true
+	case "never":
+		stdoutColor, stderrColor = false, false
+	default:
+		return fmt.Errorf("--color must be auto, always or never")
+	}
+	return nil
+}
+
+func colorTerminal(f *os.File) bool {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0 && enableVirtualTerminal(f)
+}
+
+// paint styles s for stdout. Pad s before painting it, because the escape
+// sequences would count towards printf field widths.
+func paint(style, s string) string {
+	if !stdoutColor || style == "" {
+		return s
+	}
+	return "\x1b[" + style + "m" + s + "\x1b[0m"
+}
+
+// paintErr styles s for stderr.
+func paintErr(style, s string) string {
+	if !stderrColor || style == "" {
+		return s
+	}
+	return "\x1b[" + style + "m" + s + "\x1b[0m"
+}
+
+func severityStyle(severity string) string {
+	switch strings.ToUpper(severity) {
+	case "CRITICAL":
+		return styleCritical
+	case "HIGH":
+		return styleHigh
+	case "MEDIUM":
+		return styleMedium
+	case "LOW":
+		return styleLow
+	}
+	return ""
+}
+
+// severityCell pads a severity to width and colors it.
+func severityCell(severity string, width int) string {
+	return paint(severityStyle(severity), fmt.Sprintf("%-*s", width, severity))
+}
+
+// overdueDays is the age after which a finding counts as overdue. The
+// server's default is 30 days; SECMAN_OVERDUE_DAYS matches a changed
+// server setting.
+func overdueDays() int {
+	if n, err := strconv.Atoi(setting("SECMAN_OVERDUE_DAYS")); err == nil && n > 0 {
+		return n
+	}
+	return 30
+}
+
+// parseDays reads the leading number of a "58 days" style value.
+func parseDays(s string) (int, bool) {
+	s = strings.TrimSpace(s)
+	end := 0
+	for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+		end++
+	}
+	n, err := strconv.Atoi(s[:end])
+	return n, err == nil
+}
+
+// isOverdue reports whether a record is past its SLA: the server's
+// overdueStatus when present, otherwise its daysOpen against overdueDays.
+func isOverdue(record map[string]interface{}) bool {
+	if status := stringField(record, "overdueStatus"); status != "" {
+		return strings.EqualFold(status, "OVERDUE")
+	}
+	days, ok := parseDays(stringField(record, "daysOpen"))
+	return ok && days >= overdueDays()
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/schmalle/secman/scripts/mcp/config"
+)
+
+// Shell completion works the way kubectl's does: the script a shell loads
+// is a thin wrapper that runs
+//
+//	secman __complete <index> <words>...
+//
+// with the words typed after the binary's name and the index of the one
+// under the cursor (an index past the last word completes an empty word,
+// since not every shell can pass an empty argument). The client prints one
+// candidate per line. The commands, their subcommands and flags come from
+// the help text, so they cannot drift from it, and the tool names after
+// call and describe from the server when an API key is set. When nothing
+// matches, the shells fall back to file names.
+
+// completionShells are the shells completion scripts are written for.
+var completionShells = []string{"bash", "zsh", "fish", "powershell"}
+
+func cmdCompletion(osArgs []string) {
+	if len(osArgs) > 0 && osArgs[0] == "install" {
+		cmdCompletionInstall(osArgs[1:])
+		return
+	}
+	if len(osArgs) != 1 || !containsFold(completionShells, osArgs[0]) {
+		fmt.Fprintf(os.Stderr, "Usage: %s completion %s | install [--shell <shell>]\n", progName(), strings.Join(completionShells, "|"))
+		exit(ExitUsage)
+	}
+	fmt.Print(completionScript(strings.ToLower(osArgs[0]), binaryName()))
+}
+
+// completionScript returns the script that registers completion of name
+// in shell.
+func completionScript(shell, name string) string {
+	fn := "_" + regexp.MustCompile(`[^A-Za-z0-9_]`).ReplaceAllString(name, "_")
+	var script string
+	switch shell {
+	case "bash":
+		script = `# bash completion for NAME; load with: source <(NAME completion bash)
+FN() {
+	local IFS=$'\n'
+	COMPREPLY=($(NAME __complete $((COMP_CWORD - 1)) "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null))
+}
+complete -o default -F FN NAME
+`
+	case "zsh":
+		script = `#compdef NAME
+# zsh completion for NAME; load with: source <(NAME completion zsh)
+FN() {
+	local -a candidates
+	candidates=("${(@f)$(NAME __complete $((CURRENT - 2)) "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+	if [[ -n ${candidates[1]} ]]; then
+		compadd -a candidates
+	else
+		_files
+	fi
+}
+if [[ $funcstack[1] == FN ]]; then
+	FN "$@"
+else
+	compdef FN NAME
+fi
+`
+	case "fish":
+		script = `# fish completion for NAME; load with: NAME completion fish | source
+function FN
+	set -l words (commandline -opc)[2..-1]
+	NAME __complete (count $words) $words (commandline -ct) 2>/dev/null
+end
+complete -c NAME -a '(FN)'
+`
+	case "powershell":
+		script = `# PowerShell completion for NAME; load with: NAME completion powershell | Out-String | Invoke-Expression
+Register-ArgumentCompleter -Native -CommandName 'NAME' -ScriptBlock {
+	param($wordToComplete, $commandAst, $cursorPosition)
+	$words = @($commandAst.CommandElements | Select-Object -Skip 1 |
+		Where-Object { $_.Extent.StartOffset -lt $cursorPosition } | ForEach-Object { $_.ToString() })
+	$index = $words.Count
+	if ($wordToComplete -ne '') { $index-- }
+	& 'NAME' __complete $index @words 2>$null | ForEach-Object {
+		[System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+	}
+}
+`
+	}
+	return strings.ReplaceAll(strings.ReplaceAll(script, "FN", fn), "NAME", name)
+}
+
+// completionInstallPath is where a shell loads completion scripts from
+// without further setup, where it has such a place.
+func completionInstallPath(shell, name string) (string, error) {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if !filepath.IsAbs(dataHome) || !filepath.IsAbs(configHome) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		if !filepath.IsAbs(dataHome) {
+			dataHome = filepath.Join(home, ".local", "share")
+		}
+		if !filepath.IsAbs(configHome) {
+			configHome = filepath.Join(home, ".config")
+		}
+	}
+	switch shell {
+	case "bash":
+		return filepath.Join(dataHome, "bash-completion", "completions", name), nil
+	case "zsh":
+		return filepath.Join(dataHome, "zsh", "site-functions", "_"+name), nil
+	case "fish":
+		return filepath.Join(configHome, "fish", "completions", name+".fish"), nil
+	}
+	dir, err := config.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "completion.ps1"), nil
+}
+
+// detectShell names the user's shell from $SHELL, or PowerShell on Windows.
+func detectShell() string {
+	if sh := strings.TrimSuffix(filepath.Base(os.Getenv("SHELL")), ".exe"); containsFold(completionShells, sh) {
+		return sh
+	}
+	if runtime.GOOS == "windows" || os.Getenv("PSModulePath") != "" {
+		return "powershell"
+	}
+	return ""
+}
+
+func cmdCompletionInstall(osArgs []string) {
+	fs := flag.NewFlagSet("completion install", flag.ContinueOnError)
+	shell := fs.String("shell", detectShell(), "Shell to install completion for: "+strings.Join(completionShells, ", "))
+	output := fs.String("output", "", "Write the script to this file instead of the shell's completion directory")
+	parseFlags(fs, osArgs)
+
+	*shell = strings.ToLower(*shell)
+	if !containsFold(completionShells, *shell) {
+		fmt.Fprintf(os.Stderr, "Error: cannot tell the shell from $SHELL; use --shell %s\n", strings.Join(completionShells, "|"))
+		exit(ExitUsage)
+	}
+	name := binaryName()
+	path := *output
+	if path == "" {
+		var err error
+		if path, err = completionInstallPath(*shell, name); err != nil {
+			fatal(err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(completionScript(*shell, name)), 0o644); err != nil {
+		fatal(err)
+	}
+	fmt.Printf("Installed %s completion for %s in %s\n", *shell, name, path)
+	switch {
+	case *output != "":
+	case *shell == "bash":
+		fmt.Println("It is loaded by bash-completion in new shells.")
+	case *shell == "zsh":
+		fmt.Printf("Add this to ~/.zshrc before compinit, if the directory is not in fpath yet:\n  fpath=(%s $fpath)\n", filepath.Dir(path))
+	case *shell == "fish":
+		fmt.Println("It is loaded by fish in new shells.")
+	case *shell == "powershell":
+		fmt.Printf("Add this line to your PowerShell profile ($PROFILE):\n  . '%s'\n", path)
+	}
+}
+
+// usageEntry is one entry of a help text section: a command, flag or
+// variable and its description.
+type usageEntry struct {
+	term, text string
+}
+
+// usageSections splits the help text into its sections and their entries,
+// by section title without the colon ("Commands").
+func usageSections(text string) map[string][]usageEntry {
+	sections := map[string][]usageEntry{}
+	var title string
+	for _, line := range strings.Split(text, "\n") {
+		switch {
+		case line == "":
+		case !strings.HasPrefix(line, " "):
+			if strings.HasSuffix(line, ":") {
+				title, _, _ = strings.Cut(strings.TrimSuffix(line, ":"), " (")
+			}
+		case strings.HasPrefix(line, strings.Repeat(" ", 4)):
+			// A continuation of the entry above.
+			if n := len(sections[title]); n > 0 {
+				e := &sections[title][n-1]
+				e.text = strings.TrimSpace(e.text + " " + strings.TrimSpace(line))
+			}
+		default:
+			term, desc, _ := strings.Cut(strings.TrimSpace(line), "  ")
+			sections[title] = append(sections[title], usageEntry{term: term, text: strings.TrimSpace(desc)})
+		}
+	}
+	return sections
+}
+
+var (
+	subcommandRe = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+	longFlagRe   = regexp.MustCompile(`--[a-zA-Z][a-zA-Z0-9-]*`)
+)
+
+// completeWords returns the candidates for words[index], which has been
+// typed up to the cursor.
+func completeWords(global *flag.FlagSet, words []string, index int) []string {
+	if index < 0 {
+		return nil
+	}
+	var current string
+	if index < len(words) {
+		current = words[index]
+	}
+	// Skip the global flags and their values to find the command.
+	var command []string
+	for i := 0; i < index && i < len(words); i++ {
+		w := words[i]
+		if len(command) == 0 && strings.HasPrefix(w, "-") {
+			name := strings.TrimLeft(w, "-")
+			if f := global.Lookup(name); f != nil && !strings.Contains(name, "=") && !isBoolFlag(f) {
+				i++
+			}
+			continue
+		}
+		if !strings.HasPrefix(w, "-") {
+			command = append(command, w)
+		}
+	}
+
+	commands := usageSections(usageTemplate)["Commands"]
+	var options []string
+	switch {
+	case strings.HasPrefix(current, "-") && len(command) == 0:
+		global.VisitAll(func(f *flag.Flag) {
+			if len(f.Name) > 1 {
+				options = append(options, "--"+f.Name)
+			}
+		})
+	case strings.HasPrefix(current, "-"):
+		for _, e := range commands {
+			fields := strings.Fields(e.term)
+			if fields[0] != command[0] {
+				continue
+			}
+			if len(command) > 1 && len(fields) > 1 && subcommandRe.MatchString(fields[1]) && fields[1] != command[1] {
+				continue
+			}
+			options = append(options, longFlagRe.FindAllString(e.term+" "+e.text, -1)...)
+		}
+	case len(command) == 0:
+		options = append(options, "help")
+		options = append(options, commandNames...)
+	case len(command) == 1 && command[0] == "help":
+		options = commandNames
+	case command[0] == "call" && len(command) == 1, command[0] == "describe":
+		options = completionToolNames()
+	case len(command) == 1:
+		for _, e := range commands {
+			if fields := strings.Fields(e.term); len(fields) > 1 && fields[0] == command[0] && subcommandRe.MatchString(fields[1]) {
+				options = append(options, fields[1])
+			}
+		}
+	}
+
+	var candidates []string
+	seen := map[string]bool{}
+	for _, o := range options {
+		if strings.HasPrefix(o, current) && !seen[o] {
+			seen[o] = true
+			candidates = append(candidates, o)
+		}
+	}
+	sort.Strings(candidates)
+	return candidates
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// completionToolNames asks the server for the tools the user can call,
+// within the time a shell can wait for.
+func completionToolNames() []string {
+	apiKey := setting("SECMAN_MCP_KEY")
+	if apiKey == "" || settings.CheckKeyDestination() != nil {
+		return nil
+	}
+	var opts []ClientOption
+	strictOpt, err := strictTLSOption(setting("SECMAN_BASE_URL"), setting("SECMAN_TLS_PIN"))
+	if err != nil {
+		return nil
+	}
+	if strictOpt != nil {
+		opts = append(opts, strictOpt)
+	}
+	client := NewMcpClient(setting("SECMAN_BASE_URL"), apiKey, setting("SECMAN_USER_EMAIL"), opts...)
+	client.Tenant = setting("SECMAN_TENANT")
+	client.HTTP.Timeout = 5 * time.Second
+	return toolNames(client)
+}
+
+// cmdComplete answers the completion scripts; see the top of this file.
+func cmdComplete(global *flag.FlagSet, osArgs []string) {
+	if len(osArgs) == 0 {
+		exit(ExitUsage)
+	}
+	index, err := strconv.Atoi(osArgs[0])
+	if err != nil {
+		exit(ExitUsage)
+	}
+	for _, c := range completeWords(global, osArgs[1:], index) {
+		fmt.Println(c)
+	}
+}
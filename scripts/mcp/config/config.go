@@ -0,0 +1,467 @@
+// Package config resolves the client's settings from several layers. A
+// setting is taken from the first layer that defines it:
+//
+//  1. command-line flags
+//  2. the process environment
+//  3. a project .env or secman.env file
+//  4. a profile section of the user's config file
+//  5. built-in defaults
+//
+// Settings are named like the environment variables that set them
+// (SECMAN_BASE_URL, SECMAN_MCP_KEY, ...), whatever layer they come from.
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Layer names, as reported by Lookup.
+const (
+	SourceFlag    = "flag"
+	SourceEnv     = "environment"
+	SourceDotEnv  = "env file"
+	SourceProfile = "profile"
+	SourceDefault = "default"
+)
+
+// DotEnvNames are the project files searched for, in this order, in the
+// working directory and then its parents up to the root of the git
+// repository it is in. Outside a repository only the working directory is
+// searched.
+var DotEnvNames = []string{".env", "secman.env"}
+
+// Options select the files Load reads.
+type Options struct {
+	// EnvFile is an explicit .env file; when empty, the nearest
+	// .env/secman.env is used if there is one.
+	EnvFile string
+	// Profile names the profile section; when empty, SECMAN_PROFILE from
+	// the environment or env file is used, then "default".
+	Profile string
+	// Defaults are the values of the lowest layer.
+	Defaults map[string]string
+	// ResolveKeyring reads keyring:<name> references in the env file and
+	// the profile from the OS credential store. Without it, or when it
+	// fails, the setting is left unset and listed in Unresolved.
+	ResolveKeyring func(ref string) (string, error)
+}
+
+// KeyringPrefix starts a value kept in the OS credential store.
+const KeyringPrefix = "keyring:"
+
+// Config is the resolved set of layers.
+type Config struct {
+	flags    map[string]string
+	dotEnv   map[string]string
+	profile  map[string]string
+	defaults map[string]string
+
+	// EnvFile and ProfileFile are the files that were read, if any.
+	EnvFile string
+	// EnvFileFound is true when EnvFile was found by searching rather than
+	// named with Options.EnvFile.
+	EnvFileFound bool
+	ProfileFile  string
+	ProfileName  string
+	// Skipped lists env file keys whose value is an unresolved pass://
+	// reference; run the client under `pass-cli run --env-file` instead.
+	Skipped []string
+	// Unresolved holds the keyring: references that could not be read,
+	// with the reason.
+	Unresolved map[string]error
+
+	// fromKeyring marks the env file keys read from the credential store.
+	fromKeyring map[string]bool
+}
+
+// Load reads the env file and the profile.
+func Load(opts Options) (*Config, error) {
+	c := &Config{
+		flags:    map[string]string{},
+		dotEnv:   map[string]string{},
+		profile:  map[string]string{},
+		defaults: opts.Defaults,
+	}
+
+	envFile := opts.EnvFile
+	if envFile == "" {
+		envFile = findDotEnv()
+		c.EnvFileFound = envFile != ""
+	}
+	if envFile != "" {
+		values, skipped, err := readDotEnv(envFile)
+		if err != nil {
+			return nil, err
+		}
+		c.dotEnv, c.Skipped, c.EnvFile = values, skipped, envFile
+	}
+
+	name := opts.Profile
+	explicit := name != ""
+	if name == "" {
+		name, _, _ = c.lookupBelowFlags("SECMAN_PROFILE", false)
+		explicit = name != ""
+	}
+	if name == "" {
+		name = "default"
+	}
+	c.ProfileName = name
+
+	path := ProfilePath()
+	sections, err := readProfiles(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if section, ok := sections[name]; ok {
+		c.profile, c.ProfileFile = section, path
+	} else if explicit {
+		return nil, fmt.Errorf("profile %q not found in %s", name, path)
+	}
+	c.resolveKeyring(opts.ResolveKeyring)
+	return c, nil
+}
+
+// resolveKeyring replaces the keyring: references of the env file and the
+// profile by their secrets.
+func (c *Config) resolveKeyring(resolve func(string) (string, error)) {
+	c.fromKeyring = map[string]bool{}
+	for i, layer := range []map[string]string{c.dotEnv, c.profile} {
+		for key, value := range layer {
+			if !strings.HasPrefix(value, KeyringPrefix) {
+				continue
+			}
+			delete(layer, key)
+			if resolve == nil {
+				continue
+			}
+			if secret, err := resolve(value); err == nil {
+				layer[key] = secret
+				if i == 0 {
+					c.fromKeyring[key] = true
+				}
+			} else {
+				if c.Unresolved == nil {
+					c.Unresolved = map[string]error{}
+				}
+				c.Unresolved[key] = err
+			}
+		}
+	}
+}
+
+// serverSettings are the settings that say where the API key is sent.
+var serverSettings = []string{"SECMAN_BASE_URL", "SECMAN_INSTANCES"}
+
+// CheckKeyDestination refuses an env file that was found by searching and
+// points the API key at another server than the profile's, unless the key
+// is written in that file too. The file may come with a cloned repository,
+// and would otherwise send the user's own key, from the environment, the
+// profile or the credential store, wherever it names.
+func (c *Config) CheckKeyDestination() error {
+	if !c.EnvFileFound {
+		return nil
+	}
+	if _, source, ok := c.Lookup("SECMAN_MCP_KEY"); !ok ||
+		source == SourceDotEnv && !c.fromKeyring["SECMAN_MCP_KEY"] {
+		return nil
+	}
+	for _, key := range serverSettings {
+		value, source, _ := c.Lookup(key)
+		if source != SourceDotEnv {
+			continue
+		}
+		want := c.profile[key]
+		if want == "" {
+			want = c.defaults[key]
+		}
+		if value != want {
+			return fmt.Errorf("%s sets %s to %s, not the server of profile %s, and the API key does not come from that file; name the file with --env-file if it is trusted", c.EnvFile, key, value, c.ProfileName)
+		}
+	}
+	return nil
+}
+
+// SetFlag records a value given on the command line.
+func (c *Config) SetFlag(key, value string) {
+	c.flags[key] = value
+}
+
+// Get returns the value of a setting, or "" when no layer defines it.
+func (c *Config) Get(key string) string {
+	v, _, _ := c.Lookup(key)
+	return v
+}
+
+// GetDefault returns the value of a setting, or def when no layer defines it.
+func (c *Config) GetDefault(key, def string) string {
+	if v, _, ok := c.Lookup(key); ok {
+		return v
+	}
+	return def
+}
+
+// Lookup returns a setting's value and the layer it came from. Empty
+// values count as unset, as they always have for these variables.
+func (c *Config) Lookup(key string) (value, source string, ok bool) {
+	if v := c.flags[key]; v != "" {
+		return v, SourceFlag, true
+	}
+	return c.lookupBelowFlags(key, true)
+}
+
+func (c *Config) lookupBelowFlags(key string, withProfile bool) (string, string, bool) {
+	if v := os.Getenv(key); v != "" {
+		return v, SourceEnv, true
+	}
+	if v := c.dotEnv[key]; v != "" {
+		return v, SourceDotEnv, true
+	}
+	if withProfile {
+		if v := c.profile[key]; v != "" {
+			return v, SourceProfile, true
+		}
+		if v := c.defaults[key]; v != "" {
+			return v, SourceDefault, true
+		}
+	}
+	return "", "", false
+}
+
+// GetTrusted returns the value of a setting like Get, but passes over an
+// env file that was found by searching rather than named. It is for the
+// settings a file that came with a cloned repository must not choose, such
+// as where the client installs its updates from.
+func (c *Config) GetTrusted(key string) string {
+	if v := c.flags[key]; v != "" {
+		return v
+	}
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	if v := c.dotEnv[key]; v != "" && !c.EnvFileFound {
+		return v
+	}
+	if v := c.profile[key]; v != "" {
+		return v
+	}
+	return c.defaults[key]
+}
+
+// Keys returns the SECMAN_ settings defined by any layer, sorted.
+func (c *Config) Keys() []string {
+	seen := map[string]bool{}
+	for _, m := range []map[string]string{c.flags, c.dotEnv, c.profile, c.defaults} {
+		for k := range m {
+			if strings.HasPrefix(k, "SECMAN_") {
+				seen[k] = true
+			}
+		}
+	}
+	for _, kv := range os.Environ() {
+		if k, _, ok := strings.Cut(kv, "="); ok && strings.HasPrefix(k, "SECMAN_") {
+			seen[k] = true
+		}
+	}
+	keys := make([]string, 0, len(seen))
+	for k := range seen {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ProfilePath is the user's config file: $SECMAN_CONFIG, or config in Dir.
+func ProfilePath() string {
+	if p := os.Getenv("SECMAN_CONFIG"); p != "" {
+		return p
+	}
+	dir, err := Dir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "config")
+}
+
+// Dir is the directory of the config file and the files kept next to it:
+// secman in $XDG_CONFIG_HOME when that is set, on every OS, and otherwise
+// in the OS config directory (~/.config on Linux, ~/Library/Application
+// Support on macOS, %AppData% on Windows).
+func Dir() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); filepath.IsAbs(dir) {
+		return filepath.Join(dir, "secman"), nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "secman"), nil
+}
+
+// StateDir is the directory for logs and history: secman in
+// $XDG_STATE_HOME (default ~/.local/state) on Linux and the BSDs, in
+// %LocalAppData% on Windows, where it does not roam with the profile, and
+// Dir elsewhere unless XDG_STATE_HOME is set.
+func StateDir() (string, error) {
+	if dir := os.Getenv("XDG_STATE_HOME"); filepath.IsAbs(dir) {
+		return filepath.Join(dir, "secman"), nil
+	}
+	switch runtime.GOOS {
+	case "windows":
+		// UserCacheDir is %LocalAppData% on Windows.
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(dir, "secman"), nil
+	case "darwin", "ios", "plan9":
+		return Dir()
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "state", "secman"), nil
+}
+
+// bom is the byte order mark Notepad and Excel put at the start of UTF-8
+// files on Windows.
+const bom = "\ufeff"
+
+// findDotEnv returns the nearest .env/secman.env in the working directory
+// or one of its parents within the same git repository.
+func findDotEnv() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	stop := gitRoot(dir)
+	if stop == "" {
+		stop = dir
+	}
+	for {
+		for _, name := range DotEnvNames {
+			path := filepath.Join(dir, name)
+			if info, err := os.Stat(path); err == nil && !info.IsDir() {
+				return path
+			}
+		}
+		parent := filepath.Dir(dir)
+		if dir == stop || parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// gitRoot returns the nearest directory from dir up that holds .git (a
+// directory, or a file in worktrees and submodules), or "".
+func gitRoot(dir string) string {
+	for {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// readDotEnv parses KEY=VALUE lines. Blank lines and # comments are
+// ignored, an "export " prefix is allowed and values may be quoted.
+// pass:// references are left out and returned as skipped.
+func readDotEnv(path string) (map[string]string, []string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	values := map[string]string{}
+	var skipped []string
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), bom))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, nil, fmt.Errorf("%s:%d: expected KEY=VALUE", path, n)
+		}
+		key = strings.TrimSpace(key)
+		value = unquote(strings.TrimSpace(value))
+		if strings.HasPrefix(value, "pass://") {
+			skipped = append(skipped, key)
+			continue
+		}
+		values[key] = value
+	}
+	return values, skipped, scanner.Err()
+}
+
+// readProfiles parses an INI-style file of [name] sections holding
+// key = value lines. Keys may be written as the variable name
+// (SECMAN_BASE_URL) or short and lower-case (base_url).
+func readProfiles(path string) (map[string]map[string]string, error) {
+	if path == "" {
+		return nil, os.ErrNotExist
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sections := map[string]map[string]string{}
+	var current map[string]string
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), bom))
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+			continue
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			if sections[name] == nil {
+				sections[name] = map[string]string{}
+			}
+			current = sections[name]
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || current == nil {
+			return nil, fmt.Errorf("%s:%d: expected [profile] or key = value", path, n)
+		}
+		current[settingName(strings.TrimSpace(key))] = unquote(strings.TrimSpace(value))
+	}
+	return sections, scanner.Err()
+}
+
+// settingName maps a profile key to its variable name: base_url becomes
+// SECMAN_BASE_URL.
+func settingName(key string) string {
+	key = strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+	if !strings.HasPrefix(key, "SECMAN_") {
+		key = "SECMAN_" + key
+	}
+	return key
+}
+
+func unquote(v string) string {
+	if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+		return v[1 : len(v)-1]
+	}
+	if i := strings.Index(v, " #"); i >= 0 {
+		return strings.TrimSpace(v[:i])
+	}
+	return v
+}
@@ -0,0 +1,191 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestDirFollowsXDGConfigHome(t *testing.T) {
+	base := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", base)
+	dir, err := Dir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(base, "secman"); dir != want {
+		t.Errorf("Dir() = %s, want %s", dir, want)
+	}
+}
+
+func TestDirAndStateDirPerOS(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("XDG_STATE_HOME", "")
+	t.Setenv("HOME", home)
+
+	var wantDir, wantState string
+	switch runtime.GOOS {
+	case "windows":
+		// Settings roam with the profile; logs and history stay local.
+		roaming, local := filepath.Join(home, "Roaming"), filepath.Join(home, "Local")
+		t.Setenv("AppData", roaming)
+		t.Setenv("LocalAppData", local)
+		wantDir, wantState = filepath.Join(roaming, "secman"), filepath.Join(local, "secman")
+	case "darwin":
+		wantDir = filepath.Join(home, "Library", "Application Support", "secman")
+		wantState = wantDir
+	case "linux", "freebsd", "openbsd", "netbsd", "dragonfly":
+		wantDir = filepath.Join(home, ".config", "secman")
+		wantState = filepath.Join(home, ".local", "state", "secman")
+	default:
+		t.Skipf("no expected directories for %s", runtime.GOOS)
+	}
+
+	dir, err := Dir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dir != wantDir {
+		t.Errorf("Dir() = %s, want %s", dir, wantDir)
+	}
+	state, err := StateDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != wantState {
+		t.Errorf("StateDir() = %s, want %s", state, wantState)
+	}
+
+	t.Setenv("XDG_STATE_HOME", filepath.Join(home, "state"))
+	state, err = StateDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(home, "state", "secman"); state != want {
+		t.Errorf("StateDir() with XDG_STATE_HOME = %s, want %s", state, want)
+	}
+}
+
+func TestReadDotEnvWindowsLineEnds(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	data := bom + "# written by Notepad\r\nSECMAN_BASE_URL=https://secman.example\r\nexport SECMAN_TENANT=\"acme\"\r\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	values, _, err := readDotEnv(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := values["SECMAN_BASE_URL"]; got != "https://secman.example" {
+		t.Errorf("SECMAN_BASE_URL = %q, want https://secman.example", got)
+	}
+	if got := values["SECMAN_TENANT"]; got != "acme" {
+		t.Errorf("SECMAN_TENANT = %q, want acme", got)
+	}
+}
+
+// chdir changes the working directory for the rest of the test.
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	prev, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(prev) })
+}
+
+func TestFindDotEnvStopsAtGitRoot(t *testing.T) {
+	root := t.TempDir()
+	repo := filepath.Join(root, "repo")
+	sub := filepath.Join(repo, "sub")
+	if err := os.MkdirAll(filepath.Join(repo, ".git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, ".env"), []byte("SECMAN_BASE_URL=https://outside.example\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	chdir(t, sub)
+	if got := findDotEnv(); got != "" {
+		t.Errorf("findDotEnv() = %s, want none: the .env is outside the repository", got)
+	}
+
+	if err := os.WriteFile(filepath.Join(repo, "secman.env"), []byte("SECMAN_TENANT=acme\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := filepath.EvalSymlinks(findDotEnv())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := filepath.EvalSymlinks(filepath.Join(repo, "secman.env"))
+	if got != want {
+		t.Errorf("findDotEnv() = %s, want %s", got, want)
+	}
+}
+
+func TestCheckKeyDestination(t *testing.T) {
+	t.Setenv("SECMAN_BASE_URL", "")
+	t.Setenv("SECMAN_MCP_KEY", "")
+	profile := map[string]string{"SECMAN_BASE_URL": "https://secman.example", "SECMAN_MCP_KEY": "from-profile"}
+	tests := []struct {
+		name    string
+		dotEnv  map[string]string
+		keyring bool
+		found   bool
+		wantErr bool
+	}{
+		{"other server, profile key", map[string]string{"SECMAN_BASE_URL": "https://evil.example"}, false, true, true},
+		{"other instances, profile key", map[string]string{"SECMAN_INSTANCES": "eu=https://evil.example"}, false, true, true},
+		{"other server, keyring key in the file", map[string]string{"SECMAN_BASE_URL": "https://evil.example", "SECMAN_MCP_KEY": "secret"}, true, true, true},
+		{"other server, key in the file", map[string]string{"SECMAN_BASE_URL": "https://staging.example", "SECMAN_MCP_KEY": "secret"}, false, true, false},
+		{"profile's server", map[string]string{"SECMAN_BASE_URL": "https://secman.example"}, false, true, false},
+		{"named with --env-file", map[string]string{"SECMAN_BASE_URL": "https://staging.example"}, false, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Config{
+				flags:        map[string]string{},
+				dotEnv:       tt.dotEnv,
+				profile:      profile,
+				EnvFile:      ".env",
+				EnvFileFound: tt.found,
+				fromKeyring:  map[string]bool{"SECMAN_MCP_KEY": tt.keyring},
+			}
+			if err := c.CheckKeyDestination(); (err != nil) != tt.wantErr {
+				t.Errorf("CheckKeyDestination() = %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetTrustedSkipsFoundEnvFile(t *testing.T) {
+	t.Setenv("SECMAN_UPDATE_REPO", "")
+	c := &Config{
+		flags:        map[string]string{},
+		dotEnv:       map[string]string{"SECMAN_UPDATE_REPO": "evil/releases"},
+		profile:      map[string]string{},
+		EnvFileFound: true,
+	}
+	if got := c.GetTrusted("SECMAN_UPDATE_REPO"); got != "" {
+		t.Errorf("GetTrusted from a found env file = %q, want it ignored", got)
+	}
+	if got := c.Get("SECMAN_UPDATE_REPO"); got != "evil/releases" {
+		t.Errorf("Get = %q, want the env file's value", got)
+	}
+
+	c.EnvFileFound = false
+	if got := c.GetTrusted("SECMAN_UPDATE_REPO"); got != "evil/releases" {
+		t.Errorf("GetTrusted from a named env file = %q, want evil/releases", got)
+	}
+	t.Setenv("SECMAN_UPDATE_REPO", "acme/secman")
+	if got := c.GetTrusted("SECMAN_UPDATE_REPO"); got != "acme/secman" {
+		t.Errorf("GetTrusted = %q, want the environment's acme/secman", got)
+	}
+}
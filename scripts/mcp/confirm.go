@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Destructive commands (delete, bulk update, restore) show a summary of
+// the affected records and ask before proceeding. In a non-interactive
+// session --yes is required; under --dry-run nothing is sent, so no
+// confirmation is needed.
+
+func addYesFlag(fs *flag.FlagSet) *bool {
+	yes := fs.Bool("yes", false, "Do not ask for confirmation (required in non-interactive sessions)")
+	fs.BoolVar(yes, "y", false, "Shorthand for --yes")
+	return yes
+}
+
+// isInteractive reports whether stdin is a terminal. /dev/null is a
+// character device too, so it is excluded explicitly.
+func isInteractive() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	if null, err := os.Stat(os.DevNull); err == nil && os.SameFile(info, null) {
+		return false
+	}
+	return true
+}
+
+// confirm prints the summary and asks the user to proceed. It returns an
+// error when the operation must not go ahead.
+func confirm(client *McpClient, yes bool, action string, summary []string) error {
+	if yes || client.dryRun {
+		return nil
+	}
+
+	fmt.Fprintf(os.Stderr, "About to %s:\n", action)
+	for _, line := range summary {
+		fmt.Fprintf(os.Stderr, "  %s\n", line)
+	}
+	if !isInteractive() {
+		return fmt.Errorf("refusing to %s without --yes in a non-interactive session", action)
+	}
+
+	fmt.Fprint(os.Stderr, "Proceed? [y/N] ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	}
+	return fmt.Errorf("aborted")
+}
+
+// countSummary renders "<n> <section>" lines in the given order, skipping
+// empty sections.
+func countSummary(order []string, counts map[string]int) []string {
+	var lines []string
+	for _, name := range order {
+		if n := counts[name]; n > 0 {
+			lines = append(lines, fmt.Sprintf("%-18s %d", name, n))
+		}
+	}
+	return lines
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// verify-contract checks that the server still honours what this client
+// relies on. Every advertised tool is called once with the smallest
+// arguments its schema allows (the required ones, with values made up as by
+// describe), and its result is checked against the shape the commands
+// decode: the list tools export csv streams must return their list and
+// totalPages, the dashboard statistics must decode into Stats, and every
+// other result must be structured JSON. The schemas themselves are checked
+// too, since a required property the schema does not declare cannot be
+// sent.
+//
+// Tools that change records are skipped unless --include-mutating is given,
+// as the made-up arguments would create or change real records. A tool
+// that answers with isError, such as "asset 42 not found", is reported but
+// only fails the run with --strict: made-up IDs rarely exist.
+
+const (
+	contractOK        = "ok"
+	contractFailed    = "failed"
+	contractToolError = "tool-error"
+	contractSkipped   = "skipped"
+)
+
+// contractShape is a field a tool's result must have, with its JSON kind.
+type contractShape struct {
+	field, kind string
+}
+
+// contractShapes are the results the commands decode by field.
+// exportDatasets adds its list tools.
+var contractShapes = map[string][]contractShape{}
+
+func init() {
+	for _, d := range exportDatasets {
+		contractShapes[d.tool] = []contractShape{{d.listKey, "array"}, {"totalPages", "number"}}
+	}
+}
+
+// contractCheck is the outcome for one tool.
+type contractCheck struct {
+	Tool       string                 `json:"tool"`
+	Status     string                 `json:"status"`
+	Arguments  map[string]interface{} `json:"arguments,omitempty"`
+	Problems   []string               `json:"problems,omitempty"`
+	DurationMs int64                  `json:"durationMs,omitempty"`
+}
+
+type contractReport struct {
+	URL    string          `json:"url"`
+	Server string          `json:"server,omitempty"`
+	Checks []contractCheck `json:"checks"`
+	Counts map[string]int  `json:"counts"`
+	Passed bool            `json:"passed"`
+}
+
+func cmdVerifyContract(client *McpClient, osArgs []string) {
+	fs := flag.NewFlagSet("verify-contract", flag.ContinueOnError)
+	var tools stringList
+	fs.Var(&tools, "tool", "Only check tools matching this name or pattern (repeatable)")
+	includeMutating := fs.Bool("include-mutating", false, "Also call tools that change records, with made-up arguments")
+	strict := fs.Bool("strict", false, "Fail on tools that answer with an error too")
+	asJSON := fs.Bool("json", false, "Print the report as JSON")
+	yes := addYesFlag(fs)
+	parseFlags(fs, osArgs)
+
+	caps, err := client.GetCapabilities()
+	if err != nil {
+		fatal(err)
+	}
+	defs := caps.Capabilities.Tools
+	sort.Slice(defs, func(i, j int) bool { return defs[i].Name < defs[j].Name })
+	var selected []ToolDefinition
+	var mutating []string
+	for _, def := range defs {
+		if len(tools) > 0 && !matchesAnyTool(tools, def.Name) {
+			continue
+		}
+		selected = append(selected, def)
+		if *includeMutating && isMutatingTool(def.Name) {
+			mutating = append(mutating, def.Name)
+		}
+	}
+	if len(selected) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: no advertised tool matches --tool")
+		exit(ExitNotFound)
+	}
+	if len(mutating) > 0 {
+		if err := confirm(client, *yes, "call tools that change records with made-up arguments", mutating); err != nil {
+			fatal(err)
+		}
+	}
+
+	report := &contractReport{URL: client.BaseURL, Server: serverVersion(caps), Counts: map[string]int{}}
+	progress := startProgress("Verifying tools", "tools", int64(len(selected)))
+	for _, def := range selected {
+		check := verifyTool(client, def, *includeMutating)
+		report.Checks = append(report.Checks, check)
+		report.Counts[check.Status]++
+		progress.Add(1)
+	}
+	progress.Finish()
+	report.Passed = report.Counts[contractFailed] == 0 && (!*strict || report.Counts[contractToolError] == 0)
+
+	if rawOutput(*asJSON) {
+		printResult(report)
+	} else {
+		printContractReport(report)
+	}
+	if !report.Passed {
+		exit(ExitGateFailed)
+	}
+}
+
+func matchesAnyTool(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if matchTool(p, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyTool checks one tool's schema, calls it and checks its result.
+func verifyTool(client *McpClient, def ToolDefinition, includeMutating bool) contractCheck {
+	check := contractCheck{Tool: def.Name}
+	if problems := schemaProblems(def); len(problems) > 0 {
+		check.Status, check.Problems = contractFailed, problems
+		return check
+	}
+	if isMutatingTool(def.Name) && !includeMutating {
+		check.Status, check.Problems = contractSkipped, []string{"changes records; use --include-mutating"}
+		return check
+	}
+	check.Arguments = contractArgs(def)
+	if problems, _ := validateArgs(def, check.Arguments); len(problems) > 0 {
+		check.Status = contractSkipped
+		check.Problems = append([]string{"no valid arguments could be made up"}, problems...)
+		return check
+	}
+
+	started := time.Now()
+	result, err := client.CallToolContext(context.Background(), def.Name, check.Arguments)
+	check.DurationMs = time.Since(started).Milliseconds()
+	switch {
+	case err != nil:
+		check.Status, check.Problems = contractFailed, []string{err.Error()}
+	case result.IsError:
+		check.Status, check.Problems = contractToolError, []string{truncate(contentText(result.Content), 200)}
+	default:
+		check.Problems = shapeProblems(def.Name, result.Content)
+		check.Status = contractOK
+		if len(check.Problems) > 0 {
+			check.Status = contractFailed
+		}
+	}
+	return check
+}
+
+// contractArgs returns the required arguments of a tool, and the smallest
+// page of a paginated one.
+func contractArgs(def ToolDefinition) map[string]interface{} {
+	names, props, required := schemaParams(def)
+	args := map[string]interface{}{}
+	for _, name := range names {
+		prop, _ := props[name].(map[string]interface{})
+		switch {
+		case required[name]:
+			args[name] = exampleValue(name, prop)
+		case name == "page":
+			args[name] = 0
+		case name == "pageSize" || name == "size" || name == "limit":
+			args[name] = 1
+		}
+	}
+	return args
+}
+
+// schemaProblems checks that an inputSchema can be followed: an object
+// schema whose required properties are declared.
+func schemaProblems(def ToolDefinition) []string {
+	if def.InputSchema == nil {
+		return nil
+	}
+	var problems []string
+	if typ, ok := def.InputSchema["type"].(string); ok && typ != "object" {
+		problems = append(problems, fmt.Sprintf("inputSchema type is %q, not object", typ))
+	}
+	if raw, ok := def.InputSchema["properties"]; ok {
+		if _, isMap := raw.(map[string]interface{}); !isMap {
+			problems = append(problems, "inputSchema properties is not an object")
+		}
+	}
+	_, props, required := schemaParams(def)
+	for name := range required {
+		if _, ok := props[name]; !ok {
+			problems = append(problems, fmt.Sprintf("required property %q is not declared", name))
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+// shapeProblems checks a result against the shape the commands expect.
+func shapeProblems(tool string, content interface{}) []string {
+	if tool == "get_dashboard_statistics" {
+		var stats Stats
+		if err := remarshal(content, &stats); err != nil {
+			return []string{"does not decode into the dashboard statistics: " + err.Error()}
+		}
+	}
+	shapes, known := contractShapes[tool]
+	if !known {
+		switch content.(type) {
+		case map[string]interface{}, []interface{}:
+			return nil
+		case nil:
+			return []string{"empty result"}
+		}
+		return []string{fmt.Sprintf("result is %s, not a JSON object or list", jsonKind(content))}
+	}
+	m, ok := content.(map[string]interface{})
+	if !ok {
+		return []string{fmt.Sprintf("result is %s, not an object", jsonKind(content))}
+	}
+	var problems []string
+	for _, s := range shapes {
+		v, present := m[s.field]
+		switch {
+		case !present:
+			problems = append(problems, fmt.Sprintf("field %q is missing", s.field))
+		case jsonKind(v) != s.kind:
+			problems = append(problems, fmt.Sprintf("field %q is %s, not %s", s.field, jsonKind(v), s.kind))
+		case s.kind == "array" && !isObjectList(v.([]interface{})) && len(v.([]interface{})) > 0:
+			problems = append(problems, fmt.Sprintf("field %q does not hold objects", s.field))
+		}
+	}
+	return problems
+}
+
+// jsonKind names the JSON type of a decoded value.
+func jsonKind(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case float64, int, int64:
+		return "number"
+	case bool:
+		return "boolean"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func printContractReport(report *contractReport) {
+	fmt.Printf("Server: %s", report.URL)
+	if report.Server != "" {
+		fmt.Printf(" (%s)", report.Server)
+	}
+	fmt.Println()
+	fmt.Println()
+	for _, c := range report.Checks {
+		status := c.Status
+		switch c.Status {
+		case contractOK:
+			status = paint(styleOK, status)
+		case contractFailed:
+			status = paint(styleFail, status)
+		case contractToolError:
+			status = paint(styleMedium, status)
+		}
+		// Pad before painting, so the escape codes do not skew the columns.
+		line := fmt.Sprintf("  %-40s %s%s", c.Tool, status, strings.Repeat(" ", 11-len(c.Status))+durationNote(c.DurationMs))
+		fmt.Println(strings.TrimRight(line, " "))
+		for _, p := range c.Problems {
+			fmt.Printf("      %s\n", p)
+		}
+	}
+	fmt.Printf("\n%d ok, %d failed, %d tool errors, %d skipped\n",
+		report.Counts[contractOK], report.Counts[contractFailed], report.Counts[contractToolError], report.Counts[contractSkipped])
+	if report.Passed {
+		fmt.Println(paint(styleOK, "Contract holds"))
+	} else {
+		fmt.Println(paint(styleFail, "Contract broken"))
+	}
+}
+
+func durationNote(ms int64) string {
+	if ms == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d ms", ms)
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/schmalle/secman/scripts/mcp/config"
+)
+
+// A control test is a periodic check that a requirement is met: a name,
+// how often it runs, who runs it and the results so far. control-test
+// schedule adds one to a requirement, record enters a result and moves the
+// due date on by the frequency, and list shows the calendar with overdue
+// and failed tests flagged.
+//
+// The server has no place for tests, so they are kept in
+// control-tests.json next to the config file, or in
+// SECMAN_CONTROL_TEST_FILE.
+
+// controlTestFrequencies are the named frequencies as months and days.
+var controlTestFrequencies = map[string]struct{ months, days int }{
+	"daily":      {0, 1},
+	"weekly":     {0, 7},
+	"monthly":    {1, 0},
+	"quarterly":  {3, 0},
+	"semiannual": {6, 0},
+	"annual":     {12, 0},
+}
+
+// controlTestResults are the values record takes.
+var controlTestResults = []string{"PASS", "FAIL", "N_A"}
+
+type controlTest struct {
+	ID            int64               `json:"id"`
+	RequirementID int64               `json:"requirementId"`
+	Shortreq      string              `json:"shortreq,omitempty"`
+	Name          string              `json:"name"`
+	Frequency     string              `json:"frequency"`
+	Owner         string              `json:"owner,omitempty"`
+	NextDue       string              `json:"nextDue"`
+	Results       []controlTestResult `json:"results,omitempty"`
+}
+
+type controlTestResult struct {
+	Date     string `json:"date"`
+	Result   string `json:"result"`
+	Tester   string `json:"tester,omitempty"`
+	Notes    string `json:"notes,omitempty"`
+	Evidence string `json:"evidence,omitempty"`
+}
+
+type controlTestFile struct {
+	BaseURL string         `json:"baseUrl,omitempty"`
+	Tests   []*controlTest `json:"tests"`
+}
+
+func controlTestPath() string {
+	if path := setting("SECMAN_CONTROL_TEST_FILE"); path != "" {
+		return path
+	}
+	dir, err := config.Dir()
+	if err != nil {
+		return "secman-control-tests.json"
+	}
+	return filepath.Join(dir, "control-tests.json")
+}
+
+func loadControlTests() (*controlTestFile, error) {
+	f := &controlTestFile{}
+	data, err := readTextFile(controlTestPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, f); err != nil {
+		return nil, fmt.Errorf("%s: %w", controlTestPath(), err)
+	}
+	return f, nil
+}
+
+// saveControlTests writes the file through a temporary file.
+func saveControlTests(f *controlTestFile) error {
+	path := controlTestPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeStateFile(path, append(data, '\n'), 0o644)
+}
+
+func (f *controlTestFile) find(id int64) *controlTest {
+	for _, t := range f.Tests {
+		if t.ID == id {
+			return t
+		}
+	}
+	return nil
+}
+
+// advanceDue adds one period of frequency to a date: a named frequency or
+// a number of days such as 45d.
+func advanceDue(date time.Time, frequency string) (time.Time, error) {
+	if f, ok := controlTestFrequencies[strings.ToLower(frequency)]; ok {
+		return date.AddDate(0, f.months, f.days), nil
+	}
+	if days, err := strconv.Atoi(strings.TrimSuffix(frequency, "d")); err == nil && days > 0 && strings.HasSuffix(frequency, "d") {
+		return date.AddDate(0, 0, days), nil
+	}
+	names := make([]string, 0, len(controlTestFrequencies))
+	for name := range controlTestFrequencies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return time.Time{}, fmt.Errorf("frequency must be %s or a number of days such as 45d, not %q", strings.Join(names, ", "), frequency)
+}
+
+// parseDateFlag reads a YYYY-MM-DD flag, defaulting to today.
+func parseDateFlag(flagName, value string, now time.Time) time.Time {
+	if value == "" {
+		return now.UTC().Truncate(24 * time.Hour)
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --%s must be a date (YYYY-MM-DD), not %q\n", flagName, value)
+		exit(ExitUsage)
+	}
+	return t
+}
+
+func (t *controlTest) last() *controlTestResult {
+	if len(t.Results) == 0 {
+		return nil
+	}
+	return &t.Results[len(t.Results)-1]
+}
+
+// state is overdue, failed (the last result), due (within soon) or ok.
+func (t *controlTest) state(today time.Time, soon time.Time) string {
+	due, _ := time.Parse("2006-01-02", t.NextDue)
+	switch {
+	case due.Before(today):
+		return "overdue"
+	case t.last() != nil && t.last().Result == "FAIL":
+		return "failed"
+	case !due.After(soon):
+		return "due"
+	}
+	return "ok"
+}
+
+func cmdControlTest(client *McpClient, osArgs []string) {
+	if len(osArgs) < 1 {
+		fmt.Fprintln(os.Stderr, "Error: control-test subcommand required")
+		fmt.Fprintf(os.Stderr, "Usage: %s control-test <schedule|list|record> ...\n", progName())
+		exit(ExitUsage)
+	}
+	switch osArgs[0] {
+	case "schedule":
+		cmdControlTestSchedule(client, osArgs[1:])
+	case "list":
+		cmdControlTestList(osArgs[1:])
+	case "record":
+		cmdControlTestRecord(osArgs[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown control-test subcommand: %s\n", osArgs[0])
+		exit(ExitUsage)
+	}
+}
+
+func cmdControlTestSchedule(client *McpClient, osArgs []string) {
+	fs := flag.NewFlagSet("control-test schedule", flag.ContinueOnError)
+	name := fs.String("name", "", "Name of the test (default: the requirement's short text)")
+	frequency := fs.String("frequency", "", "How often the test runs: daily, weekly, monthly, quarterly, semiannual, annual or e.g. 45d (required)")
+	owner := fs.String("owner", "", "Who runs the test")
+	start := fs.String("start", "", "First due date, YYYY-MM-DD (default: today)")
+	args := parseInterspersed(fs, osArgs)
+
+	usage := "Usage: " + progName() + " control-test schedule <requirementId> --frequency quarterly [--owner who] [--name text] [--start YYYY-MM-DD]"
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Error: one requirement id required")
+		fmt.Fprintln(os.Stderr, usage)
+		exit(ExitUsage)
+	}
+	reqID, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid requirement id %q\n", args[0])
+		exit(ExitUsage)
+	}
+	if *frequency == "" {
+		fmt.Fprintln(os.Stderr, "Error: --frequency is required")
+		fmt.Fprintln(os.Stderr, usage)
+		exit(ExitUsage)
+	}
+	if _, err := advanceDue(time.Now(), *frequency); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --frequency: %v\n", err)
+		exit(ExitUsage)
+	}
+	due := parseDateFlag("start", *start, time.Now())
+
+	reqs, err := listRequirements(client, map[string]interface{}{})
+	if err != nil {
+		fatal(err)
+	}
+	shortreq, found := "", false
+	for _, r := range reqs {
+		if int64(numberField(r, "id")) == reqID {
+			shortreq, found = stringField(r, "shortreq"), true
+		}
+	}
+	if !found {
+		fmt.Fprintf(os.Stderr, "Error: requirement %d not found\n", reqID)
+		exit(ExitUsage)
+	}
+	if *name == "" {
+		*name = shortreq
+	}
+
+	f, err := loadControlTests()
+	if err != nil {
+		fatal(err)
+	}
+	// Scheduling a test again under the same name changes it; its results
+	// are kept.
+	var test *controlTest
+	var nextID int64 = 1
+	for _, t := range f.Tests {
+		if t.RequirementID == reqID && strings.EqualFold(t.Name, *name) {
+			test = t
+		}
+		if t.ID >= nextID {
+			nextID = t.ID + 1
+		}
+	}
+	if test == nil {
+		test = &controlTest{ID: nextID, RequirementID: reqID}
+		f.Tests = append(f.Tests, test)
+	}
+	test.Shortreq, test.Name, test.Frequency = shortreq, *name, strings.ToLower(*frequency)
+	if *owner != "" {
+		test.Owner = *owner
+	}
+	if *start != "" || test.NextDue == "" {
+		test.NextDue = due.Format("2006-01-02")
+	}
+	f.BaseURL = client.BaseURL
+	if err := saveControlTests(f); err != nil {
+		fatal(err)
+	}
+	status(test.ID, "Scheduled control test %d for requirement %d, %s, next due %s\n", test.ID, reqID, test.Frequency, test.NextDue)
+}
+
+// controlTestRow is a test as list shows it.
+type controlTestRow struct {
+	ID            int64  `json:"id"`
+	RequirementID int64  `json:"requirementId"`
+	Name          string `json:"name"`
+	Frequency     string `json:"frequency"`
+	Owner         string `json:"owner"`
+	LastTested    string `json:"lastTested,omitempty"`
+	LastResult    string `json:"lastResult,omitempty"`
+	NextDue       string `json:"nextDue"`
+	State         string `json:"state"`
+}
+
+func cmdControlTestList(osArgs []string) {
+	fs := flag.NewFlagSet("control-test list", flag.ContinueOnError)
+	overdue := fs.Bool("overdue", false, "Only list overdue and failed tests")
+	owner := fs.String("owner", "", "Only list tests of this owner")
+	requirement := fs.Int64("requirement", 0, "Only list tests of this requirement id")
+	dueWithin := fs.Int("due-within", 14, "Days ahead in which a test counts as due")
+	failOnOverdue := fs.Bool("fail-on-overdue", false, "Exit with 5 when a test is overdue or failed")
+	asJSON := fs.Bool("json", false, "Print the tests as JSON")
+	parseFlags(fs, osArgs)
+
+	f, err := loadControlTests()
+	if err != nil {
+		fatal(err)
+	}
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	soon := today.AddDate(0, 0, *dueWithin)
+	rows := []controlTestRow{}
+	flagged := 0
+	for _, t := range f.Tests {
+		if (*owner != "" && !strings.EqualFold(t.Owner, *owner)) || (*requirement != 0 && t.RequirementID != *requirement) {
+			continue
+		}
+		row := controlTestRow{ID: t.ID, RequirementID: t.RequirementID, Name: t.Name, Frequency: t.Frequency,
+			Owner: t.Owner, NextDue: t.NextDue, State: t.state(today, soon)}
+		if last := t.last(); last != nil {
+			row.LastTested, row.LastResult = last.Date, last.Result
+		}
+		if row.State == "overdue" || row.State == "failed" {
+			flagged++
+		} else if *overdue {
+			continue
+		}
+		rows = append(rows, row)
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].NextDue < rows[j].NextDue })
+
+	if rawOutput(*asJSON) {
+		printResult(rows)
+	} else if len(rows) == 0 {
+		fmt.Printf("No control tests in %s\n", controlTestPath())
+	} else {
+		fmt.Printf("%4s  %6s  %-36s %-10s %-16s %-10s %-6s %-10s %s\n", "ID", "REQ", "TEST", "FREQUENCY", "OWNER", "LAST", "RESULT", "NEXT DUE", "STATE")
+		for _, r := range rows {
+			style := ""
+			switch r.State {
+			case "overdue", "failed":
+				style = styleFail
+			case "due":
+				style = styleMedium
+			}
+			fmt.Printf("%4d  %6d  %-36s %-10s %-16s %-10s %-6s %-10s %s\n", r.ID, r.RequirementID, truncate(r.Name, 36),
+				r.Frequency, truncate(r.Owner, 16), r.LastTested, r.LastResult, r.NextDue, paint(style, r.State))
+		}
+		fmt.Printf("\n%d test(s), %d overdue or failed\n", len(rows), flagged)
+	}
+	if *failOnOverdue && flagged > 0 {
+		exit(ExitGateFailed)
+	}
+}
+
+func cmdControlTestRecord(osArgs []string) {
+	fs := flag.NewFlagSet("control-test record", flag.ContinueOnError)
+	result := fs.String("result", "", "Result: PASS, FAIL or N_A (required)")
+	tester := fs.String("tester", "", "Who ran the test (default: the test's owner)")
+	notes := fs.String("notes", "", "What was checked and found")
+	evidence := fs.String("evidence", "", "Where the evidence is, e.g. an evidence id, a ticket or a URL")
+	date := fs.String("date", "", "When the test ran, YYYY-MM-DD (default: today)")
+	args := parseInterspersed(fs, osArgs)
+
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Error: one control test id required")
+		fmt.Fprintf(os.Stderr, "Usage: %s control-test record <testId> --result PASS|FAIL|N_A [--notes text] [--evidence ref] [--date YYYY-MM-DD]\n", progName())
+		exit(ExitUsage)
+	}
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid control test id %q\n", args[0])
+		exit(ExitUsage)
+	}
+	*result = strings.ToUpper(strings.ReplaceAll(*result, "/", "_"))
+	if !containsFold(controlTestResults, *result) {
+		fmt.Fprintf(os.Stderr, "Error: --result must be one of %s\n", strings.Join(controlTestResults, ", "))
+		exit(ExitUsage)
+	}
+	ran := parseDateFlag("date", *date, time.Now())
+
+	f, err := loadControlTests()
+	if err != nil {
+		fatal(err)
+	}
+	test := f.find(id)
+	if test == nil {
+		fmt.Fprintf(os.Stderr, "Error: control test %d not found in %s\n", id, controlTestPath())
+		exit(ExitUsage)
+	}
+	if *tester == "" {
+		*tester = test.Owner
+	}
+	test.Results = append(test.Results, controlTestResult{
+		Date: ran.Format("2006-01-02"), Result: *result, Tester: *tester, Notes: *notes, Evidence: *evidence,
+	})
+	// The next run is one period after this one, however late it was.
+	next, err := advanceDue(ran, test.Frequency)
+	if err != nil {
+		fatal(err)
+	}
+	test.NextDue = next.Format("2006-01-02")
+	if err := saveControlTests(f); err != nil {
+		fatal(err)
+	}
+	status(test.ID, "Recorded %s for control test %d, next due %s\n", *result, test.ID, test.NextDue)
+}
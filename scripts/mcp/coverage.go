@@ -0,0 +1,483 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// `coverage` compares the network ranges the organisation declares
+// against the scan history: a range counts as scanned when a scan found a
+// host in it, and as overdue when the last such scan is older than
+// --max-age. Ranges come from SECMAN_COVERAGE_RANGES and from --ranges,
+// which takes a range or a file: plain text, or an IPAM export as CSV or
+// JSON (NetBox and phpIPAM column names are recognized).
+//
+// The hosts of each scan come from get_scan. Servers without it fall back
+// to the assets' lastSeen, which imports update as well as scans.
+
+// declaredRange is a CIDR or a first-last address range.
+type declaredRange struct {
+	Spec        string
+	Name        string
+	first, last netip.Addr
+}
+
+// parseRange reads 10.0.0.0/16, 10.0.0.1-10.0.0.99 or a single address.
+func parseRange(spec string) (declaredRange, error) {
+	spec = strings.TrimSpace(spec)
+	r := declaredRange{Spec: spec}
+	if from, to, ok := strings.Cut(spec, "-"); ok {
+		first, err1 := netip.ParseAddr(strings.TrimSpace(from))
+		last, err2 := netip.ParseAddr(strings.TrimSpace(to))
+		if err1 != nil || err2 != nil || first.Is4() != last.Is4() || last.Less(first) {
+			return r, fmt.Errorf("invalid address range %q", spec)
+		}
+		r.first, r.last = first, last
+		return r, nil
+	}
+	if !strings.Contains(spec, "/") {
+		a, err := netip.ParseAddr(spec)
+		if err != nil {
+			return r, fmt.Errorf("invalid range %q: not a CIDR, range or address", spec)
+		}
+		r.first, r.last = a, a
+		return r, nil
+	}
+	p, err := netip.ParsePrefix(spec)
+	if err != nil {
+		return r, fmt.Errorf("invalid CIDR %q", spec)
+	}
+	p = p.Masked()
+	r.first, r.last = p.Addr(), lastAddr(p)
+	return r, nil
+}
+
+// lastAddr is the highest address of a prefix.
+func lastAddr(p netip.Prefix) netip.Addr {
+	b := p.Addr().AsSlice()
+	for i := p.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 0x80 >> (i % 8)
+	}
+	a, _ := netip.AddrFromSlice(b)
+	return a
+}
+
+func (r declaredRange) contains(a netip.Addr) bool {
+	a = a.Unmap()
+	return a.Is4() == r.first.Is4() && !a.Less(r.first) && !r.last.Less(a)
+}
+
+// loadRanges reads each source as a range, or else as a file of ranges.
+func loadRanges(sources []string) ([]declaredRange, error) {
+	var ranges []declaredRange
+	for _, src := range sources {
+		if r, err := parseRange(src); err == nil {
+			ranges = append(ranges, r)
+			continue
+		}
+		data, err := readTextFile(src)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, fmt.Errorf("%s is neither a range nor a file", src)
+			}
+			return nil, err
+		}
+		rs, err := parseRangesFile(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", src, err)
+		}
+		ranges = append(ranges, rs...)
+	}
+	return ranges, nil
+}
+
+// IPAM column names, in order of preference.
+var (
+	rangeColumns = []string{"prefix", "cidr", "subnet", "network", "range", "ip range"}
+	maskColumns  = []string{"mask", "bits", "prefix length", "prefix_length", "prefixlen"}
+	nameColumns  = []string{"name", "description", "vlan", "site"}
+)
+
+// parseRangesFile reads JSON, CSV with a header naming the range column,
+// or text with a range and an optional name per line. # starts a comment.
+func parseRangesFile(data []byte) ([]declaredRange, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && (trimmed[0] == '[' || trimmed[0] == '{') {
+		return parseRangesJSON(trimmed)
+	}
+	firstLine, _, _ := bytes.Cut(trimmed, []byte("\n"))
+	if bytes.ContainsAny(firstLine, ",;") {
+		if header := csvHeader(string(firstLine)); columnIndex(header, rangeColumns) >= 0 {
+			return parseRangesCSV(trimmed)
+		}
+	}
+
+	var ranges []declaredRange
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line, _, _ := strings.Cut(sc.Text(), "#")
+		fields := strings.FieldsFunc(line, func(r rune) bool { return r == ',' || r == ';' || r == '\t' || r == ' ' })
+		if len(fields) == 0 {
+			continue
+		}
+		r, err := parseRange(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		r.Name = strings.Join(fields[1:], " ")
+		ranges = append(ranges, r)
+	}
+	return ranges, sc.Err()
+}
+
+func csvHeader(line string) []string {
+	sep := ","
+	if strings.Count(line, ";") > strings.Count(line, ",") {
+		sep = ";"
+	}
+	var header []string
+	for _, h := range strings.Split(strings.TrimPrefix(line, "\ufeff"), sep) {
+		header = append(header, strings.ToLower(strings.Trim(strings.TrimSpace(h), `"`)))
+	}
+	return header
+}
+
+// columnIndex is the index of the first of names in header, or -1.
+func columnIndex(header, names []string) int {
+	for _, name := range names {
+		for i, h := range header {
+			if h == name {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func parseRangesCSV(data []byte) ([]declaredRange, error) {
+	firstLine, _, _ := bytes.Cut(data, []byte("\n"))
+	header := csvHeader(string(firstLine))
+	cr := csv.NewReader(bytes.NewReader(data))
+	if strings.Count(string(firstLine), ";") > strings.Count(string(firstLine), ",") {
+		cr.Comma = ';'
+	}
+	cr.FieldsPerRecord = -1
+	if _, err := cr.Read(); err != nil {
+		return nil, err
+	}
+	col, mask, name := columnIndex(header, rangeColumns), columnIndex(header, maskColumns), columnIndex(header, nameColumns)
+	var ranges []declaredRange
+	for row := 2; ; row++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		r, err := rangeFromColumns(cell(rec, col), cell(rec, mask), cell(rec, name))
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", row, err)
+		}
+		if r != nil {
+			ranges = append(ranges, *r)
+		}
+	}
+	return ranges, nil
+}
+
+func cell(rec []string, i int) string {
+	if i < 0 || i >= len(rec) {
+		return ""
+	}
+	return strings.TrimSpace(rec[i])
+}
+
+// rangeFromColumns joins an IPAM subnet with its mask column, as phpIPAM
+// exports them. An empty range is skipped.
+func rangeFromColumns(spec, mask, name string) (*declaredRange, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	if mask != "" && !strings.ContainsAny(spec, "/-") {
+		spec += "/" + strings.TrimPrefix(mask, "/")
+	}
+	r, err := parseRange(spec)
+	if err != nil {
+		return nil, err
+	}
+	r.Name = name
+	return &r, nil
+}
+
+// parseRangesJSON reads a list of ranges or objects, bare or under
+// results (NetBox), data (phpIPAM), ranges, prefixes or subnets.
+func parseRangesJSON(data []byte) ([]declaredRange, error) {
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	items, ok := doc.([]interface{})
+	if m, isMap := doc.(map[string]interface{}); isMap {
+		for _, key := range []string{"results", "data", "ranges", "prefixes", "subnets"} {
+			if items, ok = m[key].([]interface{}); ok {
+				break
+			}
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("expected a list of ranges")
+	}
+	var ranges []declaredRange
+	for i, item := range items {
+		var spec, mask, name string
+		switch v := item.(type) {
+		case string:
+			spec = v
+		case map[string]interface{}:
+			lower := map[string]interface{}{}
+			for k, val := range v {
+				lower[strings.ToLower(k)] = val
+			}
+			pick := func(names []string) string {
+				for _, n := range names {
+					if s := jsonScalar(lower[n]); s != "" {
+						return s
+					}
+				}
+				return ""
+			}
+			spec, mask, name = pick(rangeColumns), pick(maskColumns), pick(nameColumns)
+		}
+		r, err := rangeFromColumns(spec, mask, name)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i+1, err)
+		}
+		if r != nil {
+			ranges = append(ranges, *r)
+		}
+	}
+	return ranges, nil
+}
+
+// jsonScalar writes a JSON string or number as text; NetBox nests some
+// values, such as a VLAN, as objects with a name.
+func jsonScalar(v interface{}) string {
+	switch x := v.(type) {
+	case string:
+		return strings.TrimSpace(x)
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case map[string]interface{}:
+		return stringField(x, "name")
+	}
+	return ""
+}
+
+// scanSightings maps each address scans found to when it was last found,
+// since the given time.
+func scanSightings(client *McpClient, since time.Time) (map[netip.Addr]time.Time, string, error) {
+	seen := map[netip.Addr]time.Time{}
+	note := func(ip string, t time.Time) {
+		a, err := netip.ParseAddr(strings.TrimSpace(ip))
+		if err != nil || t.Before(since) {
+			return
+		}
+		a = a.Unmap()
+		if t.After(seen[a]) {
+			seen[a] = t
+		}
+	}
+
+	if ok, err := client.HasTool("get_scan"); err != nil || !ok {
+		assets, err := listAll(client, "get_assets", "assets", nil, 500)
+		if err != nil {
+			return nil, "", err
+		}
+		for _, a := range assets {
+			if t, ok := parseServerTime(stringField(a, "lastSeen")); ok {
+				for _, ip := range strings.Split(stringField(a, "ip"), ",") {
+					note(ip, t)
+				}
+			}
+		}
+		return seen, "assets", nil
+	}
+
+	scans, err := listAll(client, "get_scans", "scans", map[string]interface{}{
+		"startDate": since.UTC().Format(time.RFC3339),
+		"endDate":   time.Now().UTC().Format(time.RFC3339),
+	}, 500)
+	if err != nil {
+		return nil, "", err
+	}
+	progress := startProgress("Reading scans", "scans", int64(len(scans)))
+	for _, s := range scans {
+		t, ok := parseServerTime(stringField(s, "scanDate"))
+		if !ok {
+			progress.Add(1)
+			continue
+		}
+		content, err := getScan(client, int64(numberField(s, "id")))
+		if err != nil {
+			progress.Warnf("scan %v: %v", s["id"], err)
+			progress.Add(1)
+			continue
+		}
+		for _, h := range mapsField(content, "hosts") {
+			note(stringField(h, "ip"), t)
+		}
+		progress.Add(1)
+	}
+	progress.Finish()
+	return seen, "scans", nil
+}
+
+// rangeCoverage is the scan coverage of one declared range.
+type rangeCoverage struct {
+	Range    string     `json:"range"`
+	Name     string     `json:"name,omitempty"`
+	Status   string     `json:"status"`
+	Hosts    int        `json:"hostsSeen"`
+	LastScan *time.Time `json:"lastScan,omitempty"`
+	AgeDays  *int       `json:"ageDays,omitempty"`
+}
+
+var coverageStatusOrder = map[string]int{"never": 0, "overdue": 1, "ok": 2}
+
+func cmdCoverage(client *McpClient, osArgs []string) {
+	fs := flag.NewFlagSet("coverage", flag.ContinueOnError)
+	var sources stringList
+	fs.Var(&sources, "ranges", "A range (CIDR or first-last) or a file of ranges, e.g. an IPAM export (repeatable)")
+	maxAge := fs.Int("max-age", 30, "Days after which a range's last scan is overdue")
+	since := fs.String("since", "365d", "Only consider scans since this time")
+	gapsOnly := fs.Bool("gaps", false, "Only show ranges never scanned or overdue")
+	failOnGaps := fs.Bool("fail-on-gaps", false, "Exit with 5 when a range was never scanned or is overdue")
+	asJSON := fs.Bool("json", false, "Print the coverage as JSON")
+	parseFlags(fs, osArgs)
+
+	if declared := setting("SECMAN_COVERAGE_RANGES"); declared != "" {
+		sources = append(splitList(declared), sources...)
+	}
+	if len(sources) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: no declared ranges; set SECMAN_COVERAGE_RANGES or pass --ranges")
+		fmt.Fprintf(os.Stderr, "Usage: %s coverage --ranges <cidr|file> [--max-age 30] [--since 365d] [--gaps] [--fail-on-gaps] [--json]\n", progName())
+		exit(ExitUsage)
+	}
+	ranges, err := loadRanges(sources)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(ExitUsage)
+	}
+	now := time.Now()
+	from, err := parseTimeExpr(*since, now)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --since: %v\n", err)
+		exit(ExitUsage)
+	}
+
+	seen, source, err := scanSightings(client, from)
+	if err != nil {
+		fatal(err)
+	}
+
+	results := make([]rangeCoverage, 0, len(ranges))
+	outside := 0
+	for a := range seen {
+		inside := false
+		for _, r := range ranges {
+			if r.contains(a) {
+				inside = true
+				break
+			}
+		}
+		if !inside {
+			outside++
+		}
+	}
+	never, overdue := 0, 0
+	for _, r := range ranges {
+		c := rangeCoverage{Range: r.Spec, Name: r.Name, Status: "never"}
+		var last time.Time
+		for a, t := range seen {
+			if r.contains(a) {
+				c.Hosts++
+				if t.After(last) {
+					last = t
+				}
+			}
+		}
+		if c.Hosts > 0 {
+			age := int(now.Sub(last).Hours() / 24)
+			c.LastScan, c.AgeDays = &last, &age
+			c.Status = "ok"
+			if age > *maxAge {
+				c.Status = "overdue"
+			}
+		}
+		switch c.Status {
+		case "never":
+			never++
+		case "overdue":
+			overdue++
+		}
+		if *gapsOnly && c.Status == "ok" {
+			continue
+		}
+		results = append(results, c)
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return coverageStatusOrder[results[i].Status] < coverageStatusOrder[results[j].Status]
+	})
+
+	if rawOutput(*asJSON) {
+		printResult(map[string]interface{}{
+			"ranges": results, "declared": len(ranges), "never": never, "overdue": overdue,
+			"outsideDeclared": outside, "source": source, "since": from.Format(time.RFC3339), "maxAgeDays": *maxAge,
+		})
+	} else {
+		fmt.Printf("%d declared range(s): %d never scanned, %d overdue (last scan over %d days ago), since %s\n",
+			len(ranges), never, overdue, *maxAge, from.Format("2006-01-02"))
+		if source == "assets" {
+			fmt.Println("The server has no get_scan; the assets' last seen times stand in for the scan history.")
+		}
+		if len(results) > 0 {
+			fmt.Printf("\n%-24s %-24s %-8s %6s  %s\n", "RANGE", "NAME", "STATUS", "HOSTS", "LAST SCAN")
+		}
+		for _, c := range results {
+			last := "-"
+			if c.LastScan != nil {
+				last = fmt.Sprintf("%s (%dd ago)", c.LastScan.Local().Format("2006-01-02"), *c.AgeDays)
+			}
+			fmt.Printf("%-24s %-24s %s %6d  %s\n", truncate(c.Range, 24), truncate(c.Name, 24), coverageStatusCell(c.Status), c.Hosts, last)
+		}
+		if outside > 0 {
+			fmt.Printf("\n%d scanned address(es) lie outside the declared ranges\n", outside)
+		}
+	}
+	if *failOnGaps && never+overdue > 0 {
+		exit(ExitGateFailed)
+	}
+}
+
+func coverageStatusCell(status string) string {
+	cell := fmt.Sprintf("%-8s", status)
+	switch status {
+	case "never":
+		return paint(styleFail, cell)
+	case "overdue":
+		return paint(styleMedium, cell)
+	}
+	return paint(styleOK, cell)
+}
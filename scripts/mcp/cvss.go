@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// CVSS v3.1 base scores, computed from a vector such as
+// CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H as the FIRST specification
+// defines them. finding create uses it so a score and severity come from
+// the same vector the report quotes.
+
+// cvssMetric is one base metric with its values and their weights.
+type cvssMetric struct {
+	key, name string
+	values    []cvssValue
+}
+
+type cvssValue struct {
+	code, name string
+	weight     float64
+}
+
+// cvssMetrics are the base metrics in vector order. The privileges
+// required weights are those of unchanged scope; cvssBaseScore raises them
+// for changed scope.
+var cvssMetrics = []cvssMetric{
+	{"AV", "Attack Vector", []cvssValue{{"N", "Network", 0.85}, {"A", "Adjacent", 0.62}, {"L", "Local", 0.55}, {"P", "Physical", 0.2}}},
+	{"AC", "Attack Complexity", []cvssValue{{"L", "Low", 0.77}, {"H", "High", 0.44}}},
+	{"PR", "Privileges Required", []cvssValue{{"N", "None", 0.85}, {"L", "Low", 0.62}, {"H", "High", 0.27}}},
+	{"UI", "User Interaction", []cvssValue{{"N", "None", 0.85}, {"R", "Required", 0.62}}},
+	{"S", "Scope", []cvssValue{{"U", "Unchanged", 0}, {"C", "Changed", 0}}},
+	{"C", "Confidentiality", []cvssValue{{"H", "High", 0.56}, {"L", "Low", 0.22}, {"N", "None", 0}}},
+	{"I", "Integrity", []cvssValue{{"H", "High", 0.56}, {"L", "Low", 0.22}, {"N", "None", 0}}},
+	{"A", "Availability", []cvssValue{{"H", "High", 0.56}, {"L", "Low", 0.22}, {"N", "None", 0}}},
+}
+
+// parseCVSSVector reads a v3.0 or v3.1 base vector into metric codes. The
+// CVSS: prefix is optional; temporal and environmental metrics are
+// ignored.
+func parseCVSSVector(vector string) (map[string]string, error) {
+	parts := strings.Split(strings.TrimSpace(vector), "/")
+	if strings.HasPrefix(strings.ToUpper(parts[0]), "CVSS:") {
+		if v := strings.ToUpper(parts[0]); v != "CVSS:3.1" && v != "CVSS:3.0" {
+			return nil, fmt.Errorf("CVSS vector %q: only versions 3.0 and 3.1 are supported", vector)
+		}
+		parts = parts[1:]
+	}
+	codes := map[string]string{}
+	for _, part := range parts {
+		key, value, ok := strings.Cut(strings.ToUpper(part), ":")
+		if !ok {
+			return nil, fmt.Errorf("CVSS vector %q: %q is not metric:value", vector, part)
+		}
+		codes[key] = value
+	}
+	for _, m := range cvssMetrics {
+		if _, ok := m.weight(codes[m.key]); !ok {
+			return nil, fmt.Errorf("CVSS vector %q: %s (%s) is missing or invalid", vector, m.key, m.name)
+		}
+	}
+	return codes, nil
+}
+
+func (m cvssMetric) weight(code string) (float64, bool) {
+	for _, v := range m.values {
+		if v.code == code {
+			return v.weight, true
+		}
+	}
+	return 0, false
+}
+
+// cvssVectorString writes metric codes as a v3.1 vector.
+func cvssVectorString(codes map[string]string) string {
+	parts := []string{"CVSS:3.1"}
+	for _, m := range cvssMetrics {
+		parts = append(parts, m.key+":"+codes[m.key])
+	}
+	return strings.Join(parts, "/")
+}
+
+// cvssBaseScore computes the base score of parsed metric codes.
+func cvssBaseScore(codes map[string]string) float64 {
+	w := map[string]float64{}
+	for _, m := range cvssMetrics {
+		w[m.key], _ = m.weight(codes[m.key])
+	}
+	changed := codes["S"] == "C"
+	if changed {
+		switch codes["PR"] {
+		case "L":
+			w["PR"] = 0.68
+		case "H":
+			w["PR"] = 0.5
+		}
+	}
+	iss := 1 - (1-w["C"])*(1-w["I"])*(1-w["A"])
+	impact := 6.42 * iss
+	if changed {
+		impact = 7.52*(iss-0.029) - 3.25*math.Pow(iss-0.02, 15)
+	}
+	if impact <= 0 {
+		return 0
+	}
+	exploitability := 8.22 * w["AV"] * w["AC"] * w["PR"] * w["UI"]
+	if changed {
+		return cvssRoundUp(math.Min(1.08*(impact+exploitability), 10))
+	}
+	return cvssRoundUp(math.Min(impact+exploitability, 10))
+}
+
+// cvssRoundUp rounds up to one decimal the way the specification does,
+// avoiding floating point artefacts such as 4.000000001 becoming 4.1.
+func cvssRoundUp(x float64) float64 {
+	i := int64(math.Round(x * 100000))
+	if i%10000 == 0 {
+		return float64(i) / 100000
+	}
+	return float64(i/10000+1) / 10
+}
+
+// cvssSeverity is the qualitative rating of a score: NONE, LOW, MEDIUM,
+// HIGH or CRITICAL.
+func cvssSeverity(score float64) string {
+	switch {
+	case score >= 9:
+		return "CRITICAL"
+	case score >= 7:
+		return "HIGH"
+	case score >= 4:
+		return "MEDIUM"
+	case score > 0:
+		return "LOW"
+	}
+	return "NONE"
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// debugBodyLimit caps the bytes of a body shown by --debug.
+const debugBodyLimit = 4096
+
+// WithDebug dumps every request and response to w: method, URL, status,
+// headers and JSON bodies, redacted. Binary downloads are summarized
+// instead of dumped.
+func WithDebug(w io.Writer) ClientOption {
+	return func(c *McpClient) {
+		base := c.HTTP.Transport
+		if base == nil {
+			base = http.DefaultTransport
+		}
+		c.HTTP.Transport = &debugTransport{base: base, w: w}
+	}
+}
+
+type debugTransport struct {
+	base http.RoundTripper
+	w    io.Writer
+	mu   sync.Mutex
+}
+
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		data, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		reqBody = data
+		req.Body = io.NopCloser(bytes.NewReader(data))
+	}
+
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	elapsed := time.Since(start).Round(time.Millisecond)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "> %s %s\n", req.Method, redactString(req.URL.String()))
+	writeDebugHeaders(&b, "> ", req.Header)
+	writeDebugBody(&b, "> ", req.Header.Get("Content-Type"), reqBody, int64(len(reqBody)))
+	if err != nil {
+		fmt.Fprintf(&b, "< error after %s: %s\n", elapsed, redactString(err.Error()))
+	} else {
+		fmt.Fprintf(&b, "< %s (%s)\n", resp.Status, elapsed)
+		writeDebugHeaders(&b, "< ", resp.Header)
+		if contentType := resp.Header.Get("Content-Type"); dumpableContent(contentType) || resp.StatusCode != http.StatusOK {
+			data, rerr := io.ReadAll(io.LimitReader(resp.Body, debugBodyLimit+1))
+			resp.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(data), resp.Body), resp.Body}
+			if rerr == nil {
+				writeDebugBody(&b, "< ", resp.Header.Get("Content-Type"), data, resp.ContentLength)
+			}
+		} else {
+			writeDebugBody(&b, "< ", resp.Header.Get("Content-Type"), nil, resp.ContentLength)
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	pauseProgress(func() { io.WriteString(t.w, b.String()) })
+	return resp, err
+}
+
+func writeDebugHeaders(b *strings.Builder, prefix string, h http.Header) {
+	h = redactHeaders(h)
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(b, "%s%s: %s\n", prefix, name, strings.Join(h[name], ", "))
+	}
+}
+
+// writeDebugBody shows a JSON or text body redacted and truncated, and
+// only the size of anything else. size is the full length, or -1.
+func writeDebugBody(b *strings.Builder, prefix, contentType string, data []byte, size int64) {
+	switch {
+	case data == nil && size == 0:
+		return
+	case data == nil || !dumpableContent(contentType):
+		if size < 0 {
+			fmt.Fprintf(b, "%s[%s body]\n", prefix, contentType)
+		} else {
+			fmt.Fprintf(b, "%s[%s body, %d bytes]\n", prefix, contentType, size)
+		}
+		return
+	}
+	truncated := len(data) > debugBodyLimit
+	if truncated {
+		data = data[:debugBodyLimit]
+	}
+	var text string
+	if truncated {
+		text = redactString(string(data))
+	} else {
+		text = redactJSON(data)
+	}
+	fmt.Fprintf(b, "%s%s\n", prefix, text)
+	if truncated {
+		fmt.Fprintf(b, "%s... (truncated)\n", prefix)
+	}
+}
+
+// dumpableContent reports whether a body of this type is shown: JSON, text
+// and untyped bodies, which are JSON-RPC replies from minimal servers.
+func dumpableContent(contentType string) bool {
+	return contentType == "" || strings.Contains(contentType, "json") || strings.HasPrefix(contentType, "text/")
+}
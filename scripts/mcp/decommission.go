@@ -0,0 +1,188 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// asset decommission retires assets: each is tagged lifecycle=decommissioned
+// with the date and reason, and its findings are closed by an exception for
+// all vulnerabilities scoped to the asset, carrying the reason. Gates and
+// stats leave decommissioned assets out. Deleting the asset instead would
+// lose its history; a decommissioned asset and its closed findings stay
+// queryable.
+//
+// asset decommission-candidates lists the assets no scan has seen for
+// --unseen (default 90d), ready to be piped into asset decommission --stdin.
+
+// isDecommissioned reports whether an asset was retired with asset
+// decommission.
+func isDecommissioned(asset map[string]interface{}) bool {
+	return strings.EqualFold(assetTag(asset, "lifecycle"), "decommissioned")
+}
+
+// openFindingCounts counts the open findings per asset id.
+func openFindingCounts(client *McpClient) (map[int64]int, error) {
+	findings, err := listAll(client, "get_vulnerabilities", "vulnerabilities", map[string]interface{}{}, 500)
+	if err != nil {
+		return nil, err
+	}
+	counts := map[int64]int{}
+	for _, f := range findings {
+		counts[findingAssetID(f)]++
+	}
+	return counts, nil
+}
+
+func cmdAssetDecommission(client *McpClient, osArgs []string) {
+	fs := flag.NewFlagSet("asset decommission", flag.ContinueOnError)
+	reason := fs.String("reason", "", "Why the assets are retired, e.g. a change ticket (required)")
+	sel := addAssetSelectionFlags(fs, "Decommission")
+	yes := addYesFlag(fs)
+	ids := parseInterspersed(fs, osArgs)
+
+	if strings.TrimSpace(*reason) == "" {
+		fmt.Fprintln(os.Stderr, "Error: --reason is required")
+		exit(ExitUsage)
+	}
+	targets := sel.resolve(client, ids, progName()+" asset decommission <id>... | --name/--type/--ip/--owner ... | --stdin --reason <text> [--yes]")
+	var pending []map[string]interface{}
+	for _, a := range targets {
+		if isDecommissioned(a) {
+			status(nil, "  asset %v: already decommissioned\n", a["id"])
+			continue
+		}
+		pending = append(pending, a)
+	}
+	if len(pending) == 0 {
+		status(0, "No assets to decommission\n")
+		return
+	}
+	for _, tool := range []string{"update_asset", "create_vulnerability_exception"} {
+		if err := client.requireTool(tool); err != nil {
+			fatal(err)
+		}
+	}
+	if ok, _ := client.toolAccepts("update_asset", "tags"); !ok {
+		fatal(fmt.Errorf("update_asset on %s does not take tags; the server needs updating to decommission assets", client.BaseURL))
+	}
+	counts, err := openFindingCounts(client)
+	if err != nil {
+		fatal(err)
+	}
+	open := 0
+	for _, a := range pending {
+		open += counts[int64(numberField(a, "id"))]
+	}
+	summary := assetSummary(fmt.Sprintf("%d asset(s) with %d open finding(s)", len(pending), open), pending)
+	if err := confirm(client, *yes, "decommission assets and close their findings", summary); err != nil {
+		fatal(err)
+	}
+
+	today := time.Now().UTC().Format("2006-01-02")
+	done, closed, failed := 0, 0, 0
+	progress := startProgress("Decommissioning assets", "assets", int64(len(pending)))
+	defer progress.Finish()
+	for _, a := range pending {
+		id := int64(numberField(a, "id"))
+		// The exception comes first: an asset tagged decommissioned with
+		// its findings still open would drop out of gates unnoticed.
+		_, err := client.callToolMap("create_vulnerability_exception", map[string]interface{}{
+			"subject": "ALL_VULNS",
+			"scope":   "ASSET",
+			"assetId": id,
+			"reason":  "Asset decommissioned: " + *reason,
+		})
+		if err == nil {
+			_, err = client.callToolMap("update_asset", map[string]interface{}{
+				"assetId": id,
+				"tags": map[string]interface{}{
+					"lifecycle":           "decommissioned",
+					"decommissioned-at":   today,
+					"decommission-reason": *reason,
+				},
+			})
+		}
+		progress.Add(1)
+		if err != nil {
+			progress.Warnf("  asset %v: %v\n", a["id"], err)
+			failed++
+			continue
+		}
+		done++
+		closed += counts[id]
+	}
+	progress.Finish()
+
+	status(done, "Decommissioned %d asset(s), closed %d finding(s)\n", done, closed)
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d asset(s) failed\n", failed)
+		exit(ExitPartial)
+	}
+}
+
+// decommissionCandidate is an asset no scan has seen for a while.
+type decommissionCandidate struct {
+	ID           interface{} `json:"id"`
+	Name         string      `json:"name"`
+	Type         string      `json:"type"`
+	Owner        string      `json:"owner"`
+	IP           string      `json:"ip,omitempty"`
+	LastSeen     string      `json:"lastSeen,omitempty"`
+	DaysUnseen   int         `json:"daysUnseen"`
+	OpenFindings int         `json:"openFindings"`
+}
+
+func cmdAssetDecommissionCandidates(client *McpClient, osArgs []string) {
+	fs := flag.NewFlagSet("asset decommission-candidates", flag.ContinueOnError)
+	unseen := fs.String("unseen", "90d", "Age of the last scan after which an asset is a candidate (e.g. 90d or a date)")
+	parseFlags(fs, osArgs)
+
+	now := time.Now()
+	cutoff, err := parseTimeExpr(*unseen, now)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --unseen: %v\n", err)
+		exit(ExitUsage)
+	}
+	assets, err := listAll(client, "get_assets", "assets", map[string]interface{}{}, 500)
+	if err != nil {
+		fatal(err)
+	}
+	counts, err := openFindingCounts(client)
+	if err != nil {
+		fatal(err)
+	}
+
+	candidates := []decommissionCandidate{}
+	for _, a := range assets {
+		if isDecommissioned(a) {
+			continue
+		}
+		// An asset no scan has ever seen counts from its creation.
+		seen, ok := parseServerTime(stringField(a, "lastSeen"))
+		if !ok {
+			if seen, ok = parseServerTime(stringField(a, "createdAt")); !ok {
+				continue
+			}
+		}
+		if !seen.Before(cutoff) {
+			continue
+		}
+		c := decommissionCandidate{
+			ID: a["id"], Name: stringField(a, "name"), Type: stringField(a, "type"), Owner: stringField(a, "owner"),
+			IP: stringField(a, "ip"), DaysUnseen: int(now.Sub(seen).Hours() / 24),
+			OpenFindings: counts[int64(numberField(a, "id"))],
+		}
+		if t, ok := parseServerTime(stringField(a, "lastSeen")); ok {
+			c.LastSeen = t.Format("2006-01-02")
+		}
+		candidates = append(candidates, c)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].DaysUnseen > candidates[j].DaysUnseen })
+	status(nil, "%d asset(s) unseen since %s\n", len(candidates), cutoff.Format("2006-01-02"))
+	printResult(candidates)
+}
@@ -0,0 +1,621 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/schmalle/secman/scripts/mcp/config"
+	"github.com/schmalle/secman/scripts/mcp/importer"
+)
+
+// bridge defectdojo moves findings between Secman and DefectDojo while both
+// are in use. import reads active DefectDojo findings into Secman, one
+// finding per endpoint host; export creates DefectDojo findings for Secman
+// findings in a "Secman" test of an engagement.
+//
+// Which finding became which is kept in defectdojo-map.json next to the
+// config file, or in SECMAN_DEFECTDOJO_MAP_FILE. A finding that is in the
+// map is not sent again, and a finding that came from the other side is
+// never sent back, so the two directions can run on a schedule side by
+// side. SECMAN_DEFECTDOJO_URL is the DefectDojo instance and
+// SECMAN_DEFECTDOJO_TOKEN an API v2 key.
+
+type ddClient struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+func newDDClient(client *McpClient) (*ddClient, error) {
+	d := &ddClient{
+		baseURL: strings.TrimRight(setting("SECMAN_DEFECTDOJO_URL"), "/"),
+		token:   setting("SECMAN_DEFECTDOJO_TOKEN"),
+	}
+	if d.baseURL == "" || d.token == "" {
+		return nil, fmt.Errorf("SECMAN_DEFECTDOJO_URL and SECMAN_DEFECTDOJO_TOKEN are required")
+	}
+	registerSecret(d.token)
+	d.http = externalHTTPClient(client, 60*time.Second)
+	return d, nil
+}
+
+// do calls an API v2 path, or a full URL such as a page's next link.
+func (d *ddClient) do(method, path string, body interface{}) (map[string]interface{}, error) {
+	u := path
+	if !strings.HasPrefix(u, "http") {
+		u = d.baseURL + "/api/v2" + path
+	}
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, u, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Token "+d.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := d.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("defectdojo: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("defectdojo: read response: %w", err)
+	}
+	var out map[string]interface{}
+	jsonErr := json.Unmarshal(data, &out)
+	if resp.StatusCode/100 != 2 {
+		msg := http.StatusText(resp.StatusCode)
+		if jsonErr == nil {
+			// Validation errors come as {"field": ["reason"]}.
+			if detail := stringField(out, "detail"); detail != "" {
+				msg = detail
+			} else if compact, err := json.Marshal(out); err == nil {
+				msg = truncate(string(compact), 300)
+			}
+		}
+		return nil, &HTTPError{StatusCode: resp.StatusCode, Body: "defectdojo: " + msg}
+	}
+	if jsonErr != nil {
+		return nil, fmt.Errorf("defectdojo: invalid response: %w", jsonErr)
+	}
+	return out, nil
+}
+
+// list follows the pages of a list endpoint. Prefetched objects, such as
+// the endpoints of findings, are merged across pages by kind and id.
+func (d *ddClient) list(path string, query url.Values) ([]map[string]interface{}, map[string]map[string]interface{}, error) {
+	query.Set("limit", "200")
+	next := path + "?" + query.Encode()
+	var results []map[string]interface{}
+	prefetched := map[string]map[string]interface{}{}
+	for next != "" {
+		out, err := d.do(http.MethodGet, next, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		results = append(results, mapsField(out, "results")...)
+		if p, ok := out["prefetch"].(map[string]interface{}); ok {
+			for kind, objects := range p {
+				if prefetched[kind] == nil {
+					prefetched[kind] = map[string]interface{}{}
+				}
+				if m, ok := objects.(map[string]interface{}); ok {
+					for id, o := range m {
+						prefetched[kind][id] = o
+					}
+				}
+			}
+		}
+		next = stringField(out, "next")
+	}
+	return results, prefetched, nil
+}
+
+// ddSeverities maps Secman severities to DefectDojo's and their numerical
+// severity.
+var ddSeverities = map[string][2]string{
+	"CRITICAL": {"Critical", "S0"},
+	"HIGH":     {"High", "S1"},
+	"MEDIUM":   {"Medium", "S2"},
+	"LOW":      {"Low", "S3"},
+}
+
+// ddUniquePrefix marks the unique_id_from_tool of exported findings, so
+// import leaves them alone.
+const ddUniquePrefix = "secman:finding:"
+
+// ddLink is a Secman finding and the DefectDojo finding it came from or
+// went to.
+type ddLink struct {
+	SecmanID        int64  `json:"secmanId"`
+	DefectDojoID    int64  `json:"defectdojoId"`
+	Hostname        string `json:"hostname"`
+	VulnerabilityID string `json:"vulnerabilityId"`
+	Direction       string `json:"direction"`
+	Synced          string `json:"synced"`
+}
+
+type ddMapFile struct {
+	BaseURL       string    `json:"baseUrl,omitempty"`
+	DefectDojoURL string    `json:"defectdojoUrl,omitempty"`
+	Links         []*ddLink `json:"links"`
+}
+
+func ddMapPath() string {
+	if path := setting("SECMAN_DEFECTDOJO_MAP_FILE"); path != "" {
+		return path
+	}
+	dir, err := config.Dir()
+	if err != nil {
+		return "secman-defectdojo-map.json"
+	}
+	return filepath.Join(dir, "defectdojo-map.json")
+}
+
+func loadDDMap() (*ddMapFile, error) {
+	m := &ddMapFile{}
+	data, err := os.ReadFile(ddMapPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("%s: %w", ddMapPath(), err)
+	}
+	return m, nil
+}
+
+// saveDDMap writes the map through a temporary file.
+func saveDDMap(m *ddMapFile) error {
+	path := ddMapPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeStateFile(path, append(data, '\n'), 0o644)
+}
+
+// link records a pair, replacing an earlier link of the same DefectDojo
+// finding and host or of the same Secman finding.
+func (m *ddMapFile) link(l *ddLink) {
+	kept := m.Links[:0]
+	for _, old := range m.Links {
+		sameDD := old.DefectDojoID == l.DefectDojoID && strings.EqualFold(old.Hostname, l.Hostname)
+		if !sameDD && old.SecmanID != l.SecmanID {
+			kept = append(kept, old)
+		}
+	}
+	m.Links = append(kept, l)
+}
+
+// bridgeResult is one finding a bridge run handled.
+type bridgeResult struct {
+	SecmanID        int64  `json:"secmanId,omitempty"`
+	DefectDojoID    int64  `json:"defectdojoId,omitempty"`
+	Hostname        string `json:"hostname"`
+	VulnerabilityID string `json:"vulnerabilityId"`
+	Severity        string `json:"severity"`
+	Status          string `json:"status"`
+	Error           string `json:"error,omitempty"`
+}
+
+func cmdBridge(client *McpClient, osArgs []string) {
+	if len(osArgs) < 2 || osArgs[0] != "defectdojo" {
+		fmt.Fprintf(os.Stderr, "Usage: %s bridge defectdojo <import|export|map> [options]\n", progName())
+		exit(ExitUsage)
+	}
+	switch osArgs[1] {
+	case "import":
+		cmdBridgeDDImport(client, osArgs[2:])
+	case "export":
+		cmdBridgeDDExport(client, osArgs[2:])
+	case "map":
+		cmdBridgeDDMap(osArgs[2:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown bridge defectdojo subcommand: %s\n", osArgs[1])
+		exit(ExitUsage)
+	}
+}
+
+// ddFindingCVE is the first CVE of a DefectDojo finding, or DD- and its id
+// for findings without one.
+func ddFindingCVE(f map[string]interface{}) string {
+	for _, v := range mapsField(f, "vulnerability_ids") {
+		if id := stringField(v, "vulnerability_id"); strings.HasPrefix(strings.ToUpper(id), "CVE-") {
+			return strings.ToUpper(id)
+		}
+	}
+	if cve := stringField(f, "cve"); cve != "" {
+		return strings.ToUpper(cve)
+	}
+	return fmt.Sprintf("DD-%d", int64(numberField(f, "id")))
+}
+
+// ddFindingHosts are the hosts of a finding's endpoints.
+func ddFindingHosts(f map[string]interface{}, endpoints map[string]interface{}) []string {
+	var hosts []string
+	raw, _ := f["endpoints"].([]interface{})
+	for _, e := range raw {
+		var host string
+		switch e := e.(type) {
+		case map[string]interface{}:
+			host = stringField(e, "host")
+		case float64:
+			if ep, ok := endpoints[strconv.FormatInt(int64(e), 10)].(map[string]interface{}); ok {
+				host = stringField(ep, "host")
+			}
+		}
+		if host != "" && !containsFold(hosts, host) {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+func cmdBridgeDDImport(client *McpClient, osArgs []string) {
+	fs := flag.NewFlagSet("bridge defectdojo import", flag.ContinueOnError)
+	product := fs.Int64("product", 0, "Only findings of this DefectDojo product id")
+	engagement := fs.Int64("engagement", 0, "Only findings of this engagement id")
+	test := fs.Int64("test", 0, "Only findings of this test id")
+	severity := fs.String("severity", "", "Only findings of this severity (CRITICAL, HIGH, MEDIUM, LOW)")
+	host := fs.String("host", "", "Hostname for findings without an endpoint (default: skip them)")
+	asJSON := fs.Bool("json", false, "Print the imported and skipped findings as JSON")
+	yes := addYesFlag(fs)
+	parseFlags(fs, osArgs)
+
+	dd, err := newDDClient(client)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(ExitUsage)
+	}
+	if err := client.requireTool("add_vulnerability"); err != nil {
+		fatal(err)
+	}
+	m, err := loadDDMap()
+	if err != nil {
+		fatal(err)
+	}
+
+	query := url.Values{"active": {"true"}, "duplicate": {"false"}, "prefetch": {"endpoints"}}
+	if *product != 0 {
+		query.Set("test__engagement__product", strconv.FormatInt(*product, 10))
+	}
+	if *engagement != 0 {
+		query.Set("test__engagement", strconv.FormatInt(*engagement, 10))
+	}
+	if *test != 0 {
+		query.Set("test", strconv.FormatInt(*test, 10))
+	}
+	findings, prefetched, err := dd.list("/findings/", query)
+	if err != nil {
+		fatal(err)
+	}
+
+	exported := map[int64]bool{}
+	for _, l := range m.Links {
+		if l.Direction == "export" {
+			exported[l.DefectDojoID] = true
+		}
+	}
+	var results []*bridgeResult
+	type pendingImport struct {
+		result  *bridgeResult
+		finding importer.Finding
+	}
+	var pending []pendingImport
+	skipped := 0
+	for _, f := range findings {
+		id := int64(numberField(f, "id"))
+		sev := strings.ToUpper(stringField(f, "severity"))
+		if _, ok := ddSeverities[sev]; !ok || (*severity != "" && !strings.EqualFold(sev, *severity)) {
+			continue
+		}
+		// Findings this bridge exported go the other way only.
+		if exported[id] || strings.HasPrefix(stringField(f, "unique_id_from_tool"), ddUniquePrefix) {
+			continue
+		}
+		hosts := ddFindingHosts(f, prefetched["endpoints"])
+		if len(hosts) == 0 && *host != "" {
+			hosts = []string{*host}
+		}
+		cve := ddFindingCVE(f)
+		if len(hosts) == 0 {
+			results = append(results, &bridgeResult{DefectDojoID: id, VulnerabilityID: cve, Severity: sev, Status: "no-host"})
+			skipped++
+			continue
+		}
+		for _, h := range hosts {
+			r := &bridgeResult{DefectDojoID: id, Hostname: h, VulnerabilityID: cve, Severity: sev, Status: "pending"}
+			results = append(results, r)
+			finding := importer.Finding{Hostname: h, CVE: cve, Severity: sev, Scanner: "defectdojo"}
+			if score, ok := f["cvssv3_score"].(float64); ok {
+				finding.CVSS = &score
+			}
+			if age := int(numberField(f, "age")); age > 0 {
+				finding.DaysOpen = age
+			}
+			finding.ExternalID = importer.ExternalID(finding)
+			pending = append(pending, pendingImport{r, finding})
+		}
+	}
+	if len(pending) == 0 {
+		status(0, "No DefectDojo findings to import (%d without a host)\n", skipped)
+		return
+	}
+	if err := confirm(client, *yes, "import DefectDojo findings", []string{
+		fmt.Sprintf("%d finding(s) from %s", len(pending), dd.baseURL),
+	}); err != nil {
+		fatal(err)
+	}
+
+	imported, failed := 0, 0
+	progress := startProgress("Importing findings", "findings", int64(len(pending)))
+	defer progress.Finish()
+	for _, p := range pending {
+		out, err := client.callToolMap("add_vulnerability", findingArgs(client, p.finding))
+		progress.Add(1)
+		if err != nil {
+			progress.Warnf("  DefectDojo %d on %s: %v\n", p.result.DefectDojoID, p.result.Hostname, err)
+			p.result.Status, p.result.Error = "failed", err.Error()
+			failed++
+			continue
+		}
+		if client.dryRun {
+			p.result.Status = "dry-run"
+			continue
+		}
+		p.result.SecmanID, p.result.Status = int64(numberField(out, "id")), "imported"
+		m.link(&ddLink{SecmanID: p.result.SecmanID, DefectDojoID: p.result.DefectDojoID, Hostname: p.result.Hostname,
+			VulnerabilityID: p.result.VulnerabilityID, Direction: "import", Synced: time.Now().UTC().Format(time.RFC3339)})
+		imported++
+	}
+	progress.Finish()
+	if imported > 0 {
+		m.BaseURL, m.DefectDojoURL = client.BaseURL, dd.baseURL
+		if err := saveDDMap(m); err != nil {
+			fatal(err)
+		}
+	}
+
+	if rawOutput(*asJSON) {
+		printResult(results)
+	}
+	status(imported, "Imported %d finding(s) from DefectDojo, %d without a host\n", imported, skipped)
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d finding(s) could not be imported\n", failed)
+		exit(ExitPartial)
+	}
+}
+
+// ddTest returns the id of the engagement's Secman test, creating it when
+// there is none.
+func (d *ddClient) ddTest(engagement int64, testType string, dryRun bool) (testID, testTypeID int64, err error) {
+	types, _, err := d.list("/test_types/", url.Values{"name": {testType}})
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, t := range types {
+		if strings.EqualFold(stringField(t, "name"), testType) {
+			testTypeID = int64(numberField(t, "id"))
+		}
+	}
+	if testTypeID == 0 {
+		return 0, 0, fmt.Errorf("defectdojo has no test type %q", testType)
+	}
+	tests, _, err := d.list("/tests/", url.Values{"engagement": {strconv.FormatInt(engagement, 10)}})
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, t := range tests {
+		if stringField(t, "title") == "Secman" {
+			return int64(numberField(t, "id")), testTypeID, nil
+		}
+	}
+	if dryRun {
+		fmt.Printf("DRY RUN defectdojo test Secman in engagement %d\n", engagement)
+		return 0, testTypeID, nil
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	out, err := d.do(http.MethodPost, "/tests/", map[string]interface{}{
+		"engagement": engagement, "test_type": testTypeID, "title": "Secman", "target_start": now, "target_end": now,
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return int64(numberField(out, "id")), testTypeID, nil
+}
+
+func cmdBridgeDDExport(client *McpClient, osArgs []string) {
+	fs := flag.NewFlagSet("bridge defectdojo export", flag.ContinueOnError)
+	engagement := fs.Int64("engagement", 0, "DefectDojo engagement id to export to (required)")
+	testType := fs.String("test-type", "Generic Findings Import", "DefectDojo test type of the Secman test")
+	severity := fs.String("severity", "", "Only findings of this severity (CRITICAL, HIGH, MEDIUM, LOW)")
+	cve := fs.String("cve", "", "Only findings whose CVE id contains this text")
+	assetID := fs.Int64("asset-id", 0, "Only findings on this asset")
+	asJSON := fs.Bool("json", false, "Print the exported and skipped findings as JSON")
+	yes := addYesFlag(fs)
+	parseFlags(fs, osArgs)
+
+	if *engagement == 0 {
+		fmt.Fprintln(os.Stderr, "Error: --engagement is required")
+		fmt.Fprintf(os.Stderr, "Usage: %s bridge defectdojo export --engagement <id> [--severity S] [--cve text] [--asset-id N] [--yes]\n", progName())
+		exit(ExitUsage)
+	}
+	dd, err := newDDClient(client)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(ExitUsage)
+	}
+	m, err := loadDDMap()
+	if err != nil {
+		fatal(err)
+	}
+	findings, err := ticketFindings(client, *severity, *cve, *assetID)
+	if err != nil {
+		fatal(err)
+	}
+
+	// Findings already exported, or imported from DefectDojo, are skipped.
+	linked := map[int64]string{}
+	for _, l := range m.Links {
+		linked[l.SecmanID] = l.Direction
+	}
+	var results, pending []*bridgeResult
+	for _, f := range findings {
+		id := int64(numberField(f, "id"))
+		r := &bridgeResult{SecmanID: id, Hostname: stringField(f, "assetName"), VulnerabilityID: stringField(f, "vulnerabilityId"),
+			Severity: strings.ToUpper(stringField(f, "cvssSeverity"))}
+		results = append(results, r)
+		switch {
+		case linked[id] == "export":
+			r.Status = "exists"
+		case linked[id] == "import":
+			r.Status = "from-defectdojo"
+		case ddSeverities[r.Severity][0] == "":
+			r.Status = "no-severity"
+		default:
+			r.Status = "pending"
+			pending = append(pending, r)
+		}
+	}
+	if len(pending) == 0 {
+		status(0, "No findings to export (%d already in DefectDojo)\n", len(results))
+		return
+	}
+	summary := []string{fmt.Sprintf("%d finding(s) to engagement %d on %s", len(pending), *engagement, dd.baseURL)}
+	for i, r := range pending {
+		if i == 20 {
+			summary = append(summary, fmt.Sprintf("... and %d more", len(pending)-20))
+			break
+		}
+		summary = append(summary, fmt.Sprintf("%s on %s (%s)", r.VulnerabilityID, r.Hostname, r.Severity))
+	}
+	if err := confirm(client, *yes, "export findings to DefectDojo", summary); err != nil {
+		fatal(err)
+	}
+	testID, testTypeID, err := dd.ddTest(*engagement, *testType, client.dryRun)
+	if err != nil {
+		fatal(err)
+	}
+
+	byID := map[int64]map[string]interface{}{}
+	for _, f := range findings {
+		byID[int64(numberField(f, "id"))] = f
+	}
+	exported, failed := 0, 0
+	progress := startProgress("Exporting findings", "findings", int64(len(pending)))
+	defer progress.Finish()
+	for _, r := range pending {
+		f := byID[r.SecmanID]
+		sev := ddSeverities[r.Severity]
+		days, _ := parseDays(stringField(f, "daysOpen"))
+		description := fmt.Sprintf("Exported from Secman finding %d on asset %s, open %d day(s).", r.SecmanID, r.Hostname, days)
+		if products := stringField(f, "vulnerableProductVersions"); products != "" {
+			description += "\n\nVulnerable products: " + products
+		}
+		body := map[string]interface{}{
+			"test": testID, "found_by": []int64{testTypeID},
+			"title":    truncate(r.VulnerabilityID+" on "+r.Hostname, 511),
+			"severity": sev[0], "numerical_severity": sev[1],
+			"description": description, "active": true, "verified": false,
+			"date":                time.Now().UTC().AddDate(0, 0, -days).Format("2006-01-02"),
+			"unique_id_from_tool": fmt.Sprintf("%s%d", ddUniquePrefix, r.SecmanID),
+			"component_name":      r.Hostname,
+		}
+		if strings.HasPrefix(strings.ToUpper(r.VulnerabilityID), "CVE-") {
+			body["vulnerability_ids"] = []map[string]string{{"vulnerability_id": r.VulnerabilityID}}
+		}
+		if score, ok := cvssScore(f); ok {
+			body["cvssv3_score"] = score
+		}
+		if client.dryRun {
+			client.dryRunCalls.Add(1)
+			pauseProgress(func() {
+				fmt.Printf("DRY RUN defectdojo finding %s%d\n", ddUniquePrefix, r.SecmanID)
+				fmt.Printf("    title = %s\n    severity = %s\n", dryRunValue(body["title"]), sev[0])
+			})
+			r.Status = "dry-run"
+			progress.Add(1)
+			continue
+		}
+		out, err := dd.do(http.MethodPost, "/findings/", body)
+		progress.Add(1)
+		if err != nil {
+			progress.Warnf("  finding %d: %v\n", r.SecmanID, err)
+			r.Status, r.Error = "failed", err.Error()
+			failed++
+			continue
+		}
+		r.DefectDojoID, r.Status = int64(numberField(out, "id")), "exported"
+		m.link(&ddLink{SecmanID: r.SecmanID, DefectDojoID: r.DefectDojoID, Hostname: r.Hostname,
+			VulnerabilityID: r.VulnerabilityID, Direction: "export", Synced: time.Now().UTC().Format(time.RFC3339)})
+		exported++
+	}
+	progress.Finish()
+	if exported > 0 {
+		m.BaseURL, m.DefectDojoURL = client.BaseURL, dd.baseURL
+		if err := saveDDMap(m); err != nil {
+			fatal(err)
+		}
+	}
+
+	if rawOutput(*asJSON) {
+		printResult(results)
+	}
+	status(exported, "Exported %d finding(s) to DefectDojo test %d\n", exported, testID)
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d finding(s) could not be exported\n", failed)
+		exit(ExitPartial)
+	}
+}
+
+func cmdBridgeDDMap(osArgs []string) {
+	fs := flag.NewFlagSet("bridge defectdojo map", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "Print the links as JSON")
+	parseFlags(fs, osArgs)
+
+	m, err := loadDDMap()
+	if err != nil {
+		fatal(err)
+	}
+	if rawOutput(*asJSON) {
+		printResult(m.Links)
+		return
+	}
+	if len(m.Links) == 0 {
+		fmt.Printf("No linked findings in %s\n", ddMapPath())
+		return
+	}
+	fmt.Printf("%8s  %12s  %-9s %-30s %-20s %s\n", "SECMAN", "DEFECTDOJO", "DIRECTION", "HOST", "VULNERABILITY", "SYNCED")
+	for _, l := range m.Links {
+		fmt.Printf("%8d  %12d  %-9s %-30s %-20s %s\n", l.SecmanID, l.DefectDojoID, l.Direction, truncate(l.Hostname, 30),
+			truncate(l.VulnerabilityID, 20), l.Synced)
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// describe documents tools from their definitions: the description, each
+// parameter with its type, enum values, default and limits, and example
+// calls whose arguments are made up from the schema.
+
+// toolDoc is describe's --json output.
+type toolDoc struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Mutating    bool                   `json:"mutating"`
+	Roles       []string               `json:"roles,omitempty"`
+	InputSchema map[string]interface{} `json:"inputSchema,omitempty"`
+	Examples    []string               `json:"examples"`
+}
+
+func cmdDescribe(client *McpClient, osArgs []string) {
+	fs := flag.NewFlagSet("describe", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "Print the definitions and examples as JSON")
+	names := parseInterspersed(fs, osArgs)
+	if len(names) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: tool name required")
+		fmt.Fprintf(os.Stderr, "Usage: %s describe <tool>... [--json]\n", progName())
+		exit(ExitUsage)
+	}
+
+	var docs []toolDoc
+	for _, name := range names {
+		def, ok, err := client.Tool(name)
+		if err != nil {
+			fatal(err)
+		}
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Error: no tool %q\n", name)
+			if similar := similarTools(client, name); len(similar) > 0 {
+				fmt.Fprintf(os.Stderr, "Similar: %s\n", strings.Join(similar, ", "))
+			}
+			exit(ExitNotFound)
+		}
+		docs = append(docs, toolDoc{
+			Name:        def.Name,
+			Description: strings.TrimSpace(def.Description),
+			Mutating:    isMutatingTool(def.Name),
+			Roles:       toolRoles[def.Name],
+			InputSchema: def.InputSchema,
+			Examples:    toolExamples(def),
+		})
+	}
+	if rawOutput(*asJSON) {
+		if len(docs) == 1 {
+			printResult(docs[0])
+		} else {
+			printResult(docs)
+		}
+		return
+	}
+	for i, doc := range docs {
+		if i > 0 {
+			fmt.Println()
+		}
+		printToolDoc(doc)
+	}
+}
+
+func printToolDoc(doc toolDoc) {
+	kind := "reads records"
+	if doc.Mutating {
+		kind = paint(styleFail, "changes records")
+	}
+	fmt.Printf("%s  (%s", doc.Name, kind)
+	if len(doc.Roles) > 0 {
+		fmt.Printf("; needs %s", rolesText(doc.Roles))
+	}
+	fmt.Println(")")
+	if doc.Description != "" {
+		fmt.Println()
+		for _, line := range wrapWords(doc.Description, 76) {
+			fmt.Printf("  %s\n", line)
+		}
+	}
+
+	names, props, required := schemaParams(ToolDefinition{InputSchema: doc.InputSchema})
+	fmt.Println("\nParameters:")
+	if len(names) == 0 {
+		fmt.Println("  none")
+	}
+	for _, name := range names {
+		prop, _ := props[name].(map[string]interface{})
+		need := "optional"
+		if required[name] {
+			need = "required"
+		}
+		typ := schemaType(prop)
+		if typ == "" {
+			typ = "any"
+		}
+		fmt.Printf("  %-24s %-10s %s\n", name, typ, need)
+		if desc, _ := prop["description"].(string); desc != "" {
+			for _, line := range wrapWords(strings.TrimSpace(desc), 68) {
+				fmt.Printf("      %s\n", line)
+			}
+		}
+		for _, note := range schemaNotes(prop) {
+			fmt.Printf("      %s\n", note)
+		}
+	}
+	if extra, ok := doc.InputSchema["additionalProperties"].(bool); ok && !extra {
+		fmt.Println("  (no other arguments are accepted)")
+	}
+
+	fmt.Println("\nExamples:")
+	for _, ex := range doc.Examples {
+		fmt.Printf("  %s\n", ex)
+	}
+}
+
+// schemaType names a property's type; arrays say what they hold.
+func schemaType(prop map[string]interface{}) string {
+	typ, _ := prop["type"].(string)
+	if typ == "array" {
+		if items, ok := prop["items"].(map[string]interface{}); ok {
+			if it, _ := items["type"].(string); it != "" {
+				return it + "[]"
+			}
+		}
+	}
+	return typ
+}
+
+// schemaNotes lists a property's enum, default, limits and format.
+func schemaNotes(prop map[string]interface{}) []string {
+	var notes []string
+	if enum, ok := prop["enum"].([]interface{}); ok && len(enum) > 0 {
+		values := make([]string, len(enum))
+		for i, e := range enum {
+			values[i] = fmt.Sprint(e)
+		}
+		notes = append(notes, "one of: "+strings.Join(values, ", "))
+	}
+	if items, ok := prop["items"].(map[string]interface{}); ok {
+		if enum, ok := items["enum"].([]interface{}); ok && len(enum) > 0 {
+			notes = append(notes, "items one of: "+strings.TrimSuffix(strings.TrimPrefix(fmt.Sprint(enum), "["), "]"))
+		}
+	}
+	if def, ok := prop["default"]; ok {
+		raw, _ := json.Marshal(def)
+		notes = append(notes, "default: "+string(raw))
+	}
+	min, hasMin := prop["minimum"].(float64)
+	max, hasMax := prop["maximum"].(float64)
+	switch {
+	case hasMin && hasMax:
+		notes = append(notes, fmt.Sprintf("range: %v to %v", min, max))
+	case hasMin:
+		notes = append(notes, fmt.Sprintf("at least %v", min))
+	case hasMax:
+		notes = append(notes, fmt.Sprintf("at most %v", max))
+	}
+	if format, _ := prop["format"].(string); format != "" {
+		notes = append(notes, "format: "+format)
+	}
+	if pattern, _ := prop["pattern"].(string); pattern != "" {
+		notes = append(notes, "pattern: "+pattern)
+	}
+	return notes
+}
+
+// toolExamples returns calls of the tool: with its required arguments,
+// with all of them, in batch form for tools that change records, and
+// with prompting.
+func toolExamples(def ToolDefinition) []string {
+	names, props, required := schemaParams(def)
+	if len(names) == 0 {
+		return []string{progName() + " call " + def.Name}
+	}
+	minimal, full := map[string]interface{}{}, map[string]interface{}{}
+	for _, name := range names {
+		prop, _ := props[name].(map[string]interface{})
+		v := exampleValue(name, prop)
+		full[name] = v
+		if required[name] {
+			minimal[name] = v
+		}
+	}
+	call := func(args map[string]interface{}) string {
+		raw, _ := json.Marshal(args)
+		return fmt.Sprintf("%s call %s --args '%s'", progName(), def.Name, raw)
+	}
+	var examples []string
+	if len(minimal) > 0 {
+		examples = append(examples, call(minimal))
+	} else {
+		examples = append(examples, progName()+" call "+def.Name+" --no-prompt")
+	}
+	if len(full) > len(minimal) {
+		examples = append(examples, call(full))
+	}
+	if isMutatingTool(def.Name) {
+		raw, _ := json.Marshal(full)
+		examples = append(examples, fmt.Sprintf("echo '%s' | %s call %s --stdin", raw, progName(), def.Name))
+	}
+	return append(examples, progName()+" call "+def.Name+"    # prompts for each argument")
+}
+
+// exampleValue makes up a plausible value for a property: its default or
+// first enum value, else one that fits its type and name.
+func exampleValue(name string, prop map[string]interface{}) interface{} {
+	if def, ok := prop["default"]; ok {
+		return def
+	}
+	if enum, ok := prop["enum"].([]interface{}); ok && len(enum) > 0 {
+		return enum[0]
+	}
+	lower := strings.ToLower(name)
+	switch typ, _ := prop["type"].(string); typ {
+	case "integer", "number":
+		switch {
+		case lower == "page":
+			return 0
+		case strings.Contains(lower, "size") || lower == "limit":
+			return 50
+		case strings.Contains(lower, "days"):
+			return 30
+		}
+		if min, ok := prop["minimum"].(float64); ok && min > 42 {
+			return min
+		}
+		if max, ok := prop["maximum"].(float64); ok && max < 42 {
+			return max
+		}
+		return 42
+	case "boolean":
+		return true
+	case "array":
+		items, _ := prop["items"].(map[string]interface{})
+		return []interface{}{exampleValue(strings.TrimSuffix(name, "s"), items)}
+	case "object":
+		return map[string]interface{}{}
+	}
+	switch {
+	case strings.Contains(lower, "email"):
+		return "alice@example.com"
+	case strings.Contains(lower, "cve"):
+		return "CVE-2024-3094"
+	case lower == "ip" || strings.HasSuffix(name, "Ip") || strings.HasSuffix(name, "IP") || strings.Contains(lower, "address"):
+		return "10.0.0.12"
+	case strings.Contains(lower, "date") || strings.Contains(lower, "since") || strings.Contains(lower, "before") || strings.Contains(lower, "after"):
+		return "2026-01-31"
+	case strings.Contains(lower, "url"):
+		return "https://example.com"
+	case strings.Contains(lower, "name") || lower == "hostname" || lower == "owner":
+		return "web-01"
+	}
+	return "example"
+}
+
+// similarTools suggests names sharing a word with an unknown one.
+func similarTools(client *McpClient, name string) []string {
+	all, err := client.ToolNames()
+	if err != nil {
+		return nil
+	}
+	var similar []string
+	for _, candidate := range all {
+		for _, word := range strings.Split(strings.ToLower(name), "_") {
+			if len(word) > 2 && strings.Contains(candidate, word) && !containsFold(similar, candidate) {
+				similar = append(similar, candidate)
+			}
+		}
+	}
+	sort.Strings(similar)
+	if len(similar) > 8 {
+		similar = similar[:8]
+	}
+	return similar
+}
+
+// wrapWords breaks text into lines of at most width runes, keeping its
+// paragraphs.
+func wrapWords(text string, width int) []string {
+	var lines []string
+	for _, para := range strings.Split(text, "\n") {
+		line := ""
+		for _, word := range strings.Fields(para) {
+			if line != "" && len([]rune(line))+1+len([]rune(word)) > width {
+				lines = append(lines, line)
+				line = ""
+			}
+			if line != "" {
+				line += " "
+			}
+			line += word
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
@@ -0,0 +1,503 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Export commands can copy what they wrote to object storage with
+// --destination, so scheduled exports land directly in a data lake:
+//
+//	s3://bucket/prefix                Amazon S3 or an S3-compatible store
+//	azure://account/container/prefix  Azure Blob Storage
+//	gs://bucket/prefix                Google Cloud Storage
+//
+// The object key is the prefix, a date partition of the upload day (UTC)
+// and the file name: prefix/year=2026/month=10/day=17/report.pdf. The local
+// file is kept. A signature written by --sign is uploaded next to it.
+
+// destinationOptions are the flags added by addDestinationFlags.
+type destinationOptions struct {
+	url           *string
+	encryption    *string
+	encryptionKey *string
+	partition     *string
+}
+
+func addDestinationFlags(fs *flag.FlagSet) *destinationOptions {
+	return &destinationOptions{
+		url:           fs.String("destination", setting("SECMAN_DESTINATION"), "Also upload the file to s3://bucket/prefix, azure://account/container/prefix or gs://bucket/prefix"),
+		encryption:    fs.String("encryption", setting("SECMAN_DESTINATION_ENCRYPTION"), "S3 server-side encryption: AES256, aws:kms or aws:kms:dsse"),
+		encryptionKey: fs.String("encryption-key", setting("SECMAN_DESTINATION_ENCRYPTION_KEY"), "KMS key (S3, GCS) or encryption scope (Azure)"),
+		partition:     fs.String("partition", settingOr("SECMAN_DESTINATION_PARTITION", "hive"), "Key partitioning: hive (year=/month=/day=), date (yyyy/mm/dd) or none"),
+	}
+}
+
+// objectStore uploads one object and returns its URL.
+type objectStore interface {
+	Put(key string, f *os.File, size int64, contentType string) (string, error)
+}
+
+// uploadOutput copies a written artifact, and its signature when signed,
+// to the destination. It is a no-op without --destination.
+func uploadOutput(client *McpClient, filePath string, signed bool, d *destinationOptions) {
+	if *d.url == "" {
+		return
+	}
+	store, prefix, err := newObjectStore(client, *d.url, *d.encryption, *d.encryptionKey)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --destination: %v\n", err)
+		exit(ExitUsage)
+	}
+	partition, err := datePartition(*d.partition, time.Now().UTC())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(ExitUsage)
+	}
+	key := path.Join(prefix, partition, filepath.Base(filePath))
+
+	files := []string{filePath}
+	if signed {
+		files = append(files, filePath+".minisig")
+	}
+	for _, p := range files {
+		objectKey := key + strings.TrimPrefix(p, filePath)
+		u, err := putFile(client, store, p, objectKey)
+		if err != nil {
+			fatal(fmt.Errorf("upload %s: %w", p, err))
+		}
+		if u != "" {
+			status(nil, "Uploaded %s to %s\n", p, u)
+		}
+	}
+}
+
+func putFile(client *McpClient, store objectStore, p, key string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	contentType := mime.TypeByExtension(filepath.Ext(p))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	if client.dryRun {
+		client.dryRunCalls.Add(1)
+		fmt.Printf("DRY RUN upload %s (%d bytes, %s) as %s\n", p, info.Size(), contentType, key)
+		return "", nil
+	}
+	return store.Put(key, f, info.Size(), contentType)
+}
+
+// datePartition returns the key segment for day t.
+func datePartition(style string, t time.Time) (string, error) {
+	switch style {
+	case "hive":
+		return t.Format("year=2006/month=01/day=02"), nil
+	case "date":
+		return t.Format("2006/01/02"), nil
+	case "none", "":
+		return "", nil
+	}
+	return "", fmt.Errorf("--partition must be hive, date or none, got %q", style)
+}
+
+// newObjectStore parses a destination URL into a store and key prefix.
+func newObjectStore(client *McpClient, raw, encryption, encryptionKey string) (objectStore, string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, "", err
+	}
+	bucket := u.Host
+	prefix := strings.Trim(u.Path, "/")
+	if bucket == "" {
+		return nil, "", fmt.Errorf("%q has no bucket", raw)
+	}
+	httpClient := externalHTTPClient(client, 30*time.Minute)
+
+	switch u.Scheme {
+	case "s3":
+		store, err := newS3Store(httpClient, bucket, encryption, encryptionKey)
+		return store, prefix, err
+	case "azure":
+		container, rest, _ := strings.Cut(prefix, "/")
+		if container == "" {
+			return nil, "", fmt.Errorf("%q has no container (azure://account/container/prefix)", raw)
+		}
+		store, err := newAzureStore(httpClient, bucket, container, encryption, encryptionKey)
+		return store, rest, err
+	case "gs":
+		store, err := newGCSStore(httpClient, bucket, encryption, encryptionKey)
+		return store, prefix, err
+	}
+	return nil, "", fmt.Errorf("unsupported scheme in %q (use s3://, azure:// or gs://)", raw)
+}
+
+// putObject sends the request and fails on any non-2xx status.
+func putObject(httpClient *http.Client, req *http.Request) error {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("http request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &HTTPError{StatusCode: resp.StatusCode, Body: req.URL.Host + ": " + strings.TrimSpace(string(msg))}
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// uriEncode escapes like AWS SigV4 and Azure expect: everything but
+// unreserved characters, and "/" only when encodeSlash is set.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3Store uploads with a single SigV4-signed PUT. Credentials are the
+// standard AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN;
+// SECMAN_S3_ENDPOINT points at an S3-compatible store such as MinIO.
+type s3Store struct {
+	http          *http.Client
+	endpoint      *url.URL // path-style when set
+	bucket        string
+	region        string
+	accessKey     string
+	secretKey     string
+	sessionToken  string
+	encryption    string
+	encryptionKey string
+}
+
+// s3MaxPut is the largest object a single PUT accepts.
+const s3MaxPut = 5 << 30
+
+func newS3Store(httpClient *http.Client, bucket, encryption, encryptionKey string) (*s3Store, error) {
+	s := &s3Store{
+		http:          httpClient,
+		bucket:        bucket,
+		region:        settingOr("AWS_REGION", settingOr("AWS_DEFAULT_REGION", "us-east-1")),
+		accessKey:     setting("AWS_ACCESS_KEY_ID"),
+		secretKey:     setting("AWS_SECRET_ACCESS_KEY"),
+		sessionToken:  setting("AWS_SESSION_TOKEN"),
+		encryption:    encryption,
+		encryptionKey: encryptionKey,
+	}
+	if s.accessKey == "" || s.secretKey == "" {
+		return nil, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required for s3://")
+	}
+	registerSecret(s.secretKey)
+	registerSecret(s.sessionToken)
+	if s.encryptionKey != "" && s.encryption == "" {
+		s.encryption = "aws:kms"
+	}
+	switch s.encryption {
+	case "", "AES256", "aws:kms", "aws:kms:dsse":
+	default:
+		return nil, fmt.Errorf("--encryption must be AES256, aws:kms or aws:kms:dsse for s3://, got %q", s.encryption)
+	}
+	if s.encryptionKey != "" && s.encryption == "AES256" {
+		return nil, fmt.Errorf("--encryption-key needs --encryption aws:kms or aws:kms:dsse")
+	}
+	if e := setting("SECMAN_S3_ENDPOINT"); e != "" {
+		u, err := url.Parse(strings.TrimRight(e, "/"))
+		if err != nil {
+			return nil, fmt.Errorf("SECMAN_S3_ENDPOINT: %w", err)
+		}
+		s.endpoint = u
+	}
+	return s, nil
+}
+
+// objectURL is virtual-hosted for AWS, except for bucket names with dots,
+// which do not match the wildcard certificate, and path-style otherwise.
+func (s *s3Store) objectURL(key string) *url.URL {
+	if s.endpoint != nil {
+		u := *s.endpoint
+		u.Path += "/" + s.bucket + "/" + key
+		u.RawPath = s.endpoint.EscapedPath() + uriEncode("/"+s.bucket+"/"+key, false)
+		return &u
+	}
+	if strings.Contains(s.bucket, ".") {
+		return &url.URL{Scheme: "https", Host: "s3." + s.region + ".amazonaws.com", Path: "/" + s.bucket + "/" + key, RawPath: uriEncode("/"+s.bucket+"/"+key, false)}
+	}
+	return &url.URL{Scheme: "https", Host: s.bucket + ".s3." + s.region + ".amazonaws.com", Path: "/" + key, RawPath: uriEncode("/"+key, false)}
+}
+
+func (s *s3Store) Put(key string, f *os.File, size int64, contentType string) (string, error) {
+	if size > s3MaxPut {
+		return "", fmt.Errorf("%d bytes exceed the 5 GiB limit of a single S3 PUT", size)
+	}
+	// SigV4 signs the payload hash, so the file is read twice.
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	payloadHash := hex.EncodeToString(h.Sum(nil))
+
+	u := s.objectURL(key)
+	req, err := http.NewRequest(http.MethodPut, u.String(), f)
+	if err != nil {
+		return "", err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+	if s.sessionToken != "" {
+		req.Header.Set("x-amz-security-token", s.sessionToken)
+	}
+	if s.encryption != "" {
+		req.Header.Set("x-amz-server-side-encryption", s.encryption)
+	}
+	if s.encryptionKey != "" {
+		req.Header.Set("x-amz-server-side-encryption-aws-kms-key-id", s.encryptionKey)
+	}
+	s.sign(req, payloadHash, time.Now().UTC())
+
+	if err := putObject(s.http, req); err != nil {
+		return "", err
+	}
+	return "s3://" + s.bucket + "/" + key, nil
+}
+
+func (s *s3Store) sign(req *http.Request, payloadHash string, now time.Time) {
+	sigV4Sign(req, "s3", s.region, s.accessKey, s.secretKey, payloadHash, now)
+}
+
+// sigV4Sign adds a SigV4 Authorization header covering host, content type
+// and every x-amz-* header.
+func sigV4Sign(req *http.Request, service, region, accessKey, secretKey, payloadHash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	req.Header.Set("x-amz-date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host, "content-type": req.Header.Get("Content-Type")}
+	for k, v := range req.Header {
+		if lk := strings.ToLower(k); strings.HasPrefix(lk, "x-amz-") {
+			headers[lk] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := day + "/" + region + "/" + service + "/aws4_request"
+	sum := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+// azureStore uploads block blobs with Put Blob, authorized by a SAS token
+// (SECMAN_AZURE_STORAGE_SAS) or the account key (SECMAN_AZURE_STORAGE_KEY).
+// Azure always encrypts at rest; --encryption-key selects an encryption
+// scope. SECMAN_AZURE_BLOB_ENDPOINT overrides the account endpoint, e.g.
+// for Azurite.
+type azureStore struct {
+	http      *http.Client
+	endpoint  *url.URL
+	account   string
+	container string
+	key       []byte
+	sas       string
+	scope     string
+}
+
+// azureMaxPut is the largest blob a single Put Blob accepts.
+const azureMaxPut = 5000 << 20
+
+func newAzureStore(httpClient *http.Client, account, container, encryption, encryptionKey string) (*azureStore, error) {
+	if encryption != "" {
+		return nil, fmt.Errorf("--encryption is S3-only; Azure encrypts at rest, --encryption-key selects an encryption scope")
+	}
+	s := &azureStore{http: httpClient, account: account, container: container, scope: encryptionKey,
+		sas: strings.TrimPrefix(setting("SECMAN_AZURE_STORAGE_SAS"), "?")}
+	endpoint := settingOr("SECMAN_AZURE_BLOB_ENDPOINT", "https://"+account+".blob.core.windows.net")
+	u, err := url.Parse(strings.TrimRight(endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("SECMAN_AZURE_BLOB_ENDPOINT: %w", err)
+	}
+	s.endpoint = u
+	if key := setting("SECMAN_AZURE_STORAGE_KEY"); key != "" && s.sas == "" {
+		registerSecret(key)
+		if s.key, err = base64.StdEncoding.DecodeString(key); err != nil {
+			return nil, fmt.Errorf("SECMAN_AZURE_STORAGE_KEY is not base64: %w", err)
+		}
+	}
+	if s.sas == "" && s.key == nil {
+		return nil, fmt.Errorf("SECMAN_AZURE_STORAGE_SAS or SECMAN_AZURE_STORAGE_KEY is required for azure://")
+	}
+	registerSecret(s.sas)
+	return s, nil
+}
+
+func (s *azureStore) Put(key string, f *os.File, size int64, contentType string) (string, error) {
+	if size > azureMaxPut {
+		return "", fmt.Errorf("%d bytes exceed the 5000 MiB limit of a single Put Blob", size)
+	}
+	u := *s.endpoint
+	blobPath := "/" + s.container + "/" + key
+	u.Path += blobPath
+	u.RawPath = s.endpoint.EscapedPath() + uriEncode(blobPath, false)
+	u.RawQuery = s.sas
+	req, err := http.NewRequest(http.MethodPut, u.String(), f)
+	if err != nil {
+		return "", err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("x-ms-blob-type", "BlockBlob")
+	req.Header.Set("x-ms-version", "2021-08-06")
+	req.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+	if s.scope != "" {
+		req.Header.Set("x-ms-encryption-scope", s.scope)
+	}
+	if s.key != nil {
+		s.sign(req, size)
+	}
+
+	if err := putObject(s.http, req); err != nil {
+		return "", err
+	}
+	return "azure://" + s.account + blobPath, nil
+}
+
+// sign adds a Shared Key Authorization header.
+func (s *azureStore) sign(req *http.Request, size int64) {
+	var msHeaders []string
+	for k, v := range req.Header {
+		if lk := strings.ToLower(k); strings.HasPrefix(lk, "x-ms-") {
+			msHeaders = append(msHeaders, lk+":"+strings.TrimSpace(strings.Join(v, ",")))
+		}
+	}
+	sort.Strings(msHeaders)
+	length := ""
+	if size > 0 {
+		length = fmt.Sprint(size)
+	}
+	stringToSign := strings.Join([]string{
+		req.Method,
+		"", // Content-Encoding
+		"", // Content-Language
+		length,
+		"", // Content-MD5
+		req.Header.Get("Content-Type"),
+		"",                 // Date, replaced by x-ms-date
+		"", "", "", "", "", // If-Modified-Since, If-Match, If-None-Match, If-Unmodified-Since, Range
+		strings.Join(msHeaders, "\n"),
+		"/" + s.account + req.URL.EscapedPath(),
+	}, "\n")
+	signature := base64.StdEncoding.EncodeToString(hmacSHA256(s.key, stringToSign))
+	req.Header.Set("Authorization", "SharedKey "+s.account+":"+signature)
+}
+
+// gcsStore uploads through the JSON API with an OAuth access token from
+// SECMAN_GCS_TOKEN (e.g. `gcloud auth print-access-token`). GCS encrypts
+// at rest; --encryption-key names a Cloud KMS key instead of Google's.
+type gcsStore struct {
+	http     *http.Client
+	endpoint string
+	bucket   string
+	token    string
+	kmsKey   string
+}
+
+func newGCSStore(httpClient *http.Client, bucket, encryption, encryptionKey string) (*gcsStore, error) {
+	if encryption != "" {
+		return nil, fmt.Errorf("--encryption is S3-only; GCS encrypts at rest, --encryption-key names a Cloud KMS key")
+	}
+	s := &gcsStore{
+		http:     httpClient,
+		endpoint: strings.TrimRight(settingOr("SECMAN_GCS_ENDPOINT", "https://storage.googleapis.com"), "/"),
+		bucket:   bucket,
+		token:    setting("SECMAN_GCS_TOKEN"),
+		kmsKey:   encryptionKey,
+	}
+	if s.token == "" {
+		return nil, fmt.Errorf("SECMAN_GCS_TOKEN is required for gs:// (e.g. from gcloud auth print-access-token)")
+	}
+	registerSecret(s.token)
+	return s, nil
+}
+
+func (s *gcsStore) Put(key string, f *os.File, size int64, contentType string) (string, error) {
+	query := url.Values{"uploadType": {"media"}, "name": {key}}
+	if s.kmsKey != "" {
+		query.Set("kmsKeyName", s.kmsKey)
+	}
+	u := s.endpoint + "/upload/storage/v1/b/" + url.PathEscape(s.bucket) + "/o?" + query.Encode()
+	req, err := http.NewRequest(http.MethodPost, u, f)
+	if err != nil {
+		return "", err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Authorization", "Bearer "+s.token)
+
+	if err := putObject(s.http, req); err != nil {
+		return "", err
+	}
+	return "gs://" + s.bucket + "/" + key, nil
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// discover reads the compute instances and load balancers of cloud
+// accounts, or the nodes, exposed services and images of a Kubernetes
+// cluster, and registers them as assets, so the inventory follows what
+// actually runs. Each provider is read through its REST API with the
+// credentials its SDKs would find (see discoveraws.go, discoverazure.go,
+// discovergcp.go and discoverk8s.go).
+//
+// Cloud assets carry the account as cloudAccountId, and all of them these
+// tags:
+//
+//	cloud-provider   aws, azure, gcp or k8s
+//	cloud-id         instance id, resource id, ARN, uid or image reference
+//	cloud-region     region or location
+//	cloud-kind       instance, load-balancer, node, service or image
+//	cloud-state      running, stopped, active, ...
+//	public-exposure  true when the resource has a public address
+//	public-ip        that address, when there is one
+//	dns-name         the load balancer's DNS name
+//
+// plus the provider's own (k8s-cluster, image-digest, ...) and, unless
+// --no-cloud-tags is given, the resource's tags or labels.
+// Assets are matched by cloud-id first and by name second, so a host a
+// scanner created before is adopted rather than duplicated. Updates do not
+// touch name, type or owner. With --prune, assets tagged with the provider
+// whose resource is gone are deleted, limited to the accounts and regions
+// that were read.
+
+// cloudResource is a discovered instance, load balancer, node, service or
+// image.
+type cloudResource struct {
+	Provider  string            `json:"provider"`
+	Account   string            `json:"account"`
+	Region    string            `json:"region"`
+	ID        string            `json:"id"`
+	Name      string            `json:"name"`
+	Kind      string            `json:"kind"`
+	State     string            `json:"state,omitempty"`
+	PrivateIP string            `json:"privateIp,omitempty"`
+	PublicIP  string            `json:"publicIp,omitempty"`
+	DNSName   string            `json:"dnsName,omitempty"`
+	Public    bool              `json:"public"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	Attrs     map[string]string `json:"attributes,omitempty"` // always tagged
+	Aliases   []string          `json:"aliases,omitempty"`    // other names to match assets by
+}
+
+// cloudScope is what a discovery run reads.
+type cloudScope struct {
+	regions       []string // aws
+	subscriptions []string // azure
+	projects      []string // gcp
+	context       string   // k8s
+	ldap          ldapOptions
+	kinds         map[string]bool
+}
+
+// cloudInventory is what a discovery run found. accounts and regions are
+// the ones read completely; regions is nil when every region was. keep,
+// when set, protects assets from --prune.
+type cloudInventory struct {
+	resources []cloudResource
+	accounts  []string
+	regions   []string
+	keep      func(asset map[string]interface{}) bool
+}
+
+// cloudProvider reads one provider; kinds are the resource kinds it knows.
+// reconcile, when set, annotates the resources with what the server knows
+// about them before the plan is made.
+type cloudProvider struct {
+	kinds     []string
+	discover  func(client *McpClient, scope cloudScope) (*cloudInventory, error)
+	reconcile func(inv *cloudInventory, s *applyState, scope cloudScope)
+}
+
+var cloudProviders = map[string]cloudProvider{
+	"aws":   {[]string{"instance", "load-balancer"}, discoverAWS, nil},
+	"azure": {[]string{"instance", "load-balancer"}, discoverAzure, nil},
+	"gcp":   {[]string{"instance", "load-balancer"}, discoverGCP, nil},
+	"k8s":   {[]string{"node", "service", "image"}, discoverK8s, nil},
+	"ldap":  {[]string{"server", "workstation"}, discoverLDAP, reconcileLDAP},
+}
+
+// cloudAssetTypes are the asset types of new assets by kind.
+var cloudAssetTypes = map[string]string{
+	"instance":      "SERVER",
+	"node":          "SERVER",
+	"load-balancer": "LOAD_BALANCER",
+	"service":       "LOAD_BALANCER",
+	"image":         "CONTAINER_IMAGE",
+	"server":        "SERVER",
+	"workstation":   "WORKSTATION",
+}
+
+func cmdDiscover(client *McpClient, osArgs []string) {
+	usage := "Usage: " + progName() + " discover aws|azure|gcp|k8s|ldap [--regions r1,r2] [--subscription id] [--project id] [--context ctx] [--url ldaps://dc] [--kinds k1,k2] [--owner name] [--list] [--prune] [--yes]"
+	if len(osArgs) == 0 || cloudProviders[osArgs[0]].discover == nil {
+		fmt.Fprintln(os.Stderr, "Error: provider required (aws, azure, gcp, k8s or ldap)")
+		fmt.Fprintln(os.Stderr, usage)
+		exit(ExitUsage)
+	}
+	provider := osArgs[0]
+	p := cloudProviders[provider]
+
+	fs := flag.NewFlagSet("discover "+provider, flag.ContinueOnError)
+	regions := fs.String("regions", setting("SECMAN_DISCOVER_REGIONS"), "AWS regions to read (default: every enabled region)")
+	var subscriptions, projects stringList
+	fs.Var(&subscriptions, "subscription", "Azure subscription id (repeatable; default: every subscription the credentials see)")
+	fs.Var(&projects, "project", "GCP project id (repeatable; default: the credentials' project)")
+	kubeContext := fs.String("context", "", "Kubernetes context of the kubeconfig (default: its current context)")
+	ldapOpts := addLDAPFlags(fs)
+	kinds := fs.String("kinds", strings.Join(p.kinds, ","), "Resource kinds: "+strings.Join(p.kinds, ", "))
+	owner := fs.String("owner", setting("SECMAN_DISCOVER_OWNER"), "Owner of new assets (default: the resource's owner tag, else <provider>:<account>)")
+	noCloudTags := fs.Bool("no-cloud-tags", false, "Do not copy the resources' tags or labels to the assets")
+	list := fs.Bool("list", false, "Only print the resources found; change nothing")
+	prune := fs.Bool("prune", false, "Delete assets of this provider whose resource is gone")
+	diff := fs.Bool("diff", false, "Only print the changes; exit 5 when there are any")
+	yes := addYesFlag(fs)
+	parseFlags(fs, osArgs[1:])
+
+	scope := cloudScope{regions: splitList(*regions), subscriptions: subscriptions, projects: projects, context: *kubeContext,
+		ldap: ldapOpts.resolve(), kinds: map[string]bool{}}
+	for _, k := range splitList(*kinds) {
+		if !containsFold(p.kinds, k) {
+			fmt.Fprintf(os.Stderr, "Error: unknown kind %q (use %s)\n", k, strings.Join(p.kinds, ", "))
+			exit(ExitUsage)
+		}
+		scope.kinds[strings.ToLower(k)] = true
+	}
+
+	inv, err := p.discover(client, scope)
+	if err != nil {
+		fatal(fmt.Errorf("discover %s: %w", provider, err))
+	}
+	sort.SliceStable(inv.resources, func(i, j int) bool {
+		a, b := inv.resources[i], inv.resources[j]
+		if a.Account != b.Account {
+			return a.Account < b.Account
+		}
+		return a.ID < b.ID
+	})
+	if *list && p.reconcile == nil {
+		printResult(map[string]interface{}{"provider": provider, "accounts": inv.accounts, "resources": inv.resources})
+		return
+	}
+
+	state, err := readApplyState(client, map[string]bool{"assets": true}, false)
+	if err != nil {
+		fatal(err)
+	}
+	if p.reconcile != nil {
+		p.reconcile(inv, state, scope)
+	}
+	if *list {
+		printResult(map[string]interface{}{"provider": provider, "accounts": inv.accounts, "resources": inv.resources})
+		return
+	}
+	if scope.ldap.report {
+		printResult(ldapReport(inv, state))
+		return
+	}
+	status(nil, "Found %d resource(s) in %d %s account(s)\n", len(inv.resources), len(inv.accounts), provider)
+	plan := planDiscovery(provider, inv, state, scope.kinds, *owner, !*noCloudTags, *prune)
+	if len(plan) == 0 {
+		status(0, "No changes: the inventory matches %s\n", provider)
+		return
+	}
+	if *diff {
+		for _, a := range plan {
+			fmt.Println(a)
+		}
+		exit(ExitGateFailed)
+	}
+	runApplyPlan(client, state, plan, *yes)
+}
+
+// resourceAsset is the asset record of a resource, in manifest form.
+func resourceAsset(r cloudResource, owner string, cloudTags bool) map[string]interface{} {
+	tags := map[string]interface{}{
+		"cloud-provider":  r.Provider,
+		"cloud-id":        r.ID,
+		"cloud-kind":      r.Kind,
+		"public-exposure": strconv.FormatBool(r.Public),
+	}
+	for k, v := range map[string]string{"cloud-region": r.Region, "cloud-state": r.State, "public-ip": r.PublicIP, "dns-name": r.DNSName} {
+		if v != "" {
+			tags[k] = v
+		}
+	}
+	for k, v := range r.Attrs {
+		if v != "" {
+			tags[k] = v
+		}
+	}
+	if cloudTags {
+		for k, v := range r.Tags {
+			if _, taken := tags[k]; !taken && !strings.EqualFold(k, "name") {
+				tags[k] = v
+			}
+		}
+	}
+
+	if owner == "" {
+		for k, v := range r.Tags {
+			if strings.EqualFold(k, "owner") && v != "" {
+				owner = v
+			}
+		}
+	}
+	if owner == "" && r.Account != "" {
+		owner = r.Provider + ":" + r.Account
+	} else if owner == "" {
+		owner = r.Provider
+	}
+	rec := map[string]interface{}{
+		"name":  r.Name,
+		"type":  cloudAssetTypes[r.Kind],
+		"owner": owner,
+		"tags":  tags,
+	}
+	// A cluster is not a cloud account; it is in the k8s-cluster tag.
+	switch r.Provider {
+	case "k8s":
+	case "ldap":
+		rec["adDomain"] = r.Account
+	default:
+		rec["cloudAccountId"] = r.Account
+	}
+	if ip := r.PrivateIP; ip != "" {
+		rec["ip"] = ip
+	} else if r.PublicIP != "" {
+		rec["ip"] = r.PublicIP
+	}
+	return rec
+}
+
+// planDiscovery compares the resources with the provider's assets.
+func planDiscovery(provider string, inv *cloudInventory, s *applyState, kinds map[string]bool, owner string, cloudTags, prune bool) []*applyAction {
+	byCloudID := discoveredAssets(provider, s)
+	var plan []*applyAction
+	matched := map[string]bool{}
+	names := map[string]bool{}
+	for _, r := range inv.resources {
+		rec := resourceAsset(r, owner, cloudTags)
+		current := matchDiscovered(r, s, byCloudID)
+		if current == nil {
+			// Names are unique; a second resource of that name, or an
+			// asset of another resource, gets the id appended.
+			key := strings.ToLower(r.Name)
+			if names[key] || s.records["assets"][key] != nil {
+				rec["name"] = fmt.Sprintf("%s (%s)", r.Name, r.ID)
+			}
+			names[applyKey("assets", rec)] = true
+			plan = append(plan, &applyAction{op: "create", section: "assets", desired: rec, tools: []string{"create_asset", "update_asset"}})
+			continue
+		}
+
+		key := applyKey("assets", current)
+		matched[key] = true
+		names[key] = true
+		rec["name"] = stringField(current, "name")
+		delete(rec, "type")
+		delete(rec, "owner")
+		if changes := diffRecord("assets", rec, current, nil); len(changes) > 0 {
+			plan = append(plan, &applyAction{op: "update", section: "assets", desired: rec, current: current,
+				changes: changes, tools: updateTools("assets", changes)})
+		}
+	}
+	if !prune {
+		return plan
+	}
+
+	keys := make([]string, 0, len(s.records["assets"]))
+	for key := range s.records["assets"] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		a := s.records["assets"][key]
+		if matched[key] || assetTag(a, "cloud-provider") != provider || !kinds[assetTag(a, "cloud-kind")] ||
+			!containsFold(inv.accounts, discoveredAccount(provider, a)) ||
+			(inv.regions != nil && !containsFold(inv.regions, assetTag(a, "cloud-region"))) ||
+			(inv.keep != nil && inv.keep(a)) {
+			continue
+		}
+		plan = append(plan, &applyAction{op: "delete", section: "assets", current: a, tools: []string{"delete_asset"}})
+	}
+	return plan
+}
+
+// discoveredAssets indexes the assets of a provider by cloud-id.
+func discoveredAssets(provider string, s *applyState) map[string]map[string]interface{} {
+	byCloudID := map[string]map[string]interface{}{}
+	for _, a := range s.records["assets"] {
+		if id := assetTag(a, "cloud-id"); id != "" && assetTag(a, "cloud-provider") == provider {
+			byCloudID[id] = a
+		}
+	}
+	return byCloudID
+}
+
+// matchDiscovered finds the asset of a resource: by cloud-id, else by its
+// name or an alias when that asset is not another resource's.
+func matchDiscovered(r cloudResource, s *applyState, byCloudID map[string]map[string]interface{}) map[string]interface{} {
+	if a := byCloudID[r.ID]; a != nil {
+		return a
+	}
+	for _, name := range append([]string{r.Name}, r.Aliases...) {
+		if a := s.records["assets"][strings.ToLower(name)]; a != nil && assetTag(a, "cloud-id") == "" {
+			return a
+		}
+	}
+	return nil
+}
+
+// discoveredAccount is the account (or cluster) a discovered asset was
+// found in.
+func discoveredAccount(provider string, asset map[string]interface{}) string {
+	switch provider {
+	case "k8s":
+		return assetTag(asset, "k8s-cluster")
+	case "ldap":
+		return stringField(asset, "adDomain")
+	}
+	return stringField(asset, "cloudAccountId")
+}
+
+// cloudRequest sends req and returns the response body, failing on any
+// non-2xx status.
+func cloudRequest(httpClient *http.Client, req *http.Request) ([]byte, error) {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("http request: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		msg := string(body)
+		if len(msg) > 1024 {
+			msg = msg[:1024]
+		}
+		return nil, &HTTPError{StatusCode: resp.StatusCode, Body: req.URL.Host + ": " + strings.TrimSpace(msg)}
+	}
+	return body, nil
+}
+
+// cloudJSON sends req and decodes the JSON response into v.
+func cloudJSON(httpClient *http.Client, req *http.Request, v interface{}) error {
+	body, err := cloudRequest(httpClient, req)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
+
+// cliToken runs a provider CLI that prints an access token, the last link
+// of the credential chains.
+func cliOutput(name string, args ...string) (string, error) {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return "", err
+	}
+	out, err := exec.Command(path, args...).Output()
+	if err != nil {
+		var stderr string
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			stderr = strings.TrimSpace(string(exitErr.Stderr))
+		}
+		return "", fmt.Errorf("%s: %v %s", name, err, stderr)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// metadataClient is for instance metadata endpoints, which answer at once
+// or not at all.
+func metadataClient() *http.Client {
+	return &http.Client{Timeout: 2 * time.Second}
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// discover aws reads EC2 instances and Elastic Load Balancing v2 load
+// balancers with the EC2 and ELB Query APIs. Credentials are looked up like
+// the AWS SDKs do: AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY/AWS_SESSION_TOKEN,
+// then the AWS_PROFILE (default "default") profile of the shared
+// credentials file, then the ECS container endpoint, then the EC2 instance
+// role. Profiles that assume a role or use SSO are not followed; export
+// their credentials first (aws configure export-credentials).
+//
+// Without --regions every region enabled for the account is read. An
+// instance is publicly exposed when it has a public IPv4 address, a load
+// balancer when its scheme is internet-facing.
+
+type awsCredentials struct {
+	accessKey, secretKey, sessionToken string
+}
+
+// awsCredentialChain returns the first credentials found.
+func awsCredentialChain() (awsCredentials, error) {
+	if c := (awsCredentials{setting("AWS_ACCESS_KEY_ID"), setting("AWS_SECRET_ACCESS_KEY"), setting("AWS_SESSION_TOKEN")}); c.accessKey != "" && c.secretKey != "" {
+		return c, nil
+	}
+
+	profile := settingOr("AWS_PROFILE", "default")
+	file := setting("AWS_SHARED_CREDENTIALS_FILE")
+	if file == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			file = filepath.Join(home, ".aws", "credentials")
+		}
+	}
+	if values, err := readINISection(file, profile); err == nil && values["aws_access_key_id"] != "" {
+		return awsCredentials{values["aws_access_key_id"], values["aws_secret_access_key"], values["aws_session_token"]}, nil
+	}
+
+	if uri := setting("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); uri != "" {
+		req, _ := http.NewRequest(http.MethodGet, "http://169.254.170.2"+uri, nil)
+		if c, err := awsRoleCredentials(req); err == nil {
+			return c, nil
+		}
+	}
+
+	// EC2 instance metadata, IMDSv2.
+	req, _ := http.NewRequest(http.MethodPut, "http://169.254.169.254/latest/api/token", nil)
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "300")
+	if token, err := cloudRequest(metadataClient(), req); err == nil {
+		base := "http://169.254.169.254/latest/meta-data/iam/security-credentials/"
+		req, _ = http.NewRequest(http.MethodGet, base, nil)
+		req.Header.Set("X-aws-ec2-metadata-token", string(token))
+		if role, err := cloudRequest(metadataClient(), req); err == nil {
+			req, _ = http.NewRequest(http.MethodGet, base+strings.TrimSpace(strings.SplitN(string(role), "\n", 2)[0]), nil)
+			req.Header.Set("X-aws-ec2-metadata-token", string(token))
+			if c, err := awsRoleCredentials(req); err == nil {
+				return c, nil
+			}
+		}
+	}
+	return awsCredentials{}, fmt.Errorf("no AWS credentials: set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, or configure profile %q in %s", profile, file)
+}
+
+// awsRoleCredentials reads the JSON credentials of the container and
+// instance metadata endpoints.
+func awsRoleCredentials(req *http.Request) (awsCredentials, error) {
+	var doc struct {
+		AccessKeyID     string `json:"AccessKeyId"`
+		SecretAccessKey string `json:"SecretAccessKey"`
+		Token           string `json:"Token"`
+	}
+	body, err := cloudRequest(metadataClient(), req)
+	if err == nil {
+		err = json.Unmarshal(body, &doc)
+	}
+	if err != nil || doc.AccessKeyID == "" {
+		return awsCredentials{}, fmt.Errorf("no role credentials at %s", req.URL)
+	}
+	return awsCredentials{doc.AccessKeyID, doc.SecretAccessKey, doc.Token}, nil
+}
+
+// readINISection returns the keys of one [section] of an AWS-style INI
+// file; "profile name" headers, as in ~/.aws/config, match name.
+func readINISection(file, section string) (map[string]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	values := map[string]string{}
+	in := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+		case strings.HasPrefix(line, "["):
+			name := strings.TrimSpace(strings.Trim(line, "[]"))
+			in = name == section || name == "profile "+section
+		case in:
+			if k, v, ok := strings.Cut(line, "="); ok {
+				values[strings.ToLower(strings.TrimSpace(k))] = strings.TrimSpace(v)
+			}
+		}
+	}
+	return values, scanner.Err()
+}
+
+// awsDefaultRegion is the region of the configuration, for the calls
+// that list regions and identify the account.
+func awsDefaultRegion() string {
+	if r := setting("AWS_REGION"); r != "" {
+		return r
+	}
+	if r := setting("AWS_DEFAULT_REGION"); r != "" {
+		return r
+	}
+	file := setting("AWS_CONFIG_FILE")
+	if file == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			file = filepath.Join(home, ".aws", "config")
+		}
+	}
+	if values, err := readINISection(file, settingOr("AWS_PROFILE", "default")); err == nil && values["region"] != "" {
+		return values["region"]
+	}
+	return "us-east-1"
+}
+
+// awsQuery calls a Query API action and decodes the XML response into v.
+func awsQuery(httpClient *http.Client, creds awsCredentials, service, region string, params url.Values, v interface{}) error {
+	host := service + "." + region + ".amazonaws.com"
+	signingService := service
+	switch service {
+	case "elb":
+		host = "elasticloadbalancing." + region + ".amazonaws.com"
+		signingService = "elasticloadbalancing"
+	case "sts":
+		host = "sts." + region + ".amazonaws.com"
+	}
+	body := params.Encode()
+	req, err := http.NewRequest(http.MethodPost, "https://"+host+"/", strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	if creds.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.sessionToken)
+	}
+	sum := sha256.Sum256([]byte(body))
+	sigV4Sign(req, signingService, region, creds.accessKey, creds.secretKey, hex.EncodeToString(sum[:]), time.Now().UTC())
+	data, err := cloudRequest(httpClient, req)
+	if err != nil {
+		return err
+	}
+	return xml.Unmarshal(data, v)
+}
+
+type awsTag struct {
+	Key   string `xml:"key"`
+	Value string `xml:"value"`
+}
+
+type ec2DescribeInstances struct {
+	Reservations []struct {
+		OwnerID   string `xml:"ownerId"`
+		Instances []struct {
+			InstanceID     string   `xml:"instanceId"`
+			PrivateDNSName string   `xml:"privateDnsName"`
+			PrivateIP      string   `xml:"privateIpAddress"`
+			PublicIP       string   `xml:"ipAddress"`
+			State          string   `xml:"instanceState>name"`
+			Tags           []awsTag `xml:"tagSet>item"`
+		} `xml:"instancesSet>item"`
+	} `xml:"reservationSet>item"`
+	NextToken string `xml:"nextToken"`
+}
+
+type elbDescribeLoadBalancers struct {
+	LoadBalancers []struct {
+		Name    string `xml:"LoadBalancerName"`
+		ARN     string `xml:"LoadBalancerArn"`
+		DNSName string `xml:"DNSName"`
+		Scheme  string `xml:"Scheme"`
+		State   string `xml:"State>Code"`
+	} `xml:"DescribeLoadBalancersResult>LoadBalancers>member"`
+	NextMarker string `xml:"DescribeLoadBalancersResult>NextMarker"`
+}
+
+func discoverAWS(client *McpClient, scope cloudScope) (*cloudInventory, error) {
+	httpClient := externalHTTPClient(client, 2*time.Minute)
+	creds, err := awsCredentialChain()
+	if err != nil {
+		return nil, err
+	}
+	registerSecret(creds.secretKey)
+	registerSecret(creds.sessionToken)
+	home := awsDefaultRegion()
+
+	var identity struct {
+		Account string `xml:"GetCallerIdentityResult>Account"`
+	}
+	if err := awsQuery(httpClient, creds, "sts", home, url.Values{"Action": {"GetCallerIdentity"}, "Version": {"2011-06-15"}}, &identity); err != nil {
+		return nil, fmt.Errorf("identify account: %w", err)
+	}
+	account := identity.Account
+
+	regions := scope.regions
+	if len(regions) == 0 {
+		var out struct {
+			Regions []string `xml:"regionInfo>item>regionName"`
+		}
+		if err := awsQuery(httpClient, creds, "ec2", home, url.Values{"Action": {"DescribeRegions"}, "Version": {"2016-11-15"}}, &out); err != nil {
+			return nil, fmt.Errorf("list regions: %w", err)
+		}
+		regions = out.Regions
+	}
+
+	inv := &cloudInventory{accounts: []string{account}, regions: []string{}}
+	for _, region := range regions {
+		found, err := discoverAWSRegion(httpClient, creds, account, region, scope.kinds)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: aws %s: %v\n", region, err)
+			continue
+		}
+		inv.resources = append(inv.resources, found...)
+		inv.regions = append(inv.regions, region)
+	}
+	return inv, nil
+}
+
+func discoverAWSRegion(httpClient *http.Client, creds awsCredentials, account, region string, kinds map[string]bool) ([]cloudResource, error) {
+	var found []cloudResource
+	if kinds["instance"] {
+		token := ""
+		for {
+			params := url.Values{"Action": {"DescribeInstances"}, "Version": {"2016-11-15"}, "MaxResults": {"1000"}}
+			if token != "" {
+				params.Set("NextToken", token)
+			}
+			var page ec2DescribeInstances
+			if err := awsQuery(httpClient, creds, "ec2", region, params, &page); err != nil {
+				return nil, err
+			}
+			for _, res := range page.Reservations {
+				for _, in := range res.Instances {
+					if in.State == "terminated" || in.State == "shutting-down" {
+						continue
+					}
+					r := cloudResource{
+						Provider: "aws", Account: res.OwnerID, Region: region, ID: in.InstanceID, Kind: "instance",
+						State: in.State, PrivateIP: in.PrivateIP, PublicIP: in.PublicIP, Public: in.PublicIP != "",
+						Tags: map[string]string{},
+					}
+					for _, t := range in.Tags {
+						r.Tags[t.Key] = t.Value
+					}
+					r.Name = r.Tags["Name"]
+					if r.Name == "" {
+						r.Name, _, _ = strings.Cut(in.PrivateDNSName, ".")
+					}
+					if r.Name == "" {
+						r.Name = in.InstanceID
+					}
+					if r.Account == "" {
+						r.Account = account
+					}
+					found = append(found, r)
+				}
+			}
+			if token = page.NextToken; token == "" {
+				break
+			}
+		}
+	}
+
+	if kinds["load-balancer"] {
+		marker := ""
+		for {
+			params := url.Values{"Action": {"DescribeLoadBalancers"}, "Version": {"2015-12-01"}}
+			if marker != "" {
+				params.Set("Marker", marker)
+			}
+			var page elbDescribeLoadBalancers
+			if err := awsQuery(httpClient, creds, "elb", region, params, &page); err != nil {
+				return nil, err
+			}
+			for _, lb := range page.LoadBalancers {
+				found = append(found, cloudResource{
+					Provider: "aws", Account: account, Region: region, ID: lb.ARN, Name: lb.Name, Kind: "load-balancer",
+					State: lb.State, DNSName: lb.DNSName, Public: lb.Scheme == "internet-facing",
+				})
+			}
+			if marker = page.NextMarker; marker == "" {
+				break
+			}
+		}
+	}
+	return found, nil
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// discover azure reads virtual machines and load balancers with one Azure
+// Resource Graph query each, joined with their network interfaces and
+// public IP addresses. The ARM token is looked up like DefaultAzureCredential
+// does: AZURE_ACCESS_TOKEN, then a service principal from AZURE_TENANT_ID,
+// AZURE_CLIENT_ID and AZURE_CLIENT_SECRET, then the managed identity of the
+// VM (AZURE_CLIENT_ID picks a user-assigned one), then the Azure CLI login.
+//
+// Without --subscription every subscription the credentials see is read.
+// A resource is publicly exposed when it has a public IP address.
+
+const azureManagement = "https://management.azure.com"
+
+// azureToken returns the first ARM token of the chain.
+func azureToken(httpClient *http.Client) (string, error) {
+	if token := setting("AZURE_ACCESS_TOKEN"); token != "" {
+		return token, nil
+	}
+
+	var doc struct {
+		AccessToken string `json:"access_token"`
+	}
+	tenant, clientID, secret := setting("AZURE_TENANT_ID"), setting("AZURE_CLIENT_ID"), setting("AZURE_CLIENT_SECRET")
+	if tenant != "" && clientID != "" && secret != "" {
+		form := url.Values{
+			"grant_type":    {"client_credentials"},
+			"client_id":     {clientID},
+			"client_secret": {secret},
+			"scope":         {azureManagement + "/.default"},
+		}
+		req, _ := http.NewRequest(http.MethodPost, "https://login.microsoftonline.com/"+url.PathEscape(tenant)+"/oauth2/v2.0/token",
+			strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if err := cloudJSON(httpClient, req, &doc); err != nil {
+			return "", fmt.Errorf("service principal %s: %w", clientID, err)
+		}
+		return doc.AccessToken, nil
+	}
+
+	q := url.Values{"api-version": {"2018-02-01"}, "resource": {azureManagement + "/"}}
+	if clientID != "" {
+		q.Set("client_id", clientID)
+	}
+	req, _ := http.NewRequest(http.MethodGet, "http://169.254.169.254/metadata/identity/oauth2/token?"+q.Encode(), nil)
+	req.Header.Set("Metadata", "true")
+	if err := cloudJSON(metadataClient(), req, &doc); err == nil && doc.AccessToken != "" {
+		return doc.AccessToken, nil
+	}
+
+	token, err := cliOutput("az", "account", "get-access-token", "--resource", azureManagement+"/", "--query", "accessToken", "-o", "tsv")
+	if err != nil {
+		return "", fmt.Errorf("no Azure credentials: set AZURE_TENANT_ID, AZURE_CLIENT_ID and AZURE_CLIENT_SECRET, or run az login (%v)", err)
+	}
+	return token, nil
+}
+
+// azureVMQuery joins each VM with the addresses of its primary network
+// interface.
+const azureVMQuery = `Resources
+| where type =~ 'microsoft.compute/virtualmachines'
+| extend nicId = tolower(tostring(properties.networkProfile.networkInterfaces[0].id))
+| join kind=leftouter (Resources
+    | where type =~ 'microsoft.network/networkinterfaces'
+    | extend ipc = properties.ipConfigurations[0]
+    | project nicId = tolower(id), privateIp = tostring(ipc.properties.privateIPAddress), pipId = tolower(tostring(ipc.properties.publicIPAddress.id))) on nicId
+| join kind=leftouter (Resources
+    | where type =~ 'microsoft.network/publicipaddresses'
+    | project pipId = tolower(id), publicIp = tostring(properties.ipAddress)) on pipId
+| project id, name, location, subscriptionId, tags, privateIp, publicIp, state = tostring(properties.extended.instanceView.powerState.code)`
+
+// azureLBQuery joins each load balancer with the addresses of its first
+// frontend.
+const azureLBQuery = `Resources
+| where type =~ 'microsoft.network/loadbalancers'
+| extend fe = properties.frontendIPConfigurations[0]
+| extend privateIp = tostring(fe.properties.privateIPAddress), pipId = tolower(tostring(fe.properties.publicIPAddress.id))
+| join kind=leftouter (Resources
+    | where type =~ 'microsoft.network/publicipaddresses'
+    | project pipId = tolower(id), publicIp = tostring(properties.ipAddress), dnsName = tostring(properties.dnsSettings.fqdn)) on pipId
+| project id, name, location, subscriptionId, tags, privateIp, publicIp, dnsName, state = tostring(properties.provisioningState)`
+
+// azureGraph runs a Resource Graph query and returns every row.
+func azureGraph(httpClient *http.Client, token string, subscriptions []string, query string) ([]map[string]interface{}, error) {
+	var rows []map[string]interface{}
+	skipToken := ""
+	for {
+		body := map[string]interface{}{"query": query, "options": map[string]interface{}{"resultFormat": "objectArray", "$top": 1000}}
+		if len(subscriptions) > 0 {
+			body["subscriptions"] = subscriptions
+		}
+		if skipToken != "" {
+			body["options"].(map[string]interface{})["$skipToken"] = skipToken
+		}
+		data, _ := json.Marshal(body)
+		req, err := http.NewRequest(http.MethodPost, azureManagement+"/providers/Microsoft.ResourceGraph/resources?api-version=2021-03-01", bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		var page struct {
+			Data      []map[string]interface{} `json:"data"`
+			SkipToken string                   `json:"$skipToken"`
+		}
+		if err := cloudJSON(httpClient, req, &page); err != nil {
+			return nil, err
+		}
+		rows = append(rows, page.Data...)
+		if skipToken = page.SkipToken; skipToken == "" {
+			return rows, nil
+		}
+	}
+}
+
+func discoverAzure(client *McpClient, scope cloudScope) (*cloudInventory, error) {
+	httpClient := externalHTTPClient(client, 2*time.Minute)
+	token, err := azureToken(httpClient)
+	if err != nil {
+		return nil, err
+	}
+	registerSecret(token)
+
+	accounts := scope.subscriptions
+	if len(accounts) == 0 {
+		req, _ := http.NewRequest(http.MethodGet, azureManagement+"/subscriptions?api-version=2020-01-01", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		var out struct {
+			Value []struct {
+				SubscriptionID string `json:"subscriptionId"`
+			} `json:"value"`
+		}
+		if err := cloudJSON(httpClient, req, &out); err != nil {
+			return nil, fmt.Errorf("list subscriptions: %w", err)
+		}
+		for _, s := range out.Value {
+			accounts = append(accounts, s.SubscriptionID)
+		}
+	}
+	if len(accounts) == 0 {
+		fmt.Fprintln(os.Stderr, "Warning: the Azure credentials see no subscriptions")
+		return &cloudInventory{}, nil
+	}
+
+	inv := &cloudInventory{accounts: accounts}
+	for _, kind := range []string{"instance", "load-balancer"} {
+		if !scope.kinds[kind] {
+			continue
+		}
+		query := azureVMQuery
+		if kind == "load-balancer" {
+			query = azureLBQuery
+		}
+		rows, err := azureGraph(httpClient, token, accounts, query)
+		if err != nil {
+			return nil, fmt.Errorf("resource graph: %w", err)
+		}
+		for _, row := range rows {
+			r := cloudResource{
+				Provider: "azure", Account: stringField(row, "subscriptionId"), Region: stringField(row, "location"),
+				ID: stringField(row, "id"), Name: stringField(row, "name"), Kind: kind,
+				State:     strings.TrimPrefix(strings.ToLower(stringField(row, "state")), "powerstate/"),
+				PrivateIP: stringField(row, "privateIp"), PublicIP: stringField(row, "publicIp"), DNSName: stringField(row, "dnsName"),
+				Tags: map[string]string{},
+			}
+			r.Public = r.PublicIP != ""
+			tags, _ := row["tags"].(map[string]interface{})
+			for k := range tags {
+				r.Tags[k] = stringField(tags, k)
+			}
+			inv.resources = append(inv.resources, r)
+		}
+	}
+	return inv, nil
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// discover gcp reads Compute Engine instances and forwarding rules (the
+// frontends of load balancers) with the aggregated list calls of the
+// Compute API. The token is looked up like Application Default Credentials
+// are: GOOGLE_OAUTH_ACCESS_TOKEN, then the key or user credentials file of
+// GOOGLE_APPLICATION_CREDENTIALS or gcloud auth application-default login,
+// then the metadata server, then gcloud auth print-access-token.
+//
+// Without --project the project of GOOGLE_CLOUD_PROJECT, the credentials
+// file or gcloud config is read. An instance is publicly exposed when it
+// has an external address, a forwarding rule when its scheme is EXTERNAL or
+// EXTERNAL_MANAGED.
+
+const gcpComputeScope = "https://www.googleapis.com/auth/compute.readonly"
+
+// gcpCredentialsFile is the file of Application Default Credentials.
+type gcpCredentialsFile struct {
+	Type         string `json:"type"`
+	ProjectID    string `json:"project_id"`
+	QuotaProject string `json:"quota_project_id"`
+	ClientEmail  string `json:"client_email"`
+	PrivateKey   string `json:"private_key"`
+	TokenURI     string `json:"token_uri"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+func gcpReadCredentialsFile() (*gcpCredentialsFile, error) {
+	file := setting("GOOGLE_APPLICATION_CREDENTIALS")
+	if file == "" {
+		// gcloud keeps its configuration in %APPDATA% on Windows and in
+		// ~/.config everywhere else, macOS included.
+		dir := os.Getenv("APPDATA")
+		if runtime.GOOS != "windows" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, err
+			}
+			dir = filepath.Join(home, ".config")
+		}
+		file = filepath.Join(dir, "gcloud", "application_default_credentials.json")
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var creds gcpCredentialsFile
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return &creds, nil
+}
+
+// gcpToken returns the first token of the chain, and the credentials
+// file when there is one.
+func gcpToken(httpClient *http.Client) (string, *gcpCredentialsFile, error) {
+	if token := setting("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		return token, nil, nil
+	}
+
+	var doc struct {
+		AccessToken string `json:"access_token"`
+	}
+	creds, err := gcpReadCredentialsFile()
+	if err == nil {
+		var form url.Values
+		tokenURI := "https://oauth2.googleapis.com/token"
+		switch creds.Type {
+		case "service_account":
+			if creds.TokenURI != "" {
+				tokenURI = creds.TokenURI
+			}
+			assertion, err := gcpJWT(creds, tokenURI)
+			if err != nil {
+				return "", nil, err
+			}
+			form = url.Values{"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"}, "assertion": {assertion}}
+		case "authorized_user":
+			form = url.Values{"grant_type": {"refresh_token"}, "client_id": {creds.ClientID},
+				"client_secret": {creds.ClientSecret}, "refresh_token": {creds.RefreshToken}}
+		default:
+			return "", nil, fmt.Errorf("unsupported Google credentials type %q", creds.Type)
+		}
+		req, _ := http.NewRequest(http.MethodPost, tokenURI, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if err := cloudJSON(httpClient, req, &doc); err != nil {
+			return "", nil, fmt.Errorf("google token: %w", err)
+		}
+		return doc.AccessToken, creds, nil
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token", nil)
+	req.Header.Set("Metadata-Flavor", "Google")
+	if err := cloudJSON(metadataClient(), req, &doc); err == nil && doc.AccessToken != "" {
+		return doc.AccessToken, nil, nil
+	}
+
+	token, err := cliOutput("gcloud", "auth", "print-access-token")
+	if err != nil {
+		return "", nil, fmt.Errorf("no Google credentials: set GOOGLE_APPLICATION_CREDENTIALS or run gcloud auth login (%v)", err)
+	}
+	return token, nil, nil
+}
+
+// gcpJWT signs the assertion a service account exchanges for a token.
+func gcpJWT(creds *gcpCredentialsFile, audience string) (string, error) {
+	block, _ := pem.Decode([]byte(creds.PrivateKey))
+	if block == nil {
+		return "", fmt.Errorf("service account %s: no private key", creds.ClientEmail)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return "", fmt.Errorf("service account %s: %w", creds.ClientEmail, err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return "", fmt.Errorf("service account %s: not an RSA key", creds.ClientEmail)
+	}
+
+	now := time.Now().Unix()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss": creds.ClientEmail, "scope": gcpComputeScope, "aud": audience, "iat": now, "exp": now + 3600,
+	})
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	sum := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + enc.EncodeToString(sig), nil
+}
+
+// gcpAggregated pages through an aggregated list call and returns the items
+// of every zone or region.
+func gcpAggregated(httpClient *http.Client, token, project, collection, field string) ([]map[string]interface{}, error) {
+	var items []map[string]interface{}
+	pageToken := ""
+	for {
+		q := url.Values{"maxResults": {"500"}}
+		if pageToken != "" {
+			q.Set("pageToken", pageToken)
+		}
+		u := "https://compute.googleapis.com/compute/v1/projects/" + url.PathEscape(project) + "/aggregated/" + collection + "?" + q.Encode()
+		req, err := http.NewRequest(http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		var page struct {
+			Items         map[string]map[string]interface{} `json:"items"`
+			NextPageToken string                            `json:"nextPageToken"`
+		}
+		if err := cloudJSON(httpClient, req, &page); err != nil {
+			return nil, err
+		}
+		for _, scoped := range page.Items {
+			items = append(items, mapsField(scoped, field)...)
+		}
+		if pageToken = page.NextPageToken; pageToken == "" {
+			return items, nil
+		}
+	}
+}
+
+func discoverGCP(client *McpClient, scope cloudScope) (*cloudInventory, error) {
+	httpClient := externalHTTPClient(client, 2*time.Minute)
+	token, creds, err := gcpToken(httpClient)
+	if err != nil {
+		return nil, err
+	}
+	registerSecret(token)
+
+	projects := scope.projects
+	if len(projects) == 0 {
+		project := settingOr("GOOGLE_CLOUD_PROJECT", setting("CLOUDSDK_CORE_PROJECT"))
+		if project == "" && creds != nil {
+			project = creds.ProjectID
+			if project == "" {
+				project = creds.QuotaProject
+			}
+		}
+		if project == "" {
+			project, _ = cliOutput("gcloud", "config", "get-value", "project")
+		}
+		if project == "" {
+			return nil, fmt.Errorf("no project: pass --project or set GOOGLE_CLOUD_PROJECT")
+		}
+		projects = []string{project}
+	}
+
+	inv := &cloudInventory{}
+	for _, project := range projects {
+		found, err := discoverGCPProject(httpClient, token, project, scope.kinds)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: gcp %s: %v\n", project, err)
+			continue
+		}
+		inv.resources = append(inv.resources, found...)
+		inv.accounts = append(inv.accounts, project)
+	}
+	return inv, nil
+}
+
+func discoverGCPProject(httpClient *http.Client, token, project string, kinds map[string]bool) ([]cloudResource, error) {
+	var found []cloudResource
+	labels := func(item map[string]interface{}) map[string]string {
+		out := map[string]string{}
+		l, _ := item["labels"].(map[string]interface{})
+		for k := range l {
+			out[k] = stringField(l, k)
+		}
+		return out
+	}
+
+	if kinds["instance"] {
+		instances, err := gcpAggregated(httpClient, token, project, "instances", "instances")
+		if err != nil {
+			return nil, err
+		}
+		for _, in := range instances {
+			r := cloudResource{
+				Provider: "gcp", Account: project, Region: path.Base(stringField(in, "zone")),
+				ID: stringField(in, "id"), Name: stringField(in, "name"), Kind: "instance",
+				State: strings.ToLower(stringField(in, "status")), Tags: labels(in),
+			}
+			for _, nic := range mapsField(in, "networkInterfaces") {
+				if r.PrivateIP == "" {
+					r.PrivateIP = stringField(nic, "networkIP")
+				}
+				for _, ac := range mapsField(nic, "accessConfigs") {
+					if ip := stringField(ac, "natIP"); ip != "" && r.PublicIP == "" {
+						r.PublicIP = ip
+					}
+				}
+			}
+			r.Public = r.PublicIP != ""
+			found = append(found, r)
+		}
+	}
+
+	if kinds["load-balancer"] {
+		rules, err := gcpAggregated(httpClient, token, project, "forwardingRules", "forwardingRules")
+		if err != nil {
+			return nil, err
+		}
+		for _, fr := range rules {
+			r := cloudResource{
+				Provider: "gcp", Account: project, Region: path.Base(stringField(fr, "region")),
+				ID: stringField(fr, "id"), Name: stringField(fr, "name"), Kind: "load-balancer", Tags: labels(fr),
+			}
+			scheme := stringField(fr, "loadBalancingScheme")
+			if r.Region == "." {
+				r.Region = "global"
+			}
+			r.Public = scheme == "EXTERNAL" || scheme == "EXTERNAL_MANAGED"
+			if r.Public {
+				r.PublicIP = stringField(fr, "IPAddress")
+			} else {
+				r.PrivateIP = stringField(fr, "IPAddress")
+			}
+			found = append(found, r)
+		}
+	}
+	return found, nil
+}
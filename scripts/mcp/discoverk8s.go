@@ -0,0 +1,512 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// discover k8s reads a cluster's nodes, the services reachable from
+// outside it (LoadBalancer ingress or externalIPs) and the images its pods
+// run, because cluster workloads do not show up in network scans. The
+// cluster is a context of the kubeconfig (KUBECONFIG, default
+// ~/.kube/config), or the cluster the client runs in when there is no
+// kubeconfig. Users authenticate with a token, a client certificate, basic
+// auth or an exec credential plugin (aws eks get-token,
+// gke-gcloud-auth-plugin, kubelogin, ...), as with kubectl.
+//
+// Nodes become SERVER assets, services LOAD_BALANCER assets named
+// <cluster>/<namespace>/<name>, and images CONTAINER_IMAGE assets named by
+// their full reference (docker.io/library/nginx:1.25), shared by every
+// cluster that runs them, so SBOM and vulnerability findings of an image
+// correlate across clusters. --prune deletes vanished nodes and services
+// of the cluster; images are kept, since other clusters may still run them.
+
+// kubeTarget is a resolved kubeconfig context.
+type kubeTarget struct {
+	cluster string
+	server  string
+	http    *http.Client
+	header  http.Header
+}
+
+// kubeNamed finds a named entry of a kubeconfig list (clusters, contexts,
+// users).
+func kubeNamed(config map[string]interface{}, list, name string) map[string]interface{} {
+	for _, item := range mapsField(config, list) {
+		if stringField(item, "name") == name {
+			inner, _ := item[strings.TrimSuffix(list, "s")].(map[string]interface{})
+			return inner
+		}
+	}
+	return nil
+}
+
+// loadKubeconfig merges the KUBECONFIG files like kubectl: the first file
+// that defines a name or the current context wins. Relative paths in a file
+// are made absolute to its directory.
+func loadKubeconfig() (map[string]interface{}, error) {
+	files := filepath.SplitList(setting("KUBECONFIG"))
+	if len(files) == 0 {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		files = []string{filepath.Join(home, ".kube", "config")}
+	}
+	merged := map[string]interface{}{}
+	found := false
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var doc interface{}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			if doc, err = parseYAML(data); err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+		}
+		config, _ := doc.(map[string]interface{})
+		found = true
+		if merged["current-context"] == nil && stringField(config, "current-context") != "" {
+			merged["current-context"] = config["current-context"]
+		}
+		for _, list := range []string{"clusters", "contexts", "users"} {
+			have, _ := merged[list].([]interface{})
+			for _, item := range mapsField(config, list) {
+				if kubeNamed(merged, list, stringField(item, "name")) != nil {
+					continue
+				}
+				if inner, ok := item[strings.TrimSuffix(list, "s")].(map[string]interface{}); ok {
+					for _, k := range []string{"certificate-authority", "client-certificate", "client-key", "tokenFile"} {
+						if p := stringField(inner, k); p != "" && !filepath.IsAbs(p) {
+							inner[k] = filepath.Join(filepath.Dir(file), p)
+						}
+					}
+				}
+				have = append(have, item)
+			}
+			merged[list] = have
+		}
+	}
+	if !found {
+		return nil, nil
+	}
+	return merged, nil
+}
+
+// kubeFileOrData reads field-data (base64) or the file named by field.
+func kubeFileOrData(m map[string]interface{}, field string) ([]byte, error) {
+	if d := stringField(m, field+"-data"); d != "" {
+		return base64.StdEncoding.DecodeString(d)
+	}
+	if f := stringField(m, field); f != "" {
+		return os.ReadFile(f)
+	}
+	return nil, nil
+}
+
+// resolveKubeTarget builds the client of a context, or of the cluster the
+// client runs in when there is no kubeconfig.
+func resolveKubeTarget(client *McpClient, contextName string) (*kubeTarget, error) {
+	config, err := loadKubeconfig()
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	target := &kubeTarget{header: http.Header{}}
+
+	if config == nil {
+		const sa = "/var/run/secrets/kubernetes.io/serviceaccount/"
+		host := os.Getenv("KUBERNETES_SERVICE_HOST")
+		if host == "" || contextName != "" {
+			return nil, fmt.Errorf("no kubeconfig: set KUBECONFIG or create ~/.kube/config")
+		}
+		token, err := os.ReadFile(sa + "token")
+		if err != nil {
+			return nil, fmt.Errorf("in-cluster service account: %w", err)
+		}
+		ca, err := os.ReadFile(sa + "ca.crt")
+		if err != nil {
+			return nil, fmt.Errorf("in-cluster service account: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		tlsConfig.RootCAs.AppendCertsFromPEM(ca)
+		target.cluster = settingOr("SECMAN_K8S_CLUSTER", "in-cluster")
+		target.server = "https://" + net.JoinHostPort(host, os.Getenv("KUBERNETES_SERVICE_PORT"))
+		target.header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+		registerSecret(string(token))
+		target.http = kubeHTTPClient(client, tlsConfig)
+		return target, nil
+	}
+
+	if contextName == "" {
+		contextName = stringField(config, "current-context")
+	}
+	kctx := kubeNamed(config, "contexts", contextName)
+	if kctx == nil {
+		return nil, fmt.Errorf("context %q not found in the kubeconfig", contextName)
+	}
+	cluster := kubeNamed(config, "clusters", stringField(kctx, "cluster"))
+	if cluster == nil {
+		return nil, fmt.Errorf("context %q: cluster %q not found", contextName, stringField(kctx, "cluster"))
+	}
+	user := kubeNamed(config, "users", stringField(kctx, "user"))
+	if user == nil {
+		user = map[string]interface{}{}
+	}
+	target.cluster = stringField(kctx, "cluster")
+	target.server = strings.TrimSuffix(stringField(cluster, "server"), "/")
+
+	ca, err := kubeFileOrData(cluster, "certificate-authority")
+	if err != nil {
+		return nil, fmt.Errorf("cluster %s: %w", target.cluster, err)
+	}
+	if len(ca) > 0 {
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("cluster %s: no certificates in certificate-authority", target.cluster)
+		}
+	}
+	tlsConfig.ServerName = stringField(cluster, "tls-server-name")
+	tlsConfig.InsecureSkipVerify = cluster["insecure-skip-tls-verify"] == true
+
+	cert, err := kubeFileOrData(user, "client-certificate")
+	if err != nil {
+		return nil, err
+	}
+	key, err := kubeFileOrData(user, "client-key")
+	if err != nil {
+		return nil, err
+	}
+	token := stringField(user, "token")
+	if f := stringField(user, "tokenFile"); token == "" && f != "" {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	if plugin, ok := user["exec"].(map[string]interface{}); ok {
+		status, err := runKubeExecPlugin(plugin, cluster)
+		if err != nil {
+			return nil, fmt.Errorf("user %s: %w", stringField(kctx, "user"), err)
+		}
+		if t := stringField(status, "token"); t != "" {
+			token = t
+		}
+		if c := stringField(status, "clientCertificateData"); c != "" {
+			cert, key = []byte(c), []byte(stringField(status, "clientKeyData"))
+		}
+	}
+	if user["auth-provider"] != nil && token == "" {
+		return nil, fmt.Errorf("user %s: auth-provider is not supported; use an exec credential plugin", stringField(kctx, "user"))
+	}
+
+	if len(cert) > 0 {
+		pair, err := tls.X509KeyPair(cert, key)
+		if err != nil {
+			return nil, fmt.Errorf("client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{pair}
+	}
+	switch {
+	case token != "":
+		target.header.Set("Authorization", "Bearer "+token)
+		registerSecret(token)
+	case stringField(user, "username") != "":
+		target.header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString(
+			[]byte(stringField(user, "username")+":"+stringField(user, "password"))))
+		registerSecret(stringField(user, "password"))
+	}
+	target.http = kubeHTTPClient(client, tlsConfig)
+	return target, nil
+}
+
+// runKubeExecPlugin runs an exec credential plugin and returns the status
+// of the ExecCredential it prints.
+func runKubeExecPlugin(spec, cluster map[string]interface{}) (map[string]interface{}, error) {
+	command := stringField(spec, "command")
+	path, err := exec.LookPath(command)
+	if err != nil {
+		if hint := stringField(spec, "installHint"); hint != "" {
+			return nil, fmt.Errorf("%s: %w\n%s", command, err, hint)
+		}
+		return nil, err
+	}
+	cmd := exec.Command(path, stringsField(spec, "args")...)
+	cmd.Env = os.Environ()
+	for _, e := range mapsField(spec, "env") {
+		cmd.Env = append(cmd.Env, stringField(e, "name")+"="+stringField(e, "value"))
+	}
+	info := map[string]interface{}{"interactive": false}
+	if spec["provideClusterInfo"] == true {
+		info["cluster"] = map[string]interface{}{
+			"server": stringField(cluster, "server"), "certificate-authority-data": stringField(cluster, "certificate-authority-data"),
+		}
+	}
+	execInfo, _ := json.Marshal(map[string]interface{}{
+		"apiVersion": stringField(spec, "apiVersion"), "kind": "ExecCredential", "spec": info,
+	})
+	cmd.Env = append(cmd.Env, "KUBERNETES_EXEC_INFO="+string(execInfo))
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", command, err)
+	}
+	var cred map[string]interface{}
+	if err := json.Unmarshal(out, &cred); err != nil {
+		return nil, fmt.Errorf("%s: not an ExecCredential: %w", command, err)
+	}
+	status, _ := cred["status"].(map[string]interface{})
+	if status == nil {
+		return nil, fmt.Errorf("%s: ExecCredential without status", command)
+	}
+	return status, nil
+}
+
+func kubeHTTPClient(client *McpClient, tlsConfig *tls.Config) *http.Client {
+	var transport http.RoundTripper = &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: tlsConfig}
+	if d, ok := client.HTTP.Transport.(*debugTransport); ok {
+		transport = &debugTransport{base: transport, w: d.w}
+	}
+	return &http.Client{Timeout: 2 * time.Minute, Transport: transport}
+}
+
+// list pages through a list call of the API server.
+func (t *kubeTarget) list(path string) ([]map[string]interface{}, error) {
+	var items []map[string]interface{}
+	next := ""
+	for {
+		q := url.Values{"limit": {"500"}}
+		if next != "" {
+			q.Set("continue", next)
+		}
+		req, err := http.NewRequest(http.MethodGet, t.server+path+"?"+q.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range t.header {
+			req.Header[k] = v
+		}
+		var page struct {
+			Items    []map[string]interface{} `json:"items"`
+			Metadata struct {
+				Continue string `json:"continue"`
+			} `json:"metadata"`
+		}
+		if err := cloudJSON(t.http, req, &page); err != nil {
+			return nil, err
+		}
+		items = append(items, page.Items...)
+		if next = page.Metadata.Continue; next == "" {
+			return items, nil
+		}
+	}
+}
+
+// kubeLabels copies the labels of an object, leaving out the well-known
+// kubernetes.io and k8s.io ones, which only repeat what the API says.
+func kubeLabels(meta map[string]interface{}) map[string]string {
+	out := map[string]string{}
+	labels, _ := meta["labels"].(map[string]interface{})
+	for k := range labels {
+		prefix, _, namespaced := strings.Cut(k, "/")
+		if namespaced && (strings.HasSuffix(prefix, "kubernetes.io") || strings.HasSuffix(prefix, "k8s.io")) {
+			continue
+		}
+		out[k] = stringField(labels, k)
+	}
+	return out
+}
+
+// publicAddress reports whether an address is reachable from the internet:
+// a global unicast IP outside the private ranges, or a host name.
+func publicAddress(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return addr != ""
+	}
+	return ip.IsGlobalUnicast() && !ip.IsPrivate()
+}
+
+// normalizeImage spells an image reference out in full, as registries and
+// scanners report it: docker.io/library/nginx:latest for nginx.
+func normalizeImage(ref string) string {
+	name, digest, _ := strings.Cut(ref, "@")
+	first, _, hasSlash := strings.Cut(name, "/")
+	if !hasSlash {
+		name = "docker.io/library/" + name
+	} else if !strings.ContainsAny(first, ".:") && first != "localhost" {
+		name = "docker.io/" + name
+	}
+	if slash := strings.LastIndex(name, "/"); !strings.Contains(name[slash:], ":") && digest == "" {
+		name += ":latest"
+	}
+	if digest != "" {
+		return name + "@" + digest
+	}
+	return name
+}
+
+func discoverK8s(client *McpClient, scope cloudScope) (*cloudInventory, error) {
+	t, err := resolveKubeTarget(client, scope.context)
+	if err != nil {
+		return nil, err
+	}
+	inv := &cloudInventory{accounts: []string{t.cluster}}
+	base := func(kind string, meta map[string]interface{}) cloudResource {
+		return cloudResource{
+			Provider: "k8s", Account: t.cluster, ID: stringField(meta, "uid"), Kind: kind,
+			Tags: kubeLabels(meta), Attrs: map[string]string{"k8s-cluster": t.cluster},
+		}
+	}
+
+	if scope.kinds["node"] {
+		nodes, err := t.list("/api/v1/nodes")
+		if err != nil {
+			return nil, fmt.Errorf("nodes: %w", err)
+		}
+		for _, n := range nodes {
+			meta, _ := n["metadata"].(map[string]interface{})
+			status, _ := n["status"].(map[string]interface{})
+			info, _ := status["nodeInfo"].(map[string]interface{})
+			r := base("node", meta)
+			r.Name = stringField(meta, "name")
+			labels, _ := meta["labels"].(map[string]interface{})
+			r.Region = stringField(labels, "topology.kubernetes.io/region")
+			for _, a := range mapsField(status, "addresses") {
+				switch stringField(a, "type") {
+				case "InternalIP":
+					if r.PrivateIP == "" {
+						r.PrivateIP = stringField(a, "address")
+					}
+				case "ExternalIP":
+					if r.PublicIP == "" {
+						r.PublicIP = stringField(a, "address")
+					}
+				}
+			}
+			r.Public = publicAddress(r.PublicIP)
+			r.State = "not-ready"
+			for _, c := range mapsField(status, "conditions") {
+				if stringField(c, "type") == "Ready" && stringField(c, "status") == "True" {
+					r.State = "ready"
+				}
+			}
+			r.Attrs["k8s-version"] = stringField(info, "kubeletVersion")
+			r.Attrs["os"] = stringField(info, "osImage")
+			inv.resources = append(inv.resources, r)
+		}
+	}
+
+	if scope.kinds["service"] {
+		services, err := t.list("/api/v1/services")
+		if err != nil {
+			return nil, fmt.Errorf("services: %w", err)
+		}
+		for _, svc := range services {
+			meta, _ := svc["metadata"].(map[string]interface{})
+			spec, _ := svc["spec"].(map[string]interface{})
+			status, _ := svc["status"].(map[string]interface{})
+			lb, _ := status["loadBalancer"].(map[string]interface{})
+			external := stringsField(spec, "externalIPs")
+			var hostnames []string
+			for _, in := range mapsField(lb, "ingress") {
+				if ip := stringField(in, "ip"); ip != "" {
+					external = append(external, ip)
+				}
+				if h := stringField(in, "hostname"); h != "" {
+					hostnames = append(hostnames, h)
+				}
+			}
+			if len(external) == 0 && len(hostnames) == 0 {
+				continue
+			}
+			r := base("service", meta)
+			r.Name = t.cluster + "/" + stringField(meta, "namespace") + "/" + stringField(meta, "name")
+			r.PrivateIP = stringField(spec, "clusterIP")
+			for _, ip := range external {
+				r.Public = r.Public || publicAddress(ip)
+			}
+			if len(external) > 0 {
+				r.PublicIP = external[0]
+			}
+			if len(hostnames) > 0 {
+				r.DNSName = hostnames[0]
+				r.Public = true
+			}
+			var ports []string
+			for _, p := range mapsField(spec, "ports") {
+				ports = append(ports, fmt.Sprintf("%s/%s", stringField(p, "port"), stringField(p, "protocol")))
+			}
+			r.Attrs["k8s-namespace"] = stringField(meta, "namespace")
+			r.Attrs["ports"] = strings.Join(ports, ",")
+			inv.resources = append(inv.resources, r)
+		}
+	}
+
+	if scope.kinds["image"] {
+		pods, err := t.list("/api/v1/pods")
+		if err != nil {
+			return nil, fmt.Errorf("pods: %w", err)
+		}
+		images := map[string]*cloudResource{}
+		for _, pod := range pods {
+			spec, _ := pod["spec"].(map[string]interface{})
+			status, _ := pod["status"].(map[string]interface{})
+			digests := map[string]string{}
+			for _, field := range []string{"containerStatuses", "initContainerStatuses"} {
+				for _, cs := range mapsField(status, field) {
+					if _, d, ok := strings.Cut(stringField(cs, "imageID"), "@"); ok {
+						digests[stringField(cs, "name")] = d
+					}
+				}
+			}
+			for _, field := range []string{"containers", "initContainers", "ephemeralContainers"} {
+				for _, c := range mapsField(spec, field) {
+					ref := normalizeImage(stringField(c, "image"))
+					if ref == "" {
+						continue
+					}
+					img := images[ref]
+					if img == nil {
+						repo, _, _ := strings.Cut(ref, "@")
+						img = &cloudResource{
+							Provider: "k8s", ID: ref, Name: ref, Kind: "image",
+							Attrs: map[string]string{"image-registry": strings.SplitN(repo, "/", 2)[0]},
+						}
+						images[ref] = img
+					}
+					if d := digests[stringField(c, "name")]; d != "" {
+						img.Attrs["image-digest"] = d
+					}
+				}
+			}
+		}
+		refs := make([]string, 0, len(images))
+		for ref := range images {
+			refs = append(refs, ref)
+		}
+		sort.Strings(refs)
+		for _, ref := range refs {
+			inv.resources = append(inv.resources, *images[ref])
+		}
+	}
+	return inv, nil
+}
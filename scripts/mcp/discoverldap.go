@@ -0,0 +1,242 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// discover ldap reads the computer objects of Active Directory (or another
+// LDAP directory) and reconciles them with the assets: computers become
+// SERVER or WORKSTATION assets with their domain as adDomain, and each is
+// tagged with ad-status:
+//
+//	never-scanned  enabled in the directory, but no scan has seen it
+//	stale          scans stopped seeing it before --stale-after and the
+//	               directory has no logon since (or the account is
+//	               disabled): likely decommissioned, clean up the entry
+//	disabled       disabled in the directory and never scanned
+//	active         everything else
+//
+// --report prints the never-scanned and stale computers instead of changing
+// anything. The client binds with SECMAN_LDAP_BIND_DN (a DN, or
+// user@domain for AD) and SECMAN_LDAP_PASSWORD over ldaps://, or ldap://
+// upgraded with StartTLS; Kerberos binds are not supported.
+
+// ldapOptions are the flags of discover ldap.
+type ldapOptions struct {
+	url, baseDN, bindDN, filter string
+	staleAfter                  time.Time
+	report                      bool
+}
+
+type ldapFlags struct {
+	url, baseDN, bindDN, filter, staleAfter *string
+	report                                  *bool
+}
+
+func addLDAPFlags(fs *flag.FlagSet) *ldapFlags {
+	return &ldapFlags{
+		url:        fs.String("url", setting("SECMAN_LDAP_URL"), "LDAP server, ldaps://dc.example.com or ldap:// with StartTLS (ldap)"),
+		baseDN:     fs.String("base-dn", setting("SECMAN_LDAP_BASE_DN"), "Search base, e.g. DC=corp,DC=example,DC=com (ldap)"),
+		bindDN:     fs.String("bind-dn", setting("SECMAN_LDAP_BIND_DN"), "Bind DN or user@domain; the password is SECMAN_LDAP_PASSWORD (ldap)"),
+		filter:     fs.String("filter", settingOr("SECMAN_LDAP_FILTER", "(objectCategory=computer)"), "Filter selecting computer objects (ldap)"),
+		staleAfter: fs.String("stale-after", settingOr("SECMAN_LDAP_STALE_AFTER", "90d"), "Age of the last scan and logon after which a computer is stale (ldap)"),
+		report:     fs.Bool("report", false, "Print the never-scanned and stale computers; change nothing (ldap)"),
+	}
+}
+
+func (f *ldapFlags) resolve() ldapOptions {
+	cutoff, err := parseTimeExpr(*f.staleAfter, time.Now())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --stale-after: %v\n", err)
+		exit(ExitUsage)
+	}
+	return ldapOptions{url: *f.url, baseDN: *f.baseDN, bindDN: *f.bindDN, filter: *f.filter, staleAfter: cutoff, report: *f.report}
+}
+
+// ldapDomain turns DC=corp,DC=example,DC=com into corp.example.com.
+func ldapDomain(dn string) string {
+	var labels []string
+	for _, rdn := range strings.Split(dn, ",") {
+		if k, v, ok := strings.Cut(strings.TrimSpace(rdn), "="); ok && strings.EqualFold(k, "dc") {
+			labels = append(labels, strings.ToLower(v))
+		}
+	}
+	return strings.Join(labels, ".")
+}
+
+// ldapGUID formats AD's binary objectGUID, whose first three fields are
+// little-endian.
+func ldapGUID(b []byte) string {
+	if len(b) != 16 {
+		return ""
+	}
+	return fmt.Sprintf("%02x%02x%02x%02x-%02x%02x-%02x%02x-%x-%x",
+		b[3], b[2], b[1], b[0], b[5], b[4], b[7], b[6], b[8:10], b[10:])
+}
+
+// ldapFileTime converts a Windows FILETIME (100 ns since 1601) such as
+// lastLogonTimestamp; zero means never.
+func ldapFileTime(s string) time.Time {
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || v <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(v/10000000-11644473600, 0).UTC()
+}
+
+// ldapComputerKind tells servers from workstations by operatingSystem;
+// computers without a known client OS count as servers.
+func ldapComputerKind(os string) string {
+	lower := strings.ToLower(os)
+	switch {
+	case strings.Contains(lower, "server"):
+		return "server"
+	case strings.Contains(lower, "windows"), strings.Contains(lower, "mac os"), strings.Contains(lower, "macos"):
+		return "workstation"
+	}
+	return "server"
+}
+
+func discoverLDAP(_ *McpClient, scope cloudScope) (*cloudInventory, error) {
+	o := scope.ldap
+	if o.url == "" || o.baseDN == "" {
+		return nil, fmt.Errorf("--url and --base-dn are required (or SECMAN_LDAP_URL and SECMAN_LDAP_BASE_DN)")
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if ca := setting("SECMAN_LDAP_CA"); ca != "" {
+		pem, err := os.ReadFile(ca)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no certificates", ca)
+		}
+	}
+	conn, err := dialLDAP(o.url, tlsConfig, time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	password := setting("SECMAN_LDAP_PASSWORD")
+	registerSecret(password)
+	if err := conn.Bind(o.bindDN, password); err != nil {
+		return nil, fmt.Errorf("bind as %q: %w", o.bindDN, err)
+	}
+	entries, err := conn.Search(o.baseDN, o.filter, []string{
+		"cn", "dNSHostName", "operatingSystem", "operatingSystemVersion", "lastLogonTimestamp",
+		"userAccountControl", "objectGUID", "entryUUID",
+	}, 500)
+	if err != nil {
+		return nil, fmt.Errorf("search %s: %w", o.baseDN, err)
+	}
+
+	domain := ldapDomain(o.baseDN)
+	inv := &cloudInventory{accounts: []string{domain}}
+	// A computer missing from the directory may still be on the network;
+	// --prune leaves assets alone that scans still see.
+	inv.keep = func(asset map[string]interface{}) bool {
+		t, ok := parseServerTime(stringField(asset, "lastSeen"))
+		return ok && t.After(o.staleAfter)
+	}
+	for _, e := range entries {
+		cn := strings.ToLower(e.get("cn"))
+		r := cloudResource{
+			Provider: "ldap", Account: domain, ID: ldapGUID([]byte(e.get("objectGUID"))),
+			Name: strings.ToLower(e.get("dNSHostName")), Kind: ldapComputerKind(e.get("operatingSystem")),
+			State: "enabled",
+			Attrs: map[string]string{
+				"os":    strings.TrimSpace(e.get("operatingSystem") + " " + e.get("operatingSystemVersion")),
+				"ad-dn": e.DN,
+			},
+		}
+		if r.ID == "" {
+			r.ID = e.get("entryUUID")
+		}
+		if r.ID == "" {
+			r.ID = strings.ToLower(e.DN)
+		}
+		if r.Name == "" {
+			r.Name = cn
+		} else if cn != "" && cn != r.Name {
+			r.Aliases = []string{cn}
+		}
+		if uac, err := strconv.Atoi(e.get("userAccountControl")); err == nil && uac&2 != 0 {
+			r.State = "disabled"
+		}
+		if t := ldapFileTime(e.get("lastLogonTimestamp")); !t.IsZero() {
+			r.Attrs["ad-last-logon"] = t.Format("2006-01-02")
+		}
+		if !scope.kinds[r.Kind] || r.Name == "" {
+			continue
+		}
+		inv.resources = append(inv.resources, r)
+	}
+	return inv, nil
+}
+
+// reconcileLDAP sets ad-status from the directory and the assets' last
+// scan.
+func reconcileLDAP(inv *cloudInventory, s *applyState, scope cloudScope) {
+	cutoff := scope.ldap.staleAfter
+	byCloudID := discoveredAssets("ldap", s)
+	counts := map[string]int{}
+	for i := range inv.resources {
+		r := &inv.resources[i]
+		lastSeen := ldapLastScan(*r, s, byCloudID)
+		lastLogon, _ := time.Parse("2006-01-02", r.Attrs["ad-last-logon"])
+		disabled := r.State == "disabled"
+		adStatus := "active"
+		switch {
+		case lastSeen.IsZero() && disabled:
+			adStatus = "disabled"
+		case lastSeen.IsZero():
+			adStatus = "never-scanned"
+		case lastSeen.Before(cutoff) && (disabled || lastLogon.Before(cutoff)):
+			adStatus = "stale"
+		}
+		r.Attrs["ad-status"] = adStatus
+		counts[adStatus]++
+	}
+	status(nil, "%d computer(s) in %s: %d never scanned, %d stale, %d disabled\n",
+		len(inv.resources), strings.Join(inv.accounts, ", "), counts["never-scanned"], counts["stale"], counts["disabled"])
+}
+
+// ldapLastScan is when a scan last saw the asset of a computer, or zero.
+func ldapLastScan(r cloudResource, s *applyState, byCloudID map[string]map[string]interface{}) time.Time {
+	if a := matchDiscovered(r, s, byCloudID); a != nil {
+		if t, ok := parseServerTime(stringField(a, "lastSeen")); ok {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// ldapReport lists the computers that need attention.
+func ldapReport(inv *cloudInventory, s *applyState) map[string]interface{} {
+	byCloudID := discoveredAssets("ldap", s)
+	neverScanned, stale := []map[string]interface{}{}, []map[string]interface{}{}
+	for _, r := range inv.resources {
+		row := map[string]interface{}{
+			"name": r.Name, "dn": r.Attrs["ad-dn"], "os": r.Attrs["os"],
+			"lastLogon": r.Attrs["ad-last-logon"], "lastScan": nil, "enabled": r.State == "enabled",
+		}
+		if t := ldapLastScan(r, s, byCloudID); !t.IsZero() {
+			row["lastScan"] = t.Format("2006-01-02")
+		}
+		switch r.Attrs["ad-status"] {
+		case "never-scanned":
+			neverScanned = append(neverScanned, row)
+		case "stale":
+			stale = append(stale, row)
+		}
+	}
+	return map[string]interface{}{"domain": strings.Join(inv.accounts, ", "), "neverScanned": neverScanned, "stale": stale}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// With --dry-run every call to a mutating tool is validated against the
+// tool's inputSchema and printed instead of sent. Read tools still run, so
+// commands can look up the records they would change.
+
+var mutatingToolPrefixes = []string{
+	"add_", "create_", "update_", "delete_", "remove_", "import_", "submit_",
+	"answer_", "acknowledge_", "start_", "upload_", "complete_", "approve_",
+	"reject_", "assign_", "set_", "send_", "bulk_", "test_email", "cancel_",
+	"deduplicate_", "reconcile_", "refresh_", "finalize_", "notify_",
+	"asset_match_clear", "application_register",
+}
+
+func isMutatingTool(name string) bool {
+	for _, prefix := range mutatingToolPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	for _, pattern := range extraMutatingTools {
+		if matchTool(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// dryRunCall validates and prints a mutating call in place of sending it.
+// current, when known, is the record as it exists on the server and is
+// diffed against the arguments.
+func (c *McpClient) dryRunCall(name string, args, current map[string]interface{}) (*ToolCallResult, error) {
+	def, ok, err := c.Tool(name)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, &ToolNotFoundError{Name: name}
+	}
+	c.dryRunCalls.Add(1)
+
+	problems, warnings := validateArgs(def, args)
+	pauseProgress(func() {
+		fmt.Printf("DRY RUN %s\n", name)
+		if current != nil {
+			printDiff(current, args)
+		} else {
+			keys := sortedArgKeys(args)
+			for _, k := range keys {
+				fmt.Printf("    %s = %s\n", k, dryRunValue(redactField(k, args[k])))
+			}
+		}
+		for _, w := range warnings {
+			fmt.Printf("    ? %s\n", w)
+		}
+		for _, p := range problems {
+			fmt.Printf("    ! %s\n", p)
+		}
+	})
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("dry run: %s: arguments do not match the tool schema", name)
+	}
+	return &ToolCallResult{Content: map[string]interface{}{"dryRun": true}}, nil
+}
+
+// callUpdate calls an update tool; in dry-run mode the change is shown as a
+// diff against current.
+func (c *McpClient) callUpdate(name string, args, current map[string]interface{}) (map[string]interface{}, error) {
+	if c.dryRun {
+		result, err := c.dryRunCall(name, args, current)
+		if err != nil {
+			return nil, err
+		}
+		return result.Content.(map[string]interface{}), nil
+	}
+	return c.callToolMap(name, args)
+}
+
+func printDiff(current, args map[string]interface{}) {
+	for _, k := range sortedArgKeys(args) {
+		before, had := current[k]
+		after := dryRunValue(redactField(k, args[k]))
+		switch {
+		case !had:
+			fmt.Printf("  + %s = %s\n", k, after)
+		case dryRunValue(before) != dryRunValue(args[k]):
+			fmt.Printf("  ~ %s: %s -> %s\n", k, dryRunValue(redactField(k, before)), after)
+		default:
+			fmt.Printf("    %s = %s\n", k, after)
+		}
+	}
+}
+
+func sortedArgKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// dryRunValue renders an argument compactly; large payloads such as
+// base64 chunks are summarized.
+func dryRunValue(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	if len(data) > 120 {
+		return fmt.Sprintf("%s... (%d bytes)", data[:80], len(data))
+	}
+	return string(data)
+}
+
+// validateArgs checks arguments against the JSON schema subset used by
+// Secman tool definitions: required, properties with type and enum, and
+// additionalProperties. Undeclared arguments are only an error when the
+// schema sets additionalProperties to false.
+func validateArgs(def ToolDefinition, args map[string]interface{}) (problems, warnings []string) {
+	schema := def.InputSchema
+	props, _ := schema["properties"].(map[string]interface{})
+
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, r := range required {
+			if name, _ := r.(string); name != "" {
+				if _, set := args[name]; !set {
+					problems = append(problems, fmt.Sprintf("missing required argument %q", name))
+				}
+			}
+		}
+	}
+
+	for _, k := range sortedArgKeys(args) {
+		prop, declared := props[k].(map[string]interface{})
+		if !declared {
+			if extra, ok := schema["additionalProperties"].(bool); ok && !extra {
+				problems = append(problems, fmt.Sprintf("unknown argument %q", k))
+			} else if props != nil {
+				warnings = append(warnings, fmt.Sprintf("argument %q is not declared by the tool", k))
+			}
+			continue
+		}
+		if want, _ := prop["type"].(string); want != "" && !schemaTypeMatches(want, args[k]) {
+			problems = append(problems, fmt.Sprintf("argument %q should be %s, got %s", k, want, dryRunValue(args[k])))
+		}
+		if enum, ok := prop["enum"].([]interface{}); ok && !enumContains(enum, args[k]) {
+			problems = append(problems, fmt.Sprintf("argument %q must be one of %s", k, dryRunValue(enum)))
+		}
+	}
+	return problems, warnings
+}
+
+func schemaTypeMatches(want string, v interface{}) bool {
+	// Normalize Go values (int, []int64, ...) to their JSON form first.
+	var norm interface{}
+	if err := remarshal(v, &norm); err != nil {
+		return false
+	}
+	switch want {
+	case "string":
+		_, ok := norm.(string)
+		return ok
+	case "integer":
+		f, ok := norm.(float64)
+		return ok && f == float64(int64(f))
+	case "number":
+		_, ok := norm.(float64)
+		return ok
+	case "boolean":
+		_, ok := norm.(bool)
+		return ok
+	case "array":
+		_, ok := norm.([]interface{})
+		return ok
+	case "object":
+		_, ok := norm.(map[string]interface{})
+		return ok
+	}
+	return true
+}
+
+func enumContains(enum []interface{}, v interface{}) bool {
+	values := []interface{}{v}
+	if list, ok := v.([]interface{}); ok {
+		values = list
+	} else if list, ok := v.([]string); ok {
+		values = values[:0]
+		for _, s := range list {
+			values = append(values, s)
+		}
+	}
+	for _, val := range values {
+		found := false
+		for _, e := range enum {
+			if fmt.Sprint(e) == fmt.Sprint(val) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// reportDryRun prints the summary line at the end of a dry run.
+func reportDryRun(c *McpClient) {
+	if c.dryRun {
+		fmt.Fprintf(os.Stderr, "Dry run: %d mutating call(s) validated, nothing was sent\n", c.dryRunCalls.Load())
+	}
+}
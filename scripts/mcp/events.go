@@ -0,0 +1,557 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/schmalle/secman/scripts/mcp/config"
+)
+
+// `events publish` polls the server, compares assets and findings with the
+// previous poll and publishes what changed as normalized events:
+//
+//	asset.created     an asset appeared
+//	finding.created   a finding appeared
+//	finding.resolved  a finding is no longer open (fixed, excepted or deleted)
+//
+// Events go to NATS, spoken natively, or to Kafka through a Kafka REST
+// Proxy, since the client has no Kafka wire protocol. Each event type has
+// its own subject or topic: <prefix>.asset.created and so on. The first
+// poll only records the current state, unless --emit-existing is given.
+// The state file holds one small entry per open finding.
+
+// event is the envelope of every published event.
+type event struct {
+	ID     string                 `json:"id"`
+	Type   string                 `json:"type"`
+	Time   time.Time              `json:"time"`
+	Source string                 `json:"source"`
+	Tenant string                 `json:"tenant,omitempty"`
+	Key    string                 `json:"key"`
+	Data   map[string]interface{} `json:"data"`
+}
+
+var eventTypes = []string{"asset.created", "finding.created", "finding.resolved"}
+
+// eventFinding is what the state keeps of an open finding, so that
+// finding.resolved can describe a finding the server no longer returns.
+type eventFinding struct {
+	CVE       string `json:"cve"`
+	AssetID   int64  `json:"assetId"`
+	AssetName string `json:"assetName,omitempty"`
+	Severity  string `json:"severity,omitempty"`
+}
+
+type eventState struct {
+	Initialized bool                   `json:"initialized"`
+	Assets      map[int64]bool         `json:"assets"`
+	Findings    map[int64]eventFinding `json:"findings"`
+}
+
+func eventStatePath() string {
+	if path := setting("SECMAN_EVENTS_STATE"); path != "" {
+		return path
+	}
+	dir, err := config.Dir()
+	if err != nil {
+		return "secman-events-state.json"
+	}
+	return filepath.Join(dir, "events-state.json")
+}
+
+func loadEventState(path string) (*eventState, error) {
+	s := &eventState{Assets: map[int64]bool{}, Findings: map[int64]eventFinding{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if s.Assets == nil {
+		s.Assets = map[int64]bool{}
+	}
+	if s.Findings == nil {
+		s.Findings = map[int64]eventFinding{}
+	}
+	return s, nil
+}
+
+func (s *eventState) save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return writeStateFile(path, data, 0o644)
+}
+
+// diffEvents compares the server's current assets and findings with the
+// state, updates the state and returns the events, assets first.
+func diffEvents(client *McpClient, state *eventState, emit bool) ([]event, error) {
+	assets, err := listAll(client, "get_assets", "assets", map[string]interface{}{}, 500)
+	if err != nil {
+		return nil, err
+	}
+	findings, err := listAll(client, "get_vulnerabilities", "vulnerabilities", map[string]interface{}{}, 500)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []event
+	add := func(typ, key string, data map[string]interface{}) {
+		if emit {
+			events = append(events, newEvent(client, typ, key, data))
+		}
+	}
+
+	sort.Slice(assets, func(i, j int) bool { return numberField(assets[i], "id") < numberField(assets[j], "id") })
+	for _, a := range assets {
+		id := int64(numberField(a, "id"))
+		if !state.Assets[id] {
+			state.Assets[id] = true
+			add("asset.created", fmt.Sprintf("asset:%d", id), a)
+		}
+	}
+
+	open := make(map[int64]bool, len(findings))
+	sort.Slice(findings, func(i, j int) bool { return numberField(findings[i], "id") < numberField(findings[j], "id") })
+	for _, f := range findings {
+		id := int64(numberField(f, "id"))
+		open[id] = true
+		if _, known := state.Findings[id]; known {
+			continue
+		}
+		state.Findings[id] = eventFinding{
+			CVE:       stringField(f, "vulnerabilityId"),
+			AssetID:   int64(numberField(f, "assetId")),
+			AssetName: stringField(f, "assetName"),
+			Severity:  strings.ToUpper(stringField(f, "cvssSeverity")),
+		}
+		add("finding.created", fmt.Sprintf("finding:%d", id), f)
+	}
+
+	var resolved []int64
+	for id := range state.Findings {
+		if !open[id] {
+			resolved = append(resolved, id)
+		}
+	}
+	sort.Slice(resolved, func(i, j int) bool { return resolved[i] < resolved[j] })
+	for _, id := range resolved {
+		f := state.Findings[id]
+		delete(state.Findings, id)
+		add("finding.resolved", fmt.Sprintf("finding:%d", id), map[string]interface{}{
+			"id":              id,
+			"vulnerabilityId": f.CVE,
+			"assetId":         f.AssetID,
+			"assetName":       f.AssetName,
+			"cvssSeverity":    f.Severity,
+		})
+	}
+	state.Initialized = true
+	return events, nil
+}
+
+func newEvent(client *McpClient, typ, key string, data map[string]interface{}) event {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return event{
+		ID:     hex.EncodeToString(id),
+		Type:   typ,
+		Time:   time.Now().UTC(),
+		Source: client.BaseURL,
+		Tenant: client.Tenant,
+		Key:    key,
+		Data:   data,
+	}
+}
+
+// eventSink publishes a batch of events of one type to a topic or subject.
+type eventSink interface {
+	Name() string
+	Publish(topic string, events []event) error
+	Close() error
+}
+
+// natsSink speaks the NATS client protocol: CONNECT, then PUB per event and
+// a PING whose PONG confirms the server processed everything before it.
+// nats:// connects in plain text, tls:// with TLS. Credentials come from
+// the URL or from SECMAN_NATS_TOKEN / SECMAN_NATS_USER and
+// SECMAN_NATS_PASSWORD.
+type natsSink struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dialNATS(rawURL string) (*natsSink, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid NATS URL %q", rawURL)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "4222")
+	}
+
+	var conn net.Conn
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	switch u.Scheme {
+	case "nats":
+		conn, err = dialer.Dial("tcp", host)
+	case "tls":
+		conn, err = tls.DialWithDialer(dialer, "tcp", host, &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12})
+	default:
+		return nil, fmt.Errorf("NATS URL must start with nats:// or tls://, got %q", rawURL)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("nats: %w", err)
+	}
+	s := &natsSink{conn: conn, r: bufio.NewReader(conn)}
+
+	line, err := s.readLine()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		conn.Close()
+		return nil, fmt.Errorf("nats: unexpected greeting %q", line)
+	}
+
+	opts := map[string]interface{}{"verbose": false, "pedantic": false, "name": "secman-mcp", "lang": "go", "version": "1", "protocol": 0}
+	user, pass := setting("SECMAN_NATS_USER"), setting("SECMAN_NATS_PASSWORD")
+	if u.User != nil {
+		user = u.User.Username()
+		if p, ok := u.User.Password(); ok {
+			pass = p
+		} else if pass == "" {
+			// nats://<token>@host is the token form.
+			opts["auth_token"], user = user, ""
+		}
+	}
+	if token := setting("SECMAN_NATS_TOKEN"); token != "" {
+		opts["auth_token"] = token
+	}
+	if user != "" {
+		opts["user"], opts["pass"] = user, pass
+	}
+	for _, k := range []string{"auth_token", "pass"} {
+		if v, ok := opts[k].(string); ok {
+			registerSecret(v)
+		}
+	}
+	connect, _ := json.Marshal(opts)
+	if _, err := fmt.Fprintf(conn, "CONNECT %s\r\n", connect); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("nats: %w", err)
+	}
+	if err := s.flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *natsSink) Name() string { return "nats" }
+
+func (s *natsSink) readLine() (string, error) {
+	s.conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+	line, err := s.r.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("nats: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// flush sends PING and waits for PONG, answering the server's own PINGs.
+// An -ERR reply (bad credentials, permissions) fails the flush.
+func (s *natsSink) flush() error {
+	if _, err := s.conn.Write([]byte("PING\r\n")); err != nil {
+		return fmt.Errorf("nats: %w", err)
+	}
+	for {
+		line, err := s.readLine()
+		if err != nil {
+			return err
+		}
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			s.conn.Write([]byte("PONG\r\n"))
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("nats: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+}
+
+func (s *natsSink) Publish(subject string, events []event) error {
+	w := bufio.NewWriter(s.conn)
+	for _, e := range events {
+		payload, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "PUB %s %d\r\n", subject, len(payload))
+		w.Write(payload)
+		w.WriteString("\r\n")
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("nats: %w", err)
+	}
+	return s.flush()
+}
+
+func (s *natsSink) Close() error { return s.conn.Close() }
+
+// kafkaRESTSink produces through a Kafka REST Proxy (v2 API). Records are
+// keyed by asset or finding, so all events of one record land in the same
+// partition, in order.
+type kafkaRESTSink struct {
+	baseURL  string
+	user     string
+	password string
+	http     *http.Client
+}
+
+func (s *kafkaRESTSink) Name() string { return "kafka" }
+
+func (s *kafkaRESTSink) Publish(topic string, events []event) error {
+	type record struct {
+		Key   string `json:"key"`
+		Value event  `json:"value"`
+	}
+	for start := 0; start < len(events); start += 500 {
+		end := start + 500
+		if end > len(events) {
+			end = len(events)
+		}
+		records := make([]record, 0, end-start)
+		for _, e := range events[start:end] {
+			records = append(records, record{Key: e.Key, Value: e})
+		}
+		if err := s.produce(topic, records); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *kafkaRESTSink) produce(topic string, records interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{"records": records})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.baseURL+"/topics/"+url.PathEscape(topic), strings.NewReader(string(body)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+	if s.user != "" {
+		req.SetBasicAuth(s.user, s.password)
+	}
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("kafka: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var out struct {
+		Offsets []struct {
+			ErrorCode *int   `json:"error_code"`
+			Error     string `json:"error"`
+		} `json:"offsets"`
+		Message string `json:"message"`
+	}
+	json.NewDecoder(resp.Body).Decode(&out)
+	if resp.StatusCode/100 != 2 {
+		return &HTTPError{StatusCode: resp.StatusCode, Body: "kafka: " + out.Message}
+	}
+	// The proxy answers 200 even when single records fail.
+	for _, o := range out.Offsets {
+		if o.ErrorCode != nil {
+			return fmt.Errorf("kafka: topic %s: %s (error code %d)", topic, o.Error, *o.ErrorCode)
+		}
+	}
+	return nil
+}
+
+func (s *kafkaRESTSink) Close() error { return nil }
+
+// dryRunEventSink prints events under --dry-run instead of publishing.
+type dryRunEventSink struct {
+	name   string
+	client *McpClient
+}
+
+func (s *dryRunEventSink) Name() string { return s.name }
+
+func (s *dryRunEventSink) Publish(topic string, events []event) error {
+	for _, e := range events {
+		s.client.dryRunCalls.Add(1)
+		fmt.Printf("DRY RUN %s %s key=%s\n", s.name, topic, e.Key)
+	}
+	return nil
+}
+
+func (s *dryRunEventSink) Close() error { return nil }
+
+func newEventSink(client *McpClient, natsURL, kafkaURL string) (eventSink, error) {
+	name := "nats"
+	if kafkaURL != "" {
+		name = "kafka"
+	}
+	if client.dryRun {
+		return &dryRunEventSink{name: name, client: client}, nil
+	}
+	if natsURL != "" {
+		return dialNATS(natsURL)
+	}
+	s := &kafkaRESTSink{
+		baseURL:  strings.TrimRight(kafkaURL, "/"),
+		user:     setting("SECMAN_KAFKA_REST_USER"),
+		password: setting("SECMAN_KAFKA_REST_PASSWORD"),
+		http:     externalHTTPClient(client, 60*time.Second),
+	}
+	registerSecret(s.password)
+	return s, nil
+}
+
+func cmdEvents(client *McpClient, osArgs []string) {
+	if len(osArgs) > 0 && osArgs[0] == "tail" {
+		cmdEventsTail(client, osArgs[1:])
+		return
+	}
+	if len(osArgs) < 1 || osArgs[0] != "publish" {
+		fmt.Fprintf(os.Stderr, "Usage: %s events publish --nats <url> | --kafka-rest <url> [options]\n", progName())
+		fmt.Fprintf(os.Stderr, "       %s events tail [--nats <url> | --kafka-rest <url>] [options]\n", progName())
+		exit(ExitUsage)
+	}
+
+	fs := flag.NewFlagSet("events publish", flag.ContinueOnError)
+	natsURL := fs.String("nats", setting("SECMAN_NATS_URL"), "NATS server, nats://host:4222 or tls://host:4222")
+	kafkaURL := fs.String("kafka-rest", setting("SECMAN_KAFKA_REST_URL"), "Kafka REST Proxy URL")
+	prefix := fs.String("prefix", settingOr("SECMAN_EVENTS_PREFIX", "secman"), "Subject/topic prefix: <prefix>.finding.created")
+	interval := fs.Duration("interval", 15*time.Minute, "Time between polls")
+	once := fs.Bool("once", false, "Poll once and exit (for cron)")
+	emitExisting := fs.Bool("emit-existing", false, "Publish everything found at the first poll as created")
+	statePath := fs.String("state", eventStatePath(), "State file of known assets and open findings")
+	shutdownTimeout := addShutdownFlag(fs)
+	parseFlags(fs, osArgs[1:])
+
+	if (*natsURL == "") == (*kafkaURL == "") {
+		fmt.Fprintln(os.Stderr, "Error: exactly one of --nats or --kafka-rest is required (or SECMAN_NATS_URL / SECMAN_KAFKA_REST_URL)")
+		exit(ExitUsage)
+	}
+	if *interval < 30*time.Second {
+		fmt.Fprintln(os.Stderr, "Error: --interval must be at least 30s")
+		exit(ExitUsage)
+	}
+	if !client.dryRun {
+		defer holdState(*statePath, "--state")()
+	}
+	state, err := loadEventState(*statePath)
+	if err != nil {
+		fatal(err)
+	}
+
+	// A stop signal lets the poll under way finish publishing and save the
+	// state.
+	g := newRunGroup(*shutdownTimeout)
+	g.Go(func(context.Context) error {
+		for {
+			err := publishEvents(client, state, *statePath, *natsURL, *kafkaURL, *prefix, !state.Initialized && !*emitExisting)
+			switch {
+			case err != nil && *once:
+				return err
+			case err != nil:
+				warnf("%s poll failed: %v\n", time.Now().Format("2006-01-02 15:04:05"), err)
+			}
+			if *once || !g.Sleep(*interval) {
+				return nil
+			}
+		}
+	})
+	if err := g.Wait(); err != nil {
+		fatal(err)
+	}
+}
+
+// publishEvents runs one poll. The state is saved only after every event
+// was accepted, so a failed publish is repeated on the next poll; with
+// keyed records and event ids, consumers can drop the duplicates.
+func publishEvents(client *McpClient, state *eventState, statePath, natsURL, kafkaURL, prefix string, baseline bool) error {
+	next := &eventState{Initialized: state.Initialized, Assets: make(map[int64]bool, len(state.Assets)), Findings: make(map[int64]eventFinding, len(state.Findings))}
+	for k, v := range state.Assets {
+		next.Assets[k] = v
+	}
+	for k, v := range state.Findings {
+		next.Findings[k] = v
+	}
+
+	events, err := diffEvents(client, next, !baseline)
+	if err != nil {
+		return err
+	}
+	counts := map[string]int{}
+	byType := map[string][]event{}
+	for _, e := range events {
+		byType[e.Type] = append(byType[e.Type], e)
+		counts[e.Type]++
+	}
+
+	if len(events) > 0 {
+		sink, err := newEventSink(client, natsURL, kafkaURL)
+		if err != nil {
+			return err
+		}
+		defer sink.Close()
+		for _, typ := range eventTypes {
+			if len(byType[typ]) == 0 {
+				continue
+			}
+			if err := sink.Publish(prefix+"."+typ, byType[typ]); err != nil {
+				return err
+			}
+		}
+	}
+
+	// A dry run leaves the state alone, so the next real poll publishes.
+	if !client.dryRun {
+		if err := next.save(statePath); err != nil {
+			return err
+		}
+		*state = *next
+	}
+	if baseline {
+		status(nil, "%s recorded %d asset(s) and %d open finding(s) as the baseline\n",
+			time.Now().Format("2006-01-02 15:04:05"), len(next.Assets), len(next.Findings))
+		return nil
+	}
+	status(nil, "%s published %d event(s): %d asset.created, %d finding.created, %d finding.resolved\n",
+		time.Now().Format("2006-01-02 15:04:05"), len(events), counts["asset.created"], counts["finding.created"], counts["finding.resolved"])
+	return nil
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/schmalle/secman/scripts/mcp/config"
+)
+
+// `events tail` follows the server's change feed, where it has one: a tool
+// returning the entities changed since a cursor, with the cursor to ask
+// from next. Unlike events publish, which compares snapshots, it sees every
+// change the server records, including updates. Each change is turned into
+// the event envelope of events publish and printed, or forwarded to NATS or
+// Kafka. The cursor is saved after every batch was printed or accepted, so
+// a restarted tail resumes where it stopped.
+
+// changesTools are the change feed tools, in order of preference.
+var changesTools = []string{"get_changes", "list_changes", "get_events", "list_events", "get_change_feed"}
+
+// eventCursor is the saved position in the change feed.
+type eventCursor struct {
+	Source string      `json:"source"`
+	Tenant string      `json:"tenant,omitempty"`
+	Tool   string      `json:"tool"`
+	Cursor interface{} `json:"cursor"`
+	Saved  time.Time   `json:"saved"`
+}
+
+func eventCursorPath() string {
+	if path := setting("SECMAN_EVENTS_CURSOR"); path != "" {
+		return path
+	}
+	dir, err := config.Dir()
+	if err != nil {
+		return "secman-events-cursor.json"
+	}
+	return filepath.Join(dir, "events-cursor.json")
+}
+
+func loadEventCursor(path string) (*eventCursor, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var c eventCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &c, nil
+}
+
+func (c *eventCursor) save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	c.Saved = time.Now().UTC()
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeStateFile(path, data, 0o644)
+}
+
+// changeFeed is the server's change feed tool and the properties it takes.
+type changeFeed struct {
+	tool      string
+	cursorArg string
+	sinceArg  string
+	limitArg  string
+}
+
+func findChangeFeed(client *McpClient) (*changeFeed, error) {
+	for _, name := range changesTools {
+		def, ok, err := client.Tool(name)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		feed := &changeFeed{tool: name}
+		_, props, _ := schemaParams(def)
+		for _, arg := range []string{"cursor", "after", "afterCursor", "sinceCursor", "fromCursor"} {
+			if _, ok := props[arg]; ok {
+				feed.cursorArg = arg
+				break
+			}
+		}
+		for _, arg := range []string{"since", "changedSince", "from"} {
+			if _, ok := props[arg]; ok && arg != feed.cursorArg {
+				feed.sinceArg = arg
+				break
+			}
+		}
+		for _, arg := range []string{"limit", "pageSize", "maxResults", "size"} {
+			if _, ok := props[arg]; ok {
+				feed.limitArg = arg
+				break
+			}
+		}
+		if feed.cursorArg == "" {
+			return nil, fmt.Errorf("%s takes no cursor argument (cursor, after, ...)", name)
+		}
+		return feed, nil
+	}
+	return nil, nil
+}
+
+// changePage is one answer of the change feed.
+type changePage struct {
+	changes []map[string]interface{}
+	next    interface{}
+	more    bool
+}
+
+// fetch asks for the changes after cursor; since applies when there is no
+// cursor yet.
+func (f *changeFeed) fetch(client *McpClient, cursor interface{}, since time.Time, limit int) (*changePage, error) {
+	args := map[string]interface{}{}
+	switch {
+	case cursor != nil:
+		args[f.cursorArg] = cursor
+	case !since.IsZero() && f.sinceArg != "":
+		args[f.sinceArg] = since.Format(time.RFC3339)
+	}
+	if f.limitArg != "" && limit > 0 {
+		args[f.limitArg] = limit
+	}
+	content, err := client.callToolMap(f.tool, args)
+	if err != nil {
+		return nil, err
+	}
+	page := &changePage{next: cursor}
+	for _, key := range []string{"events", "changes", "items", "entries"} {
+		if _, ok := content[key]; ok {
+			page.changes = mapsField(content, key)
+			break
+		}
+	}
+	if page.changes == nil {
+		if _, list := longestList(content); list != nil {
+			for _, item := range list {
+				page.changes = append(page.changes, item.(map[string]interface{}))
+			}
+		}
+	}
+	next, found := firstField(content, "nextCursor", "cursor", "next")
+	if !found && len(page.changes) > 0 {
+		// Without a cursor in the answer, the last change's own cursor or
+		// id is the position.
+		next, found = firstField(page.changes[len(page.changes)-1], "cursor", "sequence", "id")
+	}
+	if found {
+		page.next = next
+	}
+	more, _ := firstField(content, "hasMore", "more")
+	page.more = more == true && len(page.changes) > 0
+	return page, nil
+}
+
+func firstField(m map[string]interface{}, keys ...string) (interface{}, bool) {
+	for _, k := range keys {
+		if v, ok := m[k]; ok && v != nil && v != "" {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// changeEvent turns a change of the feed into the events publish envelope.
+// The type is the change's own type, or <entity>.<action> lowercased, as
+// in finding.updated.
+func changeEvent(client *McpClient, change map[string]interface{}) event {
+	entity := strings.ToLower(firstString(change, "entityType", "entity", "resource", "kind"))
+	typ := firstString(change, "type", "eventType")
+	if typ == "" {
+		action := strings.ToLower(firstString(change, "action", "operation", "change"))
+		typ = strings.Trim(entity+"."+action, ".")
+	}
+	if typ == "" {
+		typ = "change"
+	}
+	if entity == "" {
+		entity, _, _ = strings.Cut(typ, ".")
+	}
+	e := newEvent(client, typ, entity+":"+firstString(change, "entityId", "recordId", "objectId"), nil)
+	if id := firstString(change, "id", "eventId"); id != "" {
+		e.ID = id
+	}
+	if at := firstString(change, "time", "timestamp", "occurredAt", "changedAt"); at != "" {
+		if t, err := time.Parse(time.RFC3339, at); err == nil {
+			e.Time = t.UTC()
+		}
+	}
+	e.Data = change
+	for _, key := range []string{"data", "entity", "payload", "after"} {
+		if m, ok := change[key].(map[string]interface{}); ok {
+			e.Data = m
+			break
+		}
+	}
+	if strings.HasSuffix(e.Key, ":") {
+		if id, ok := firstField(e.Data, "id"); ok {
+			e.Key += fmt.Sprint(id)
+		}
+	}
+	return e
+}
+
+func cmdEventsTail(client *McpClient, osArgs []string) {
+	fs := flag.NewFlagSet("events tail", flag.ContinueOnError)
+	natsURL := fs.String("nats", "", "Forward events to this NATS server instead of printing them")
+	kafkaURL := fs.String("kafka-rest", "", "Forward events through this Kafka REST Proxy instead of printing them")
+	prefix := fs.String("prefix", settingOr("SECMAN_EVENTS_PREFIX", "secman"), "Subject/topic prefix when forwarding: <prefix>.finding.updated")
+	var types stringList
+	fs.Var(&types, "type", "Only pass events of this type or pattern, such as finding.* (repeatable)")
+	interval := fs.Duration("interval", 10*time.Second, "Time between polls once the feed is drained")
+	once := fs.Bool("once", false, "Read the feed up to now and exit")
+	since := fs.String("since", "", "Without a saved cursor, start at this time (7d, 2025-01-01, ...)")
+	fromStart := fs.Bool("from-start", false, "Ignore the saved cursor")
+	batch := fs.Int("batch", 500, "Changes to ask for per call")
+	cursorPath := fs.String("cursor-file", eventCursorPath(), "File the feed position is kept in")
+	asJSON := fs.Bool("json", false, "Print one JSON event per line")
+	shutdownTimeout := addShutdownFlag(fs)
+	parseFlags(fs, osArgs)
+
+	if *natsURL != "" && *kafkaURL != "" {
+		fmt.Fprintln(os.Stderr, "Error: --nats and --kafka-rest cannot be combined")
+		exit(ExitUsage)
+	}
+	if *interval < time.Second {
+		fmt.Fprintln(os.Stderr, "Error: --interval must be at least 1s")
+		exit(ExitUsage)
+	}
+	var start time.Time
+	if *since != "" {
+		t, err := parseTimeExpr(*since, time.Now())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --since: %v\n", err)
+			exit(ExitUsage)
+		}
+		start = t
+	}
+
+	feed, err := findChangeFeed(client)
+	if err != nil {
+		fatal(err)
+	}
+	if feed == nil {
+		fmt.Fprintf(os.Stderr, "Error: the server offers no change feed (%s); use events publish, which compares polls\n", strings.Join(changesTools, ", "))
+		exit(ExitNotFound)
+	}
+	if !start.IsZero() && feed.sinceArg == "" {
+		warnf("Warning: %s takes no start time; --since is ignored\n", feed.tool)
+	}
+
+	if !client.dryRun {
+		defer holdState(*cursorPath, "--cursor-file")()
+	}
+	cursor := &eventCursor{Source: client.BaseURL, Tenant: client.Tenant, Tool: feed.tool}
+	if !*fromStart {
+		saved, err := loadEventCursor(*cursorPath)
+		if err != nil {
+			fatal(err)
+		}
+		switch {
+		case saved == nil:
+		case saved.Source != cursor.Source || saved.Tenant != cursor.Tenant || saved.Tool != cursor.Tool:
+			warnf("Warning: %s belongs to %s (%s); starting without it\n", *cursorPath, saved.Source, saved.Tool)
+		default:
+			cursor.Cursor = saved.Cursor
+		}
+	}
+
+	var sink eventSink
+	if *natsURL != "" || *kafkaURL != "" {
+		if sink, err = newEventSink(client, *natsURL, *kafkaURL); err != nil {
+			fatal(err)
+		}
+	}
+
+	// A stop signal lets the batch under way be delivered and its cursor
+	// saved; the sink is closed last.
+	g := newRunGroup(*shutdownTimeout)
+	if sink != nil {
+		g.OnShutdown("close "+sink.Name(), sink.Close)
+	}
+
+	g.Go(func(context.Context) error {
+		for {
+			page, err := feed.fetch(client, cursor.Cursor, start, *batch)
+			if err == nil {
+				err = deliverChanges(client, page.changes, types, sink, *prefix, *asJSON)
+			}
+			if err == nil && !client.dryRun && fmt.Sprint(page.next) != fmt.Sprint(cursor.Cursor) {
+				cursor.Cursor = page.next
+				err = cursor.save(*cursorPath)
+			}
+			switch {
+			case err != nil && *once:
+				return err
+			case err != nil:
+				warnf("%s %s failed: %v\n", time.Now().Format("2006-01-02 15:04:05"), feed.tool, err)
+			case page.more && g.ctx.Err() == nil:
+				continue
+			case *once:
+				return nil
+			}
+			if !g.Sleep(*interval) {
+				return nil
+			}
+		}
+	})
+	if err := g.Wait(); err != nil {
+		fatal(err)
+	}
+}
+
+// deliverChanges prints or forwards one batch of changes.
+func deliverChanges(client *McpClient, changes []map[string]interface{}, types []string, sink eventSink, prefix string, asJSON bool) error {
+	var events []event
+	for _, change := range changes {
+		e := changeEvent(client, change)
+		if len(types) > 0 && !matchesAnyTool(types, e.Type) {
+			continue
+		}
+		events = append(events, e)
+	}
+	if sink == nil {
+		for _, e := range events {
+			if rawOutput(asJSON) {
+				line, _ := json.Marshal(e)
+				fmt.Println(string(line))
+				continue
+			}
+			fmt.Printf("%s  %-20s %-18s %s\n", e.Time.Local().Format("2006-01-02 15:04:05"), e.Type, e.Key, eventSummary(e.Data))
+		}
+		return nil
+	}
+	// Publish by type in feed order, so each subject or topic sees its
+	// events in order.
+	var order []string
+	byType := map[string][]event{}
+	for _, e := range events {
+		if byType[e.Type] == nil {
+			order = append(order, e.Type)
+		}
+		byType[e.Type] = append(byType[e.Type], e)
+	}
+	for _, typ := range order {
+		if err := sink.Publish(prefix+"."+typ, byType[typ]); err != nil {
+			return err
+		}
+	}
+	if len(events) > 0 {
+		status(nil, "%s forwarded %d event(s) to %s\n", time.Now().Format("2006-01-02 15:04:05"), len(events), sink.Name())
+	}
+	return nil
+}
+
+// eventSummary names the record an event is about.
+func eventSummary(data map[string]interface{}) string {
+	var parts []string
+	for _, key := range []string{"name", "assetName", "hostname", "cve", "vulnerabilityId", "severity", "cvssSeverity", "status"} {
+		if s := stringField(data, key); s != "" {
+			parts = append(parts, s)
+		}
+	}
+	return truncate(strings.Join(parts, " "), 80)
+}
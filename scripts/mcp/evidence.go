@@ -0,0 +1,258 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Evidence files are transferred in base64-encoded chunks so large pentest
+// reports stay well below the server's request size limit. The server-side
+// contract is:
+//
+//	start_evidence_upload    entityType, entityId, fileName, contentType, size, sha256 -> uploadId
+//	upload_evidence_chunk    uploadId, index, data (base64)
+//	complete_evidence_upload uploadId -> evidenceId
+//	list_evidence            entityType, entityId -> evidence[]
+//	get_evidence_chunk       evidenceId, offset, length -> data (base64), eof
+const defaultEvidenceChunkSize = 1 << 20
+
+// evidenceEntityTypes maps the CLI entity prefixes to the server entity types.
+var evidenceEntityTypes = map[string]string{
+	"assessment": "RISK_ASSESSMENT",
+	"exception":  "VULNERABILITY_EXCEPTION",
+	"request":    "EXCEPTION_REQUEST",
+	"finding":    "VULNERABILITY",
+}
+
+func cmdEvidence(client *McpClient, osArgs []string) {
+	if len(osArgs) < 1 {
+		fmt.Fprintln(os.Stderr, "Error: evidence subcommand required")
+		fmt.Fprintf(os.Stderr, "Usage: %s evidence <upload|download|list> ...\n", progName())
+		exit(ExitUsage)
+	}
+
+	switch osArgs[0] {
+	case "upload":
+		cmdEvidenceUpload(client, osArgs[1:])
+	case "download":
+		cmdEvidenceDownload(client, osArgs[1:])
+	case "list":
+		cmdEvidenceList(client, osArgs[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown evidence subcommand: %s\n", osArgs[0])
+		exit(ExitUsage)
+	}
+}
+
+// parseEvidenceEntity parses "assessment:12" style references.
+func parseEvidenceEntity(ref string) (string, int64, error) {
+	kind, idStr, ok := strings.Cut(ref, ":")
+	if !ok {
+		return "", 0, fmt.Errorf("entity must be <type>:<id> (types: assessment, exception, request, finding), got %q", ref)
+	}
+	entityType, ok := evidenceEntityTypes[strings.ToLower(kind)]
+	if !ok {
+		return "", 0, fmt.Errorf("unknown entity type %q (types: assessment, exception, request, finding)", kind)
+	}
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid entity id %q: %w", idStr, err)
+	}
+	return entityType, id, nil
+}
+
+func cmdEvidenceUpload(client *McpClient, osArgs []string) {
+	if len(osArgs) < 2 {
+		fmt.Fprintln(os.Stderr, "Error: entity and file required")
+		fmt.Fprintf(os.Stderr, "Usage: %s evidence upload <assessment|exception|request|finding>:<id> <file> [--chunk-size N]\n", progName())
+		exit(ExitUsage)
+	}
+
+	entityRef, path := osArgs[0], osArgs[1]
+
+	fs := flag.NewFlagSet("evidence upload", flag.ContinueOnError)
+	chunkSize := fs.Int("chunk-size", defaultEvidenceChunkSize, "Chunk size in bytes")
+	description := fs.String("description", "", "Optional description stored with the file")
+	parseFlags(fs, osArgs[2:])
+
+	entityType, entityID, err := parseEvidenceEntity(entityRef)
+	if err != nil {
+		fatal(err)
+	}
+	if *chunkSize <= 0 {
+		fmt.Fprintln(os.Stderr, "Error: --chunk-size must be positive")
+		exit(ExitUsage)
+	}
+
+	evidenceID, err := uploadEvidence(client, entityType, entityID, path, *description, *chunkSize)
+	if err != nil {
+		fatal(err)
+	}
+
+	status(evidenceID, "Uploaded %s as evidence %v\n", filepath.Base(path), evidenceID)
+}
+
+func uploadEvidence(client *McpClient, entityType string, entityID int64, path, description string, chunkSize int) (interface{}, error) {
+	if err := client.requireTool("start_evidence_upload"); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	// Hash first so the server can verify the reassembled file.
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, fmt.Errorf("hash %s: %w", path, err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(path))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	start, err := client.callToolMap("start_evidence_upload", map[string]interface{}{
+		"entityType":  entityType,
+		"entityId":    entityID,
+		"fileName":    filepath.Base(path),
+		"contentType": contentType,
+		"size":        info.Size(),
+		"sha256":      hex.EncodeToString(h.Sum(nil)),
+		"description": description,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if client.dryRun {
+		return "(dry run)", nil
+	}
+	uploadID, ok := start["uploadId"].(string)
+	if !ok || uploadID == "" {
+		return nil, fmt.Errorf("start_evidence_upload returned no uploadId")
+	}
+
+	buf := make([]byte, chunkSize)
+	progress := startProgress("Uploading "+filepath.Base(path), "bytes", info.Size())
+	defer progress.Finish()
+	for index := 0; ; index++ {
+		n, err := io.ReadFull(f, buf)
+		if n > 0 {
+			if _, cerr := client.callToolMap("upload_evidence_chunk", map[string]interface{}{
+				"uploadId": uploadID,
+				"index":    index,
+				"data":     base64.StdEncoding.EncodeToString(buf[:n]),
+			}); cerr != nil {
+				return nil, fmt.Errorf("chunk %d: %w", index, cerr)
+			}
+			progress.Add(int64(n))
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", path, err)
+		}
+	}
+	progress.Finish()
+
+	done, err := client.callToolMap("complete_evidence_upload", map[string]interface{}{
+		"uploadId": uploadID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return done["evidenceId"], nil
+}
+
+func cmdEvidenceDownload(client *McpClient, osArgs []string) {
+	if len(osArgs) < 1 {
+		fmt.Fprintln(os.Stderr, "Error: evidence id required")
+		fmt.Fprintf(os.Stderr, "Usage: %s evidence download <evidenceId> [--output file] [--chunk-size N]\n", progName())
+		exit(ExitUsage)
+	}
+
+	evidenceID, err := strconv.ParseInt(osArgs[0], 10, 64)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid evidence id: %v\n", err)
+		exit(ExitUsage)
+	}
+
+	fs := flag.NewFlagSet("evidence download", flag.ContinueOnError)
+	output := fs.String("output", "", "Output file (default: original file name)")
+	chunkSize := fs.Int("chunk-size", defaultEvidenceChunkSize, "Chunk size in bytes")
+	parseFlags(fs, osArgs[1:])
+
+	path, err := downloadEvidence(client, evidenceID, *output, *chunkSize)
+	if err != nil {
+		fatal(err)
+	}
+
+	status(path, "Saved evidence %d to %s\n", evidenceID, path)
+}
+
+func downloadEvidence(client *McpClient, evidenceID int64, output string, chunkSize int) (string, error) {
+	dir := "."
+	if output != "" {
+		dir, output = dirAndBase(output)
+	}
+	return downloadVerified(dir, output, func(w io.Writer) (string, string, error) {
+		meta, err := chunkedDownload(client, "get_evidence_chunk", map[string]interface{}{
+			"evidenceId": evidenceID,
+		}, chunkSize, w)
+		if err != nil {
+			return "", "", err
+		}
+		name, _ := meta["fileName"].(string)
+		if name == "" {
+			name = fmt.Sprintf("evidence-%d", evidenceID)
+		}
+		checksum, _ := meta["sha256"].(string)
+		return name, checksum, nil
+	})
+}
+
+func cmdEvidenceList(client *McpClient, osArgs []string) {
+	if len(osArgs) < 1 {
+		fmt.Fprintln(os.Stderr, "Error: entity required")
+		fmt.Fprintf(os.Stderr, "Usage: %s evidence list <assessment|exception|request|finding>:<id>\n", progName())
+		exit(ExitUsage)
+	}
+
+	entityType, entityID, err := parseEvidenceEntity(osArgs[0])
+	if err != nil {
+		fatal(err)
+	}
+	if err := client.requireTool("list_evidence"); err != nil {
+		fatal(err)
+	}
+
+	result, err := client.CallTool("list_evidence", map[string]interface{}{
+		"entityType": entityType,
+		"entityId":   entityID,
+	})
+	if err != nil {
+		fatal(err)
+	}
+
+	printResult(result)
+}
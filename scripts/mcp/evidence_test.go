@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestUploadEvidenceDryRun(t *testing.T) {
+	srv := newFakeServer(t, map[string]fakeTool{
+		"start_evidence_upload": func(map[string]interface{}) (interface{}, error) {
+			return map[string]interface{}{"uploadId": "u1"}, nil
+		},
+		"upload_evidence_chunk":    func(map[string]interface{}) (interface{}, error) { return map[string]interface{}{}, nil },
+		"complete_evidence_upload": func(map[string]interface{}) (interface{}, error) { return map[string]interface{}{"evidenceId": 9}, nil },
+	})
+	path := filepath.Join(t.TempDir(), "ev.txt")
+	if err := os.WriteFile(path, []byte("firewall export"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	client := srv.client()
+	client.dryRun = true
+	id, err := uploadEvidence(client, "FINDING", 1, path, "", defaultEvidenceChunkSize)
+	if err != nil {
+		t.Fatalf("dry-run upload: %v", err)
+	}
+	if id != "(dry run)" {
+		t.Errorf("evidence id = %v, want (dry run)", id)
+	}
+	if calls := srv.called(); len(calls) != 0 {
+		t.Errorf("dry run sent %v", calls)
+	}
+
+	client = srv.client()
+	id, err = uploadEvidence(client, "FINDING", 1, path, "", 4)
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	if id != float64(9) {
+		t.Errorf("evidence id = %v, want 9", id)
+	}
+	want := []string{"start_evidence_upload", "upload_evidence_chunk", "upload_evidence_chunk",
+		"upload_evidence_chunk", "upload_evidence_chunk", "complete_evidence_upload"}
+	if calls := srv.called(); !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Exit codes. Shell pipelines and CI steps can branch on these instead of
+// parsing stderr.
+const (
+	ExitOK          = 0 // success
+	ExitUsage       = 1 // usage error or any failure not covered below
+	ExitAuth        = 2 // missing/invalid API key, delegation or permission denied
+	ExitNotFound    = 3 // record or tool does not exist
+	ExitRateLimited = 4 // the server's rate limit was hit
+	ExitGateFailed  = 5 // a check/gate command ran and its condition failed
+	ExitPartial     = 6 // some items succeeded, some failed
+)
+
+// exit terminates the process. The interactive shell replaces it so that a
+// failing command returns to the prompt instead of ending the session.
+var exit = os.Exit
+
+// ToolNotFoundError is returned when the server does not advertise a tool.
+type ToolNotFoundError struct {
+	Name string
+}
+
+func (e *ToolNotFoundError) Error() string {
+	return fmt.Sprintf("server does not expose the %s tool", e.Name)
+}
+
+// exitCode maps an error to the exit code of its failure class.
+func exitCode(err error) int {
+	var toolErr *ToolNotFoundError
+	if errors.As(err, &toolErr) {
+		return ExitNotFound
+	}
+
+	var readOnlyErr *ReadOnlyError
+	if errors.As(err, &readOnlyErr) {
+		return ExitAuth
+	}
+
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		switch httpErr.StatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return ExitAuth
+		case http.StatusNotFound:
+			return ExitNotFound
+		case http.StatusTooManyRequests:
+			return ExitRateLimited
+		}
+	}
+
+	var rpcErr *JSONRPCError
+	if errors.As(err, &rpcErr) {
+		return rpcExitCode(string(rpcErr.Code))
+	}
+	return ExitUsage
+}
+
+// rpcExitCode classifies the string error codes of /api/mcp/tools/call and
+// the numeric codes of the streamable endpoint.
+func rpcExitCode(code string) int {
+	switch code {
+	case "RATE_LIMITED", "-32006":
+		return ExitRateLimited
+	case "TOOL_NOT_FOUND", "-32005", "-32601":
+		return ExitNotFound
+	case "AUTH_REQUIRED", "AUTH_FAILED", "PERMISSION_DENIED", "FORBIDDEN", "ADMIN_REQUIRED",
+		"ADMIN_ROLE_REQUIRED", "INSUFFICIENT_ROLE", "-32001", "-32002", "-32003", "-32007":
+		return ExitAuth
+	}
+	switch {
+	case strings.HasPrefix(code, "DELEGATION_"):
+		return ExitAuth
+	case code == "NOT_FOUND" || strings.HasSuffix(code, "_NOT_FOUND"):
+		return ExitNotFound
+	}
+	return ExitUsage
+}
+
+// fatal prints the error and exits with the code of its failure class.
+func fatal(err error) {
+	pauseProgress(func() { fmt.Fprintf(os.Stderr, "%s %s\n", paintErr(styleFail, "Error:"), redactString(err.Error())) })
+	exit(exitCode(err))
+}
+
+// parseFlags parses a command's flags, exiting with ExitUsage on bad flags
+// (the flag package's ExitOnError would use 2, which means auth failure).
+func parseFlags(fs *flag.FlagSet, args []string) {
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			exit(ExitOK)
+		}
+		exit(ExitUsage)
+	}
+}
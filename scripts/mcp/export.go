@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/schmalle/secman/scripts/mcp/secman"
+)
+
+// export csv streams a paginated list tool to CSV: each page is written as
+// soon as it arrives, so memory stays flat however large the dataset is.
+// The columns are --columns, or every key of the first page's records;
+// keys that only appear later are not exported.
+
+// exportDataset is a paginated list tool export csv can stream.
+type exportDataset struct {
+	tool, listKey string
+	pageSize      int
+}
+
+var exportDatasets = map[string]exportDataset{
+	"assets":                 {"get_assets", "assets", 500},
+	"assets-detail":          {"get_all_assets_detail", "assets", 500},
+	"vulnerabilities":        {"get_vulnerabilities", "vulnerabilities", 500},
+	"vulnerabilities-detail": {"get_all_vulnerabilities_detail", "vulnerabilities", 500},
+	"scans":                  {"get_scans", "scans", 500},
+	"user-mappings":          {"list_user_mappings", "mappings", 100},
+}
+
+func exportDatasetNames() []string {
+	names := make([]string, 0, len(exportDatasets))
+	for name := range exportDatasets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func cmdExport(client *McpClient, osArgs []string) {
+	if len(osArgs) < 1 {
+		fmt.Fprintln(os.Stderr, "Error: export format required")
+		fmt.Fprintf(os.Stderr, "Usage: %s export <csv|manifests> ...\n", progName())
+		exit(ExitUsage)
+	}
+	switch osArgs[0] {
+	case "csv":
+		cmdExportCSV(client, osArgs[1:])
+	case "manifests":
+		cmdExportManifests(client, osArgs[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown export format: %s (use csv or manifests)\n", osArgs[0])
+		exit(ExitUsage)
+	}
+}
+
+func cmdExportCSV(client *McpClient, osArgs []string) {
+	if len(osArgs) < 1 || strings.HasPrefix(osArgs[0], "-") {
+		fmt.Fprintln(os.Stderr, "Error: dataset required ("+strings.Join(exportDatasetNames(), ", ")+")")
+		fmt.Fprintf(os.Stderr, "Usage: %s export csv <dataset> [--args '{...}'] [--columns a,b] [--output file]\n", progName())
+		exit(ExitUsage)
+	}
+	dataset, ok := exportDatasets[osArgs[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: unknown dataset %q (use %s)\n", osArgs[0], strings.Join(exportDatasetNames(), ", "))
+		exit(ExitUsage)
+	}
+
+	fs := flag.NewFlagSet("export csv", flag.ContinueOnError)
+	argsJSON := fs.String("args", "{}", "Filter arguments of the list tool as JSON, e.g. '{\"severity\":[\"Critical\"]}'")
+	columns := fs.String("columns", "", "Comma-separated columns (default: every field of the first page)")
+	output := fs.String("output", "", "CSV file to write (default: stdout)")
+	noHeader := fs.Bool("no-header", false, "Omit the header row")
+	sign := addSignFlag(fs)
+	dest := addDestinationFlags(fs)
+	parseFlags(fs, osArgs[1:])
+
+	var args map[string]interface{}
+	if err := json.Unmarshal([]byte(*argsJSON), &args); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid --args JSON: %v\n", err)
+		exit(ExitUsage)
+	}
+	if *output == "" && (*sign != "" || *dest.url != "") {
+		fmt.Fprintln(os.Stderr, "Error: --sign and --destination need --output")
+		exit(ExitUsage)
+	}
+	if err := client.requireTool(dataset.tool); err != nil {
+		fatal(err)
+	}
+
+	var w io.Writer = os.Stdout
+	var tmp *os.File
+	if *output != "" {
+		f, err := os.Create(*output + ".part")
+		if err != nil {
+			fatal(err)
+		}
+		tmp, w = f, f
+	}
+	n, err := streamCSV(client, dataset, args, splitList(*columns), !*noHeader, w)
+	if tmp != nil {
+		if cerr := tmp.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(tmp.Name())
+		} else {
+			err = os.Rename(tmp.Name(), *output)
+		}
+	}
+	if err != nil {
+		fatal(err)
+	}
+
+	if *output != "" {
+		status(*output, "Wrote %d row(s) to %s\n", n, *output)
+		signOutput(client, *output, *sign)
+		uploadOutput(client, *output, *sign != "", dest)
+	}
+}
+
+// streamCSV writes the records of dataset as CSV page by page and returns
+// the number of rows written.
+func streamCSV(client *McpClient, dataset exportDataset, args map[string]interface{}, columns []string, header bool, w io.Writer) (int, error) {
+	progress := startProgress("Exporting "+dataset.listKey, "pages", 0)
+	defer progress.Finish()
+
+	pager := secman.Pages(context.Background(), client, dataset.tool, dataset.listKey, args, dataset.pageSize)
+	pager.OnPage = func(totalPages int) {
+		progress.SetTotal(int64(totalPages))
+		progress.Add(1)
+	}
+	cw := csv.NewWriter(w)
+	rows := 0
+	for pager.Next() {
+		item := pager.Item()
+		if rows == 0 {
+			if columns == nil {
+				columns = pageColumns(pager.PageItems())
+			}
+			if header {
+				cw.Write(columns)
+			}
+		}
+		row := make([]string, len(columns))
+		for i, c := range columns {
+			row[i] = cellText(item[c])
+		}
+		cw.Write(row)
+		rows++
+		// Write each page out before the next one is fetched.
+		if pager.EndOfPage() {
+			cw.Flush()
+			if err := cw.Error(); err != nil {
+				return rows, err
+			}
+		}
+	}
+	if err := pager.Err(); err != nil {
+		return rows, err
+	}
+	if rows == 0 && header && columns != nil {
+		cw.Write(columns)
+	}
+	cw.Flush()
+	return rows, cw.Error()
+}
+
+// pageColumns returns every key of the records, ordered like table output.
+func pageColumns(items []map[string]interface{}) []string {
+	seen := map[string]bool{}
+	var columns []string
+	for _, item := range items {
+		for k := range item {
+			if !seen[k] {
+				seen[k] = true
+				columns = append(columns, k)
+			}
+		}
+	}
+	sortColumns(columns)
+	return columns
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// fakeTool answers a tools/call. A toolError is returned as a result with
+// isError set; an httpStatus as that HTTP status.
+type fakeTool func(args map[string]interface{}) (interface{}, error)
+
+type toolError string
+
+func (e toolError) Error() string { return string(e) }
+
+type httpStatus int
+
+func (s httpStatus) Error() string { return http.StatusText(int(s)) }
+
+// fakeServer is a Secman MCP endpoint for tests: capabilities lists the
+// tools, tools/call runs them, and other paths go to routes.
+type fakeServer struct {
+	*httptest.Server
+	tools  map[string]fakeTool
+	routes map[string]http.HandlerFunc
+
+	mu    sync.Mutex
+	calls []string
+}
+
+func newFakeServer(t *testing.T, tools map[string]fakeTool) *fakeServer {
+	t.Helper()
+	s := &fakeServer{tools: tools, routes: map[string]http.HandlerFunc{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// client returns a client of the server.
+func (s *fakeServer) client() *McpClient {
+	return NewMcpClient(s.URL, "test-key", "")
+}
+
+// called returns the names of the tools called so far, in order.
+func (s *fakeServer) called() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.calls...)
+}
+
+func (s *fakeServer) serve(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/api/mcp/capabilities":
+		var caps CapabilitiesResponse
+		for name := range s.tools {
+			caps.Capabilities.Tools = append(caps.Capabilities.Tools, ToolDefinition{Name: name})
+		}
+		json.NewEncoder(w).Encode(caps)
+	case "/api/mcp/tools/call":
+		var req struct {
+			ID     string         `json:"id"`
+			Params ToolCallParams `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.mu.Lock()
+		s.calls = append(s.calls, req.Params.Name)
+		s.mu.Unlock()
+		tool, ok := s.tools[req.Params.Name]
+		if !ok {
+			json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID,
+				"error": map[string]interface{}{"code": -32601, "message": "tool not found: " + req.Params.Name}})
+			return
+		}
+		content, err := tool(req.Params.Arguments)
+		result := ToolCallResult{Content: content}
+		switch err := err.(type) {
+		case nil:
+		case httpStatus:
+			w.WriteHeader(int(err))
+			return
+		default:
+			result = ToolCallResult{Content: err.Error(), IsError: true}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result})
+	default:
+		if route, ok := s.routes[r.URL.Path]; ok {
+			route(w, r)
+			return
+		}
+		http.NotFound(w, r)
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/schmalle/secman/scripts/mcp/config"
+)
+
+// Federation lets read commands query several Secman deployments at once.
+// Instances are configured as
+//
+//	SECMAN_INSTANCES=prod=https://secman.eu.example.com,dr=https://secman-dr.example.com
+//
+// with per-instance credentials in SECMAN_MCP_KEY_<NAME> and
+// SECMAN_USER_EMAIL_<NAME>, falling back to SECMAN_MCP_KEY and
+// SECMAN_USER_EMAIL.
+
+type Instance struct {
+	Name   string
+	Client *McpClient
+}
+
+// instanceSelection holds the --all-instances / --instances flags of a
+// read command.
+type instanceSelection struct {
+	all   *bool
+	names *string
+}
+
+func addInstanceFlags(fs *flag.FlagSet) *instanceSelection {
+	return &instanceSelection{
+		all:   fs.Bool("all-instances", false, "Query every instance in SECMAN_INSTANCES and merge the results"),
+		names: fs.String("instances", "", "Comma-separated instance names from SECMAN_INSTANCES to query"),
+	}
+}
+
+func (s *instanceSelection) active() bool {
+	return *s.all || *s.names != ""
+}
+
+// loadInstances builds a client per configured instance. Tenant, custom
+// headers and strict TLS are taken from the primary client; pins come from
+// SECMAN_TLS_PIN_<NAME>, falling back to SECMAN_TLS_PIN.
+func loadInstances(primary *McpClient) ([]Instance, error) {
+	spec := setting("SECMAN_INSTANCES")
+	if spec == "" {
+		return nil, fmt.Errorf("SECMAN_INSTANCES is not set (format: name=url,name=url)")
+	}
+
+	var instances []Instance
+	seen := map[string]bool{}
+	for _, entry := range splitList(spec) {
+		name, url, ok := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || url == "" {
+			return nil, fmt.Errorf("invalid SECMAN_INSTANCES entry %q (want name=url)", entry)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate instance %q in SECMAN_INSTANCES", name)
+		}
+		seen[name] = true
+
+		suffix := "_" + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(name))
+		apiKey := settingOr("SECMAN_MCP_KEY"+suffix, setting("SECMAN_MCP_KEY"))
+		if apiKey == "" {
+			return nil, fmt.Errorf("no API key for instance %s (set SECMAN_MCP_KEY%s)", name, suffix)
+		}
+		userEmail := settingOr("SECMAN_USER_EMAIL"+suffix, setting("SECMAN_USER_EMAIL"))
+		url = strings.TrimSpace(url)
+		opts := []ClientOption{WithHeaders(primary.Headers)}
+		if primary.strictTLS {
+			if err := checkStrictURL(url); err != nil {
+				return nil, fmt.Errorf("instance %s: %w", name, err)
+			}
+			pins, err := parsePins(settingOr("SECMAN_TLS_PIN"+suffix, setting("SECMAN_TLS_PIN")))
+			if err != nil {
+				return nil, fmt.Errorf("instance %s: %w", name, err)
+			}
+			opts = append(opts, WithStrictTLS(pins))
+		}
+		client := NewMcpClient(url, apiKey, userEmail, opts...)
+		client.Tenant = primary.Tenant
+		instances = append(instances, Instance{Name: name, Client: client})
+	}
+	return instances, nil
+}
+
+// profileClient builds a client from another profile of the config file,
+// for commands that compare deployments. Flags do not apply to it, but the
+// environment and the env file still override the profile, as they do for
+// the active one; that is reported when it makes the server the same.
+func profileClient(primary *McpClient, name string) (*McpClient, error) {
+	cfg, err := config.Load(config.Options{EnvFile: settings.EnvFile, Profile: name, Defaults: settingDefaults})
+	if err != nil {
+		return nil, err
+	}
+	cfg.EnvFileFound = settings.EnvFileFound
+	if err := cfg.CheckKeyDestination(); err != nil {
+		return nil, err
+	}
+	baseURL, source, _ := cfg.Lookup("SECMAN_BASE_URL")
+	if source != config.SourceProfile {
+		warnf("Warning: profile %s: SECMAN_BASE_URL %s comes from the %s, not the profile\n", name, baseURL, source)
+	}
+	apiKey := cfg.Get("SECMAN_MCP_KEY")
+	if apiKey == "" {
+		return nil, fmt.Errorf("profile %s: no SECMAN_MCP_KEY", name)
+	}
+	registerSecret(apiKey)
+	opts := []ClientOption{WithHeaders(primary.Headers)}
+	if pinSpec := cfg.Get("SECMAN_TLS_PIN"); primary.strictTLS || pinSpec != "" || cfg.Get("SECMAN_STRICT_TLS") == "true" {
+		if err := checkStrictURL(baseURL); err != nil {
+			return nil, fmt.Errorf("profile %s: %w", name, err)
+		}
+		pins, err := parsePins(pinSpec)
+		if err != nil {
+			return nil, fmt.Errorf("profile %s: %w", name, err)
+		}
+		opts = append(opts, WithStrictTLS(pins))
+	}
+	client := NewMcpClient(baseURL, apiKey, cfg.Get("SECMAN_USER_EMAIL"), opts...)
+	client.Tenant = cfg.Get("SECMAN_TENANT")
+	return client, nil
+}
+
+// resolve returns the instances picked by the flags, in configuration order.
+// The tenant and headers of the primary client apply to every instance.
+func (s *instanceSelection) resolve(primary *McpClient) ([]Instance, error) {
+	instances, err := loadInstances(primary)
+	if err != nil || *s.all {
+		return instances, err
+	}
+
+	byName := map[string]Instance{}
+	for _, inst := range instances {
+		byName[inst.Name] = inst
+	}
+	var picked []Instance
+	for _, name := range splitList(*s.names) {
+		inst, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown instance %q (configured: %s)", name, strings.Join(instanceNames(instances), ", "))
+		}
+		picked = append(picked, inst)
+	}
+	return picked, nil
+}
+
+func instanceNames(instances []Instance) []string {
+	names := make([]string, len(instances))
+	for i, inst := range instances {
+		names[i] = inst.Name
+	}
+	return names
+}
+
+// runRead calls a read tool on the configured server, or on every selected
+// instance in parallel, and prints the result.
+func runRead(client *McpClient, sel *instanceSelection, tool string, args map[string]interface{}) {
+	if !sel.active() {
+		result, err := client.CallTool(tool, args)
+		if err != nil {
+			fatal(err)
+		}
+		printResult(result)
+		return
+	}
+
+	instances, err := sel.resolve(client)
+	if err != nil {
+		fatal(err)
+	}
+
+	merged, errs := federatedCall(instances, tool, args)
+	printResult(merged)
+	switch {
+	case len(errs) == len(instances):
+		exit(exitCode(errs[0]))
+	case len(errs) > 0:
+		exit(ExitPartial)
+	}
+}
+
+// federatedCall fans the tool call out to all instances and merges the
+// results: every list of objects is concatenated with an "instance" field
+// added to each item, and numeric totals are summed. Per-instance status is
+// reported under "instances"; the errors of failed instances are returned.
+func federatedCall(instances []Instance, tool string, args map[string]interface{}) (map[string]interface{}, []error) {
+	type outcome struct {
+		content map[string]interface{}
+		err     error
+	}
+	outcomes := make([]outcome, len(instances))
+
+	var wg sync.WaitGroup
+	for i, inst := range instances {
+		wg.Add(1)
+		go func(i int, inst Instance) {
+			defer wg.Done()
+			content, err := inst.Client.callToolMap(tool, args)
+			outcomes[i] = outcome{content, err}
+		}(i, inst)
+	}
+	wg.Wait()
+
+	merged := map[string]interface{}{}
+	var status []map[string]interface{}
+	var errs []error
+	for i, inst := range instances {
+		o := outcomes[i]
+		entry := map[string]interface{}{"instance": inst.Name, "baseUrl": inst.Client.BaseURL}
+		if inst.Client.Tenant != "" {
+			entry["tenant"] = inst.Client.Tenant
+		}
+		if o.err != nil {
+			errs = append(errs, o.err)
+			entry["error"] = o.err.Error()
+			fmt.Fprintf(os.Stderr, "Warning: instance %s: %s\n", inst.Name, redactString(o.err.Error()))
+			status = append(status, entry)
+			continue
+		}
+		mergeInstanceContent(merged, inst.Name, o.content)
+		entry["ok"] = true
+		status = append(status, entry)
+	}
+	merged["instances"] = status
+	return merged, errs
+}
+
+func mergeInstanceContent(merged map[string]interface{}, instance string, content map[string]interface{}) {
+	keys := make([]string, 0, len(content))
+	for k := range content {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		switch v := content[k].(type) {
+		case []interface{}:
+			list, _ := merged[k].([]interface{})
+			for _, item := range v {
+				if m, ok := item.(map[string]interface{}); ok {
+					m["instance"] = instance
+				}
+				list = append(list, item)
+			}
+			merged[k] = list
+		case float64:
+			// Page-relative values do not add up across instances.
+			if k == "page" || k == "pageSize" || k == "size" || k == "totalPages" {
+				continue
+			}
+			sum, _ := merged[k].(float64)
+			merged[k] = sum + v
+		}
+	}
+}
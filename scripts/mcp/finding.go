@@ -0,0 +1,399 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// finding create logs a manual finding, such as one from a penetration
+// test, on one or more assets: one add_vulnerability call per asset, then
+// the evidence files attached to each created finding. Values not given as
+// flags are asked for when stdin is a terminal, with a CVSS v3.1
+// calculator for the score and a filterable list to pick the assets from,
+// so a consultant can log findings during an engagement without the web
+// UI. Without a terminal the flags must say everything.
+//
+// Manual findings rarely have a CVE. add_vulnerability needs an
+// identifier all the same, so without --id the finding is named PT- and
+// the title, e.g. PT-SQL-INJECTION-IN-LOGIN-FORM; logging it again updates
+// the same finding.
+
+// findingSeverities are the criticalities add_vulnerability takes.
+var findingSeverities = []string{"CRITICAL", "HIGH", "MEDIUM", "LOW"}
+
+var findingSlugPattern = regexp.MustCompile(`[^A-Z0-9]+`)
+
+// findingID derives an identifier from a title.
+func findingID(title string) string {
+	slug := strings.Trim(findingSlugPattern.ReplaceAllString(strings.ToUpper(title), "-"), "-")
+	if len(slug) > 60 {
+		slug = strings.TrimRight(slug[:60], "-")
+	}
+	return "PT-" + slug
+}
+
+// prompter asks for values on stderr and reads the answers from stdin.
+type prompter struct {
+	in *bufio.Reader
+}
+
+// ask reads one answer, returning def for an empty one or at end of input.
+func (p *prompter) ask(label, def string) string {
+	if def != "" {
+		fmt.Fprintf(os.Stderr, "%s [%s]: ", label, def)
+	} else {
+		fmt.Fprintf(os.Stderr, "%s: ", label)
+	}
+	line, err := p.in.ReadString('\n')
+	if line = strings.TrimSpace(line); line == "" {
+		if err == io.EOF {
+			fmt.Fprintln(os.Stderr)
+		}
+		return def
+	}
+	return line
+}
+
+// askRequired asks until the answer is not empty; at end of input it
+// gives up.
+func (p *prompter) askRequired(label string) string {
+	for {
+		if answer := p.ask(label, ""); answer != "" {
+			return answer
+		}
+		if _, err := p.in.Peek(1); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s is required\n", strings.ToLower(label))
+			exit(ExitUsage)
+		}
+	}
+}
+
+// askCVSS builds a vector one metric at a time.
+func (p *prompter) askCVSS() map[string]string {
+	codes := map[string]string{}
+	for _, m := range cvssMetrics {
+		var choices []string
+		for _, v := range m.values {
+			choices = append(choices, v.code+"="+v.name)
+		}
+		for {
+			answer := strings.ToUpper(p.ask(fmt.Sprintf("  %s (%s)", m.name, strings.Join(choices, ", ")), m.values[0].code))
+			if _, ok := m.weight(answer); ok {
+				codes[m.key] = answer
+				break
+			}
+			fmt.Fprintf(os.Stderr, "  %q is not one of %s\n", answer, strings.Join(choices, ", "))
+		}
+	}
+	return codes
+}
+
+// askAssets lets the user pick assets from a numbered list. "/text" narrows
+// the list to assets whose name, IP or owner contains text; anything that
+// is not a number is taken as the hostname of an asset to pick or create.
+func (p *prompter) askAssets(assets []map[string]interface{}) []string {
+	const shown = 30
+	filter := ""
+	for {
+		var matches []map[string]interface{}
+		for _, a := range assets {
+			text := strings.ToLower(stringField(a, "name") + " " + stringField(a, "ip") + " " + stringField(a, "owner"))
+			if strings.Contains(text, strings.ToLower(filter)) {
+				matches = append(matches, a)
+			}
+		}
+		for i, a := range matches {
+			if i == shown {
+				fmt.Fprintf(os.Stderr, "  ... %d more; type /text to narrow the list\n", len(matches)-shown)
+				break
+			}
+			fmt.Fprintf(os.Stderr, "  %3d  %-30s %-16s %s\n", i+1, truncate(stringField(a, "name"), 30), stringField(a, "ip"), stringField(a, "owner"))
+		}
+		answer := p.ask("Assets (numbers such as 1,3-5, /text to filter, or hostnames)", "")
+		if strings.HasPrefix(answer, "/") {
+			filter = strings.TrimSpace(answer[1:])
+			continue
+		}
+		var names []string
+		valid := true
+		for _, token := range strings.FieldsFunc(answer, func(r rune) bool { return r == ',' || r == ' ' }) {
+			from, to, isRange := strings.Cut(token, "-")
+			first, errFrom := strconv.Atoi(from)
+			last, errTo := strconv.Atoi(to)
+			if !isRange {
+				last, errTo = first, errFrom
+			}
+			if errFrom != nil || errTo != nil {
+				names = append(names, token)
+				continue
+			}
+			if first < 1 || last > len(matches) || last > shown || first > last {
+				fmt.Fprintf(os.Stderr, "  %s is not in the list\n", token)
+				valid = false
+				break
+			}
+			for i := first; i <= last; i++ {
+				names = append(names, stringField(matches[i-1], "name"))
+			}
+		}
+		if valid && len(names) > 0 {
+			return names
+		}
+		if _, err := p.in.Peek(1); err != nil {
+			fmt.Fprintln(os.Stderr, "Error: no assets selected")
+			exit(ExitUsage)
+		}
+	}
+}
+
+// createdFinding is a finding finding create logged on one asset.
+type createdFinding struct {
+	ID              interface{}   `json:"id"`
+	VulnerabilityID string        `json:"vulnerabilityId"`
+	Hostname        string        `json:"hostname"`
+	AssetID         interface{}   `json:"assetId,omitempty"`
+	AssetCreated    bool          `json:"assetCreated"`
+	Evidence        []interface{} `json:"evidence,omitempty"`
+}
+
+func cmdFinding(client *McpClient, osArgs []string) {
+	if len(osArgs) < 1 {
+		fmt.Fprintln(os.Stderr, "Error: finding subcommand required")
+		fmt.Fprintf(os.Stderr, "Usage: %s finding create ...\n", progName())
+		exit(ExitUsage)
+	}
+	switch osArgs[0] {
+	case "create":
+		cmdFindingCreate(client, osArgs[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown finding subcommand: %s\n", osArgs[0])
+		exit(ExitUsage)
+	}
+}
+
+func cmdFindingCreate(client *McpClient, osArgs []string) {
+	fs := flag.NewFlagSet("finding create", flag.ContinueOnError)
+	title := fs.String("title", "", "Title of the finding")
+	id := fs.String("id", "", "CVE or identifier of the finding (default: PT- and the title)")
+	vector := fs.String("cvss", "", "CVSS v3.1 vector, e.g. CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H")
+	severity := fs.String("severity", "", "CRITICAL, HIGH, MEDIUM or LOW (default: from --cvss)")
+	description := fs.String("description", "", "Description, e.g. the steps to reproduce")
+	scanner := fs.String("scanner", "pentest", "Source recorded with the finding")
+	owner := fs.String("owner", "", "Owner of assets that do not exist yet and are created")
+	var assetArgs, evidenceArgs stringList
+	fs.Var(&assetArgs, "asset", "Affected asset by hostname or id (repeatable)")
+	fs.Var(&evidenceArgs, "evidence", "File to attach as evidence, e.g. a screenshot (repeatable)")
+	yes := addYesFlag(fs)
+	asJSON := fs.Bool("json", false, "Print the created findings as JSON")
+	parseFlags(fs, osArgs)
+
+	var p *prompter
+	if isInteractive() {
+		p = &prompter{in: bufio.NewReader(os.Stdin)}
+	}
+	usage := "Usage: " + progName() + " finding create --title text --asset host... (--cvss vector | --severity S) [--id CVE] [--evidence file]..."
+	missing := func(what string) {
+		fmt.Fprintf(os.Stderr, "Error: %s required when stdin is not a terminal\n", what)
+		fmt.Fprintln(os.Stderr, usage)
+		exit(ExitUsage)
+	}
+
+	if *title == "" {
+		if p == nil {
+			missing("--title")
+		}
+		*title = p.askRequired("Title")
+	}
+	if *id == "" && p != nil {
+		*id = p.ask("CVE or identifier", findingID(*title))
+	}
+	if *id == "" {
+		*id = findingID(*title)
+	}
+
+	// The score comes from the vector; --severity only overrides the
+	// rating sent with it.
+	var score *float64
+	if *vector == "" && *severity == "" && p != nil {
+		*vector = p.ask("CVSS vector (empty to build it, - to skip)", "")
+		if *vector == "" {
+			*vector = cvssVectorString(p.askCVSS())
+		}
+	}
+	if *vector != "" && *vector != "-" {
+		codes, err := parseCVSSVector(*vector)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --cvss: %v\n", err)
+			exit(ExitUsage)
+		}
+		s := cvssBaseScore(codes)
+		score, *vector = &s, cvssVectorString(codes)
+		fmt.Fprintf(os.Stderr, "CVSS %.1f %s (%s)\n", s, cvssSeverity(s), *vector)
+		if *severity == "" {
+			*severity = cvssSeverity(s)
+		}
+	} else {
+		*vector = ""
+	}
+	*severity = strings.ToUpper(*severity)
+	for !containsFold(findingSeverities, *severity) {
+		if p == nil {
+			if *severity == "" || *severity == "NONE" {
+				missing("--severity or a --cvss vector scoring above 0")
+			}
+			fmt.Fprintf(os.Stderr, "Error: --severity must be one of %s\n", strings.Join(findingSeverities, ", "))
+			exit(ExitUsage)
+		}
+		*severity = strings.ToUpper(p.askRequired("Severity (" + strings.Join(findingSeverities, ", ") + ")"))
+	}
+	if *description == "" && p != nil {
+		*description = p.ask("Description (optional)", "")
+	}
+
+	if err := client.requireTool("add_vulnerability"); err != nil {
+		fatal(err)
+	}
+	assets, err := listAll(client, "get_assets", "assets", map[string]interface{}{}, 500)
+	if err != nil {
+		fatal(err)
+	}
+	sort.Slice(assets, func(i, j int) bool {
+		return strings.ToLower(stringField(assets[i], "name")) < strings.ToLower(stringField(assets[j], "name"))
+	})
+	if len(assetArgs) == 0 {
+		if p == nil {
+			missing("--asset")
+		}
+		assetArgs = p.askAssets(assets)
+	}
+	// Assets are given by id or hostname; add_vulnerability takes the
+	// hostname and creates the asset when there is none of that name.
+	byName := map[string]map[string]interface{}{}
+	byID := map[string]map[string]interface{}{}
+	for _, a := range assets {
+		byName[strings.ToLower(stringField(a, "name"))] = a
+		byID[strconv.FormatInt(int64(numberField(a, "id")), 10)] = a
+	}
+	var hostnames []string
+	newAssets := 0
+	for _, arg := range assetArgs {
+		if a := byID[arg]; a != nil {
+			hostnames = append(hostnames, stringField(a, "name"))
+			continue
+		}
+		if _, err := strconv.ParseInt(arg, 10, 64); err == nil {
+			fmt.Fprintf(os.Stderr, "Error: asset %s not found\n", arg)
+			exit(ExitUsage)
+		}
+		if a := byName[strings.ToLower(arg)]; a != nil {
+			hostnames = append(hostnames, stringField(a, "name"))
+			continue
+		}
+		hostnames = append(hostnames, arg)
+		newAssets++
+	}
+
+	if len(evidenceArgs) == 0 && p != nil {
+		for {
+			path := p.ask("Evidence file (empty to finish)", "")
+			if path == "" {
+				break
+			}
+			evidenceArgs = append(evidenceArgs, path)
+		}
+	}
+	for _, path := range evidenceArgs {
+		if info, err := os.Stat(path); err != nil || info.IsDir() {
+			fmt.Fprintf(os.Stderr, "Error: evidence %s is not a readable file\n", path)
+			exit(ExitUsage)
+		}
+	}
+	if len(evidenceArgs) > 0 {
+		if err := client.requireTool("start_evidence_upload"); err != nil {
+			fatal(err)
+		}
+	}
+
+	summary := []string{
+		fmt.Sprintf("%s %q, %s", *id, *title, *severity),
+		fmt.Sprintf("on %s", strings.Join(hostnames, ", ")),
+	}
+	if newAssets > 0 {
+		summary = append(summary, fmt.Sprintf("%d asset(s) do not exist and will be created", newAssets))
+	}
+	if len(evidenceArgs) > 0 {
+		summary = append(summary, fmt.Sprintf("%d evidence file(s) attached to each", len(evidenceArgs)))
+	}
+	if err := confirm(client, *yes, "create findings", summary); err != nil {
+		fatal(err)
+	}
+
+	base := map[string]interface{}{"cve": *id, "criticality": *severity}
+	if *owner != "" {
+		base["owner"] = *owner
+	}
+	// The severity map reads scanner and cvss and drops them again when
+	// add_vulnerability does not take them.
+	if ok, _ := client.toolAccepts("add_vulnerability", "scanner"); ok || client.severityMap != nil {
+		base["scanner"] = *scanner
+	}
+	if ok, _ := client.toolAccepts("add_vulnerability", "cvss"); (ok || client.severityMap != nil) && score != nil {
+		base["cvss"] = *score
+	}
+	optional := map[string]string{"title": *title, "description": *description, "cvssVector": *vector}
+	for key, value := range optional {
+		if ok, _ := client.toolAccepts("add_vulnerability", key); ok && value != "" {
+			base[key] = value
+		}
+	}
+
+	created := []createdFinding{}
+	failed := 0
+	for _, hostname := range hostnames {
+		args := map[string]interface{}{"hostname": hostname}
+		for k, v := range base {
+			args[k] = v
+		}
+		result, err := client.callToolMap("add_vulnerability", args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "  %s: %v\n", hostname, err)
+			failed++
+			continue
+		}
+		f := createdFinding{ID: result["id"], VulnerabilityID: *id, Hostname: hostname, AssetID: result["assetId"]}
+		f.AssetCreated, _ = result["assetCreated"].(bool)
+		findingID, _ := result["id"].(float64)
+		for _, path := range evidenceArgs {
+			if client.dryRun {
+				continue
+			}
+			evidenceID, err := uploadEvidence(client, evidenceEntityTypes["finding"], int64(findingID), path, *title, defaultEvidenceChunkSize)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "  %s: evidence %s: %v\n", hostname, filepath.Base(path), err)
+				failed++
+				continue
+			}
+			f.Evidence = append(f.Evidence, evidenceID)
+		}
+		created = append(created, f)
+		if !rawOutput(*asJSON) {
+			status(f.ID, "Logged %s on %s as finding %v\n", *id, hostname, f.ID)
+		}
+	}
+
+	if rawOutput(*asJSON) {
+		printResult(created)
+	}
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d step(s) failed\n", failed)
+		exit(ExitPartial)
+	}
+}
@@ -0,0 +1,561 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// `gate` checks the open findings against rules and exits with 5 when one
+// is broken, so a pipeline can stop on it. Simple rules are threshold
+// flags such as --max-critical 0. Anything more specific to an
+// organization is a Rego policy given with --policy and evaluated with the
+// OPA CLI (opa eval) against the findings and assets:
+//
+//	input.findings   open findings, each with its asset under "asset", its
+//	                 upper-cased "severity", "overdue" and, unless --offline,
+//	                 "kev" and "kevDateAdded"
+//	input.assets     the assets in scope
+//	input.kev        CVE -> date added to CISA's KEV catalog, unless --offline
+//	input.summary    open findings by severity, and "overdue"
+//	input.regressions  with --compare-baseline, the new and worsened
+//	                 findings by severity, and "overdue"
+//	input.now        the evaluation time, RFC 3339
+//
+// The query, data.secman.gate.deny by default, yields the violations: a
+// set of messages, or of objects with a "msg". A boolean query such as
+// data.secman.gate.allow fails the gate when it is false.
+//
+// With --compare-baseline the thresholds count only regressions against a
+// snapshot written earlier by --write-baseline: findings that are new, or
+// whose severity went up. Known debt then no longer blocks a pipeline, and
+// each finding carries "baseline": "new", "increased" or "unchanged".
+//
+// Rules set centrally per workgroup come from a gate configuration; see
+// gateconfig.go.
+
+type gateViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// gateDataset is the input document of a gate run.
+type gateDataset struct {
+	Findings []map[string]interface{} `json:"findings"`
+	Assets   []map[string]interface{} `json:"assets"`
+	KEV      map[string]string        `json:"kev,omitempty"`
+	Summary  map[string]int           `json:"summary"`
+	// Regressions is set when comparing with a baseline.
+	Regressions map[string]int `json:"regressions,omitempty"`
+	Now         string         `json:"now"`
+
+	// allAssets holds the ids of every asset, in scope or not.
+	allAssets map[int64]bool
+}
+
+// loadGateDataset fetches the open findings of the assets in scope. The
+// findings are copies, so enriching them does not touch a shared list.
+func loadGateDataset(client *McpClient, tag string, assetID int64, withKEV bool) (*gateDataset, error) {
+	assets, err := listAll(client, "get_assets", "assets", map[string]interface{}{}, 500)
+	if err != nil {
+		return nil, err
+	}
+	d := &gateDataset{Assets: []map[string]interface{}{}, Findings: []map[string]interface{}{}, Summary: map[string]int{}, Now: time.Now().UTC().Format(time.RFC3339)}
+	inScope := map[int64]map[string]interface{}{}
+	d.allAssets = make(map[int64]bool, len(assets))
+	for _, a := range assets {
+		id := int64(numberField(a, "id"))
+		d.allAssets[id] = true
+		// Decommissioned assets are retired, not a risk to gate on.
+		if (assetID > 0 && id != assetID) || (tag != "" && !assetHasTag(a, tag)) || isDecommissioned(a) {
+			continue
+		}
+		inScope[id] = a
+		d.Assets = append(d.Assets, a)
+	}
+
+	args := map[string]interface{}{}
+	if assetID > 0 {
+		args["assetId"] = assetID
+	}
+	findings, err := listAll(client, "get_vulnerabilities", "vulnerabilities", args, 500)
+	if err != nil {
+		return nil, err
+	}
+	if withKEV {
+		if d.KEV, err = fetchKEVDates(); err != nil {
+			// A gate must not pass because its data is missing.
+			return nil, fmt.Errorf("KEV catalog: %w (use --offline to evaluate without it)", err)
+		}
+	}
+	for _, f := range findings {
+		asset, ok := inScope[findingAssetID(f)]
+		if !ok {
+			continue
+		}
+		g := make(map[string]interface{}, len(f)+5)
+		for k, v := range f {
+			g[k] = v
+		}
+		sev := strings.ToUpper(stringField(f, "cvssSeverity"))
+		g["severity"] = sev
+		g["asset"] = asset
+		g["overdue"] = isOverdue(f)
+		if d.KEV != nil {
+			added, kev := d.KEV[strings.ToUpper(stringField(f, "vulnerabilityId"))]
+			g["kev"] = kev
+			if kev {
+				g["kevDateAdded"] = added
+			}
+		}
+		d.Findings = append(d.Findings, g)
+		d.Summary[sev]++
+		if g["overdue"] == true {
+			d.Summary["overdue"]++
+		}
+	}
+	return d, nil
+}
+
+// gateThresholds checks the --max-* flags; a negative limit is off. With a
+// baseline the limits apply to the regressions instead of all findings.
+func gateThresholds(d *gateDataset, limits map[string]int) []gateViolation {
+	counts, what := d.Summary, ""
+	if d.Regressions != nil {
+		counts, what = d.Regressions, "new or worsened "
+	}
+	var out []gateViolation
+	for _, key := range append(append([]string{}, severityOrder...), "overdue") {
+		limit, ok := limits[key]
+		if !ok || limit < 0 || counts[key] <= limit {
+			continue
+		}
+		out = append(out, gateViolation{
+			Rule:    "max-" + strings.ToLower(key),
+			Message: fmt.Sprintf("%d %s%s finding(s), limit %d", counts[key], what, key, limit),
+		})
+	}
+	return out
+}
+
+// gateBaseline is the snapshot --write-baseline stores: the severity of
+// each open finding by asset and CVE. Finding ids are not used, since a
+// rescan may replace a finding with a new record.
+type gateBaseline struct {
+	Created  string            `json:"created"`
+	Findings map[string]string `json:"findings"`
+	// AssetNames names the assets of Findings, by id, so that fixed
+	// findings on assets since deleted can still be shown.
+	AssetNames map[string]string `json:"assetNames,omitempty"`
+}
+
+// gateChange is a finding that differs from the baseline.
+type gateChange struct {
+	CVE      string `json:"cve"`
+	AssetID  int64  `json:"assetId"`
+	Asset    string `json:"asset,omitempty"`
+	AssetURL string `json:"assetUrl,omitempty"`
+	Severity string `json:"severity"`
+	// Was is the baseline severity of a finding whose severity went up.
+	Was string `json:"was,omitempty"`
+}
+
+func (c gateChange) String() string {
+	where := fmt.Sprintf("%s on %s", c.CVE, c.Asset)
+	if c.Asset == "" {
+		where = fmt.Sprintf("%s on asset %d", c.CVE, c.AssetID)
+	}
+	if c.Was != "" {
+		return fmt.Sprintf("%s: %s -> %s", where, c.Was, c.Severity)
+	}
+	return fmt.Sprintf("%s: %s", where, c.Severity)
+}
+
+func gateBaselineKey(f map[string]interface{}) string {
+	return fmt.Sprintf("%d/%s", findingAssetID(f), strings.ToUpper(stringField(f, "vulnerabilityId")))
+}
+
+// severityRank orders severities from LOW (1) to CRITICAL (4); anything
+// else is 0.
+func severityRank(sev string) int {
+	for i, s := range severityOrder {
+		if s == sev {
+			return len(severityOrder) - i
+		}
+	}
+	return 0
+}
+
+func loadGateBaseline(path string) (*gateBaseline, error) {
+	data, err := readTextFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("baseline %s does not exist; write it with --write-baseline", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	b := &gateBaseline{}
+	if err := json.Unmarshal(data, b); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if b.Findings == nil {
+		b.Findings = map[string]string{}
+	}
+	return b, nil
+}
+
+func writeGateBaseline(path string, d *gateDataset) error {
+	b := gateBaseline{Created: d.Now, Findings: make(map[string]string, len(d.Findings)), AssetNames: map[string]string{}}
+	for _, f := range d.Findings {
+		key := gateBaselineKey(f)
+		asset, _ := f["asset"].(map[string]interface{})
+		b.AssetNames[fmt.Sprint(findingAssetID(f))] = stringField(asset, "name")
+		// An asset may have a CVE more than once; keep the worst.
+		if sev := stringField(f, "severity"); severityRank(sev) >= severityRank(b.Findings[key]) {
+			b.Findings[key] = sev
+		}
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".tmp", append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// compareGateBaseline marks each finding as new, increased or unchanged
+// against b and counts the regressions. It returns the new and worsened
+// findings, and the baseline findings that are no longer open. Findings
+// outside the scope of the run are not reported as fixed.
+func compareGateBaseline(d *gateDataset, b *gateBaseline) (regressed, fixed []gateChange) {
+	d.Regressions = map[string]int{}
+	open := map[string]bool{}
+	for _, f := range d.Findings {
+		key := gateBaselineKey(f)
+		open[key] = true
+		sev := stringField(f, "severity")
+		was, known := b.Findings[key]
+		asset, _ := f["asset"].(map[string]interface{})
+		change := gateChange{
+			CVE:      strings.ToUpper(stringField(f, "vulnerabilityId")),
+			AssetID:  findingAssetID(f),
+			Asset:    stringField(asset, "name"),
+			AssetURL: assetURL(findingAssetID(f)),
+			Severity: sev,
+		}
+		switch {
+		case !known:
+			f["baseline"] = "new"
+		case severityRank(sev) > severityRank(was):
+			f["baseline"] = "increased"
+			change.Was = was
+		default:
+			f["baseline"] = "unchanged"
+			continue
+		}
+		regressed = append(regressed, change)
+		d.Regressions[sev]++
+		if f["overdue"] == true {
+			d.Regressions["overdue"]++
+		}
+	}
+
+	inScope := map[int64]bool{}
+	for _, a := range d.Assets {
+		inScope[int64(numberField(a, "id"))] = true
+	}
+	for key, sev := range b.Findings {
+		if open[key] {
+			continue
+		}
+		var c gateChange
+		idText, cve, _ := strings.Cut(key, "/")
+		if _, err := fmt.Sscan(idText, &c.AssetID); err != nil {
+			continue
+		}
+		// A deleted asset counts as fixed; one filtered out by --tag or
+		// --asset-id does not.
+		if !inScope[c.AssetID] && d.allAssets[c.AssetID] {
+			continue
+		}
+		c.CVE, c.Severity, c.Asset = cve, sev, b.AssetNames[idText]
+		if inScope[c.AssetID] {
+			c.AssetURL = assetURL(c.AssetID)
+		}
+		fixed = append(fixed, c)
+	}
+	sortGateChanges(regressed)
+	sortGateChanges(fixed)
+	return regressed, fixed
+}
+
+// sortGateChanges orders changes by severity, worst first, then by CVE.
+func sortGateChanges(changes []gateChange) {
+	sort.Slice(changes, func(i, j int) bool {
+		if ri, rj := severityRank(changes[i].Severity), severityRank(changes[j].Severity); ri != rj {
+			return ri > rj
+		}
+		if changes[i].CVE != changes[j].CVE {
+			return changes[i].CVE < changes[j].CVE
+		}
+		return changes[i].AssetID < changes[j].AssetID
+	})
+}
+
+// assetURL links an asset in the Secman web UI, at SECMAN_UI_URL or else
+// the server URL.
+func assetURL(id int64) string {
+	base := strings.TrimRight(settingOr("SECMAN_UI_URL", setting("SECMAN_BASE_URL")), "/")
+	if base == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/assets/%d", base, id)
+}
+
+// opaOutput is the JSON that `opa eval --format json` prints.
+type opaOutput struct {
+	Result []struct {
+		Expressions []struct {
+			Value interface{} `json:"value"`
+		} `json:"expressions"`
+	} `json:"result"`
+	Errors []struct {
+		Message  string `json:"message"`
+		Location *struct {
+			File string `json:"file"`
+			Row  int    `json:"row"`
+		} `json:"location"`
+	} `json:"errors"`
+}
+
+// evalPolicies runs query over the policies with opa eval. SECMAN_OPA names
+// the opa binary when it is not on the PATH.
+func evalPolicies(policies []string, query string, d *gateDataset) ([]gateViolation, error) {
+	opa, err := exec.LookPath(settingOr("SECMAN_OPA", "opa"))
+	if err != nil {
+		return nil, fmt.Errorf("--policy needs the OPA CLI (https://www.openpolicyagent.org/docs/latest/#running-opa); install it or set SECMAN_OPA: %w", err)
+	}
+	input, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"eval", "--format", "json", "--stdin-input"}
+	for _, p := range policies {
+		args = append(args, "--data", p)
+	}
+	args = append(args, query)
+
+	cmd := exec.Command(opa, args...)
+	cmd.Stdin = bytes.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	runErr := cmd.Run()
+
+	var out opaOutput
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		if runErr != nil {
+			return nil, fmt.Errorf("opa eval: %v: %s", runErr, strings.TrimSpace(stderr.String()))
+		}
+		return nil, fmt.Errorf("opa eval: invalid output: %w", err)
+	}
+	if len(out.Errors) > 0 {
+		msgs := make([]string, 0, len(out.Errors))
+		for _, e := range out.Errors {
+			if e.Location != nil {
+				msgs = append(msgs, fmt.Sprintf("%s:%d: %s", e.Location.File, e.Location.Row, e.Message))
+			} else {
+				msgs = append(msgs, e.Message)
+			}
+		}
+		return nil, fmt.Errorf("opa eval: %s", strings.Join(msgs, "; "))
+	}
+	if runErr != nil {
+		return nil, fmt.Errorf("opa eval: %v: %s", runErr, strings.TrimSpace(stderr.String()))
+	}
+	// An undefined query is most likely a package or rule name that does
+	// not match; passing the gate on it would hide that.
+	if len(out.Result) == 0 || len(out.Result[0].Expressions) == 0 {
+		return nil, fmt.Errorf("%s is undefined; check the policy's package and rule names", query)
+	}
+
+	var violations []gateViolation
+	switch v := out.Result[0].Expressions[0].Value.(type) {
+	case bool:
+		if !v {
+			violations = append(violations, gateViolation{Rule: "policy", Message: query + " is false"})
+		}
+	case []interface{}:
+		for _, item := range v {
+			msg := ""
+			switch item := item.(type) {
+			case string:
+				msg = item
+			case map[string]interface{}:
+				msg = stringField(item, "msg")
+			}
+			if msg == "" {
+				data, _ := json.Marshal(item)
+				msg = string(data)
+			}
+			violations = append(violations, gateViolation{Rule: "policy", Message: msg})
+		}
+	default:
+		return nil, fmt.Errorf("%s must be a set of messages or a boolean, got %T", query, v)
+	}
+	return violations, nil
+}
+
+func cmdGate(client *McpClient, osArgs []string) {
+	fs := flag.NewFlagSet("gate", flag.ContinueOnError)
+	limits := map[string]*int{}
+	for _, sev := range severityOrder {
+		limits[sev] = fs.Int("max-"+strings.ToLower(sev), -1, "Fail when more "+sev+" findings are open (-1: no limit)")
+	}
+	limits["overdue"] = fs.Int("max-overdue", -1, "Fail when more findings are overdue (-1: no limit)")
+	tag := fs.String("tag", "", "Only findings on assets with this tag (key=value, or a value or group name)")
+	assetID := fs.Int64("asset-id", 0, "Only findings on this asset")
+	var policies stringList
+	fs.Var(&policies, "policy", "Rego policy file or directory evaluated with opa (repeatable)")
+	query := fs.String("query", settingOr("SECMAN_GATE_QUERY", "data.secman.gate.deny"), "Rego query yielding the violations")
+	offline := fs.Bool("offline", false, "Do not fetch the KEV catalog for policies")
+	baselinePath := fs.String("compare-baseline", "", "Count only findings that are new or worse than in this baseline snapshot")
+	writeBaseline := fs.String("write-baseline", "", "Save the open findings as a baseline snapshot when the gate passes")
+	configPath := fs.String("config", "", "Gate configuration with rules per workgroup, file or URL (default: SECMAN_GATE_CONFIG or .secman-gate.yaml)")
+	asJSON := fs.Bool("json", false, "Print the verdict and violations as JSON")
+	parseFlags(fs, osArgs)
+
+	if p := setting("SECMAN_GATE_POLICY"); p != "" && len(policies) == 0 {
+		policies = splitList(p)
+	}
+	limited := false
+	for _, l := range limits {
+		limited = limited || *l >= 0
+	}
+	var cfg *gateConfig
+	if p := gateConfigPath(*configPath); p != "" {
+		c, err := loadGateConfig(client, p)
+		if err != nil {
+			fatal(err)
+		}
+		cfg = c
+	}
+	if !limited && cfg == nil && len(policies) == 0 && *baselinePath == "" && *writeBaseline == "" {
+		fmt.Fprintln(os.Stderr, "Error: no rule given; use --max-critical, --max-high, --max-medium, --max-low, --max-overdue, --policy, --config or --compare-baseline")
+		exit(ExitUsage)
+	}
+	var baseline *gateBaseline
+	if *baselinePath != "" {
+		b, err := loadGateBaseline(*baselinePath)
+		if err != nil {
+			fatal(err)
+		}
+		baseline = b
+	}
+
+	d, err := loadGateDataset(client, *tag, *assetID, len(policies) > 0 && !*offline)
+	if err != nil {
+		fatal(err)
+	}
+	if cfg != nil && cfg.needsWorkgroups() {
+		if err := loadAssetWorkgroups(client, d); err != nil {
+			fatal(err)
+		}
+	}
+	var regressed, fixed []gateChange
+	if baseline != nil {
+		regressed, fixed = compareGateBaseline(d, baseline)
+	}
+	values := map[string]int{}
+	for k, l := range limits {
+		values[k] = *l
+	}
+	violations := gateThresholds(d, values)
+	if cfg != nil {
+		violations = append(violations, gateConfigViolations(d, cfg)...)
+	}
+	if baseline != nil && !limited && cfg == nil && len(policies) == 0 {
+		// Without other rules, any regression fails the gate.
+		for _, c := range regressed {
+			violations = append(violations, gateViolation{Rule: "regression", Message: c.String()})
+		}
+	}
+	if len(policies) > 0 {
+		pv, err := evalPolicies(policies, *query, d)
+		if err != nil {
+			fatal(err)
+		}
+		violations = append(violations, pv...)
+	}
+
+	passed := len(violations) == 0
+	raw := rawOutput(*asJSON)
+	if raw {
+		if violations == nil {
+			violations = []gateViolation{}
+		}
+		result := map[string]interface{}{
+			"passed":     passed,
+			"violations": violations,
+			"summary":    d.Summary,
+			"findings":   len(d.Findings),
+			"assets":     len(d.Assets),
+		}
+		if cfg != nil {
+			result["config"] = cfg.source
+		}
+		if baseline != nil {
+			if regressed == nil {
+				regressed = []gateChange{}
+			}
+			if fixed == nil {
+				fixed = []gateChange{}
+			}
+			result["new"] = regressed
+			result["fixed"] = fixed
+			result["baseline"] = baseline.Created
+		}
+		printResult(result)
+	} else {
+		status(nil, "Checked %d open finding(s) on %d asset(s)\n", len(d.Findings), len(d.Assets))
+		if cfg != nil {
+			status(nil, "Rules from %s\n", cfg.source)
+		}
+		if baseline != nil {
+			status(nil, "%d new or worsened, %d fixed since the baseline of %s\n", len(regressed), len(fixed), baseline.Created)
+		}
+		for _, v := range violations {
+			fmt.Printf("  %s %-13s %s\n", paint(styleFail, "FAIL"), v.Rule, v.Message)
+		}
+	}
+	if !passed {
+		fmt.Fprintf(os.Stderr, "%s: %d violation(s)\n", paintErr(styleFail, "Gate FAILED"), len(violations))
+		exit(ExitGateFailed)
+	}
+	if *writeBaseline != "" {
+		if err := writeGateBaseline(*writeBaseline, d); err != nil {
+			fatal(err)
+		}
+		if !raw {
+			status(nil, "Wrote baseline of %d finding(s) to %s\n", len(d.Findings), *writeBaseline)
+		}
+	}
+	if !raw {
+		status(nil, "%s\n", paint(styleOK, "Gate passed"))
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A gate configuration lets central security set the gate rules once
+// instead of in each pipeline's flags. It holds default rules and rules per
+// workgroup; every finding is checked against the rules of its asset's
+// workgroups, or the defaults when none of them is configured:
+//
+//	default:
+//	  max-critical: 0
+//	  sla-days: 30
+//	  max-overdue: 5
+//	workgroups:
+//	  Payments:
+//	    max-high: 0
+//	    sla-days: 14
+//	    max-overdue: 0
+//	    exceptions:
+//	      - cve: CVE-2023-44487
+//	        asset: lb-01
+//	        until: 2026-12-31
+//	        reason: mitigated at the WAF
+//
+// A workgroup inherits what it does not set from default, and its
+// exceptions add to those of default. The file is YAML or JSON, kept in
+// the repository (.secman-gate.yaml) or served centrally over HTTPS.
+
+// gateConfigFiles are looked for in the working directory when neither
+// --config nor SECMAN_GATE_CONFIG is given.
+var gateConfigFiles = []string{".secman-gate.yaml", ".secman-gate.yml", ".secman-gate.json"}
+
+type gateRules struct {
+	MaxCritical *int            `json:"max-critical,omitempty"`
+	MaxHigh     *int            `json:"max-high,omitempty"`
+	MaxMedium   *int            `json:"max-medium,omitempty"`
+	MaxLow      *int            `json:"max-low,omitempty"`
+	MaxOverdue  *int            `json:"max-overdue,omitempty"`
+	SLADays     int             `json:"sla-days,omitempty"`
+	Exceptions  []gateException `json:"exceptions,omitempty"`
+}
+
+// gateException allows a CVE, on every asset or on one asset given by name
+// or id, until a date.
+type gateException struct {
+	CVE    string `json:"cve"`
+	Asset  string `json:"asset,omitempty"`
+	Until  string `json:"until,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+type gateConfig struct {
+	Default    gateRules            `json:"default"`
+	Workgroups map[string]gateRules `json:"workgroups"`
+
+	source string
+}
+
+// limits returns the thresholds of r keyed like the --max-* flags.
+func (r gateRules) limits() map[string]int {
+	out := map[string]int{}
+	for key, v := range map[string]*int{
+		"CRITICAL": r.MaxCritical, "HIGH": r.MaxHigh, "MEDIUM": r.MaxMedium, "LOW": r.MaxLow, "overdue": r.MaxOverdue,
+	} {
+		if v != nil {
+			out[key] = *v
+		}
+	}
+	return out
+}
+
+// inherit fills what r leaves unset from def.
+func (r gateRules) inherit(def gateRules) gateRules {
+	for _, p := range []struct{ dst, src **int }{
+		{&r.MaxCritical, &def.MaxCritical}, {&r.MaxHigh, &def.MaxHigh}, {&r.MaxMedium, &def.MaxMedium},
+		{&r.MaxLow, &def.MaxLow}, {&r.MaxOverdue, &def.MaxOverdue},
+	} {
+		if *p.dst == nil {
+			*p.dst = *p.src
+		}
+	}
+	if r.SLADays == 0 {
+		r.SLADays = def.SLADays
+	}
+	r.Exceptions = append(append([]gateException{}, def.Exceptions...), r.Exceptions...)
+	return r
+}
+
+// excepts reports whether an unexpired exception of r covers f.
+func (r gateRules) excepts(f map[string]interface{}, today string) bool {
+	cve := strings.ToUpper(stringField(f, "vulnerabilityId"))
+	asset, _ := f["asset"].(map[string]interface{})
+	for _, e := range r.Exceptions {
+		if !strings.EqualFold(e.CVE, cve) || (e.Until != "" && e.Until < today) {
+			continue
+		}
+		if e.Asset == "" || e.Asset == fmt.Sprint(findingAssetID(f)) || strings.EqualFold(e.Asset, stringField(asset, "name")) {
+			return true
+		}
+	}
+	return false
+}
+
+// overdue applies the rules' SLA, if any, instead of the server's.
+func (r gateRules) overdue(f map[string]interface{}) bool {
+	if r.SLADays <= 0 {
+		return f["overdue"] == true
+	}
+	days, ok := parseDays(stringField(f, "daysOpen"))
+	return ok && days >= r.SLADays
+}
+
+// gateConfigPath returns the configuration to use: --config, then
+// SECMAN_GATE_CONFIG, then a file in the working directory, else "".
+func gateConfigPath(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	if p := setting("SECMAN_GATE_CONFIG"); p != "" {
+		return p
+	}
+	for _, name := range gateConfigFiles {
+		if _, err := os.Stat(name); err == nil {
+			return name
+		}
+	}
+	return ""
+}
+
+// loadGateConfig reads a configuration from a file or an http(s) URL. A
+// URL is fetched with SECMAN_GATE_CONFIG_TOKEN as bearer token, if set.
+func loadGateConfig(client *McpClient, path string) (*gateConfig, error) {
+	var data []byte
+	var err error
+	if strings.HasPrefix(path, "https://") || strings.HasPrefix(path, "http://") {
+		data, err = fetchGateConfig(client, path)
+	} else {
+		data, err = readTextFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("gate configuration %s does not exist", path)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var doc interface{}
+	if trimmed := strings.TrimSpace(string(data)); strings.HasPrefix(trimmed, "{") {
+		err = json.Unmarshal(data, &doc)
+	} else {
+		doc, err = parseYAML(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	cfg := &gateConfig{source: path}
+	if err := remarshal(doc, cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for name, r := range cfg.Workgroups {
+		if err := r.validate(); err != nil {
+			return nil, fmt.Errorf("%s: workgroup %s: %w", path, name, err)
+		}
+	}
+	if err := cfg.Default.validate(); err != nil {
+		return nil, fmt.Errorf("%s: default: %w", path, err)
+	}
+	return cfg, nil
+}
+
+func (r gateRules) validate() error {
+	for i, e := range r.Exceptions {
+		if e.CVE == "" {
+			return fmt.Errorf("exception %d has no cve", i+1)
+		}
+		if e.Until != "" {
+			if _, err := time.Parse("2006-01-02", e.Until); err != nil {
+				return fmt.Errorf("exception %s: until must be YYYY-MM-DD", e.CVE)
+			}
+		}
+	}
+	return nil
+}
+
+func fetchGateConfig(client *McpClient, u string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token := setting("SECMAN_GATE_CONFIG_TOKEN"); token != "" {
+		registerSecret(token)
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := externalHTTPClient(client, 30*time.Second).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("gate configuration: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &HTTPError{StatusCode: resp.StatusCode, Body: "gate configuration: " + req.URL.Host + " returned " + resp.Status}
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+}
+
+// needsWorkgroups reports whether rules depend on the assets' workgroups.
+func (c *gateConfig) needsWorkgroups() bool {
+	return len(c.Workgroups) > 0
+}
+
+// loadAssetWorkgroups adds the names of each asset's workgroups to the
+// dataset's assets as "workgroups". get_assets does not return them, so
+// they come from get_all_assets_detail.
+func loadAssetWorkgroups(client *McpClient, d *gateDataset) error {
+	details, err := listAll(client, "get_all_assets_detail", "assets", map[string]interface{}{}, 500)
+	if err != nil {
+		return fmt.Errorf("workgroups of assets: %w", err)
+	}
+	names := map[int64][]interface{}{}
+	for _, a := range details {
+		list, _ := a["workgroups"].([]interface{})
+		for _, w := range list {
+			if wg, ok := w.(map[string]interface{}); ok {
+				id := int64(numberField(a, "id"))
+				names[id] = append(names[id], stringField(wg, "name"))
+			}
+		}
+	}
+	for _, a := range d.Assets {
+		wgs := names[int64(numberField(a, "id"))]
+		if wgs == nil {
+			wgs = []interface{}{}
+		}
+		a["workgroups"] = wgs
+	}
+	return nil
+}
+
+// rulesFor returns the rules a finding is checked against, by the name of
+// the configuration section: its asset's configured workgroups, or
+// "default".
+func (c *gateConfig) rulesFor(f map[string]interface{}) map[string]gateRules {
+	out := map[string]gateRules{}
+	asset, _ := f["asset"].(map[string]interface{})
+	for _, wg := range stringsField(asset, "workgroups") {
+		for name, r := range c.Workgroups {
+			if strings.EqualFold(name, wg) {
+				out[name] = r.inherit(c.Default)
+			}
+		}
+	}
+	if len(out) == 0 {
+		out["default"] = c.Default
+	}
+	return out
+}
+
+// gateConfigViolations checks each workgroup's findings against its
+// thresholds. Excepted findings are marked "excepted" and not counted; with
+// a baseline only new and worsened findings count, as for the flags.
+func gateConfigViolations(d *gateDataset, c *gateConfig) []gateViolation {
+	today := time.Now().UTC().Format("2006-01-02")
+	counts := map[string]map[string]int{}
+	rules := map[string]gateRules{}
+	for _, f := range d.Findings {
+		for name, r := range c.rulesFor(f) {
+			rules[name] = r
+			if r.excepts(f, today) {
+				f["excepted"] = true
+				continue
+			}
+			if d.Regressions != nil && f["baseline"] == "unchanged" {
+				continue
+			}
+			if counts[name] == nil {
+				counts[name] = map[string]int{}
+			}
+			counts[name][stringField(f, "severity")]++
+			if r.overdue(f) {
+				counts[name]["overdue"]++
+			}
+		}
+	}
+
+	what := ""
+	if d.Regressions != nil {
+		what = "new or worsened "
+	}
+	names := make([]string, 0, len(rules))
+	for name := range rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var out []gateViolation
+	for _, name := range names {
+		limits := rules[name].limits()
+		for _, key := range append(append([]string{}, severityOrder...), "overdue") {
+			limit, ok := limits[key]
+			if !ok || limit < 0 || counts[name][key] <= limit {
+				continue
+			}
+			scope := "workgroup " + name
+			if name == "default" {
+				scope = "default"
+			}
+			out = append(out, gateViolation{
+				Rule:    "max-" + strings.ToLower(key),
+				Message: fmt.Sprintf("%s: %d %s%s finding(s), limit %d", scope, counts[name][key], what, key, limit),
+			})
+		}
+	}
+	return out
+}
@@ -0,0 +1,664 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// `serve-grafana` serves Secman data to Grafana through the JSON
+// datasource contract (simpod-json-datasource): GET / for the connection
+// test, POST /search or /metrics to list targets, POST /query for time
+// series and tables, and POST /annotations for scans and first-seen
+// findings. The Infinity datasource reads the same tables as plain JSON
+// arrays from GET /tables/<name>.
+//
+// Secman keeps no metric history, so gauges such as vulnerabilities.critical
+// are one data point at the end of the range. Scans and new findings are
+// bucketed over the range from their timestamps. Server data is cached for
+// --cache, so a dashboard refresh does not page every finding again.
+
+// grafanaTargets lists the query targets. Names starting with "table."
+// are tables, the others time series.
+var grafanaTargets = []struct{ name, help string }{
+	{"vulnerabilities.critical", "Open CRITICAL findings"},
+	{"vulnerabilities.high", "Open HIGH findings"},
+	{"vulnerabilities.medium", "Open MEDIUM findings"},
+	{"vulnerabilities.low", "Open LOW findings"},
+	{"vulnerabilities.total", "Open findings"},
+	{"findings.overdue", "Open findings past SECMAN_OVERDUE_DAYS"},
+	{"findings.new", "Open findings by first-seen time"},
+	{"assets.total", "Assets"},
+	{"scans", "Scans by scan time"},
+	{"table.findings", "Open findings"},
+	{"table.assets", "Assets"},
+	{"table.risky-assets", "Assets with the most severe open findings"},
+	{"table.scans", "Scans in the range"},
+	{"table.severity", "Open findings by severity"},
+	{"table.asset-types", "Assets by type"},
+}
+
+// errGrafanaRequest marks errors caused by the request, such as an
+// unknown target, as opposed to failures of the Secman server.
+var errGrafanaRequest = errors.New("bad request")
+
+type grafanaServer struct {
+	client *McpClient
+	ttl    time.Duration
+	token  string
+
+	mu    sync.Mutex
+	cache map[string]grafanaCached
+}
+
+type grafanaCached struct {
+	at    time.Time
+	value interface{}
+}
+
+type grafanaRange struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+type grafanaQuery struct {
+	Range         grafanaRange `json:"range"`
+	IntervalMs    int64        `json:"intervalMs"`
+	MaxDataPoints int          `json:"maxDataPoints"`
+	Targets       []struct {
+		Target string `json:"target"`
+		RefID  string `json:"refId"`
+		Hide   bool   `json:"hide"`
+	} `json:"targets"`
+}
+
+type grafanaColumn struct {
+	Text string `json:"text"`
+	Type string `json:"type"` // string, number or time
+}
+
+type grafanaTable struct {
+	Type    string          `json:"type"`
+	RefID   string          `json:"refId,omitempty"`
+	Columns []grafanaColumn `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+type grafanaSeries struct {
+	Target     string       `json:"target"`
+	RefID      string       `json:"refId,omitempty"`
+	Datapoints [][2]float64 `json:"datapoints"` // [value, unix ms]
+}
+
+type grafanaAnnotation struct {
+	Annotation json.RawMessage `json:"annotation,omitempty"`
+	Time       int64           `json:"time"`
+	Title      string          `json:"title"`
+	Text       string          `json:"text"`
+	Tags       []string        `json:"tags"`
+}
+
+// cached returns the value stored under key, fetching it when it is
+// missing or older than the TTL. Fetches are serialized, so concurrent
+// panels wait for one fetch instead of each starting their own.
+func (g *grafanaServer) cached(key string, fetch func() (interface{}, error)) (interface{}, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := time.Now()
+	if c, ok := g.cache[key]; ok && now.Sub(c.at) < g.ttl {
+		return c.value, nil
+	}
+	v, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+	for k, c := range g.cache {
+		if now.Sub(c.at) >= g.ttl {
+			delete(g.cache, k)
+		}
+	}
+	g.cache[key] = grafanaCached{at: now, value: v}
+	return v, nil
+}
+
+func (g *grafanaServer) stats() (*Stats, error) {
+	v, err := g.cached("stats", func() (interface{}, error) { return collectStats(g.client, 25) })
+	if err != nil {
+		return nil, err
+	}
+	return v.(*Stats), nil
+}
+
+func (g *grafanaServer) list(tool, key string) ([]map[string]interface{}, error) {
+	v, err := g.cached(tool, func() (interface{}, error) {
+		return listAll(g.client, tool, key, map[string]interface{}{}, 500)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]map[string]interface{}), nil
+}
+
+// scans returns the scans in r. The range is part of the cache key, so
+// it is rounded to the minute to let panels of one dashboard share it.
+func (g *grafanaServer) scans(r grafanaRange) ([]map[string]interface{}, error) {
+	from, to := r.From.UTC().Truncate(time.Minute), r.To.UTC().Truncate(time.Minute).Add(time.Minute)
+	key := "scans|" + from.Format(time.RFC3339) + "|" + to.Format(time.RFC3339)
+	v, err := g.cached(key, func() (interface{}, error) {
+		return listAll(g.client, "get_scans", "scans", map[string]interface{}{
+			"startDate": from.Format(time.RFC3339),
+			"endDate":   to.Format(time.RFC3339),
+		}, 500)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]map[string]interface{}), nil
+}
+
+// firstSeen is when a finding was first recorded.
+func firstSeen(f map[string]interface{}) (time.Time, bool) {
+	if t, ok := parseServerTime(stringField(f, "createdAt")); ok {
+		return t, true
+	}
+	return parseServerTime(stringField(f, "scanTimestamp"))
+}
+
+// bucket counts the times in the query range in steps of the query
+// interval, bounded so that there are at most maxDataPoints buckets.
+func bucket(times []time.Time, q *grafanaQuery) [][2]float64 {
+	from, to := q.Range.From.UTC(), q.Range.To.UTC()
+	maxPoints := q.MaxDataPoints
+	if maxPoints <= 0 {
+		maxPoints = 1000
+	}
+	step := time.Duration(q.IntervalMs) * time.Millisecond
+	if min := to.Sub(from) / time.Duration(maxPoints); step < min {
+		step = min
+	}
+	if step < time.Minute {
+		step = time.Minute
+	}
+	start := from.Truncate(step)
+	n := int(to.Sub(start)/step) + 1
+	if n <= 0 {
+		return [][2]float64{}
+	}
+	points := make([][2]float64, n)
+	for i := range points {
+		points[i][1] = float64(start.Add(time.Duration(i) * step).UnixMilli())
+	}
+	for _, t := range times {
+		if t.Before(from) || t.After(to) {
+			continue
+		}
+		if i := int(t.Sub(start) / step); i >= 0 && i < n {
+			points[i][0]++
+		}
+	}
+	return points
+}
+
+// series answers a time series target.
+func (g *grafanaServer) series(target string, q *grafanaQuery) (*grafanaSeries, error) {
+	gauge := func(v int) *grafanaSeries {
+		return &grafanaSeries{Target: target, Datapoints: [][2]float64{{float64(v), float64(q.Range.To.UnixMilli())}}}
+	}
+	switch target {
+	case "vulnerabilities.critical", "vulnerabilities.high", "vulnerabilities.medium", "vulnerabilities.low", "vulnerabilities.total", "assets.total":
+		s, err := g.stats()
+		if err != nil {
+			return nil, err
+		}
+		switch target {
+		case "assets.total":
+			return gauge(s.TotalAssets), nil
+		case "vulnerabilities.total":
+			total := 0
+			for _, sev := range severityOrder {
+				total += s.VulnsBySeverity[sev]
+			}
+			return gauge(total), nil
+		}
+		return gauge(s.VulnsBySeverity[strings.ToUpper(strings.TrimPrefix(target, "vulnerabilities."))]), nil
+	case "findings.overdue", "findings.new":
+		findings, err := g.list("get_vulnerabilities", "vulnerabilities")
+		if err != nil {
+			return nil, err
+		}
+		if target == "findings.overdue" {
+			n := 0
+			for _, f := range findings {
+				if isOverdue(f) {
+					n++
+				}
+			}
+			return gauge(n), nil
+		}
+		var times []time.Time
+		for _, f := range findings {
+			if t, ok := firstSeen(f); ok {
+				times = append(times, t)
+			}
+		}
+		return &grafanaSeries{Target: target, Datapoints: bucket(times, q)}, nil
+	case "scans":
+		scans, err := g.scans(q.Range)
+		if err != nil {
+			return nil, err
+		}
+		var times []time.Time
+		for _, s := range scans {
+			if t, ok := parseServerTime(stringField(s, "scanDate")); ok {
+				times = append(times, t)
+			}
+		}
+		return &grafanaSeries{Target: target, Datapoints: bucket(times, q)}, nil
+	}
+	return nil, fmt.Errorf("%w: unknown target %q", errGrafanaRequest, target)
+}
+
+func timeMillis(v string) interface{} {
+	if t, ok := parseServerTime(v); ok {
+		return t.UnixMilli()
+	}
+	return nil
+}
+
+// table answers a table target.
+func (g *grafanaServer) table(target string, r grafanaRange) (*grafanaTable, error) {
+	t := &grafanaTable{Type: "table", Rows: [][]interface{}{}}
+	col := func(text, typ string) { t.Columns = append(t.Columns, grafanaColumn{Text: text, Type: typ}) }
+
+	switch target {
+	case "table.findings":
+		findings, err := g.list("get_vulnerabilities", "vulnerabilities")
+		if err != nil {
+			return nil, err
+		}
+		col("ID", "number")
+		col("CVE", "string")
+		col("Severity", "string")
+		col("Asset", "string")
+		col("Days open", "number")
+		col("Overdue", "string")
+		col("First seen", "time")
+		for _, f := range findings {
+			days, _ := parseDays(stringField(f, "daysOpen"))
+			overdue := "no"
+			if isOverdue(f) {
+				overdue = "yes"
+			}
+			var seen interface{}
+			if ts, ok := firstSeen(f); ok {
+				seen = ts.UnixMilli()
+			}
+			t.Rows = append(t.Rows, []interface{}{int64(numberField(f, "id")), stringField(f, "vulnerabilityId"),
+				strings.ToUpper(stringField(f, "cvssSeverity")), stringField(f, "assetName"), days, overdue, seen})
+		}
+	case "table.assets":
+		assets, err := g.list("get_assets", "assets")
+		if err != nil {
+			return nil, err
+		}
+		col("ID", "number")
+		col("Name", "string")
+		col("Type", "string")
+		col("IP", "string")
+		col("Owner", "string")
+		col("Groups", "string")
+		for _, a := range assets {
+			t.Rows = append(t.Rows, []interface{}{int64(numberField(a, "id")), stringField(a, "name"), stringField(a, "type"),
+				stringField(a, "ip"), stringField(a, "owner"), strings.Join(stringsField(a, "groups"), ", ")})
+		}
+	case "table.risky-assets":
+		s, err := g.stats()
+		if err != nil {
+			return nil, err
+		}
+		col("Asset", "string")
+		col("Type", "string")
+		col("Critical", "number")
+		col("High", "number")
+		col("Medium", "number")
+		col("Low", "number")
+		col("Heat", "string")
+		for _, a := range s.TopRiskyAssets {
+			t.Rows = append(t.Rows, []interface{}{a.AssetName, a.AssetType, a.Critical, a.High, a.Medium, a.Low, a.HeatLevel})
+		}
+	case "table.scans":
+		scans, err := g.scans(r)
+		if err != nil {
+			return nil, err
+		}
+		col("Time", "time")
+		col("Type", "string")
+		col("File", "string")
+		col("Hosts", "number")
+		col("Uploaded by", "string")
+		for _, s := range scans {
+			t.Rows = append(t.Rows, []interface{}{timeMillis(stringField(s, "scanDate")), stringField(s, "scanType"),
+				stringField(s, "filename"), int64(numberField(s, "hostCount")), stringField(s, "uploadedBy")})
+		}
+	case "table.severity":
+		s, err := g.stats()
+		if err != nil {
+			return nil, err
+		}
+		col("Severity", "string")
+		col("Count", "number")
+		for _, sev := range severityOrder {
+			t.Rows = append(t.Rows, []interface{}{sev, s.VulnsBySeverity[sev]})
+		}
+	case "table.asset-types":
+		s, err := g.stats()
+		if err != nil {
+			return nil, err
+		}
+		col("Type", "string")
+		col("Count", "number")
+		types := make([]string, 0, len(s.AssetsByType))
+		for typ := range s.AssetsByType {
+			types = append(types, typ)
+		}
+		sort.Slice(types, func(i, j int) bool { return s.AssetsByType[types[i]] > s.AssetsByType[types[j]] })
+		for _, typ := range types {
+			t.Rows = append(t.Rows, []interface{}{typ, s.AssetsByType[typ]})
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown target %q", errGrafanaRequest, target)
+	}
+	return t, nil
+}
+
+// maxAnnotations bounds one annotation response; Grafana does not draw
+// thousands of markers usefully.
+const maxAnnotations = 1000
+
+// annotations answers "scans" (the default) and "findings" or
+// "findings:<SEVERITY>", which mark when open findings were first seen.
+func (g *grafanaServer) annotations(query string, r grafanaRange, raw json.RawMessage) ([]grafanaAnnotation, error) {
+	out := []grafanaAnnotation{}
+	kind, severity, _ := strings.Cut(strings.TrimSpace(query), ":")
+	switch strings.ToLower(kind) {
+	case "", "scans":
+		scans, err := g.scans(r)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range scans {
+			ts, ok := parseServerTime(stringField(s, "scanDate"))
+			if !ok || ts.Before(r.From) || ts.After(r.To) {
+				continue
+			}
+			out = append(out, grafanaAnnotation{
+				Annotation: raw,
+				Time:       ts.UnixMilli(),
+				Title:      fmt.Sprintf("%s scan: %s", stringField(s, "scanType"), stringField(s, "filename")),
+				Text:       fmt.Sprintf("%d host(s), uploaded by %s", int64(numberField(s, "hostCount")), stringField(s, "uploadedBy")),
+				Tags:       []string{"scan", stringField(s, "scanType")},
+			})
+		}
+	case "findings":
+		findings, err := g.list("get_vulnerabilities", "vulnerabilities")
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range findings {
+			sev := strings.ToUpper(stringField(f, "cvssSeverity"))
+			if severity != "" && !strings.EqualFold(sev, severity) {
+				continue
+			}
+			ts, ok := firstSeen(f)
+			if !ok || ts.Before(r.From) || ts.After(r.To) {
+				continue
+			}
+			cve := stringField(f, "vulnerabilityId")
+			days, _ := parseDays(stringField(f, "daysOpen"))
+			out = append(out, grafanaAnnotation{
+				Annotation: raw,
+				Time:       ts.UnixMilli(),
+				Title:      fmt.Sprintf("%s %s on %s", sev, cve, stringField(f, "assetName")),
+				Text:       fmt.Sprintf("Finding %d, open %d day(s)", int64(numberField(f, "id")), days),
+				Tags:       []string{"finding", sev, cve},
+			})
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown annotation query %q (use scans, findings or findings:<SEVERITY>)", errGrafanaRequest, query)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Time < out[j].Time })
+	if len(out) > maxAnnotations {
+		out = out[len(out)-maxAnnotations:]
+	}
+	return out, nil
+}
+
+func writeGrafanaJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// grafanaError reports a failure in a form Grafana shows on the panel.
+func grafanaError(w http.ResponseWriter, err error) {
+	code := http.StatusBadGateway
+	if errors.Is(err, errGrafanaRequest) {
+		code = http.StatusBadRequest
+	}
+	writeGrafanaJSON(w, code, map[string]string{"error": redactString(err.Error()), "message": redactString(err.Error())})
+}
+
+// decodeGrafana reads a JSON request body of at most 1 MiB. An empty body is
+// allowed, since /search and /metrics may be posted without one.
+func decodeGrafana(r *http.Request, v interface{}) error {
+	err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(v)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%w: %v", errGrafanaRequest, err)
+	}
+	return nil
+}
+
+func (g *grafanaServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		writeGrafanaJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	mux.HandleFunc("/search", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Target string `json:"target"`
+		}
+		if err := decodeGrafana(r, &req); err != nil {
+			grafanaError(w, err)
+			return
+		}
+		names := []string{}
+		for _, t := range grafanaTargets {
+			if strings.Contains(t.name, req.Target) {
+				names = append(names, t.name)
+			}
+		}
+		writeGrafanaJSON(w, http.StatusOK, names)
+	})
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		metrics := []map[string]string{}
+		for _, t := range grafanaTargets {
+			metrics = append(metrics, map[string]string{"label": t.name, "value": t.name, "text": t.help})
+		}
+		writeGrafanaJSON(w, http.StatusOK, metrics)
+	})
+	mux.HandleFunc("/metric-payload-options", func(w http.ResponseWriter, r *http.Request) {
+		writeGrafanaJSON(w, http.StatusOK, []interface{}{})
+	})
+	mux.HandleFunc("/query", func(w http.ResponseWriter, r *http.Request) {
+		var q grafanaQuery
+		if err := decodeGrafana(r, &q); err != nil {
+			grafanaError(w, err)
+			return
+		}
+		out := []interface{}{}
+		for _, t := range q.Targets {
+			if t.Hide || t.Target == "" {
+				continue
+			}
+			var result interface{}
+			var err error
+			if strings.HasPrefix(t.Target, "table.") {
+				var table *grafanaTable
+				if table, err = g.table(t.Target, q.Range); err == nil {
+					table.RefID = t.RefID
+					result = table
+				}
+			} else {
+				var series *grafanaSeries
+				if series, err = g.series(t.Target, &q); err == nil {
+					series.RefID = t.RefID
+					result = series
+				}
+			}
+			if err != nil {
+				grafanaError(w, err)
+				return
+			}
+			out = append(out, result)
+		}
+		writeGrafanaJSON(w, http.StatusOK, out)
+	})
+	mux.HandleFunc("/annotations", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Range      grafanaRange    `json:"range"`
+			Annotation json.RawMessage `json:"annotation"`
+		}
+		if err := decodeGrafana(r, &req); err != nil {
+			grafanaError(w, err)
+			return
+		}
+		var a struct {
+			Query string `json:"query"`
+		}
+		json.Unmarshal(req.Annotation, &a)
+		out, err := g.annotations(a.Query, req.Range, req.Annotation)
+		if err != nil {
+			grafanaError(w, err)
+			return
+		}
+		writeGrafanaJSON(w, http.StatusOK, out)
+	})
+	// Infinity reads rows as objects keyed by column name. Tables that
+	// depend on a range (scans) default to the last 30 days, or take
+	// ?from= and ?to= in RFC 3339 or as Unix milliseconds.
+	mux.HandleFunc("/tables/", func(w http.ResponseWriter, r *http.Request) {
+		rng := grafanaRange{From: time.Now().AddDate(0, 0, -30), To: time.Now()}
+		for _, p := range []struct {
+			name string
+			t    *time.Time
+		}{{"from", &rng.From}, {"to", &rng.To}} {
+			v := r.URL.Query().Get(p.name)
+			if v == "" {
+				continue
+			}
+			if ms, err := strconv.ParseInt(v, 10, 64); err == nil {
+				*p.t = time.UnixMilli(ms)
+			} else if t, err := time.Parse(time.RFC3339, v); err == nil {
+				*p.t = t
+			} else {
+				grafanaError(w, fmt.Errorf("%w: invalid %s %q", errGrafanaRequest, p.name, v))
+				return
+			}
+		}
+		table, err := g.table("table."+strings.TrimPrefix(r.URL.Path, "/tables/"), rng)
+		if err != nil {
+			if errors.Is(err, errGrafanaRequest) {
+				http.NotFound(w, r)
+				return
+			}
+			grafanaError(w, err)
+			return
+		}
+		rows := make([]map[string]interface{}, 0, len(table.Rows))
+		for _, row := range table.Rows {
+			m := make(map[string]interface{}, len(row))
+			for i, c := range table.Columns {
+				if c.Type == "time" && row[i] != nil {
+					m[c.Text] = time.UnixMilli(row[i].(int64)).UTC().Format(time.RFC3339)
+					continue
+				}
+				m[c.Text] = row[i]
+			}
+			rows = append(rows, m)
+		}
+		writeGrafanaJSON(w, http.StatusOK, rows)
+	})
+
+	if g.token == "" {
+		return mux
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		want := "Bearer " + g.token
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(want)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="secman"`)
+			writeGrafanaJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized", "message": "unauthorized"})
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func cmdServeGrafana(client *McpClient, osArgs []string) {
+	fs := flag.NewFlagSet("serve-grafana", flag.ContinueOnError)
+	listen := fs.String("listen", settingOr("SECMAN_GRAFANA_LISTEN", "127.0.0.1:3003"), "Address to listen on")
+	ttl := fs.Duration("cache", time.Minute, "How long server data is reused between queries")
+	shutdownTimeout := addShutdownFlag(fs)
+	parseFlags(fs, osArgs)
+
+	token := setting("SECMAN_GRAFANA_TOKEN")
+	registerSecret(token)
+	if token == "" && !strings.HasPrefix(*listen, "127.0.0.1:") && !strings.HasPrefix(*listen, "localhost:") && !strings.HasPrefix(*listen, "[::1]:") {
+		warnf("Warning: %s is reachable from other hosts and SECMAN_GRAFANA_TOKEN is not set; anyone who can connect reads Secman data\n", *listen)
+	}
+
+	g := &grafanaServer{client: client, ttl: *ttl, token: token, cache: map[string]grafanaCached{}}
+	server := &http.Server{
+		Addr:              *listen,
+		Handler:           g.handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	ln, err := net.Listen("tcp", *listen)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(ExitUsage)
+	}
+	status(nil, "Serving the Grafana JSON datasource on http://%s\n", *listen)
+
+	// A stop signal closes the listener and waits for the queries being
+	// answered.
+	group := newRunGroup(*shutdownTimeout)
+	group.Go(func(ctx context.Context) error {
+		served := make(chan error, 1)
+		go func() { served <- server.Serve(ln) }()
+		select {
+		case err := <-served:
+			return err
+		case <-ctx.Done():
+			return server.Shutdown(context.Background())
+		}
+	})
+	if err := group.Wait(); err != nil {
+		fatal(err)
+	}
+}
@@ -0,0 +1,571 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/schmalle/secman/scripts/mcp/importer"
+)
+
+// enrich hibp checks the e-mail addresses of Secman users against Have I
+// Been Pwned and raises a finding for every account in a breach added
+// since --since. Each account is an IDENTITY asset named by its address and
+// owned by the user, so breached accounts rank, age and report like any
+// other finding. The finding is HIBP- and the breach name, e.g.
+// HIBP-ADOBE; checking again updates it.
+//
+// With --domain the addresses come from one domain search per domain,
+// which needs the domain verified in the HIBP dashboard; without it every
+// address is looked up on its own. Both need SECMAN_HIBP_API_KEY.
+// --dataset reads a local breach dataset instead: HIBP's domain search
+// JSON, a list of {email, breach, date, dataClasses} objects, or a CSV with
+// such columns. Breaches without a date or data classes there are looked
+// up in the public breach catalog.
+//
+// The severity follows what leaked:
+//
+//	CRITICAL  passwords, and the user has no MFA
+//	HIGH      passwords
+//	MEDIUM    password hints, security questions or auth tokens
+//	LOW       anything else, such as names and addresses
+
+const hibpURL = "https://haveibeenpwned.com/api/v3"
+
+// hibpCredentialClasses are data classes that help take over an account
+// without the password itself.
+var hibpCredentialClasses = []string{"Password hints", "Security questions and answers", "Auth tokens"}
+
+// hibpBreach is a breach as the HIBP API describes it.
+type hibpBreach struct {
+	Name        string   `json:"Name"`
+	Title       string   `json:"Title"`
+	Domain      string   `json:"Domain"`
+	BreachDate  string   `json:"BreachDate"`
+	AddedDate   string   `json:"AddedDate"`
+	DataClasses []string `json:"DataClasses"`
+	IsSpamList  bool     `json:"IsSpamList"`
+	Fabricated  bool     `json:"IsFabricated"`
+}
+
+// added is when the breach became known, or when it happened; zero when
+// neither is known.
+func (b *hibpBreach) added() time.Time {
+	for _, s := range []string{b.AddedDate, b.BreachDate} {
+		if t, ok := parseServerTime(s); ok {
+			return t
+		}
+		if t, err := time.Parse("2006-01-02", s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// hibpExposure is one account in one breach.
+type hibpExposure struct {
+	Email       string   `json:"email"`
+	Username    string   `json:"username"`
+	MFA         bool     `json:"mfaEnabled"`
+	Breach      string   `json:"breach"`
+	Title       string   `json:"title,omitempty"`
+	Added       string   `json:"added,omitempty"`
+	DataClasses []string `json:"dataClasses,omitempty"`
+	Severity    string   `json:"severity"`
+	FindingID   string   `json:"vulnerabilityId"`
+	SecmanID    int64    `json:"secmanId,omitempty"`
+	Status      string   `json:"status"`
+	Error       string   `json:"error,omitempty"`
+}
+
+// hibpSeverity rates what a breach exposed of an account.
+func hibpSeverity(classes []string, mfa bool) string {
+	switch {
+	case containsFold(classes, "Passwords") && !mfa:
+		return "CRITICAL"
+	case containsFold(classes, "Passwords"):
+		return "HIGH"
+	}
+	for _, c := range hibpCredentialClasses {
+		if containsFold(classes, c) {
+			return "MEDIUM"
+		}
+	}
+	return "LOW"
+}
+
+type hibpClient struct {
+	baseURL string
+	key     string
+	http    *http.Client
+}
+
+func newHIBPClient(client *McpClient) *hibpClient {
+	h := &hibpClient{
+		baseURL: strings.TrimRight(settingOr("SECMAN_HIBP_URL", hibpURL), "/"),
+		key:     setting("SECMAN_HIBP_API_KEY"),
+		http:    externalHTTPClient(client, 60*time.Second),
+	}
+	if h.key != "" {
+		registerSecret(h.key)
+	}
+	return h
+}
+
+// get decodes an API path into out. A 404 means nothing was found and
+// leaves out alone; a 429 is retried after the wait the API asks for.
+func (h *hibpClient) get(path string, out interface{}) error {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest(http.MethodGet, h.baseURL+path, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("User-Agent", userAgent())
+		if h.key != "" {
+			req.Header.Set("hibp-api-key", h.key)
+		}
+		resp, err := h.http.Do(req)
+		if err != nil {
+			return fmt.Errorf("hibp: %w", err)
+		}
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("hibp: read response: %w", err)
+		}
+		switch {
+		case resp.StatusCode == http.StatusNotFound:
+			return nil
+		case resp.StatusCode == http.StatusTooManyRequests && attempt < 5:
+			wait, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+			time.Sleep(time.Duration(max(wait, 1)) * time.Second)
+			continue
+		case resp.StatusCode/100 != 2:
+			msg := http.StatusText(resp.StatusCode)
+			var body map[string]interface{}
+			if json.Unmarshal(data, &body) == nil && stringField(body, "message") != "" {
+				msg = stringField(body, "message")
+			}
+			return &HTTPError{StatusCode: resp.StatusCode, Body: "hibp: " + msg}
+		}
+		if err := json.Unmarshal(data, out); err != nil {
+			return fmt.Errorf("hibp: invalid response: %w", err)
+		}
+		return nil
+	}
+}
+
+// catalog returns all breaches by lower-case name. It needs no key.
+func (h *hibpClient) catalog() (map[string]*hibpBreach, error) {
+	var breaches []*hibpBreach
+	if err := h.get("/breaches", &breaches); err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*hibpBreach, len(breaches))
+	for _, b := range breaches {
+		byName[strings.ToLower(b.Name)] = b
+	}
+	return byName, nil
+}
+
+// domain returns the breach names of each breached address of a domain.
+func (h *hibpClient) domain(domain string) (map[string][]string, error) {
+	aliases := map[string][]string{}
+	if err := h.get("/breacheddomain/"+url.PathEscape(domain), &aliases); err != nil {
+		return nil, err
+	}
+	out := make(map[string][]string, len(aliases))
+	for alias, names := range aliases {
+		out[strings.ToLower(alias+"@"+domain)] = names
+	}
+	return out, nil
+}
+
+// account returns the breaches of one address.
+func (h *hibpClient) account(email string) ([]*hibpBreach, error) {
+	var breaches []*hibpBreach
+	err := h.get("/breachedaccount/"+url.PathEscape(email)+"?truncateResponse=false&includeUnverified=true", &breaches)
+	return breaches, err
+}
+
+// hibpDatasetColumns name the columns of a CSV breach dataset.
+var (
+	hibpEmailColumns   = []string{"email", "e-mail", "email address", "account", "address"}
+	hibpBreachColumns  = []string{"breach", "breach name", "name", "source"}
+	hibpDateColumns    = []string{"added", "addeddate", "added date", "date", "breachdate", "breach date"}
+	hibpClassesColumns = []string{"dataclasses", "data classes", "data", "exposed"}
+)
+
+// readHIBPDataset reads a local breach dataset into the breaches of each
+// address. Aliases without a domain, as in a domain search, take domain.
+func readHIBPDataset(path, domain string) (map[string][]*hibpBreach, error) {
+	data, err := readTextFile(path)
+	if err != nil {
+		return nil, err
+	}
+	out := map[string][]*hibpBreach{}
+	add := func(email string, b *hibpBreach) {
+		email = strings.ToLower(strings.TrimSpace(email))
+		if email == "" || b.Name == "" {
+			return
+		}
+		if !strings.Contains(email, "@") {
+			if domain == "" {
+				return
+			}
+			email += "@" + domain
+		}
+		out[email] = append(out[email], b)
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		var aliases map[string][]string
+		if err := json.Unmarshal(trimmed, &aliases); err != nil {
+			return nil, fmt.Errorf("%s: expected a domain search (alias: [breach, ...]): %w", path, err)
+		}
+		for alias, names := range aliases {
+			for _, name := range names {
+				add(alias, &hibpBreach{Name: name})
+			}
+		}
+		return out, nil
+	}
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var rows []map[string]interface{}
+		if err := json.Unmarshal(trimmed, &rows); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		for _, row := range rows {
+			b := &hibpBreach{Name: firstString(row, "breach", "name", "Name"), AddedDate: firstString(row, "added", "date", "addedDate", "AddedDate"),
+				BreachDate: firstString(row, "breachDate", "BreachDate")}
+			for _, key := range []string{"dataClasses", "DataClasses"} {
+				if classes, ok := row[key].([]interface{}); ok {
+					for _, c := range classes {
+						b.DataClasses = append(b.DataClasses, fmt.Sprint(c))
+					}
+				}
+			}
+			add(firstString(row, "email", "account", "alias"), b)
+		}
+		return out, nil
+	}
+
+	firstLine, _, _ := bytes.Cut(trimmed, []byte("\n"))
+	header := csvHeader(string(firstLine))
+	email, breach := columnIndex(header, hibpEmailColumns), columnIndex(header, hibpBreachColumns)
+	if email < 0 || breach < 0 {
+		return nil, fmt.Errorf("%s: expected JSON or a CSV with email and breach columns", path)
+	}
+	date, classes := columnIndex(header, hibpDateColumns), columnIndex(header, hibpClassesColumns)
+	cr := csv.NewReader(bytes.NewReader(trimmed))
+	if strings.Count(string(firstLine), ";") > strings.Count(string(firstLine), ",") {
+		cr.Comma = ';'
+	}
+	cr.FieldsPerRecord = -1
+	if _, err := cr.Read(); err != nil {
+		return nil, err
+	}
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		b := &hibpBreach{Name: cell(rec, breach), AddedDate: cell(rec, date)}
+		if c := cell(rec, classes); c != "" {
+			for _, class := range strings.FieldsFunc(c, func(r rune) bool { return r == ';' || r == ',' || r == '|' }) {
+				b.DataClasses = append(b.DataClasses, strings.TrimSpace(class))
+			}
+		}
+		add(cell(rec, email), b)
+	}
+	return out, nil
+}
+
+func firstString(m map[string]interface{}, keys ...string) string {
+	for _, k := range keys {
+		if s := stringField(m, k); s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+func cmdEnrich(client *McpClient, osArgs []string) {
+	if len(osArgs) < 1 {
+		fmt.Fprintln(os.Stderr, "Error: enrich source required")
+		fmt.Fprintf(os.Stderr, "Usage: %s enrich hibp [--domain example.com] ...\n", progName())
+		exit(ExitUsage)
+	}
+	switch osArgs[0] {
+	case "hibp":
+		cmdEnrichHIBP(client, osArgs[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown enrich source: %s (supported: hibp)\n", osArgs[0])
+		exit(ExitUsage)
+	}
+}
+
+func cmdEnrichHIBP(client *McpClient, osArgs []string) {
+	fs := flag.NewFlagSet("enrich hibp", flag.ContinueOnError)
+	domains := fs.String("domain", "", "Only users with addresses in these domains, comma-separated; searched as a whole")
+	since := fs.String("since", "365d", "Only breaches added since this time")
+	dataset := fs.String("dataset", "", "Local breach dataset (JSON or CSV) to use instead of the HIBP API")
+	report := fs.Bool("report", false, "Only list the breached accounts; raise no findings")
+	asJSON := fs.Bool("json", false, "Print the breached accounts as JSON")
+	yes := addYesFlag(fs)
+	parseFlags(fs, osArgs)
+
+	now := time.Now()
+	from, err := parseTimeExpr(*since, now)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --since: %v\n", err)
+		exit(ExitUsage)
+	}
+	domainList := splitList(strings.ToLower(*domains))
+	h := newHIBPClient(client)
+	if *dataset == "" && h.key == "" {
+		fmt.Fprintln(os.Stderr, "Error: SECMAN_HIBP_API_KEY is required, or --dataset with a local breach dataset")
+		exit(ExitUsage)
+	}
+	if *dataset != "" && len(domainList) > 1 {
+		fmt.Fprintln(os.Stderr, "Error: --dataset takes at most one --domain, the domain of its aliases")
+		exit(ExitUsage)
+	}
+	if err := client.requireTool("list_users"); err != nil {
+		fatal(err)
+	}
+
+	// The users to check, by lower-case address.
+	content, err := client.callToolMap("list_users", map[string]interface{}{})
+	if err != nil {
+		fatal(err)
+	}
+	users := map[string]map[string]interface{}{}
+	for _, u := range mapsField(content, "users") {
+		email := strings.ToLower(strings.TrimSpace(stringField(u, "email")))
+		_, domain, ok := strings.Cut(email, "@")
+		if !ok || (len(domainList) > 0 && !containsFold(domainList, domain)) {
+			continue
+		}
+		users[email] = u
+	}
+	if len(users) == 0 {
+		status(0, "No users with an address to check\n")
+		return
+	}
+
+	// The breaches of each address, from the dataset, the domain search or
+	// one lookup per address.
+	breached := map[string][]*hibpBreach{}
+	var catalog map[string]*hibpBreach
+	lookup := func() {
+		if catalog != nil {
+			return
+		}
+		if catalog, err = h.catalog(); err != nil {
+			warnf("Warning: breach catalog: %v; breaches without a date count as recent\n", err)
+			catalog = map[string]*hibpBreach{}
+		}
+	}
+	switch {
+	case *dataset != "":
+		domain := ""
+		if len(domainList) == 1 {
+			domain = domainList[0]
+		}
+		if breached, err = readHIBPDataset(*dataset, domain); err != nil {
+			fatal(err)
+		}
+	case len(domainList) > 0:
+		for _, domain := range domainList {
+			names, err := h.domain(domain)
+			if err != nil {
+				fatal(fmt.Errorf("domain %s: %w", domain, err))
+			}
+			for email, list := range names {
+				for _, name := range list {
+					breached[email] = append(breached[email], &hibpBreach{Name: name})
+				}
+			}
+		}
+	default:
+		emails := make([]string, 0, len(users))
+		for email := range users {
+			emails = append(emails, email)
+		}
+		sort.Strings(emails)
+		progress := startProgress("Checking accounts", "accounts", int64(len(emails)))
+		for _, email := range emails {
+			breaches, err := h.account(email)
+			progress.Add(1)
+			if err != nil {
+				progress.Finish()
+				fatal(fmt.Errorf("%s: %w", email, err))
+			}
+			breached[email] = breaches
+		}
+		progress.Finish()
+	}
+
+	var exposures []*hibpExposure
+	others := 0
+	for email, breaches := range breached {
+		u := users[email]
+		if u == nil {
+			others++
+			continue
+		}
+		mfa, _ := u["mfaEnabled"].(bool)
+		seen := map[string]bool{}
+		for _, b := range breaches {
+			key := strings.ToLower(b.Name)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			if b.added().IsZero() || b.DataClasses == nil {
+				lookup()
+				if c := catalog[key]; c != nil {
+					b = c
+				}
+			}
+			if b.IsSpamList || b.Fabricated {
+				continue
+			}
+			added := b.added()
+			if !added.IsZero() && added.Before(from) {
+				continue
+			}
+			e := &hibpExposure{Email: email, Username: stringField(u, "username"), MFA: mfa, Breach: b.Name, Title: b.Title,
+				DataClasses: b.DataClasses, Severity: hibpSeverity(b.DataClasses, mfa), Status: "pending",
+				FindingID: "HIBP-" + findingSlugPattern.ReplaceAllString(strings.ToUpper(b.Name), "-")}
+			if !added.IsZero() {
+				e.Added = added.Format("2006-01-02")
+			}
+			exposures = append(exposures, e)
+		}
+	}
+	sort.Slice(exposures, func(i, j int) bool {
+		a, b := exposures[i], exposures[j]
+		if severityRank(a.Severity) != severityRank(b.Severity) {
+			return severityRank(a.Severity) > severityRank(b.Severity)
+		}
+		if a.Email != b.Email {
+			return a.Email < b.Email
+		}
+		return a.Breach < b.Breach
+	})
+	accounts := map[string]bool{}
+	for _, e := range exposures {
+		accounts[e.Email] = true
+	}
+
+	if !rawOutput(*asJSON) {
+		if len(exposures) > 0 {
+			fmt.Printf("%-32s %-24s %-10s %-10s %s\n", "ACCOUNT", "BREACH", "ADDED", "SEVERITY", "DATA")
+			for _, e := range exposures {
+				fmt.Printf("%-32s %-24s %-10s %s %s\n", truncate(e.Email, 32), truncate(e.Breach, 24), orNone(e.Added),
+					severityCell(e.Severity, 10), truncate(strings.Join(e.DataClasses, ", "), 60))
+			}
+			fmt.Println()
+		}
+		fmt.Printf("%d of %d account(s) in %d breach(es) since %s\n", len(accounts), len(users), len(exposures), from.Format("2006-01-02"))
+		if others > 0 {
+			fmt.Printf("%d breached address(es) are not Secman users\n", others)
+		}
+	}
+	if *report || len(exposures) == 0 {
+		if rawOutput(*asJSON) {
+			printResult(exposures)
+		}
+		return
+	}
+
+	if err := client.requireTool("add_vulnerability"); err != nil {
+		fatal(err)
+	}
+	assets, err := listAll(client, "get_assets", "assets", map[string]interface{}{}, 500)
+	if err != nil {
+		fatal(err)
+	}
+	existing := map[string]bool{}
+	for _, a := range assets {
+		existing[strings.ToLower(stringField(a, "name"))] = true
+	}
+	newAssets := 0
+	for email := range accounts {
+		if !existing[email] {
+			newAssets++
+		}
+	}
+	summary := []string{fmt.Sprintf("%d finding(s) on %d account(s)", len(exposures), len(accounts))}
+	if newAssets > 0 {
+		summary = append(summary, fmt.Sprintf("%d IDENTITY asset(s) do not exist and will be created", newAssets))
+	}
+	if err := confirm(client, *yes, "raise breach findings", summary); err != nil {
+		fatal(err)
+	}
+
+	// add_vulnerability would create missing assets as well, but not as
+	// identities.
+	createIdentities, _ := client.HasTool("create_asset")
+	raised, failed := 0, 0
+	progress := startProgress("Raising findings", "findings", int64(len(exposures)))
+	defer progress.Finish()
+	for _, e := range exposures {
+		if createIdentities && !existing[e.Email] {
+			_, err := client.callToolMap("create_asset", map[string]interface{}{"name": e.Email, "type": "IDENTITY",
+				"owner": e.Username, "description": "Account of Secman user " + e.Username})
+			if err != nil {
+				progress.Warnf("  %s: create asset: %v\n", e.Email, err)
+			}
+			existing[e.Email] = true
+		}
+		f := importer.Finding{Hostname: e.Email, CVE: e.FindingID, Severity: e.Severity, Scanner: "hibp"}
+		if added, err := time.Parse("2006-01-02", e.Added); err == nil {
+			f.DaysOpen = int(now.Sub(added).Hours() / 24)
+		}
+		f.ExternalID = importer.ExternalID(f)
+		args := findingArgs(client, f)
+		args["owner"] = e.Username
+		out, err := client.callToolMap("add_vulnerability", args)
+		progress.Add(1)
+		if err != nil {
+			progress.Warnf("  %s %s: %v\n", e.Email, e.FindingID, err)
+			e.Status, e.Error = "failed", err.Error()
+			failed++
+			continue
+		}
+		if client.dryRun {
+			e.Status = "dry-run"
+			continue
+		}
+		e.SecmanID, e.Status = int64(numberField(out, "id")), "raised"
+		raised++
+	}
+	progress.Finish()
+
+	if rawOutput(*asJSON) {
+		printResult(exposures)
+	}
+	status(raised, "Raised %d breach finding(s) on %d account(s)\n", raised, len(accounts))
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d finding(s) could not be raised\n", failed)
+		exit(ExitPartial)
+	}
+}
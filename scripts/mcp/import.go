@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/schmalle/secman/scripts/mcp/config"
+	"github.com/schmalle/secman/scripts/mcp/importer"
+	_ "github.com/schmalle/secman/scripts/mcp/importer/csvfindings"
+	"github.com/schmalle/secman/scripts/mcp/importer/execplugin"
+	_ "github.com/schmalle/secman/scripts/mcp/importer/nmap"
+)
+
+// import hands each file to the format that detects it (or --format); the
+// formats live in package importer and its subpackages. Executables named
+// secman-import-<format> in SECMAN_IMPORT_PLUGINS (default: importers/ in
+// the config directory) add formats without rebuilding the client.
+// import dhcp-leases and import arp compare devices on the network with the
+// inventory; see leases.go.
+//
+// Findings are added by --workers goroutines at a time. A finding the
+// server refuses does not stop the import; --error-report writes the
+// failed ones as CSV in the csv format's columns, with the file and error
+// added, so importing the report retries just those.
+
+// importPluginDirs lists the directories searched for plugin executables.
+func importPluginDirs() []string {
+	if v := setting("SECMAN_IMPORT_PLUGINS"); v != "" {
+		return filepath.SplitList(v)
+	}
+	dir, err := config.Dir()
+	if err != nil {
+		return nil
+	}
+	return []string{filepath.Join(dir, "importers")}
+}
+
+func registerImportPlugins() {
+	for _, dir := range importPluginDirs() {
+		if _, err := execplugin.RegisterDir(dir); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: import plugins in %s: %v\n", dir, err)
+		}
+	}
+}
+
+// clientSink uploads through the MCP client, so dry-run, the audit log and
+// the severity map apply to imports like to any other call.
+type clientSink struct {
+	client      *McpClient
+	onDuplicate string
+	workers     int
+	// bulk is the server's bulk tool for add_vulnerability, if any.
+	bulk *bulkRoute
+}
+
+func (s clientSink) Workers() int { return s.workers }
+
+func (s clientSink) BatchSize() int {
+	if s.bulk == nil {
+		return 1
+	}
+	return s.bulk.size
+}
+
+func (s clientSink) AddFindings(ctx context.Context, fs []importer.Finding) []error {
+	records := make([]map[string]interface{}, len(fs))
+	for i, f := range fs {
+		records[i] = findingArgs(s.client, f)
+	}
+	return s.client.callBulk(ctx, s.bulk, records)
+}
+
+func (s clientSink) AddFinding(_ context.Context, f importer.Finding) error {
+	_, err := s.client.callToolMap("add_vulnerability", findingArgs(s.client, f))
+	return err
+}
+
+// findingArgs are the add_vulnerability arguments of a finding.
+func findingArgs(client *McpClient, f importer.Finding) map[string]interface{} {
+	args := map[string]interface{}{
+		"hostname":    f.Hostname,
+		"cve":         f.CVE,
+		"criticality": strings.ToUpper(f.Severity),
+	}
+	if f.DaysOpen > 0 {
+		args["daysOpen"] = f.DaysOpen
+	}
+	// The severity map reads scanner and cvss and drops them again when
+	// add_vulnerability does not take them.
+	if ok, _ := client.toolAccepts("add_vulnerability", "scanner"); (ok || client.severityMap != nil) && f.Scanner != "" {
+		args["scanner"] = f.Scanner
+	}
+	if ok, _ := client.toolAccepts("add_vulnerability", "cvss"); (ok || client.severityMap != nil) && f.CVSS != nil {
+		args["cvss"] = *f.CVSS
+	}
+	// Servers that key findings by asset and CVE only do not take the
+	// external id; imports are idempotent there for CVE findings anyway.
+	if ok, _ := client.toolAccepts("add_vulnerability", "externalId"); ok && f.ExternalID != "" {
+		args["externalId"] = f.ExternalID
+	}
+	return args
+}
+
+func (s clientSink) UploadArtifact(_ context.Context, path, scanType string) (interface{}, bool, error) {
+	if err := s.client.requireTool("start_scan_upload"); err != nil {
+		return nil, false, err
+	}
+	done, skipped, err := uploadScanOnce(s.client, scanStatePath(), path, scanType, s.onDuplicate, defaultEvidenceChunkSize)
+	if err != nil || skipped {
+		return nil, skipped, err
+	}
+	return done["scanId"], false, nil
+}
+
+func cmdImport(client *McpClient, osArgs []string) {
+	registerImportPlugins()
+	if len(osArgs) > 0 {
+		switch osArgs[0] {
+		case "formats":
+			for _, name := range importer.Names() {
+				fmt.Println(name)
+			}
+			return
+		case "dhcp-leases":
+			cmdImportDevices(client, "dhcp", osArgs[1:])
+			return
+		case "arp":
+			cmdImportDevices(client, "arp", osArgs[1:])
+			return
+		}
+	}
+
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	format := fs.String("format", "", "Format of the files (default: detected per file; see import formats)")
+	onDuplicate := fs.String("on-duplicate", "skip", "When an identical scan artifact was imported before: skip, warn or fail")
+	workers := fs.Int("workers", 4, "Number of findings to upload at a time")
+	errorReport := fs.String("error-report", "", "Write the findings that failed to this CSV file, to import again later")
+	noBulk := fs.Bool("no-bulk", false, "Add findings one by one even when the server has a bulk tool")
+	files := parseInterspersed(fs, osArgs)
+
+	if len(files) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: file required")
+		fmt.Fprintf(os.Stderr, "Usage: %s import <file>... [--format name] [--on-duplicate skip|warn|fail] [--workers 4] [--error-report failed.csv] [--no-bulk]\n", progName())
+		exit(ExitUsage)
+	}
+	if *workers < 1 {
+		fmt.Fprintln(os.Stderr, "Error: --workers must be at least 1")
+		exit(ExitUsage)
+	}
+	switch *onDuplicate {
+	case "skip", "warn", "fail":
+	default:
+		fmt.Fprintln(os.Stderr, "Error: --on-duplicate must be skip, warn or fail")
+		exit(ExitUsage)
+	}
+	var forced importer.Importer
+	if *format != "" {
+		imp, ok := importer.Lookup(*format)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Error: unknown format %q (use %s)\n", *format, strings.Join(importer.Names(), ", "))
+			exit(ExitUsage)
+		}
+		forced = imp
+	}
+
+	sink := clientSink{client: client, onDuplicate: *onDuplicate, workers: *workers}
+	if !*noBulk {
+		if sink.bulk = client.bulkRoute("add_vulnerability"); sink.bulk != nil {
+			status(nil, "Sending findings through %s, %d at a time\n", sink.bulk.tool, sink.bulk.size)
+		}
+	}
+	imported, failed := 0, 0
+	var itemErrors []importItemError
+	for _, path := range files {
+		res, err := importFile(sink, forced, path)
+		for _, e := range res.Errors {
+			itemErrors = append(itemErrors, importItemError{path, e})
+		}
+		var dup *duplicateScanError
+		switch {
+		case errors.As(err, &dup):
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(ExitGateFailed)
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			failed++
+			continue
+		}
+		imported++
+		switch {
+		case res.Skipped:
+		case res.ScanID != nil:
+			status(res.ScanID, "Imported %s as scan %v\n", path, res.ScanID)
+		default:
+			status(res.Findings, "Imported %s: %d finding(s)\n", path, res.Findings)
+		}
+		if res.Failed > 0 {
+			fmt.Fprintf(os.Stderr, "%s: %d finding(s) failed\n", path, res.Failed)
+			failed++
+		}
+	}
+	if *errorReport != "" {
+		if err := writeImportErrorReport(*errorReport, itemErrors); err != nil {
+			fatal(err)
+		}
+		if len(itemErrors) > 0 {
+			fmt.Fprintf(os.Stderr, "Wrote %d failed finding(s) to %s\n", len(itemErrors), *errorReport)
+		}
+	}
+
+	if failed > 0 {
+		if imported > 0 {
+			exit(ExitPartial)
+		}
+		exit(ExitUsage)
+	}
+}
+
+// importFile detects, parses, maps and uploads one file.
+func importFile(sink importer.Sink, imp importer.Importer, path string) (importer.Result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return importer.Result{}, err
+	}
+	defer f.Close()
+	head := make([]byte, 4096)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return importer.Result{}, err
+	}
+	artifact := importer.Artifact{Path: path, Head: head[:n]}
+	if imp == nil {
+		var ok bool
+		if imp, ok = importer.Detect(artifact); !ok {
+			return importer.Result{}, fmt.Errorf("format not recognized (pass --format; see import formats)")
+		}
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return importer.Result{}, err
+	}
+	findings, err := importer.Findings(imp, f)
+	if err != nil {
+		return importer.Result{}, fmt.Errorf("%s: %w", imp.Name(), err)
+	}
+	return imp.Upload(context.Background(), sink, artifact, findings)
+}
+
+// importItemError is a failed finding and the file it came from.
+type importItemError struct {
+	file string
+	importer.ItemError
+}
+
+// writeImportErrorReport writes the failed findings as CSV. The file is
+// written, with just the header, when nothing failed, so a retry job never
+// picks up the failures of an earlier run.
+func writeImportErrorReport(path string, errs []importItemError) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	w.Write([]string{"hostname", "ip", "cve", "severity", "cvss", "scanner", "rule", "days open", "external id", "file", "error"})
+	for _, e := range errs {
+		cvss, days := "", ""
+		if e.Finding.CVSS != nil {
+			cvss = strconv.FormatFloat(*e.Finding.CVSS, 'f', -1, 64)
+		}
+		if e.Finding.DaysOpen > 0 {
+			days = strconv.Itoa(e.Finding.DaysOpen)
+		}
+		w.Write([]string{e.Finding.Hostname, e.Finding.IP, e.Finding.CVE, e.Finding.Severity, cvss,
+			e.Finding.Scanner, e.Finding.Rule, days, e.Finding.ExternalID, e.file, e.Error})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,154 @@
+// Package csvfindings imports findings from CSV with one finding per row,
+// such as a Nessus CSV export or a hand-made sheet. Columns are found by
+// their header, in any order and case:
+//
+//	host      hostname, host, asset, dns name, netbios name
+//	ip        ip, ip address
+//	cve       cve, cve id, vulnerabilityid
+//	severity  severity, risk, criticality
+//	cvss      cvss, cvss score, cvss v3.0 base score, cvss v2.0 base score
+//	scanner   scanner, source (default: nessus for Nessus exports, else csv)
+//	rule      plugin id, rule, rule id, check id
+//	days open days open, daysopen
+//	key       external id, externalid (as written by import --error-report)
+//
+// A cell may list several CVEs; each becomes a finding. Rows without a CVE,
+// or with severity None, are skipped.
+package csvfindings
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/schmalle/secman/scripts/mcp/importer"
+)
+
+func init() {
+	importer.Register(format{})
+}
+
+var columns = map[string][]string{
+	"host":     {"hostname", "host", "asset", "dns name", "netbios name"},
+	"ip":       {"ip", "ip address"},
+	"cve":      {"cve", "cve id", "vulnerabilityid"},
+	"severity": {"severity", "risk", "criticality"},
+	"cvss":     {"cvss", "cvss score", "cvss v3.0 base score", "cvss v2.0 base score"},
+	"scanner":  {"scanner", "source"},
+	"rule":     {"plugin id", "rule", "rule id", "check id"},
+	"daysopen": {"days open", "daysopen"},
+	"key":      {"external id", "externalid"},
+}
+
+type format struct {
+	importer.FindingUploader
+}
+
+func (format) Name() string { return "csv" }
+
+func (format) Detect(a importer.Artifact) bool {
+	if !strings.EqualFold(filepath.Ext(a.Path), ".csv") {
+		return false
+	}
+	line, _, _ := bytes.Cut(a.Head, []byte("\n"))
+	header := strings.ToLower(string(line))
+	return strings.Contains(header, "cve") && (strings.Contains(header, "host") || strings.Contains(header, "asset"))
+}
+
+// Parse keys each row by its lower-cased header.
+func (format) Parse(r io.Reader) ([]importer.Record, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("header: %w", err)
+	}
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(header[i], "\ufeff")))
+	}
+	nessus := false
+	for _, h := range header {
+		nessus = nessus || h == "plugin id"
+	}
+	var records []importer.Record
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		rec := importer.Record{}
+		for i, cell := range row {
+			if i < len(header) {
+				rec[header[i]] = strings.TrimSpace(cell)
+			}
+		}
+		if _, ok := rec["scanner"]; nessus && !ok {
+			rec["scanner"] = "nessus"
+		}
+		records = append(records, rec)
+	}
+}
+
+func field(rec importer.Record, name string) string {
+	for _, col := range columns[name] {
+		if v, ok := rec[col].(string); ok && v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func (format) Map(rec importer.Record) ([]importer.Finding, error) {
+	cves := strings.FieldsFunc(field(rec, "cve"), func(r rune) bool { return r == ',' || r == ';' || r == ' ' })
+	severity := strings.ToUpper(field(rec, "severity"))
+	if len(cves) == 0 || severity == "" || severity == "NONE" {
+		return nil, nil
+	}
+	host := field(rec, "host")
+	if host == "" {
+		host = field(rec, "ip")
+	}
+	if host == "" {
+		return nil, fmt.Errorf("no host or ip")
+	}
+	scanner := field(rec, "scanner")
+	if scanner == "" {
+		scanner = "csv"
+	}
+	var cvss *float64
+	if s := field(rec, "cvss"); s != "" {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("cvss %q: %w", s, err)
+		}
+		cvss = &v
+	}
+	daysOpen := 0
+	if s := field(rec, "daysopen"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("days open %q: %w", s, err)
+		}
+		daysOpen = v
+	}
+	out := make([]importer.Finding, 0, len(cves))
+	for _, cve := range cves {
+		out = append(out, importer.Finding{
+			Hostname: host, IP: field(rec, "ip"), CVE: strings.ToUpper(cve),
+			Severity: severity, CVSS: cvss, Scanner: scanner, Rule: field(rec, "rule"), DaysOpen: daysOpen,
+		})
+	}
+	// A key is only taken as is for a single CVE; several CVEs in one row
+	// each need their own.
+	if key := field(rec, "key"); key != "" && len(out) == 1 {
+		out[0].ExternalID = key
+	}
+	return out, nil
+}
@@ -0,0 +1,133 @@
+// Package execplugin adds import formats implemented as executables, in any
+// language. An executable named secman-import-<format> in a plugin
+// directory registers <format> and is run as:
+//
+//	secman-import-<format> detect <file>   exit 0 if it handles the file, 1 if not
+//	secman-import-<format> parse < file    print the findings as JSON
+//
+// parse prints a JSON array of findings, or one finding per line:
+//
+//	{"hostname": "web-01", "cve": "CVE-2024-1234", "severity": "HIGH", "cvss": 7.5, "scanner": "acme", "rule": "ACME-42"}
+//
+// rule is the scanner's check id and goes into the finding's external id;
+// a plugin may also set externalId itself.
+//
+// Anything written to stderr is passed through; a non-zero exit of parse
+// fails the import.
+package execplugin
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/schmalle/secman/scripts/mcp/importer"
+)
+
+// Prefix starts the name of every plugin executable.
+const Prefix = "secman-import-"
+
+// detectTimeout bounds a plugin's detect run.
+const detectTimeout = 10 * time.Second
+
+// RegisterDir registers every plugin executable in dir and returns their
+// format names. A missing directory has no plugins.
+func RegisterDir(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		name := strings.TrimSuffix(e.Name(), filepath.Ext(e.Name()))
+		if e.IsDir() || !strings.HasPrefix(name, Prefix) || name == Prefix {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || (info.Mode()&0o111 == 0 && filepath.Ext(e.Name()) != ".exe") {
+			continue
+		}
+		p := &plugin{name: strings.TrimPrefix(name, Prefix), path: filepath.Join(dir, e.Name())}
+		importer.Register(p)
+		names = append(names, p.name)
+	}
+	return names, nil
+}
+
+type plugin struct {
+	importer.FindingUploader
+	name, path string
+}
+
+func (p *plugin) Name() string { return p.name }
+
+func (p *plugin) Detect(a importer.Artifact) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), detectTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, p.path, "detect", a.Path)
+	cmd.Stderr = os.Stderr
+	return cmd.Run() == nil
+}
+
+// Parse runs the plugin on the artifact; each finding it prints is a record.
+func (p *plugin) Parse(r io.Reader) ([]importer.Record, error) {
+	cmd := exec.Command(p.path, "parse")
+	cmd.Stdin = r
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s parse: %w", filepath.Base(p.path), err)
+	}
+	out = bytes.TrimSpace(out)
+	var records []importer.Record
+	if len(out) > 0 && out[0] == '[' {
+		if err := json.Unmarshal(out, &records); err != nil {
+			return nil, fmt.Errorf("%s parse: %w", filepath.Base(p.path), err)
+		}
+		return records, nil
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16<<20)
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		var rec importer.Record
+		if err := json.Unmarshal(text, &rec); err != nil {
+			return nil, fmt.Errorf("%s parse: line %d: %w", filepath.Base(p.path), line, err)
+		}
+		records = append(records, rec)
+	}
+	return records, scanner.Err()
+}
+
+// Map reads a record in the Finding JSON shape.
+func (p *plugin) Map(rec importer.Record) ([]importer.Finding, error) {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	var f importer.Finding
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	if f.Hostname == "" || f.CVE == "" || f.Severity == "" {
+		return nil, fmt.Errorf("finding needs hostname, cve and severity")
+	}
+	if f.Scanner == "" {
+		f.Scanner = p.name
+	}
+	return []importer.Finding{f}, nil
+}
@@ -0,0 +1,278 @@
+// Package importer defines how scanner output becomes secman data. An
+// Importer handles one format in four steps:
+//
+//  1. Detect: does this file look like the format?
+//  2. Parse: read the file into the format's own records.
+//  3. Map: turn a record into findings in secman's terms.
+//  4. Upload: send the findings, or the artifact itself, through a Sink.
+//
+// Formats register themselves from an init function, so a new scanner is a
+// self-contained package the CLI imports for its side effect:
+//
+//	import _ "github.com/schmalle/secman/scripts/mcp/importer/nmap"
+//
+// Formats outside this module are added as executables; see package
+// execplugin.
+package importer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Record is one entry of a scanner's output, as the format sees it.
+type Record = map[string]interface{}
+
+// Finding is a vulnerability on a host, as add_vulnerability takes it.
+// Rule is the scanner's own check id (a Nessus plugin id, a Trivy rule), if
+// it has one. ExternalID is the finding's stable key; Findings fills it in.
+type Finding struct {
+	Hostname   string   `json:"hostname"`
+	IP         string   `json:"ip,omitempty"`
+	CVE        string   `json:"cve"`
+	Severity   string   `json:"severity"`
+	CVSS       *float64 `json:"cvss,omitempty"`
+	Scanner    string   `json:"scanner,omitempty"`
+	Rule       string   `json:"rule,omitempty"`
+	DaysOpen   int      `json:"daysOpen,omitempty"`
+	ExternalID string   `json:"externalId,omitempty"`
+}
+
+// ExternalID is the stable key of a finding: scanner, rule and asset, in
+// lower case, so importing the same output again updates the findings it
+// created instead of adding new ones. A finding without a rule is keyed by
+// its CVE; a rule reporting several CVEs gets one key per CVE.
+func ExternalID(f Finding) string {
+	scanner := strings.ToLower(strings.TrimSpace(f.Scanner))
+	if scanner == "" {
+		scanner = "unknown"
+	}
+	rule := strings.TrimSpace(f.Rule)
+	cve := strings.TrimSpace(f.CVE)
+	switch {
+	case rule == "":
+		rule = cve
+	case cve != "" && !strings.EqualFold(rule, cve):
+		rule += "/" + cve
+	}
+	asset := strings.TrimSpace(f.Hostname)
+	if asset == "" {
+		asset = strings.TrimSpace(f.IP)
+	}
+	return strings.ToLower(scanner + ":" + rule + ":" + asset)
+}
+
+// Artifact is a file offered for import. Head holds its first bytes for
+// Detect.
+type Artifact struct {
+	Path string
+	Head []byte
+}
+
+// Sink receives what an importer uploads. The CLI provides it; in dry-run
+// mode it only reports.
+type Sink interface {
+	AddFinding(ctx context.Context, f Finding) error
+	// UploadArtifact imports a raw scanner file the server parses itself
+	// (nmap, masscan). It returns the scan id, or skipped when the same
+	// artifact was imported before.
+	UploadArtifact(ctx context.Context, path, scanType string) (scanID interface{}, skipped bool, err error)
+}
+
+// ConcurrentSink is a Sink that takes findings from several goroutines at
+// once. FindingUploader uses Workers of them.
+type ConcurrentSink interface {
+	Sink
+	Workers() int
+}
+
+// BatchSink is a Sink that also takes findings in batches, such as through
+// a bulk tool of the server. FindingUploader uses it when BatchSize is
+// above 1.
+type BatchSink interface {
+	Sink
+	BatchSize() int
+	// AddFindings adds a batch and returns one error per finding, nil for
+	// those it took.
+	AddFindings(ctx context.Context, fs []Finding) []error
+}
+
+// ItemError is a finding the sink did not take.
+type ItemError struct {
+	Finding Finding `json:"finding"`
+	Error   string  `json:"error"`
+}
+
+// Result sums up one import. Errors lists the failed findings in file
+// order.
+type Result struct {
+	Findings int         `json:"findings"`
+	Failed   int         `json:"failed,omitempty"`
+	ScanID   interface{} `json:"scanId,omitempty"`
+	Skipped  bool        `json:"skipped,omitempty"`
+	Errors   []ItemError `json:"errors,omitempty"`
+}
+
+// Importer handles one scanner format.
+type Importer interface {
+	// Name is the format name users pass to --format.
+	Name() string
+	// Detect reports whether the artifact is in this format.
+	Detect(a Artifact) bool
+	// Parse reads the artifact into records.
+	Parse(r io.Reader) ([]Record, error)
+	// Map turns a record into findings; a record may yield none.
+	Map(rec Record) ([]Finding, error)
+	// Upload sends the mapped findings, or the artifact, to the sink.
+	Upload(ctx context.Context, sink Sink, a Artifact, findings []Finding) (Result, error)
+}
+
+// FindingUploader is the Upload of formats whose findings are added one by
+// one. Formats embed it.
+type FindingUploader struct{}
+
+// Upload adds every finding, with as many at a time as a ConcurrentSink
+// allows, in batches when the sink is a BatchSink; a failed finding does
+// not stop the others.
+func (FindingUploader) Upload(ctx context.Context, sink Sink, _ Artifact, findings []Finding) (Result, error) {
+	workers := 1
+	if cs, ok := sink.(ConcurrentSink); ok && cs.Workers() > 1 {
+		workers = cs.Workers()
+	}
+	size := 1
+	batches, isBatch := sink.(BatchSink)
+	if isBatch && batches.BatchSize() > 1 {
+		size = batches.BatchSize()
+	}
+	errs := make([]error, len(findings))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for start := range next {
+				end := start + size
+				if end > len(findings) {
+					end = len(findings)
+				}
+				if size == 1 {
+					errs[start] = sink.AddFinding(ctx, findings[start])
+					continue
+				}
+				copy(errs[start:end], batches.AddFindings(ctx, findings[start:end]))
+			}
+		}()
+	}
+	var ctxErr error
+	sent := 0
+	for sent < len(findings) {
+		if ctxErr = ctx.Err(); ctxErr != nil {
+			break
+		}
+		next <- sent
+		sent += size
+	}
+	close(next)
+	wg.Wait()
+	if sent > len(findings) {
+		sent = len(findings)
+	}
+
+	var res Result
+	for i, err := range errs[:sent] {
+		if err != nil {
+			res.Failed++
+			res.Errors = append(res.Errors, ItemError{Finding: findings[i], Error: err.Error()})
+			continue
+		}
+		res.Findings++
+	}
+	if ctxErr != nil {
+		return res, ctxErr
+	}
+	if res.Findings == 0 && len(res.Errors) > 0 {
+		e := res.Errors[0]
+		return res, fmt.Errorf("%s on %s: %s", e.Finding.CVE, e.Finding.Hostname, e.Error)
+	}
+	return res, nil
+}
+
+var (
+	mu        sync.RWMutex
+	importers = map[string]Importer{}
+)
+
+// Register adds a format. A later registration of the same name replaces
+// the earlier one, so a plugin can override a built-in format.
+func Register(imp Importer) {
+	mu.Lock()
+	defer mu.Unlock()
+	importers[strings.ToLower(imp.Name())] = imp
+}
+
+// Lookup returns the format registered under name.
+func Lookup(name string) (Importer, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	imp, ok := importers[strings.ToLower(name)]
+	return imp, ok
+}
+
+// Names lists the registered formats.
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(importers))
+	for name := range importers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Detect returns the format that recognizes the artifact, trying formats
+// by name.
+func Detect(a Artifact) (Importer, bool) {
+	for _, name := range Names() {
+		imp, _ := Lookup(name)
+		if imp.Detect(a) {
+			return imp, true
+		}
+	}
+	return nil, false
+}
+
+// Findings parses and maps an artifact's content. Every finding gets its
+// ExternalID unless the format set one; a key that comes up again replaces
+// the earlier finding, so each is uploaded once.
+func Findings(imp Importer, r io.Reader) ([]Finding, error) {
+	records, err := imp.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	var out []Finding
+	index := map[string]int{}
+	for i, rec := range records {
+		fs, err := imp.Map(rec)
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %w", i+1, err)
+		}
+		for _, f := range fs {
+			if f.ExternalID == "" {
+				f.ExternalID = ExternalID(f)
+			}
+			if at, seen := index[f.ExternalID]; seen {
+				out[at] = f
+				continue
+			}
+			index[f.ExternalID] = len(out)
+			out = append(out, f)
+		}
+	}
+	return out, nil
+}
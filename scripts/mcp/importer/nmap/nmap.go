@@ -0,0 +1,91 @@
+// Package nmap imports nmap and masscan XML. The server parses these
+// itself, so the artifact is uploaded as is; Parse and Map only read the
+// hosts for a dry run.
+package nmap
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io"
+
+	"github.com/schmalle/secman/scripts/mcp/importer"
+)
+
+func init() {
+	importer.Register(format{name: "nmap"})
+	importer.Register(format{name: "masscan"})
+}
+
+type format struct {
+	name string
+}
+
+func (f format) Name() string { return f.name }
+
+func (f format) Detect(a importer.Artifact) bool {
+	if !bytes.Contains(a.Head, []byte("<nmaprun")) {
+		return false
+	}
+	masscan := bytes.Contains(a.Head, []byte(`scanner="masscan"`))
+	return masscan == (f.name == "masscan")
+}
+
+type nmapRun struct {
+	Hosts []struct {
+		Addresses []struct {
+			Addr string `xml:"addr,attr"`
+			Type string `xml:"addrtype,attr"`
+		} `xml:"address"`
+		Hostnames []struct {
+			Name string `xml:"name,attr"`
+		} `xml:"hostnames>hostname"`
+		Ports []struct {
+			Protocol string `xml:"protocol,attr"`
+			Port     int    `xml:"portid,attr"`
+			State    struct {
+				State string `xml:"state,attr"`
+			} `xml:"state"`
+		} `xml:"ports>port"`
+	} `xml:"host"`
+}
+
+// Parse returns one record per host: ip, hostname and its open ports.
+func (f format) Parse(r io.Reader) ([]importer.Record, error) {
+	var run nmapRun
+	if err := xml.NewDecoder(r).Decode(&run); err != nil {
+		return nil, err
+	}
+	records := make([]importer.Record, 0, len(run.Hosts))
+	for _, h := range run.Hosts {
+		rec := importer.Record{}
+		for _, a := range h.Addresses {
+			if a.Type == "ipv4" || a.Type == "ipv6" {
+				rec["ip"] = a.Addr
+			}
+		}
+		if len(h.Hostnames) > 0 {
+			rec["hostname"] = h.Hostnames[0].Name
+		}
+		var open []interface{}
+		for _, p := range h.Ports {
+			if p.State.State == "open" {
+				open = append(open, float64(p.Port))
+			}
+		}
+		rec["openPorts"] = open
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+// Map yields no findings: nmap reports ports, which the server stores
+// with the scan.
+func (format) Map(importer.Record) ([]importer.Finding, error) {
+	return nil, nil
+}
+
+func (f format) Upload(ctx context.Context, sink importer.Sink, a importer.Artifact, _ []importer.Finding) (importer.Result, error) {
+	id, skipped, err := sink.UploadArtifact(ctx, a.Path, f.name)
+	return importer.Result{ScanID: id, Skipped: skipped}, err
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/schmalle/secman/scripts/mcp/config"
+)
+
+// Secrets can be kept in the OS credential store instead of the env file
+// or the config file: the Windows Credential Manager, the macOS keychain,
+// or the Secret Service (GNOME Keyring, KWallet) through secret-tool
+// elsewhere. A setting whose value is keyring:<name> is read from the
+// entry <name> of the service "secman" when the settings are loaded:
+//
+//	[prod]
+//	mcp_key = keyring:prod
+//
+// `credential set prod` stores the entry.
+
+// keyringService is the service (Windows: target prefix) of the entries.
+const keyringService = "secman"
+
+// errKeyringNotFound is returned for an entry the store does not have.
+var errKeyringNotFound = errors.New("no such entry in the credential store")
+
+// resolveKeyringRef reads a keyring:<name> reference for config.Load.
+func resolveKeyringRef(ref string) (string, error) {
+	name := strings.TrimPrefix(ref, config.KeyringPrefix)
+	if name == "" {
+		return "", fmt.Errorf("%s names no entry", ref)
+	}
+	secret, err := keyringGet(name)
+	if err != nil {
+		return "", fmt.Errorf("%s in the %s: %w", name, keyringStore, err)
+	}
+	registerSecret(secret)
+	return secret, nil
+}
+
+func cmdCredential(osArgs []string) {
+	if len(osArgs) < 1 {
+		credentialUsage()
+	}
+	fs := flag.NewFlagSet("credential "+osArgs[0], flag.ContinueOnError)
+	fromStdin := fs.Bool("stdin", false, "set: read the secret from stdin instead of prompting for it")
+	args := parseInterspersed(fs, osArgs[1:])
+	if len(args) != 1 {
+		credentialUsage()
+	}
+	name := args[0]
+
+	switch osArgs[0] {
+	case "set":
+		secret, err := readSecret(fmt.Sprintf("Secret for %s: ", name), *fromStdin)
+		if err != nil {
+			fatal(err)
+		}
+		if secret == "" {
+			fmt.Fprintln(os.Stderr, "Error: empty secret")
+			exit(ExitUsage)
+		}
+		if err := keyringSet(name, secret); err != nil {
+			fatal(fmt.Errorf("%s: %w", keyringStore, err))
+		}
+		status(name, "Stored %s in the %s. Use it in the env file or a profile as, for example:\n  mcp_key = %s%s\n",
+			name, keyringStore, config.KeyringPrefix, name)
+	case "get":
+		secret, err := keyringGet(name)
+		if errors.Is(err, errKeyringNotFound) {
+			fmt.Fprintf(os.Stderr, "Error: %s is not in the %s\n", name, keyringStore)
+			exit(ExitNotFound)
+		}
+		if err != nil {
+			fatal(fmt.Errorf("%s: %w", keyringStore, err))
+		}
+		fmt.Println(secret)
+	case "delete":
+		err := keyringDelete(name)
+		if errors.Is(err, errKeyringNotFound) {
+			fmt.Fprintf(os.Stderr, "Error: %s is not in the %s\n", name, keyringStore)
+			exit(ExitNotFound)
+		}
+		if err != nil {
+			fatal(fmt.Errorf("%s: %w", keyringStore, err))
+		}
+		status(name, "Deleted %s from the %s\n", name, keyringStore)
+	default:
+		credentialUsage()
+	}
+}
+
+func credentialUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s credential set|get|delete <name> (set: --stdin)\n", progName())
+	exit(ExitUsage)
+}
+
+// readSecret prompts for a secret without echoing it, or reads the first
+// line of stdin when it is not a terminal or fromStdin is set.
+func readSecret(prompt string, fromStdin bool) (string, error) {
+	if fromStdin || !isInteractive() {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return "", fmt.Errorf("read secret from stdin: %w", err)
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+	fd := int(os.Stdin.Fd())
+	state, err := makeRaw(fd)
+	if err != nil {
+		return "", fmt.Errorf("cannot turn off echo (%v); pass the secret on stdin with --stdin", err)
+	}
+	defer restoreTerm(fd, state)
+	fmt.Fprint(os.Stderr, prompt)
+	defer fmt.Fprint(os.Stderr, "\r\n")
+
+	var secret []byte
+	in := bufio.NewReader(os.Stdin)
+	for {
+		b, err := in.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		switch b {
+		case '\r', '\n':
+			return string(secret), nil
+		case 3: // Ctrl-C
+			return "", errors.New("aborted")
+		case 4: // Ctrl-D
+			if len(secret) == 0 {
+				return "", errors.New("aborted")
+			}
+		case 8, 127: // Backspace
+			if len(secret) > 0 {
+				_, size := utf8.DecodeLastRune(secret)
+				secret = secret[:len(secret)-size]
+			}
+		default:
+			secret = append(secret, b)
+		}
+	}
+}
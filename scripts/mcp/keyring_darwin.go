@@ -0,0 +1,57 @@
+//go:build darwin
+
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Entries are generic passwords of the service secman in the login
+// keychain, managed with the security tool. The secret is handed to it on
+// stdin, hex-encoded, so it does not show up in the process list.
+
+const keyringStore = "macOS keychain"
+
+// securityItemNotFound is security's exit status for a missing item.
+const securityItemNotFound = 44
+
+func securityError(err error, out []byte) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == securityItemNotFound {
+		return errKeyringNotFound
+	}
+	if msg := strings.TrimSpace(string(out)); msg != "" {
+		return fmt.Errorf("%w: %s", err, msg)
+	}
+	return err
+}
+
+func keyringGet(name string) (string, error) {
+	out, err := exec.Command("security", "find-generic-password", "-s", keyringService, "-a", name, "-w").Output()
+	if err != nil {
+		return "", securityError(err, nil)
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+func keyringSet(name, secret string) error {
+	cmd := exec.Command("security", "-i")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %s -a %q -X %s\n", keyringService, name, hex.EncodeToString([]byte(secret))))
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return securityError(err, out)
+	}
+	return nil
+}
+
+func keyringDelete(name string) error {
+	out, err := exec.Command("security", "delete-generic-password", "-s", keyringService, "-a", name).CombinedOutput()
+	if err != nil {
+		return securityError(err, out)
+	}
+	return nil
+}
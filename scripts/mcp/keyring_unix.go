@@ -0,0 +1,60 @@
+//go:build !windows && !darwin
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Entries are Secret Service items with the attributes service=secman and
+// account=<name>, managed with secret-tool (libsecret-tools), which talks
+// to GNOME Keyring, KWallet or KeePassXC. The secret is handed to it on
+// stdin.
+
+const keyringStore = "Secret Service"
+
+func secretTool(stdin string, args ...string) ([]byte, error) {
+	if _, err := exec.LookPath("secret-tool"); err != nil {
+		return nil, errors.New("secret-tool is not installed (package libsecret-tools or libsecret)")
+	}
+	cmd := exec.Command("secret-tool", args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return out, nil
+	case errors.As(err, &exitErr) && args[0] == "lookup" && strings.TrimSpace(stderr.String()) == "":
+		// lookup fails without a message when there is no such item.
+		return nil, errKeyringNotFound
+	case strings.TrimSpace(stderr.String()) != "":
+		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil, err
+}
+
+func keyringGet(name string) (string, error) {
+	out, err := secretTool("", "lookup", "service", keyringService, "account", name)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+func keyringSet(name, secret string) error {
+	_, err := secretTool(secret, "store", "--label", keyringService+" "+name, "service", keyringService, "account", name)
+	return err
+}
+
+func keyringDelete(name string) error {
+	if _, err := keyringGet(name); err != nil {
+		return err
+	}
+	_, err := secretTool("", "clear", "service", keyringService, "account", name)
+	return err
+}
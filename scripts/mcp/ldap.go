@@ -0,0 +1,517 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A minimal LDAPv3 client: simple bind, StartTLS and subtree searches with
+// the paged results control, which Active Directory needs for more than
+// 1000 entries. Messages are BER-encoded by hand; only the definite-length
+// forms LDAP uses are supported.
+
+// ldapConn is one LDAP connection.
+type ldapConn struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	msgID   int
+	timeout time.Duration // per request
+}
+
+// ldapEntry is one search result: its DN and attribute values, by
+// lower-case attribute name.
+type ldapEntry struct {
+	DN    string
+	Attrs map[string][][]byte
+}
+
+func (e ldapEntry) get(attr string) string {
+	if v := e.Attrs[strings.ToLower(attr)]; len(v) > 0 {
+		return string(v[0])
+	}
+	return ""
+}
+
+// LDAPError is a non-success LDAP result.
+type LDAPError struct {
+	Code    int
+	Message string
+}
+
+func (e *LDAPError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("LDAP result %d: %s", e.Code, e.Message)
+	}
+	return fmt.Sprintf("LDAP result %d", e.Code)
+}
+
+// dialLDAP connects to ldaps://host[:636] or ldap://host[:389]. Plain ldap://
+// connections are upgraded with StartTLS before anything is sent, so a
+// password never crosses the network in the clear.
+func dialLDAP(rawURL string, tlsConfig *tls.Config, timeout time.Duration) (*ldapConn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	host := u.Hostname()
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = host
+	}
+	dialer := &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	switch u.Scheme {
+	case "ldaps":
+		port := u.Port()
+		if port == "" {
+			port = "636"
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", net.JoinHostPort(host, port), tlsConfig)
+	case "ldap":
+		port := u.Port()
+		if port == "" {
+			port = "389"
+		}
+		conn, err = dialer.Dial("tcp", net.JoinHostPort(host, port))
+	default:
+		return nil, fmt.Errorf("%q: use ldaps:// or ldap://", rawURL)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &ldapConn{conn: conn, r: bufio.NewReader(conn), timeout: timeout}
+	if u.Scheme == "ldap" {
+		if err := c.startTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("StartTLS: %w", err)
+		}
+	}
+	return c, nil
+}
+
+func (c *ldapConn) Close() error {
+	c.msgID++
+	c.conn.Write(berTLV(0x30, berInt(0x02, c.msgID), berTLV(0x42)))
+	return c.conn.Close()
+}
+
+// send writes a request and returns its message id.
+func (c *ldapConn) send(op []byte, controls ...[]byte) (int, error) {
+	c.msgID++
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	parts := [][]byte{berInt(0x02, c.msgID), op}
+	if len(controls) > 0 {
+		parts = append(parts, berTLV(0xa0, controls...))
+	}
+	_, err := c.conn.Write(berTLV(0x30, parts...))
+	return c.msgID, err
+}
+
+// receive reads the next message of id: the protocol op and the controls.
+func (c *ldapConn) receive(id int) (berElem, []berElem, error) {
+	for {
+		tag, body, err := berRead(c.r)
+		if err != nil {
+			return berElem{}, nil, err
+		}
+		if tag != 0x30 {
+			return berElem{}, nil, fmt.Errorf("unexpected LDAP message tag %#x", tag)
+		}
+		parts, err := berParse(body)
+		if err != nil || len(parts) < 2 {
+			return berElem{}, nil, fmt.Errorf("malformed LDAP message")
+		}
+		if berIntValue(parts[0].body) != id {
+			continue // a notice of disconnection or a stale response
+		}
+		var controls []berElem
+		if len(parts) > 2 && parts[2].tag == 0xa0 {
+			controls, _ = berParse(parts[2].body)
+		}
+		return parts[1], controls, nil
+	}
+}
+
+// ldapResult checks an LDAPResult: resultCode, matchedDN, diagnosticMessage.
+func ldapResult(op berElem) error {
+	parts, err := berParse(op.body)
+	if err != nil || len(parts) < 3 {
+		return fmt.Errorf("malformed LDAP result")
+	}
+	if code := berIntValue(parts[0].body); code != 0 {
+		return &LDAPError{Code: code, Message: string(parts[2].body)}
+	}
+	return nil
+}
+
+func (c *ldapConn) startTLS(tlsConfig *tls.Config) error {
+	id, err := c.send(berTLV(0x77, berTLV(0x80, []byte("1.3.6.1.4.1.1466.20037"))))
+	if err != nil {
+		return err
+	}
+	op, _, err := c.receive(id)
+	if err != nil {
+		return err
+	}
+	if err := ldapResult(op); err != nil {
+		return err
+	}
+	tlsConn := tls.Client(c.conn, tlsConfig)
+	if err := tlsConn.Handshake(); err != nil {
+		return err
+	}
+	c.conn, c.r = tlsConn, bufio.NewReader(tlsConn)
+	return nil
+}
+
+// Bind authenticates with a DN (or user@domain for AD) and password; an
+// empty DN binds anonymously.
+func (c *ldapConn) Bind(dn, password string) error {
+	id, err := c.send(berTLV(0x60, berInt(0x02, 3), berTLV(0x04, []byte(dn)), berTLV(0x80, []byte(password))))
+	if err != nil {
+		return err
+	}
+	op, _, err := c.receive(id)
+	if err != nil {
+		return err
+	}
+	return ldapResult(op)
+}
+
+// Search runs a subtree search and returns every entry, fetching pageSize
+// entries per request.
+func (c *ldapConn) Search(base, filter string, attrs []string, pageSize int) ([]ldapEntry, error) {
+	encodedFilter, rest, err := ldapFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(rest) != "" {
+		return nil, fmt.Errorf("filter %q: unexpected %q", filter, rest)
+	}
+	var attrList [][]byte
+	for _, a := range attrs {
+		attrList = append(attrList, berTLV(0x04, []byte(a)))
+	}
+	req := berTLV(0x63,
+		berTLV(0x04, []byte(base)),
+		berInt(0x0a, 2), // wholeSubtree
+		berInt(0x0a, 0), // neverDerefAliases
+		berInt(0x02, 0),
+		berInt(0x02, 0),
+		berTLV(0x01, []byte{0}),
+		encodedFilter,
+		berTLV(0x30, attrList...),
+	)
+
+	var entries []ldapEntry
+	var cookie []byte
+	for {
+		paging := berTLV(0x30,
+			berTLV(0x04, []byte("1.2.840.113556.1.4.319")),
+			berTLV(0x04, berTLV(0x30, berInt(0x02, pageSize), berTLV(0x04, cookie))),
+		)
+		id, err := c.send(req, paging)
+		if err != nil {
+			return nil, err
+		}
+		cookie = nil
+		for {
+			op, controls, err := c.receive(id)
+			if err != nil {
+				return nil, err
+			}
+			if op.tag == 0x64 {
+				entry, err := ldapParseEntry(op.body)
+				if err != nil {
+					return nil, err
+				}
+				entries = append(entries, entry)
+				continue
+			}
+			if op.tag != 0x65 {
+				continue // search result references
+			}
+			if err := ldapResult(op); err != nil {
+				return entries, err
+			}
+			for _, ctl := range controls {
+				parts, _ := berParse(ctl.body)
+				if len(parts) < 2 || string(parts[0].body) != "1.2.840.113556.1.4.319" {
+					continue
+				}
+				value := parts[len(parts)-1]
+				if _, inner, err := berReadBytes(value.body); err == nil {
+					if fields, _ := berParse(inner); len(fields) == 2 {
+						cookie = fields[1].body
+					}
+				}
+			}
+			break
+		}
+		if len(cookie) == 0 {
+			return entries, nil
+		}
+	}
+}
+
+func ldapParseEntry(body []byte) (ldapEntry, error) {
+	parts, err := berParse(body)
+	if err != nil || len(parts) < 2 {
+		return ldapEntry{}, fmt.Errorf("malformed search entry")
+	}
+	entry := ldapEntry{DN: string(parts[0].body), Attrs: map[string][][]byte{}}
+	attrs, _ := berParse(parts[1].body)
+	for _, a := range attrs {
+		fields, _ := berParse(a.body)
+		if len(fields) < 2 {
+			continue
+		}
+		values, _ := berParse(fields[1].body)
+		name := strings.ToLower(string(fields[0].body))
+		for _, v := range values {
+			entry.Attrs[name] = append(entry.Attrs[name], v.body)
+		}
+	}
+	return entry, nil
+}
+
+// ldapFilter encodes the first RFC 4515 filter of s and returns the rest:
+// &, |, !, =, >=, <=, ~=, presence (attr=*), substrings (attr=a*b*) and
+// extensible matches (attr:1.2.840.113556.1.4.803:=2).
+func ldapFilter(s string) ([]byte, string, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "(") {
+		return nil, s, fmt.Errorf("filter must start with '(': %q", s)
+	}
+	s = s[1:]
+	if s == "" {
+		return nil, s, errors.New("filter ends early")
+	}
+	switch s[0] {
+	case '&', '|', '!':
+		tag := map[byte]byte{'&': 0xa0, '|': 0xa1, '!': 0xa2}[s[0]]
+		s = s[1:]
+		var parts [][]byte
+		for strings.HasPrefix(strings.TrimSpace(s), "(") {
+			part, rest, err := ldapFilter(s)
+			if err != nil {
+				return nil, s, err
+			}
+			parts = append(parts, part)
+			s = rest
+		}
+		s = strings.TrimSpace(s)
+		if !strings.HasPrefix(s, ")") {
+			return nil, s, errors.New("missing ')' in filter")
+		}
+		if tag == 0xa2 && len(parts) != 1 {
+			return nil, s, errors.New("'!' takes exactly one filter")
+		}
+		return berTLV(tag, parts...), s[1:], nil
+	}
+
+	end := strings.IndexByte(s, ')')
+	if end < 0 {
+		return nil, s, errors.New("missing ')' in filter")
+	}
+	item, rest := s[:end], s[end+1:]
+	eq := strings.IndexByte(item, '=')
+	if eq <= 0 {
+		return nil, rest, fmt.Errorf("filter item %q has no '='", item)
+	}
+	attr, value := item[:eq], item[eq+1:]
+	tag := byte(0xa3)
+	switch attr[len(attr)-1] {
+	case '>':
+		tag, attr = 0xa5, attr[:len(attr)-1]
+	case '<':
+		tag, attr = 0xa6, attr[:len(attr)-1]
+	case '~':
+		tag, attr = 0xa8, attr[:len(attr)-1]
+	case ':':
+		// attr:dn:rule:=value
+		fields := strings.Split(attr[:len(attr)-1], ":")
+		v, err := ldapUnescape(value)
+		if err != nil {
+			return nil, rest, err
+		}
+		var parts [][]byte
+		if len(fields) > 1 && fields[len(fields)-1] != "dn" {
+			parts = append(parts, berTLV(0x81, []byte(fields[len(fields)-1])))
+		}
+		if fields[0] != "" {
+			parts = append(parts, berTLV(0x82, []byte(fields[0])))
+		}
+		parts = append(parts, berTLV(0x83, v))
+		if containsFold(fields[1:], "dn") {
+			parts = append(parts, berTLV(0x84, []byte{0xff}))
+		}
+		return berTLV(0xa9, parts...), rest, nil
+	}
+
+	if tag == 0xa3 && value == "*" {
+		return berTLV(0x87, []byte(attr)), rest, nil
+	}
+	if tag == 0xa3 && strings.Contains(value, "*") {
+		pieces := strings.Split(value, "*")
+		var subs [][]byte
+		for i, p := range pieces {
+			if p == "" {
+				continue
+			}
+			v, err := ldapUnescape(p)
+			if err != nil {
+				return nil, rest, err
+			}
+			subTag := byte(0x81)
+			switch i {
+			case 0:
+				subTag = 0x80
+			case len(pieces) - 1:
+				subTag = 0x82
+			}
+			subs = append(subs, berTLV(subTag, v))
+		}
+		return berTLV(0xa4, berTLV(0x04, []byte(attr)), berTLV(0x30, subs...)), rest, nil
+	}
+	v, err := ldapUnescape(value)
+	if err != nil {
+		return nil, rest, err
+	}
+	return berTLV(tag, berTLV(0x04, []byte(attr)), berTLV(0x04, v)), rest, nil
+}
+
+// ldapUnescape decodes the \XX escapes of a filter value.
+func ldapUnescape(s string) ([]byte, error) {
+	var out []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			out = append(out, s[i])
+			continue
+		}
+		if i+2 >= len(s) {
+			return nil, fmt.Errorf("bad escape in filter value %q", s)
+		}
+		b, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+		if err != nil {
+			return nil, fmt.Errorf("bad escape in filter value %q", s)
+		}
+		out = append(out, byte(b))
+		i += 2
+	}
+	return out, nil
+}
+
+// berElem is a decoded BER element.
+type berElem struct {
+	tag  byte
+	body []byte
+}
+
+// berTLV encodes an element with the given contents.
+func berTLV(tag byte, contents ...[]byte) []byte {
+	n := 0
+	for _, c := range contents {
+		n += len(c)
+	}
+	out := []byte{tag}
+	switch {
+	case n < 0x80:
+		out = append(out, byte(n))
+	default:
+		var lenBytes []byte
+		for v := n; v > 0; v >>= 8 {
+			lenBytes = append([]byte{byte(v)}, lenBytes...)
+		}
+		out = append(out, 0x80|byte(len(lenBytes)))
+		out = append(out, lenBytes...)
+	}
+	for _, c := range contents {
+		out = append(out, c...)
+	}
+	return out
+}
+
+// berInt encodes an INTEGER or ENUMERATED.
+func berInt(tag byte, v int) []byte {
+	var b []byte
+	for {
+		b = append([]byte{byte(v)}, b...)
+		v >>= 8
+		if (v == 0 && b[0]&0x80 == 0) || (v == -1 && b[0]&0x80 != 0) {
+			break
+		}
+	}
+	return berTLV(tag, b)
+}
+
+func berIntValue(b []byte) int {
+	v := 0
+	for i, c := range b {
+		if i == 0 && c&0x80 != 0 {
+			v = -1
+		}
+		v = v<<8 | int(c)
+	}
+	return v
+}
+
+// berRead reads one element from a stream.
+func berRead(r *bufio.Reader) (byte, []byte, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	first, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	n := int(first)
+	if first&0x80 != 0 {
+		count := int(first & 0x7f)
+		if count == 0 || count > 4 {
+			return 0, nil, fmt.Errorf("unsupported BER length")
+		}
+		n = 0
+		for i := 0; i < count; i++ {
+			b, err := r.ReadByte()
+			if err != nil {
+				return 0, nil, err
+			}
+			n = n<<8 | int(b)
+		}
+	}
+	body := make([]byte, n)
+	_, err = io.ReadFull(r, body)
+	return tag, body, err
+}
+
+// berReadBytes decodes the element at the start of b.
+func berReadBytes(b []byte) (byte, []byte, error) {
+	r := bufio.NewReader(bytes.NewReader(b))
+	return berRead(r)
+}
+
+// berParse splits the contents of a constructed element into its elements.
+func berParse(b []byte) ([]berElem, error) {
+	var out []berElem
+	r := bufio.NewReader(bytes.NewReader(b))
+	for {
+		tag, body, err := berRead(r)
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return out, err
+		}
+		out = append(out, berElem{tag, body})
+	}
+}
@@ -0,0 +1,555 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// import dhcp-leases and import arp read what the network itself has seen
+// and compare it with the approved inventory: every asset not tagged
+// transient=true. A device matches an asset by its mac tag, then by
+// hostname, then by IP address when that asset has no mac tag. Devices
+// that match nothing become transient assets tagged network-status=rogue,
+// so they show up next to the real inventory until someone approves them
+// (removes the transient tag) or they drop off the network and --prune
+// expires them.
+//
+// Lease formats: ISC dhcpd.leases, dnsmasq.leases, MikroTik "lease print
+// terse", and CSV exports with address and MAC columns (Kea lease4.csv,
+// Get-DhcpServerv4Lease | Export-Csv, pfSense/OPNsense). ARP input is any
+// table with an IP and a MAC address per line: arp -a (Linux, BSD, macOS,
+// Windows), ip neigh, /proc/net/arp and show ip arp of routers and switches.
+
+// networkDevice is a device one lease or ARP entry saw.
+type networkDevice struct {
+	IP       string    `json:"ip"`
+	MAC      string    `json:"mac"`
+	Hostname string    `json:"hostname,omitempty"`
+	Seen     time.Time `json:"seen"`
+	Status   string    `json:"status,omitempty"` // known or rogue
+	Asset    string    `json:"asset,omitempty"`  // the matched asset
+}
+
+// leaseFormats are the --format values of import dhcp-leases.
+var leaseFormats = []string{"isc", "dnsmasq", "mikrotik", "csv"}
+
+// normalizeMAC returns a MAC address as aa:bb:cc:dd:ee:ff, accepting colons,
+// dashes, Cisco dots, bare hex and macOS's unpadded octets; "" when s is no
+// unicast MAC address.
+func normalizeMAC(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	var octets []string
+	switch {
+	case strings.Count(s, ":") == 5:
+		octets = strings.Split(s, ":")
+	case strings.Count(s, "-") == 5:
+		octets = strings.Split(s, "-")
+	case strings.Count(s, ".") == 2 && len(s) == 14:
+		s = strings.ReplaceAll(s, ".", "")
+		fallthrough
+	case len(s) == 12:
+		for i := 0; i < 12; i += 2 {
+			octets = append(octets, s[i:i+2])
+		}
+	default:
+		return ""
+	}
+	var b [6]byte
+	for i, o := range octets {
+		v, err := strconv.ParseUint(o, 16, 8)
+		if err != nil || o == "" || len(o) > 2 {
+			return ""
+		}
+		b[i] = byte(v)
+	}
+	// Broadcast, multicast and empty entries are no devices.
+	if b[0]&1 != 0 || b == [6]byte{} {
+		return ""
+	}
+	return net.HardwareAddr(b[:]).String()
+}
+
+// detectLeaseFormat guesses the format of a lease file from its content.
+func detectLeaseFormat(data []byte) string {
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"), strings.HasPrefix(line, "Flags:"), strings.HasPrefix(line, "duid "):
+			continue
+		case strings.HasPrefix(line, "lease ") || strings.HasPrefix(line, "server-duid") ||
+			strings.HasPrefix(line, "authoring-byte-order"):
+			return "isc"
+		case strings.Contains(line, "address=") && strings.Contains(line, "mac-address="):
+			return "mikrotik"
+		case strings.Contains(line, ","):
+			return "csv"
+		}
+		if fields := strings.Fields(line); len(fields) >= 4 && normalizeMAC(fields[1]) != "" {
+			return "dnsmasq"
+		}
+	}
+	return ""
+}
+
+// parseDHCPLeases reads the active leases of a lease file. seen is used for
+// leases that carry no start time.
+func parseDHCPLeases(data []byte, format string, seen time.Time) ([]networkDevice, error) {
+	switch format {
+	case "isc":
+		return parseISCLeases(data, seen), nil
+	case "dnsmasq":
+		return parseDnsmasqLeases(data, seen), nil
+	case "mikrotik":
+		return parseMikroTikLeases(data, seen), nil
+	case "csv":
+		return parseCSVLeases(data, seen)
+	}
+	return nil, fmt.Errorf("format not recognized (pass --format %s)", strings.Join(leaseFormats, "|"))
+}
+
+// parseISCLeases reads dhcpd.leases. The file is a journal: a later lease
+// of an address replaces an earlier one, and free, expired, released and
+// abandoned leases are no longer on the network.
+func parseISCLeases(data []byte, seen time.Time) []networkDevice {
+	byIP := map[string]networkDevice{}
+	active := map[string]bool{}
+	var order []string
+	var cur *networkDevice
+	state := ""
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "lease ") && strings.HasSuffix(line, "{"):
+			cur = &networkDevice{IP: strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(line, "lease "), "{")), Seen: seen}
+			state = ""
+		case cur == nil:
+		case line == "}":
+			if cur.MAC != "" {
+				if _, ok := byIP[cur.IP]; !ok {
+					order = append(order, cur.IP)
+				}
+				byIP[cur.IP] = *cur
+				active[cur.IP] = state == "" || state == "active"
+			}
+			cur = nil
+		default:
+			stmt := strings.TrimSuffix(line, ";")
+			switch fields := strings.Fields(stmt); {
+			case strings.HasPrefix(stmt, "hardware ethernet "):
+				cur.MAC = normalizeMAC(strings.TrimPrefix(stmt, "hardware ethernet "))
+			case strings.HasPrefix(stmt, "client-hostname "):
+				cur.Hostname = strings.Trim(strings.TrimPrefix(stmt, "client-hostname "), `"`)
+			case strings.HasPrefix(stmt, "binding state "):
+				state = strings.TrimPrefix(stmt, "binding state ")
+			case len(fields) >= 3 && fields[0] == "starts":
+				// starts 4 2024/01/11 10:00:00 (UTC), or starts epoch 1704967200
+				if fields[1] == "epoch" {
+					if v, err := strconv.ParseInt(fields[2], 10, 64); err == nil {
+						cur.Seen = time.Unix(v, 0).UTC()
+					}
+				} else if len(fields) >= 4 {
+					if t, err := time.Parse("2006/01/02 15:04:05", fields[2]+" "+fields[3]); err == nil {
+						cur.Seen = t
+					}
+				}
+			}
+		}
+	}
+	var out []networkDevice
+	for _, ip := range order {
+		if active[ip] {
+			out = append(out, byIP[ip])
+		}
+	}
+	return out
+}
+
+// parseDnsmasqLeases reads dnsmasq.leases: expiry, MAC, IP, hostname, client
+// id. Every line is a current lease.
+func parseDnsmasqLeases(data []byte, seen time.Time) []networkDevice {
+	var out []networkDevice
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+		d := networkDevice{MAC: normalizeMAC(fields[1]), IP: fields[2], Seen: seen}
+		if fields[3] != "*" {
+			d.Hostname = fields[3]
+		}
+		if d.MAC != "" && net.ParseIP(d.IP) != nil {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// parseMikroTikLeases reads "/ip dhcp-server lease print terse" (or export)
+// output: key=value pairs per lease. Leases that are waiting or offered are
+// skipped.
+func parseMikroTikLeases(data []byte, seen time.Time) []networkDevice {
+	var out []networkDevice
+	for _, line := range strings.Split(string(data), "\n") {
+		kv := map[string]string{}
+		for _, field := range strings.Fields(line) {
+			if k, v, ok := strings.Cut(field, "="); ok {
+				kv[k] = strings.Trim(v, `"`)
+			}
+		}
+		if s := kv["status"]; s != "" && s != "bound" {
+			continue
+		}
+		d := networkDevice{IP: kv["address"], MAC: normalizeMAC(kv["mac-address"]), Hostname: kv["host-name"], Seen: seen}
+		if d.MAC != "" && net.ParseIP(d.IP) != nil {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// csvLeaseColumns name the columns of CSV lease exports, compared without
+// case, spaces and underscores.
+var csvLeaseColumns = map[string][]string{
+	"ip":       {"address", "ipaddress", "ip", "ipv4address"},
+	"mac":      {"hwaddr", "macaddress", "mac", "clientid", "hardwareaddress", "physicaladdress"},
+	"hostname": {"hostname", "clientname", "name"},
+	"state":    {"state", "addressstate", "status"},
+}
+
+// parseCSVLeases reads a CSV export with a header row. Kea marks current
+// leases with state 0, Windows with an AddressState starting with Active.
+func parseCSVLeases(data []byte, seen time.Time) ([]networkDevice, error) {
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "#") {
+			lines = append(lines, line)
+		}
+	}
+	r := csv.NewReader(strings.NewReader(strings.Join(lines, "\n")))
+	r.FieldsPerRecord = -1
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	col := map[string]int{}
+	for i, h := range rows[0] {
+		h = strings.ToLower(strings.NewReplacer(" ", "", "_", "", "-", "", "\ufeff", "").Replace(h))
+		for field, names := range csvLeaseColumns {
+			if _, taken := col[field]; !taken && containsFold(names, h) {
+				col[field] = i
+			}
+		}
+	}
+	if _, ok := col["ip"]; !ok {
+		return nil, fmt.Errorf("no IP address column in %q", strings.Join(rows[0], ","))
+	}
+	if _, ok := col["mac"]; !ok {
+		return nil, fmt.Errorf("no MAC address column in %q", strings.Join(rows[0], ","))
+	}
+	get := func(row []string, field string) string {
+		if i, ok := col[field]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+	var out []networkDevice
+	for _, row := range rows[1:] {
+		if s := strings.ToLower(get(row, "state")); s != "" && s != "0" && !strings.HasPrefix(s, "active") && s != "bound" {
+			continue
+		}
+		d := networkDevice{IP: get(row, "ip"), MAC: normalizeMAC(get(row, "mac")), Hostname: get(row, "hostname"), Seen: seen}
+		if d.MAC != "" && net.ParseIP(d.IP) != nil {
+			out = append(out, d)
+		}
+	}
+	return out, nil
+}
+
+// parseARP reads any ARP or neighbor table with an IP and a MAC address on
+// each line. arp -a on BSD and macOS names the host first:
+// "host.example.com (10.0.0.5) at aa:bb:cc:dd:ee:ff on en0".
+func parseARP(data []byte, seen time.Time) []networkDevice {
+	var out []networkDevice
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		var d networkDevice
+		for i, f := range fields {
+			f = strings.Trim(f, "()[],")
+			if d.IP == "" && net.ParseIP(f) != nil {
+				d.IP = f
+				if i == 1 && strings.HasPrefix(fields[1], "(") && fields[0] != "?" {
+					d.Hostname = fields[0]
+				}
+			} else if d.MAC == "" {
+				d.MAC = normalizeMAC(f)
+			}
+		}
+		if d.IP != "" && d.MAC != "" {
+			d.Seen = seen
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// mergeDevices keeps one device per MAC address: the latest seen, with a
+// hostname from any entry.
+func mergeDevices(devices []networkDevice) []networkDevice {
+	byMAC := map[string]networkDevice{}
+	for _, d := range devices {
+		prev, ok := byMAC[d.MAC]
+		if ok && prev.Seen.After(d.Seen) {
+			prev, d = d, prev
+		}
+		if d.Hostname == "" {
+			d.Hostname = prev.Hostname
+		}
+		byMAC[d.MAC] = d
+	}
+	out := make([]networkDevice, 0, len(byMAC))
+	for _, d := range byMAC {
+		out = append(out, d)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].MAC < out[j].MAC })
+	return out
+}
+
+// shortHostname is the first label of a hostname.
+func shortHostname(name string) string {
+	name, _, _ = strings.Cut(strings.ToLower(name), ".")
+	return name
+}
+
+// deviceIndex finds the asset of a device.
+type deviceIndex struct {
+	byMAC, byName, byIP map[string]map[string]interface{}
+}
+
+func newDeviceIndex(assets map[string]map[string]interface{}) deviceIndex {
+	idx := deviceIndex{byMAC: map[string]map[string]interface{}{}, byName: map[string]map[string]interface{}{},
+		byIP: map[string]map[string]interface{}{}}
+	for _, a := range assets {
+		mac := normalizeMAC(assetTag(a, "mac"))
+		if mac != "" {
+			idx.byMAC[mac] = a
+		}
+		if name := strings.ToLower(stringField(a, "name")); name != "" {
+			idx.byName[name] = a
+			if short := shortHostname(name); idx.byName[short] == nil && net.ParseIP(name) == nil {
+				idx.byName[short] = a
+			}
+		}
+		// An address says little once DHCP has handed it to another
+		// device, so assets that know their MAC address match by it only.
+		if ip := stringField(a, "ip"); ip != "" && mac == "" {
+			idx.byIP[ip] = a
+		}
+	}
+	return idx
+}
+
+func (idx deviceIndex) match(d networkDevice) map[string]interface{} {
+	if a := idx.byMAC[d.MAC]; a != nil {
+		return a
+	}
+	if d.Hostname != "" {
+		if a := idx.byName[strings.ToLower(d.Hostname)]; a != nil {
+			return a
+		}
+		if a := idx.byName[shortHostname(d.Hostname)]; a != nil {
+			return a
+		}
+	}
+	return idx.byIP[d.IP]
+}
+
+// isTransient reports whether an asset was created for an unapproved device.
+func isTransient(asset map[string]interface{}) bool {
+	return strings.EqualFold(assetTag(asset, "transient"), "true")
+}
+
+// planDevices sorts the devices into known and rogue and plans the
+// transient assets of the rogue ones. With prune, transient assets not seen
+// since expire are deleted.
+func planDevices(devices []networkDevice, s *applyState, source, owner string, prune bool, expire time.Time) []*applyAction {
+	approved, transient := map[string]map[string]interface{}{}, map[string]map[string]interface{}{}
+	for key, a := range s.records["assets"] {
+		if isTransient(a) {
+			transient[key] = a
+		} else {
+			approved[key] = a
+		}
+	}
+	known, rogue := newDeviceIndex(approved), newDeviceIndex(transient)
+	if owner == "" {
+		owner = source
+	}
+
+	var plan []*applyAction
+	matched := map[string]bool{}
+	for i := range devices {
+		d := &devices[i]
+		if a := known.match(*d); a != nil {
+			d.Status, d.Asset = "known", stringField(a, "name")
+			continue
+		}
+		d.Status = "rogue"
+		tags := map[string]interface{}{
+			"transient":      "true",
+			"network-status": "rogue",
+			"mac":            d.MAC,
+			"seen-via":       source,
+			"last-seen":      d.Seen.UTC().Format("2006-01-02"),
+		}
+		if current := rogue.byMAC[d.MAC]; current != nil {
+			d.Asset = stringField(current, "name")
+			key := applyKey("assets", current)
+			matched[key] = true
+			rec := map[string]interface{}{"name": d.Asset, "ip": d.IP, "tags": tags}
+			// An older lease does not move last-seen back.
+			if last, err := time.Parse("2006-01-02", assetTag(current, "last-seen")); err == nil && last.After(d.Seen) {
+				delete(tags, "last-seen")
+				delete(tags, "seen-via")
+			}
+			if changes := diffRecord("assets", rec, current, nil); len(changes) > 0 {
+				plan = append(plan, &applyAction{op: "update", section: "assets", desired: rec, current: current,
+					changes: changes, tools: updateTools("assets", changes)})
+			}
+			continue
+		}
+
+		tags["first-seen"] = tags["last-seen"]
+		name := strings.ToLower(d.Hostname)
+		if name == "" {
+			name = d.MAC
+		} else if s.records["assets"][name] != nil {
+			name = fmt.Sprintf("%s (%s)", name, d.MAC)
+		}
+		d.Asset = name
+		rec := map[string]interface{}{"name": name, "type": "UNKNOWN", "owner": owner, "ip": d.IP, "tags": tags}
+		plan = append(plan, &applyAction{op: "create", section: "assets", desired: rec, tools: []string{"create_asset", "update_asset"}})
+	}
+	if !prune {
+		return plan
+	}
+
+	keys := make([]string, 0, len(transient))
+	for key := range transient {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		a := transient[key]
+		last, err := time.Parse("2006-01-02", assetTag(a, "last-seen"))
+		if matched[key] || err != nil || !last.Before(expire) {
+			continue
+		}
+		plan = append(plan, &applyAction{op: "delete", section: "assets", current: a, tools: []string{"delete_asset"}})
+	}
+	return plan
+}
+
+// cmdImportDevices runs import dhcp-leases and import arp.
+func cmdImportDevices(client *McpClient, source string, osArgs []string) {
+	kind := map[string]string{"dhcp": "dhcp-leases", "arp": "arp"}[source]
+	fs := flag.NewFlagSet("import "+kind, flag.ContinueOnError)
+	format := new(string)
+	if source == "dhcp" {
+		format = fs.String("format", "", "Lease file format: "+strings.Join(leaseFormats, ", ")+" (default: detected per file)")
+	}
+	owner := fs.String("owner", setting("SECMAN_DISCOVER_OWNER"), "Owner of new transient assets (default: "+source+")")
+	report := fs.Bool("report", false, "Only print the devices and whether they are known; change nothing")
+	prune := fs.Bool("prune", false, "Delete transient assets not seen since --expire-after")
+	expireAfter := fs.String("expire-after", "30d", "Age after which --prune deletes an unseen transient asset")
+	failOnRogue := fs.Bool("fail-on-rogue", false, "Exit 5 when a device is not in the approved inventory")
+	diff := fs.Bool("diff", false, "Only print the changes; exit 5 when there are any")
+	yes := addYesFlag(fs)
+	files := parseInterspersed(fs, osArgs)
+
+	if len(files) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: file required")
+		fmt.Fprintf(os.Stderr, "Usage: %s import %s <file>... [--owner name] [--report] [--prune] [--fail-on-rogue] [--yes]\n", progName(), kind)
+		exit(ExitUsage)
+	}
+	if *format != "" && !containsFold(leaseFormats, *format) {
+		fmt.Fprintf(os.Stderr, "Error: unknown format %q (use %s)\n", *format, strings.Join(leaseFormats, ", "))
+		exit(ExitUsage)
+	}
+	expire, err := parseTimeExpr(*expireAfter, time.Now())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --expire-after: %v\n", err)
+		exit(ExitUsage)
+	}
+
+	var devices []networkDevice
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fatal(err)
+		}
+		// Entries without a time of their own were current when the file
+		// was written.
+		seen := time.Now().UTC()
+		if info, err := os.Stat(path); err == nil {
+			seen = info.ModTime().UTC()
+		}
+		var found []networkDevice
+		if source == "arp" {
+			found = parseARP(data, seen)
+		} else {
+			f := strings.ToLower(*format)
+			if f == "" {
+				f = detectLeaseFormat(data)
+			}
+			if found, err = parseDHCPLeases(data, f, seen); err != nil {
+				fatal(fmt.Errorf("%s: %w", path, err))
+			}
+		}
+		status(nil, "%s: %d device(s)\n", path, len(found))
+		devices = append(devices, found...)
+	}
+	devices = mergeDevices(devices)
+
+	state, err := readApplyState(client, map[string]bool{"assets": true}, false)
+	if err != nil {
+		fatal(err)
+	}
+	plan := planDevices(devices, state, source, *owner, *prune, expire)
+	var rogue []networkDevice
+	for _, d := range devices {
+		if d.Status == "rogue" {
+			rogue = append(rogue, d)
+		}
+	}
+	status(nil, "%d device(s): %d known, %d not in the approved inventory\n", len(devices), len(devices)-len(rogue), len(rogue))
+
+	switch {
+	case *report:
+		printResult(map[string]interface{}{"source": source, "devices": devices, "rogue": len(rogue)})
+	case len(plan) == 0:
+		status(0, "No changes: the transient assets match the %s data\n", kind)
+	case *diff:
+		for _, a := range plan {
+			fmt.Println(a)
+		}
+		exit(ExitGateFailed)
+	default:
+		runApplyPlan(client, state, plan, *yes)
+	}
+	if *failOnRogue && len(rogue) > 0 {
+		exit(ExitGateFailed)
+	}
+}
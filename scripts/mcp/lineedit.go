@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// errInterrupted is returned by readLine when the user presses Ctrl-C.
+var errInterrupted = errors.New("interrupted")
+
+// lineEditor reads shell input. On a terminal it runs in raw mode with
+// cursor movement, history (up/down) and Tab completion; otherwise it reads
+// plain lines, so scripts can be piped into the shell.
+type lineEditor struct {
+	in       *os.File
+	out      io.Writer
+	reader   *bufio.Reader
+	terminal bool
+	history  []string
+
+	// complete returns the rune offset where the word being completed
+	// starts and the candidates for it, given the line up to the cursor.
+	complete func(line string) (int, []string)
+}
+
+func newLineEditor(in *os.File, out io.Writer, complete func(string) (int, []string)) *lineEditor {
+	return &lineEditor{
+		in:       in,
+		out:      out,
+		reader:   bufio.NewReader(in),
+		terminal: isInteractive(),
+		complete: complete,
+	}
+}
+
+// addHistory records an entered line, skipping repeats of the last one.
+func (e *lineEditor) addHistory(line string) {
+	if n := len(e.history); n > 0 && e.history[n-1] == line {
+		return
+	}
+	e.history = append(e.history, line)
+}
+
+// readLine shows the prompt and returns the entered line without its
+// newline. io.EOF means the input ended (Ctrl-D on an empty line).
+func (e *lineEditor) readLine(prompt string) (string, error) {
+	if !e.terminal {
+		return e.readPlain(prompt)
+	}
+	fd := int(e.in.Fd())
+	state, err := makeRaw(fd)
+	if err != nil {
+		e.terminal = false
+		return e.readPlain(prompt)
+	}
+	defer restoreTerm(fd, state)
+	return e.readRaw(prompt)
+}
+
+func (e *lineEditor) readPlain(prompt string) (string, error) {
+	if e.terminal || isInteractive() {
+		fmt.Fprint(e.out, prompt)
+	}
+	line, err := e.reader.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (e *lineEditor) readRaw(prompt string) (string, error) {
+	var buf []rune
+	pos := 0
+	histIdx := len(e.history)
+	var pending []rune // the unfinished line while browsing history
+
+	redraw := func() {
+		fmt.Fprintf(e.out, "\r%s%s\x1b[K", prompt, string(buf))
+		if back := len(buf) - pos; back > 0 {
+			fmt.Fprintf(e.out, "\x1b[%dD", back)
+		}
+	}
+	insert := func(rs []rune) {
+		buf = append(buf[:pos], append(rs, buf[pos:]...)...)
+		pos += len(rs)
+	}
+	setLine := func(s []rune) {
+		buf = append([]rune(nil), s...)
+		pos = len(buf)
+	}
+	historyMove := func(delta int) {
+		next := histIdx + delta
+		if next < 0 || next > len(e.history) {
+			return
+		}
+		if histIdx == len(e.history) {
+			pending = append([]rune(nil), buf...)
+		}
+		histIdx = next
+		if histIdx == len(e.history) {
+			setLine(pending)
+		} else {
+			setLine([]rune(e.history[histIdx]))
+		}
+	}
+
+	fmt.Fprint(e.out, prompt)
+	for {
+		r, _, err := e.reader.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		switch r {
+		case '\r', '\n':
+			fmt.Fprint(e.out, "\r\n")
+			return string(buf), nil
+		case 3: // Ctrl-C
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", errInterrupted
+		case 4: // Ctrl-D
+			if len(buf) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+			if pos < len(buf) {
+				buf = append(buf[:pos], buf[pos+1:]...)
+			}
+		case 127, 8: // Backspace
+			if pos > 0 {
+				buf = append(buf[:pos-1], buf[pos:]...)
+				pos--
+			}
+		case 1: // Ctrl-A
+			pos = 0
+		case 5: // Ctrl-E
+			pos = len(buf)
+		case 2: // Ctrl-B
+			if pos > 0 {
+				pos--
+			}
+		case 6: // Ctrl-F
+			if pos < len(buf) {
+				pos++
+			}
+		case 11: // Ctrl-K
+			buf = buf[:pos]
+		case 21: // Ctrl-U
+			buf = append([]rune(nil), buf[pos:]...)
+			pos = 0
+		case 23: // Ctrl-W
+			start := pos
+			for start > 0 && buf[start-1] == ' ' {
+				start--
+			}
+			for start > 0 && buf[start-1] != ' ' {
+				start--
+			}
+			buf = append(buf[:start], buf[pos:]...)
+			pos = start
+		case 12: // Ctrl-L
+			fmt.Fprint(e.out, "\x1b[H\x1b[2J")
+		case 16: // Ctrl-P
+			historyMove(-1)
+		case 14: // Ctrl-N
+			historyMove(1)
+		case '\t':
+			e.completeAt(&buf, &pos, prompt)
+		case 27: // escape sequence
+			switch e.readEscape() {
+			case "A":
+				historyMove(-1)
+			case "B":
+				historyMove(1)
+			case "C":
+				if pos < len(buf) {
+					pos++
+				}
+			case "D":
+				if pos > 0 {
+					pos--
+				}
+			case "H", "1~", "7~":
+				pos = 0
+			case "F", "4~", "8~":
+				pos = len(buf)
+			case "3~":
+				if pos < len(buf) {
+					buf = append(buf[:pos], buf[pos+1:]...)
+				}
+			}
+		default:
+			if r >= ' ' {
+				insert([]rune{r})
+			}
+		}
+		redraw()
+	}
+}
+
+// readEscape reads the rest of an ESC [ or ESC O sequence and returns its
+// final part, e.g. "A" for the up arrow or "3~" for Delete.
+func (e *lineEditor) readEscape() string {
+	intro, err := e.reader.ReadByte()
+	if err != nil || (intro != '[' && intro != 'O') {
+		return ""
+	}
+	var seq []byte
+	for {
+		b, err := e.reader.ReadByte()
+		if err != nil {
+			return ""
+		}
+		seq = append(seq, b)
+		if b >= 0x40 && b <= 0x7e {
+			return string(seq)
+		}
+	}
+}
+
+// completeAt completes the word before the cursor to the candidates'
+// common prefix, listing them when that does not narrow things down.
+func (e *lineEditor) completeAt(buf *[]rune, pos *int, prompt string) {
+	if e.complete == nil {
+		return
+	}
+	start, candidates := e.complete(string((*buf)[:*pos]))
+	if len(candidates) == 0 {
+		return
+	}
+	word := string((*buf)[start:*pos])
+	prefix := commonPrefix(candidates)
+	if len(candidates) == 1 && !strings.HasSuffix(prefix, "=") {
+		prefix += " "
+	}
+	if len(prefix) > len(word) {
+		add := []rune(prefix[len(word):])
+		*buf = append((*buf)[:*pos], append(add, (*buf)[*pos:]...)...)
+		*pos += len(add)
+		return
+	}
+
+	sort.Strings(candidates)
+	width := 0
+	for _, c := range candidates {
+		if len(c) > width {
+			width = len(c)
+		}
+	}
+	perLine := 80 / (width + 2)
+	if perLine < 1 {
+		perLine = 1
+	}
+	fmt.Fprint(e.out, "\r\n")
+	for i, c := range candidates {
+		fmt.Fprintf(e.out, "%-*s", width+2, c)
+		if (i+1)%perLine == 0 || i == len(candidates)-1 {
+			fmt.Fprint(e.out, "\r\n")
+		}
+	}
+	fmt.Fprint(e.out, prompt)
+}
+
+func commonPrefix(words []string) string {
+	prefix := words[0]
+	for _, w := range words[1:] {
+		for !strings.HasPrefix(w, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
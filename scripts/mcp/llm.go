@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// summarize and ask talk to an LLM through the OpenAI-compatible chat
+// completions API, which OpenAI, Azure OpenAI, Ollama, vLLM and LM Studio
+// all serve. SECMAN_LLM_URL is the API's base URL and SECMAN_LLM_API_KEY,
+// when set, is sent as a bearer token.
+
+// llmMessage is one message of a chat.
+type llmMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// llmChat sends a chat and returns the answer. jsonMode asks for a JSON
+// object; servers that do not know the option ignore it.
+func llmChat(client *McpClient, endpoint, model string, messages []llmMessage, jsonMode bool) (answer string, err error) {
+	started := time.Now()
+	defer func() { client.recordLLM(model, messages, answer, err, started) }()
+	request := map[string]interface{}{"model": model, "temperature": 0.2, "messages": messages}
+	if jsonMode {
+		request["temperature"] = 0
+		request["response_format"] = map[string]string{"type": "json_object"}
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent())
+	if key := setting("SECMAN_LLM_API_KEY"); key != "" {
+		registerSecret(key)
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	// Local models on a CPU take their time.
+	resp, err := externalHTTPClient(client, 5*time.Minute).Do(req)
+	if err != nil {
+		return "", fmt.Errorf("llm: %w", err)
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("llm: read response: %w", err)
+	}
+	var out struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	jsonErr := json.Unmarshal(raw, &out)
+	if resp.StatusCode/100 != 2 {
+		msg := http.StatusText(resp.StatusCode)
+		if jsonErr == nil && out.Error != nil && out.Error.Message != "" {
+			msg = out.Error.Message
+		}
+		return "", &HTTPError{StatusCode: resp.StatusCode, Body: "llm: " + msg}
+	}
+	if jsonErr != nil {
+		return "", fmt.Errorf("llm: invalid response: %w", jsonErr)
+	}
+	if len(out.Choices) == 0 || strings.TrimSpace(out.Choices[0].Message.Content) == "" {
+		return "", fmt.Errorf("llm: empty answer")
+	}
+	return out.Choices[0].Message.Content, nil
+}
@@ -0,0 +1,13 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || windows)
+
+package main
+
+import "os"
+
+// lockFile is a no-op here; appends within one process are still
+// serialized by auditMu, and state files are still replaced atomically.
+func lockFile(f *os.File) error { return nil }
+
+func tryLockFile(f *os.File) error { return nil }
+
+func unlockFile(f *os.File) {}
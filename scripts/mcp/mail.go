@@ -0,0 +1,644 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/schmalle/secman/scripts/mcp/chart"
+)
+
+// `report send` mails the dashboard summary as HTML, with server reports
+// (usually PDF) and local files attached, through the SMTP server in
+// SECMAN_SMTP_HOST. The connection is encrypted with STARTTLS, or with
+// implicit TLS on port 465; SECMAN_SMTP_TLS=none is only for local relays.
+// Authentication uses SECMAN_SMTP_USER and SECMAN_SMTP_PASSWORD when set.
+
+type smtpConfig struct {
+	host     string
+	port     int
+	security string // starttls, tls or none
+	user     string
+	password string
+	from     string // header form, with an optional display name
+	envelope string // bare sender address for MAIL FROM
+}
+
+func loadSMTPConfig() (*smtpConfig, error) {
+	c := &smtpConfig{
+		host:     setting("SECMAN_SMTP_HOST"),
+		security: strings.ToLower(setting("SECMAN_SMTP_TLS")),
+		user:     setting("SECMAN_SMTP_USER"),
+		password: setting("SECMAN_SMTP_PASSWORD"),
+		from:     setting("SECMAN_SMTP_FROM"),
+	}
+	if c.host == "" {
+		return nil, fmt.Errorf("SECMAN_SMTP_HOST is required")
+	}
+	port, err := strconv.Atoi(settingOr("SECMAN_SMTP_PORT", "587"))
+	if err != nil || port <= 0 || port > 65535 {
+		return nil, fmt.Errorf("invalid SECMAN_SMTP_PORT %q", setting("SECMAN_SMTP_PORT"))
+	}
+	c.port = port
+	if c.security == "" {
+		c.security = "starttls"
+		if port == 465 {
+			c.security = "tls"
+		}
+	}
+	if c.security != "starttls" && c.security != "tls" && c.security != "none" {
+		return nil, fmt.Errorf("SECMAN_SMTP_TLS must be starttls, tls or none, got %q", c.security)
+	}
+	if c.from == "" {
+		c.from = c.user
+	}
+	if c.from == "" {
+		return nil, fmt.Errorf("SECMAN_SMTP_FROM is required when SECMAN_SMTP_USER is not an address")
+	}
+	from, err := mail.ParseAddress(c.from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SECMAN_SMTP_FROM %q: %v", c.from, err)
+	}
+	c.from = from.String()
+	c.envelope = from.Address
+	registerSecret(c.password)
+	return c, nil
+}
+
+// send delivers msg to every recipient, given as bare addresses. The
+// server's certificate is always verified; a relay that does not offer
+// STARTTLS is refused.
+func (c *smtpConfig) send(to []string, msg []byte) error {
+	addr := net.JoinHostPort(c.host, strconv.Itoa(c.port))
+	tlsConfig := &tls.Config{ServerName: c.host, MinVersion: tls.VersionTLS12}
+
+	var client *smtp.Client
+	if c.security == "tls" {
+		conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 30 * time.Second}, "tcp", addr, tlsConfig)
+		if err != nil {
+			return fmt.Errorf("smtp: %w", err)
+		}
+		if client, err = smtp.NewClient(conn, c.host); err != nil {
+			conn.Close()
+			return fmt.Errorf("smtp: %w", err)
+		}
+	} else {
+		conn, err := net.DialTimeout("tcp", addr, 30*time.Second)
+		if err != nil {
+			return fmt.Errorf("smtp: %w", err)
+		}
+		if client, err = smtp.NewClient(conn, c.host); err != nil {
+			conn.Close()
+			return fmt.Errorf("smtp: %w", err)
+		}
+	}
+	defer client.Close()
+
+	if c.security == "starttls" {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("smtp: %s does not offer STARTTLS (SECMAN_SMTP_TLS=none sends unencrypted)", c.host)
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("smtp: starttls: %w", err)
+		}
+	}
+	if c.user != "" {
+		// smtp.PlainAuth refuses to send the password over an unencrypted
+		// connection to anything but localhost.
+		if err := client.Auth(smtp.PlainAuth("", c.user, c.password, c.host)); err != nil {
+			return fmt.Errorf("smtp: auth: %w", err)
+		}
+	}
+	if err := client.Mail(c.envelope); err != nil {
+		return fmt.Errorf("smtp: MAIL FROM: %w", err)
+	}
+	for _, rcpt := range to {
+		if err := client.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("smtp: RCPT TO %s: %w", rcpt, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("smtp: DATA: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	return client.Quit()
+}
+
+// mailAttachment is a file sent with the mail. One with a ContentID is
+// an inline image the HTML refers to as cid:<ContentID>.
+type mailAttachment struct {
+	Name      string
+	Data      []byte
+	ContentID string
+}
+
+// buildMail renders a multipart/mixed message: the HTML body, together
+// with its inline images in a multipart/related part when there are any,
+// followed by the attachments, base64 encoded.
+func buildMail(from string, to []string, subject string, html []byte, attachments []mailAttachment) ([]byte, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+
+	id := make([]byte, 12)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	domain := "secman"
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		domain = strings.Trim(from[at+1:], ">")
+	}
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(id), domain)
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", w.Boundary())
+
+	var inline, attached []mailAttachment
+	for _, a := range attachments {
+		if a.ContentID != "" {
+			inline = append(inline, a)
+		} else {
+			attached = append(attached, a)
+		}
+	}
+	bodyWriter := w
+	if len(inline) > 0 {
+		boundary := multipart.NewWriter(io.Discard).Boundary()
+		related, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type": {mime.FormatMediaType("multipart/related", map[string]string{"boundary": boundary, "type": "text/html"})},
+		})
+		if err != nil {
+			return nil, err
+		}
+		bodyWriter = multipart.NewWriter(related)
+		if err := bodyWriter.SetBoundary(boundary); err != nil {
+			return nil, err
+		}
+	}
+	body, err := bodyWriter.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/html; charset=utf-8"},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	writeBase64Lines(body, html)
+	if len(inline) > 0 {
+		for _, a := range inline {
+			if err := writeMailPart(bodyWriter, a); err != nil {
+				return nil, err
+			}
+		}
+		if err := bodyWriter.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, a := range attached {
+		if err := writeMailPart(w, a); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeMailPart writes an attachment, or an inline image, as a part.
+func writeMailPart(w *multipart.Writer, a mailAttachment) error {
+	contentType := mime.TypeByExtension(filepath.Ext(a.Name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	header := textproto.MIMEHeader{
+		"Content-Type":              {contentType},
+		"Content-Transfer-Encoding": {"base64"},
+		"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Name})},
+	}
+	if a.ContentID != "" {
+		header.Set("Content-ID", "<"+a.ContentID+">")
+		header.Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": a.Name}))
+	}
+	part, err := w.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	writeBase64Lines(part, a.Data)
+	return nil
+}
+
+// writeBase64Lines writes data base64 encoded in 76-character lines, as
+// RFC 2045 requires.
+func writeBase64Lines(w interface{ Write([]byte) (int, error) }, data []byte) {
+	enc := base64.StdEncoding.EncodeToString(data)
+	for len(enc) > 76 {
+		w.Write([]byte(enc[:76] + "\r\n"))
+		enc = enc[76:]
+	}
+	w.Write([]byte(enc + "\r\n"))
+}
+
+func cmdReportSend(client *McpClient, osArgs []string) {
+	fs := flag.NewFlagSet("report send", flag.ContinueOnError)
+	to := fs.String("to", "", "Recipients, comma-separated (required)")
+	subject := fs.String("subject", "", "Subject (default: Secman summary <date>)")
+	var reports, attach stringList
+	fs.Var(&reports, "report", "Attach the server report with this id (repeatable)")
+	fs.Var(&attach, "attach", "Attach a local file, e.g. a campaign report (repeatable)")
+	top := fs.Int("top", 10, "Number of riskiest assets in the summary")
+	ageBuckets := fs.Bool("age-bucket", false, "Add open findings by days open to the summary; reads every finding")
+	sla := fs.Bool("sla", false, "Add SLA compliance per severity to the summary; reads every finding")
+	noCharts := fs.Bool("no-charts", false, "Show tables instead of chart images")
+	parseFlags(fs, osArgs)
+
+	recipients := splitList(*to)
+	if len(recipients) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: --to is required")
+		fmt.Fprintf(os.Stderr, "Usage: %s report send --to <addr>[,<addr>...] [--report <id>] [--attach <file>] [--subject S]\n", progName())
+		exit(ExitUsage)
+	}
+	var envelopeTo []string
+	for i, r := range recipients {
+		addr, err := mail.ParseAddress(r)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid recipient %q: %v\n", r, err)
+			exit(ExitUsage)
+		}
+		recipients[i] = addr.String()
+		envelopeTo = append(envelopeTo, addr.Address)
+	}
+	smtpCfg, err := loadSMTPConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(ExitUsage)
+	}
+
+	var attachments []mailAttachment
+	for _, path := range attach {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fatal(err)
+		}
+		attachments = append(attachments, mailAttachment{Name: filepath.Base(path), Data: data})
+	}
+	if len(reports) > 0 {
+		dir, err := os.MkdirTemp("", "secman-report-send-*")
+		if err != nil {
+			fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		for _, r := range reports {
+			id, err := strconv.ParseInt(r, 10, 64)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: invalid report id %q\n", r)
+				exit(ExitUsage)
+			}
+			path, _, err := downloadReport(client, id, dir, "", defaultEvidenceChunkSize, true)
+			if err != nil {
+				fatal(err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				fatal(err)
+			}
+			attachments = append(attachments, mailAttachment{Name: filepath.Base(path), Data: data})
+		}
+	}
+
+	stats, err := collectStats(client, *top)
+	if err != nil {
+		fatal(err)
+	}
+	content := summaryContent{Stats: stats, Charts: !*noCharts}
+	if *ageBuckets || *sla {
+		findings, err := listAll(client, "get_vulnerabilities", "vulnerabilities", map[string]interface{}{}, 500)
+		if err != nil {
+			fatal(err)
+		}
+		if *ageBuckets {
+			stats.AgeBuckets = countAgeBuckets(findings, time.Now())
+		}
+		if *sla {
+			content.SLA = countSLA(findings)
+		}
+	}
+	if content.Charts {
+		// Snapshots are optional; without two of them there is no trend.
+		trend, err := severityTrend(timeRange{After: time.Now().AddDate(0, 0, -90)}, 0)
+		if err != nil {
+			warnf("trend: %v", err)
+		} else if len(trend) > 1 {
+			content.Trend = trend
+		}
+	}
+	if *subject == "" {
+		*subject = "Secman summary " + time.Now().Format("2006-01-02")
+	}
+	html, inline, err := renderSummaryHTML(client, content, *subject, attachments)
+	if err != nil {
+		fatal(err)
+	}
+	msg, err := buildMail(smtpCfg.from, recipients, *subject, html, append(inline, attachments...))
+	if err != nil {
+		fatal(err)
+	}
+
+	if client.dryRun {
+		client.dryRunCalls.Add(1)
+		fmt.Printf("DRY RUN smtp %s:%d (%s)\n", smtpCfg.host, smtpCfg.port, smtpCfg.security)
+		fmt.Printf("    from = %s\n    to = %s\n    subject = %q\n", smtpCfg.from, strings.Join(recipients, ", "), *subject)
+		for _, a := range inline {
+			fmt.Printf("    inline = %s (%d bytes)\n", a.Name, len(a.Data))
+		}
+		for _, a := range attachments {
+			fmt.Printf("    attachment = %s (%d bytes)\n", a.Name, len(a.Data))
+		}
+		return
+	}
+	if err := smtpCfg.send(envelopeTo, msg); err != nil {
+		fatal(err)
+	}
+	status(len(envelopeTo), "Sent %q to %s (%d attachment(s), %d bytes)\n", *subject, strings.Join(envelopeTo, ", "), len(attachments), len(msg))
+}
+
+// stringList collects the values of a repeatable flag.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// summaryContent is what the summary mail reports. SLA and Trend are
+// optional.
+type summaryContent struct {
+	Stats  *Stats
+	SLA    []slaCount
+	Trend  []trendPoint
+	Charts bool
+}
+
+// slaCount is the open findings of one severity and how many of them are
+// past their SLA.
+type slaCount struct {
+	Severity string
+	Open     int
+	Overdue  int
+}
+
+// Within is the percentage of the open findings within their SLA.
+func (c slaCount) Within() int {
+	if c.Open == 0 {
+		return 100
+	}
+	return (c.Open - c.Overdue) * 100 / c.Open
+}
+
+func countSLA(findings []map[string]interface{}) []slaCount {
+	counts := make([]slaCount, len(severityOrder))
+	index := map[string]int{}
+	for i, sev := range severityOrder {
+		counts[i].Severity = sev
+		index[sev] = i
+	}
+	for _, f := range findings {
+		i, ok := index[strings.ToUpper(stringField(f, "cvssSeverity"))]
+		if !ok {
+			continue
+		}
+		counts[i].Open++
+		if isOverdue(f) {
+			counts[i].Overdue++
+		}
+	}
+	return counts
+}
+
+type summaryMailData struct {
+	Title       string
+	Server      string
+	Generated   string
+	Severities  []summarySeverity
+	Total       int
+	TotalAssets int
+	AssetTypes  []summaryCount
+	Scans       int
+	Risky       []RiskyAsset
+	AgeBuckets  []ageBucketCount
+	SLA         []slaCount
+	TrendPoints int
+	TrendFrom   string
+	TrendTo     string
+	Images      map[string]*summaryImage
+	Attachments []string
+}
+
+type summarySeverity struct {
+	Name  string
+	Count int
+	Color string
+}
+
+type summaryCount struct {
+	Name  string
+	Count int
+}
+
+// summaryImage is a chart inlined in the mail.
+type summaryImage struct {
+	Src    template.URL
+	Alt    string
+	Width  int
+	Height int
+}
+
+var summarySeverityColors = map[string]string{
+	"CRITICAL": chart.Critical,
+	"HIGH":     chart.High,
+	"MEDIUM":   chart.Medium,
+	"LOW":      chart.Low,
+}
+
+// severityChart draws counts per severity as bars in the severity colors.
+func severityChart(title string, counts map[string]int) *chart.BarChart {
+	ch := &chart.BarChart{Frame: chart.Frame{Title: title, Width: 400, Height: 200}}
+	for _, sev := range severityOrder {
+		ch.Bars = append(ch.Bars, chart.Bar{Label: sev, Value: float64(counts[sev]), Color: summarySeverityColors[sev]})
+	}
+	return ch
+}
+
+// slaChart draws a bar per severity split into the findings within and
+// past their SLA.
+func slaChart(counts []slaCount) *chart.StackedBarChart {
+	ch := &chart.StackedBarChart{Frame: chart.Frame{Title: "SLA compliance", Height: 40 + 32*len(counts)}}
+	for _, c := range counts {
+		ch.Rows = append(ch.Rows, chart.StackedBar{
+			Label: c.Severity,
+			Parts: []chart.Bar{{Label: "within SLA", Value: float64(c.Open - c.Overdue), Color: chart.Good},
+				{Label: "overdue", Value: float64(c.Overdue), Color: chart.Critical}},
+			Note: fmt.Sprintf("%d%% of %d", c.Within(), c.Open),
+		})
+	}
+	return ch
+}
+
+// trendChart draws a line per severity over the snapshots.
+func trendChart(points []trendPoint) *chart.LineChart {
+	ch := &chart.LineChart{
+		Frame:      chart.Frame{Title: "Open vulnerabilities"},
+		StartLabel: points[0].Taken.Local().Format("2006-01-02"),
+		EndLabel:   points[len(points)-1].Taken.Local().Format("2006-01-02"),
+	}
+	for _, sev := range severityOrder {
+		s := chart.Series{Name: sev, Color: summarySeverityColors[sev], Markers: len(points) <= 30}
+		for _, p := range points {
+			s.Points = append(s.Points, chart.Point{X: float64(p.Taken.Unix()), Y: float64(p.Counts[sev])})
+		}
+		ch.Series = append(ch.Series, s)
+	}
+	return ch
+}
+
+// renderSummaryHTML renders the summary mail and, with charts, the PNG
+// images it refers to, to be sent inline.
+func renderSummaryHTML(client *McpClient, content summaryContent, title string, attachments []mailAttachment) ([]byte, []mailAttachment, error) {
+	s := content.Stats
+	data := summaryMailData{
+		Title:       title,
+		Server:      client.BaseURL,
+		Generated:   time.Now().Format("2006-01-02 15:04 MST"),
+		TotalAssets: s.TotalAssets,
+		Scans:       s.ScansLast30Days,
+		Risky:       s.TopRiskyAssets,
+		AgeBuckets:  s.AgeBuckets,
+		SLA:         content.SLA,
+		TrendPoints: len(content.Trend),
+		Images:      map[string]*summaryImage{},
+	}
+	for _, sev := range severityOrder {
+		data.Severities = append(data.Severities, summarySeverity{Name: sev, Count: s.VulnsBySeverity[sev], Color: summarySeverityColors[sev]})
+		data.Total += s.VulnsBySeverity[sev]
+	}
+	for t, n := range s.AssetsByType {
+		data.AssetTypes = append(data.AssetTypes, summaryCount{Name: t, Count: n})
+	}
+	sort.Slice(data.AssetTypes, func(i, j int) bool { return data.AssetTypes[i].Count > data.AssetTypes[j].Count })
+	for _, a := range attachments {
+		data.Attachments = append(data.Attachments, a.Name)
+	}
+
+	if n := len(content.Trend); n > 0 {
+		data.TrendFrom = content.Trend[0].Taken.Local().Format("2006-01-02")
+		data.TrendTo = content.Trend[n-1].Taken.Local().Format("2006-01-02")
+	}
+
+	var inline []mailAttachment
+	if content.Charts {
+		type summaryChart struct {
+			name, alt string
+			chart     chart.Chart
+		}
+		charts := []summaryChart{{"severities", "Open vulnerabilities by severity", severityChart("", s.VulnsBySeverity)}}
+		if len(content.Trend) > 1 {
+			charts = append(charts, summaryChart{"trend", "Open vulnerabilities over time", trendChart(content.Trend)})
+		}
+		if len(content.SLA) > 0 {
+			charts = append(charts, summaryChart{"sla", "SLA compliance by severity", slaChart(content.SLA)})
+		}
+		for _, c := range charts {
+			png, err := c.chart.PNG()
+			if err != nil {
+				return nil, nil, err
+			}
+			cid := c.name + "@secman"
+			inline = append(inline, mailAttachment{Name: c.name + ".png", Data: png, ContentID: cid})
+			w, h := c.chart.Size()
+			data.Images[c.name] = &summaryImage{Src: template.URL("cid:" + cid), Alt: c.alt, Width: w, Height: h}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := summaryMailTemplate.Execute(&buf, data); err != nil {
+		return nil, nil, err
+	}
+	return buf.Bytes(), inline, nil
+}
+
+// Mail clients ignore style sheets in many cases, so the template styles
+// inline. Charts are PNGs since few mail clients show SVG.
+var summaryMailTemplate = template.Must(template.New("summary").Parse(`{{define "image"}}<img src="{{.Src}}" alt="{{.Alt}}" width="{{.Width}}" height="{{.Height}}" style="display: block;">{{end}}<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.Title}}</title></head>
+<body style="font-family: Arial, sans-serif; color: #222;">
+<h2>{{.Title}}</h2>
+<p style="color: #666;">{{.Server}} &middot; generated {{.Generated}}</p>
+
+<h3>Open vulnerabilities ({{.Total}})</h3>
+{{with .Images.severities}}{{template "image" .}}
+<p>{{range $i, $s := $.Severities}}{{if $i}} &middot; {{end}}<span style="color: {{$s.Color}}; font-weight: bold;">{{$s.Name}}</span> {{$s.Count}}{{end}}</p>
+{{else}}<table cellpadding="6" style="border-collapse: collapse;">
+{{range .Severities}}<tr><td style="color: {{.Color}}; font-weight: bold;">{{.Name}}</td><td align="right">{{.Count}}</td></tr>
+{{end}}</table>{{end}}
+
+{{with .Images.trend}}<h3>Trend</h3>
+{{template "image" .}}
+<p style="color: #666;">Open vulnerabilities per severity in {{$.TrendPoints}} snapshots, {{$.TrendFrom}} to {{$.TrendTo}}.</p>{{end}}
+
+{{if .SLA}}<h3>SLA compliance</h3>
+{{with .Images.sla}}{{template "image" .}}
+<p>{{range $i, $c := $.SLA}}{{if $i}} &middot; {{end}}<b>{{$c.Severity}}</b> {{$c.Within}}% within SLA ({{$c.Overdue}} of {{$c.Open}} overdue){{end}}</p>
+{{else}}<table cellpadding="6" style="border-collapse: collapse;">
+<tr style="background: #eee;"><th align="left">Severity</th><th>Open</th><th>Overdue</th><th>Within SLA</th></tr>
+{{range .SLA}}<tr><td>{{.Severity}}</td><td align="right">{{.Open}}</td><td align="right">{{.Overdue}}</td><td align="right">{{.Within}}%</td></tr>
+{{end}}</table>{{end}}{{end}}
+
+{{if .AgeBuckets}}<h3>Open vulnerabilities by days open</h3>
+<table cellpadding="6" style="border-collapse: collapse;">
+<tr style="background: #eee;"><th align="left">Age</th><th>Total</th><th>Critical</th><th>High</th><th>Medium</th><th>Low</th></tr>
+{{range .AgeBuckets}}<tr><td>{{.Bucket}}</td><td align="right">{{.Total}}</td><td align="right">{{.Critical}}</td><td align="right">{{.High}}</td><td align="right">{{.Medium}}</td><td align="right">{{.Low}}</td></tr>
+{{end}}</table>{{end}}
+
+<h3>Assets ({{.TotalAssets}})</h3>
+<table cellpadding="6" style="border-collapse: collapse;">
+{{range .AssetTypes}}<tr><td>{{.Name}}</td><td align="right">{{.Count}}</td></tr>
+{{end}}</table>
+<p>Scans in the last 30 days: {{.Scans}}</p>
+
+{{if .Risky}}<h3>Riskiest assets</h3>
+<table cellpadding="6" style="border-collapse: collapse;">
+<tr style="background: #eee;"><th align="left">Asset</th><th>Critical</th><th>High</th><th>Medium</th><th>Low</th></tr>
+{{range .Risky}}<tr><td>{{.AssetName}}</td><td align="right">{{.Critical}}</td><td align="right">{{.High}}</td><td align="right">{{.Medium}}</td><td align="right">{{.Low}}</td></tr>
+{{end}}</table>{{end}}
+
+{{if .Attachments}}<p>Attached: {{range $i, $a := .Attachments}}{{if $i}}, {{end}}{{$a}}{{end}}</p>{{end}}
+</body></html>
+`))
@@ -8,366 +8,1410 @@
 //	export SECMAN_BASE_URL=http://localhost:8080
 //	export SECMAN_MCP_KEY=sk-your-api-key
 //	export SECMAN_USER_EMAIL=admin@example.com  # optional, for user delegation
-//	go run main.go [command] [flags]
+//	go run . [command] [flags]
 //
 // Commands:
 //
 //	capabilities     List server capabilities and available tools
+//	describe <tool>  Document a tool: parameters, enums, defaults and example calls
+//	verify-contract  Call every read tool with minimal arguments and check the result shapes
 //	call <tool>      Call a tool by name (pass arguments as JSON via --args)
 //	assets           List assets (shorthand for call get_assets)
 //	vulnerabilities  List vulnerabilities (shorthand for call get_vulnerabilities)
 //	requirements     List requirements (shorthand for call get_requirements)
 //	users            List users (requires ADMIN delegation)
+//	workgroups       List workgroups
+//	vuln remediation Aggregate remediation guidance for a finding or CVE
+//	summarize        Summarize an asset, scan or CVE for executives, with an LLM or a template
+//	finding create   Log a manual (pentest) finding with a CVSS calculator and evidence
+//	evidence         Upload, download and list evidence files
+//	assessment       Answer and submit assessment questionnaires
+//	report           Download, rank by risk score and email reports
+//	campaign         Track remediation campaigns and their burn-down
+//	control-test     Schedule periodic control tests on requirements and record results
+//	mapping          List and check the packs mapping requirement catalogs to NIST 800-53 and CIS v8
+//	ticket           Open ServiceNow incidents or Azure DevOps work items for findings
+//	cmdb             Reconcile assets with the ServiceNow CMDB
+//	sync netbox      Reconcile assets with NetBox prefixes and IP addresses
+//	bridge           Import findings from and export findings to DefectDojo
+//	enrich hibp      Raise findings for user accounts in recent Have I Been Pwned breaches
+//	watch            Page PagerDuty/Opsgenie on new critical findings in production
+//	gate             Fail a pipeline on finding thresholds or Rego policies
+//	pr-comment post  Post a -o pr-comment summary to a pull or merge request
+//	snapshot         Take and list local snapshots for --as-of queries
+//	events           Publish asset and finding changes to NATS or Kafka
+//	serve-grafana    Serve metrics and tables to Grafana's JSON/Infinity datasources
+//	serve-stdio      Serve the tools over MCP stdio to an LLM host, within an allow/deny policy
+//	notifications    List and acknowledge in-app notifications
+//	stats            One-screen dashboard summary
+//	top              Rank assets, CVEs or owners by open findings
+//	query            Filter and join vulnerabilities and assets with a small query language
+//	ask              Answer a plain-language question with tool calls an LLM plans
+//	scan             Show, export or upload scan artifacts
+//	coverage         Compare declared network ranges against the scan history
+//	export csv       Stream a list (assets, vulnerabilities, scans, ...) to CSV
+//	export manifests Write workgroups, assets, requirements and exceptions as apply manifests
+//	import           Import scanner output (nmap, masscan, CSV, plugin formats)
+//	apply -f <dir>   Reconcile workgroups, assets, requirements and exceptions with manifests
+//	discover <cloud> Register AWS, Azure, GCP, Kubernetes or Active Directory resources as assets
+//	requirement      Export requirements to Word or Excel
+//	translation      Export/import requirement translations (XLIFF or CSV)
+//	admin email-test Test the server's email configuration
+//	backup           Create, inspect and restore portable backups
+//	bundle           Signed air-gapped transfer bundles
+//	asset            Delete assets by id or filter
+//	shell            Interactive shell with history and tab completion
+//	config           Show the resolved settings and their sources
+//	audit-log        Verify or show the local log of mutating calls
+//	state            Show and clean the local checkpoints, records and snapshots
+//	transcript show  Print a session transcript written with --transcript
+//	verify           Check the signature of a signed export
+//	plugin list      List secman-<name> plugin executables on PATH
+//	version          Print the version this binary was built from
+//	self-update      Replace this binary with the newest verified release
+//	completion       Print or install shell completion for bash, zsh, fish or PowerShell
+//	man              Write the manual page
+//	credential       Keep secrets in the OS credential store
 package main
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/schmalle/secman/scripts/mcp/config"
+	"github.com/schmalle/secman/scripts/mcp/secman"
 )
 
-// --- JSON-RPC 2.0 types ---
+// The wire types and errors are those of the secman package, which
+// external programs import to talk to the server.
+type (
+	JSONRPCError         = secman.JSONRPCError
+	RPCCode              = secman.RPCCode
+	HTTPError            = secman.HTTPError
+	ToolCallParams       = secman.ToolCallParams
+	ToolDefinition       = secman.ToolDefinition
+	CapabilitiesResponse = secman.CapabilitiesResponse
+	ToolCallResult       = secman.ToolCallResult
+)
 
-type JSONRPCRequest struct {
-	JSONRPC string      `json:"jsonrpc"`
-	ID      string      `json:"id"`
-	Method  string      `json:"method"`
-	Params  interface{} `json:"params,omitempty"`
-}
+// --- Client ---
 
-type JSONRPCResponse struct {
-	JSONRPC string           `json:"jsonrpc"`
-	ID      string           `json:"id"`
-	Result  *json.RawMessage `json:"result,omitempty"`
-	Error   *JSONRPCError    `json:"error,omitempty"`
-}
+// McpClient is the secman package's Client with the command's modes on
+// top: dry runs, read-only sessions, snapshots, budgets, the audit log and
+// the transcript. It is safe for concurrent use by multiple goroutines: the
+// transport is, and the tool cache is guarded by a mutex. Configuration
+// fields (user, tenant, headers, dryRun) must not be changed while calls
+// are in flight.
+type McpClient struct {
+	*secman.Client
 
-type JSONRPCError struct {
-	Code    int             `json:"code"`
-	Message string          `json:"message"`
-	Data    json.RawMessage `json:"data,omitempty"`
-}
+	toolsMu sync.Mutex
+	tools   map[string]ToolDefinition
+	access  *userAccess
 
-// --- MCP types ---
+	dryRun      bool
+	readOnly    bool
+	dryRunCalls atomic.Int64
 
-type ToolCallParams struct {
-	Name      string                 `json:"name"`
-	Arguments map[string]interface{} `json:"arguments,omitempty"`
-}
+	// auditLog is the file mutating calls are recorded in; "" disables it.
+	auditLog string
+
+	// transcript, set by --transcript, records every call of the session.
+	transcript *transcript
 
-type ToolDefinition struct {
-	Name        string                 `json:"name"`
-	Description string                 `json:"description"`
-	InputSchema map[string]interface{} `json:"inputSchema,omitempty"`
+	// budget bounds the time, result size and pages of tool calls; nil
+	// leaves them unbounded.
+	budget *toolBudget
+
+	// strictTLS and tlsPins record WithStrictTLS for federated instances.
+	strictTLS bool
+	tlsPins   []string
+
+	// snapshot, set by --as-of, answers read tools instead of the server.
+	snapshot *snapshotStore
+
+	// severityMap normalizes imported and returned severities; nil keeps
+	// the scanners' own.
+	severityMap *severityMap
 }
 
-type CapabilitiesResponse struct {
-	Capabilities struct {
-		Tools []ToolDefinition `json:"tools"`
-	} `json:"capabilities"`
-	ServerInfo map[string]interface{} `json:"serverInfo"`
+func NewMcpClient(baseURL, apiKey, userEmail string, opts ...ClientOption) *McpClient {
+	c := &McpClient{Client: secman.NewClient(baseURL, apiKey, userEmail)}
+	c.UserAgent = userAgent()
+	registerSecret(apiKey)
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
-type ToolCallResult struct {
-	Content  interface{}            `json:"content"`
-	IsError  bool                   `json:"isError"`
-	Metadata map[string]interface{} `json:"metadata,omitempty"`
+// doRequest sends a JSON-RPC request to the MCP tools/call endpoint, within
+// the timeout and size limits of the tool's budget.
+func (c *McpClient) doRequest(ctx context.Context, params ToolCallParams, limits toolLimits) (*ToolCallResult, error) {
+	result, err := c.Send(ctx, params, secman.Limits{Timeout: limits.Timeout, MaxSize: limits.MaxSize})
+	var sizeErr *secman.SizeError
+	if errors.As(err, &sizeErr) {
+		return nil, limits.sizeError(sizeErr.Size)
+	}
+	if err != nil {
+		return nil, limits.timeoutError(err)
+	}
+	return result, nil
 }
 
-// --- Client ---
+// GetCapabilities fetches the server capabilities (tool list).
+func (c *McpClient) GetCapabilities() (*CapabilitiesResponse, error) {
+	return c.Capabilities(context.Background())
+}
 
-type McpClient struct {
-	baseURL   string
-	apiKey    string
-	userEmail string
-	http      *http.Client
-	requestID int
+// CallTool invokes an MCP tool by name with the given arguments.
+func (c *McpClient) CallTool(name string, args map[string]interface{}) (*ToolCallResult, error) {
+	return c.CallToolContext(context.Background(), name, args)
 }
 
-func NewMcpClient(baseURL, apiKey, userEmail string) *McpClient {
-	return &McpClient{
-		baseURL:   strings.TrimRight(baseURL, "/"),
-		apiKey:    apiKey,
-		userEmail: userEmail,
-		http: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+// CallToolContext is CallTool with a context that cancels the HTTP request.
+func (c *McpClient) CallToolContext(ctx context.Context, name string, args map[string]interface{}) (*ToolCallResult, error) {
+	if c.severityMap != nil && name == "add_vulnerability" {
+		args = c.severityMap.importArgs(c, name, args)
+	}
+	params := ToolCallParams{
+		Name:      name,
+		Arguments: c.withTenant(name, args),
+	}
+	started := time.Now()
+	limits := c.budget.limits(name)
+	if err := limits.checkPage(name, args); err != nil {
+		c.recordTranscript("refused", name, params.Arguments, nil, err, started)
+		return nil, err
+	}
+	if c.readOnly && !isReadTool(name) {
+		err := &ReadOnlyError{Tool: name}
+		c.recordTranscript("refused", name, params.Arguments, nil, err, started)
+		return nil, err
+	}
+	if c.snapshot != nil {
+		result, err := c.snapshot.call(name, args)
+		c.normalizeResult(result)
+		c.recordTranscript("snapshot", name, args, result, err, started)
+		return result, err
+	}
+	if c.dryRun && isMutatingTool(name) {
+		result, err := c.dryRunCall(name, params.Arguments, nil)
+		c.recordTranscript("dry-run", name, params.Arguments, result, err, started)
+		return result, err
 	}
-}
 
-func (c *McpClient) nextID() string {
-	c.requestID++
-	return fmt.Sprintf("req-%d", c.requestID)
+	result, err := c.sendToolCall(ctx, params, limits)
+	if isMutatingTool(name) {
+		c.recordAudit(name, params.Arguments, result, err)
+	}
+	c.normalizeResult(result)
+	c.recordTranscript("", name, params.Arguments, result, err, started)
+	return result, err
 }
 
-// doRequest sends a JSON-RPC request to the MCP tools/call endpoint.
-func (c *McpClient) doRequest(method string, params interface{}) (*json.RawMessage, error) {
-	req := JSONRPCRequest{
-		JSONRPC: "2.0",
-		ID:      c.nextID(),
-		Method:  method,
-		Params:  params,
+func (c *McpClient) normalizeResult(result *ToolCallResult) {
+	if c.severityMap != nil && result != nil && !result.IsError {
+		c.severityMap.applyResult(result.Content)
 	}
+}
 
-	body, err := json.Marshal(req)
+func (c *McpClient) sendToolCall(ctx context.Context, params ToolCallParams, limits toolLimits) (*ToolCallResult, error) {
+	result, err := c.doRequest(ctx, params, limits)
 	if err != nil {
-		return nil, fmt.Errorf("marshal request: %w", err)
+		var budgetErr *BudgetError
+		if errors.As(err, &budgetErr) {
+			budgetErr.Tool = params.Name
+		}
+		return nil, err
 	}
+	return result, nil
+}
 
-	httpReq, err := http.NewRequest("POST", c.baseURL+"/api/mcp/tools/call", bytes.NewReader(body))
+// withTenant adds the active tenant to the arguments of tools whose schema
+// declares a tenant property. The X-MCP-Tenant header is always sent; the
+// argument covers servers that scope by tool argument instead.
+func (c *McpClient) withTenant(name string, args map[string]interface{}) map[string]interface{} {
+	if c.Tenant == "" {
+		return args
+	}
+	for _, property := range []string{"tenant", "tenantId", "organization"} {
+		if _, set := args[property]; set {
+			return args
+		}
+		if ok, _ := c.toolAccepts(name, property); ok {
+			scoped := make(map[string]interface{}, len(args)+1)
+			for k, v := range args {
+				scoped[k] = v
+			}
+			scoped[property] = c.Tenant
+			return scoped
+		}
+	}
+	return args
+}
+
+// Download streams the body of a GET request into w and returns the
+// response headers. path is relative to the server, or an absolute URL the
+// server handed out, such as a presigned object-store link. The API key and
+// the other client headers are sent only to the server itself.
+func (c *McpClient) Download(path string, w io.Writer) (http.Header, error) {
+	target := c.BaseURL + path
+	if u, err := url.Parse(path); err == nil && u.IsAbs() {
+		target = path
+	}
+	httpReq, err := http.NewRequest("GET", target, nil)
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
 
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("X-MCP-API-Key", c.apiKey)
-	if c.userEmail != "" {
-		httpReq.Header.Set("X-MCP-User-Email", c.userEmail)
+	var requestID string
+	if sameOrigin(httpReq.URL, c.BaseURL) {
+		requestID = c.SetHeaders(httpReq)
+	} else {
+		requestID = secman.NewRequestID()
+		httpReq.Header.Set("User-Agent", userAgent())
 	}
 
-	resp, err := c.http.Do(httpReq)
-	if err != nil {
-		return nil, fmt.Errorf("http request: %w", err)
+	// Downloads can legitimately take longer than the RPC timeout.
+	httpClient := *c.HTTP
+	httpClient.Timeout = 0
+	// A redirect away from the server, to a presigned link for example,
+	// must not carry the client headers with it.
+	httpClient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		if !sameOrigin(req.URL, c.BaseURL) {
+			for name := range c.Headers {
+				req.Header.Del(name)
+			}
+			for _, name := range []string{"X-MCP-API-Key", "X-MCP-User-Email", "X-MCP-Tenant"} {
+				req.Header.Del(name)
+			}
+		}
+		return nil
 	}
-	defer resp.Body.Close()
-
-	respBody, err := io.ReadAll(resp.Body)
+	resp, err := httpClient.Do(httpReq)
 	if err != nil {
-		return nil, fmt.Errorf("read response: %w", err)
+		return nil, fmt.Errorf("http request (request %s): %w", requestID, err)
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(respBody))
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, secman.NewHTTPError(resp.StatusCode, body, requestID)
 	}
 
-	var rpcResp JSONRPCResponse
-	if err := json.Unmarshal(respBody, &rpcResp); err != nil {
-		return nil, fmt.Errorf("unmarshal response: %w", err)
+	total := resp.ContentLength
+	if total < 0 {
+		total = 0
 	}
-
-	if rpcResp.Error != nil {
-		return nil, fmt.Errorf("RPC error %d: %s", rpcResp.Error.Code, rpcResp.Error.Message)
+	progress := startProgress("Downloading", "bytes", total)
+	defer progress.Finish()
+	if _, err := io.Copy(progress.Writer(w), resp.Body); err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
 	}
+	return resp.Header, nil
+}
 
-	return rpcResp.Result, nil
+// sameOrigin reports whether u has the scheme, host and port of baseURL.
+func sameOrigin(u *url.URL, baseURL string) bool {
+	base, err := url.Parse(baseURL)
+	return err == nil && strings.EqualFold(u.Scheme, base.Scheme) && strings.EqualFold(u.Host, base.Host)
 }
 
-// GetCapabilities fetches the server capabilities (tool list).
-func (c *McpClient) GetCapabilities() (*CapabilitiesResponse, error) {
-	httpReq, err := http.NewRequest("GET", c.baseURL+"/api/mcp/capabilities", nil)
+// Tool returns the definition of an advertised tool. The capabilities list
+// is fetched once and cached on the client.
+func (c *McpClient) Tool(name string) (ToolDefinition, bool, error) {
+	tools, err := c.toolCache()
 	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
-	}
-
-	httpReq.Header.Set("X-MCP-API-Key", c.apiKey)
-	if c.userEmail != "" {
-		httpReq.Header.Set("X-MCP-User-Email", c.userEmail)
+		return ToolDefinition{}, false, err
 	}
+	tool, ok := tools[name]
+	return tool, ok, nil
+}
 
-	resp, err := c.http.Do(httpReq)
+// ToolNames returns the names of all advertised tools, sorted.
+func (c *McpClient) ToolNames() ([]string, error) {
+	tools, err := c.toolCache()
 	if err != nil {
-		return nil, fmt.Errorf("http request: %w", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("read response: %w", err)
+	names := make([]string, 0, len(tools))
+	for name := range tools {
+		names = append(names, name)
 	}
+	sort.Strings(names)
+	return names, nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
-	}
+// resetTools drops the cached tool list, e.g. after the delegated user
+// changed; the next lookup fetches it again.
+func (c *McpClient) resetTools() {
+	c.toolsMu.Lock()
+	c.tools = nil
+	c.access = nil
+	c.toolsMu.Unlock()
+}
 
-	var caps CapabilitiesResponse
-	if err := json.Unmarshal(body, &caps); err != nil {
-		return nil, fmt.Errorf("unmarshal capabilities: %w", err)
+// toolCache returns the cached tool map, fetching it on first use. The map
+// is never modified after it is built, so callers may read it unlocked.
+func (c *McpClient) toolCache() (map[string]ToolDefinition, error) {
+	c.toolsMu.Lock()
+	defer c.toolsMu.Unlock()
+	if c.tools == nil && c.snapshot != nil {
+		c.tools = c.snapshot.tools()
 	}
+	if c.tools == nil {
+		caps, err := c.GetCapabilities()
+		if err != nil {
+			return nil, err
+		}
+		tools := make(map[string]ToolDefinition, len(caps.Capabilities.Tools))
+		for _, tool := range caps.Capabilities.Tools {
+			tools[tool.Name] = tool
+		}
+		c.tools = tools
+		c.access = accessFromServerInfo(caps.ServerInfo)
+	}
+	return c.tools, nil
+}
 
-	return &caps, nil
+// HasTool reports whether the server advertises a tool with the given name.
+func (c *McpClient) HasTool(name string) (bool, error) {
+	_, ok, err := c.Tool(name)
+	return ok, err
 }
 
-// CallTool invokes an MCP tool by name with the given arguments.
-func (c *McpClient) CallTool(name string, args map[string]interface{}) (*ToolCallResult, error) {
-	params := ToolCallParams{
-		Name:      name,
-		Arguments: args,
+// toolAccepts reports whether a tool's inputSchema declares the property.
+func (c *McpClient) toolAccepts(tool, property string) (bool, error) {
+	def, ok, err := c.Tool(tool)
+	if err != nil || !ok {
+		return false, err
 	}
+	props, _ := def.InputSchema["properties"].(map[string]interface{})
+	_, ok = props[property]
+	return ok, nil
+}
 
-	result, err := c.doRequest("tools/call", params)
+// requireTool returns an error naming the missing tool when the server does
+// not advertise it, so optional features fail with an actionable message.
+func (c *McpClient) requireTool(name string) error {
+	ok, err := c.HasTool(name)
 	if err != nil {
-		return nil, err
+		return err
 	}
-
-	var toolResult ToolCallResult
-	if result != nil {
-		if err := json.Unmarshal(*result, &toolResult); err != nil {
-			return nil, fmt.Errorf("unmarshal tool result: %w", err)
-		}
+	if !ok {
+		return &ToolNotFoundError{Name: name}
 	}
+	return nil
+}
 
-	return &toolResult, nil
+// callToolMap calls a tool and returns its content as a JSON object, turning
+// tool-level errors (isError) into Go errors.
+func (c *McpClient) callToolMap(name string, args map[string]interface{}) (map[string]interface{}, error) {
+	result, err := c.CallTool(name, args)
+	if err != nil {
+		return nil, err
+	}
+	if result.IsError {
+		return nil, fmt.Errorf("%s failed: %v", name, result.Content)
+	}
+	content, _ := result.Content.(map[string]interface{})
+	if content == nil {
+		content = map[string]interface{}{}
+	}
+	return content, nil
 }
 
 // --- CLI ---
 
-func printJSON(v interface{}) {
-	out, err := json.MarshalIndent(v, "", "  ")
+// remarshal converts a decoded JSON value (e.g. tool content) into a typed
+// value by round-tripping it through encoding/json.
+func remarshal(in, out interface{}) error {
+	data, err := json.Marshal(in)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error formatting output: %v\n", err)
-		return
+		return err
 	}
-	fmt.Println(string(out))
+	return json.Unmarshal(data, out)
 }
 
-func usage() {
-	fmt.Fprintf(os.Stderr, `Secman MCP Client - Go Example
+// stringField returns m[key] as a string, formatting non-string values.
+func stringField(m map[string]interface{}, key string) string {
+	switch v := m[key].(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
 
-Usage: go run main.go <command> [flags]
+// numberField returns m[key] as a float64, parsing numeric strings.
+func numberField(m map[string]interface{}, key string) float64 {
+	switch v := m[key].(type) {
+	case float64:
+		return v
+	case string:
+		f, _ := strconv.ParseFloat(v, 64)
+		return f
+	}
+	return 0
+}
+
+// mapsField returns m[key] as a slice of JSON objects.
+func mapsField(m map[string]interface{}, key string) []map[string]interface{} {
+	raw, _ := m[key].([]interface{})
+	items := make([]map[string]interface{}, 0, len(raw))
+	for _, item := range raw {
+		if o, ok := item.(map[string]interface{}); ok {
+			items = append(items, o)
+		}
+	}
+	return items
+}
+
+// parseInterspersed parses flags that may appear before, between or after
+// positional arguments and returns the positional arguments.
+func parseInterspersed(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		parseFlags(fs, args)
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// usageTemplate is the help text; progName replaces "go run ." in it.
+const usageTemplate = `Secman MCP Client - Go Example
+
+Usage: go run . [global flags] <command> [flags]
+
+Global Flags:
+  --base-url <url>      Backend URL (overrides SECMAN_BASE_URL)
+  --user-email <email>  User email for delegation (overrides SECMAN_USER_EMAIL)
+  --tenant, --org <name>
+                        Scope every call to a tenant (overrides SECMAN_TENANT)
+  --profile <name>      Profile section of the config file (default: SECMAN_PROFILE, then "default")
+  --env-file <file>     Settings file (default: nearest .env or secman.env)
+  --header 'Name: value'
+                        Add a header to every request (repeatable), e.g. for an API gateway
+  --dry-run             Validate and print mutating calls without sending them
+  --read-only           Refuse every tool call that changes records (default: SECMAN_READ_ONLY;
+                        SECMAN_MUTATING_TOOLS adds tools the verb heuristic misses)
+  --as-of <time>        Answer read commands from the newest snapshot taken on or before the time
+                        (YYYY-MM-DD, RFC 3339 or an age such as 30d; no server or API key needed)
+  --severity-map <file> Map scanner severities onto one scale on import and display
+                        (default: SECMAN_SEVERITY_MAP; off disables)
+  --tool-timeout <d>    Time limit of every tool call, e.g. 2m (default: the 30s HTTP timeout)
+  --max-result-size <n> Size limit of every tool result, e.g. 20MB
+  --max-pages <n>       Page limit of every paginated tool call
+  --tool-limits <rules> Per-tool limits, e.g. 'get_vulnerabilities: timeout=2m max-pages=50; export_*: timeout=10m'
+  --strict-tls          Require TLS 1.2+, approved cipher suites and https (pins: SECMAN_TLS_PIN)
+  --debug               Dump HTTP traffic to stderr (API keys, tokens and passwords redacted)
+  --transcript <file>   Append the session's tool calls, results and LLM exchanges, redacted, to a file
+  -q, --quiet           Print only essential output (IDs, counts, paths) and errors
+  -o, --output-format json|yaml|table|csv|template|pr-comment|tfdata
+                        Output format for results (default: json; tfdata: versioned schema of
+                        assets and workgroups for Terraform)
+  --tfdata-version <majors>
+                        tfdata schema versions the consumer understands, e.g. 2,1 (default: newest)
+  --template <tmpl>     Render results through a Go template (or @file); implies -o template
+  --color auto|always|never
+                        Colorize tables (default: auto, on for terminals)
 
 Commands:
-  capabilities          List available MCP tools
-  call <tool> [--args]  Call a tool (pass arguments as JSON)
-  assets                List assets (optional: --name, --type, --page, --pageSize)
-  vulnerabilities       List vulnerabilities (optional: --severity, --page, --pageSize)
+  capabilities          List the MCP tools the delegated user can call (optional: --all)
+  capabilities diff --profile <from> --profile <to>
+                        Compare the tool catalogs and schemas of two profiles' servers and mark
+                        breaking changes (optional: --fail-on breaking|any|never, --json)
+  describe <tool>...    Show a tool's description, parameters (types, enums, defaults, required)
+                        and example calls made up from its schema (optional: --json)
+  verify-contract       Call every advertised read tool with minimal arguments made up from its
+                        schema and check the results parse into the expected shapes; exits 5 on
+                        a broken contract (optional: --tool <pattern>, --include-mutating,
+                        --strict, --json)
+  call <tool> [--args]  Call a tool (pass arguments as JSON, or answer prompts for them on a terminal;
+                        --stdin calls once per input record)
+  assets                List assets (optional: --name, --type, --page, --pageSize, --all,
+                        --criticality, --environment, --classification, --business-owner)
+  vulnerabilities       List vulnerabilities (optional: --severity, --page, --pageSize, --all,
+                        --risk to add a riskScore and sort by it, --weights, --offline,
+                        --since, --created-after/-before, --scanned-after/-before,
+                        --resolved-after/-before from snapshots, --asset-criticality,
+                        --environment, --classification, --business-owner, --sort criticality|...,
+                        --age-bucket counts by days open instead of listing)
   requirements          List requirements (optional: --status, --priority, --limit)
   users                 List users (requires ADMIN delegation)
-  scans                 List scan history
-
-Environment Variables:
+  workgroups            List workgroups (list_workgroups, or those of assets on older servers)
+  scans                 List scan history (optional: --since, --created-after, --created-before)
+                        (assets, vulnerabilities, requirements, users and scans accept
+                        --all-instances or --instances a,b to query several servers)
+  vuln remediation <id|CVE>
+                        Remediation summary from findings and NVD (optional: --write-back, --no-nvd, --json)
+  summarize <asset|scan|cve> <name|id|CVE>
+                        Write an executive summary and remediation steps with the LLM at SECMAN_LLM_URL,
+                        or from a template (optional: --offline, --anonymize, --model, --max-findings 50,
+                        --no-nvd, --json)
+  finding create        Log a manual finding on assets; prompts for what the flags leave out, with a CVSS
+                        calculator and an asset picker (--title, --asset, --cvss or --severity, --id,
+                        --description, --evidence <file>, --owner, --yes, --json)
+  evidence upload <entity> <file>
+                        Attach a file to assessment:<id>, exception:<id>, request:<id> or finding:<id>
+  evidence download <id>
+                        Download an evidence file (optional: --output)
+  evidence list <entity>
+                        List evidence attached to an entity
+  assessment list       List risk assessments
+  assessment questions <id>
+                        Show questionnaire questions (optional: --unanswered, --json)
+  assessment answer <id>
+                        Answer questions (--requirement, --answer, --comment or --file answers.yaml|csv)
+  assessment submit <id>
+                        Submit a completed questionnaire
+  report list           List server-generated reports (optional: --type, --json)
+  report download <id>  Download a report with checksum verification (optional: --output-dir, --output, --anonymize)
+  report risk-ranking   Rank findings or assets by risk score (optional: --by finding|asset, --top,
+                        --severity, --weights, --offline, --json)
+  report send --to <addrs>
+                        Email the dashboard summary as HTML through SMTP (optional: --report <id> and
+                        --attach <file> attach files, repeatable; --subject, --top, --age-bucket,
+                        --sla adds SLA compliance, --no-charts uses tables instead of images)
+  report applicability-gaps
+                        List assets not evaluated for requirements that apply to them (optional:
+                        --requirement, --owner, --fail-on-gaps, --json)
+  report compliance --pack <name>
+                        Show which controls of a mapped framework the requirements cover, with their
+                        control test state (optional: --gaps, --min-coverage 80, --json)
+  report trend          Show open findings by severity per snapshot, with sparklines on a terminal
+                        (optional: --since 90d, --points N, --json)
+  campaign create <name>
+                        Group the open findings matching --severity/--cve/--asset-id into a
+                        remediation campaign (optional: --due YYYY-MM-DD, --description)
+  campaign status <name>
+                        Sync and show progress and burn-down (optional: --no-sync, --remaining N, --json)
+  campaign report <name>
+                        Write an HTML progress report with burn-down and severity charts (optional: --output, --sign)
+  campaign list         List campaigns with their progress
+  control-test schedule <requirementId> --frequency quarterly
+                        Add a periodic test to a requirement (optional: --owner, --name, --start)
+  control-test list     Show the test calendar with overdue and failed tests flagged (optional: --overdue,
+                        --owner, --requirement, --due-within 14, --fail-on-overdue, --json)
+  control-test record <testId> --result PASS|FAIL|N_A
+                        Record a test run and move the due date on (optional: --notes, --evidence, --tester, --date)
+  mapping packs         List the built-in and local mapping packs (optional: --json)
+  mapping show <pack>   Show a pack's mappings (optional: --json)
+  mapping validate <file.json>...
+                        Check pack files before putting them in SECMAN_MAPPING_PACKS
+  ticket servicenow     Open an incident per finding matching --severity/--cve/--asset-id, skipping those
+                        with an active incident (optional: --per asset, --assignment-group, --category, --json)
+  ticket azure-devops   Create a work item per finding matching --severity/--cve/--asset-id, skipping those
+                        with an open work item (optional: --per asset, --type Bug, --area-path,
+                        --iteration, --field Ref=value, --json)
+  bridge defectdojo import
+                        Import active DefectDojo findings, one per endpoint host (optional: --product,
+                        --engagement, --test, --severity, --host for findings without endpoints, --json)
+  bridge defectdojo export --engagement <id>
+                        Create DefectDojo findings for findings matching --severity/--cve/--asset-id in the
+                        engagement's Secman test (optional: --test-type, --json)
+  bridge defectdojo map List which Secman finding is which DefectDojo finding (optional: --json)
+  cmdb sync servicenow  Match assets with CMDB CIs by serial, hostname and IP and list orphans on both
+                        sides (optional: --table, --query, --match, --fill-serials, --json)
+  sync netbox           Create assets for active NetBox IP addresses without one, flag owners that differ
+                        from NetBox and list assets NetBox does not know (optional: --owner-field tenant,
+                        --type SERVER, --fix-owners, --report, --diff, --fail-on-drift, --json, --yes)
+  enrich hibp           Raise a finding on each user's IDENTITY asset for every breach added since --since
+                        (optional: --domain example.com, --since 365d, --dataset file, --report, --json, --yes)
+  watch                 Poll for new CRITICAL findings on assets tagged environment=production and
+                        raise PagerDuty/Opsgenie alerts, one per CVE (optional: --interval 5m, --once,
+                        --tag, --severity, --alert pagerduty,opsgenie, --alert-existing, --resolve, --state)
+  gate                  Exit 5 when open findings break a rule: --max-critical, --max-high, --max-medium,
+                        --max-low, --max-overdue or a Rego --policy file evaluated with opa (optional:
+                        --query, --tag, --asset-id, --offline, --json)
+                        --compare-baseline <file> counts only findings new or worse since a snapshot
+                        saved by --write-baseline <file>
+                        --config <file|url> applies thresholds, SLA days and exceptions per workgroup
+                        (default: SECMAN_GATE_CONFIG or .secman-gate.yaml in the working directory)
+  pr-comment post [file]
+                        Post Markdown from -o pr-comment (file or stdin) to a GitHub pull request or GitLab
+                        merge request, updating the previous one (optional: --github owner/repo,
+                        --gitlab <project>, --pr N, --api-url, --token, --new)
+  events publish --nats <url> | --kafka-rest <url>
+                        Poll for changes and publish asset.created, finding.created and finding.resolved
+                        events (optional: --prefix secman, --interval 15m, --once, --emit-existing, --state)
+  events tail           Follow the server's change feed from a saved cursor and print the events, or
+                        forward them with --nats/--kafka-rest (optional: --type 'finding.*',
+                        --since 24h, --from-start, --once, --interval 10s, --json)
+  serve-grafana         Serve metrics, tables and annotations to Grafana's JSON and Infinity
+                        datasources (optional: --listen 127.0.0.1:3003, --cache 1m)
+  serve-stdio           Serve the tools over MCP stdio to an LLM host (optional: --read-only,
+                        --allow get_*,list_*, --deny <tools>, --list to print the policy's verdicts,
+                        --max-output 100KB or --max-tokens N, --overflow summarize|truncate)
+  notifications list    List notifications (optional: --unread, --type, --count, --json)
+  notifications ack <id>...
+                        Acknowledge notifications (or --all [--type])
+  stats                 Dashboard summary: vulns by severity, assets by type, recent scans, riskiest assets
+                        (optional: --age-bucket adds vulns by days open)
+  top assets|cves|owners
+                        Rank by open findings (--by open, open-critical, open-high, overdue, oldest,
+                        affected-assets for cves and owners; optional: -n 10, --severity, business
+                        context filters, --json)
+  query '<query>'       Filter vulnerabilities or assets, joined client-side, e.g.
+                        'vulnerabilities where asset.tag.pci = true and asset.owner = team-x'
+                        (operators: = != < <= > >= ~ in exists, and/or/not, order by, limit;
+                        optional: --fields a,asset.b)
+  ask "<question>"      Let the LLM at SECMAN_LLM_URL plan read tool calls and queries for the question,
+                        confirm the plan, run it and print the results (optional: --plan, --allow-writes,
+                        --model, --json, --yes)
+  scan show <id>        Scan metadata, host/port breakdown and derived findings (optional: --json)
+  scan export <id>      Download the originally uploaded artifact (optional: --format xml, --output, --anonymize)
+  scan upload <file>... Upload nmap/masscan XML, skipping artifacts imported before (by SHA-256)
+                        (optional: --type, --on-duplicate skip|warn|fail, --chunk-size)
+  coverage --ranges <cidr|file>
+                        Show which declared ranges (CIDRs, first-last, or an IPAM CSV/JSON export) scans
+                        never found a host in, or last did over --max-age days ago (optional: --max-age 30,
+                        --since 365d, --gaps, --fail-on-gaps, --json)
+  export csv <dataset>  Stream assets, vulnerabilities, scans, ... to CSV page by page
+                        (optional: --args '{...}', --columns a,b, --output, --no-header, --sign, --destination)
+  export manifests      Write workgroups, assets, requirements and exceptions as YAML for apply
+                        (optional: --sections, --output-dir one file per section)
+  import <file>...      Import scanner output in a detected format (optional: --format, --on-duplicate,
+                        --workers 4, --error-report failed.csv)
+  import formats        List the import formats, including plugins
+  import dhcp-leases <file>...
+                        Flag devices in DHCP leases (ISC, dnsmasq, MikroTik, Kea/Windows CSV) that are not in
+                        the approved inventory as transient assets (optional: --format, --owner, --report,
+                        --prune, --expire-after, --fail-on-rogue, --diff)
+  import arp <file>...  The same for ARP and neighbor tables (arp -a, ip neigh, show ip arp)
+  apply -f <file|dir>   Create and update workgroups, assets, requirements and exceptions to match YAML/JSON
+                        manifests (optional: -R, --prune deletes unlisted records, --diff only shows changes)
+  discover aws|azure|gcp
+                        Create and update assets for the cloud's instances and load balancers, tagged with
+                        region and public exposure (optional: --regions, --subscription, --project, --kinds,
+                        --owner, --no-cloud-tags, --list only prints them, --prune deletes vanished ones, --diff)
+  discover k8s          The same for a cluster's nodes, externally reachable services and container images
+                        (optional: --context, default the kubeconfig's current context; --kinds node,service,image)
+  discover ldap         The same for Active Directory/LDAP computer accounts, tagged with ad-status never-scanned,
+                        stale, disabled or active (--url, --base-dn, optional: --bind-dn, --filter, --stale-after,
+                        --report only lists never-scanned and stale computers)
+  requirement export    Export requirements (--format xlsx|docx, optional: --norm, --usecase, --template, --output-dir)
+  requirement update <id>...
+                        Change --shortreq, --details, --motivation, --example, --norm, --usecase or --chapter
+                        after showing a field-level diff (optional: --stdin, --yes)
+  requirement applicability set <id>... --type T | --tag k=v | --clear
+                        Record which asset types and tags requirements apply to (repeatable)
+  requirement applicability list
+                        Show the applicability rules and how many assets each covers (optional: --json)
+  translation export    Export requirement texts for translation (--lang, optional: --format xliff|csv, --output)
+  translation import <file>
+                        Import reviewed translations from XLIFF or CSV (optional: --lang)
+  admin email-test --to <addr>
+                        Send a test mail and show SMTP handshake details (ADMIN)
+  backup create         Archive assets, vulnerabilities, requirements, assessments and configuration
+                        (optional: --output, --sections, --no-attachments)
+  backup inspect <file> Show the manifest of a backup archive
+  backup restore <file> Load a backup into the configured server (optional: --sections)
+  snapshot take         Store assets, vulnerabilities, requirements, ... in the local snapshot store for
+                        --as-of (optional: --sections, --keep N)
+  snapshot list         List the snapshots in the store (optional: --json)
+  bundle keygen         Create an Ed25519 signing key pair (optional: --name)
+  bundle export --key <file>
+                        Write a signed bundle for offline transfer (optional: --since, --sections, --output, --anonymize)
+  bundle import <file> --pubkey <file>
+                        Verify and load a bundle (optional: --on-conflict skip|update|fail)
+  asset delete <id>...  Delete assets by id, or by --name/--type/--ip/--owner, business context
+                        filter (--criticality, --environment, ...) or --stdin
+  asset assign --to <owner> | --workgroup <id>
+                        Set the owner of / add to a workgroup the selected assets (same selection)
+  asset set <id>...     Set --criticality, --environment, --classification, --business-owner (or --clear)
+  asset update <id>...  Change --name, --type, --owner, --ip, --uri, --description, --criticality, --ad-domain
+                        or --tag k=v after showing a field-level diff (optional: --stdin, --yes)
+  asset decommission <id>... --reason <text>
+                        Retire assets and close their findings (same selection); gates and stats skip them
+  asset decommission-candidates
+                        List assets no scan has seen for --unseen (default 90d)
+                        (restore, import and delete commands ask first; --yes skips the prompt)
+  config                Show each setting and where it comes from
+  credential set|get|delete <name>
+                        Keep a secret in the OS credential store (Windows Credential Manager, macOS
+                        keychain, Secret Service); settings read it as keyring:<name> (set: --stdin)
+  audit-log verify      Check the hash chain of the local audit log (optional: --file)
+  audit-log show        Print the last audit log entries (optional: --last N, --file, --since)
+  state show            List the local state (checkpoints, records, snapshots, logs) with sizes and
+                        whether a running command holds it (optional: --json)
+  state clean [<name>...]
+                        Remove the named state, e.g. watch-state or snapshots, and temporary files
+                        left by interrupted writes (optional: --older-than 90d, --yes)
+  transcript show <file> Print a session transcript (optional: --session <id>, --full, --json)
+  verify <file> --pubkey <key>
+                        Check a signed export's <file>.minisig (optional: --signature)
+                        (report download, scan/requirement/translation export and backup
+                        create sign their file with --sign <key> or SECMAN_SIGNING_KEY; they and
+                        campaign report also upload it with --destination s3://|azure://|gs://...,
+                        optional: --encryption, --encryption-key, --partition hive|date|none)
+  shell                 Interactive shell: history, tab completion of commands, tools and
+                        tool arguments (optional: --history <file>)
+  plugin list           List the secman-<name> executables on PATH; "go run . <name>" runs one
+                        with the resolved settings in its environment
+  version               Print the version, commit and build date (optional: --json)
+  self-update           Install the newest release for this platform after checking its SHA-256
+                        (optional: --check, --version <tag>, --pubkey <key>)
+  completion bash|zsh|fish|powershell
+                        Print the shell's completion script (commands, subcommands, flags, tool names)
+  completion install    Install it where the shell loads it from (optional: --shell, --output)
+  man                   Print the manual page in roff (optional: --output <dir> writes <dir>/secman.1)
+  help                  Print this help to stdout
+
+Environment Variables (also read from .env/secman.env and the config file profile):
   SECMAN_BASE_URL       Backend URL (default: http://localhost:8080)
   SECMAN_MCP_KEY        MCP API key (required)
   SECMAN_USER_EMAIL     User email for delegation (optional)
+  SECMAN_TENANT         Default tenant/organization (same as --tenant / --org)
+  SECMAN_INSTANCES      Federated instances as name=url,... (keys: SECMAN_MCP_KEY_<NAME>)
+  SECMAN_ANONYMIZE_KEY  Key for --anonymize pseudonyms (optional; random per run if unset)
+  SECMAN_OVERDUE_DAYS   Days open after which findings are shown as overdue (default: 30)
+  SECMAN_RISK_WEIGHTS   Risk score weights as name=weight,... (same as --weights)
+  SECMAN_EPSS_URL       EPSS API mirror (default: FIRST's api.first.org)
+  SECMAN_KEV_URL        KEV catalog mirror (default: CISA's feed)
+  SECMAN_CAMPAIGN_DIR   Where campaigns are kept (default: campaigns/ next to the config file)
+  SECMAN_APPLICABILITY_FILE
+                        Requirement applicability rules (default: applicability.json next to the config file)
+  SECMAN_CONTROL_TEST_FILE
+                        Control tests and their results (default: control-tests.json next to the config file)
+  SECMAN_COVERAGE_RANGES
+                        Declared ranges for coverage, comma-separated ranges or files
+  SECMAN_MAPPING_PACKS  Directory of local mapping packs (default: mapping-packs/ next to the config file)
+  SECMAN_SERVICENOW_URL ServiceNow instance for ticket and cmdb (e.g. https://example.service-now.com)
+  SECMAN_SERVICENOW_TOKEN
+                        ServiceNow OAuth token, or SECMAN_SERVICENOW_USER and SECMAN_SERVICENOW_PASSWORD
+  SECMAN_SERVICENOW_ASSIGNMENT_GROUP
+                        Default assignment group of new incidents (same as --assignment-group)
+  SECMAN_AZURE_DEVOPS_URL
+                        Azure DevOps organization or collection URL for ticket (e.g. https://dev.azure.com/example)
+  SECMAN_AZURE_DEVOPS_PROJECT
+                        Azure DevOps project; SECMAN_AZURE_DEVOPS_TOKEN is a PAT with Work Items read & write
+  SECMAN_AZURE_DEVOPS_AREA_PATH, SECMAN_AZURE_DEVOPS_ITERATION, SECMAN_AZURE_DEVOPS_TYPE
+                        Defaults of --area-path, --iteration and --type
+  SECMAN_AZURE_DEVOPS_FIELDS
+                        Field mappings applied before --field, as Ref=value;Ref=value
+  SECMAN_NETBOX_URL     NetBox instance for sync netbox; SECMAN_NETBOX_TOKEN is an API token
+  SECMAN_LLM_URL        OpenAI-compatible API for summarize and ask, e.g. http://localhost:11434/v1; SECMAN_LLM_MODEL
+                        is the model and SECMAN_LLM_API_KEY its key
+  SECMAN_HIBP_API_KEY   Have I Been Pwned API key for enrich hibp; SECMAN_HIBP_URL points at a mirror
+  SECMAN_DEFECTDOJO_URL DefectDojo instance for bridge; SECMAN_DEFECTDOJO_TOKEN is an API v2 key
+  SECMAN_DEFECTDOJO_MAP_FILE
+                        Linked finding ids (default: defectdojo-map.json next to the config file)
+  SECMAN_PAGERDUTY_ROUTING_KEY
+                        PagerDuty Events API v2 routing key for watch alerts
+  SECMAN_OPSGENIE_API_KEY
+                        Opsgenie API key for watch alerts (EU accounts: SECMAN_OPSGENIE_URL=https://api.eu.opsgenie.com)
+  SECMAN_WATCH_TAG      Asset tag that watch alerts on (default: environment=production)
+  SECMAN_WATCH_STATE    watch state file (default: watch-state.json next to the config file)
+  SECMAN_SMTP_HOST      SMTP server for report send (SECMAN_SMTP_PORT, default 587)
+  SECMAN_SMTP_TLS       starttls (default), tls (implicit, default on port 465) or none
+  SECMAN_SMTP_USER      SMTP login, with SECMAN_SMTP_PASSWORD (optional)
+  SECMAN_SMTP_FROM      Sender address (default: SECMAN_SMTP_USER)
+  SECMAN_GATE_POLICY    Rego policy files or directories for gate, comma-separated (same as --policy)
+  SECMAN_GATE_QUERY     Rego query of gate (default: data.secman.gate.deny)
+  SECMAN_GATE_CONFIG    gate configuration file or URL (SECMAN_GATE_CONFIG_TOKEN: bearer token for the URL)
+  SECMAN_OPA            opa binary for gate --policy (default: opa on the PATH)
+  SECMAN_UI_URL         Secman web UI for links in pr-comment output (default: SECMAN_BASE_URL)
+  SECMAN_GITHUB_TOKEN   Token for pr-comment post to GitHub (default: GITHUB_TOKEN)
+  SECMAN_GITLAB_TOKEN   Token for pr-comment post to GitLab, with api scope (default: GITLAB_TOKEN)
+  SECMAN_IMPORT_PLUGINS Directories of secman-import-<format> plugins (default: importers/ in the config directory)
+  SECMAN_SCAN_STATE     Local record of scan uploads (default: uploaded-scans.jsonl in the config directory)
+  SECMAN_DISCOVER_REGIONS
+                        AWS regions of discover aws (same as --regions; default: every enabled region)
+  SECMAN_DISCOVER_OWNER Owner of assets created by discover (same as --owner)
+  KUBECONFIG            kubeconfig files of discover k8s (default: ~/.kube/config)
+  SECMAN_K8S_CLUSTER    Cluster name of discover k8s when run inside a pod without kubeconfig (default: in-cluster)
+  SECMAN_LDAP_URL, SECMAN_LDAP_BASE_DN, SECMAN_LDAP_BIND_DN, SECMAN_LDAP_FILTER, SECMAN_LDAP_STALE_AFTER
+                        Defaults of the discover ldap flags
+  SECMAN_LDAP_PASSWORD  Bind password of discover ldap
+  SECMAN_LDAP_CA        CA bundle (PEM) that verifies the directory server (default: system roots)
+  SECMAN_TFDATA_VERSION tfdata schema versions to negotiate (same as --tfdata-version)
+  SECMAN_SEVERITY_MAP   Severity mapping file (YAML or JSON), or off
+  SECMAN_SNAPSHOT_DIR   Snapshot store of snapshot take and --as-of (default: snapshots/ next to the config file)
+  SECMAN_NATS_URL       NATS server for events publish (credentials: SECMAN_NATS_TOKEN or _USER/_PASSWORD)
+  SECMAN_KAFKA_REST_URL Kafka REST Proxy for events publish (SECMAN_KAFKA_REST_USER/_PASSWORD optional)
+  SECMAN_EVENTS_PREFIX  Subject/topic prefix of published events (default: secman)
+  SECMAN_EVENTS_STATE   events publish state file (default: events-state.json next to the config file)
+  SECMAN_EVENTS_CURSOR  events tail cursor file (default: events-cursor.json next to the config file)
+  SECMAN_GRAFANA_LISTEN serve-grafana listen address (default: 127.0.0.1:3003)
+  SECMAN_GRAFANA_TOKEN  Bearer token serve-grafana requires from Grafana (optional)
+  SECMAN_SHUTDOWN_TIMEOUT
+                        How long watch, events, serve-grafana and serve-stdio wait for work in flight
+                        after SIGINT or SIGTERM (default: 30s; flag: --shutdown-timeout)
+  SECMAN_BRIDGE_ALLOW, SECMAN_BRIDGE_DENY, SECMAN_BRIDGE_READ_ONLY
+                        Defaults of the serve-stdio --allow, --deny and --read-only flags
+  SECMAN_BRIDGE_MAX_OUTPUT, SECMAN_BRIDGE_MAX_TOKENS, SECMAN_BRIDGE_OVERFLOW
+                        Defaults of the serve-stdio --max-output, --max-tokens and --overflow flags
+  SECMAN_DESTINATION    Default --destination of exports (s3://bucket/prefix, azure://account/container/prefix,
+                        gs://bucket/prefix; credentials: AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY,
+                        SECMAN_AZURE_STORAGE_SAS or _KEY, SECMAN_GCS_TOKEN)
+  SECMAN_S3_ENDPOINT    S3-compatible endpoint for s3:// destinations (e.g. MinIO; default: AWS)
+  SECMAN_STRICT_TLS     true to always use --strict-tls (e.g. in a profile)
+  SECMAN_TLS_PIN        Accepted server keys as sha256/<base64>,... (implies --strict-tls)
+  SECMAN_AUDIT_LOG      Audit log of mutating calls (default: audit.jsonl in ~/.local/state/secman; "off" disables it)
+  SECMAN_READ_ONLY      true refuses every tool call that changes records (as --read-only)
+  SECMAN_MUTATING_TOOLS Tools or patterns that change records besides those named add_, update_, ...
+  SECMAN_TOOL_TIMEOUT, SECMAN_TOOL_MAX_SIZE, SECMAN_TOOL_MAX_PAGES, SECMAN_TOOL_LIMITS
+                        Tool budgets (same as --tool-timeout, --max-result-size, --max-pages, --tool-limits)
+  SECMAN_TRANSCRIPT     Session transcript of every tool call and LLM exchange (same as --transcript)
+  SECMAN_SIGNING_KEY    Private key used to sign every export (same as --sign)
+  SECMAN_VERIFY_KEY     Default public key for verify
+  SECMAN_UPDATE_PUBKEY  Release key self-update checks checksums.txt.minisig with
+  SECMAN_UPDATE_REPO    GitHub repository self-update installs from (default: schmalle/secman);
+                        SECMAN_UPDATE_API_URL points at GitHub Enterprise or a mirror
+  SECMAN_PROFILE        Profile to use from the config file
+  SECMAN_CONFIG         Config file (default: ~/.config/secman/config)
+  XDG_CONFIG_HOME, XDG_STATE_HOME
+                        Base directories of the config file and of the audit log and shell history,
+                        honoured on every OS
+  NO_COLOR              Disable colored output (same as --color never)
+
+Exit Codes:
+  0 ok, 1 usage or other error, 2 auth failure, 3 not found,
+  4 rate limited, 5 gate/check failed, 6 partial failure
 
 Examples:
   # List all available tools
-  go run main.go capabilities
+  go run . capabilities
 
   # Get first page of assets
-  go run main.go assets --page 0 --pageSize 10
+  go run . assets --page 0 --pageSize 10
 
   # Get critical vulnerabilities
-  go run main.go vulnerabilities --severity CRITICAL
+  go run . vulnerabilities --severity CRITICAL
 
   # Call any tool with raw JSON arguments
-  go run main.go call get_asset_profile --args '{"assetId": 42}'
+  go run . call get_asset_profile --args '{"assetId": 42}'
+
+  # Remediation guidance for a CVE
+  go run . vuln remediation CVE-2024-3094
 
   # List users (requires admin delegation)
-  SECMAN_USER_EMAIL=admin@example.com go run main.go users
-`)
-	os.Exit(1)
+  SECMAN_USER_EMAIL=admin@example.com go run . users
+`
+
+// usageText is the help text with the name the client was run by.
+func usageText() string {
+	return strings.ReplaceAll(usageTemplate, "go run . ", progName()+" ")
 }
 
-func envOrDefault(key, defaultVal string) string {
-	if v := os.Getenv(key); v != "" {
-		return v
-	}
-	return defaultVal
+// usage prints the help text to stderr and exits with ExitUsage, for a
+// missing or unknown command.
+func usage() {
+	fmt.Fprint(os.Stderr, usageText())
+	exit(ExitUsage)
+}
+
+// help prints the help text that was asked for to stdout.
+func help() {
+	fmt.Print(usageText())
+	exit(ExitOK)
 }
 
 func main() {
-	if len(os.Args) < 2 {
+	global := flag.NewFlagSet("secman-mcp", flag.ContinueOnError)
+	global.Usage = func() {}
+	tenant := global.String("tenant", "", "Tenant/organization to scope every call to (default: SECMAN_TENANT)")
+	global.StringVar(tenant, "org", "", "Alias for --tenant")
+	global.String("base-url", "", "Backend URL (default: SECMAN_BASE_URL)")
+	global.String("user-email", "", "User email for delegation (default: SECMAN_USER_EMAIL)")
+	profile := global.String("profile", "", "Profile section of the config file (default: SECMAN_PROFILE, then default)")
+	envFile := global.String("env-file", "", "Read settings from this file instead of the nearest .env/secman.env")
+	var headers headerFlag
+	global.Var(&headers, "header", "Extra request header 'Name: value' (repeatable)")
+	dryRun := global.Bool("dry-run", false, "Validate and print mutating tool calls without sending them")
+	readOnly := global.Bool("read-only", false, "Refuse every tool call that changes records (default: SECMAN_READ_ONLY)")
+	asOf := global.String("as-of", "", "Answer read commands from the newest local snapshot taken on or before this date")
+	global.String("transcript", "", "Record the session's tool calls and LLM exchanges, redacted, in this file (default: SECMAN_TRANSCRIPT)")
+	global.String("tool-timeout", "", "Time limit of every tool call, e.g. 2m (default: SECMAN_TOOL_TIMEOUT)")
+	global.String("max-result-size", "", "Size limit of every tool result, e.g. 20MB (default: SECMAN_TOOL_MAX_SIZE)")
+	global.String("max-pages", "", "Page limit of every paginated tool (default: SECMAN_TOOL_MAX_PAGES)")
+	global.String("tool-limits", "", "Per-tool limits, e.g. 'get_vulnerabilities: timeout=2m max-pages=50; export_*: timeout=10m'")
+	global.String("severity-map", "", "Severity mapping file applied on import and display (default: SECMAN_SEVERITY_MAP)")
+	global.Bool("strict-tls", false, "Require TLS 1.2+, approved cipher suites and the SECMAN_TLS_PIN pins")
+	debug := global.Bool("debug", false, "Dump HTTP requests and responses to stderr, with credentials redacted")
+	outputFormat := global.String("output-format", "", "Output format: json, yaml, table, csv, template, pr-comment or tfdata (default json)")
+	global.String("tfdata-version", "", "tfdata schema versions the consumer understands (default: SECMAN_TFDATA_VERSION, then the newest)")
+	global.StringVar(outputFormat, "o", "", "Shorthand for --output-format")
+	tmpl := global.String("template", "", "Go template for the output (implies -o template), or @file")
+	color := global.String("color", "auto", "Colorize table output: auto, always or never")
+	global.BoolVar(&quiet, "quiet", false, "Print only essential output (IDs, counts, paths) and errors")
+	global.BoolVar(&quiet, "q", false, "Shorthand for --quiet")
+	if err := global.Parse(os.Args[1:]); err != nil {
+		if err == flag.ErrHelp {
+			help()
+		}
+		fmt.Fprintf(os.Stderr, "Run '%s help' for usage.\n", progName())
+		exit(ExitUsage)
+	}
+	if err := setColorMode(*color); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(ExitUsage)
+	}
+	args := global.Args()
+	if len(args) < 1 {
 		usage()
 	}
 
-	baseURL := envOrDefault("SECMAN_BASE_URL", "http://localhost:8080")
-	apiKey := os.Getenv("SECMAN_MCP_KEY")
-	userEmail := os.Getenv("SECMAN_USER_EMAIL")
+	cfg, err := config.Load(config.Options{EnvFile: *envFile, Profile: *profile, Defaults: settingDefaults,
+		ResolveKeyring: resolveKeyringRef})
+	if err != nil {
+		fatal(err)
+	}
+	for key, err := range cfg.Unresolved {
+		if args[0] != "config" && args[0] != "credential" {
+			warnf("Warning: %s: %v\n", key, err)
+		}
+	}
+	settings = cfg
+	global.Visit(func(f *flag.Flag) {
+		if key, ok := settingFlags[f.Name]; ok {
+			settings.SetFlag(key, f.Value.String())
+		}
+	})
+	// --read-only=false does not lift read-only mode set elsewhere.
+	if *readOnly {
+		settings.SetFlag("SECMAN_READ_ONLY", "true")
+	}
+	r, err := newRenderer(*outputFormat, *tmpl)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(ExitUsage)
+	}
+	renderer, outputChosen = r, *outputFormat != "" || *tmpl != ""
+	switch args[0] {
+	case "help", "-h", "--help":
+		help()
+	case "completion":
+		cmdCompletion(args[1:])
+		return
+	case "__complete":
+		cmdComplete(global, args[1:])
+		return
+	case "man":
+		cmdMan(args[1:])
+		return
+	case "config":
+		cmdConfig(args[1:])
+		return
+	case "credential":
+		cmdCredential(args[1:])
+		return
+	case "audit-log":
+		cmdAuditLog(args[1:])
+		return
+	case "state":
+		cmdState(*dryRun, args[1:])
+		return
+	case "transcript":
+		cmdTranscript(args[1:])
+		return
+	case "version":
+		cmdVersion(args[1:])
+		return
+	case "self-update":
+		cmdSelfUpdate(args[1:])
+		return
+	case "verify":
+		cmdVerify(args[1:])
+		return
+	case "plugin":
+		cmdPlugin(args[1:])
+		return
+	case "mapping":
+		cmdMapping(args[1:])
+		return
+	case "snapshot":
+		if len(args) > 1 && args[1] == "list" {
+			cmdSnapshotList(args[2:])
+			return
+		}
+	}
 
-	if apiKey == "" {
-		fmt.Fprintln(os.Stderr, "Error: SECMAN_MCP_KEY environment variable is required")
-		os.Exit(1)
+	var snapshot *snapshotStore
+	if *asOf != "" {
+		t, err := parseAsOf(*asOf)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(ExitUsage)
+		}
+		if snapshot, err = openSnapshotAsOf(t); err != nil {
+			fatal(err)
+		}
 	}
 
-	client := NewMcpClient(baseURL, apiKey, userEmail)
-	command := os.Args[1]
+	apiKey := setting("SECMAN_MCP_KEY")
+	if apiKey == "" && snapshot == nil {
+		fmt.Fprintln(os.Stderr, "Error: SECMAN_MCP_KEY is required (environment, .env file or profile; keyring:<name> reads the credential store)")
+		exit(ExitUsage)
+	}
+	if err := settings.CheckKeyDestination(); err != nil && snapshot == nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(ExitUsage)
+	}
+
+	registerSecret(setting("SECMAN_ANONYMIZE_KEY"))
+	opts := []ClientOption{WithHeaders(headers.header)}
+	strictOpt, err := strictTLSOption(setting("SECMAN_BASE_URL"), setting("SECMAN_TLS_PIN"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(ExitUsage)
+	}
+	if strictOpt != nil {
+		opts = append(opts, strictOpt)
+	}
+	if *debug {
+		opts = append(opts, WithDebug(os.Stderr))
+	}
+	client := NewMcpClient(setting("SECMAN_BASE_URL"), apiKey, setting("SECMAN_USER_EMAIL"), opts...)
+	client.Tenant = setting("SECMAN_TENANT")
+	client.dryRun = *dryRun
+	if client.readOnly, err = loadMutationSettings(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(ExitUsage)
+	}
+	client.auditLog = auditLogPath()
+	if client.budget, err = loadToolBudget(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(ExitUsage)
+	}
+	if path := setting("SECMAN_TRANSCRIPT"); path != "" {
+		if client.transcript, err = openTranscript(client, path); err != nil {
+			fatal(fmt.Errorf("transcript: %w", err))
+		}
+	}
+	client.snapshot = snapshot
+	if path := severityMapPath(); path != "" {
+		if client.severityMap, err = loadSeverityMap(path); err != nil {
+			fatal(err)
+		}
+	}
+	if snapshot != nil && !quiet {
+		fmt.Fprintf(os.Stderr, "As of %s: snapshot of %s\n", snapshot.manifest.CreatedAt.Format(time.RFC3339), snapshot.manifest.Source)
+	}
+
+	// The active tenant goes to stderr so JSON output stays parseable.
+	if client.Tenant != "" && !quiet {
+		fmt.Fprintf(os.Stderr, "Tenant: %s @ %s\n", client.Tenant, client.BaseURL)
+	}
+
+	dispatch(client, args)
+	reportDryRun(client)
+}
+
+// commandNames lists the commands handled by dispatch, for shell completion.
+var commandNames = []string{
+	"capabilities",
+	"describe",
+	"verify-contract",
+	"call",
+	"assets",
+	"vulnerabilities",
+	"requirements",
+	"users",
+	"scans",
+	"coverage",
+	"workgroups",
+	"vuln",
+	"summarize",
+	"finding",
+	"evidence",
+	"assessment",
+	"report",
+	"campaign",
+	"control-test",
+	"mapping",
+	"ticket",
+	"cmdb",
+	"sync",
+	"bridge",
+	"enrich",
+	"watch",
+	"gate",
+	"snapshot",
+	"pr-comment",
+	"events",
+	"serve-grafana",
+	"serve-stdio",
+	"notifications",
+	"stats",
+	"top",
+	"query",
+	"ask",
+	"scan",
+	"export",
+	"import",
+	"apply",
+	"discover",
+	"requirement",
+	"translation",
+	"admin",
+	"backup",
+	"bundle",
+	"asset",
+	"shell",
+	"config",
+	"audit-log",
+	"state",
+	"transcript",
+	"verify",
+	"plugin",
+	"version",
+	"self-update",
+	"completion",
+	"man",
+	"credential",
+}
+
+// dispatch runs one command; args[0] is the command name.
+func dispatch(client *McpClient, args []string) {
+	command := args[0]
+	currentCommand = command
 
 	switch command {
 	case "capabilities":
-		cmdCapabilities(client)
+		cmdCapabilities(client, args[1:])
+	case "describe":
+		cmdDescribe(client, args[1:])
+	case "verify-contract":
+		cmdVerifyContract(client, args[1:])
 	case "call":
-		cmdCall(client, os.Args[2:])
+		cmdCall(client, args[1:])
 	case "assets":
-		cmdAssets(client, os.Args[2:])
+		cmdAssets(client, args[1:])
 	case "vulnerabilities":
-		cmdVulnerabilities(client, os.Args[2:])
+		cmdVulnerabilities(client, args[1:])
 	case "requirements":
-		cmdRequirements(client, os.Args[2:])
+		cmdRequirements(client, args[1:])
 	case "users":
-		cmdUsers(client)
+		cmdUsers(client, args[1:])
 	case "scans":
-		cmdScans(client, os.Args[2:])
+		cmdScans(client, args[1:])
+	case "workgroups":
+		cmdWorkgroups(client, args[1:])
+	case "summarize":
+		cmdSummarize(client, args[1:])
+	case "vuln":
+		cmdVuln(client, args[1:])
+	case "finding":
+		cmdFinding(client, args[1:])
+	case "evidence":
+		cmdEvidence(client, args[1:])
+	case "assessment":
+		cmdAssessment(client, args[1:])
+	case "report":
+		cmdReport(client, args[1:])
+	case "campaign":
+		cmdCampaign(client, args[1:])
+	case "coverage":
+		cmdCoverage(client, args[1:])
+	case "control-test":
+		cmdControlTest(client, args[1:])
+	case "mapping":
+		cmdMapping(args[1:])
+	case "ticket":
+		cmdTicket(client, args[1:])
+	case "sync":
+		cmdSync(client, args[1:])
+	case "cmdb":
+		cmdCmdb(client, args[1:])
+	case "enrich":
+		cmdEnrich(client, args[1:])
+	case "bridge":
+		cmdBridge(client, args[1:])
+	case "watch":
+		cmdWatch(client, args[1:])
+	case "gate":
+		cmdGate(client, args[1:])
+	case "snapshot":
+		cmdSnapshot(client, args[1:])
+	case "pr-comment":
+		cmdPRComment(client, args[1:])
+	case "events":
+		cmdEvents(client, args[1:])
+	case "serve-stdio":
+		cmdServeStdio(client, args[1:])
+	case "serve-grafana":
+		cmdServeGrafana(client, args[1:])
+	case "notifications":
+		cmdNotifications(client, args[1:])
+	case "stats":
+		cmdStats(client, args[1:])
+	case "top":
+		cmdTop(client, args[1:])
+	case "query":
+		cmdQuery(client, args[1:])
+	case "ask":
+		cmdAsk(client, args[1:])
+	case "scan":
+		cmdScan(client, args[1:])
+	case "export":
+		cmdExport(client, args[1:])
+	case "import":
+		cmdImport(client, args[1:])
+	case "apply":
+		cmdApply(client, args[1:])
+	case "discover":
+		cmdDiscover(client, args[1:])
+	case "requirement":
+		cmdRequirement(client, args[1:])
+	case "translation":
+		cmdTranslation(client, args[1:])
+	case "admin":
+		cmdAdmin(client, args[1:])
+	case "backup":
+		cmdBackup(client, args[1:])
+	case "bundle":
+		cmdBundle(client, args[1:])
+	case "asset":
+		cmdAsset(client, args[1:])
+	case "shell":
+		cmdShell(client, args[1:])
+	case "config":
+		cmdConfig(args[1:])
+	case "audit-log":
+		cmdAuditLog(args[1:])
+	case "state":
+		cmdState(client.dryRun, args[1:])
+	case "verify":
+		cmdVerify(args[1:])
 	case "help", "-h", "--help":
-		usage()
+		help()
+	case "plugin":
+		cmdPlugin(args[1:])
 	default:
+		if path, n := findPlugin(args); path != "" {
+			runPlugin(client, path, args[n:])
+			return
+		}
 		fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n", command)
 		usage()
 	}
 }
 
-func cmdCapabilities(client *McpClient) {
-	caps, err := client.GetCapabilities()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
-	}
-
-	fmt.Printf("Server: %v\n\n", caps.ServerInfo["name"])
-	fmt.Printf("Available tools (%d):\n", len(caps.Capabilities.Tools))
-	for _, tool := range caps.Capabilities.Tools {
-		fmt.Printf("  %-35s %s\n", tool.Name, tool.Description)
-	}
-}
-
 func cmdCall(client *McpClient, osArgs []string) {
 	if len(osArgs) < 1 {
 		fmt.Fprintln(os.Stderr, "Error: tool name required")
-		fmt.Fprintln(os.Stderr, "Usage: go run main.go call <tool-name> [--args '{...}']")
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "Usage: %s call <tool-name> [--args '{...}'] [--stdin] [--no-prompt]\n", progName())
+		exit(ExitUsage)
 	}
 
 	toolName := osArgs[0]
 
-	fs := flag.NewFlagSet("call", flag.ExitOnError)
+	fs := flag.NewFlagSet("call", flag.ContinueOnError)
 	argsJSON := fs.String("args", "{}", "Tool arguments as JSON")
-	fs.Parse(osArgs[1:])
+	stdin := fs.Bool("stdin", false, "Call the tool once per JSON object on stdin, merged over --args")
+	noPrompt := fs.Bool("no-prompt", false, "Do not ask for the arguments on a terminal when --args is not given")
+	parseFlags(fs, osArgs[1:])
 
 	var args map[string]interface{}
 	if err := json.Unmarshal([]byte(*argsJSON), &args); err != nil {
 		fmt.Fprintf(os.Stderr, "Error parsing --args JSON: %v\n", err)
-		os.Exit(1)
+		exit(ExitUsage)
+	}
+	argsSet := false
+	fs.Visit(func(f *flag.Flag) { argsSet = argsSet || f.Name == "args" })
+	if !argsSet && !*stdin && !*noPrompt && isInteractive() {
+		def, ok, err := client.Tool(toolName)
+		if err != nil {
+			fatal(err)
+		}
+		if props, _ := def.InputSchema["properties"].(map[string]interface{}); ok && len(props) > 0 {
+			if args, err = promptArgs(def); err != nil {
+				fatal(err)
+			}
+			raw, _ := json.Marshal(args)
+			fmt.Fprintf(os.Stderr, "\nSame call: %s call %s --args '%s'\n\n", progName(), toolName, raw)
+		}
 	}
 
-	result, err := client.CallTool(toolName, args)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+	if !*stdin {
+		result, err := client.CallTool(toolName, args)
+		if err != nil {
+			fatal(err)
+		}
+		printResult(result)
+		return
 	}
 
-	printJSON(result)
+	items, err := readStdinItems(os.Stdin)
+	if err != nil {
+		fatal(err)
+	}
+	failed := 0
+	progress := startProgress("Calling "+toolName, "records", int64(len(items)))
+	defer progress.Finish()
+	for i, item := range items {
+		progress.Add(1)
+		callArgs := make(map[string]interface{}, len(args)+len(item))
+		for k, v := range args {
+			callArgs[k] = v
+		}
+		for k, v := range item {
+			callArgs[k] = v
+		}
+		result, err := client.CallTool(toolName, callArgs)
+		if err != nil {
+			progress.Warnf("  record %d: %v\n", i+1, err)
+			failed++
+			continue
+		}
+		printResult(result)
+	}
+	progress.Finish()
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d of %d call(s) failed\n", failed, len(items))
+		exit(ExitPartial)
+	}
 }
 
 func cmdAssets(client *McpClient, osArgs []string) {
-	fs := flag.NewFlagSet("assets", flag.ExitOnError)
+	fs := flag.NewFlagSet("assets", flag.ContinueOnError)
 	name := fs.String("name", "", "Filter by name (partial match)")
 	assetType := fs.String("type", "", "Filter by type (SERVER, WORKSTATION, etc.)")
 	ip := fs.String("ip", "", "Filter by IP (partial match)")
 	owner := fs.String("owner", "", "Filter by owner")
 	page := fs.Int("page", 0, "Page number (0-indexed)")
 	pageSize := fs.Int("pageSize", 100, "Items per page (max 500)")
-	fs.Parse(osArgs)
-
-	args := map[string]interface{}{
-		"page":     *page,
-		"pageSize": *pageSize,
+	all := fs.Bool("all", false, "Fetch every page instead of one")
+	business := addAssetContextFlags(fs, "criticality")
+	instances := addInstanceFlags(fs)
+	parseFlags(fs, osArgs)
+	if (*all || business.active()) && instances.active() {
+		fmt.Fprintln(os.Stderr, "Error: --all and the business context filters cannot be combined with --all-instances or --instances")
+		exit(ExitUsage)
+	}
+	// tfdata describes the whole inventory.
+	if _, ok := renderer.(tfdataRenderer); ok && !instances.active() {
+		*all = true
 	}
+
+	args := map[string]interface{}{}
 	if *name != "" {
 		args["name"] = *name
 	}
@@ -381,28 +1425,62 @@ func cmdAssets(client *McpClient, osArgs []string) {
 		args["owner"] = *owner
 	}
 
-	result, err := client.CallTool("get_assets", args)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+	// get_assets has no business context filters; they apply to every page.
+	if business.active() {
+		assets, err := listAll(client, "get_assets", "assets", args, 500)
+		if err != nil {
+			fatal(err)
+		}
+		assets = business.filter(assets)
+		printResult(map[string]interface{}{"assets": assets, "totalElements": len(assets)})
+		return
 	}
-
-	printJSON(result)
+	if *all {
+		runListAll(client, "get_assets", "assets", args)
+		return
+	}
+	args["page"], args["pageSize"] = *page, *pageSize
+	runRead(client, instances, "get_assets", args)
 }
 
 func cmdVulnerabilities(client *McpClient, osArgs []string) {
-	fs := flag.NewFlagSet("vulnerabilities", flag.ExitOnError)
+	fs := flag.NewFlagSet("vulnerabilities", flag.ContinueOnError)
 	severity := fs.String("severity", "", "Filter by severity (CRITICAL, HIGH, MEDIUM, LOW)")
 	assetID := fs.String("assetId", "", "Filter by asset ID")
 	minDaysOpen := fs.Int("minDaysOpen", -1, "Minimum days open")
+	createdFlags := addTimeRangeFlags(fs, "created", "findings created", true)
+	scannedFlags := addTimeRangeFlags(fs, "scanned", "findings last scanned", false)
+	resolvedFlags := addTimeRangeFlags(fs, "resolved", "findings resolved, derived from the snapshot store,", false)
 	page := fs.Int("page", 0, "Page number (0-indexed)")
 	pageSize := fs.Int("pageSize", 100, "Items per page (max 500)")
-	fs.Parse(osArgs)
-
-	args := map[string]interface{}{
-		"page":     *page,
-		"pageSize": *pageSize,
+	all := fs.Bool("all", false, "Fetch every page instead of one")
+	risk := fs.Bool("risk", false, "Add a riskScore to each finding and sort by it")
+	riskOpts := addRiskFlags(fs)
+	business := addAssetContextFlags(fs, "asset-criticality")
+	sortKey := fs.String("sort", "", "Sort by "+strings.Join(vulnSortKeys, ", ")+"; adds the assets' business context")
+	ageBuckets := fs.Bool("age-bucket", false, "Count the matching findings per age bucket (0-7d, 8-30d, 31-90d, >90d) and severity instead of listing them")
+	instances := addInstanceFlags(fs)
+	parseFlags(fs, osArgs)
+	created, scanned, resolved := createdFlags.resolve(), scannedFlags.resolve(), resolvedFlags.resolve()
+	local := created.set() || resolved.set() || business.active() || *sortKey != "" || *ageBuckets
+	if (*all || *risk || local) && instances.active() {
+		fmt.Fprintln(os.Stderr, "Error: --all, --risk, --sort, --age-bucket and the time and business context filters cannot be combined with --all-instances or --instances")
+		exit(ExitUsage)
 	}
+	if *ageBuckets && (*risk || *sortKey != "") {
+		fmt.Fprintln(os.Stderr, "Error: --age-bucket counts findings; it cannot be combined with --risk or --sort")
+		exit(ExitUsage)
+	}
+	if *sortKey != "" && !containsFold(vulnSortKeys, *sortKey) {
+		fmt.Fprintf(os.Stderr, "Error: --sort must be one of %s\n", strings.Join(vulnSortKeys, ", "))
+		exit(ExitUsage)
+	}
+	if *sortKey != "" && *risk {
+		fmt.Fprintln(os.Stderr, "Error: --risk sorts by risk score; it cannot be combined with --sort")
+		exit(ExitUsage)
+	}
+
+	args := map[string]interface{}{}
 	if *severity != "" {
 		args["severity"] = *severity
 	}
@@ -410,29 +1488,116 @@ func cmdVulnerabilities(client *McpClient, osArgs []string) {
 		id, err := strconv.Atoi(*assetID)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error: invalid assetId: %v\n", err)
-			os.Exit(1)
+			exit(ExitUsage)
 		}
 		args["assetId"] = id
 	}
 	if *minDaysOpen >= 0 {
 		args["minDaysOpen"] = *minDaysOpen
 	}
+	// The server filters by scan time itself.
+	if !scanned.After.IsZero() {
+		args["startDate"] = scanned.After.Format(time.RFC3339)
+	}
+	if !scanned.Before.IsZero() {
+		args["endDate"] = scanned.Before.Format(time.RFC3339)
+	}
 
-	result, err := client.CallTool("get_vulnerabilities", args)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+	// The server has no filter by creation time or business context and
+	// keeps no resolved findings, so these fetch everything and filter here.
+	if local {
+		var findings []map[string]interface{}
+		var err error
+		if resolved.set() {
+			findings, err = resolvedFromSnapshots(resolved)
+			kept := findings[:0]
+			for _, f := range findings {
+				if snapshotMatches("get_vulnerabilities", f, args) {
+					kept = append(kept, f)
+				}
+			}
+			findings = kept
+		} else {
+			findings, err = listAll(client, "get_vulnerabilities", "vulnerabilities", args, 500)
+		}
+		if err != nil {
+			fatal(err)
+		}
+		findings = created.filter(findings, "createdAt", "scanTimestamp")
+		if business.active() || *sortKey != "" {
+			assets, err := assetsByID(client)
+			if err != nil {
+				fatal(err)
+			}
+			if business.active() {
+				kept := findings[:0]
+				for _, f := range findings {
+					if business.matches(assets[findingAssetID(f)]) {
+						kept = append(kept, f)
+					}
+				}
+				findings = kept
+			}
+			annotateFindings(findings, assets)
+			if *sortKey != "" {
+				sortFindings(findings, strings.ToLower(*sortKey))
+			}
+		}
+		if findings == nil {
+			findings = []map[string]interface{}{}
+		}
+		if *ageBuckets {
+			printResult(map[string]interface{}{"ageBuckets": countAgeBuckets(findings, time.Now()), "totalElements": len(findings)})
+			return
+		}
+		addAgeFields(findings, time.Now())
+		content := map[string]interface{}{"vulnerabilities": findings, "totalElements": len(findings)}
+		if *risk {
+			printRiskList(client, content, riskOpts)
+			return
+		}
+		printResult(content)
+		return
 	}
 
-	printJSON(result)
+	if *risk {
+		runRiskList(client, args, *all, *page, *pageSize, riskOpts)
+		return
+	}
+	if *all {
+		findings, err := listAll(client, "get_vulnerabilities", "vulnerabilities", args, 500)
+		if err != nil {
+			fatal(err)
+		}
+		if findings == nil {
+			findings = []map[string]interface{}{}
+		}
+		addAgeFields(findings, time.Now())
+		printResult(map[string]interface{}{"vulnerabilities": findings, "totalElements": len(findings)})
+		return
+	}
+	args["page"], args["pageSize"] = *page, *pageSize
+	if !instances.active() {
+		result, err := client.CallTool("get_vulnerabilities", args)
+		if err != nil {
+			fatal(err)
+		}
+		if content, ok := result.Content.(map[string]interface{}); ok && !result.IsError {
+			addAgeFields(mapsField(content, "vulnerabilities"), time.Now())
+		}
+		printResult(result)
+		return
+	}
+	runRead(client, instances, "get_vulnerabilities", args)
 }
 
 func cmdRequirements(client *McpClient, osArgs []string) {
-	fs := flag.NewFlagSet("requirements", flag.ExitOnError)
+	fs := flag.NewFlagSet("requirements", flag.ContinueOnError)
 	status := fs.String("status", "", "Filter by status (DRAFT, ACTIVE, DEPRECATED, ARCHIVED)")
 	priority := fs.String("priority", "", "Filter by priority (LOW, MEDIUM, HIGH, CRITICAL)")
 	limit := fs.Int("limit", 0, "Maximum number to return (0 = all)")
-	fs.Parse(osArgs)
+	instances := addInstanceFlags(fs)
+	parseFlags(fs, osArgs)
 
 	args := map[string]interface{}{}
 	if *status != "" {
@@ -445,32 +1610,27 @@ func cmdRequirements(client *McpClient, osArgs []string) {
 		args["limit"] = *limit
 	}
 
-	result, err := client.CallTool("get_requirements", args)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
-	}
-
-	printJSON(result)
+	runRead(client, instances, "get_requirements", args)
 }
 
-func cmdUsers(client *McpClient) {
-	result, err := client.CallTool("list_users", map[string]interface{}{})
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
-	}
+func cmdUsers(client *McpClient, osArgs []string) {
+	fs := flag.NewFlagSet("users", flag.ContinueOnError)
+	instances := addInstanceFlags(fs)
+	parseFlags(fs, osArgs)
 
-	printJSON(result)
+	runRead(client, instances, "list_users", map[string]interface{}{})
 }
 
 func cmdScans(client *McpClient, osArgs []string) {
-	fs := flag.NewFlagSet("scans", flag.ExitOnError)
+	fs := flag.NewFlagSet("scans", flag.ContinueOnError)
 	scanType := fs.String("type", "", "Filter by scan type (nmap, masscan)")
 	uploadedBy := fs.String("uploadedBy", "", "Filter by uploader")
+	createdFlags := addTimeRangeFlags(fs, "created", "scans run", true)
 	page := fs.Int("page", 0, "Page number (0-indexed)")
 	pageSize := fs.Int("pageSize", 100, "Items per page (max 500)")
-	fs.Parse(osArgs)
+	instances := addInstanceFlags(fs)
+	parseFlags(fs, osArgs)
+	created := createdFlags.resolve()
 
 	args := map[string]interface{}{
 		"page":     *page,
@@ -482,12 +1642,28 @@ func cmdScans(client *McpClient, osArgs []string) {
 	if *uploadedBy != "" {
 		args["uploadedBy"] = *uploadedBy
 	}
+	if !created.After.IsZero() {
+		args["startDate"] = created.After.Format(time.RFC3339)
+	}
+	if !created.Before.IsZero() {
+		args["endDate"] = created.Before.Format(time.RFC3339)
+	}
+
+	runRead(client, instances, "get_scans", args)
+}
 
-	result, err := client.CallTool("get_scans", args)
+func cmdWorkgroups(client *McpClient, osArgs []string) {
+	fs := flag.NewFlagSet("workgroups", flag.ContinueOnError)
+	parseFlags(fs, osArgs)
+
+	state, err := readApplyState(client, map[string]bool{"workgroups": true}, false)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		fatal(err)
 	}
-
-	printJSON(result)
+	workgroups := make([]map[string]interface{}, 0, len(state.records["workgroups"]))
+	for _, wg := range state.records["workgroups"] {
+		workgroups = append(workgroups, wg)
+	}
+	sort.Slice(workgroups, func(i, j int) bool { return numberField(workgroups[i], "id") < numberField(workgroups[j], "id") })
+	printResult(map[string]interface{}{"workgroups": workgroups, "totalElements": len(workgroups)})
 }
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// man writes the manual page, made from the help text, for packages that
+// install it (Homebrew's man1, a .deb's /usr/share/man/man1).
+
+// manSections maps the help text's sections to those of the manual page,
+// in order.
+var manSections = []struct{ usage, man string }{
+	{"Global Flags", "OPTIONS"},
+	{"Commands", "COMMANDS"},
+	{"Environment Variables", "ENVIRONMENT"},
+}
+
+// manExitCodes describe the exit codes of exit.go.
+var manExitCodes = []struct {
+	code int
+	text string
+}{
+	{ExitOK, "Success."},
+	{ExitUsage, "Usage error, or any failure not covered below."},
+	{ExitAuth, "Missing or invalid API key, failed delegation, permission denied, or a call refused in read-only mode."},
+	{ExitNotFound, "The record or tool does not exist."},
+	{ExitRateLimited, "The server's rate limit was hit."},
+	{ExitGateFailed, "A check or gate command ran and its condition failed."},
+	{ExitPartial, "Some items succeeded, some failed."},
+}
+
+func cmdMan(osArgs []string) {
+	fs := flag.NewFlagSet("man", flag.ContinueOnError)
+	outDir := fs.String("output", "", "Write <name>.1 into this directory instead of printing the page")
+	parseFlags(fs, osArgs)
+
+	name := binaryName()
+	date := time.Now()
+	if t, err := time.Parse(time.RFC3339, buildDate); err == nil {
+		date = t
+	}
+	page := manPage(name, date)
+	if *outDir == "" {
+		fmt.Print(page)
+		return
+	}
+	path := filepath.Join(*outDir, name+".1")
+	if err := os.MkdirAll(*outDir, 0o755); err != nil {
+		fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(page), 0o644); err != nil {
+		fatal(err)
+	}
+	status(path, "Wrote %s\n", path)
+}
+
+// manPage renders the manual page of name in roff.
+func manPage(name string, date time.Time) string {
+	text := strings.ReplaceAll(usageTemplate, "go run . ", name+" ")
+	sections := usageSections(text)
+	var b strings.Builder
+	fmt.Fprintf(&b, ".TH %s 1 %q %q \"User Commands\"\n", strings.ToUpper(name), date.Format("2006-01-02"), name+" "+version)
+	fmt.Fprintf(&b, ".SH NAME\n%s \\- command-line client of the Secman MCP server\n", roffEscape(name))
+	fmt.Fprintf(&b, ".SH SYNOPSIS\n.B %s\n[\\fIglobal flags\\fR] \\fIcommand\\fR [\\fIflags\\fR]\n", roffEscape(name))
+	b.WriteString(".SH DESCRIPTION\n")
+	fmt.Fprintf(&b, "%s calls the tools of a Secman server over its MCP endpoint: it lists and changes assets, "+
+		"vulnerabilities and requirements, imports scanner output, produces reports and gates pipelines. "+
+		"Settings come from flags, the environment, a project .env or secman.env file and the profiles of the config file.\n",
+		roffEscape(name))
+	for _, s := range manSections {
+		fmt.Fprintf(&b, ".SH %s\n", s.man)
+		for _, e := range sections[s.usage] {
+			fmt.Fprintf(&b, ".TP\n.B %s\n", roffEscape(e.term))
+			if e.text != "" {
+				fmt.Fprintf(&b, "%s\n", roffEscape(e.text))
+			}
+		}
+	}
+	b.WriteString(".SH EXIT STATUS\n")
+	for _, c := range manExitCodes {
+		fmt.Fprintf(&b, ".TP\n.B %d\n%s\n", c.code, c.text)
+	}
+	b.WriteString(".SH FILES\n")
+	fmt.Fprintf(&b, ".TP\n.I $XDG_CONFIG_HOME/secman/config\n%s\n",
+		roffEscape("The config file and its profiles (default: ~/.config/secman/config on Linux; SECMAN_CONFIG picks another file). State the commands keep, such as campaigns and snapshots, lives next to it."))
+	fmt.Fprintf(&b, ".TP\n.I $XDG_STATE_HOME/secman\n%s\n",
+		roffEscape("The audit log (audit.jsonl) and shell history (default: ~/.local/state/secman on Linux)."))
+	b.WriteString(".SH EXAMPLES\n")
+	var inExamples bool
+	for _, line := range strings.Split(text, "\n") {
+		switch {
+		case line == "Examples:":
+			inExamples = true
+		case !inExamples || strings.TrimSpace(line) == "":
+		case strings.HasPrefix(strings.TrimSpace(line), "#"):
+			fmt.Fprintf(&b, ".PP\n%s\n", roffEscape(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "#"))))
+		default:
+			fmt.Fprintf(&b, ".PP\n.RS 4\n.nf\n%s\n.fi\n.RE\n", roffEscape(strings.TrimSpace(line)))
+		}
+	}
+	fmt.Fprintf(&b, ".SH SEE ALSO\n%s completion, %s help\n", roffEscape(name), roffEscape(name))
+	return b.String()
+}
+
+// roffEscape keeps text from being read as roff requests and escapes.
+func roffEscape(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\e`)
+	s = strings.ReplaceAll(s, "-", `\-`)
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = `\&` + s
+	}
+	return s
+}
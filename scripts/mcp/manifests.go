@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// export manifests writes the server's workgroups, assets, requirements and
+// exceptions in the format apply reads, so a team can start the
+// declarative workflow from what it has. Records are sorted and carry no
+// ids or timestamps, so exporting twice gives the same files and git
+// shows only real changes.
+
+func cmdExportManifests(client *McpClient, osArgs []string) {
+	fs := flag.NewFlagSet("export manifests", flag.ContinueOnError)
+	sectionsFlag := fs.String("sections", "workgroups,assets,requirements,exceptions", "Comma-separated sections to export")
+	outputDir := fs.String("output-dir", "", "Write one <section>.yaml per section here (default: one document on stdout)")
+	parseFlags(fs, osArgs)
+
+	sections := map[string]bool{}
+	var order []string
+	for _, name := range splitList(*sectionsFlag) {
+		found := false
+		for _, k := range applyKinds {
+			found = found || k.section == name
+		}
+		if !found {
+			fmt.Fprintf(os.Stderr, "Error: unknown section %q (use workgroups, assets, requirements or exceptions)\n", name)
+			exit(ExitUsage)
+		}
+		sections[name] = true
+	}
+	for _, k := range applyKinds {
+		if sections[k.section] {
+			order = append(order, k.section)
+		}
+	}
+	if len(order) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: --sections is empty")
+		exit(ExitUsage)
+	}
+
+	// Manifests hold the severities and values the server has.
+	client.severityMap = nil
+	state, err := readApplyState(client, sections, sections["assets"])
+	if err != nil {
+		fatal(err)
+	}
+
+	header := fmt.Sprintf("# Exported from %s with export manifests; apply with: %s apply -f <dir>\n", client.BaseURL, progName())
+	if *outputDir == "" {
+		doc := map[string]interface{}{}
+		for _, section := range order {
+			doc[section] = manifestRecords(state, section)
+		}
+		fmt.Print(header)
+		if err := writeYAML(os.Stdout, doc); err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	if err := os.MkdirAll(*outputDir, 0o755); err != nil {
+		fatal(err)
+	}
+	for _, section := range order {
+		records := manifestRecords(state, section)
+		var buf bytes.Buffer
+		buf.WriteString(header)
+		if err := writeYAML(&buf, map[string]interface{}{section: records}); err != nil {
+			fatal(err)
+		}
+		path := filepath.Join(*outputDir, section+".yaml")
+		if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+			fatal(err)
+		}
+		status(path, "Wrote %d %s to %s\n", len(records), section, path)
+	}
+}
+
+// manifestRecords turns the server records of a section into manifest
+// records, sorted by their key.
+func manifestRecords(s *applyState, section string) []interface{} {
+	keys := make([]string, 0, len(s.records[section]))
+	for key := range s.records[section] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	out := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		out = append(out, manifestRecord(s, section, s.records[section][key]))
+	}
+	return out
+}
+
+func manifestRecord(s *applyState, section string, rec map[string]interface{}) map[string]interface{} {
+	m := map[string]interface{}{}
+	set := func(field, value string) {
+		if value = strings.TrimSpace(value); value != "" {
+			m[field] = value
+		}
+	}
+	for _, field := range applyKindOf(section).fields {
+		switch field {
+		case "tags", "workgroups":
+		default:
+			set(field, currentValue(section, field, rec))
+		}
+	}
+
+	switch section {
+	case "assets":
+		tags := map[string]interface{}{}
+		for _, t := range stringsField(rec, "tags") {
+			k, v, _ := strings.Cut(t, "=")
+			context := false
+			for _, c := range assetContextTags {
+				context = context || strings.EqualFold(c.key, k)
+			}
+			if !context {
+				tags[k] = v
+			}
+		}
+		if len(tags) > 0 {
+			m["tags"] = tags
+		}
+		wgs := append([]string(nil), s.assetWorkgroups[applyKey(section, rec)]...)
+		sort.Strings(wgs)
+		if len(wgs) > 0 {
+			list := make([]interface{}, len(wgs))
+			for i, wg := range wgs {
+				list[i] = wg
+			}
+			m["workgroups"] = list
+		}
+	case "exceptions":
+		if d, ok := m["expirationDate"].(string); ok && len(d) > 10 {
+			m["expirationDate"] = d[:10]
+		}
+	}
+	return m
+}
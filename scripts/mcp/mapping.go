@@ -0,0 +1,538 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/schmalle/secman/scripts/mcp/config"
+)
+
+// A mapping pack links the controls of a requirement catalog, such as ISO
+// 27001 Annex A, to the controls of another framework. Requirements refer
+// to their catalog controls through their norms ("ISO 27001: A.8.8"), so
+// with a pack report compliance can show a catalog's coverage in the terms
+// of NIST SP 800-53 or the CIS Controls.
+//
+// Two packs are built in. Further packs are JSON files in the directory
+// SECMAN_MAPPING_PACKS names (default: mapping-packs/ next to the config
+// file); a file there with the name of a built-in pack replaces it.
+//
+// The format, also described in the README:
+//
+//	{
+//	  "name": "iso27001-nist80053",          lower case letters, digits and -
+//	  "title": "ISO/IEC 27001:2022 Annex A to NIST SP 800-53 Rev. 5",
+//	  "version": "1",
+//	  "description": "...",
+//	  "source": {"catalog": "ISO 27001", "aliases": ["ISO/IEC 27001"]},
+//	  "target": {"framework": "NIST SP 800-53 Rev. 5",
+//	             "controls": {"RA-5": "Vulnerability Monitoring and Scanning"}},
+//	  "mappings": [{"source": "A.8.8", "title": "...", "targets": ["RA-5", "SI-2"]}]
+//	}
+
+//go:embed packs/*.json
+var builtinPacks embed.FS
+
+type mappingPack struct {
+	Name        string `json:"name"`
+	Title       string `json:"title"`
+	Version     string `json:"version,omitempty"`
+	Description string `json:"description,omitempty"`
+	Source      struct {
+		Catalog string   `json:"catalog"`
+		Aliases []string `json:"aliases,omitempty"`
+	} `json:"source"`
+	Target struct {
+		Framework string            `json:"framework"`
+		Controls  map[string]string `json:"controls"`
+	} `json:"target"`
+	Mappings []packMapping `json:"mappings"`
+
+	// Origin is "built-in" or the file the pack was read from.
+	Origin string `json:"-"`
+}
+
+type packMapping struct {
+	Source  string   `json:"source"`
+	Title   string   `json:"title,omitempty"`
+	Targets []string `json:"targets"`
+}
+
+var packNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+func mappingPackDir() string {
+	if dir := setting("SECMAN_MAPPING_PACKS"); dir != "" {
+		return dir
+	}
+	dir, err := config.Dir()
+	if err != nil {
+		return "mapping-packs"
+	}
+	return filepath.Join(dir, "mapping-packs")
+}
+
+// parseMappingPack reads and checks a pack.
+func parseMappingPack(data []byte, origin string) (*mappingPack, error) {
+	p := &mappingPack{Origin: origin}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("%s: %w", origin, err)
+	}
+	var problems []string
+	if !packNamePattern.MatchString(p.Name) {
+		problems = append(problems, fmt.Sprintf("name %q must be lower case letters, digits and -", p.Name))
+	}
+	if p.Source.Catalog == "" {
+		problems = append(problems, "source.catalog is missing")
+	}
+	if p.Target.Framework == "" {
+		problems = append(problems, "target.framework is missing")
+	}
+	if len(p.Mappings) == 0 {
+		problems = append(problems, "mappings is empty")
+	}
+	seen := map[string]bool{}
+	for i, m := range p.Mappings {
+		source := normalizeControl(m.Source)
+		switch {
+		case source == "":
+			problems = append(problems, fmt.Sprintf("mappings[%d]: source is missing", i))
+		case seen[source]:
+			problems = append(problems, fmt.Sprintf("mappings[%d]: %s is mapped twice", i, m.Source))
+		}
+		seen[source] = true
+		if len(m.Targets) == 0 {
+			problems = append(problems, fmt.Sprintf("mappings[%d]: %s has no targets", i, m.Source))
+		}
+		// Controls is optional, but when given it lists every target.
+		for _, t := range m.Targets {
+			if _, ok := p.Target.Controls[t]; len(p.Target.Controls) > 0 && !ok {
+				problems = append(problems, fmt.Sprintf("mappings[%d]: target %s is not in target.controls", i, t))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("%s: %s", origin, strings.Join(problems, "; "))
+	}
+	return p, nil
+}
+
+// loadMappingPacks returns the built-in packs and those in the pack
+// directory, by name.
+func loadMappingPacks() (map[string]*mappingPack, error) {
+	packs := map[string]*mappingPack{}
+	builtin, _ := fs.Glob(builtinPacks, "packs/*.json")
+	for _, name := range builtin {
+		data, err := builtinPacks.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		p, err := parseMappingPack(data, "built-in")
+		if err != nil {
+			return nil, err
+		}
+		packs[p.Name] = p
+	}
+	files, err := filepath.Glob(filepath.Join(mappingPackDir(), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range files {
+		data, err := readTextFile(path)
+		if err != nil {
+			return nil, err
+		}
+		p, err := parseMappingPack(data, path)
+		if err != nil {
+			return nil, err
+		}
+		packs[p.Name] = p
+	}
+	return packs, nil
+}
+
+func findMappingPack(name string) (*mappingPack, error) {
+	packs, err := loadMappingPacks()
+	if err != nil {
+		return nil, err
+	}
+	if p := packs[name]; p != nil {
+		return p, nil
+	}
+	names := make([]string, 0, len(packs))
+	for n := range packs {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return nil, fmt.Errorf("no mapping pack %q (have: %s)", name, strings.Join(names, ", "))
+}
+
+// normalizeControl makes control ids comparable: "a.8.8." and " A.8.8"
+// are both A.8.8.
+func normalizeControl(s string) string {
+	return strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), ".")
+}
+
+// normalizeCatalog makes catalog names comparable: ISO/IEC 27001 and
+// iso 27001 are the same.
+func normalizeCatalog(s string) string {
+	s = strings.ToLower(s)
+	s = strings.ReplaceAll(s, "/iec", "")
+	return strings.Join(strings.Fields(s), "")
+}
+
+// matchesCatalog reports whether a norm's catalog name is the pack's
+// source. A name with a year or edition the pack does not list, such as
+// "ISO 27001:2013", still matches the bare catalog name.
+func (p *mappingPack) matchesCatalog(catalog string) bool {
+	c := normalizeCatalog(catalog)
+	for _, name := range append([]string{p.Source.Catalog}, p.Source.Aliases...) {
+		if n := normalizeCatalog(name); c == n || strings.HasPrefix(c, n+":") {
+			return true
+		}
+	}
+	return false
+}
+
+// splitNorm splits a norm name into a catalog and a control: "ISO 27001:
+// A.8.8" and "ISO 27001:2022 A.8.8" are ISO 27001 (of 2022) and A.8.8. A
+// name without a control, such as "ISO 27001:2022", has an empty control.
+func splitNorm(norm string) (catalog, control string) {
+	if before, after, ok := strings.Cut(norm, ":"); ok {
+		fields := strings.Fields(after)
+		if len(fields) > 0 {
+			if _, err := strconv.Atoi(fields[0]); err == nil {
+				return before + ":" + fields[0], strings.Join(fields[1:], " ")
+			}
+		}
+		return before, strings.Join(fields, " ")
+	}
+	fields := strings.Fields(norm)
+	if len(fields) < 2 {
+		return norm, ""
+	}
+	return strings.Join(fields[:len(fields)-1], " "), fields[len(fields)-1]
+}
+
+// requirementControls returns the controls of the pack's source catalog a
+// requirement refers to through its norms. A norm naming only the catalog
+// takes the control from the requirement's chapter.
+func (p *mappingPack) requirementControls(req map[string]interface{}) []string {
+	norms := stringsField(req, "norms")
+	for _, n := range strings.FieldsFunc(stringField(req, "norm"), func(r rune) bool { return r == ',' || r == ';' }) {
+		norms = append(norms, strings.TrimSpace(n))
+	}
+	var controls []string
+	seen := map[string]bool{}
+	for _, norm := range norms {
+		catalog, control := splitNorm(norm)
+		switch {
+		case control != "" && p.matchesCatalog(catalog):
+		case p.matchesCatalog(norm):
+			control = stringField(req, "chapter")
+		default:
+			continue
+		}
+		if c := normalizeControl(control); c != "" && !seen[c] {
+			seen[c] = true
+			controls = append(controls, c)
+		}
+	}
+	return controls
+}
+
+// targetsOf returns the target controls a source control maps to. A
+// control below a mapped one, such as A.8.8.1 under A.8.8, takes its
+// parent's targets.
+func (p *mappingPack) targetsOf(control string) []string {
+	var targets []string
+	for _, m := range p.Mappings {
+		source := normalizeControl(m.Source)
+		if control == source || strings.HasPrefix(control, source+".") {
+			targets = append(targets, m.Targets...)
+		}
+	}
+	return targets
+}
+
+// targetControls lists the pack's target controls in framework order:
+// numeric parts compare as numbers, so AC-2 comes before AC-10 and 3.2
+// before 3.10.
+func (p *mappingPack) targetControls() []string {
+	seen := map[string]bool{}
+	var controls []string
+	for id := range p.Target.Controls {
+		seen[id] = true
+		controls = append(controls, id)
+	}
+	for _, m := range p.Mappings {
+		for _, t := range m.Targets {
+			if !seen[t] {
+				seen[t] = true
+				controls = append(controls, t)
+			}
+		}
+	}
+	sort.Slice(controls, func(i, j int) bool { return controlLess(controls[i], controls[j]) })
+	return controls
+}
+
+func controlLess(a, b string) bool {
+	split := func(s string) []string {
+		return strings.FieldsFunc(s, func(r rune) bool { return r == '.' || r == '-' || r == '(' || r == ')' || r == ' ' })
+	}
+	x, y := split(a), split(b)
+	for i := 0; i < len(x) && i < len(y); i++ {
+		if x[i] == y[i] {
+			continue
+		}
+		m, errM := strconv.Atoi(x[i])
+		n, errN := strconv.Atoi(y[i])
+		if errM == nil && errN == nil {
+			return m < n
+		}
+		return x[i] < y[i]
+	}
+	return len(x) < len(y)
+}
+
+func cmdMapping(osArgs []string) {
+	if len(osArgs) < 1 {
+		fmt.Fprintln(os.Stderr, "Error: mapping subcommand required")
+		fmt.Fprintf(os.Stderr, "Usage: %s mapping <packs|show|validate> ...\n", progName())
+		exit(ExitUsage)
+	}
+	switch osArgs[0] {
+	case "packs":
+		cmdMappingPacks(osArgs[1:])
+	case "show":
+		cmdMappingShow(osArgs[1:])
+	case "validate":
+		cmdMappingValidate(osArgs[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown mapping subcommand: %s\n", osArgs[0])
+		exit(ExitUsage)
+	}
+}
+
+// mappingPackInfo is a pack as mapping packs lists it.
+type mappingPackInfo struct {
+	Name      string `json:"name"`
+	Title     string `json:"title"`
+	Version   string `json:"version,omitempty"`
+	Catalog   string `json:"catalog"`
+	Framework string `json:"framework"`
+	Mappings  int    `json:"mappings"`
+	Origin    string `json:"origin"`
+}
+
+func cmdMappingPacks(osArgs []string) {
+	fs := flag.NewFlagSet("mapping packs", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "Print the packs as JSON")
+	parseFlags(fs, osArgs)
+
+	packs, err := loadMappingPacks()
+	if err != nil {
+		fatal(err)
+	}
+	infos := []mappingPackInfo{}
+	for _, p := range packs {
+		infos = append(infos, mappingPackInfo{Name: p.Name, Title: p.Title, Version: p.Version, Catalog: p.Source.Catalog,
+			Framework: p.Target.Framework, Mappings: len(p.Mappings), Origin: p.Origin})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	if rawOutput(*asJSON) {
+		printResult(infos)
+		return
+	}
+	fmt.Printf("%-24s %-14s %-26s %8s  %s\n", "NAME", "CATALOG", "FRAMEWORK", "MAPPINGS", "ORIGIN")
+	for _, p := range infos {
+		fmt.Printf("%-24s %-14s %-26s %8d  %s\n", p.Name, truncate(p.Catalog, 14), truncate(p.Framework, 26), p.Mappings, p.Origin)
+	}
+}
+
+func cmdMappingShow(osArgs []string) {
+	fs := flag.NewFlagSet("mapping show", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "Print the pack as JSON")
+	args := parseInterspersed(fs, osArgs)
+
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Error: one pack name required")
+		fmt.Fprintf(os.Stderr, "Usage: %s mapping show <pack> [--json]\n", progName())
+		exit(ExitUsage)
+	}
+	p, err := findMappingPack(args[0])
+	if err != nil {
+		fatal(err)
+	}
+	if rawOutput(*asJSON) {
+		printResult(p)
+		return
+	}
+	fmt.Printf("%s (%s)\n", p.Title, p.Origin)
+	if p.Description != "" {
+		fmt.Printf("%s\n", p.Description)
+	}
+	fmt.Printf("\n%-10s %-48s %s\n", strings.ToUpper(truncate(p.Source.Catalog, 10)), "TITLE", strings.ToUpper(p.Target.Framework))
+	for _, m := range p.Mappings {
+		fmt.Printf("%-10s %-48s %s\n", m.Source, truncate(m.Title, 48), strings.Join(m.Targets, ", "))
+	}
+}
+
+func cmdMappingValidate(osArgs []string) {
+	fs := flag.NewFlagSet("mapping validate", flag.ContinueOnError)
+	files := parseInterspersed(fs, osArgs)
+
+	if len(files) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: pack file required")
+		fmt.Fprintf(os.Stderr, "Usage: %s mapping validate <file.json>...\n", progName())
+		exit(ExitUsage)
+	}
+	failed := 0
+	for _, path := range files {
+		data, err := readTextFile(path)
+		if err == nil {
+			var p *mappingPack
+			if p, err = parseMappingPack(data, path); err == nil {
+				status(nil, "%s: %s, %d mapping(s) from %s to %s\n", path, paint(styleOK, "ok"), len(p.Mappings), p.Source.Catalog, p.Target.Framework)
+				continue
+			}
+		}
+		fmt.Fprintf(os.Stderr, "%s\n", paintErr(styleFail, err.Error()))
+		failed++
+	}
+	if failed > 0 {
+		exit(ExitUsage)
+	}
+}
+
+// complianceControl is a target control as report compliance shows it.
+type complianceControl struct {
+	Control      string   `json:"control"`
+	Title        string   `json:"title"`
+	Sources      []string `json:"sources"`
+	Requirements []int64  `json:"requirements"`
+	Tests        string   `json:"tests,omitempty"`
+	Covered      bool     `json:"covered"`
+}
+
+func cmdReportCompliance(client *McpClient, osArgs []string) {
+	fs := flag.NewFlagSet("report compliance", flag.ContinueOnError)
+	pack := fs.String("pack", "", "Mapping pack to report against (see mapping packs) (required)")
+	gaps := fs.Bool("gaps", false, "Only list controls no requirement covers")
+	minCoverage := fs.Float64("min-coverage", 0, "Exit with 5 when less than this percentage of controls is covered")
+	asJSON := fs.Bool("json", false, "Print the controls as JSON")
+	parseFlags(fs, osArgs)
+
+	if *pack == "" {
+		fmt.Fprintln(os.Stderr, "Error: --pack is required")
+		fmt.Fprintf(os.Stderr, "Usage: %s report compliance --pack <name> [--gaps] [--min-coverage 80] [--json]\n", progName())
+		exit(ExitUsage)
+	}
+	p, err := findMappingPack(*pack)
+	if err != nil {
+		fatal(err)
+	}
+	reqs, err := listRequirements(client, map[string]interface{}{"detailed": true})
+	if err != nil {
+		fatal(err)
+	}
+	tests, err := loadControlTests()
+	if err != nil {
+		fatal(err)
+	}
+
+	// Each requirement covers the target controls its catalog controls map
+	// to; the sources say which catalog controls those were.
+	byControl := map[string]*complianceControl{}
+	for _, id := range p.targetControls() {
+		byControl[id] = &complianceControl{Control: id, Title: p.Target.Controls[id], Sources: []string{}, Requirements: []int64{}}
+	}
+	referenced := 0
+	for _, r := range reqs {
+		controls := p.requirementControls(r)
+		if len(controls) > 0 {
+			referenced++
+		}
+		id := int64(numberField(r, "id"))
+		for _, source := range controls {
+			for _, t := range p.targetsOf(source) {
+				c := byControl[t]
+				if !containsFold(c.Sources, source) {
+					c.Sources = append(c.Sources, source)
+				}
+				if n := len(c.Requirements); n == 0 || c.Requirements[n-1] != id {
+					c.Requirements = append(c.Requirements, id)
+				}
+				c.Covered = true
+			}
+		}
+	}
+
+	// A covered control's tests are the worst state of the control tests on
+	// its requirements.
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	rank := map[string]int{"": 0, "ok": 1, "due": 2, "failed": 3, "overdue": 4}
+	controls := []complianceControl{}
+	covered := 0
+	for _, id := range p.targetControls() {
+		c := byControl[id]
+		for _, t := range tests.Tests {
+			for _, reqID := range c.Requirements {
+				if s := t.state(today, today); t.RequirementID == reqID && rank[s] > rank[c.Tests] {
+					c.Tests = s
+				}
+			}
+		}
+		if c.Covered {
+			covered++
+			if *gaps {
+				continue
+			}
+		}
+		controls = append(controls, *c)
+	}
+	total := len(byControl)
+	coverage := 0.0
+	if total > 0 {
+		coverage = float64(covered) * 100 / float64(total)
+	}
+
+	if rawOutput(*asJSON) {
+		printResult(map[string]interface{}{
+			"pack": p.Name, "framework": p.Target.Framework, "controls": controls,
+			"covered": covered, "totalControls": total, "coverage": coverage, "requirements": referenced,
+		})
+	} else {
+		fmt.Printf("%s: %d of %d control(s) covered (%.0f%%) by %d requirement(s)\n\n", p.Title, covered, total, coverage, referenced)
+		fmt.Printf("%-10s %-48s %-18s %-16s %s\n", "CONTROL", "TITLE", "SOURCES", "REQUIREMENTS", "TESTS")
+		for _, c := range controls {
+			ids := make([]string, len(c.Requirements))
+			for i, id := range c.Requirements {
+				ids[i] = strconv.FormatInt(id, 10)
+			}
+			reqCol := fmt.Sprintf("%-16s", truncate(strings.Join(ids, ","), 16))
+			if !c.Covered {
+				reqCol = paint(styleFail, fmt.Sprintf("%-16s", "gap"))
+			}
+			testStyle := ""
+			if c.Tests == "overdue" || c.Tests == "failed" {
+				testStyle = styleFail
+			}
+			fmt.Printf("%-10s %-48s %-18s %s %s\n", c.Control, truncate(c.Title, 48), truncate(strings.Join(c.Sources, ","), 18),
+				reqCol, paint(testStyle, c.Tests))
+		}
+	}
+	if *minCoverage > 0 && coverage < *minCoverage {
+		exit(ExitGateFailed)
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Exported artifacts (reports, scan artifacts, requirement and translation
+// exports, backups) can be signed with the Ed25519 keys created by
+// `bundle keygen`. The signature is written next to the file as
+// <file>.minisig in minisign's format, so recipients can check it with the
+// verify command or with `minisign -Vm <file> -p <name>.minisign.pub`.
+//
+// Signatures are prehashed ("ED"): the signed message is the BLAKE2b-512
+// digest of the file. The trusted comment, which is covered by a second
+// signature, records the signing time, file name and source server.
+
+var (
+	minisignAlgPure      = [2]byte{'E', 'd'}
+	minisignAlgPrehashed = [2]byte{'E', 'D'}
+)
+
+// minisignKeyID derives the 8-byte key number minisign uses to match
+// signatures to keys. PEM keys carry none, so it is taken from the key.
+func minisignKeyID(pub ed25519.PublicKey) [8]byte {
+	sum := sha256.Sum256(pub)
+	var id [8]byte
+	copy(id[:], sum[:8])
+	return id
+}
+
+func minisignKeyIDString(id [8]byte) string {
+	return fmt.Sprintf("%016X", binary.LittleEndian.Uint64(id[:]))
+}
+
+// minisignPublicKey renders pub as a minisign public key file.
+func minisignPublicKey(pub ed25519.PublicKey) []byte {
+	id := minisignKeyID(pub)
+	raw := append(append(minisignAlgPure[:], id[:]...), pub...)
+	return []byte(fmt.Sprintf("untrusted comment: minisign public key %s\n%s\n",
+		minisignKeyIDString(id), base64.StdEncoding.EncodeToString(raw)))
+}
+
+// verifyKey is a public key with its minisign key number.
+type verifyKey struct {
+	pub ed25519.PublicKey
+	id  [8]byte
+}
+
+// loadVerifyKey reads a PEM public key or a minisign public key file,
+// including keys generated by minisign itself.
+func loadVerifyKey(path string) (*verifyKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Contains(data, []byte("-----BEGIN")) {
+		pub, err := loadPublicKey(path)
+		if err != nil {
+			return nil, err
+		}
+		return &verifyKey{pub: pub, id: minisignKeyID(pub)}, nil
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "untrusted comment:") {
+			continue
+		}
+		raw, err := base64.StdEncoding.DecodeString(line)
+		if err != nil || len(raw) != 2+8+ed25519.PublicKeySize || !bytes.Equal(raw[:2], minisignAlgPure[:]) {
+			return nil, fmt.Errorf("%s: not a minisign public key", path)
+		}
+		key := &verifyKey{pub: ed25519.PublicKey(raw[10:])}
+		copy(key.id[:], raw[2:10])
+		return key, nil
+	}
+	return nil, fmt.Errorf("%s: no key found", path)
+}
+
+// signArtifact writes <path>.minisig signed with the PEM private key at
+// keyPath and returns the signature path.
+func signArtifact(path, keyPath, source string) (string, error) {
+	priv, err := loadPrivateKey(keyPath)
+	if err != nil {
+		return "", err
+	}
+	digest, err := blake2bFile(path)
+	if err != nil {
+		return "", err
+	}
+	pub := priv.Public().(ed25519.PublicKey)
+	id := minisignKeyID(pub)
+
+	sig := ed25519.Sign(priv, digest)
+	trusted := fmt.Sprintf("timestamp:%d\tfile:%s\tprehashed", time.Now().Unix(), filepath.Base(path))
+	if source != "" {
+		trusted += "\tsource:" + source
+	}
+	global := ed25519.Sign(priv, append(append([]byte(nil), sig...), trusted...))
+
+	sigLine := append(append(minisignAlgPrehashed[:], id[:]...), sig...)
+	out := fmt.Sprintf("untrusted comment: signature from secman-mcp-go key %s\n%s\ntrusted comment: %s\n%s\n",
+		minisignKeyIDString(id), base64.StdEncoding.EncodeToString(sigLine), trusted, base64.StdEncoding.EncodeToString(global))
+
+	sigPath := path + ".minisig"
+	return sigPath, os.WriteFile(sigPath, []byte(out), 0o644)
+}
+
+// verifyArtifact checks a minisign signature of path and returns its
+// trusted comment.
+func verifyArtifact(path, sigPath string, key *verifyKey) (string, error) {
+	f, err := os.Open(sigPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, strings.TrimRight(scanner.Text(), "\r"))
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	if len(lines) < 4 || !strings.HasPrefix(lines[0], "untrusted comment:") || !strings.HasPrefix(lines[2], "trusted comment: ") {
+		return "", fmt.Errorf("%s: not a minisign signature", sigPath)
+	}
+
+	sigLine, err := base64.StdEncoding.DecodeString(lines[1])
+	if err != nil || len(sigLine) != 2+8+ed25519.SignatureSize {
+		return "", fmt.Errorf("%s: malformed signature", sigPath)
+	}
+	var sigID [8]byte
+	copy(sigID[:], sigLine[2:10])
+	if sigID != key.id {
+		return "", fmt.Errorf("signed with key %s, not with the given key %s", minisignKeyIDString(sigID), minisignKeyIDString(key.id))
+	}
+	pub, sig := key.pub, sigLine[10:]
+
+	var message []byte
+	switch {
+	case bytes.Equal(sigLine[:2], minisignAlgPrehashed[:]):
+		message, err = blake2bFile(path)
+	case bytes.Equal(sigLine[:2], minisignAlgPure[:]):
+		message, err = os.ReadFile(path)
+	default:
+		return "", fmt.Errorf("%s: unsupported signature algorithm %q", sigPath, sigLine[:2])
+	}
+	if err != nil {
+		return "", err
+	}
+	if !ed25519.Verify(pub, message, sig) {
+		return "", errors.New("signature does not match the file; it was altered after signing or signed by another key")
+	}
+
+	trusted := strings.TrimPrefix(lines[2], "trusted comment: ")
+	global, err := base64.StdEncoding.DecodeString(lines[3])
+	if err != nil || !ed25519.Verify(pub, append(append([]byte(nil), sig...), trusted...), global) {
+		return "", errors.New("trusted comment was altered after signing")
+	}
+	return trusted, nil
+}
+
+func blake2bFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := newBlake2b512()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// addSignFlag adds --sign to an export command. SECMAN_SIGNING_KEY sets a
+// default key so every export is signed.
+func addSignFlag(fs *flag.FlagSet) *string {
+	return fs.String("sign", setting("SECMAN_SIGNING_KEY"), "Sign the written file with this Ed25519 key (writes <file>.minisig)")
+}
+
+// signOutput signs a written artifact when a key was given.
+func signOutput(client *McpClient, path, keyPath string) {
+	if keyPath == "" {
+		return
+	}
+	sigPath, err := signArtifact(path, keyPath, client.BaseURL)
+	if err != nil {
+		fatal(fmt.Errorf("sign %s: %w", path, err))
+	}
+	status(nil, "Signed %s (%s)\n", path, sigPath)
+}
+
+func cmdVerify(osArgs []string) {
+	if len(osArgs) < 1 || strings.HasPrefix(osArgs[0], "-") {
+		fmt.Fprintln(os.Stderr, "Error: file required")
+		fmt.Fprintf(os.Stderr, "Usage: %s verify <file> --pubkey <key.pub|key.minisign.pub> [--signature <file.minisig>]\n", progName())
+		exit(ExitUsage)
+	}
+	path := osArgs[0]
+
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	pubPath := fs.String("pubkey", setting("SECMAN_VERIFY_KEY"), "Public key (PEM from bundle keygen, or its .minisign.pub)")
+	sigPath := fs.String("signature", path+".minisig", "Signature file")
+	parseFlags(fs, osArgs[1:])
+	if *pubPath == "" {
+		fmt.Fprintln(os.Stderr, "Error: --pubkey is required")
+		exit(ExitUsage)
+	}
+
+	key, err := loadVerifyKey(*pubPath)
+	if err != nil {
+		fatal(err)
+	}
+	trusted, err := verifyArtifact(path, *sigPath, key)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s %s: %v\n", paintErr(styleFail, "FAILED"), path, err)
+		exit(ExitGateFailed)
+	}
+	status(path, "%s %s: signature valid\n  trusted comment: %s\n", paint(styleOK, "OK"), path, trusted)
+}
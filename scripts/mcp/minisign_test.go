@@ -0,0 +1,120 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// signedFile writes a file and a fresh key pair to a temporary directory
+// and signs the file. It returns the file and the public key.
+func signedFile(t *testing.T) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	priv, pub := filepath.Join(dir, "key.pem"), filepath.Join(dir, "key.pub")
+	if err := generateSigningKey(priv, pub); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "report.csv")
+	if err := os.WriteFile(path, []byte("id,name\n1,web-01\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sigPath, err := signArtifact(path, priv, "https://secman.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sigPath != path+".minisig" {
+		t.Fatalf("signature written to %s, want %s.minisig", sigPath, path)
+	}
+	return path, pub
+}
+
+func TestSignVerifyRoundTrip(t *testing.T) {
+	path, pubPath := signedFile(t)
+
+	key, err := loadVerifyKey(pubPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trusted, err := verifyArtifact(path, path+".minisig", key)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	for _, want := range []string{"file:report.csv", "prehashed", "source:https://secman.example"} {
+		if !strings.Contains(trusted, want) {
+			t.Errorf("trusted comment %q lacks %q", trusted, want)
+		}
+	}
+
+	// The same key as a minisign public key file.
+	minisignPath := filepath.Join(filepath.Dir(path), "key.minisign.pub")
+	if err := os.WriteFile(minisignPath, minisignPublicKey(key.pub), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	mkey, err := loadVerifyKey(minisignPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mkey.id != key.id {
+		t.Errorf("minisign key id %s, want %s", minisignKeyIDString(mkey.id), minisignKeyIDString(key.id))
+	}
+	if _, err := verifyArtifact(path, path+".minisig", mkey); err != nil {
+		t.Errorf("verify with the minisign key file: %v", err)
+	}
+}
+
+func TestVerifyTamperedFile(t *testing.T) {
+	path, pubPath := signedFile(t)
+	key, err := loadVerifyKey(pubPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("id,name\n1,web-02\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifyArtifact(path, path+".minisig", key); err == nil || !strings.Contains(err.Error(), "does not match the file") {
+		t.Errorf("verify of a changed file: err = %v, want a mismatch", err)
+	}
+}
+
+func TestVerifyTamperedTrustedComment(t *testing.T) {
+	path, pubPath := signedFile(t)
+	key, err := loadVerifyKey(pubPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := os.ReadFile(path + ".minisig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := strings.Replace(string(sig), "file:report.csv", "file:other.csv", 1)
+	if err := os.WriteFile(path+".minisig", []byte(forged), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifyArtifact(path, path+".minisig", key); err == nil || !strings.Contains(err.Error(), "trusted comment") {
+		t.Errorf("verify with a changed trusted comment: err = %v, want it refused", err)
+	}
+}
+
+func TestVerifyWrongKey(t *testing.T) {
+	path, _ := signedFile(t)
+	_, otherPub := signedFile(t)
+	other, err := loadVerifyKey(otherPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifyArtifact(path, path+".minisig", other); err == nil || !strings.Contains(err.Error(), "not with the given key") {
+		t.Errorf("verify with another key: err = %v, want a key mismatch", err)
+	}
+
+	// Another key that claims the signer's key number still fails.
+	signer, err := loadVerifyKey(filepath.Join(filepath.Dir(path), "key.pub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other.id = signer.id
+	if _, err := verifyArtifact(path, path+".minisig", other); err == nil || !strings.Contains(err.Error(), "does not match the file") {
+		t.Errorf("verify with another key under the signer's id: err = %v, want a mismatch", err)
+	}
+}
@@ -0,0 +1,471 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sync netbox reconciles the IP address management in NetBox with the
+// Secman inventory. Every active IP address in NetBox should be an asset:
+// addresses without one are created, named by their DNS name or the
+// device they are assigned to. An asset whose owner differs from the
+// address's owner in NetBox is flagged, and with --fix-owners corrected.
+// Assets whose addresses NetBox does not know are listed, and among them
+// those outside every NetBox prefix.
+//
+// The owner is the address's tenant, or a custom field named by
+// --owner-field; an address without one takes it from the most specific
+// prefix that contains it. Assets are matched by IP address first and by
+// host name second. SECMAN_NETBOX_URL is the NetBox instance and
+// SECMAN_NETBOX_TOKEN an API token.
+
+type nbClient struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+func newNBClient(client *McpClient) (*nbClient, error) {
+	n := &nbClient{
+		baseURL: strings.TrimRight(setting("SECMAN_NETBOX_URL"), "/"),
+		token:   setting("SECMAN_NETBOX_TOKEN"),
+	}
+	if n.baseURL == "" || n.token == "" {
+		return nil, fmt.Errorf("SECMAN_NETBOX_URL and SECMAN_NETBOX_TOKEN are required")
+	}
+	registerSecret(n.token)
+	n.http = externalHTTPClient(client, 60*time.Second)
+	return n, nil
+}
+
+// get calls an API path, or a full URL such as a page's next link.
+func (n *nbClient) get(path string) (map[string]interface{}, error) {
+	u := path
+	if !strings.HasPrefix(u, "http") {
+		u = n.baseURL + "/api" + path
+	}
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	// NetBox 4.5 tokens (nbt_...) are bearer tokens; older ones use the
+	// Token scheme.
+	if strings.HasPrefix(n.token, "nbt_") {
+		req.Header.Set("Authorization", "Bearer "+n.token)
+	} else {
+		req.Header.Set("Authorization", "Token "+n.token)
+	}
+	resp, err := n.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("netbox: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("netbox: read response: %w", err)
+	}
+	var out map[string]interface{}
+	jsonErr := json.Unmarshal(data, &out)
+	if resp.StatusCode/100 != 2 {
+		msg := http.StatusText(resp.StatusCode)
+		if detail := stringField(out, "detail"); jsonErr == nil && detail != "" {
+			msg = detail
+		}
+		return nil, &HTTPError{StatusCode: resp.StatusCode, Body: "netbox: " + msg}
+	}
+	if jsonErr != nil {
+		return nil, fmt.Errorf("netbox: invalid response: %w", jsonErr)
+	}
+	return out, nil
+}
+
+// list follows the pages of a list endpoint.
+func (n *nbClient) list(path string, query url.Values) ([]map[string]interface{}, error) {
+	query.Set("limit", "1000")
+	next := path + "?" + query.Encode()
+	var results []map[string]interface{}
+	for next != "" {
+		out, err := n.get(next)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, mapsField(out, "results")...)
+		next = stringField(out, "next")
+	}
+	return results, nil
+}
+
+// nbPrefix is a NetBox prefix with its owner.
+type nbPrefix struct {
+	prefix netip.Prefix
+	owner  string
+}
+
+// nbAddress is an active NetBox IP address, as sync netbox compares it.
+type nbAddress struct {
+	ID       int64  `json:"id"`
+	IP       string `json:"ip"`
+	Name     string `json:"name"`
+	Assigned string `json:"assignedTo,omitempty"`
+	Owner    string `json:"owner,omitempty"`
+	Prefix   string `json:"prefix,omitempty"`
+	addr     netip.Addr
+}
+
+// nbOwner reads the owner of a prefix or address: its tenant, or the
+// custom field.
+func nbOwner(rec map[string]interface{}, field string) string {
+	if field == "tenant" {
+		if t, ok := rec["tenant"].(map[string]interface{}); ok {
+			return stringField(t, "name")
+		}
+		return ""
+	}
+	cf, _ := rec["custom_fields"].(map[string]interface{})
+	switch v := cf[field].(type) {
+	case map[string]interface{}:
+		// Object custom fields, such as a contact, carry a name or display.
+		if name := stringField(v, "name"); name != "" {
+			return name
+		}
+		return stringField(v, "display")
+	case string:
+		return strings.TrimSpace(v)
+	}
+	return ""
+}
+
+// nbAssignedName is the device or virtual machine an address is assigned
+// to.
+func nbAssignedName(rec map[string]interface{}) string {
+	obj, _ := rec["assigned_object"].(map[string]interface{})
+	for _, key := range []string{"device", "virtual_machine"} {
+		if parent, ok := obj[key].(map[string]interface{}); ok {
+			return stringField(parent, "name")
+		}
+	}
+	return ""
+}
+
+// readNetBox reads the prefixes and active IP addresses, filling each
+// address's owner and prefix from the most specific prefix when needed.
+func readNetBox(n *nbClient, ownerField string) ([]nbPrefix, []nbAddress, error) {
+	rawPrefixes, err := n.list("/ipam/prefixes/", url.Values{})
+	if err != nil {
+		return nil, nil, err
+	}
+	var prefixes []nbPrefix
+	for _, p := range rawPrefixes {
+		pfx, err := netip.ParsePrefix(stringField(p, "prefix"))
+		if err != nil {
+			continue
+		}
+		prefixes = append(prefixes, nbPrefix{prefix: pfx.Masked(), owner: nbOwner(p, ownerField)})
+	}
+	// Most specific first, so the first containing prefix is the one.
+	sort.SliceStable(prefixes, func(i, j int) bool { return prefixes[i].prefix.Bits() > prefixes[j].prefix.Bits() })
+
+	rawAddresses, err := n.list("/ipam/ip-addresses/", url.Values{"status": {"active"}})
+	if err != nil {
+		return nil, nil, err
+	}
+	var addresses []nbAddress
+	for _, rec := range rawAddresses {
+		pfx, err := netip.ParsePrefix(stringField(rec, "address"))
+		if err != nil {
+			continue
+		}
+		a := nbAddress{
+			ID:       int64(numberField(rec, "id")),
+			IP:       pfx.Addr().String(),
+			Name:     strings.ToLower(strings.TrimSuffix(stringField(rec, "dns_name"), ".")),
+			Assigned: nbAssignedName(rec),
+			Owner:    nbOwner(rec, ownerField),
+			addr:     pfx.Addr().Unmap(),
+		}
+		if p := nbContaining(prefixes, a.addr); p != nil {
+			a.Prefix = p.prefix.String()
+			if a.Owner == "" {
+				a.Owner = p.owner
+			}
+		}
+		addresses = append(addresses, a)
+	}
+	return prefixes, addresses, nil
+}
+
+func nbContaining(prefixes []nbPrefix, a netip.Addr) *nbPrefix {
+	for i := range prefixes {
+		if prefixes[i].prefix.Contains(a) {
+			return &prefixes[i]
+		}
+	}
+	return nil
+}
+
+// nbMismatch is an asset whose owner differs from NetBox.
+type nbMismatch struct {
+	AssetID     int64  `json:"assetId"`
+	AssetName   string `json:"assetName"`
+	IP          string `json:"ip"`
+	Owner       string `json:"owner"`
+	NetBoxOwner string `json:"netboxOwner"`
+}
+
+// nbSync is the outcome of comparing NetBox with the assets.
+type nbSync struct {
+	Matched    int                      `json:"matched"`
+	ByIP       int                      `json:"matchedByIp"`
+	ByName     int                      `json:"matchedByName"`
+	Mismatches []nbMismatch             `json:"ownerMismatches"`
+	Missing    []nbAddress              `json:"missing"`
+	SecmanOnly []map[string]interface{} `json:"secmanOnly"`
+	Outside    []map[string]interface{} `json:"outsidePrefixes"`
+}
+
+func cmdSync(client *McpClient, osArgs []string) {
+	if len(osArgs) < 1 {
+		fmt.Fprintf(os.Stderr, "Usage: %s sync netbox [options]\n", progName())
+		exit(ExitUsage)
+	}
+	switch osArgs[0] {
+	case "netbox":
+		cmdSyncNetBox(client, osArgs[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown sync source: %s (supported: netbox)\n", osArgs[0])
+		exit(ExitUsage)
+	}
+}
+
+func cmdSyncNetBox(client *McpClient, osArgs []string) {
+	fs := flag.NewFlagSet("sync netbox", flag.ContinueOnError)
+	ownerField := fs.String("owner-field", "tenant", "Where the owner is in NetBox: tenant, or the name of a custom field")
+	assetType := fs.String("type", "SERVER", "Type of new assets assigned to a device or virtual machine; others are UNKNOWN")
+	fixOwners := fs.Bool("fix-owners", false, "Set the owner of mismatched assets to NetBox's")
+	report := fs.Bool("report", false, "Only print the comparison; change nothing")
+	diff := fs.Bool("diff", false, "Only print the changes; exit 5 when there are any")
+	failOnDrift := fs.Bool("fail-on-drift", false, "Exit 5 when NetBox and Secman disagree")
+	asJSON := fs.Bool("json", false, "Print the comparison as JSON (implies --report)")
+	yes := addYesFlag(fs)
+	parseFlags(fs, osArgs)
+
+	n, err := newNBClient(client)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(ExitUsage)
+	}
+	prefixes, addresses, err := readNetBox(n, *ownerField)
+	if err != nil {
+		fatal(err)
+	}
+	state, err := readApplyState(client, map[string]bool{"assets": true}, false)
+	if err != nil {
+		fatal(err)
+	}
+
+	result, plan := planNetBox(prefixes, addresses, state, *assetType, *fixOwners)
+	drift := len(result.Mismatches)+len(result.Missing)+len(result.SecmanOnly) > 0
+
+	if rawOutput(*asJSON) {
+		printResult(result)
+	} else {
+		printNetBoxSync(result, len(prefixes), len(addresses))
+		switch {
+		case *report:
+		case len(plan) == 0:
+			status(0, "\nNo changes\n")
+		case *diff:
+			fmt.Println()
+			for _, a := range plan {
+				fmt.Println(a)
+			}
+			exit(ExitGateFailed)
+		default:
+			fmt.Println()
+			runApplyPlan(client, state, plan, *yes)
+		}
+	}
+	if *failOnDrift && drift {
+		exit(ExitGateFailed)
+	}
+}
+
+// planNetBox compares the addresses with the assets and plans the assets
+// to create and, with fixOwners, the owners to correct.
+func planNetBox(prefixes []nbPrefix, addresses []nbAddress, s *applyState, assetType string, fixOwners bool) (*nbSync, []*applyAction) {
+	result := &nbSync{Mismatches: []nbMismatch{}, Missing: []nbAddress{}, SecmanOnly: []map[string]interface{}{}, Outside: []map[string]interface{}{}}
+	byIP, byName := map[netip.Addr]map[string]interface{}{}, map[string]map[string]interface{}{}
+	keys := make([]string, 0, len(s.records["assets"]))
+	for key := range s.records["assets"] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		a := s.records["assets"][key]
+		if isDecommissioned(a) {
+			continue
+		}
+		for _, ip := range assetAddrs(a) {
+			if byIP[ip] == nil {
+				byIP[ip] = a
+			}
+		}
+		if name := nbNameKey(stringField(a, "name")); name != "" && byName[name] == nil {
+			byName[name] = a
+		}
+	}
+
+	var plan []*applyAction
+	matched := map[string]bool{}
+	known := map[netip.Addr]bool{}
+	for _, nb := range addresses {
+		known[nb.addr] = true
+		a, by := byIP[nb.addr], "ip"
+		if a == nil {
+			for _, name := range []string{nb.Name, nb.Assigned} {
+				if a = byName[nbNameKey(name)]; a != nil {
+					by = "name"
+					break
+				}
+			}
+		}
+		if a == nil {
+			result.Missing = append(result.Missing, nb)
+			name := nb.Name
+			if name == "" {
+				name = strings.ToLower(nb.Assigned)
+			}
+			if name == "" || s.records["assets"][strings.ToLower(name)] != nil {
+				name = nb.IP
+			}
+			typ := "UNKNOWN"
+			if nb.Assigned != "" {
+				typ = assetType
+			}
+			rec := map[string]interface{}{"name": name, "type": typ, "ip": nb.IP,
+				"tags": map[string]interface{}{"netbox-id": strconv.FormatInt(nb.ID, 10)}}
+			if nb.Owner != "" {
+				rec["owner"] = nb.Owner
+			}
+			if nb.Prefix != "" {
+				rec["tags"].(map[string]interface{})["netbox-prefix"] = nb.Prefix
+			}
+			// An asset created for this run's first address takes later ones
+			// with the same name.
+			if key := nbNameKey(name); key != "" {
+				byName[key] = rec
+			}
+			plan = append(plan, &applyAction{op: "create", section: "assets", desired: rec, tools: []string{"create_asset", "update_asset"}})
+			continue
+		}
+		if a["id"] == nil {
+			continue
+		}
+		key := applyKey("assets", a)
+		if matched[key] {
+			continue
+		}
+		matched[key] = true
+		result.Matched++
+		if by == "ip" {
+			result.ByIP++
+		} else {
+			result.ByName++
+		}
+		owner := strings.TrimSpace(stringField(a, "owner"))
+		if nb.Owner == "" || strings.EqualFold(owner, nb.Owner) {
+			continue
+		}
+		result.Mismatches = append(result.Mismatches, nbMismatch{
+			AssetID: int64(numberField(a, "id")), AssetName: stringField(a, "name"), IP: nb.IP, Owner: owner, NetBoxOwner: nb.Owner,
+		})
+		if fixOwners {
+			rec := map[string]interface{}{"name": stringField(a, "name"), "owner": nb.Owner}
+			if changes := diffRecord("assets", rec, a, nil); len(changes) > 0 {
+				plan = append(plan, &applyAction{op: "update", section: "assets", desired: rec, current: a,
+					changes: changes, tools: updateTools("assets", changes)})
+			}
+		}
+	}
+
+	for _, key := range keys {
+		a := s.records["assets"][key]
+		addrs := assetAddrs(a)
+		if matched[key] || isDecommissioned(a) || len(addrs) == 0 {
+			continue
+		}
+		inNetBox, inPrefix := false, false
+		for _, ip := range addrs {
+			inNetBox = inNetBox || known[ip]
+			inPrefix = inPrefix || nbContaining(prefixes, ip) != nil
+		}
+		if inNetBox {
+			continue
+		}
+		result.SecmanOnly = append(result.SecmanOnly, a)
+		if !inPrefix {
+			result.Outside = append(result.Outside, a)
+		}
+	}
+	return result, plan
+}
+
+// assetAddrs parses an asset's comma-separated IP addresses.
+func assetAddrs(a map[string]interface{}) []netip.Addr {
+	var addrs []netip.Addr
+	for _, ip := range splitList(stringField(a, "ip")) {
+		if addr, err := netip.ParseAddr(ip); err == nil {
+			addrs = append(addrs, addr.Unmap())
+		}
+	}
+	return addrs
+}
+
+// nbNameKey is the short host name assets and addresses are matched by.
+// Assets named by their address are matched by IP only.
+func nbNameKey(name string) string {
+	name = strings.TrimSpace(name)
+	if _, err := netip.ParseAddr(name); err == nil {
+		return ""
+	}
+	return shortHostname(name)
+}
+
+func printNetBoxSync(r *nbSync, prefixes, addresses int) {
+	fmt.Printf("NetBox:           %d prefix(es), %d active IP address(es)\n", prefixes, addresses)
+	fmt.Printf("Matched:          %d (%d by IP, %d by name)\n", r.Matched, r.ByIP, r.ByName)
+	fmt.Printf("Owner mismatch:   %d\n", len(r.Mismatches))
+	fmt.Printf("Missing assets:   %d\n", len(r.Missing))
+	fmt.Printf("Only in Secman:   %d (%d outside every NetBox prefix)\n", len(r.SecmanOnly), len(r.Outside))
+	if len(r.Mismatches) > 0 {
+		fmt.Println("\nAssets whose owner differs from NetBox:")
+		for _, m := range r.Mismatches {
+			fmt.Printf("  %-8d %-30s %-15s %-20s NetBox: %s\n", m.AssetID, truncate(m.AssetName, 30), m.IP, orNone(m.Owner), m.NetBoxOwner)
+		}
+	}
+	if len(r.SecmanOnly) > 0 {
+		outside := map[interface{}]bool{}
+		for _, a := range r.Outside {
+			outside[a["id"]] = true
+		}
+		fmt.Println("\nAssets with addresses NetBox does not have:")
+		for _, a := range r.SecmanOnly {
+			note := ""
+			if outside[a["id"]] {
+				note = "outside every prefix"
+			}
+			fmt.Printf("  %-8v %-30s %-15s %s\n", a["id"], truncate(stringField(a, "name"), 30), stringField(a, "ip"), note)
+		}
+	}
+}
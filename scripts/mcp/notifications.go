@@ -0,0 +1,135 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+func cmdNotifications(client *McpClient, osArgs []string) {
+	if len(osArgs) < 1 {
+		fmt.Fprintln(os.Stderr, "Error: notifications subcommand required")
+		fmt.Fprintf(os.Stderr, "Usage: %s notifications <list|ack> ...\n", progName())
+		exit(ExitUsage)
+	}
+
+	switch osArgs[0] {
+	case "list":
+		cmdNotificationsList(client, osArgs[1:])
+	case "ack":
+		cmdNotificationsAck(client, osArgs[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown notifications subcommand: %s\n", osArgs[0])
+		exit(ExitUsage)
+	}
+}
+
+func cmdNotificationsList(client *McpClient, osArgs []string) {
+	fs := flag.NewFlagSet("notifications list", flag.ContinueOnError)
+	unread := fs.Bool("unread", false, "Only unacknowledged notifications")
+	notifType := fs.String("type", "", "Filter by type (e.g. CRITICAL_FINDING, EXCEPTION_REQUEST)")
+	count := fs.Bool("count", false, "Print only the number of matching notifications")
+	asJSON := fs.Bool("json", false, "Print the raw tool result as JSON")
+	parseFlags(fs, osArgs)
+
+	notifications, err := listNotifications(client, *unread, *notifType)
+	if err != nil {
+		fatal(err)
+	}
+
+	switch {
+	case *count:
+		fmt.Println(len(notifications))
+	case rawOutput(*asJSON):
+		printResult(notifications)
+	default:
+		for _, n := range notifications {
+			state := "new"
+			if read, _ := n["read"].(bool); read {
+				state = "ack"
+			}
+			fmt.Printf("%-8v %-4s %-20v %-25v %v\n", n["id"], state, n["type"], n["createdAt"], n["message"])
+		}
+	}
+}
+
+func listNotifications(client *McpClient, unread bool, notifType string) ([]map[string]interface{}, error) {
+	if err := client.requireTool("list_notifications"); err != nil {
+		return nil, err
+	}
+
+	args := map[string]interface{}{}
+	if unread {
+		args["unreadOnly"] = true
+	}
+	if notifType != "" {
+		args["type"] = notifType
+	}
+
+	content, err := client.callToolMap("list_notifications", args)
+	if err != nil {
+		return nil, err
+	}
+
+	return mapsField(content, "notifications"), nil
+}
+
+func cmdNotificationsAck(client *McpClient, osArgs []string) {
+	fs := flag.NewFlagSet("notifications ack", flag.ContinueOnError)
+	all := fs.Bool("all", false, "Acknowledge all unread notifications")
+	notifType := fs.String("type", "", "With --all: only acknowledge notifications of this type")
+	stdin := fs.Bool("stdin", false, "Read notification ids or JSON from stdin")
+	parseFlags(fs, osArgs)
+
+	var ids []int64
+	if *stdin {
+		items, err := readStdinItems(os.Stdin)
+		if err != nil {
+			fatal(err)
+		}
+		if ids, err = recordIDs(items, "notificationId", "id"); err != nil {
+			fatal(err)
+		}
+	} else if *all {
+		notifications, err := listNotifications(client, true, *notifType)
+		if err != nil {
+			fatal(err)
+		}
+		for _, n := range notifications {
+			if id, ok := n["id"].(float64); ok {
+				ids = append(ids, int64(id))
+			}
+		}
+	} else {
+		for _, arg := range fs.Args() {
+			id, err := strconv.ParseInt(arg, 10, 64)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: invalid notification id %q\n", arg)
+				exit(ExitUsage)
+			}
+			ids = append(ids, id)
+		}
+	}
+
+	if len(ids) == 0 {
+		if *all {
+			status(0, "No unread notifications\n")
+			return
+		}
+		fmt.Fprintln(os.Stderr, "Error: notification ids or --all required")
+		fmt.Fprintf(os.Stderr, "Usage: %s notifications ack <id>... | --all [--type TYPE] | --stdin\n", progName())
+		exit(ExitUsage)
+	}
+
+	if err := client.requireTool("acknowledge_notifications"); err != nil {
+		fatal(err)
+	}
+	if _, err := client.callToolMap("acknowledge_notifications", map[string]interface{}{
+		"notificationIds": ids,
+	}); err != nil {
+		fatal(err)
+	}
+
+	status(len(ids), "Acknowledged %d notification(s)\n", len(ids))
+}
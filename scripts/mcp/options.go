@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// version is the client version reported in the User-Agent header and by
+// the version command. Release builds (build.sh) set it, the commit and
+// the build time with -ldflags "-X main.version=1.2.3 -X main.commit=...
+// -X main.buildDate=...".
+var (
+	version   = "0.1.0"
+	commit    = ""
+	buildDate = ""
+)
+
+// underGoRun reports whether this is a binary go run built in a temporary
+// directory, rather than an installed one.
+func underGoRun() bool {
+	exe, err := os.Executable()
+	return err == nil && strings.Contains(filepath.ToSlash(exe), "/go-build")
+}
+
+// binaryName is the name the client is installed as: secman, or whatever a
+// package manager or user renamed it to.
+func binaryName() string {
+	if underGoRun() || len(os.Args) == 0 {
+		return "secman"
+	}
+	return strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe")
+}
+
+// progName is how the user runs the client, for help texts: "go run ." in
+// a checkout, the binary's name otherwise.
+func progName() string {
+	if underGoRun() {
+		return "go run ."
+	}
+	return binaryName()
+}
+
+// userAgent identifies the client to the server and to gateways in between.
+func userAgent() string {
+	return fmt.Sprintf("secman-mcp-go/%s (%s/%s; %s)", version, runtime.GOOS, runtime.GOARCH, runtime.Version())
+}
+
+// ClientOption configures an McpClient at construction.
+type ClientOption func(*McpClient)
+
+// WithHeaders adds headers to every request, e.g. the correlation and
+// routing headers an API gateway requires. A User-Agent given here replaces
+// the default; the authentication, delegation and tenant headers always
+// take their values from the client.
+func WithHeaders(h http.Header) ClientOption {
+	return func(c *McpClient) {
+		if c.Headers == nil {
+			c.Headers = http.Header{}
+		}
+		for name, values := range h {
+			for _, v := range values {
+				c.Headers.Add(name, v)
+				if sensitiveName(name) {
+					registerSecret(v)
+				}
+			}
+		}
+	}
+}
+
+// headerFlag collects repeated --header 'Name: value' flags.
+type headerFlag struct {
+	header http.Header
+}
+
+func (f *headerFlag) String() string {
+	if f == nil || f.header == nil {
+		return ""
+	}
+	var parts []string
+	for name, values := range f.header {
+		for _, v := range values {
+			parts = append(parts, name+": "+v)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (f *headerFlag) Set(s string) error {
+	name, value, ok := strings.Cut(s, ":")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" || strings.ContainsAny(name, " \t") || strings.ContainsAny(s, "\r\n") {
+		return fmt.Errorf("invalid header %q (want 'Name: value')", s)
+	}
+	if f.header == nil {
+		f.header = http.Header{}
+	}
+	f.header.Add(textproto.CanonicalMIMEHeaderKey(name), strings.TrimSpace(value))
+	return nil
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// A model's context is small next to what list tools can return, so
+// serve-stdio keeps each result within a byte budget (--max-output, or
+// --max-tokens at about four bytes a token). A larger result is cut down
+// before it reaches the host, with a note saying so:
+//
+//   - summarize (the default) replaces the longest list in the result with
+//     its length, counts per value of its short text fields (severity,
+//     type, status, ...) and a few sample items
+//   - truncate keeps as many items of the list as fit
+//
+// A result without a list is cut at the budget. Either way the note tells
+// the model how large the result was and to narrow the call.
+
+const (
+	overflowSummarize = "summarize"
+	overflowTruncate  = "truncate"
+
+	// overflowSamples is how many items a summary shows at most.
+	overflowSamples = 5
+	// overflowMaxGroups caps the fields counted in a summary and the
+	// distinct values a field may have to be counted.
+	overflowMaxGroups = 20
+)
+
+// overflowPolicy is the budget of the bridge's results.
+type overflowPolicy struct {
+	maxBytes int
+	mode     string
+}
+
+// shape returns the content to send for a result, as MCP text items.
+func (p overflowPolicy) shape(tool string, content interface{}) []map[string]string {
+	text := contentText(content)
+	if p.maxBytes <= 0 || len(text) <= p.maxBytes {
+		return []map[string]string{{"type": "text", "text": text}}
+	}
+	var data interface{}
+	if err := json.Unmarshal([]byte(text), &data); err != nil {
+		return p.cut(tool, text)
+	}
+	key, list := longestList(data)
+	if list == nil {
+		return p.cut(tool, text)
+	}
+	var shaped interface{}
+	var note string
+	if p.mode == overflowTruncate {
+		shaped, note = p.truncate(tool, len(text), data, key, list)
+	} else {
+		shaped, note = p.summarize(tool, len(text), data, key, list)
+	}
+	out, _ := json.Marshal(shaped)
+	if len(out) > p.maxBytes {
+		return p.cut(tool, string(out))
+	}
+	return []map[string]string{{"type": "text", "text": string(out)}, {"type": "text", "text": note}}
+}
+
+// contentText is the result as the host reads it: the text of MCP text
+// items, or the JSON of the structured content this server returns.
+func contentText(content interface{}) string {
+	if items, ok := content.([]interface{}); ok && len(items) > 0 {
+		var texts []string
+		for _, item := range items {
+			m, _ := item.(map[string]interface{})
+			text, isText := m["text"].(string)
+			if !isText {
+				texts = nil
+				break
+			}
+			texts = append(texts, text)
+		}
+		if texts != nil {
+			return strings.Join(texts, "\n")
+		}
+	}
+	out, err := json.Marshal(content)
+	if err != nil {
+		return fmt.Sprint(content)
+	}
+	return string(out)
+}
+
+// longestList finds the longest list of objects: the result itself, or
+// one of its top-level fields. key is "" for the result itself.
+func longestList(data interface{}) (string, []interface{}) {
+	if list, ok := data.([]interface{}); ok && isObjectList(list) {
+		return "", list
+	}
+	m, ok := data.(map[string]interface{})
+	if !ok {
+		return "", nil
+	}
+	var key string
+	var longest []interface{}
+	for _, k := range objectKeys(m) {
+		if l, ok := m[k].([]interface{}); ok && len(l) > len(longest) && isObjectList(l) {
+			key, longest = k, l
+		}
+	}
+	return key, longest
+}
+
+func listName(key string) string {
+	if key == "" {
+		return "its list"
+	}
+	return key
+}
+
+// otherFields copies the top-level fields of a result besides its list,
+// such as totalElements, and returns the key the list goes under.
+func otherFields(data interface{}, key string) (map[string]interface{}, string) {
+	out := map[string]interface{}{}
+	m, ok := data.(map[string]interface{})
+	if !ok || key == "" {
+		return out, "items"
+	}
+	for k, v := range m {
+		if k != key {
+			out[k] = v
+		}
+	}
+	return out, key
+}
+
+func (p overflowPolicy) truncate(tool string, size int, data interface{}, key string, list []interface{}) (interface{}, string) {
+	// Leave room for the other fields and the note.
+	shaped, listKey := otherFields(data, key)
+	budget := p.maxBytes - 1024
+	if rest, err := json.Marshal(shaped); err == nil {
+		budget -= len(rest)
+	}
+	kept, used := 0, 0
+	for _, item := range list {
+		b, _ := json.Marshal(item)
+		if used+len(b)+1 > budget {
+			break
+		}
+		used += len(b) + 1
+		kept++
+	}
+	note := fmt.Sprintf("Result truncated: %s returned %s with %d items in %s; only the first %d fit the bridge's limit of %s. "+
+		"Narrow the call (filters, page, pageSize) to see the rest.",
+		tool, formatBytes(int64(size)), len(list), listName(key), kept, formatBytes(int64(p.maxBytes)))
+	shaped[listKey] = list[:kept]
+	shaped["truncated"] = map[string]interface{}{"shown": kept, "total": len(list)}
+	return shaped, note
+}
+
+func (p overflowPolicy) summarize(tool string, size int, data interface{}, key string, list []interface{}) (interface{}, string) {
+	counts := countsByField(list)
+	samples := list
+	if len(samples) > overflowSamples {
+		samples = samples[:overflowSamples]
+	}
+	// Samples may be large records; drop them one by one until the
+	// summary fits.
+	shaped, _ := otherFields(data, key)
+	for n := len(samples); n >= 0; n-- {
+		shaped["summary"] = map[string]interface{}{"items": len(list), "countsBy": counts, "sample": samples[:n]}
+		if out, _ := json.Marshal(shaped); len(out) <= p.maxBytes-1024 {
+			break
+		}
+	}
+	note := fmt.Sprintf("Result summarized: %s returned %s with %d items in %s, over the bridge's limit of %s. "+
+		"The summary gives their count, counts per value of their short fields and a sample. "+
+		"Narrow the call (filters, page, pageSize) to get the items themselves.",
+		tool, formatBytes(int64(size)), len(list), listName(key), formatBytes(int64(p.maxBytes)))
+	return shaped, note
+}
+
+// countsByField counts the values of each field holding short text, a
+// number of distinct values small enough to be a grouping.
+func countsByField(list []interface{}) map[string]map[string]int {
+	values := map[string]map[string]int{}
+	skip := map[string]bool{}
+	for _, item := range list {
+		for field, v := range item.(map[string]interface{}) {
+			if skip[field] {
+				continue
+			}
+			var value string
+			switch t := v.(type) {
+			case string:
+				value = t
+			case bool:
+				value = fmt.Sprint(t)
+			case nil:
+				value = "(none)"
+			default:
+				skip[field] = true
+				continue
+			}
+			if len(value) > 64 {
+				skip[field] = true
+				continue
+			}
+			if values[field] == nil {
+				values[field] = map[string]int{}
+			}
+			values[field][value]++
+			if len(values[field]) > overflowMaxGroups {
+				skip[field] = true
+			}
+		}
+	}
+	fields := make([]string, 0, len(values))
+	for field := range values {
+		// A field unique to every item, such as a name, is no grouping.
+		if !skip[field] && (len(values[field]) < len(list) || len(list) == 1) {
+			fields = append(fields, field)
+		}
+	}
+	// Prefer the fields with the fewest values.
+	sort.Slice(fields, func(i, j int) bool {
+		if len(values[fields[i]]) != len(values[fields[j]]) {
+			return len(values[fields[i]]) < len(values[fields[j]])
+		}
+		return fields[i] < fields[j]
+	})
+	if len(fields) > overflowMaxGroups {
+		fields = fields[:overflowMaxGroups]
+	}
+	counts := make(map[string]map[string]int, len(fields))
+	for _, field := range fields {
+		counts[field] = values[field]
+	}
+	return counts
+}
+
+// cut shortens text that cannot be shaped, on a rune boundary.
+func (p overflowPolicy) cut(tool, text string) []map[string]string {
+	n := p.maxBytes - 512
+	if n < 0 {
+		n = 0
+	}
+	for n > 0 && n < len(text) && !utf8.RuneStart(text[n]) {
+		n--
+	}
+	note := fmt.Sprintf("Result cut: %s returned %s, over the bridge's limit of %s; only the start is shown and it is not valid JSON. "+
+		"Narrow the call to get all of it.", tool, formatBytes(int64(len(text))), formatBytes(int64(p.maxBytes)))
+	return []map[string]string{{"type": "text", "text": text[:n]}, {"type": "text", "text": note}}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+
+	"github.com/schmalle/secman/scripts/mcp/secman"
+)
+
+// listPage calls a paginated list tool (page/pageSize arguments) and returns
+// the items stored under listKey together with the total page count.
+func listPage(client *McpClient, tool, listKey string, args map[string]interface{}) ([]map[string]interface{}, int, error) {
+	content, err := client.callToolMap(tool, args)
+	if err != nil {
+		return nil, 0, err
+	}
+	items := mapsField(content, listKey)
+	totalPages, _ := content["totalPages"].(float64)
+	return items, int(totalPages), nil
+}
+
+// listAll fetches every page of a paginated list tool, showing progress.
+func listAll(client *McpClient, tool, listKey string, args map[string]interface{}, pageSize int) ([]map[string]interface{}, error) {
+	progress := startProgress("Fetching "+listKey, "pages", 0)
+	defer progress.Finish()
+
+	pager := secman.Pages(context.Background(), client, tool, listKey, args, pageSize)
+	pager.OnPage = func(totalPages int) {
+		progress.SetTotal(int64(totalPages))
+		progress.Add(1)
+	}
+	return pager.All()
+}
+
+// runListAll prints every item of a paginated list tool under listKey, for
+// the --all flag of the list commands.
+func runListAll(client *McpClient, tool, listKey string, args map[string]interface{}) {
+	items, err := listAll(client, tool, listKey, args, 500)
+	if err != nil {
+		fatal(err)
+	}
+	if items == nil {
+		items = []map[string]interface{}{}
+	}
+	printResult(map[string]interface{}{listKey: items, "totalElements": len(items)})
+}
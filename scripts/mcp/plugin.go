@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Command plugins work like kubectl's: an executable named secman-<name> on
+// PATH runs as `go run . <name>`. Dashes nest, so secman-team-sync handles
+// `team sync`; the longest matching name wins and gets the remaining
+// arguments. Built-in commands cannot be replaced.
+//
+// A plugin inherits the environment plus the settings this client resolved
+// from flags, the env file and the profile (SECMAN_BASE_URL, SECMAN_MCP_KEY,
+// SECMAN_TENANT, ...), and:
+//
+//	SECMAN_PROFILE   the active profile
+//	SECMAN_DRY_RUN   true under --dry-run
+//	SECMAN_QUIET     true under --quiet
+//	SECMAN_CLI       this executable, to call back into the client
+//
+// Plugins do not run in read-only mode: they get the API key and talk to
+// the server themselves, so the client cannot keep them from writing.
+
+const pluginPrefix = "secman-"
+
+// findPlugin returns the plugin executable for a command line and how many
+// of its words name the plugin, or "" when there is none.
+func findPlugin(args []string) (string, int) {
+	if len(args) == 0 || isCommand(args[0]) {
+		return "", 0
+	}
+	n := 0
+	for n < len(args) && args[n] != "" && !strings.HasPrefix(args[n], "-") && !strings.ContainsAny(args[n], `/\`) {
+		n++
+	}
+	for ; n > 0; n-- {
+		if path, err := exec.LookPath(pluginPrefix + strings.Join(args[:n], "-")); err == nil {
+			return path, n
+		}
+	}
+	return "", 0
+}
+
+// pluginEnv is the environment of a plugin run.
+func pluginEnv(client *McpClient) []string {
+	env := os.Environ()
+	for _, key := range settings.Keys() {
+		if value, _, ok := settings.Lookup(key); ok {
+			env = append(env, key+"="+value)
+		}
+	}
+	env = append(env,
+		"SECMAN_BASE_URL="+client.BaseURL,
+		"SECMAN_USER_EMAIL="+client.UserEmail,
+		"SECMAN_TENANT="+client.Tenant,
+		"SECMAN_PROFILE="+settings.ProfileName,
+		fmt.Sprintf("SECMAN_DRY_RUN=%t", client.dryRun),
+		fmt.Sprintf("SECMAN_QUIET=%t", quiet),
+	)
+	if self, err := os.Executable(); err == nil {
+		env = append(env, "SECMAN_CLI="+self)
+	}
+	return env
+}
+
+// runPlugin runs a plugin with the rest of the command line and exits with
+// its exit code when it fails.
+func runPlugin(client *McpClient, path string, args []string) {
+	if client.readOnly {
+		fatal(&ReadOnlyError{Plugin: filepath.Base(path)})
+	}
+	cmd := exec.Command(path, args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = pluginEnv(client)
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		exit(exitErr.ExitCode())
+	}
+	if err != nil {
+		fatal(fmt.Errorf("plugin %s: %w", filepath.Base(path), err))
+	}
+}
+
+// pluginCommand is the command a plugin executable provides.
+func pluginCommand(file string) (string, bool) {
+	if runtime.GOOS == "windows" {
+		file = strings.TrimSuffix(file, filepath.Ext(file))
+	}
+	if !strings.HasPrefix(file, pluginPrefix) || file == pluginPrefix {
+		return "", false
+	}
+	return strings.ReplaceAll(strings.TrimPrefix(file, pluginPrefix), "-", " "), true
+}
+
+func cmdPlugin(osArgs []string) {
+	if len(osArgs) != 1 || osArgs[0] != "list" {
+		fmt.Fprintf(os.Stderr, "Usage: %s plugin list\n", progName())
+		exit(ExitUsage)
+	}
+
+	type found struct{ command, path, note string }
+	var plugins []found
+	seen := map[string]string{}
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			command, ok := pluginCommand(e.Name())
+			if !ok || e.IsDir() {
+				continue
+			}
+			path := filepath.Join(dir, e.Name())
+			if _, err := exec.LookPath(path); err != nil {
+				continue
+			}
+			p := found{command: command, path: path}
+			if first, dup := seen[command]; dup {
+				p.note = "shadowed by " + first
+			} else if name := strings.Fields(command)[0]; isCommand(name) {
+				p.note = "shadowed by the built-in " + name + " command"
+			} else {
+				seen[command] = path
+			}
+			plugins = append(plugins, p)
+		}
+	}
+	if len(plugins) == 0 {
+		status(nil, "No secman-* plugins on PATH\n")
+		return
+	}
+	sort.SliceStable(plugins, func(i, j int) bool { return plugins[i].command < plugins[j].command })
+	for _, p := range plugins {
+		if p.note != "" {
+			fmt.Printf("%-24s %s (%s)\n", p.command, p.path, p.note)
+		} else {
+			fmt.Printf("%-24s %s\n", p.command, p.path)
+		}
+	}
+}
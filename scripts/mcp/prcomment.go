@@ -0,0 +1,416 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// -o pr-comment renders a result as compact Markdown for a GitHub pull
+// request or GitLab merge request comment. A gate result becomes its
+// verdict, violations and the findings that are new or fixed since the
+// baseline; any other result becomes a table. `pr-comment post` posts the
+// Markdown, replacing the comment of an earlier run on the same request.
+
+// prCommentMarker starts every comment, so that a later post finds and
+// updates it instead of adding another one.
+const prCommentMarker = "<!-- secman:pr-comment -->"
+
+const (
+	prCommentMaxRows = 25
+	// GitHub rejects comments over 65536 characters.
+	prCommentMaxBytes = 60000
+)
+
+type prCommentRenderer struct{}
+
+func (prCommentRenderer) Render(w io.Writer, v interface{}) error {
+	data, err := normalize(v)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	b.WriteString(prCommentMarker + "\n")
+	if m, ok := data.(map[string]interface{}); ok && isGateResult(m) {
+		writeGateComment(&b, m)
+	} else if err := writeTableComment(&b, v); err != nil {
+		return err
+	}
+	writeCommentFooter(&b)
+	out := b.String()
+	if len(out) > prCommentMaxBytes {
+		out = out[:prCommentMaxBytes] + "\n\n_(truncated)_\n"
+	}
+	_, err = io.WriteString(w, out)
+	return err
+}
+
+func isGateResult(m map[string]interface{}) bool {
+	_, passed := m["passed"].(bool)
+	_, violations := m["violations"].([]interface{})
+	return passed && violations
+}
+
+func writeGateComment(b *strings.Builder, m map[string]interface{}) {
+	if m["passed"] == true {
+		b.WriteString("### :white_check_mark: Secman gate passed\n\n")
+	} else {
+		b.WriteString("### :x: Secman gate failed\n\n")
+	}
+
+	summary, _ := m["summary"].(map[string]interface{})
+	counts := make([]string, 0, len(severityOrder)+1)
+	for _, sev := range append(append([]string{}, severityOrder...), "overdue") {
+		counts = append(counts, fmt.Sprintf("%s %s", cellText(numberOrZero(summary[sev])), strings.ToLower(sev)))
+	}
+	fmt.Fprintf(b, "%s open finding(s) on %s asset(s): %s\n", cellText(m["findings"]), cellText(m["assets"]), strings.Join(counts, " · "))
+
+	newList, _ := m["new"].([]interface{})
+	fixedList, _ := m["fixed"].([]interface{})
+	if created, ok := m["baseline"].(string); ok {
+		fmt.Fprintf(b, "\nSince the baseline of %s: **%d new or worsened**, **%d fixed**\n", created, len(newList), len(fixedList))
+	}
+
+	if violations, _ := m["violations"].([]interface{}); len(violations) > 0 {
+		b.WriteString("\n**Violations**\n\n")
+		for i, item := range violations {
+			if i == prCommentMaxRows {
+				fmt.Fprintf(b, "- …and %d more\n", len(violations)-i)
+				break
+			}
+			v, _ := item.(map[string]interface{})
+			fmt.Fprintf(b, "- `%s` %s\n", stringField(v, "rule"), markdownText(stringField(v, "message")))
+		}
+	}
+	writeChangeTable(b, "New or worsened findings", newList, true)
+	writeChangeTable(b, "Fixed findings", fixedList, false)
+}
+
+// writeChangeTable lists gate changes in a collapsible section, open when
+// they matter to the reviewer.
+func writeChangeTable(b *strings.Builder, title string, changes []interface{}, open bool) {
+	if len(changes) == 0 {
+		return
+	}
+	attr := ""
+	if open {
+		attr = " open"
+	}
+	fmt.Fprintf(b, "\n<details%s><summary>%s (%d)</summary>\n\n", attr, title, len(changes))
+	b.WriteString("| Severity | CVE | Asset |\n|---|---|---|\n")
+	for i, item := range changes {
+		if i == prCommentMaxRows {
+			fmt.Fprintf(b, "\n…and %d more\n", len(changes)-i)
+			break
+		}
+		c, _ := item.(map[string]interface{})
+		sev := stringField(c, "severity")
+		if was := stringField(c, "was"); was != "" {
+			sev = was + " → " + sev
+		}
+		asset := stringField(c, "asset")
+		if asset == "" {
+			asset = "asset " + cellText(c["assetId"])
+		}
+		asset = markdownText(asset)
+		if u := stringField(c, "assetUrl"); u != "" {
+			asset = fmt.Sprintf("[%s](%s)", asset, u)
+		}
+		fmt.Fprintf(b, "| %s | %s | %s |\n", sev, cveLink(stringField(c, "cve")), asset)
+	}
+	b.WriteString("\n</details>\n")
+}
+
+// writeTableComment renders any other result as a Markdown table.
+func writeTableComment(b *strings.Builder, v interface{}) error {
+	columns, rows, err := tabulate(v)
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		b.WriteString("_(no results)_\n")
+		return nil
+	}
+	header := make([]string, len(columns))
+	sep := make([]string, len(columns))
+	for i, c := range columns {
+		header[i], sep[i] = markdownText(c), "---"
+	}
+	fmt.Fprintf(b, "| %s |\n|%s|\n", strings.Join(header, " | "), strings.Join(sep, "|"))
+	for i, row := range rows {
+		if i == prCommentMaxRows {
+			fmt.Fprintf(b, "\n…and %d more\n", len(rows)-i)
+			break
+		}
+		cells := make([]string, len(row))
+		for j, cell := range row {
+			cells[j] = markdownText(truncate(cell, 80))
+		}
+		fmt.Fprintf(b, "| %s |\n", strings.Join(cells, " | "))
+	}
+	return nil
+}
+
+// writeCommentFooter links the Secman UI and, in CI, the pipeline run.
+func writeCommentFooter(b *strings.Builder) {
+	var links []string
+	if base := strings.TrimRight(settingOr("SECMAN_UI_URL", setting("SECMAN_BASE_URL")), "/"); base != "" {
+		links = append(links, fmt.Sprintf("[Secman](%s/vulnerabilities/current)", base))
+	}
+	if run := ciRunURL(); run != "" {
+		links = append(links, fmt.Sprintf("[CI run](%s)", run))
+	}
+	if len(links) > 0 {
+		fmt.Fprintf(b, "\n<sub>%s</sub>\n", strings.Join(links, " · "))
+	}
+}
+
+// ciRunURL returns the URL of the current GitHub Actions run or GitLab job.
+func ciRunURL() string {
+	if id := os.Getenv("GITHUB_RUN_ID"); id != "" && os.Getenv("GITHUB_REPOSITORY") != "" {
+		return fmt.Sprintf("%s/%s/actions/runs/%s", strings.TrimRight(envOr("GITHUB_SERVER_URL", "https://github.com"), "/"), os.Getenv("GITHUB_REPOSITORY"), id)
+	}
+	return os.Getenv("CI_JOB_URL")
+}
+
+func cveLink(cve string) string {
+	if !strings.HasPrefix(cve, "CVE-") {
+		return markdownText(cve)
+	}
+	return fmt.Sprintf("[%s](https://nvd.nist.gov/vuln/detail/%s)", cve, cve)
+}
+
+// markdownText keeps a value on one table line and out of the markup.
+func markdownText(s string) string {
+	s = strings.NewReplacer("\r", "", "\n", " ", "|", "\\|", "<", "&lt;", ">", "&gt;").Replace(s)
+	return strings.TrimSpace(s)
+}
+
+func numberOrZero(v interface{}) interface{} {
+	if v == nil {
+		return 0.0
+	}
+	return v
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// prTarget is the pull or merge request a comment is posted to.
+type prTarget struct {
+	gitlab  bool
+	apiURL  string
+	project string // owner/repo on GitHub, id or path on GitLab
+	number  int
+	token   string
+}
+
+// detectPRTarget fills what the flags left open from the GitHub Actions or
+// GitLab CI environment.
+func detectPRTarget(t *prTarget) error {
+	if t.project == "" {
+		switch {
+		case os.Getenv("GITHUB_REPOSITORY") != "":
+			t.project = os.Getenv("GITHUB_REPOSITORY")
+		case os.Getenv("CI_PROJECT_ID") != "":
+			t.gitlab, t.project = true, os.Getenv("CI_PROJECT_ID")
+		default:
+			return fmt.Errorf("no repository given; use --github owner/repo or --gitlab <project>")
+		}
+	}
+	if t.number == 0 {
+		if t.gitlab {
+			t.number, _ = strconv.Atoi(os.Getenv("CI_MERGE_REQUEST_IID"))
+		} else if ref := os.Getenv("GITHUB_REF"); strings.HasPrefix(ref, "refs/pull/") {
+			// refs/pull/<number>/merge
+			t.number, _ = strconv.Atoi(strings.SplitN(strings.TrimPrefix(ref, "refs/pull/"), "/", 2)[0])
+		}
+		if t.number == 0 {
+			return fmt.Errorf("no pull or merge request number; use --pr (the pipeline may not run for a pull request)")
+		}
+	}
+	if t.apiURL == "" {
+		if t.gitlab {
+			t.apiURL = envOr("CI_API_V4_URL", "https://gitlab.com/api/v4")
+		} else {
+			t.apiURL = envOr("GITHUB_API_URL", "https://api.github.com")
+		}
+	}
+	t.apiURL = strings.TrimRight(t.apiURL, "/")
+	if t.token == "" {
+		if t.gitlab {
+			t.token = settingOr("SECMAN_GITLAB_TOKEN", setting("GITLAB_TOKEN"))
+		} else {
+			t.token = settingOr("SECMAN_GITHUB_TOKEN", setting("GITHUB_TOKEN"))
+		}
+	}
+	if t.token == "" {
+		if t.gitlab {
+			return fmt.Errorf("SECMAN_GITLAB_TOKEN or GITLAB_TOKEN is required (a CI job token cannot post notes)")
+		}
+		return fmt.Errorf("SECMAN_GITHUB_TOKEN or GITHUB_TOKEN is required")
+	}
+	registerSecret(t.token)
+	return nil
+}
+
+// commentsURL is the collection of the request's comments.
+func (t *prTarget) commentsURL() string {
+	if t.gitlab {
+		return fmt.Sprintf("%s/projects/%s/merge_requests/%d/notes", t.apiURL, url.PathEscape(t.project), t.number)
+	}
+	return fmt.Sprintf("%s/repos/%s/issues/%d/comments", t.apiURL, t.project, t.number)
+}
+
+// commentURL addresses one existing comment.
+func (t *prTarget) commentURL(id int64) string {
+	if t.gitlab {
+		return fmt.Sprintf("%s/%d", t.commentsURL(), id)
+	}
+	return fmt.Sprintf("%s/repos/%s/issues/comments/%d", t.apiURL, t.project, id)
+}
+
+func (t *prTarget) do(httpClient *http.Client, method, u string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, u, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if t.gitlab {
+		req.Header.Set("PRIVATE-TOKEN", t.token)
+	} else {
+		req.Header.Set("Accept", "application/vnd.github+json")
+		req.Header.Set("Authorization", "Bearer "+t.token)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("http request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &HTTPError{StatusCode: resp.StatusCode, Body: req.URL.Host + ": " + strings.TrimSpace(string(msg))}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// findComment returns the id of the request's earlier Secman comment, or 0.
+// Only the first 100 comments are searched.
+func (t *prTarget) findComment(httpClient *http.Client) (int64, error) {
+	var comments []map[string]interface{}
+	if err := t.do(httpClient, http.MethodGet, t.commentsURL()+"?per_page=100", nil, &comments); err != nil {
+		return 0, err
+	}
+	for _, c := range comments {
+		if strings.HasPrefix(stringField(c, "body"), prCommentMarker) {
+			return int64(numberField(c, "id")), nil
+		}
+	}
+	return 0, nil
+}
+
+func cmdPRComment(client *McpClient, osArgs []string) {
+	if len(osArgs) < 1 || osArgs[0] != "post" {
+		fmt.Fprintf(os.Stderr, "Usage: %s pr-comment post [file] [--github owner/repo | --gitlab <project>] [--pr N]\n", progName())
+		exit(ExitUsage)
+	}
+	fs := flag.NewFlagSet("pr-comment post", flag.ContinueOnError)
+	var t prTarget
+	github := fs.String("github", "", "GitHub repository owner/repo (default: GITHUB_REPOSITORY)")
+	gitlab := fs.String("gitlab", "", "GitLab project id or path (default: CI_PROJECT_ID)")
+	fs.IntVar(&t.number, "pr", 0, "Pull or merge request number (default: from the CI environment)")
+	fs.StringVar(&t.apiURL, "api-url", "", "API URL for GitHub Enterprise or self-managed GitLab")
+	fs.StringVar(&t.token, "token", "", "Access token (default: SECMAN_GITHUB_TOKEN/GITHUB_TOKEN or SECMAN_GITLAB_TOKEN/GITLAB_TOKEN)")
+	always := fs.Bool("new", false, "Add a new comment instead of updating the previous one")
+	parseFlags(fs, osArgs[1:])
+
+	if *github != "" && *gitlab != "" {
+		fmt.Fprintln(os.Stderr, "Error: --github and --gitlab are mutually exclusive")
+		exit(ExitUsage)
+	}
+	t.project, t.gitlab = *github, *gitlab != ""
+	if t.gitlab {
+		t.project = *gitlab
+	}
+	if err := detectPRTarget(&t); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(ExitUsage)
+	}
+
+	var body []byte
+	var err error
+	if fs.NArg() > 0 && fs.Arg(0) != "-" {
+		body, err = os.ReadFile(fs.Arg(0))
+	} else {
+		body, err = io.ReadAll(os.Stdin)
+	}
+	if err != nil {
+		fatal(err)
+	}
+	text := strings.TrimSpace(string(body))
+	if text == "" {
+		fmt.Fprintln(os.Stderr, "Error: the comment is empty")
+		exit(ExitUsage)
+	}
+	if !strings.HasPrefix(text, prCommentMarker) {
+		text = prCommentMarker + "\n" + text
+	}
+
+	httpClient := externalHTTPClient(client, 30*time.Second)
+	var id int64
+	if !*always {
+		if id, err = t.findComment(httpClient); err != nil {
+			fatal(err)
+		}
+	}
+	if client.dryRun {
+		client.dryRunCalls.Add(1)
+		action := "create comment on"
+		if id != 0 {
+			action = fmt.Sprintf("update comment %d on", id)
+		}
+		fmt.Printf("DRY RUN %s %s #%d (%d bytes)\n", action, t.project, t.number, len(text))
+		return
+	}
+
+	var out map[string]interface{}
+	if id != 0 {
+		method := http.MethodPatch
+		if t.gitlab {
+			method = http.MethodPut
+		}
+		err = t.do(httpClient, method, t.commentURL(id), map[string]string{"body": text}, &out)
+	} else {
+		err = t.do(httpClient, http.MethodPost, t.commentsURL(), map[string]string{"body": text}, &out)
+		id = int64(numberField(out, "id"))
+	}
+	if err != nil {
+		fatal(err)
+	}
+	status(id, "Posted comment %d on %s #%d\n", id, t.project, t.number)
+}
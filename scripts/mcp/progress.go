@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Long operations (multi-page fetches, downloads, restores and imports)
+// report progress on stderr. On a terminal this is a bar with an ETA, or a
+// spinner when the total is unknown; otherwise a log line is written every
+// progressLogInterval. Nothing is shown for operations that finish within
+// progressDelay, so quick commands print exactly what they did before.
+
+const (
+	progressDelay       = time.Second
+	progressLogInterval = 10 * time.Second
+	progressBarWidth    = 24
+)
+
+var spinnerFrames = []string{"|", "/", "-", `\`}
+
+// Progress tracks one operation. total 0 means unknown.
+type Progress struct {
+	mu       sync.Mutex
+	label    string
+	unit     string
+	total    int64
+	done     int64
+	start    time.Time
+	lastLog  time.Time
+	frame    int
+	tty      bool
+	drawn    bool
+	logged   bool
+	inert    bool
+	once     sync.Once
+	stop     chan struct{}
+	finished sync.WaitGroup
+}
+
+// activeProgress is the operation currently reporting. Operations started
+// while another one runs (a page fetch inside an import) stay silent, as
+// does everything under --quiet.
+var (
+	activeMu       sync.Mutex
+	activeProgress *Progress
+)
+
+// startProgress begins reporting an operation. unit is "pages", "items",
+// "bytes" and so on; Finish must be called when the operation ends.
+func startProgress(label, unit string, total int64) *Progress {
+	info, err := os.Stderr.Stat()
+	p := &Progress{
+		label: label,
+		unit:  unit,
+		total: total,
+		start: time.Now(),
+		tty:   err == nil && info.Mode()&os.ModeCharDevice != 0 && os.Getenv("TERM") != "dumb",
+		stop:  make(chan struct{}),
+	}
+	p.lastLog = p.start
+
+	activeMu.Lock()
+	defer activeMu.Unlock()
+	if quiet || activeProgress != nil {
+		p.inert = true
+		return p
+	}
+	activeProgress = p
+
+	interval := time.Second
+	if p.tty {
+		interval = 100 * time.Millisecond
+	}
+	p.finished.Add(1)
+	go func() {
+		defer p.finished.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+				p.mu.Lock()
+				p.render()
+				p.mu.Unlock()
+			}
+		}
+	}()
+	return p
+}
+
+// Add records n more units as processed.
+func (p *Progress) Add(n int64) {
+	p.mu.Lock()
+	p.done += n
+	p.mu.Unlock()
+}
+
+// SetTotal sets the total once it becomes known (e.g. after the first page).
+func (p *Progress) SetTotal(n int64) {
+	p.mu.Lock()
+	p.total = n
+	p.mu.Unlock()
+}
+
+// Warnf prints a message to stderr without garbling the progress bar.
+func (p *Progress) Warnf(format string, args ...interface{}) {
+	pauseProgress(func() { fmt.Fprintf(os.Stderr, format, args...) })
+}
+
+// pauseProgress removes the active bar while print writes to the terminal;
+// the bar is drawn again on the next tick. print must not update progress.
+func pauseProgress(print func()) {
+	activeMu.Lock()
+	p := activeProgress
+	activeMu.Unlock()
+	if p == nil {
+		print()
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clear()
+	p.drawn = false
+	print()
+}
+
+// Finish stops reporting and removes the bar. A log line marks the end
+// when progress was logged. It may be called more than once, so callers
+// can defer it and still finish before printing their summary.
+func (p *Progress) Finish() {
+	if !p.inert {
+		p.once.Do(p.finish)
+	}
+}
+
+func (p *Progress) finish() {
+	close(p.stop)
+	p.finished.Wait()
+	activeMu.Lock()
+	activeProgress = nil
+	activeMu.Unlock()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clear()
+	p.drawn = false
+	if p.logged {
+		fmt.Fprintf(os.Stderr, "%s: done, %s in %s\n", p.label, p.amount(p.done), time.Since(p.start).Round(time.Second))
+	}
+}
+
+// Writer wraps w so that bytes written through it count as progress.
+func (p *Progress) Writer(w io.Writer) io.Writer {
+	return progressWriter{w: w, p: p}
+}
+
+type progressWriter struct {
+	w io.Writer
+	p *Progress
+}
+
+func (pw progressWriter) Write(b []byte) (int, error) {
+	n, err := pw.w.Write(b)
+	pw.p.Add(int64(n))
+	return n, err
+}
+
+func (p *Progress) render() {
+	elapsed := time.Since(p.start)
+	if elapsed < progressDelay {
+		return
+	}
+	if p.tty {
+		p.frame++
+		p.drawn = true
+		p.draw()
+		return
+	}
+	if time.Since(p.lastLog) >= progressLogInterval {
+		p.lastLog = time.Now()
+		p.logged = true
+		fmt.Fprintf(os.Stderr, "%s: %s\n", p.label, p.status())
+	}
+}
+
+func (p *Progress) draw() {
+	line := p.label + " "
+	if p.total > 0 {
+		filled := int(p.done * progressBarWidth / p.total)
+		if filled > progressBarWidth {
+			filled = progressBarWidth
+		}
+		line += "[" + strings.Repeat("#", filled) + strings.Repeat(".", progressBarWidth-filled) + "] "
+	} else {
+		line += spinnerFrames[p.frame%len(spinnerFrames)] + " "
+	}
+	fmt.Fprintf(os.Stderr, "\r%s%s\x1b[K", line, p.status())
+}
+
+func (p *Progress) clear() {
+	if p.tty && p.drawn {
+		fmt.Fprint(os.Stderr, "\r\x1b[K")
+	}
+}
+
+// status renders "12/40 pages (30%), ETA 12s" or "12 pages, 5s" without a total.
+func (p *Progress) status() string {
+	elapsed := time.Since(p.start)
+	if p.total <= 0 {
+		return fmt.Sprintf("%s, %s", p.amount(p.done), elapsed.Round(time.Second))
+	}
+	s := fmt.Sprintf("%s/%s (%d%%)", p.amountValue(p.done), p.amount(p.total), p.done*100/p.total)
+	if p.done > 0 && p.done < p.total {
+		eta := time.Duration(float64(elapsed) * float64(p.total-p.done) / float64(p.done))
+		s += ", ETA " + eta.Round(time.Second).String()
+	}
+	return s
+}
+
+// amount formats a count with its unit; bytes are scaled.
+func (p *Progress) amount(n int64) string {
+	if p.unit == "bytes" {
+		return formatBytes(n)
+	}
+	return fmt.Sprintf("%d %s", n, p.unit)
+}
+
+// amountValue is amount without the unit, for the left side of "x/y".
+func (p *Progress) amountValue(n int64) string {
+	if p.unit == "bytes" {
+		return formatBytes(n)
+	}
+	return fmt.Sprint(n)
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
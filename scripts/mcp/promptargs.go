@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// call without --args on a terminal asks for the tool's arguments one by
+// one, from its inputSchema: required properties first, then the optional
+// ones, which Enter skips. Enums are offered as a numbered menu (Tab
+// completes their values), numbers and booleans are checked as they are
+// typed, and arrays take comma-separated values or JSON. The equivalent
+// --args is printed afterwards, for the next time.
+
+// promptArgs asks for the arguments of def.
+func promptArgs(def ToolDefinition) (map[string]interface{}, error) {
+	names, props, required := schemaParams(def)
+
+	editor := newLineEditor(os.Stdin, os.Stderr, nil)
+	fmt.Fprintf(os.Stderr, "%s: %s\n", def.Name, strings.TrimSpace(def.Description))
+	fmt.Fprintln(os.Stderr, "Enter skips optional arguments; Ctrl-D aborts.")
+	args := map[string]interface{}{}
+	for _, name := range names {
+		prop, _ := props[name].(map[string]interface{})
+		v, set, err := promptProperty(editor, name, prop, required[name])
+		if err != nil {
+			return nil, err
+		}
+		if set {
+			args[name] = v
+		}
+	}
+	return args, nil
+}
+
+// schemaParams returns the properties of a tool's inputSchema, required
+// ones first and then by name.
+func schemaParams(def ToolDefinition) ([]string, map[string]interface{}, map[string]bool) {
+	props, _ := def.InputSchema["properties"].(map[string]interface{})
+	required := map[string]bool{}
+	if list, ok := def.InputSchema["required"].([]interface{}); ok {
+		for _, r := range list {
+			if name, ok := r.(string); ok {
+				required[name] = true
+			}
+		}
+	}
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if required[names[i]] != required[names[j]] {
+			return required[names[i]]
+		}
+		return names[i] < names[j]
+	})
+	return names, props, required
+}
+
+// promptProperty asks for one property until the answer fits its schema.
+// set is false for a skipped optional property.
+func promptProperty(editor *lineEditor, name string, prop map[string]interface{}, required bool) (interface{}, bool, error) {
+	typ, _ := prop["type"].(string)
+	enum, _ := prop["enum"].([]interface{})
+	def, hasDefault := prop["default"]
+
+	fmt.Fprintf(os.Stderr, "\n%s", name)
+	var notes []string
+	if typ != "" {
+		notes = append(notes, typ)
+	}
+	if required {
+		notes = append(notes, "required")
+	}
+	if len(notes) > 0 {
+		fmt.Fprintf(os.Stderr, " (%s)", strings.Join(notes, ", "))
+	}
+	if desc, _ := prop["description"].(string); desc != "" {
+		fmt.Fprintf(os.Stderr, ": %s", strings.TrimSpace(desc))
+	}
+	fmt.Fprintln(os.Stderr)
+	editor.complete = nil
+	if len(enum) > 0 {
+		values := make([]string, len(enum))
+		for i, e := range enum {
+			values[i] = fmt.Sprint(e)
+			fmt.Fprintf(os.Stderr, "  %d) %s\n", i+1, values[i])
+		}
+		editor.complete = func(line string) (int, []string) {
+			var matches []string
+			for _, v := range values {
+				if strings.HasPrefix(v, line) {
+					matches = append(matches, v)
+				}
+			}
+			return 0, matches
+		}
+	}
+	prompt := "> "
+	if hasDefault {
+		prompt = fmt.Sprintf("[%v] > ", def)
+	}
+
+	for {
+		line, err := editor.readLine(prompt)
+		if err == io.EOF || err == errInterrupted {
+			return nil, false, fmt.Errorf("aborted")
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			switch {
+			case hasDefault:
+				return def, true, nil
+			case !required:
+				return nil, false, nil
+			}
+			fmt.Fprintf(os.Stderr, "  %s is required\n", name)
+			continue
+		}
+		if len(enum) > 0 {
+			if v, ok := pickEnum(enum, line); ok {
+				return v, true, nil
+			}
+			fmt.Fprintf(os.Stderr, "  enter a number from 1 to %d or one of the values\n", len(enum))
+			continue
+		}
+		v, err := parsePromptValue(typ, prop, line)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "  %v\n", err)
+			continue
+		}
+		editor.addHistory(line)
+		return v, true, nil
+	}
+}
+
+// pickEnum accepts a menu number or a value, case-insensitively.
+func pickEnum(enum []interface{}, line string) (interface{}, bool) {
+	if n, err := strconv.Atoi(line); err == nil && n >= 1 && n <= len(enum) {
+		return enum[n-1], true
+	}
+	for _, e := range enum {
+		if strings.EqualFold(fmt.Sprint(e), line) {
+			return e, true
+		}
+	}
+	return nil, false
+}
+
+// parsePromptValue converts an answer to the property's type.
+func parsePromptValue(typ string, prop map[string]interface{}, line string) (interface{}, error) {
+	switch typ {
+	case "integer":
+		n, err := strconv.ParseInt(line, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a whole number", line)
+		}
+		return n, checkRange(prop, float64(n))
+	case "number":
+		f, err := strconv.ParseFloat(line, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", line)
+		}
+		return f, checkRange(prop, f)
+	case "boolean":
+		switch strings.ToLower(line) {
+		case "y", "yes", "true", "1":
+			return true, nil
+		case "n", "no", "false", "0":
+			return false, nil
+		}
+		return nil, fmt.Errorf("answer yes or no")
+	case "array":
+		if strings.HasPrefix(line, "[") {
+			var list []interface{}
+			if err := json.Unmarshal([]byte(line), &list); err != nil {
+				return nil, fmt.Errorf("not a JSON array: %v", err)
+			}
+			return list, nil
+		}
+		items, _ := prop["items"].(map[string]interface{})
+		itemType, _ := items["type"].(string)
+		var list []interface{}
+		for _, part := range splitList(line) {
+			v, err := parsePromptValue(itemType, items, part)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+	case "object":
+		var obj map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &obj); err != nil {
+			return nil, fmt.Errorf("enter a JSON object: %v", err)
+		}
+		return obj, nil
+	}
+	return line, nil
+}
+
+func checkRange(prop map[string]interface{}, v float64) error {
+	if min, ok := prop["minimum"].(float64); ok && v < min {
+		return fmt.Errorf("must be at least %v", min)
+	}
+	if max, ok := prop["maximum"].(float64); ok && v > max {
+		return fmt.Errorf("must be at most %v", max)
+	}
+	return nil
+}
@@ -0,0 +1,585 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// query answers questions no single list tool can, by fetching the lists
+// involved and joining them here:
+//
+//	vulnerabilities where asset.tag.pci = true and asset.owner = team-x
+//	vulnerabilities where severity in (critical, high) and asset.tags ~ pci order by ageDays desc limit 20
+//	assets where tag.environment = production and open.critical > 0
+//	assets where lastSeen < 90d and not tag.lifecycle exists
+//
+// A query is an entity, then optionally where <condition>, order by
+// <field> [asc|desc] and limit <n>. Conditions combine comparisons with
+// and, or, not and parentheses. Comparisons are
+//
+//	field = value, !=, <, <=, >, >=    numbers, dates or text (text ignores case)
+//	field ~ value                     contains, ignoring case
+//	field in (v1, v2, ...)            equal to one of the values
+//	field exists                      set and not empty
+//
+// A list field (tags, groups) matches when any element does. A date field
+// compared with a time expression (90d, 2024-01-31) compares as a time, so
+// lastSeen < 90d means "last seen more than 90 days ago".
+//
+// Fields are the tool records' own, dotted for nested objects, plus:
+//
+//	vulnerabilities  severity, cve, ageDays, asset.<asset field>
+//	assets           tag.<key>, open, open.critical, open.high, open.medium,
+//	                 open.low, open.overdue
+//
+// Assets are only fetched for vulnerabilities when a field starts with
+// asset., and findings for assets only when one starts with open.
+
+// queryEntities are the lists query can read.
+var queryEntities = map[string]string{"vulnerabilities": "get_vulnerabilities", "assets": "get_assets"}
+
+// queryNode is a parsed condition.
+type queryNode interface {
+	eval(q *queryEnv, rec map[string]interface{}) bool
+}
+
+type queryAnd struct{ left, right queryNode }
+type queryOr struct{ left, right queryNode }
+type queryNot struct{ inner queryNode }
+
+// queryCmp compares a field; values holds one value, or several for in.
+type queryCmp struct {
+	field  []string
+	op     string
+	values []string
+}
+
+func (n queryAnd) eval(q *queryEnv, rec map[string]interface{}) bool {
+	return n.left.eval(q, rec) && n.right.eval(q, rec)
+}
+func (n queryOr) eval(q *queryEnv, rec map[string]interface{}) bool {
+	return n.left.eval(q, rec) || n.right.eval(q, rec)
+}
+func (n queryNot) eval(q *queryEnv, rec map[string]interface{}) bool { return !n.inner.eval(q, rec) }
+
+func (n queryCmp) eval(q *queryEnv, rec map[string]interface{}) bool {
+	v := q.value(rec, n.field)
+	items, isList := v.([]interface{})
+	if !isList {
+		items = []interface{}{v}
+	}
+	if n.op == "exists" {
+		for _, item := range items {
+			if item != nil && fmt.Sprint(item) != "" {
+				return true
+			}
+		}
+		return false
+	}
+	for _, item := range items {
+		if item == nil {
+			continue
+		}
+		for _, want := range n.values {
+			if compareQueryValue(fmt.Sprint(item), n.op, want, q.now) {
+				return true
+			}
+		}
+	}
+	// != holds for a field that is not set at all.
+	return n.op == "!=" && len(items) == 1 && items[0] == nil
+}
+
+// compareQueryValue compares a field value with a query value: as numbers
+// when both are, as times when the field is a date and the value a time
+// expression, else as text ignoring case.
+func compareQueryValue(have, op, want string, now time.Time) bool {
+	if op == "~" {
+		return strings.Contains(strings.ToLower(have), strings.ToLower(want))
+	}
+	if op == "in" {
+		op = "="
+	}
+	cmp := 0
+	hn, herr := strconv.ParseFloat(have, 64)
+	wn, werr := strconv.ParseFloat(want, 64)
+	ht, hok := parseServerTime(have)
+	switch {
+	case herr == nil && werr == nil:
+		cmp = compareFloat(hn, wn)
+	case hok:
+		wt, err := parseTimeExpr(want, now)
+		if err != nil {
+			return false
+		}
+		cmp = ht.Compare(wt)
+		if op == "=" || op == "!=" {
+			// A date equals a day-precision value on any time of that day.
+			if len(want) == 10 {
+				cmp = strings.Compare(ht.UTC().Format("2006-01-02"), want)
+			}
+		}
+	default:
+		cmp = strings.Compare(strings.ToLower(have), strings.ToLower(want))
+	}
+	switch op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// queryEnv holds the joined lists of one query.
+type queryEnv struct {
+	entity string
+	assets map[int64]map[string]interface{}
+	open   map[int64]map[string]int
+	now    time.Time
+}
+
+// value resolves a field of a record; lists come back as []interface{}.
+func (q *queryEnv) value(rec map[string]interface{}, field []string) interface{} {
+	if rec == nil || len(field) == 0 {
+		return nil
+	}
+	head := strings.ToLower(field[0])
+	if q.entity == "vulnerabilities" {
+		switch {
+		case head == "asset" && len(field) > 1:
+			return q.assetValue(q.assets[findingAssetID(rec)], field[1:])
+		case head == "severity" && len(field) == 1:
+			return strings.ToUpper(stringField(rec, "cvssSeverity"))
+		case head == "cve" && len(field) == 1:
+			return strings.ToUpper(stringField(rec, "vulnerabilityId"))
+		case head == "agedays" && len(field) == 1:
+			if days, ok := findingAge(rec, q.now); ok {
+				return days
+			}
+			return nil
+		}
+		return recordValue(rec, field)
+	}
+	return q.assetValue(rec, field)
+}
+
+func (q *queryEnv) assetValue(asset map[string]interface{}, field []string) interface{} {
+	if asset == nil {
+		return nil
+	}
+	switch head := strings.ToLower(field[0]); {
+	case head == "tag" && len(field) == 2:
+		if v := assetTag(asset, field[1]); v != "" {
+			return v
+		}
+		return nil
+	case head == "open" && len(field) <= 2:
+		key := "total"
+		if len(field) == 2 {
+			key = strings.ToLower(field[1])
+		}
+		return q.open[int64(numberField(asset, "id"))][key]
+	}
+	return recordValue(asset, field)
+}
+
+// recordValue follows a dotted path through nested objects, matching keys
+// without case.
+func recordValue(rec map[string]interface{}, field []string) interface{} {
+	var cur interface{} = rec
+	for _, part := range field {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v, found := m[part]
+		if !found {
+			for k, kv := range m {
+				if strings.EqualFold(k, part) {
+					v, found = kv, true
+					break
+				}
+			}
+		}
+		if !found {
+			return nil
+		}
+		cur = v
+	}
+	if f, ok := cur.(float64); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return cur
+}
+
+// parsedQuery is a whole query.
+type parsedQuery struct {
+	entity  string
+	where   queryNode
+	orderBy []string
+	desc    bool
+	limit   int
+	fields  [][]string // every field the condition and order use
+}
+
+// tokenizeQuery splits a query into words, quoted strings and operators.
+func tokenizeQuery(s string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(' || c == ')' || c == ',' || c == '~' || c == '=':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '!' || c == '<' || c == '>':
+			if i+1 < len(s) && s[i+1] == '=' {
+				tokens = append(tokens, s[i:i+2])
+				i += 2
+			} else if c == '!' {
+				return nil, fmt.Errorf("unexpected '!' at %d (use != or not)", i)
+			} else {
+				tokens = append(tokens, string(c))
+				i++
+			}
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(s[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			// A leading quote marks the token as a literal.
+			tokens = append(tokens, "\x00"+s[i+1:i+1+end])
+			i += end + 2
+		default:
+			start := i
+			for i < len(s) && !strings.ContainsRune(" \t\r\n(),~=!<>'\"", rune(s[i])) {
+				i++
+			}
+			tokens = append(tokens, s[start:i])
+		}
+	}
+	return tokens, nil
+}
+
+type queryParser struct {
+	tokens []string
+	pos    int
+	fields [][]string
+}
+
+func (p *queryParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *queryParser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+// keyword reports whether the next token is the (unquoted) word and takes it.
+func (p *queryParser) keyword(word string) bool {
+	if strings.EqualFold(p.peek(), word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *queryParser) literal() (string, error) {
+	t := p.next()
+	switch {
+	case t == "":
+		return "", fmt.Errorf("value expected at the end")
+	case strings.HasPrefix(t, "\x00"):
+		return t[1:], nil
+	case strings.ContainsAny(t, "(),~=<>!"):
+		return "", fmt.Errorf("value expected, got %q", t)
+	}
+	return t, nil
+}
+
+func (p *queryParser) orExpr() (queryNode, error) {
+	left, err := p.andExpr()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		right, err := p.andExpr()
+		if err != nil {
+			return nil, err
+		}
+		left = queryOr{left, right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) andExpr() (queryNode, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = queryAnd{left, right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) unary() (queryNode, error) {
+	if p.keyword("not") {
+		inner, err := p.unary()
+		return queryNot{inner}, err
+	}
+	if p.peek() == "(" {
+		p.next()
+		inner, err := p.orExpr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		return inner, nil
+	}
+	return p.comparison()
+}
+
+func (p *queryParser) field() ([]string, error) {
+	t := p.next()
+	if t == "" || strings.HasPrefix(t, "\x00") || strings.ContainsAny(t, "(),~=<>!") {
+		return nil, fmt.Errorf("field expected, got %q", strings.TrimPrefix(t, "\x00"))
+	}
+	field := strings.Split(t, ".")
+	p.fields = append(p.fields, field)
+	return field, nil
+}
+
+func (p *queryParser) comparison() (queryNode, error) {
+	field, err := p.field()
+	if err != nil {
+		return nil, err
+	}
+	op := strings.ToLower(p.next())
+	switch op {
+	case "exists":
+		return queryCmp{field: field, op: op}, nil
+	case "in":
+		if p.next() != "(" {
+			return nil, fmt.Errorf("in takes a list: %s in (a, b)", strings.Join(field, "."))
+		}
+		var values []string
+		for {
+			v, err := p.literal()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+			if sep := p.next(); sep == ")" {
+				break
+			} else if sep != "," {
+				return nil, fmt.Errorf("expected , or ) in the list of %s", strings.Join(field, "."))
+			}
+		}
+		return queryCmp{field: field, op: op, values: values}, nil
+	case "=", "!=", "<", "<=", ">", ">=", "~":
+		v, err := p.literal()
+		if err != nil {
+			return nil, err
+		}
+		return queryCmp{field: field, op: op, values: []string{v}}, nil
+	}
+	return nil, fmt.Errorf("operator expected after %s, got %q (use =, !=, <, <=, >, >=, ~, in or exists)", strings.Join(field, "."), op)
+}
+
+// parseQuery parses a whole query.
+func parseQuery(s string) (*parsedQuery, error) {
+	tokens, err := tokenizeQuery(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{tokens: tokens}
+	q := &parsedQuery{entity: strings.ToLower(p.next())}
+	if queryEntities[q.entity] == "" {
+		return nil, fmt.Errorf("query must start with vulnerabilities or assets, not %q", q.entity)
+	}
+	if p.keyword("where") {
+		if q.where, err = p.orExpr(); err != nil {
+			return nil, err
+		}
+	}
+	if p.keyword("order") {
+		if !p.keyword("by") {
+			return nil, fmt.Errorf("order must be followed by by")
+		}
+		if q.orderBy, err = p.field(); err != nil {
+			return nil, err
+		}
+		if p.keyword("desc") {
+			q.desc = true
+		} else {
+			p.keyword("asc")
+		}
+	}
+	if p.keyword("limit") {
+		if q.limit, err = strconv.Atoi(p.next()); err != nil || q.limit < 0 {
+			return nil, fmt.Errorf("limit takes a number")
+		}
+	}
+	if t := p.peek(); t != "" {
+		return nil, fmt.Errorf("unexpected %q", strings.TrimPrefix(t, "\x00"))
+	}
+	q.fields = p.fields
+	return q, nil
+}
+
+// needs reports whether a field of the query starts with prefix.
+func (q *parsedQuery) needs(prefix string) bool {
+	for _, f := range q.fields {
+		if strings.EqualFold(f[0], prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// runQuery fetches the lists the query joins and returns the matching
+// records of its entity.
+func runQuery(client *McpClient, q *parsedQuery, now time.Time) ([]map[string]interface{}, error) {
+	env := &queryEnv{entity: q.entity, now: now}
+	records, err := listAll(client, queryEntities[q.entity], q.entity, map[string]interface{}{}, 500)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case q.entity == "vulnerabilities" && q.needs("asset"):
+		if env.assets, err = assetsByID(client); err != nil {
+			return nil, err
+		}
+	case q.entity == "assets" && q.needs("open"):
+		findings, err := listAll(client, "get_vulnerabilities", "vulnerabilities", map[string]interface{}{}, 500)
+		if err != nil {
+			return nil, err
+		}
+		env.open = map[int64]map[string]int{}
+		for _, f := range findings {
+			id := findingAssetID(f)
+			if env.open[id] == nil {
+				env.open[id] = map[string]int{}
+			}
+			env.open[id]["total"]++
+			env.open[id][strings.ToLower(stringField(f, "cvssSeverity"))]++
+			if isOverdue(f) {
+				env.open[id]["overdue"]++
+			}
+		}
+	}
+
+	matched := []map[string]interface{}{}
+	for _, rec := range records {
+		if q.where == nil || q.where.eval(env, rec) {
+			matched = append(matched, rec)
+		}
+	}
+	if q.orderBy != nil {
+		sort.SliceStable(matched, func(i, j int) bool {
+			a, b := fmt.Sprint(env.value(matched[i], q.orderBy)), fmt.Sprint(env.value(matched[j], q.orderBy))
+			if q.desc {
+				a, b = b, a
+			}
+			return compareQueryValue(a, "<", b, now)
+		})
+	}
+	if q.limit > 0 && len(matched) > q.limit {
+		matched = matched[:q.limit]
+	}
+	// Joined fields the query used are shown with the records.
+	if q.entity == "vulnerabilities" && env.assets != nil {
+		for _, f := range matched {
+			if a := env.assets[findingAssetID(f)]; a != nil {
+				f["asset"] = a
+			}
+		}
+	}
+	return matched, nil
+}
+
+func cmdQuery(client *McpClient, osArgs []string) {
+	fs := flag.NewFlagSet("query", flag.ContinueOnError)
+	fieldsFlag := fs.String("fields", "", "Print only these comma-separated fields, e.g. cve,severity,asset.name,asset.owner")
+	words := parseInterspersed(fs, osArgs)
+	if len(words) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: query required")
+		fmt.Fprintf(os.Stderr, "Usage: %s query 'vulnerabilities where asset.tag.pci = true and asset.owner = team-x' [--fields a,b]\n", progName())
+		exit(ExitUsage)
+	}
+	q, err := parseQuery(strings.Join(words, " "))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: query: %v\n", err)
+		exit(ExitUsage)
+	}
+	var fields [][]string
+	for _, f := range splitList(*fieldsFlag) {
+		fields = append(fields, strings.Split(f, "."))
+		q.fields = append(q.fields, strings.Split(f, "."))
+	}
+
+	now := time.Now()
+	matched, err := runQuery(client, q, now)
+	if err != nil {
+		fatal(err)
+	}
+	if fields != nil {
+		projectQueryFields(q, matched, fields, now)
+	}
+	printResult(map[string]interface{}{q.entity: matched, "totalElements": len(matched)})
+}
+
+// projectQueryFields replaces each matched record with just the fields,
+// keyed by their dotted names.
+func projectQueryFields(q *parsedQuery, matched []map[string]interface{}, fields [][]string, now time.Time) {
+	env := &queryEnv{entity: q.entity, now: now}
+	for i, rec := range matched {
+		row := make(map[string]interface{}, len(fields))
+		for _, f := range fields {
+			if q.entity == "vulnerabilities" && strings.EqualFold(f[0], "asset") && len(f) > 1 {
+				asset, _ := rec["asset"].(map[string]interface{})
+				row[strings.Join(f, ".")] = env.assetValue(asset, f[1:])
+				continue
+			}
+			row[strings.Join(f, ".")] = env.value(rec, f)
+		}
+		matched[i] = row
+	}
+}
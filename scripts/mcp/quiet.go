@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// quiet, set by the global -q/--quiet flag, is for cron jobs and scripts:
+// status messages, banners, progress and warnings are dropped, and commands
+// that change something print only the essential value (a created ID, a
+// count or a written path). Data requested from the server is still
+// printed, and errors still go to stderr. The exit code tells the rest.
+var quiet bool
+
+// status prints a human-oriented status line. Under --quiet it prints only
+// essential on a line of its own, or nothing when essential is nil.
+func status(essential interface{}, format string, args ...interface{}) {
+	if !quiet {
+		pauseProgress(func() { fmt.Printf(format, args...) })
+		return
+	}
+	if essential != nil {
+		fmt.Println(essential)
+	}
+}
+
+// warnf prints a redacted warning to stderr unless --quiet is set. Use it
+// for notices that do not change the outcome; failures that affect the
+// exit code are always printed.
+func warnf(format string, args ...interface{}) {
+	if !quiet {
+		pauseProgress(func() { fmt.Fprint(os.Stderr, redactString(fmt.Sprintf(format, args...))) })
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+)
+
+// Read-only mode refuses every tool call that could change records,
+// whichever command, shell, LLM host or script makes it, so auditors and
+// dashboards can be handed a configuration that cannot write. Only known
+// read tools are let through: those whose verb is in readToolPrefixes and
+// that neither carry a write verb (see mutatingToolPrefixes) nor match
+// SECMAN_MUTATING_TOOLS. A tool with an unfamiliar verb is refused until
+// it is known to be safe.
+//
+// It is on with --read-only, SECMAN_READ_ONLY=true or read_only = true in
+// a profile. Built with -tags readonly, the client is read-only whatever
+// the settings say.
+
+// readToolPrefixes are the verbs of the tools read-only mode keeps. The
+// list is explicit rather than "everything not mutating", so a new tool
+// with an unfamiliar verb stays refused until it is known to be safe.
+var readToolPrefixes = []string{
+	"get_", "list_", "search_", "find_", "query_", "count_", "describe_", "lookup_",
+	"export_", "compare_",
+}
+
+// isReadTool reports whether read-only mode lets a tool through.
+func isReadTool(name string) bool {
+	return hasAnyPrefix(name, readToolPrefixes) && !isMutatingTool(name)
+}
+
+// ReadOnlyError is returned for a tool call or plugin that read-only mode
+// refused.
+type ReadOnlyError struct {
+	Tool   string
+	Plugin string
+}
+
+func (e *ReadOnlyError) Error() string {
+	if e.Plugin != "" {
+		return fmt.Sprintf("plugin %s could change records and the client is read-only", e.Plugin)
+	}
+	return fmt.Sprintf("%s is not a known read tool and the client is read-only", e.Tool)
+}
+
+// extraMutatingTools are the SECMAN_MUTATING_TOOLS names and patterns.
+var extraMutatingTools []string
+
+// loadMutationSettings reads SECMAN_MUTATING_TOOLS and reports whether the
+// client is read-only.
+func loadMutationSettings() (bool, error) {
+	for _, pattern := range splitList(setting("SECMAN_MUTATING_TOOLS")) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return false, fmt.Errorf("SECMAN_MUTATING_TOOLS: bad tool pattern %q: %w", pattern, err)
+		}
+		extraMutatingTools = append(extraMutatingTools, pattern)
+	}
+	if buildReadOnly {
+		return true, nil
+	}
+	v := setting("SECMAN_READ_ONLY")
+	if v == "" {
+		return false, nil
+	}
+	readOnly, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("SECMAN_READ_ONLY: %q is not true or false", v)
+	}
+	return readOnly, nil
+}
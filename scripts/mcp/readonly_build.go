@@ -0,0 +1,7 @@
+//go:build readonly
+
+package main
+
+// buildReadOnly makes this build refuse every tool call that changes
+// records, regardless of --read-only and SECMAN_READ_ONLY.
+const buildReadOnly = true
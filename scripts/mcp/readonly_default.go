@@ -0,0 +1,6 @@
+//go:build !readonly
+
+package main
+
+// buildReadOnly is false: read-only mode follows the settings.
+const buildReadOnly = false
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/schmalle/secman/scripts/mcp/secman"
+)
+
+// Everything the client prints that did not come from the user's own
+// output request — errors, warnings, dry-run listings, --debug dumps and
+// audit log entries — passes through this redaction layer first, so
+// verbose output in CI logs does not leak credentials. It removes:
+//
+//   - secrets the client knows: the API key, the anonymization key and the
+//     values of credential headers
+//   - values of fields and headers whose names look like credentials
+//     (password, secret, token, apiKey, authorization, ...)
+//   - bearer tokens and sk- style API keys anywhere in text
+
+const redacted = "[REDACTED]"
+
+var (
+	secretsMu    sync.RWMutex
+	knownSecrets []string
+)
+
+// registerSecret adds a value that is replaced wherever it appears in
+// redacted text. Values shorter than 6 characters are ignored because they
+// would mangle unrelated text.
+func registerSecret(s string) {
+	s = strings.TrimSpace(s)
+	if len(s) < 6 {
+		return
+	}
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	for _, k := range knownSecrets {
+		if k == s {
+			return
+		}
+	}
+	knownSecrets = append(knownSecrets, s)
+}
+
+// sensitiveNames are matched against field and header names with case,
+// "-" and "_" ignored.
+var sensitiveNames = []string{
+	"password", "passwd", "passphrase", "secret", "token", "apikey",
+	"authorization", "credential", "privatekey", "cookie", "mcpkey",
+}
+
+func sensitiveName(name string) bool {
+	n := strings.ToLower(strings.NewReplacer("-", "", "_", "").Replace(name))
+	for _, s := range sensitiveNames {
+		if strings.Contains(n, s) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	bearerPattern = regexp.MustCompile(`(?i)\b(bearer|basic)\s+[A-Za-z0-9._~+/=-]{8,}`)
+	apiKeyPattern = regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{8,}`)
+	// fieldPattern matches "password": "x", password=x and password: x.
+	fieldPattern = regexp.MustCompile(`(?i)("?[A-Za-z0-9_-]*(?:password|passwd|passphrase|secret|token|api[_-]?key|authorization|credential|private[_-]?key)[A-Za-z0-9_-]*"?\s*[:=]\s*)("[^"]*"|[^\s,;&}"]+)`)
+)
+
+// redactString removes secrets from free text such as error messages and
+// response bodies.
+func redactString(s string) string {
+	secretsMu.RLock()
+	for _, k := range knownSecrets {
+		s = strings.ReplaceAll(s, k, redacted)
+	}
+	secretsMu.RUnlock()
+	s = bearerPattern.ReplaceAllString(s, "$1 "+redacted)
+	s = apiKeyPattern.ReplaceAllString(s, redacted)
+	return fieldPattern.ReplaceAllStringFunc(s, func(m string) string {
+		sub := fieldPattern.FindStringSubmatch(m)
+		switch strings.ToLower(strings.Trim(sub[2], `"`)) {
+		case strings.ToLower(redacted), "bearer", "basic":
+			return m
+		}
+		if strings.HasPrefix(sub[2], `"`) {
+			return sub[1] + `"` + redacted + `"`
+		}
+		return sub[1] + redacted
+	})
+}
+
+// redactValue returns a copy of a decoded JSON value with sensitive fields
+// replaced and strings redacted.
+func redactValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(t))
+		for k, item := range t {
+			out[k] = redactField(k, item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, item := range t {
+			out[i] = redactValue(item)
+		}
+		return out
+	case string:
+		return redactString(t)
+	}
+	return v
+}
+
+// redactField redacts the value of a named field.
+func redactField(name string, v interface{}) interface{} {
+	if v != nil && v != "" && sensitiveName(name) {
+		return redacted
+	}
+	return redactValue(v)
+}
+
+// redactJSON redacts a JSON document, falling back to text redaction when
+// it does not parse.
+func redactJSON(data []byte) string {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return redactString(string(data))
+	}
+	out, err := json.Marshal(redactValue(v))
+	if err != nil {
+		return redactString(string(data))
+	}
+	return string(out)
+}
+
+// redactHeaders returns a copy of h with credential headers masked.
+func redactHeaders(h http.Header) http.Header {
+	out := make(http.Header, len(h))
+	for name, values := range h {
+		for _, v := range values {
+			if sensitiveName(name) {
+				v = redacted
+			} else {
+				v = redactString(v)
+			}
+			out[name] = append(out[name], v)
+		}
+	}
+	return out
+}
+
+func init() {
+	secman.Redact = redactString
+	secman.RedactValue = redactValue
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+)
+
+// A Renderer writes a command's result in one output format. Commands hand
+// their result to printResult, which uses the renderer picked by the global
+// -o/--output-format flag, so every command supports every format.
+type Renderer interface {
+	Render(w io.Writer, v interface{}) error
+}
+
+// outputFormats lists the values of -o/--output-format.
+var outputFormats = []string{"json", "yaml", "table", "csv", "template", "pr-comment", "tfdata"}
+
+// renderer is the active output renderer. outputChosen is set when
+// -o/--output-format or --template was given, which makes commands with a
+// human-readable default view print their raw result instead.
+var (
+	renderer     Renderer = jsonRenderer{}
+	outputChosen bool
+)
+
+// newRenderer returns the renderer for an output format. tmpl is the
+// --template value; it is required by, and implies, the template format.
+func newRenderer(format, tmpl string) (Renderer, error) {
+	if tmpl != "" && format == "" {
+		format = "template"
+	}
+	switch format {
+	case "", "json":
+		return jsonRenderer{}, nil
+	case "yaml":
+		return yamlRenderer{}, nil
+	case "table":
+		return tableRenderer{}, nil
+	case "csv":
+		return csvRenderer{}, nil
+	case "pr-comment":
+		return prCommentRenderer{}, nil
+	case "tfdata":
+		version, err := negotiateTfdataVersion(setting("SECMAN_TFDATA_VERSION"))
+		if err != nil {
+			return nil, err
+		}
+		return tfdataRenderer{version}, nil
+	case "template":
+		if tmpl == "" {
+			return nil, fmt.Errorf("--output-format template needs --template")
+		}
+		t, err := parseOutputTemplate(tmpl)
+		if err != nil {
+			return nil, err
+		}
+		return templateRenderer{t}, nil
+	}
+	return nil, fmt.Errorf("--output-format must be one of %s", strings.Join(outputFormats, ", "))
+}
+
+// rawOutput reports whether a command with its own human-readable view
+// should print its raw result through the renderer instead.
+func rawOutput(asJSON bool) bool {
+	return asJSON || outputChosen
+}
+
+type jsonRenderer struct{}
+
+func (jsonRenderer) Render(w io.Writer, v interface{}) error {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(out))
+	return err
+}
+
+type yamlRenderer struct{}
+
+func (yamlRenderer) Render(w io.Writer, v interface{}) error {
+	data, err := normalize(v)
+	if err != nil {
+		return err
+	}
+	return writeYAML(w, data)
+}
+
+type templateRenderer struct {
+	tmpl *template.Template
+}
+
+func (r templateRenderer) Render(w io.Writer, v interface{}) error {
+	data, err := normalize(v)
+	if err != nil {
+		return err
+	}
+	return r.tmpl.Execute(w, data)
+}
+
+// tableRenderer prints the result's main list as aligned columns, or a
+// single object as KEY/VALUE rows. Nested values are shown as truncated
+// JSON.
+type tableRenderer struct{}
+
+func (tableRenderer) Render(w io.Writer, v interface{}) error {
+	columns, rows, err := tabulate(v)
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		_, err := fmt.Fprintln(w, "(no results)")
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	header := make([]string, len(columns))
+	for i, c := range columns {
+		header[i] = strings.ToUpper(c)
+	}
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			cells[i] = truncate(strings.ReplaceAll(cell, "\t", " "), 60)
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	return tw.Flush()
+}
+
+// csvRenderer writes the same rows as tableRenderer as CSV, untruncated.
+type csvRenderer struct{}
+
+func (csvRenderer) Render(w io.Writer, v interface{}) error {
+	columns, rows, err := tabulate(v)
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	if len(rows) > 0 {
+		cw.Write(columns)
+	}
+	for _, row := range rows {
+		cw.Write(row)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// normalize converts v to the shapes encoding/json decodes into.
+func normalize(v interface{}) (interface{}, error) {
+	var data interface{}
+	err := remarshal(v, &data)
+	return data, err
+}
+
+// tabulate turns a result into columns and rows. A tool result is replaced
+// by its content; a list of objects, or the longest such list in an object
+// (assets, vulnerabilities, ...), becomes one row per item. Any other
+// object becomes KEY/VALUE rows.
+func tabulate(v interface{}) ([]string, [][]string, error) {
+	data, err := normalize(v)
+	if err != nil {
+		return nil, nil, err
+	}
+	if m, ok := data.(map[string]interface{}); ok {
+		if content, ok := m["content"]; ok {
+			if _, isResult := m["isError"]; isResult {
+				data = content
+			}
+		}
+	}
+
+	var list []interface{}
+	switch d := data.(type) {
+	case []interface{}:
+		list = d
+	case map[string]interface{}:
+		for _, k := range objectKeys(d) {
+			if l, ok := d[k].([]interface{}); ok && len(l) > len(list) && isObjectList(l) {
+				list = l
+			}
+		}
+		if list == nil {
+			var rows [][]string
+			for _, k := range objectKeys(d) {
+				rows = append(rows, []string{k, cellText(d[k])})
+			}
+			return []string{"key", "value"}, rows, nil
+		}
+	default:
+		return []string{"value"}, [][]string{{cellText(data)}}, nil
+	}
+
+	if !isObjectList(list) {
+		rows := make([][]string, len(list))
+		for i, item := range list {
+			rows[i] = []string{cellText(item)}
+		}
+		return []string{"value"}, rows, nil
+	}
+
+	seen := map[string]bool{}
+	var columns []string
+	for _, item := range list {
+		for k := range item.(map[string]interface{}) {
+			if !seen[k] {
+				seen[k] = true
+				columns = append(columns, k)
+			}
+		}
+	}
+	sortColumns(columns)
+	rows := make([][]string, len(list))
+	for i, item := range list {
+		m := item.(map[string]interface{})
+		row := make([]string, len(columns))
+		for j, c := range columns {
+			row[j] = cellText(m[c])
+		}
+		rows[i] = row
+	}
+	return columns, rows, nil
+}
+
+func isObjectList(list []interface{}) bool {
+	for _, item := range list {
+		if _, ok := item.(map[string]interface{}); !ok {
+			return false
+		}
+	}
+	return len(list) > 0
+}
+
+// sortColumns orders columns alphabetically with id and name first.
+func sortColumns(columns []string) {
+	rank := func(c string) int {
+		switch c {
+		case "id":
+			return 0
+		case "name":
+			return 1
+		}
+		return 2
+	}
+	sort.Slice(columns, func(i, j int) bool {
+		if ri, rj := rank(columns[i]), rank(columns[j]); ri != rj {
+			return ri < rj
+		}
+		return columns[i] < columns[j]
+	})
+}
+
+func objectKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func cellText(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// printResult renders v to stdout with the active renderer.
+func printResult(v interface{}) {
+	pauseProgress(func() { writeResult(v) })
+}
+
+func writeResult(v interface{}) {
+	if err := renderer.Render(os.Stdout, v); err != nil {
+		fmt.Fprintf(os.Stderr, "Error formatting output: %v\n", err)
+		exit(ExitUsage)
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"strconv"
+)
+
+// Server-generated reports are listed with list_reports and described by
+// get_report. When the report carries a downloadUrl the file is streamed
+// over plain HTTP; otherwise it is fetched through get_report_chunk.
+
+func cmdReport(client *McpClient, osArgs []string) {
+	if len(osArgs) < 1 {
+		fmt.Fprintln(os.Stderr, "Error: report subcommand required")
+		fmt.Fprintf(os.Stderr, "Usage: %s report <list|download|risk-ranking|send|applicability-gaps|compliance|trend> ...\n", progName())
+		exit(ExitUsage)
+	}
+
+	switch osArgs[0] {
+	case "list":
+		cmdReportList(client, osArgs[1:])
+	case "download":
+		cmdReportDownload(client, osArgs[1:])
+	case "risk-ranking":
+		cmdReportRiskRanking(client, osArgs[1:])
+	case "send":
+		cmdReportSend(client, osArgs[1:])
+	case "applicability-gaps":
+		cmdReportApplicabilityGaps(client, osArgs[1:])
+	case "compliance":
+		cmdReportCompliance(client, osArgs[1:])
+	case "trend":
+		cmdReportTrend(osArgs[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown report subcommand: %s\n", osArgs[0])
+		exit(ExitUsage)
+	}
+}
+
+func cmdReportList(client *McpClient, osArgs []string) {
+	fs := flag.NewFlagSet("report list", flag.ContinueOnError)
+	reportType := fs.String("type", "", "Filter by report type")
+	asJSON := fs.Bool("json", false, "Print the raw tool result as JSON")
+	parseFlags(fs, osArgs)
+
+	if err := client.requireTool("list_reports"); err != nil {
+		fatal(err)
+	}
+
+	args := map[string]interface{}{}
+	if *reportType != "" {
+		args["type"] = *reportType
+	}
+
+	content, err := client.callToolMap("list_reports", args)
+	if err != nil {
+		fatal(err)
+	}
+	if rawOutput(*asJSON) {
+		printResult(content)
+		return
+	}
+
+	reports, _ := content["reports"].([]interface{})
+	fmt.Printf("%-8s %-20s %-40s %12s  %s\n", "ID", "TYPE", "NAME", "SIZE", "CREATED")
+	for _, item := range reports {
+		r, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		size, _ := r["size"].(float64)
+		fmt.Printf("%-8v %-20v %-40v %12d  %v\n", r["id"], r["type"], r["name"], int64(size), r["createdAt"])
+	}
+}
+
+func cmdReportDownload(client *McpClient, osArgs []string) {
+	if len(osArgs) < 1 {
+		fmt.Fprintln(os.Stderr, "Error: report id required")
+		fmt.Fprintf(os.Stderr, "Usage: %s report download <id> [--output-dir dir] [--output name] [--no-verify]\n", progName())
+		exit(ExitUsage)
+	}
+
+	reportID, err := strconv.ParseInt(osArgs[0], 10, 64)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid report id: %v\n", err)
+		exit(ExitUsage)
+	}
+
+	fs := flag.NewFlagSet("report download", flag.ContinueOnError)
+	outputDir := fs.String("output-dir", ".", "Directory to write the report into")
+	output := fs.String("output", "", "File name (default: the report's file name)")
+	chunkSize := fs.Int("chunk-size", defaultEvidenceChunkSize, "Chunk size in bytes when streaming is unavailable")
+	noVerify := fs.Bool("no-verify", false, "Save the report even when the server gives no checksum for it")
+	anonymize := fs.Bool("anonymize", false, "Pseudonymize hostnames, IPs, emails and owners (text formats only)")
+	sign := addSignFlag(fs)
+	dest := addDestinationFlags(fs)
+	parseFlags(fs, osArgs[1:])
+
+	path, verified, err := downloadReport(client, reportID, *outputDir, *output, *chunkSize, !*noVerify)
+	if err != nil {
+		fatal(err)
+	}
+
+	if *anonymize {
+		anon, err := newAnonymizer()
+		if err == nil {
+			err = anon.learnAssets(client)
+		}
+		if err == nil {
+			err = anonymizeFile(path, anon)
+		}
+		if err != nil {
+			fatal(err)
+		}
+		signOutput(client, path, *sign)
+		uploadOutput(client, path, *sign != "", dest)
+		status(path, "Saved anonymized report %d to %s\n", reportID, path)
+		return
+	}
+
+	signOutput(client, path, *sign)
+	uploadOutput(client, path, *sign != "", dest)
+	if verified {
+		status(path, "Saved report %d to %s (checksum verified)\n", reportID, path)
+	} else {
+		status(path, "Saved report %d to %s (not verified: the server gave no checksum)\n", reportID, path)
+	}
+}
+
+// downloadReport saves a report and reports whether its checksum was
+// compared. With verify, a report the server gives no checksum for, in
+// get_report or with the download, is refused.
+func downloadReport(client *McpClient, reportID int64, dir, name string, chunkSize int, verify bool) (string, bool, error) {
+	if err := client.requireTool("get_report"); err != nil {
+		return "", false, err
+	}
+
+	meta, err := client.callToolMap("get_report", map[string]interface{}{"reportId": reportID})
+	if err != nil {
+		return "", false, err
+	}
+
+	fileName, _ := meta["fileName"].(string)
+	if fileName == "" {
+		fileName = fmt.Sprintf("report-%d", reportID)
+	}
+	checksum, _ := meta["sha256"].(string)
+
+	path, err := downloadVerified(dir, name, func(w io.Writer) (string, string, error) {
+		if url, _ := meta["downloadUrl"].(string); url != "" {
+			header, err := client.Download(url, w)
+			if err != nil {
+				return "", "", err
+			}
+			if checksum == "" {
+				checksum = header.Get("X-Checksum-SHA256")
+			}
+			if _, params, err := mime.ParseMediaType(header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+				fileName = params["filename"]
+			}
+		} else {
+			chunkMeta, err := chunkedDownload(client, "get_report_chunk", map[string]interface{}{
+				"reportId": reportID,
+			}, chunkSize, w)
+			if err != nil {
+				return "", "", err
+			}
+			if checksum == "" {
+				checksum, _ = chunkMeta["sha256"].(string)
+			}
+		}
+		if checksum == "" && verify {
+			return "", "", fmt.Errorf("report %d: the server gave no checksum, so the download cannot be verified (--no-verify saves it unchecked)", reportID)
+		}
+		return fileName, checksum, nil
+	})
+	return path, err == nil && checksum != "", err
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDownloadReportChecksum(t *testing.T) {
+	body := []byte("%PDF-1.7 quarterly risk report")
+	sum := sha256.Sum256(body)
+	good := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name         string
+		header       string
+		verify       bool
+		wantErr      bool
+		wantVerified bool
+	}{
+		{"checksum matches", good, true, false, true},
+		{"checksum differs", hex.EncodeToString(make([]byte, 32)), true, true, false},
+		{"no checksum", "", true, true, false},
+		{"no checksum, --no-verify", "", false, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newFakeServer(t, map[string]fakeTool{
+				"get_report": func(map[string]interface{}) (interface{}, error) {
+					return map[string]interface{}{"fileName": "risk.pdf", "downloadUrl": "/reports/5/file"}, nil
+				},
+			})
+			srv.routes["/reports/5/file"] = func(w http.ResponseWriter, r *http.Request) {
+				if tt.header != "" {
+					w.Header().Set("X-Checksum-SHA256", tt.header)
+				}
+				w.Write(body)
+			}
+
+			dir := t.TempDir()
+			path, verified, err := downloadReport(srv.client(), 5, dir, "", defaultEvidenceChunkSize, tt.verify)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("downloadReport error = %v, want error %t", err, tt.wantErr)
+			}
+			if verified != tt.wantVerified {
+				t.Errorf("verified = %t, want %t", verified, tt.wantVerified)
+			}
+			if err != nil {
+				if _, statErr := os.Stat(filepath.Join(dir, "risk.pdf")); statErr == nil {
+					t.Errorf("refused download left risk.pdf behind")
+				}
+				return
+			}
+			if data, _ := os.ReadFile(path); string(data) != string(body) {
+				t.Errorf("saved %q, want %q", data, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+func cmdRequirement(client *McpClient, osArgs []string) {
+	if len(osArgs) < 1 {
+		fmt.Fprintln(os.Stderr, "Error: requirement subcommand required")
+		fmt.Fprintf(os.Stderr, "Usage: %s requirement <export|update|applicability> ...\n", progName())
+		exit(ExitUsage)
+	}
+
+	switch osArgs[0] {
+	case "export":
+		cmdRequirementExport(client, osArgs[1:])
+	case "update":
+		cmdRequirementUpdate(client, osArgs[1:])
+	case "applicability":
+		cmdRequirementApplicability(client, osArgs[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown requirement subcommand: %s\n", osArgs[0])
+		exit(ExitUsage)
+	}
+}
+
+// listRequirements fetches every requirement matching the filter using the
+// offset/limit paging of get_requirements.
+func listRequirements(client *McpClient, filter map[string]interface{}) ([]map[string]interface{}, error) {
+	var all []map[string]interface{}
+	for offset := 0; ; {
+		args := map[string]interface{}{"limit": 100, "offset": offset}
+		for k, v := range filter {
+			args[k] = v
+		}
+		content, err := client.callToolMap("get_requirements", args)
+		if err != nil {
+			return nil, err
+		}
+		items, _ := content["requirements"].([]interface{})
+		for _, item := range items {
+			if r, ok := item.(map[string]interface{}); ok {
+				all = append(all, r)
+			}
+		}
+		offset += len(items)
+		if hasMore, _ := content["hasMore"].(bool); !hasMore || len(items) == 0 {
+			return all, nil
+		}
+	}
+}
+
+func cmdRequirementExport(client *McpClient, osArgs []string) {
+	fs := flag.NewFlagSet("requirement export", flag.ContinueOnError)
+	format := fs.String("format", "xlsx", "Export format: xlsx or docx")
+	norm := fs.String("norm", "", "Only export requirements mapped to this norm")
+	usecase := fs.String("usecase", "", "Only export requirements for this use case")
+	template := fs.String("template", "", "Server-side export template name")
+	outputDir := fs.String("output-dir", ".", "Directory to write the export into")
+	output := fs.String("output", "", "File name (default: the server's file name)")
+	sign := addSignFlag(fs)
+	dest := addDestinationFlags(fs)
+	parseFlags(fs, osArgs)
+
+	if *format != "xlsx" && *format != "docx" {
+		fmt.Fprintf(os.Stderr, "Error: --format must be xlsx or docx, got %q\n", *format)
+		exit(ExitUsage)
+	}
+
+	args := map[string]interface{}{"format": *format}
+	// Filters are only sent when the server's export_requirements schema
+	// declares them; silently exporting everything would be worse than failing.
+	for _, opt := range []struct{ flag, property, value string }{
+		{"--norm", "norm", *norm},
+		{"--usecase", "usecase", *usecase},
+		{"--template", "template", *template},
+	} {
+		if opt.value == "" {
+			continue
+		}
+		ok, err := client.toolAccepts("export_requirements", opt.property)
+		if err != nil {
+			fatal(err)
+		}
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Error: this server's export_requirements does not support %s\n", opt.flag)
+			exit(ExitUsage)
+		}
+		args[opt.property] = opt.value
+	}
+
+	content, err := client.callToolMap("export_requirements", args)
+	if err != nil {
+		fatal(err)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(stringField(content, "data"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: decode export: %v\n", err)
+		exit(ExitUsage)
+	}
+	if size := int(numberField(content, "fileSizeBytes")); size > 0 && size != len(data) {
+		fmt.Fprintf(os.Stderr, "Error: export truncated: expected %d bytes, got %d\n", size, len(data))
+		exit(ExitUsage)
+	}
+
+	path, err := downloadVerified(*outputDir, *output, func(w io.Writer) (string, string, error) {
+		if _, err := w.Write(data); err != nil {
+			return "", "", err
+		}
+		name := stringField(content, "filename")
+		if name == "" {
+			name = "requirements_export." + *format
+		}
+		return name, "", nil
+	})
+	if err != nil {
+		fatal(err)
+	}
+
+	signOutput(client, path, *sign)
+	uploadOutput(client, path, *sign != "", dest)
+	status(path, "Exported %d requirement(s) to %s\n", int(numberField(content, "requirementCount")), path)
+}
@@ -0,0 +1,468 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Risk scoring ranks findings by more than their CVSS severity. Each
+// finding gets a score from 0 to 100, the weighted mean of five factors
+// between 0 and 1:
+//
+//	cvss         severity: Critical 1, High 0.75, Medium 0.5, Low 0.25
+//	epss         exploitation probability from FIRST's EPSS feed
+//	kev          1 when the CVE is in CISA's Known Exploited Vulnerabilities catalog
+//	criticality  the asset's criticality; unset counts as MEDIUM
+//	exposure     the asset's network zone: EXTERNAL 1, DMZ 0.7, INTERNAL 0.3, unknown 0.5
+//
+// The weights are set with --weights or SECMAN_RISK_WEIGHTS as
+// name=weight pairs; factors not named keep their default weight. A feed
+// that cannot be reached, or every feed under --offline, is left out and
+// the remaining weights are rescaled, so scores stay comparable within a run.
+
+var riskFactors = []string{"cvss", "epss", "kev", "criticality", "exposure"}
+
+var defaultRiskWeights = map[string]float64{
+	"cvss":        0.35,
+	"epss":        0.25,
+	"kev":         0.2,
+	"criticality": 0.1,
+	"exposure":    0.1,
+}
+
+const (
+	epssURL = "https://api.first.org/data/v1/epss"
+	kevURL  = "https://www.cisa.gov/sites/default/files/feeds/known_exploited_vulnerabilities.json"
+	// epssBatch is the number of CVEs per EPSS request, to keep URLs short.
+	epssBatch = 100
+)
+
+// parseRiskWeights applies name=weight pairs to the default weights.
+func parseRiskWeights(spec string) (map[string]float64, error) {
+	weights := make(map[string]float64, len(defaultRiskWeights))
+	for name, w := range defaultRiskWeights {
+		weights[name] = w
+	}
+	for _, pair := range splitList(spec) {
+		name, value, ok := strings.Cut(pair, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, known := defaultRiskWeights[name]; !ok || !known {
+			return nil, fmt.Errorf("invalid risk weight %q (use name=weight with names %s)", pair, strings.Join(riskFactors, ", "))
+		}
+		w, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || w < 0 {
+			return nil, fmt.Errorf("invalid risk weight %q: weight must be a number >= 0", pair)
+		}
+		weights[name] = w
+	}
+	total := 0.0
+	for _, w := range weights {
+		total += w
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("risk weights are all zero")
+	}
+	return weights, nil
+}
+
+func weightsText(weights map[string]float64) string {
+	parts := make([]string, 0, len(riskFactors))
+	for _, name := range riskFactors {
+		parts = append(parts, fmt.Sprintf("%s %.2f", name, weights[name]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// riskOptions are the flags shared by the commands that score findings.
+type riskOptions struct {
+	weights *string
+	offline *bool
+}
+
+func addRiskFlags(fs *flag.FlagSet) *riskOptions {
+	return &riskOptions{
+		weights: fs.String("weights", setting("SECMAN_RISK_WEIGHTS"), "Risk weights as name=weight,... (cvss, epss, kev, criticality, exposure)"),
+		offline: fs.Bool("offline", false, "Skip the EPSS and KEV feeds"),
+	}
+}
+
+type riskScorer struct {
+	weights map[string]float64
+	epss    map[string]float64 // nil when the feed is not used
+	kev     map[string]bool    // nil when the feed is not used
+	assets  map[int64]map[string]interface{}
+}
+
+// newRiskScorer loads what scoring the findings needs: the feeds for their
+// CVEs and, when the asset factors are weighted, the asset inventory.
+func newRiskScorer(client *McpClient, findings []map[string]interface{}, opts *riskOptions) (*riskScorer, error) {
+	weights, err := parseRiskWeights(*opts.weights)
+	if err != nil {
+		return nil, err
+	}
+	s := &riskScorer{weights: weights}
+
+	cves := findingCVEs(findings)
+	if !*opts.offline && weights["epss"] > 0 && len(cves) > 0 {
+		if s.epss, err = fetchEPSS(cves); err != nil {
+			warnf("Warning: EPSS feed unavailable, scoring without it: %v\n", err)
+		}
+	}
+	if !*opts.offline && weights["kev"] > 0 && len(cves) > 0 {
+		if s.kev, err = fetchKEV(); err != nil {
+			warnf("Warning: KEV catalog unavailable, scoring without it: %v\n", err)
+		}
+	}
+	if weights["criticality"] > 0 || weights["exposure"] > 0 {
+		assets, err := listAll(client, "get_assets", "assets", map[string]interface{}{}, 500)
+		if err != nil {
+			return nil, err
+		}
+		s.assets = make(map[int64]map[string]interface{}, len(assets))
+		for _, a := range assets {
+			s.assets[int64(numberField(a, "id"))] = a
+		}
+	}
+	return s, nil
+}
+
+// findingCVEs returns the distinct CVE ids of the findings, sorted.
+func findingCVEs(findings []map[string]interface{}) []string {
+	seen := map[string]bool{}
+	var cves []string
+	for _, f := range findings {
+		cve := strings.ToUpper(stringField(f, "vulnerabilityId"))
+		if cvePattern.MatchString(cve) && !seen[cve] {
+			seen[cve] = true
+			cves = append(cves, cve)
+		}
+	}
+	sort.Strings(cves)
+	return cves
+}
+
+// findingAssetID reads the asset id of a get_vulnerabilities item or of a
+// detail item with a nested asset.
+func findingAssetID(f map[string]interface{}) int64 {
+	if asset, ok := f["asset"].(map[string]interface{}); ok {
+		return int64(numberField(asset, "id"))
+	}
+	return int64(numberField(f, "assetId"))
+}
+
+// factors returns the value of every available factor for a finding.
+func (s *riskScorer) factors(f map[string]interface{}) map[string]float64 {
+	factors := map[string]float64{"cvss": severityFactor(stringField(f, "cvssSeverity"))}
+	cve := strings.ToUpper(stringField(f, "vulnerabilityId"))
+	if s.epss != nil {
+		factors["epss"] = s.epss[cve]
+	}
+	if s.kev != nil {
+		factors["kev"] = 0
+		if s.kev[cve] {
+			factors["kev"] = 1
+		}
+	}
+	if s.assets != nil {
+		asset := s.assets[findingAssetID(f)]
+		factors["criticality"] = criticalityFactor(stringField(asset, "criticality"))
+		factors["exposure"] = exposureFactor(stringField(asset, "networkZone"))
+	}
+	return factors
+}
+
+// score returns the finding's risk score, rounded to one decimal.
+func (s *riskScorer) score(factors map[string]float64) float64 {
+	var sum, total float64
+	for name, v := range factors {
+		sum += s.weights[name] * v
+		total += s.weights[name]
+	}
+	if total == 0 {
+		return 0
+	}
+	return math.Round(1000*sum/total) / 10
+}
+
+// rank sets riskScore on every finding, and riskFactors when withFactors
+// is set, and sorts them from highest to lowest score.
+func (s *riskScorer) rank(findings []map[string]interface{}, withFactors bool) {
+	for _, f := range findings {
+		factors := s.factors(f)
+		f["riskScore"] = s.score(factors)
+		if withFactors {
+			f["riskFactors"] = factors
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		return numberField(findings[i], "riskScore") > numberField(findings[j], "riskScore")
+	})
+}
+
+func severityFactor(severity string) float64 {
+	switch strings.ToUpper(severity) {
+	case "CRITICAL":
+		return 1
+	case "HIGH":
+		return 0.75
+	case "MEDIUM":
+		return 0.5
+	case "LOW":
+		return 0.25
+	}
+	return 0
+}
+
+func criticalityFactor(criticality string) float64 {
+	switch strings.ToUpper(criticality) {
+	case "CRITICAL":
+		return 1
+	case "HIGH":
+		return 0.75
+	case "LOW":
+		return 0.25
+	}
+	return 0.5
+}
+
+func exposureFactor(zone string) float64 {
+	switch strings.ToUpper(zone) {
+	case "EXTERNAL":
+		return 1
+	case "DMZ":
+		return 0.7
+	case "INTERNAL":
+		return 0.3
+	}
+	return 0.5
+}
+
+// fetchEPSS returns the EPSS probability per CVE. SECMAN_EPSS_URL points
+// at a mirror for hosts without internet access.
+func fetchEPSS(cves []string) (map[string]float64, error) {
+	scores := make(map[string]float64, len(cves))
+	for start := 0; start < len(cves); start += epssBatch {
+		end := min(start+epssBatch, len(cves))
+		var page struct {
+			Data []map[string]interface{} `json:"data"`
+		}
+		u := settingOr("SECMAN_EPSS_URL", epssURL) + "?cve=" + url.QueryEscape(strings.Join(cves[start:end], ","))
+		if err := fetchFeed(u, &page); err != nil {
+			return nil, err
+		}
+		for _, d := range page.Data {
+			scores[strings.ToUpper(stringField(d, "cve"))] = numberField(d, "epss")
+		}
+	}
+	return scores, nil
+}
+
+// fetchKEV returns the CVEs in CISA's KEV catalog.
+func fetchKEV() (map[string]bool, error) {
+	dates, err := fetchKEVDates()
+	if err != nil {
+		return nil, err
+	}
+	kev := make(map[string]bool, len(dates))
+	for cve := range dates {
+		kev[cve] = true
+	}
+	return kev, nil
+}
+
+// fetchKEVDates returns the date (YYYY-MM-DD) each CVE was added to CISA's
+// KEV catalog. SECMAN_KEV_URL points at a mirror for hosts without
+// internet access.
+func fetchKEVDates() (map[string]string, error) {
+	var catalog struct {
+		Vulnerabilities []struct {
+			CVE       string `json:"cveID"`
+			DateAdded string `json:"dateAdded"`
+		} `json:"vulnerabilities"`
+	}
+	if err := fetchFeed(settingOr("SECMAN_KEV_URL", kevURL), &catalog); err != nil {
+		return nil, err
+	}
+	dates := make(map[string]string, len(catalog.Vulnerabilities))
+	for _, v := range catalog.Vulnerabilities {
+		dates[strings.ToUpper(v.CVE)] = v.DateAdded
+	}
+	return dates, nil
+}
+
+func fetchFeed(u string, out interface{}) error {
+	httpClient := &http.Client{Timeout: 30 * time.Second}
+	resp, err := httpClient.Get(u)
+	if err != nil {
+		return fmt.Errorf("http request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned HTTP %d", resp.Request.URL.Host, resp.StatusCode)
+	}
+	return json.Unmarshal(body, out)
+}
+
+// rankAssets groups scored findings by asset. An asset's score is that of
+// its riskiest finding; ties are broken by the number of findings.
+func rankAssets(findings []map[string]interface{}) []map[string]interface{} {
+	byAsset := map[int64]map[string]interface{}{}
+	var assets []map[string]interface{}
+	for _, f := range findings {
+		id := findingAssetID(f)
+		a := byAsset[id]
+		if a == nil {
+			name := stringField(f, "assetName")
+			if asset, ok := f["asset"].(map[string]interface{}); ok {
+				name = stringField(asset, "name")
+			}
+			// findings are sorted, so the first one is the riskiest
+			a = map[string]interface{}{
+				"assetId":   id,
+				"assetName": name,
+				"riskScore": f["riskScore"],
+				"topCve":    stringField(f, "vulnerabilityId"),
+				"findings":  0,
+			}
+			byAsset[id] = a
+			assets = append(assets, a)
+		}
+		a["findings"] = a["findings"].(int) + 1
+	}
+	sort.SliceStable(assets, func(i, j int) bool {
+		si, sj := numberField(assets[i], "riskScore"), numberField(assets[j], "riskScore")
+		if si != sj {
+			return si > sj
+		}
+		return assets[i]["findings"].(int) > assets[j]["findings"].(int)
+	})
+	return assets
+}
+
+func cmdReportRiskRanking(client *McpClient, osArgs []string) {
+	fs := flag.NewFlagSet("report risk-ranking", flag.ContinueOnError)
+	severity := fs.String("severity", "", "Only rank findings of this severity (CRITICAL, HIGH, MEDIUM, LOW)")
+	by := fs.String("by", "finding", "Rank findings or assets: finding or asset")
+	top := fs.Int("top", 25, "Number of entries to show (0 for all)")
+	asJSON := fs.Bool("json", false, "Print the ranking with each entry's factors as JSON")
+	opts := addRiskFlags(fs)
+	parseFlags(fs, osArgs)
+
+	if *by != "finding" && *by != "asset" {
+		fmt.Fprintf(os.Stderr, "Error: --by must be finding or asset, got %q\n", *by)
+		exit(ExitUsage)
+	}
+
+	args := map[string]interface{}{}
+	if *severity != "" {
+		args["severity"] = *severity
+	}
+	findings, err := listAll(client, "get_vulnerabilities", "vulnerabilities", args, 500)
+	if err != nil {
+		fatal(err)
+	}
+	scorer, err := newRiskScorer(client, findings, opts)
+	if err != nil {
+		fatal(err)
+	}
+	scorer.rank(findings, true)
+
+	rows := findings
+	if *by == "asset" {
+		rows = rankAssets(findings)
+	}
+	total := len(rows)
+	if *top > 0 && len(rows) > *top {
+		rows = rows[:*top]
+	}
+
+	if rawOutput(*asJSON) {
+		if rows == nil {
+			rows = []map[string]interface{}{}
+		}
+		printResult(map[string]interface{}{
+			"by":            *by,
+			"weights":       scorer.weights,
+			"ranking":       rows,
+			"totalElements": total,
+		})
+		return
+	}
+
+	fmt.Printf("Risk ranking of %d %s(s) (weights: %s)\n\n", total, *by, weightsText(scorer.weights))
+	if *by == "asset" {
+		fmt.Printf("  %5s  %8s  %-18s %s\n", "SCORE", "FINDINGS", "TOP CVE", "ASSET")
+		for _, a := range rows {
+			fmt.Printf("  %5.1f  %8d  %-18s %s\n", numberField(a, "riskScore"), a["findings"].(int), stringField(a, "topCve"), stringField(a, "assetName"))
+		}
+		return
+	}
+	fmt.Printf("  %5s  %-18s %-10s %6s  %-3s  %s\n", "SCORE", "CVE", "SEVERITY", "EPSS", "KEV", "ASSET")
+	for _, f := range rows {
+		factors, _ := f["riskFactors"].(map[string]float64)
+		epss, kev := "-", "-"
+		if v, ok := factors["epss"]; ok {
+			epss = fmt.Sprintf("%.3f", v)
+		}
+		if v, ok := factors["kev"]; ok {
+			kev = "no"
+			if v == 1 {
+				kev = paint(styleCritical, "yes")
+			}
+		}
+		fmt.Printf("  %5.1f  %-18s %s %6s  %-3s  %s\n", numberField(f, "riskScore"), stringField(f, "vulnerabilityId"),
+			severityCell(strings.ToUpper(stringField(f, "cvssSeverity")), 10), epss, kev, stringField(f, "assetName"))
+	}
+}
+
+// runRiskList prints one page, or with all every page, of
+// get_vulnerabilities with a riskScore on each finding, riskiest first.
+func runRiskList(client *McpClient, args map[string]interface{}, all bool, page, pageSize int, opts *riskOptions) {
+	var content map[string]interface{}
+	if all {
+		items, err := listAll(client, "get_vulnerabilities", "vulnerabilities", args, 500)
+		if err != nil {
+			fatal(err)
+		}
+		content = map[string]interface{}{"vulnerabilities": items, "totalElements": len(items)}
+	} else {
+		args["page"], args["pageSize"] = page, pageSize
+		var err error
+		if content, err = client.callToolMap("get_vulnerabilities", args); err != nil {
+			fatal(err)
+		}
+	}
+	printRiskList(client, content, opts)
+}
+
+// printRiskList scores the findings of a get_vulnerabilities result and
+// prints it sorted by risk.
+func printRiskList(client *McpClient, content map[string]interface{}, opts *riskOptions) {
+	findings := mapsField(content, "vulnerabilities")
+	scorer, err := newRiskScorer(client, findings, opts)
+	if err != nil {
+		fatal(err)
+	}
+	scorer.rank(findings, false)
+	if findings == nil {
+		findings = []map[string]interface{}{}
+	}
+	addAgeFields(findings, time.Now())
+	content["vulnerabilities"] = findings
+	printResult(content)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// The commands that keep running (watch, events publish and tail,
+// serve-stdio, serve-grafana) run their loops in a runGroup. SIGINT or
+// SIGTERM stops the group: the loops take no new work, what is in flight
+// (a poll, a publish, a tool call, an HTTP request) is given until the
+// shutdown deadline to finish, and the shutdown hooks then close sinks and
+// flush state, in reverse order of registration. A loop that fails stops
+// the group the same way. The deadline is --shutdown-timeout, or
+// SECMAN_SHUTDOWN_TIMEOUT (default 30s); a second signal ends the process
+// at once.
+
+// defaultShutdownTimeout is how long a stopping daemon waits for work in
+// flight.
+const defaultShutdownTimeout = 30 * time.Second
+
+// shutdownSignals stop a runGroup.
+var shutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+type runGroup struct {
+	ctx     context.Context
+	cancel  context.CancelCauseFunc
+	timeout time.Duration
+	wg      sync.WaitGroup
+
+	mu    sync.Mutex
+	hooks []shutdownHook
+}
+
+type shutdownHook struct {
+	name string
+	fn   func() error
+}
+
+// signalError is the cause of a group stopped by a signal.
+type signalError struct {
+	sig os.Signal
+}
+
+func (e *signalError) Error() string { return "received " + e.sig.String() }
+
+// addShutdownFlag adds --shutdown-timeout to a daemon's flags.
+func addShutdownFlag(fs *flag.FlagSet) *time.Duration {
+	timeout := defaultShutdownTimeout
+	if v := setting("SECMAN_SHUTDOWN_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			fmt.Fprintf(os.Stderr, "Error: SECMAN_SHUTDOWN_TIMEOUT must be a positive duration like 30s, not %q\n", v)
+			exit(ExitUsage)
+		}
+		timeout = d
+	}
+	return fs.Duration("shutdown-timeout", timeout, "How long a stop signal waits for work in flight (default: SECMAN_SHUTDOWN_TIMEOUT, else 30s)")
+}
+
+// newRunGroup returns a group that stops on SIGINT or SIGTERM.
+func newRunGroup(timeout time.Duration) *runGroup {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	g := &runGroup{ctx: ctx, cancel: cancel, timeout: timeout}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, shutdownSignals...)
+	go func() {
+		select {
+		case sig := <-sigs:
+			cancel(&signalError{sig: sig})
+		case <-ctx.Done():
+		}
+		// From here on a signal has its default effect.
+		signal.Stop(sigs)
+	}()
+	return g
+}
+
+// Go runs fn in the group. Its context is done once the group stops; fn
+// should then finish what it is doing and return. An error stops the group.
+// fn returns its errors instead of calling fatal: in the shell, exit
+// unwinds the command with a panic, which a goroutine cannot recover.
+func (g *runGroup) Go(fn func(ctx context.Context) error) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		if err := fn(g.ctx); err != nil {
+			g.cancel(err)
+		}
+	}()
+}
+
+// OnShutdown registers fn to run after the group's goroutines are done,
+// or the deadline has passed.
+func (g *runGroup) OnShutdown(name string, fn func() error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.hooks = append(g.hooks, shutdownHook{name: name, fn: fn})
+}
+
+// Sleep waits for d and reports whether the group is still running.
+func (g *runGroup) Sleep(d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-g.ctx.Done():
+		return false
+	}
+}
+
+// Wait returns when the goroutines are done, or after the deadline once
+// the group has stopped, and runs the shutdown hooks. It returns the error
+// that stopped the group, or the deadline passing; a signal is no error.
+func (g *runGroup) Wait() error {
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+
+	var deadlineErr error
+	select {
+	case <-done:
+	case <-g.ctx.Done():
+		var sigErr *signalError
+		if errors.As(context.Cause(g.ctx), &sigErr) {
+			status(nil, "Received %s; stopping, waiting up to %s for work in flight\n", sigErr.sig, g.timeout)
+		}
+		t := time.NewTimer(g.timeout)
+		select {
+		case <-done:
+		case <-t.C:
+			deadlineErr = fmt.Errorf("shutdown deadline of %s passed with work still in flight", g.timeout)
+		}
+		t.Stop()
+	}
+	g.cancel(nil)
+
+	g.mu.Lock()
+	hooks := g.hooks
+	g.mu.Unlock()
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if err := hooks[i].fn(); err != nil {
+			warnf("Warning: shutdown: %s: %v\n", hooks[i].name, err)
+		}
+	}
+
+	var sigErr *signalError
+	if cause := context.Cause(g.ctx); !errors.As(cause, &sigErr) && !errors.Is(cause, context.Canceled) {
+		return cause
+	}
+	return deadlineErr
+}
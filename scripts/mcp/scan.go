@@ -0,0 +1,216 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Single-scan details come from get_scan (metadata, hosts with ports and
+// the findings derived from the scan). Original artifacts are fetched with
+// get_scan_artifact_chunk, or streamed when get_scan returns artifactUrl.
+
+func cmdScan(client *McpClient, osArgs []string) {
+	if len(osArgs) < 1 {
+		fmt.Fprintln(os.Stderr, "Error: scan subcommand required")
+		fmt.Fprintf(os.Stderr, "Usage: %s scan <show|export|upload> ...\n", progName())
+		exit(ExitUsage)
+	}
+
+	switch osArgs[0] {
+	case "show":
+		cmdScanShow(client, osArgs[1:])
+	case "export":
+		cmdScanExport(client, osArgs[1:])
+	case "upload":
+		cmdScanUpload(client, osArgs[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown scan subcommand: %s\n", osArgs[0])
+		exit(ExitUsage)
+	}
+}
+
+func parseScanID(osArgs []string, usageLine string) int64 {
+	if len(osArgs) < 1 {
+		fmt.Fprintln(os.Stderr, "Error: scan id required")
+		fmt.Fprintln(os.Stderr, "Usage: "+usageLine)
+		exit(ExitUsage)
+	}
+	id, err := strconv.ParseInt(osArgs[0], 10, 64)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid scan id: %v\n", err)
+		exit(ExitUsage)
+	}
+	return id
+}
+
+func getScan(client *McpClient, scanID int64) (map[string]interface{}, error) {
+	if err := client.requireTool("get_scan"); err != nil {
+		return nil, err
+	}
+	return client.callToolMap("get_scan", map[string]interface{}{
+		"scanId":          scanID,
+		"includeHosts":    true,
+		"includeFindings": true,
+	})
+}
+
+func cmdScanShow(client *McpClient, osArgs []string) {
+	id := parseScanID(osArgs, progName()+" scan show <id> [--json]")
+
+	fs := flag.NewFlagSet("scan show", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "Print the raw tool result as JSON")
+	parseFlags(fs, osArgs[1:])
+
+	content, err := getScan(client, id)
+	if err != nil {
+		fatal(err)
+	}
+	if rawOutput(*asJSON) {
+		printResult(content)
+		return
+	}
+
+	scan, _ := content["scan"].(map[string]interface{})
+	if scan == nil {
+		scan = content
+	}
+	fmt.Printf("Scan %v\n", scan["id"])
+	for _, key := range []string{"scanType", "filename", "scanDate", "uploadedBy", "hostCount", "duration"} {
+		if v := stringField(scan, key); v != "" {
+			fmt.Printf("  %-11s %s\n", key+":", v)
+		}
+	}
+
+	hosts, _ := content["hosts"].([]interface{})
+	services := map[string]int{}
+	fmt.Printf("\nHosts (%d):\n", len(hosts))
+	for _, item := range hosts {
+		h, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		ports, _ := h["ports"].([]interface{})
+		var open []string
+		for _, p := range ports {
+			pm, ok := p.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if state := stringField(pm, "state"); state != "" && state != "open" {
+				continue
+			}
+			entry := stringField(pm, "port") + "/" + stringField(pm, "protocol")
+			if svc := stringField(pm, "service"); svc != "" {
+				entry += " " + svc
+				services[svc]++
+			}
+			open = append(open, entry)
+		}
+		fmt.Printf("  %-16s %-30s %d open: %s\n", stringField(h, "ip"), truncate(stringField(h, "hostname"), 30), len(open), strings.Join(open, ", "))
+	}
+
+	if len(services) > 0 {
+		names := make([]string, 0, len(services))
+		for s := range services {
+			names = append(names, s)
+		}
+		sort.Slice(names, func(i, j int) bool { return services[names[i]] > services[names[j]] })
+		fmt.Println("\nServices:")
+		for _, s := range names {
+			fmt.Printf("  %-20s %d\n", s, services[s])
+		}
+	}
+
+	findings, _ := content["findings"].([]interface{})
+	fmt.Printf("\nDerived findings (%d):\n", len(findings))
+	for _, item := range findings {
+		f, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		fmt.Printf("  %-18s %s %s\n", stringField(f, "vulnerabilityId"), severityCell(stringField(f, "cvssSeverity"), 10), stringField(f, "assetName"))
+	}
+}
+
+func cmdScanExport(client *McpClient, osArgs []string) {
+	id := parseScanID(osArgs, progName()+" scan export <id> [--format xml] [--output file]")
+
+	fs := flag.NewFlagSet("scan export", flag.ContinueOnError)
+	format := fs.String("format", "xml", "Artifact format (xml returns the original upload)")
+	output := fs.String("output", "", "Output file (default: original file name)")
+	anonymize := fs.Bool("anonymize", false, "Pseudonymize hostnames, IPs and emails in the artifact")
+	sign := addSignFlag(fs)
+	dest := addDestinationFlags(fs)
+	parseFlags(fs, osArgs[1:])
+
+	if *format != "xml" {
+		fmt.Fprintf(os.Stderr, "Error: unsupported format %q (only xml is available)\n", *format)
+		exit(ExitUsage)
+	}
+
+	content, err := getScan(client, id)
+	if err != nil {
+		fatal(err)
+	}
+	scan, _ := content["scan"].(map[string]interface{})
+	if scan == nil {
+		scan = content
+	}
+	fileName := stringField(scan, "filename")
+	if fileName == "" {
+		fileName = fmt.Sprintf("scan-%d.xml", id)
+	}
+
+	dir := "."
+	name := *output
+	if name != "" {
+		dir, name = dirAndBase(name)
+	}
+
+	path, err := downloadVerified(dir, name, func(w io.Writer) (string, string, error) {
+		checksum := stringField(scan, "sha256")
+		if url := stringField(content, "artifactUrl"); url != "" {
+			if _, err := client.Download(url, w); err != nil {
+				return "", "", err
+			}
+			return fileName, checksum, nil
+		}
+		meta, err := chunkedDownload(client, "get_scan_artifact_chunk", map[string]interface{}{
+			"scanId": id,
+		}, defaultEvidenceChunkSize, w)
+		if err != nil {
+			return "", "", err
+		}
+		if checksum == "" {
+			checksum = stringField(meta, "sha256")
+		}
+		return fileName, checksum, nil
+	})
+	if err != nil {
+		fatal(err)
+	}
+
+	if *anonymize {
+		anon, err := newAnonymizer()
+		if err == nil {
+			anon.Records(mapsField(content, "hosts"), false)
+			err = anonymizeFile(path, anon)
+		}
+		if err != nil {
+			fatal(err)
+		}
+		signOutput(client, path, *sign)
+		uploadOutput(client, path, *sign != "", dest)
+		status(path, "Saved anonymized artifact of scan %d to %s\n", id, path)
+		return
+	}
+
+	signOutput(client, path, *sign)
+	uploadOutput(client, path, *sign != "", dest)
+	status(path, "Saved original artifact of scan %d to %s\n", id, path)
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/schmalle/secman/scripts/mcp/config"
+)
+
+// Scan artifacts are uploaded in chunks like evidence files:
+//
+//	start_scan_upload    scanType, fileName, size, sha256 -> uploadId
+//	upload_scan_chunk    uploadId, index, data (base64)
+//	complete_scan_upload uploadId -> scanId, hostsDiscovered, ...
+//
+// Re-uploading an artifact imports its findings again, which happens when
+// cron jobs push the same nmap output twice. Before uploading, the file's
+// SHA-256 is looked up with get_scans when the server filters by sha256,
+// and in the local record of uploads (SECMAN_SCAN_STATE, default
+// uploaded-scans.jsonl in the config directory) otherwise.
+
+// scanUpload is one line of the local upload record.
+type scanUpload struct {
+	SHA256   string      `json:"sha256"`
+	Server   string      `json:"server"`
+	File     string      `json:"file"`
+	ScanID   interface{} `json:"scanId"`
+	Uploaded time.Time   `json:"uploaded"`
+}
+
+func scanStatePath() string {
+	if p := setting("SECMAN_SCAN_STATE"); p != "" {
+		return p
+	}
+	dir, err := config.Dir()
+	if err != nil {
+		return ".secman-uploaded-scans.jsonl"
+	}
+	return filepath.Join(dir, "uploaded-scans.jsonl")
+}
+
+// findLocalUpload returns the recorded upload of sum to server, if any.
+func findLocalUpload(path, server, sum string) (*scanUpload, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var u scanUpload
+		if json.Unmarshal(scanner.Bytes(), &u) == nil && u.SHA256 == sum && u.Server == server {
+			return &u, nil
+		}
+	}
+	return nil, scanner.Err()
+}
+
+func recordLocalUpload(path string, u scanUpload) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	line, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	return appendStateFile(path, append(line, '\n'), 0o600)
+}
+
+// findServerUpload asks the server for a scan imported from sum. It
+// reports false when the server cannot filter scans by hash.
+func findServerUpload(client *McpClient, sum string) (map[string]interface{}, bool, error) {
+	if ok, _ := client.toolAccepts("get_scans", "sha256"); !ok {
+		return nil, false, nil
+	}
+	content, err := client.callToolMap("get_scans", map[string]interface{}{"sha256": sum, "page": 0, "pageSize": 1})
+	if err != nil {
+		return nil, true, err
+	}
+	if scans := mapsField(content, "scans"); len(scans) > 0 {
+		return scans[0], true, nil
+	}
+	return nil, true, nil
+}
+
+// detectScanType reads the scanner from the start of an XML artifact.
+func detectScanType(head []byte) string {
+	if bytes.Contains(head, []byte(`scanner="masscan"`)) {
+		return "masscan"
+	}
+	if bytes.Contains(head, []byte("<nmaprun")) {
+		return "nmap"
+	}
+	return ""
+}
+
+func cmdScanUpload(client *McpClient, osArgs []string) {
+	fs := flag.NewFlagSet("scan upload", flag.ContinueOnError)
+	scanType := fs.String("type", "", "Scanner of the artifacts: nmap or masscan (default: detected from the XML)")
+	onDuplicate := fs.String("on-duplicate", "skip", "When an identical artifact was imported before: skip, warn (upload anyway) or fail")
+	chunkSize := fs.Int("chunk-size", defaultEvidenceChunkSize, "Chunk size in bytes")
+	files := parseInterspersed(fs, osArgs)
+
+	if len(files) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: file required")
+		fmt.Fprintf(os.Stderr, "Usage: %s scan upload <file>... [--type nmap|masscan] [--on-duplicate skip|warn|fail]\n", progName())
+		exit(ExitUsage)
+	}
+	switch *onDuplicate {
+	case "skip", "warn", "fail":
+	default:
+		fmt.Fprintln(os.Stderr, "Error: --on-duplicate must be skip, warn or fail")
+		exit(ExitUsage)
+	}
+	if *chunkSize <= 0 {
+		fmt.Fprintln(os.Stderr, "Error: --chunk-size must be positive")
+		exit(ExitUsage)
+	}
+	if err := client.requireTool("start_scan_upload"); err != nil {
+		fatal(err)
+	}
+
+	state := scanStatePath()
+	uploaded, skipped, failed := 0, 0, 0
+	for _, path := range files {
+		done, wasSkipped, err := uploadScanOnce(client, state, path, *scanType, *onDuplicate, *chunkSize)
+		var dup *duplicateScanError
+		switch {
+		case errors.As(err, &dup):
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(ExitGateFailed)
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			failed++
+		case wasSkipped:
+			skipped++
+		default:
+			uploaded++
+			status(done["scanId"], "Uploaded %s as scan %v (%v host(s))\n", path, done["scanId"], done["hostsDiscovered"])
+		}
+	}
+
+	if skipped > 0 && uploaded == 0 && failed == 0 {
+		status(nil, "Nothing new to upload\n")
+	}
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d upload(s) failed\n", failed)
+		if uploaded > 0 || skipped > 0 {
+			exit(ExitPartial)
+		}
+		exit(ExitUsage)
+	}
+}
+
+// duplicateScanError is returned for an artifact imported before when
+// duplicates must fail.
+type duplicateScanError struct {
+	path, previous string
+}
+
+func (e *duplicateScanError) Error() string {
+	return fmt.Sprintf("%s was already imported (%s)", e.path, e.previous)
+}
+
+// uploadScanOnce uploads one artifact unless it was imported before, as
+// onDuplicate (skip, warn or fail) says. An empty scanType is detected from
+// the file. It reports skipped for a duplicate left out.
+func uploadScanOnce(client *McpClient, state, path, scanType, onDuplicate string, chunkSize int) (map[string]interface{}, bool, error) {
+	sum, head, err := hashScanArtifact(path)
+	if err != nil {
+		return nil, false, err
+	}
+	previous, err := previousUpload(client, state, sum)
+	if err != nil {
+		return nil, false, fmt.Errorf("duplicate check: %w", err)
+	}
+	if previous != "" {
+		switch onDuplicate {
+		case "fail":
+			return nil, false, &duplicateScanError{path: path, previous: previous}
+		case "warn":
+			fmt.Fprintf(os.Stderr, "Warning: %s was already imported (%s); uploading again\n", path, previous)
+		default:
+			status(nil, "Skipped %s: already imported (%s)\n", path, previous)
+			return nil, true, nil
+		}
+	}
+
+	if scanType == "" {
+		if scanType = detectScanType(head); scanType == "" {
+			return nil, false, fmt.Errorf("not an nmap or masscan XML file (pass --type)")
+		}
+	}
+	done, err := uploadScanArtifact(client, path, scanType, sum, chunkSize)
+	if err != nil {
+		return nil, false, err
+	}
+	if !client.dryRun {
+		if err := recordLocalUpload(state, scanUpload{SHA256: sum, Server: client.BaseURL, File: filepath.Base(path), ScanID: done["scanId"], Uploaded: time.Now().UTC()}); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: recording the upload in %s: %v\n", state, err)
+		}
+	}
+	return done, false, nil
+}
+
+// hashScanArtifact returns the SHA-256 of a file and its first bytes.
+func hashScanArtifact(path string) (string, []byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+	head := make([]byte, 4096)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", nil, err
+	}
+	head = head[:n]
+	h := sha256.New()
+	h.Write(head)
+	if _, err := io.Copy(h, f); err != nil {
+		return "", nil, fmt.Errorf("hash: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), head, nil
+}
+
+// previousUpload describes an earlier import of the artifact with hash
+// sum, or returns "" when there is none.
+func previousUpload(client *McpClient, state, sum string) (string, error) {
+	scan, asked, err := findServerUpload(client, sum)
+	if err != nil {
+		return "", err
+	}
+	if scan != nil {
+		return fmt.Sprintf("scan %v, uploaded %s by %s", scan["id"], stringField(scan, "scanDate"), stringField(scan, "uploadedBy")), nil
+	}
+	if asked {
+		return "", nil
+	}
+	u, err := findLocalUpload(state, client.BaseURL, sum)
+	if err != nil || u == nil {
+		return "", err
+	}
+	return fmt.Sprintf("scan %v, uploaded from here %s", u.ScanID, u.Uploaded.Format(time.RFC3339)), nil
+}
+
+func uploadScanArtifact(client *McpClient, path, scanType, sum string, chunkSize int) (map[string]interface{}, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	start, err := client.callToolMap("start_scan_upload", map[string]interface{}{
+		"scanType": scanType,
+		"fileName": filepath.Base(path),
+		"size":     info.Size(),
+		"sha256":   sum,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if client.dryRun {
+		return map[string]interface{}{"scanId": "(dry run)"}, nil
+	}
+	uploadID, ok := start["uploadId"].(string)
+	if !ok || uploadID == "" {
+		return nil, fmt.Errorf("start_scan_upload returned no uploadId")
+	}
+
+	buf := make([]byte, chunkSize)
+	progress := startProgress("Uploading "+filepath.Base(path), "bytes", info.Size())
+	defer progress.Finish()
+	for index := 0; ; index++ {
+		n, err := io.ReadFull(f, buf)
+		if n > 0 {
+			if _, cerr := client.callToolMap("upload_scan_chunk", map[string]interface{}{
+				"uploadId": uploadID,
+				"index":    index,
+				"data":     base64.StdEncoding.EncodeToString(buf[:n]),
+			}); cerr != nil {
+				return nil, fmt.Errorf("chunk %d: %w", index, cerr)
+			}
+			progress.Add(int64(n))
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", path, err)
+		}
+	}
+	progress.Finish()
+
+	return client.callToolMap("complete_scan_upload", map[string]interface{}{"uploadId": uploadID})
+}
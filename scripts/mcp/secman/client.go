@@ -0,0 +1,259 @@
+package secman
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Client is safe for concurrent use by multiple goroutines: request IDs
+// come from an atomic counter, the tool cache is guarded by a mutex and the
+// underlying http.Client is shared. The exported fields must not be changed
+// while calls are in flight.
+type Client struct {
+	BaseURL   string
+	APIKey    string
+	UserEmail string
+
+	// Tenant, when set, is sent in the X-MCP-Tenant header.
+	Tenant string
+
+	// Headers are added to every request, e.g. the correlation and routing
+	// headers an API gateway requires. A User-Agent given here replaces
+	// UserAgent; the authentication, delegation and tenant headers always
+	// take their values from the fields above.
+	Headers http.Header
+
+	// UserAgent identifies the client to the server.
+	UserAgent string
+
+	HTTP *http.Client
+
+	requestID atomic.Int64
+
+	toolsMu sync.Mutex
+	tools   map[string]ToolDefinition
+}
+
+// NewClient returns a client of the server at baseURL. userEmail, when
+// set, is the user the calls are delegated to.
+func NewClient(baseURL, apiKey, userEmail string) *Client {
+	return &Client{
+		BaseURL:   strings.TrimRight(baseURL, "/"),
+		APIKey:    apiKey,
+		UserEmail: userEmail,
+		UserAgent: "secman-go",
+		HTTP: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+// Limits bound one call. Timeout replaces the HTTP client's timeout, and
+// may be longer; MaxSize fails a larger response with a SizeError. Zero
+// means no limit.
+type Limits struct {
+	Timeout time.Duration
+	MaxSize int64
+}
+
+// SetHeaders adds the User-Agent, the custom headers, a correlation ID and
+// then the authentication, delegation and tenant headers. It returns the
+// correlation ID for error messages.
+func (c *Client) SetHeaders(req *http.Request) string {
+	req.Header.Set("User-Agent", c.UserAgent)
+	for name, values := range c.Headers {
+		req.Header[name] = append([]string(nil), values...)
+	}
+	if req.Header.Get(RequestIDHeader) == "" {
+		req.Header.Set(RequestIDHeader, NewRequestID())
+	}
+	req.Header.Set("X-MCP-API-Key", c.APIKey)
+	if c.UserEmail != "" {
+		req.Header.Set("X-MCP-User-Email", c.UserEmail)
+	}
+	if c.Tenant != "" {
+		req.Header.Set("X-MCP-Tenant", c.Tenant)
+	}
+	return req.Header.Get(RequestIDHeader)
+}
+
+// nextID returns the JSON-RPC ID of the next request, unique per client.
+func (c *Client) nextID() string {
+	return fmt.Sprintf("req-%d", c.requestID.Add(1))
+}
+
+// RPC sends a JSON-RPC request to the MCP tools/call endpoint, within
+// limits, and returns its result.
+func (c *Client) RPC(ctx context.Context, method string, params interface{}, limits Limits) (*json.RawMessage, error) {
+	req := JSONRPCRequest{
+		JSONRPC: "2.0",
+		ID:      c.nextID(),
+		Method:  method,
+		Params:  params,
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	if limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, limits.Timeout)
+		defer cancel()
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.BaseURL+"/api/mcp/tools/call", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	requestID := c.SetHeaders(httpReq)
+
+	httpClient := c.HTTP
+	if limits.Timeout > 0 {
+		unbounded := *c.HTTP
+		unbounded.Timeout = 0
+		httpClient = &unbounded
+	}
+	resp, err := httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("http request (request %s): %w", requestID, err)
+	}
+	defer resp.Body.Close()
+
+	reader := io.Reader(resp.Body)
+	if limits.MaxSize > 0 {
+		if resp.ContentLength > limits.MaxSize {
+			return nil, &SizeError{Size: resp.ContentLength, Limit: limits.MaxSize}
+		}
+		reader = io.LimitReader(resp.Body, limits.MaxSize+1)
+	}
+	respBody, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	if limits.MaxSize > 0 && int64(len(respBody)) > limits.MaxSize {
+		return nil, &SizeError{Size: -1, Limit: limits.MaxSize}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, NewHTTPError(resp.StatusCode, respBody, requestID)
+	}
+
+	var rpcResp JSONRPCResponse
+	if err := json.Unmarshal(respBody, &rpcResp); err != nil {
+		return nil, fmt.Errorf("unmarshal response: %w", err)
+	}
+
+	if rpcResp.Error != nil {
+		rpcResp.Error.RequestID = requestID
+		return nil, rpcResp.Error
+	}
+
+	return rpcResp.Result, nil
+}
+
+// Send calls a tool within limits. Tool-level errors come back in the
+// result, with IsError set.
+func (c *Client) Send(ctx context.Context, params ToolCallParams, limits Limits) (*ToolCallResult, error) {
+	result, err := c.RPC(ctx, "tools/call", params, limits)
+	if err != nil {
+		return nil, err
+	}
+
+	var toolResult ToolCallResult
+	if result != nil {
+		if err := json.Unmarshal(*result, &toolResult); err != nil {
+			return nil, fmt.Errorf("unmarshal tool result: %w", err)
+		}
+	}
+
+	return &toolResult, nil
+}
+
+// CallTool invokes an MCP tool by name with the given arguments.
+func (c *Client) CallTool(name string, args map[string]interface{}) (*ToolCallResult, error) {
+	return c.CallToolContext(context.Background(), name, args)
+}
+
+// CallToolContext is CallTool with a context that cancels the HTTP request.
+func (c *Client) CallToolContext(ctx context.Context, name string, args map[string]interface{}) (*ToolCallResult, error) {
+	return c.Send(ctx, ToolCallParams{Name: name, Arguments: args}, Limits{})
+}
+
+// Capabilities fetches the server capabilities (tool list).
+func (c *Client) Capabilities(ctx context.Context) (*CapabilitiesResponse, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", c.BaseURL+"/api/mcp/capabilities", nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	requestID := c.SetHeaders(httpReq)
+
+	resp, err := c.HTTP.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("http request (request %s): %w", requestID, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, NewHTTPError(resp.StatusCode, body, requestID)
+	}
+
+	var caps CapabilitiesResponse
+	if err := json.Unmarshal(body, &caps); err != nil {
+		return nil, fmt.Errorf("unmarshal capabilities: %w", err)
+	}
+
+	return &caps, nil
+}
+
+// Tool returns the definition of an advertised tool. The capabilities list
+// is fetched once and cached on the client.
+func (c *Client) Tool(name string) (ToolDefinition, bool, error) {
+	c.toolsMu.Lock()
+	defer c.toolsMu.Unlock()
+	if c.tools == nil {
+		caps, err := c.Capabilities(context.Background())
+		if err != nil {
+			return ToolDefinition{}, false, err
+		}
+		tools := make(map[string]ToolDefinition, len(caps.Capabilities.Tools))
+		for _, tool := range caps.Capabilities.Tools {
+			tools[tool.Name] = tool
+		}
+		c.tools = tools
+	}
+	tool, ok := c.tools[name]
+	return tool, ok, nil
+}
+
+// ToolNames returns the names of all advertised tools, sorted.
+func (c *Client) ToolNames() ([]string, error) {
+	if _, _, err := c.Tool(""); err != nil {
+		return nil, err
+	}
+	c.toolsMu.Lock()
+	defer c.toolsMu.Unlock()
+	names := make([]string, 0, len(c.tools))
+	for name := range c.tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,143 @@
+package secman
+
+import "context"
+
+// Pager walks the items of a paginated list tool, fetching pages as they
+// are needed:
+//
+//	it := secman.Assets(ctx, client, map[string]interface{}{"type": "SERVER"})
+//	for it.Next() {
+//		asset := it.Item()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+//
+// Most tools take page/pageSize; a few older ones take size, which is
+// detected from the tool schema.
+type Pager struct {
+	ctx      context.Context
+	client   Caller
+	tool     string
+	listKey  string
+	args     map[string]interface{}
+	pageSize int
+
+	page       int
+	totalPages int
+	items      []map[string]interface{}
+	index      int
+	last       bool
+	err        error
+
+	// OnPage, if set, is called after each fetched page with the total
+	// page count.
+	OnPage func(totalPages int)
+}
+
+// Pages returns a Pager over the items stored under listKey in the results
+// of tool. args are sent with every page; pageSize items are requested at a
+// time.
+func Pages(ctx context.Context, client Caller, tool, listKey string, args map[string]interface{}, pageSize int) *Pager {
+	return &Pager{ctx: ctx, client: client, tool: tool, listKey: listKey, args: args, pageSize: pageSize, index: -1}
+}
+
+// Assets iterates over every asset matching filter (get_assets arguments
+// such as name, type, ip or owner).
+func Assets(ctx context.Context, client Caller, filter map[string]interface{}) *Pager {
+	return Pages(ctx, client, "get_assets", "assets", filter, 500)
+}
+
+// Vulnerabilities iterates over every vulnerability matching filter
+// (get_vulnerabilities arguments such as severity or assetId).
+func Vulnerabilities(ctx context.Context, client Caller, filter map[string]interface{}) *Pager {
+	return Pages(ctx, client, "get_vulnerabilities", "vulnerabilities", filter, 500)
+}
+
+// Next advances to the next item, fetching the next page when the current
+// one is used up. It returns false at the end or on error; see Err.
+func (p *Pager) Next() bool {
+	if p.err != nil {
+		return false
+	}
+	p.index++
+	for p.index >= len(p.items) {
+		if p.last {
+			return false
+		}
+		if err := p.fetch(); err != nil {
+			p.err = err
+			return false
+		}
+	}
+	return true
+}
+
+// Item returns the current item.
+func (p *Pager) Item() map[string]interface{} {
+	return p.items[p.index]
+}
+
+// PageItems returns the items of the page the current item is on.
+func (p *Pager) PageItems() []map[string]interface{} {
+	return p.items
+}
+
+// EndOfPage reports whether the current item is the last of its page, so
+// a caller can flush what it wrote before the next page is fetched.
+func (p *Pager) EndOfPage() bool {
+	return p.index == len(p.items)-1
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (p *Pager) Err() error {
+	return p.err
+}
+
+// All drains the pager and returns the remaining items.
+func (p *Pager) All() ([]map[string]interface{}, error) {
+	var all []map[string]interface{}
+	for p.Next() {
+		all = append(all, p.Item())
+	}
+	return all, p.Err()
+}
+
+func (p *Pager) fetch() error {
+	sizeParam := "pageSize"
+	if ok, _ := toolAccepts(p.client, p.tool, "pageSize"); !ok {
+		if ok, _ := toolAccepts(p.client, p.tool, "size"); ok {
+			sizeParam = "size"
+		}
+	}
+	args := map[string]interface{}{"page": p.page, sizeParam: p.pageSize}
+	for k, v := range p.args {
+		args[k] = v
+	}
+
+	content, err := CallToolAs[map[string]interface{}](p.ctx, p.client, p.tool, args)
+	if err != nil {
+		return err
+	}
+	totalPages, _ := content["totalPages"].(float64)
+	p.items, p.index, p.totalPages = objects(content[p.listKey]), 0, int(totalPages)
+	p.page++
+	p.last = p.page >= p.totalPages || len(p.items) == 0
+	if p.OnPage != nil {
+		p.OnPage(p.totalPages)
+	}
+	return nil
+}
+
+// objects returns the JSON objects of a decoded JSON array.
+func objects(v interface{}) []map[string]interface{} {
+	raw, _ := v.([]interface{})
+	items := make([]map[string]interface{}, 0, len(raw))
+	for _, item := range raw {
+		if o, ok := item.(map[string]interface{}); ok {
+			items = append(items, o)
+		}
+	}
+	return items
+}
@@ -0,0 +1,76 @@
+package secman
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestAssetsPages walks three pages of get_assets through a server whose
+// tool takes the older size argument.
+func TestAssetsPages(t *testing.T) {
+	var sizes []interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-MCP-API-Key") != "test-key" {
+			http.Error(w, "no key", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/mcp/capabilities":
+			var caps CapabilitiesResponse
+			caps.Capabilities.Tools = []ToolDefinition{{Name: "get_assets", InputSchema: map[string]interface{}{
+				"properties": map[string]interface{}{"page": map[string]interface{}{}, "size": map[string]interface{}{}},
+			}}}
+			json.NewEncoder(w).Encode(caps)
+		case "/api/mcp/tools/call":
+			var req struct {
+				ID     string         `json:"id"`
+				Params ToolCallParams `json:"params"`
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+			sizes = append(sizes, req.Params.Arguments["size"])
+			page := int(req.Params.Arguments["page"].(float64))
+			content := map[string]interface{}{
+				"assets":     []interface{}{map[string]interface{}{"id": page*2 + 1}, map[string]interface{}{"id": page*2 + 2}},
+				"totalPages": 3,
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID,
+				"result": ToolCallResult{Content: content}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	client := NewClient(srv.URL, "test-key", "")
+	assets, err := Assets(context.Background(), client, nil).All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(assets) != 6 {
+		t.Fatalf("got %d assets, want 6", len(assets))
+	}
+	for i, asset := range assets {
+		if asset["id"] != float64(i+1) {
+			t.Errorf("asset %d: id = %v, want %d", i, asset["id"], i+1)
+		}
+	}
+	if len(sizes) != 3 || sizes[0] != float64(500) {
+		t.Errorf("size arguments = %v, want 500 on each of 3 pages", sizes)
+	}
+}
+
+func TestCallToolAsToolError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": "req-1",
+			"result": ToolCallResult{Content: "asset not found", IsError: true}})
+	}))
+	defer srv.Close()
+
+	_, err := CallToolAs[map[string]interface{}](context.Background(), NewClient(srv.URL, "test-key", ""), "get_asset", nil)
+	if err == nil || err.Error() != "get_asset failed: asset not found" {
+		t.Errorf("err = %v, want the tool error", err)
+	}
+}
@@ -0,0 +1,226 @@
+// Package secman is a client of the Secman MCP server: it discovers the
+// server's tools and calls them with JSON-RPC 2.0 over HTTP.
+//
+//	client := secman.NewClient("https://secman.example", apiKey, "")
+//	it := secman.Assets(ctx, client, map[string]interface{}{"type": "SERVER"})
+//	for it.Next() {
+//		fmt.Println(it.Item()["name"])
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+//
+// CallToolAs and Pager take any Caller, so they work as well with a client
+// that wraps Client in further behaviour, such as the secman command's
+// dry-run and snapshot modes.
+package secman
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// --- JSON-RPC 2.0 types ---
+
+type JSONRPCRequest struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      string      `json:"id"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+type JSONRPCResponse struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      string           `json:"id"`
+	Result  *json.RawMessage `json:"result,omitempty"`
+	Error   *JSONRPCError    `json:"error,omitempty"`
+}
+
+type JSONRPCError struct {
+	Code    RPCCode         `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+
+	// RequestID is the correlation ID of the failed request.
+	RequestID string `json:"-"`
+}
+
+// Error renders the code, message and correlation ID, followed by the
+// error data (validation details, stack hints) one key per line.
+func (e *JSONRPCError) Error() string {
+	msg := fmt.Sprintf("RPC error %s: %s", e.Code, e.Message)
+	if e.RequestID != "" {
+		msg += " (request " + e.RequestID + ")"
+	}
+	return Redact(msg) + renderErrorData(e.Data)
+}
+
+// RPCCode holds a JSON-RPC error code. The tools/call endpoint uses string
+// codes ("NOT_FOUND"); standard JSON-RPC uses numbers (-32601).
+type RPCCode string
+
+func (c *RPCCode) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*c = RPCCode(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return err
+	}
+	*c = RPCCode(n.String())
+	return nil
+}
+
+// HTTPError is returned for non-200 responses. RPC holds the JSON-RPC error
+// from the body when the server sent one.
+type HTTPError struct {
+	StatusCode int
+	Body       string
+	RPC        *JSONRPCError
+	RequestID  string
+}
+
+func (e *HTTPError) Error() string {
+	if e.RPC != nil {
+		return fmt.Sprintf("HTTP %d: %v", e.StatusCode, e.RPC)
+	}
+	if e.RequestID != "" {
+		return fmt.Sprintf("HTTP %d (request %s): %s", e.StatusCode, e.RequestID, Redact(e.Body))
+	}
+	return fmt.Sprintf("HTTP %d: %s", e.StatusCode, Redact(e.Body))
+}
+
+func (e *HTTPError) Unwrap() error {
+	if e.RPC == nil {
+		return nil
+	}
+	return e.RPC
+}
+
+// NewHTTPError builds the error for a non-200 response, decoding the
+// JSON-RPC error in body if there is one.
+func NewHTTPError(status int, body []byte, requestID string) *HTTPError {
+	e := &HTTPError{StatusCode: status, Body: string(body), RequestID: requestID}
+	var rpcResp JSONRPCResponse
+	if json.Unmarshal(body, &rpcResp) == nil && rpcResp.Error != nil {
+		e.RPC = rpcResp.Error
+		e.RPC.RequestID = requestID
+	}
+	return e
+}
+
+// SizeError is returned for a response larger than the MaxSize of the
+// call's Limits. Size is -1 when the server did not announce the length.
+type SizeError struct {
+	Size  int64
+	Limit int64
+}
+
+func (e *SizeError) Error() string {
+	if e.Size > 0 {
+		return fmt.Sprintf("result of %d bytes is larger than %d bytes", e.Size, e.Limit)
+	}
+	return fmt.Sprintf("result larger than %d bytes", e.Limit)
+}
+
+// --- MCP types ---
+
+type ToolCallParams struct {
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments,omitempty"`
+}
+
+type ToolDefinition struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	InputSchema map[string]interface{} `json:"inputSchema,omitempty"`
+}
+
+type CapabilitiesResponse struct {
+	Capabilities struct {
+		Tools []ToolDefinition `json:"tools"`
+	} `json:"capabilities"`
+	ServerInfo map[string]interface{} `json:"serverInfo"`
+}
+
+type ToolCallResult struct {
+	Content  interface{}            `json:"content"`
+	IsError  bool                   `json:"isError"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// --- Redaction and correlation ---
+
+// Redact and RedactValue remove secrets from the text and the decoded data
+// of error messages before they are rendered. Both leave their input
+// unchanged unless a program sets them, as the secman command does with
+// its redaction layer.
+var (
+	Redact      = func(s string) string { return s }
+	RedactValue = func(v interface{}) interface{} { return v }
+)
+
+// RequestIDHeader carries a correlation ID generated for every request, so
+// an error seen by the user can be found in the server and gateway logs.
+// A value set in Client.Headers is sent unchanged instead.
+const RequestIDHeader = "X-Request-Id"
+
+// NewRequestID returns a random UUID (version 4).
+func NewRequestID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("crypto/rand: %v", err))
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	h := hex.EncodeToString(b[:])
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
+
+// renderErrorData formats the data of a JSON-RPC error as indented
+// "key: value" lines (validation details, stack hints), or "" when empty.
+func renderErrorData(data json.RawMessage) string {
+	if len(data) == 0 {
+		return ""
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return "\n  data: " + Redact(string(data))
+	}
+	switch t := RedactValue(v).(type) {
+	case nil:
+		return ""
+	case map[string]interface{}:
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var b strings.Builder
+		for _, k := range keys {
+			b.WriteString("\n  " + k + ": " + renderErrorValue(t[k]))
+		}
+		return b.String()
+	default:
+		return "\n  data: " + renderErrorValue(t)
+	}
+}
+
+// renderErrorValue prints strings as-is (multi-line ones indented) and
+// anything else as compact JSON.
+func renderErrorValue(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return strings.ReplaceAll(s, "\n", "\n    ")
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(out)
+}
@@ -0,0 +1,57 @@
+package secman
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Caller calls the tools of a Secman server. Client is one; CallToolAs and
+// Pager take any.
+type Caller interface {
+	CallToolContext(ctx context.Context, name string, args map[string]interface{}) (*ToolCallResult, error)
+	Tool(name string) (ToolDefinition, bool, error)
+}
+
+// CallToolAs calls a tool and decodes its content into T, so callers can
+// declare the shape they expect instead of walking map[string]interface{}:
+//
+//	type assetPage struct {
+//		Assets []struct{ ID int64; Name string } `json:"assets"`
+//		Total  int                               `json:"total"`
+//	}
+//	page, err := secman.CallToolAs[assetPage](ctx, client, "get_assets", nil)
+//
+// Tool-level errors (isError) are returned as Go errors.
+func CallToolAs[T any](ctx context.Context, client Caller, name string, args map[string]interface{}) (T, error) {
+	var out T
+	result, err := client.CallToolContext(ctx, name, args)
+	if err != nil {
+		return out, err
+	}
+	if result.IsError {
+		return out, fmt.Errorf("%s failed: %v", name, result.Content)
+	}
+	if result.Content == nil {
+		return out, nil
+	}
+	data, err := json.Marshal(result.Content)
+	if err == nil {
+		err = json.Unmarshal(data, &out)
+	}
+	if err != nil {
+		return out, fmt.Errorf("decode %s result into %T: %w", name, out, err)
+	}
+	return out, nil
+}
+
+// toolAccepts reports whether a tool's inputSchema declares the property.
+func toolAccepts(client Caller, tool, property string) (bool, error) {
+	def, ok, err := client.Tool(tool)
+	if err != nil || !ok {
+		return false, err
+	}
+	props, _ := def.InputSchema["properties"].(map[string]interface{})
+	_, ok = props[property]
+	return ok, nil
+}
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Release builds are static binaries named secman_<os>_<arch> (.exe on
+// Windows), published as assets of a GitHub release together with
+// checksums.txt, the sha256sum of every binary, and optionally
+// checksums.txt.minisig. build.sh produces that layout.
+//
+// self-update looks for the newest release carrying the binary for this
+// platform, checks its SHA-256 against checksums.txt and, when
+// SECMAN_UPDATE_PUBKEY names the release key, the minisign signature of
+// checksums.txt. Only then does it replace the running executable, by a
+// rename in its directory, so a failed update leaves the old binary in
+// place.
+//
+// Where updates come from, the key they are checked with and the GitHub
+// token are never taken from an env file the client found by searching:
+// one that came with a cloned repository could otherwise install its own
+// binary. The token is only sent to the GitHub API itself.
+
+const (
+	defaultUpdateRepo   = "schmalle/secman"
+	defaultUpdateAPIURL = "https://api.github.com"
+)
+
+// buildInfo describes this binary.
+type buildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+	BuildDate string `json:"buildDate,omitempty"`
+	GoVersion string `json:"goVersion"`
+	Platform  string `json:"platform"`
+}
+
+// currentBuild returns the version information set at build time, or else
+// the VCS stamp go build embeds.
+func currentBuild() buildInfo {
+	info := buildInfo{Version: version, Commit: commit, BuildDate: buildDate,
+		GoVersion: runtime.Version(), Platform: runtime.GOOS + "/" + runtime.GOARCH}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			if info.Commit == "" {
+				info.Commit = s.Value
+			}
+		case "vcs.time":
+			if info.BuildDate == "" {
+				info.BuildDate = s.Value
+			}
+		case "vcs.modified":
+			info.Modified = s.Value == "true" && commit == ""
+		}
+	}
+	if len(info.Commit) > 12 {
+		info.Commit = info.Commit[:12]
+	}
+	return info
+}
+
+func cmdVersion(osArgs []string) {
+	fs := flag.NewFlagSet("version", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "Print the build information as JSON")
+	parseFlags(fs, osArgs)
+
+	info := currentBuild()
+	if rawOutput(*asJSON) {
+		printResult(info)
+		return
+	}
+	fmt.Printf("secman %s\n", info.Version)
+	if info.Commit != "" {
+		modified := ""
+		if info.Modified {
+			modified = " (modified)"
+		}
+		fmt.Printf("  commit: %s%s\n", info.Commit, modified)
+	}
+	if info.BuildDate != "" {
+		fmt.Printf("  built:  %s\n", info.BuildDate)
+	}
+	fmt.Printf("  go:     %s %s\n", info.GoVersion, info.Platform)
+}
+
+// releaseAsset is the binary name for a platform.
+func releaseAsset(goos, goarch string) string {
+	name := "secman_" + goos + "_" + goarch
+	if goos == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+type githubRelease struct {
+	TagName    string `json:"tag_name"`
+	Draft      bool   `json:"draft"`
+	Prerelease bool   `json:"prerelease"`
+	HTMLURL    string `json:"html_url"`
+	Assets     []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+		Size int64  `json:"size"`
+	} `json:"assets"`
+}
+
+func (r *githubRelease) assetURL(name string) string {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a.URL
+		}
+	}
+	return ""
+}
+
+// releaseVersion is the version of a release tag: v1.2.3, cli-v1.2.3 and
+// 1.2.3 are all 1.2.3.
+func releaseVersion(tag string) string {
+	if i := strings.LastIndex(tag, "v"); i >= 0 && i+1 < len(tag) && tag[i+1] >= '0' && tag[i+1] <= '9' {
+		return tag[i+1:]
+	}
+	return tag
+}
+
+// compareVersions compares dotted versions numerically; a pre-release
+// suffix (-rc.1) sorts before the release.
+func compareVersions(a, b string) int {
+	a, b = strings.TrimPrefix(a, "v"), strings.TrimPrefix(b, "v")
+	aCore, aPre, _ := strings.Cut(a, "-")
+	bCore, bPre, _ := strings.Cut(b, "-")
+	as, bs := strings.Split(aCore, "."), strings.Split(bCore, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case aPre == bPre:
+		return 0
+	case aPre == "":
+		return 1
+	case bPre == "":
+		return -1
+	case aPre < bPre:
+		return -1
+	}
+	return 1
+}
+
+// updater talks to the release host.
+type updater struct {
+	apiURL string
+	repo   string
+	token  string
+	http   *http.Client
+}
+
+func (u *updater) get(url string, accept string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent())
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	if u.token != "" && sameOrigin(req.URL, defaultUpdateAPIURL) {
+		req.Header.Set("Authorization", "Bearer "+u.token)
+	}
+	resp, err := u.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, &HTTPError{StatusCode: resp.StatusCode, Body: url + ": " + strings.TrimSpace(string(body))}
+	}
+	return resp, nil
+}
+
+// findRelease returns the release to install: the one tagged want, or
+// the newest stable release that has the asset.
+func (u *updater) findRelease(asset, want string) (*githubRelease, error) {
+	resp, err := u.get(fmt.Sprintf("%s/repos/%s/releases?per_page=50", u.apiURL, u.repo), "application/vnd.github+json")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var releases []githubRelease
+	if err := json.NewDecoder(resp.Body).Decode(&releases); err != nil {
+		return nil, fmt.Errorf("releases of %s: %w", u.repo, err)
+	}
+	for i := range releases {
+		r := &releases[i]
+		if r.Draft || r.assetURL(asset) == "" {
+			continue
+		}
+		if want != "" {
+			if r.TagName == want || releaseVersion(r.TagName) == strings.TrimPrefix(want, "v") {
+				return r, nil
+			}
+			continue
+		}
+		if !r.Prerelease {
+			return r, nil
+		}
+	}
+	if want != "" {
+		return nil, fmt.Errorf("no release %s of %s has %s", want, u.repo, asset)
+	}
+	return nil, fmt.Errorf("no release of %s has %s", u.repo, asset)
+}
+
+// download writes url to path and returns its SHA-256.
+func (u *updater) download(url, path string) (string, error) {
+	resp, err := u.get(url, "application/octet-stream")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o755)
+	if err != nil {
+		return "", err
+	}
+	progress := startProgress("Downloading "+filepath.Base(url), "bytes", resp.ContentLength)
+	h := sha256.New()
+	_, err = io.Copy(progress.Writer(io.MultiWriter(f, h)), resp.Body)
+	progress.Finish()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return hex.EncodeToString(h.Sum(nil)), err
+}
+
+// checksumFor finds an asset's SHA-256 in a sha256sum file.
+func checksumFor(path, asset string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == asset {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("checksums.txt has no entry for %s", asset)
+}
+
+func cmdSelfUpdate(osArgs []string) {
+	fs := flag.NewFlagSet("self-update", flag.ContinueOnError)
+	check := fs.Bool("check", false, "Only report whether a newer release exists (exit 5 if so)")
+	want := fs.String("version", "", "Install this release (e.g. v1.4.0), also an older one")
+	pubkey := fs.String("pubkey", trustedSetting("SECMAN_UPDATE_PUBKEY"), "Release public key; checksums.txt must carry its minisign signature")
+	repo := fs.String("repo", trustedSettingOr("SECMAN_UPDATE_REPO", defaultUpdateRepo), "GitHub repository the releases are published in")
+	apiURL := fs.String("api-url", trustedSettingOr("SECMAN_UPDATE_API_URL", defaultUpdateAPIURL), "GitHub API URL (GitHub Enterprise: https://host/api/v3)")
+	parseFlags(fs, osArgs)
+
+	u := &updater{
+		apiURL: strings.TrimRight(*apiURL, "/"),
+		repo:   *repo,
+		token:  trustedSettingOr("SECMAN_GITHUB_TOKEN", trustedSetting("GITHUB_TOKEN")),
+		http:   &http.Client{Timeout: 10 * time.Minute},
+	}
+	registerSecret(u.token)
+	asset := releaseAsset(runtime.GOOS, runtime.GOARCH)
+	release, err := u.findRelease(asset, *want)
+	if err != nil {
+		fatal(err)
+	}
+	latest := releaseVersion(release.TagName)
+	newer := compareVersions(latest, version) > 0
+	if *check {
+		if newer {
+			fmt.Printf("secman %s is available (running %s): %s\n", latest, version, release.HTMLURL)
+			exit(ExitGateFailed)
+		}
+		fmt.Printf("secman %s is the newest release\n", version)
+		return
+	}
+	if *want == "" && !newer {
+		fmt.Printf("secman %s is the newest release\n", version)
+		return
+	}
+
+	exe, err := os.Executable()
+	if err == nil {
+		exe, err = filepath.EvalSymlinks(exe)
+	}
+	if err != nil {
+		fatal(fmt.Errorf("locate the running binary: %w", err))
+	}
+	if underGoRun() {
+		fatal(fmt.Errorf("self-update replaces a built binary, not one run by go run; build it with build.sh or download a release"))
+	}
+	if manager, upgrade := packageManager(exe); manager != "" {
+		fatal(fmt.Errorf("%s is managed by %s; update it with %s", exe, manager, upgrade))
+	}
+	if err := installRelease(u, release, asset, exe, *pubkey); err != nil {
+		fatal(err)
+	}
+	verified := "checksum verified"
+	if *pubkey != "" {
+		verified = "checksum and signature verified"
+	}
+	fmt.Printf("Updated %s from %s to %s (%s)\n", exe, version, latest, verified)
+}
+
+// packageManager names the package manager that installed exe, and its
+// update command, so self-update does not replace a binary behind its back.
+func packageManager(exe string) (string, string) {
+	path := strings.ToLower(filepath.ToSlash(exe))
+	switch {
+	case strings.Contains(path, "/cellar/") || strings.Contains(path, "/homebrew/"):
+		return "Homebrew", "brew upgrade " + binaryName()
+	case strings.Contains(path, "/scoop/apps/") || strings.Contains(path, "/scoop/shims/"):
+		return "Scoop", "scoop update " + binaryName()
+	}
+	return "", ""
+}
+
+// installRelease downloads and verifies the release's binary and puts it in
+// place of exe.
+func installRelease(u *updater, release *githubRelease, asset, exe, pubkey string) error {
+	dir := filepath.Dir(exe)
+	// A Windows update leaves the previous binary behind; see below.
+	os.Remove(exe + ".old")
+
+	tmp, err := os.MkdirTemp(dir, ".secman-update-")
+	if err != nil {
+		return fmt.Errorf("cannot write next to %s: %w", exe, err)
+	}
+	defer os.RemoveAll(tmp)
+
+	sumsURL := release.assetURL("checksums.txt")
+	if sumsURL == "" {
+		return fmt.Errorf("release %s has no checksums.txt; refusing an unverified binary", release.TagName)
+	}
+	sumsPath := filepath.Join(tmp, "checksums.txt")
+	if _, err := u.download(sumsURL, sumsPath); err != nil {
+		return err
+	}
+	if pubkey != "" {
+		key, err := loadVerifyKey(pubkey)
+		if err != nil {
+			return err
+		}
+		sigURL := release.assetURL("checksums.txt.minisig")
+		if sigURL == "" {
+			return fmt.Errorf("release %s has no checksums.txt.minisig, but a release key is set", release.TagName)
+		}
+		if _, err := u.download(sigURL, sumsPath+".minisig"); err != nil {
+			return err
+		}
+		if _, err := verifyArtifact(sumsPath, sumsPath+".minisig", key); err != nil {
+			return fmt.Errorf("checksums.txt: %w", err)
+		}
+	}
+	expected, err := checksumFor(sumsPath, asset)
+	if err != nil {
+		return err
+	}
+	binPath := filepath.Join(tmp, asset)
+	got, err := u.download(release.assetURL(asset), binPath)
+	if err != nil {
+		return err
+	}
+	if got != expected {
+		return fmt.Errorf("%s: SHA-256 %s does not match checksums.txt (%s); not installed", asset, got, expected)
+	}
+
+	// Windows cannot replace a running executable, but can rename it.
+	if runtime.GOOS == "windows" {
+		if err := os.Rename(exe, exe+".old"); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(binPath, exe); err != nil {
+		if runtime.GOOS == "windows" {
+			os.Rename(exe+".old", exe)
+		}
+		return fmt.Errorf("replace %s: %w", exe, err)
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUpdaterSendsTokenOnlyToGitHub(t *testing.T) {
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+	}))
+	defer srv.Close()
+
+	u := &updater{apiURL: srv.URL, repo: "acme/secman", token: "ghp_secret", http: srv.Client()}
+	resp, err := u.get(srv.URL+"/repos/acme/secman/releases", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if auth != "" {
+		t.Errorf("Authorization %q sent to %s, want none outside api.github.com", auth, srv.URL)
+	}
+}
@@ -0,0 +1,555 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// ServiceNow is reached through its Table API. SECMAN_SERVICENOW_URL is the
+// instance (https://example.service-now.com); authentication is an OAuth
+// token in SECMAN_SERVICENOW_TOKEN, or basic auth with
+// SECMAN_SERVICENOW_USER and SECMAN_SERVICENOW_PASSWORD.
+//
+// Incidents carry the correlation id secman:finding:<id> or
+// secman:asset:<id>, so running `ticket servicenow` again skips findings
+// that already have an active incident.
+
+type snowClient struct {
+	baseURL  string
+	user     string
+	password string
+	token    string
+	http     *http.Client
+}
+
+// snowPageSize is the number of records fetched per Table API request.
+const snowPageSize = 1000
+
+func newSnowClient(client *McpClient) (*snowClient, error) {
+	s := &snowClient{
+		baseURL:  strings.TrimRight(setting("SECMAN_SERVICENOW_URL"), "/"),
+		user:     setting("SECMAN_SERVICENOW_USER"),
+		password: setting("SECMAN_SERVICENOW_PASSWORD"),
+		token:    setting("SECMAN_SERVICENOW_TOKEN"),
+	}
+	if s.baseURL == "" {
+		return nil, fmt.Errorf("SECMAN_SERVICENOW_URL is required")
+	}
+	if s.token == "" && (s.user == "" || s.password == "") {
+		return nil, fmt.Errorf("SECMAN_SERVICENOW_TOKEN, or SECMAN_SERVICENOW_USER and SECMAN_SERVICENOW_PASSWORD, are required")
+	}
+	registerSecret(s.password)
+	registerSecret(s.token)
+
+	s.http = externalHTTPClient(client, 60*time.Second)
+	return s, nil
+}
+
+func (s *snowClient) do(method, path string, query url.Values, body interface{}) (map[string]interface{}, error) {
+	u := s.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, u, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	} else {
+		req.SetBasicAuth(s.user, s.password)
+	}
+
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("servicenow: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("servicenow: read response: %w", err)
+	}
+
+	var out map[string]interface{}
+	jsonErr := json.Unmarshal(data, &out)
+	if resp.StatusCode/100 != 2 {
+		msg := http.StatusText(resp.StatusCode)
+		if e, ok := out["error"].(map[string]interface{}); ok {
+			msg = stringField(e, "message")
+			if detail := stringField(e, "detail"); detail != "" {
+				msg += ": " + detail
+			}
+		}
+		return nil, &HTTPError{StatusCode: resp.StatusCode, Body: "servicenow: " + msg}
+	}
+	if jsonErr != nil {
+		return nil, fmt.Errorf("servicenow: invalid response: %w", jsonErr)
+	}
+	return out, nil
+}
+
+// query returns every record of table matching the encoded query.
+func (s *snowClient) query(table, encoded string, fields []string) ([]map[string]interface{}, error) {
+	var records []map[string]interface{}
+	for offset := 0; ; offset += snowPageSize {
+		q := url.Values{
+			"sysparm_query":                  {encoded},
+			"sysparm_fields":                 {strings.Join(fields, ",")},
+			"sysparm_limit":                  {fmt.Sprint(snowPageSize)},
+			"sysparm_offset":                 {fmt.Sprint(offset)},
+			"sysparm_exclude_reference_link": {"true"},
+		}
+		out, err := s.do(http.MethodGet, "/api/now/table/"+url.PathEscape(table), q, nil)
+		if err != nil {
+			return nil, err
+		}
+		page := mapsField(out, "result")
+		records = append(records, page...)
+		if len(page) < snowPageSize {
+			return records, nil
+		}
+	}
+}
+
+// insert creates a record and returns it as stored.
+func (s *snowClient) insert(table string, record map[string]interface{}) (map[string]interface{}, error) {
+	out, err := s.do(http.MethodPost, "/api/now/table/"+url.PathEscape(table), nil, record)
+	if err != nil {
+		return nil, err
+	}
+	result, _ := out["result"].(map[string]interface{})
+	return result, nil
+}
+
+// snowImpactUrgency maps a severity onto incident impact and urgency, which
+// ServiceNow turns into the priority: Critical P1, High P2, Medium P3, Low P5.
+var snowImpactUrgency = map[string][2]string{
+	"CRITICAL": {"1", "1"},
+	"HIGH":     {"1", "2"},
+	"MEDIUM":   {"2", "2"},
+	"LOW":      {"3", "3"},
+}
+
+func cmdTicketServiceNow(client *McpClient, osArgs []string) {
+	fs := flag.NewFlagSet("ticket servicenow", flag.ContinueOnError)
+	severity := fs.String("severity", "", "Only findings of this severity (CRITICAL, HIGH, MEDIUM, LOW)")
+	cve := fs.String("cve", "", "Only findings whose CVE id contains this text")
+	assetID := fs.Int64("asset-id", 0, "Only findings on this asset")
+	per := fs.String("per", "finding", "One incident per finding or per asset: finding or asset")
+	group := fs.String("assignment-group", setting("SECMAN_SERVICENOW_ASSIGNMENT_GROUP"), "Assignment group (name or sys_id)")
+	category := fs.String("category", "", "Incident category")
+	asJSON := fs.Bool("json", false, "Print the created and skipped incidents as JSON")
+	yes := addYesFlag(fs)
+	parseFlags(fs, osArgs)
+
+	if *per != "finding" && *per != "asset" {
+		fmt.Fprintf(os.Stderr, "Error: --per must be finding or asset, got %q\n", *per)
+		exit(ExitUsage)
+	}
+	snow, err := newSnowClient(client)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(ExitUsage)
+	}
+
+	findings, err := ticketFindings(client, *severity, *cve, *assetID)
+	if err != nil {
+		fatal(err)
+	}
+	tickets := findingTickets(findings, *per)
+	if len(tickets) == 0 {
+		status(0, "No matching findings\n")
+		return
+	}
+
+	// Skip findings that already have an active incident.
+	existing, err := snowActiveIncidents(snow, tickets)
+	if err != nil {
+		fatal(err)
+	}
+	var pending []*findingTicket
+	for _, t := range tickets {
+		if number, ok := existing[t.CorrelationID]; ok {
+			t.Status, t.Number = "exists", number
+			continue
+		}
+		pending = append(pending, t)
+	}
+
+	if len(pending) > 0 {
+		summary := []string{fmt.Sprintf("%d incident(s) in %s", len(pending), snow.baseURL)}
+		for i, t := range pending {
+			if i == 20 {
+				summary = append(summary, fmt.Sprintf("... and %d more", len(pending)-20))
+				break
+			}
+			summary = append(summary, t.shortDescription())
+		}
+		if err := confirm(client, *yes, "create ServiceNow incidents", summary); err != nil {
+			fatal(err)
+		}
+	}
+
+	created, failed := 0, 0
+	progress := startProgress("Creating incidents", "incidents", int64(len(pending)))
+	defer progress.Finish()
+	for _, t := range pending {
+		record := t.incident(*group, *category)
+		if client.dryRun {
+			client.dryRunCalls.Add(1)
+			pauseProgress(func() {
+				fmt.Printf("DRY RUN servicenow incident %s\n", t.CorrelationID)
+				for _, k := range sortedArgKeys(record) {
+					fmt.Printf("    %s = %s\n", k, dryRunValue(record[k]))
+				}
+			})
+			t.Status = "dry-run"
+			progress.Add(1)
+			continue
+		}
+		result, err := snow.insert("incident", record)
+		progress.Add(1)
+		if err != nil {
+			progress.Warnf("  %s: %v\n", t.CorrelationID, err)
+			t.Status, t.Error = "failed", err.Error()
+			failed++
+			continue
+		}
+		t.Status, t.Number, t.SysID = "created", stringField(result, "number"), stringField(result, "sys_id")
+		created++
+	}
+	progress.Finish()
+
+	if rawOutput(*asJSON) {
+		printResult(tickets)
+	} else if !quiet {
+		for _, t := range tickets {
+			if t.Status == "created" || t.Status == "exists" {
+				fmt.Printf("  %-12s %-8s %s\n", t.Number, t.Status, t.shortDescription())
+			}
+		}
+	}
+	status(created, "Created %d incident(s), %d already open\n", created, len(tickets)-len(pending))
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d incident(s) could not be created\n", failed)
+		exit(ExitPartial)
+	}
+}
+
+// snowActiveIncidents maps the correlation ids of active incidents to their
+// numbers.
+func snowActiveIncidents(snow *snowClient, tickets []*findingTicket) (map[string]string, error) {
+	existing := map[string]string{}
+	for start := 0; start < len(tickets); start += 100 {
+		end := start + 100
+		if end > len(tickets) {
+			end = len(tickets)
+		}
+		ids := make([]string, 0, end-start)
+		for _, t := range tickets[start:end] {
+			ids = append(ids, t.CorrelationID)
+		}
+		records, err := snow.query("incident", "active=true^correlation_idIN"+strings.Join(ids, ","), []string{"number", "correlation_id"})
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range records {
+			existing[stringField(r, "correlation_id")] = stringField(r, "number")
+		}
+	}
+	return existing, nil
+}
+
+// incident builds the incident record for the Table API.
+func (t *findingTicket) incident(group, category string) map[string]interface{} {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Reported by Secman for asset %s.\n\n", t.AssetName)
+	for _, f := range t.Findings {
+		fmt.Fprintf(&b, "%s  %s  open %v day(s)", stringField(f, "vulnerabilityId"), strings.ToUpper(stringField(f, "cvssSeverity")), f["daysOpen"])
+		if products := stringField(f, "vulnerableProductVersions"); products != "" {
+			fmt.Fprintf(&b, "  %s", products)
+		}
+		b.WriteString("\n")
+	}
+
+	record := map[string]interface{}{
+		"short_description":   truncate("Secman: "+t.shortDescription(), 160),
+		"description":         b.String(),
+		"correlation_id":      t.CorrelationID,
+		"correlation_display": "Secman",
+	}
+	if iu, ok := snowImpactUrgency[t.Severity]; ok {
+		record["impact"], record["urgency"] = iu[0], iu[1]
+	}
+	if group != "" {
+		record["assignment_group"] = group
+	}
+	if category != "" {
+		record["category"] = category
+	}
+	return record
+}
+
+func cmdCmdb(client *McpClient, osArgs []string) {
+	if len(osArgs) < 2 || osArgs[0] != "sync" {
+		fmt.Fprintf(os.Stderr, "Usage: %s cmdb sync servicenow [options]\n", progName())
+		exit(ExitUsage)
+	}
+	switch osArgs[1] {
+	case "servicenow":
+		cmdCmdbSyncServiceNow(client, osArgs[2:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown CMDB: %s (supported: servicenow)\n", osArgs[1])
+		exit(ExitUsage)
+	}
+}
+
+// cmdbMatch pairs a Secman asset with a CMDB configuration item.
+type cmdbMatch struct {
+	AssetID   int64  `json:"assetId"`
+	AssetName string `json:"assetName"`
+	CISysID   string `json:"ciSysId"`
+	CIName    string `json:"ciName"`
+	By        string `json:"matchedBy"`
+}
+
+// cmdbKeys lists the match keys in the order they are tried. A serial
+// number identifies hardware best; hostnames and IPs can be reused.
+var cmdbKeys = []string{"serial", "hostname", "ip"}
+
+func cmdCmdbSyncServiceNow(client *McpClient, osArgs []string) {
+	fs := flag.NewFlagSet("cmdb sync servicenow", flag.ContinueOnError)
+	table := fs.String("table", "cmdb_ci_computer", "CMDB table to compare with")
+	filter := fs.String("query", "", "Encoded query restricting the configuration items")
+	matchOn := fs.String("match", strings.Join(cmdbKeys, ","), "Keys to match on, tried in order: serial, hostname, ip")
+	fillSerials := fs.Bool("fill-serials", false, "Copy the CI's serial number to matched assets that have none")
+	asJSON := fs.Bool("json", false, "Print matches and orphans as JSON")
+	yes := addYesFlag(fs)
+	parseFlags(fs, osArgs)
+
+	keys := splitList(strings.ToLower(*matchOn))
+	for _, k := range keys {
+		if k != "serial" && k != "hostname" && k != "ip" {
+			fmt.Fprintf(os.Stderr, "Error: unknown match key %q (use serial, hostname, ip)\n", k)
+			exit(ExitUsage)
+		}
+	}
+	snow, err := newSnowClient(client)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(ExitUsage)
+	}
+
+	assets, err := listAll(client, "get_assets", "assets", map[string]interface{}{}, 500)
+	if err != nil {
+		fatal(err)
+	}
+	cis, err := snow.query(*table, *filter, []string{"sys_id", "name", "serial_number", "host_name", "fqdn", "ip_address"})
+	if err != nil {
+		fatal(err)
+	}
+
+	matches, assetOrphans, ciOrphans := reconcileCMDB(assets, cis, keys)
+
+	ciSerial := map[string]string{}
+	for _, ci := range cis {
+		ciSerial[stringField(ci, "sys_id")] = strings.TrimSpace(stringField(ci, "serial_number"))
+	}
+	var fills []cmdbMatch
+	if *fillSerials {
+		assetSerial := map[int64]string{}
+		for _, a := range assets {
+			assetSerial[int64(numberField(a, "id"))] = stringField(a, "serialNumber")
+		}
+		for _, m := range matches {
+			if assetSerial[m.AssetID] == "" && ciSerial[m.CISysID] != "" {
+				fills = append(fills, m)
+			}
+		}
+	}
+
+	if rawOutput(*asJSON) {
+		printResult(map[string]interface{}{
+			"matched":        matches,
+			"secmanOnly":     assetOrphans,
+			"servicenowOnly": ciOrphans,
+		})
+	} else {
+		byKey := map[string]int{}
+		for _, m := range matches {
+			byKey[m.By]++
+		}
+		var counts []string
+		for _, k := range keys {
+			counts = append(counts, fmt.Sprintf("%d by %s", byKey[k], k))
+		}
+		fmt.Printf("Secman assets:   %d\n", len(assets))
+		fmt.Printf("ServiceNow CIs:  %d (%s)\n", len(cis), *table)
+		fmt.Printf("Matched:         %d (%s)\n", len(matches), strings.Join(counts, ", "))
+		fmt.Printf("Only in Secman:  %d\n", len(assetOrphans))
+		fmt.Printf("Only in CMDB:    %d\n", len(ciOrphans))
+		if len(assetOrphans) > 0 {
+			fmt.Println("\nAssets without a configuration item:")
+			for _, a := range assetOrphans {
+				fmt.Printf("  %-8v %-30s %-15s %s\n", a["id"], stringField(a, "name"), stringField(a, "ip"), stringField(a, "serialNumber"))
+			}
+		}
+		if len(ciOrphans) > 0 {
+			fmt.Println("\nConfiguration items without a Secman asset:")
+			for _, ci := range ciOrphans {
+				fmt.Printf("  %-32s %-30s %-15s %s\n", stringField(ci, "sys_id"), stringField(ci, "name"), stringField(ci, "ip_address"), stringField(ci, "serial_number"))
+			}
+		}
+	}
+
+	if len(fills) == 0 {
+		return
+	}
+	if err := client.requireTool("update_asset"); err != nil {
+		fatal(err)
+	}
+	summary := []string{fmt.Sprintf("%d asset(s)", len(fills))}
+	for i, m := range fills {
+		if i == 20 {
+			summary = append(summary, fmt.Sprintf("... and %d more", len(fills)-20))
+			break
+		}
+		summary = append(summary, fmt.Sprintf("%-8d %s <- %s", m.AssetID, m.AssetName, m.CIName))
+	}
+	if err := confirm(client, *yes, "copy serial numbers from ServiceNow", summary); err != nil {
+		fatal(err)
+	}
+	updated, failed := 0, 0
+	for _, m := range fills {
+		_, err := client.callToolMap("update_asset", map[string]interface{}{"assetId": m.AssetID, "serialNumber": ciSerial[m.CISysID]})
+		if err != nil {
+			warnf("  asset %d: %v\n", m.AssetID, err)
+			failed++
+			continue
+		}
+		updated++
+	}
+	status(updated, "Filled the serial number of %d asset(s)\n", updated)
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d update(s) failed\n", failed)
+		exit(ExitPartial)
+	}
+}
+
+// reconcileCMDB pairs assets with configuration items, one key at a time so
+// that a serial match wins over a hostname or IP match. Each asset and each
+// CI is matched at most once; a key value shared by several CIs matches the
+// first one not yet taken.
+func reconcileCMDB(assets, cis []map[string]interface{}, keys []string) (matches []cmdbMatch, assetOrphans, ciOrphans []map[string]interface{}) {
+	assetDone := make([]bool, len(assets))
+	ciDone := make([]bool, len(cis))
+	for _, key := range keys {
+		index := map[string][]int{}
+		for i, ci := range cis {
+			for _, v := range cmdbValues(key, ci, true) {
+				index[v] = append(index[v], i)
+			}
+		}
+		for i, a := range assets {
+			if assetDone[i] {
+				continue
+			}
+		values:
+			for _, v := range cmdbValues(key, a, false) {
+				for _, j := range index[v] {
+					if ciDone[j] {
+						continue
+					}
+					assetDone[i], ciDone[j] = true, true
+					matches = append(matches, cmdbMatch{
+						AssetID:   int64(numberField(a, "id")),
+						AssetName: stringField(a, "name"),
+						CISysID:   stringField(cis[j], "sys_id"),
+						CIName:    stringField(cis[j], "name"),
+						By:        key,
+					})
+					break values
+				}
+			}
+		}
+	}
+	for i, a := range assets {
+		if !assetDone[i] {
+			assetOrphans = append(assetOrphans, a)
+		}
+	}
+	for j, ci := range cis {
+		if !ciDone[j] {
+			ciOrphans = append(ciOrphans, ci)
+		}
+	}
+	return matches, assetOrphans, ciOrphans
+}
+
+// cmdbValues returns the normalized values of a match key for an asset or,
+// with ci set, a configuration item. Hostnames are compared without their
+// domain, so "web01" matches "web01.example.com".
+func cmdbValues(key string, record map[string]interface{}, ci bool) []string {
+	var raw []string
+	switch {
+	case key == "serial" && ci:
+		raw = []string{stringField(record, "serial_number")}
+	case key == "serial":
+		raw = []string{stringField(record, "serialNumber")}
+	case key == "hostname" && ci:
+		raw = []string{stringField(record, "name"), stringField(record, "host_name"), stringField(record, "fqdn")}
+	case key == "hostname":
+		raw = []string{stringField(record, "name")}
+	case key == "ip" && ci:
+		raw = splitList(stringField(record, "ip_address"))
+	case key == "ip":
+		raw = splitList(stringField(record, "ip"))
+	}
+
+	var values []string
+	seen := map[string]bool{}
+	for _, v := range raw {
+		v = strings.TrimSpace(v)
+		switch key {
+		case "serial":
+			v = strings.ToUpper(v)
+		case "hostname":
+			v = strings.ToLower(v)
+			if net.ParseIP(v) == nil {
+				v, _, _ = strings.Cut(v, ".")
+			}
+		case "ip":
+			if ip := net.ParseIP(v); ip != nil {
+				v = ip.String()
+			} else {
+				v = ""
+			}
+		}
+		if v != "" && !seen[v] {
+			seen[v] = true
+			values = append(values, v)
+		}
+	}
+	return values
+}
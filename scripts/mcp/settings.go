@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/schmalle/secman/scripts/mcp/config"
+)
+
+// settings holds the layered configuration: flags, environment, .env file,
+// profile and defaults, in that order of precedence.
+var settings *config.Config
+
+// settingDefaults is the lowest configuration layer.
+var settingDefaults = map[string]string{
+	"SECMAN_BASE_URL": "http://localhost:8080",
+}
+
+// settingFlags maps global flags onto the settings they override.
+var settingFlags = map[string]string{
+	"base-url":        "SECMAN_BASE_URL",
+	"user-email":      "SECMAN_USER_EMAIL",
+	"tenant":          "SECMAN_TENANT",
+	"org":             "SECMAN_TENANT",
+	"strict-tls":      "SECMAN_STRICT_TLS",
+	"severity-map":    "SECMAN_SEVERITY_MAP",
+	"transcript":      "SECMAN_TRANSCRIPT",
+	"tool-timeout":    "SECMAN_TOOL_TIMEOUT",
+	"max-result-size": "SECMAN_TOOL_MAX_SIZE",
+	"max-pages":       "SECMAN_TOOL_MAX_PAGES",
+	"tool-limits":     "SECMAN_TOOL_LIMITS",
+	"tfdata-version":  "SECMAN_TFDATA_VERSION",
+}
+
+// setting returns a configured value, or "" when it is not set anywhere.
+func setting(key string) string {
+	return settings.Get(key)
+}
+
+// settingOr returns a configured value, or def when it is not set anywhere.
+func settingOr(key, def string) string {
+	return settings.GetDefault(key, def)
+}
+
+// trustedSetting returns a configured value, leaving out an env file the
+// client found rather than was given; see config.GetTrusted.
+func trustedSetting(key string) string {
+	return settings.GetTrusted(key)
+}
+
+// trustedSettingOr is trustedSetting with a default.
+func trustedSettingOr(key, def string) string {
+	if v := trustedSetting(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// secretSettings are masked by the config command.
+var secretSettings = []string{
+	"SECMAN_MCP_KEY", "SECMAN_ANONYMIZE_KEY", "SECMAN_SERVICENOW_PASSWORD", "SECMAN_SERVICENOW_TOKEN",
+	"SECMAN_PAGERDUTY_ROUTING_KEY", "SECMAN_OPSGENIE_API_KEY", "SECMAN_SMTP_PASSWORD",
+	"SECMAN_NATS_PASSWORD", "SECMAN_NATS_TOKEN", "SECMAN_KAFKA_REST_PASSWORD",
+	"AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "SECMAN_AZURE_STORAGE_KEY", "SECMAN_AZURE_STORAGE_SAS", "SECMAN_GCS_TOKEN",
+	"SECMAN_GRAFANA_TOKEN", "SECMAN_AZURE_DEVOPS_TOKEN", "SECMAN_DEFECTDOJO_TOKEN", "SECMAN_NETBOX_TOKEN", "SECMAN_HIBP_API_KEY", "SECMAN_LLM_API_KEY", "SECMAN_GITHUB_TOKEN", "SECMAN_GITLAB_TOKEN",
+	"SECMAN_GATE_CONFIG_TOKEN", "AZURE_CLIENT_SECRET", "AZURE_ACCESS_TOKEN", "GOOGLE_OAUTH_ACCESS_TOKEN",
+	"SECMAN_LDAP_PASSWORD",
+}
+
+// cmdConfig shows every setting with the layer it was taken from.
+func cmdConfig(osArgs []string) {
+	if len(osArgs) > 0 {
+		fmt.Fprintf(os.Stderr, "Usage: %s [--profile <name>] [--env-file <file>] config\n", progName())
+		exit(ExitUsage)
+	}
+
+	envFile, profileFile := settings.EnvFile, settings.ProfileFile
+	if envFile == "" {
+		envFile = "(none)"
+	}
+	if profileFile == "" {
+		profileFile = "(not found: " + config.ProfilePath() + ")"
+	}
+	fmt.Printf("Env file: %s\n", envFile)
+	fmt.Printf("Profile:  %s from %s\n\n", settings.ProfileName, profileFile)
+
+	for _, key := range settings.Keys() {
+		value, source, _ := settings.Lookup(key)
+		for _, secret := range secretSettings {
+			if strings.HasPrefix(key, secret) {
+				value = maskSecret(value)
+			}
+		}
+		fmt.Printf("  %-28s %-40s %s\n", key, value, source)
+	}
+	for key, err := range settings.Unresolved {
+		fmt.Printf("  %-28s %-40s %s\n", key, "(keyring: reference, not resolved)", err)
+	}
+	for _, key := range settings.Skipped {
+		if strings.HasPrefix(key, "SECMAN_") {
+			if _, _, ok := settings.Lookup(key); !ok {
+				fmt.Printf("  %-28s %-40s %s\n", key, "(pass:// reference, not resolved)", config.SourceDotEnv)
+			}
+		}
+	}
+}
+
+func maskSecret(v string) string {
+	if len(v) <= 8 {
+		return strings.Repeat("*", len(v))
+	}
+	return v[:4] + strings.Repeat("*", 8)
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+)
+
+// Scanners rate the same weakness differently: a Nessus "Medium" can carry
+// a CVSS score CrowdStrike would call HIGH. A severity map puts findings
+// from every scanner on one scale, so reports and gates compare them
+// consistently:
+//
+//	rules:
+//	  - source: nessus
+//	    severity: MEDIUM
+//	    min-cvss: 6.5
+//	    to: HIGH
+//	  - source: XLSX
+//	    severity: INFO
+//	    to: LOW
+//
+// The first matching rule wins. A rule without source, severity or a CVSS
+// bound matches any finding in that respect; a CVSS bound only matches
+// findings that carry a score (cvss, cvssScore or cvssBaseScore).
+//
+// The map applies when findings are imported (the criticality argument of
+// add_vulnerability, with scanner or source and cvss taken from the same
+// record) and when they are displayed (cvssSeverity in tool results, the
+// server's value kept as originalSeverity). Backups, snapshots and bundles
+// keep the severities the server holds.
+
+// severityScale is what a rule may map from and to.
+var severityScale = append(append([]string{}, severityOrder...), "INFO")
+
+type severityRule struct {
+	Source   string   `json:"source,omitempty"`
+	Severity string   `json:"severity,omitempty"`
+	MinCVSS  *float64 `json:"min-cvss,omitempty"`
+	MaxCVSS  *float64 `json:"max-cvss,omitempty"`
+	To       string   `json:"to"`
+}
+
+type severityMap struct {
+	Rules []severityRule `json:"rules"`
+
+	source string
+}
+
+// severityMapPath returns SECMAN_SEVERITY_MAP, or "" when it is unset or
+// "off".
+func severityMapPath() string {
+	path := setting("SECMAN_SEVERITY_MAP")
+	if strings.EqualFold(path, "off") {
+		return ""
+	}
+	return path
+}
+
+// loadSeverityMap reads a severity map from a YAML or JSON file.
+func loadSeverityMap(path string) (*severityMap, error) {
+	data, err := readTextFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("severity map %s does not exist", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var doc interface{}
+	if trimmed := strings.TrimSpace(string(data)); strings.HasPrefix(trimmed, "{") {
+		err = json.Unmarshal(data, &doc)
+	} else {
+		doc, err = parseYAML(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	m := &severityMap{source: path}
+	if err := remarshal(doc, m); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for i := range m.Rules {
+		r := &m.Rules[i]
+		r.Severity, r.To = strings.ToUpper(r.Severity), strings.ToUpper(r.To)
+		if !containsFold(severityScale, r.To) {
+			return nil, fmt.Errorf("%s: rule %d: to must be one of %s", path, i+1, strings.Join(severityScale, ", "))
+		}
+		if r.Severity != "" && !containsFold(severityScale, r.Severity) {
+			return nil, fmt.Errorf("%s: rule %d: severity must be one of %s", path, i+1, strings.Join(severityScale, ", "))
+		}
+		if r.MinCVSS != nil && r.MaxCVSS != nil && *r.MinCVSS > *r.MaxCVSS {
+			return nil, fmt.Errorf("%s: rule %d: min-cvss is above max-cvss", path, i+1)
+		}
+	}
+	return m, nil
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalize returns the severity the first matching rule maps to, and
+// whether one matched.
+func (m *severityMap) normalize(source, severity string, cvss float64, hasCVSS bool) (string, bool) {
+	for _, r := range m.Rules {
+		switch {
+		case r.Source != "" && !strings.EqualFold(r.Source, source):
+		case r.Severity != "" && !strings.EqualFold(r.Severity, severity):
+		case (r.MinCVSS != nil || r.MaxCVSS != nil) && !hasCVSS:
+		case r.MinCVSS != nil && cvss < *r.MinCVSS:
+		case r.MaxCVSS != nil && cvss > *r.MaxCVSS:
+		default:
+			return r.To, true
+		}
+	}
+	return severity, false
+}
+
+// cvssScore returns the CVSS base score of a record, if it has one.
+func cvssScore(m map[string]interface{}) (float64, bool) {
+	for _, key := range []string{"cvss", "cvssScore", "cvssBaseScore"} {
+		switch v := m[key].(type) {
+		case float64:
+			return v, true
+		case string:
+			if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				return f, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// importArgs maps the criticality of add_vulnerability arguments. The
+// record's scanner, source and CVSS keys are dropped unless the tool takes
+// them.
+func (m *severityMap) importArgs(client *McpClient, tool string, args map[string]interface{}) map[string]interface{} {
+	severity := stringField(args, "criticality")
+	if severity == "" {
+		return args
+	}
+	source := stringField(args, "scanner")
+	if source == "" {
+		source = stringField(args, "source")
+	}
+	cvss, hasCVSS := cvssScore(args)
+	out := make(map[string]interface{}, len(args))
+	for k, v := range args {
+		switch k {
+		case "scanner", "source", "cvss", "cvssScore", "cvssBaseScore":
+			if ok, _ := client.toolAccepts(tool, k); !ok {
+				continue
+			}
+		}
+		out[k] = v
+	}
+	if to, ok := m.normalize(source, severity, cvss, hasCVSS); ok {
+		out["criticality"] = to
+	}
+	return out
+}
+
+// applyResult maps cvssSeverity in the findings of a tool result.
+func (m *severityMap) applyResult(content interface{}) {
+	doc, _ := content.(map[string]interface{})
+	for _, key := range []string{"vulnerabilities", "findings"} {
+		list, _ := doc[key].([]interface{})
+		for _, item := range list {
+			f, ok := item.(map[string]interface{})
+			if !ok || f["cvssSeverity"] == nil {
+				continue
+			}
+			severity := stringField(f, "cvssSeverity")
+			cvss, hasCVSS := cvssScore(f)
+			if to, ok := m.normalize(stringField(f, "source"), severity, cvss, hasCVSS); ok && !strings.EqualFold(to, severity) {
+				f["originalSeverity"] = severity
+				f["cvssSeverity"] = to
+			}
+		}
+	}
+}
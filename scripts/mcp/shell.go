@@ -0,0 +1,360 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/schmalle/secman/scripts/mcp/config"
+)
+
+// The shell keeps one client (API key, delegation, tenant and the cached
+// tool list) for the whole session. Every CLI command works at the prompt,
+// and a tool name followed by key=value pairs calls that tool directly:
+//
+//	secman> get_assets type=SERVER pageSize=5
+//	secman> vulnerabilities --severity CRITICAL
+
+// historyLimit is the number of lines kept in the history file.
+const historyLimit = 1000
+
+// shellExit carries a command's exit code from exit() back to the prompt.
+type shellExit int
+
+var shellBuiltins = []string{"exit", "quit", "help", "tools", "history", "whoami", "as", "tenant"}
+
+func cmdShell(client *McpClient, osArgs []string) {
+	fs := flag.NewFlagSet("shell", flag.ContinueOnError)
+	historyFile := fs.String("history", defaultHistoryFile(), "History file (empty to disable)")
+	parseFlags(fs, osArgs)
+
+	names, err := client.ToolNames()
+	if err != nil {
+		fatal(err)
+	}
+	if !quiet {
+		fmt.Fprintf(os.Stderr, "Connected to %s (%d tools). Type 'help' for commands, 'exit' to quit.\n",
+			client.BaseURL, len(names))
+	}
+
+	editor := newLineEditor(os.Stdin, os.Stdout, func(line string) (int, []string) {
+		return completeShell(client, line)
+	})
+	editor.history = readHistory(*historyFile)
+
+	prevExit := exit
+	exit = func(code int) { panic(shellExit(code)) }
+	defer func() { exit = prevExit }()
+
+	for {
+		line, err := editor.readLine(shellPrompt(client))
+		if err == errInterrupted {
+			continue
+		}
+		if err != nil {
+			return
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		editor.addHistory(line)
+		appendHistory(*historyFile, line)
+
+		words, err := splitWords(line)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			continue
+		}
+		switch words[0] {
+		case "exit", "quit":
+			return
+		case "help":
+			shellHelp()
+			continue
+		case "history":
+			for i, h := range editor.history {
+				fmt.Printf("%5d  %s\n", i+1, h)
+			}
+			continue
+		case "shell":
+			fmt.Fprintln(os.Stderr, "Error: already in a shell")
+			continue
+		}
+
+		if code := runShellCommand(client, words); code != ExitOK {
+			fmt.Fprintln(os.Stderr, paintErr(styleFail, fmt.Sprintf("(exit %d)", code)))
+		}
+	}
+}
+
+// runShellCommand runs one shell line and returns its exit code. Commands
+// end with exit(), which the shell turns into a panic recovered here.
+func runShellCommand(client *McpClient, words []string) (code int) {
+	defer func() {
+		if r := recover(); r != nil {
+			if c, ok := r.(shellExit); ok {
+				code = int(c)
+				return
+			}
+			panic(r)
+		}
+	}()
+
+	switch words[0] {
+	case "tools":
+		cmdCapabilities(client, words[1:])
+	case "whoami":
+		fmt.Printf("Server:  %s\n", client.BaseURL)
+		fmt.Printf("User:    %s\n", orNone(client.UserEmail))
+		fmt.Printf("Tenant:  %s\n", orNone(client.Tenant))
+	case "as":
+		// Delegation changes which tools the server exposes, so the
+		// tool list is fetched again.
+		client.UserEmail = strings.Join(words[1:], "")
+		client.resetTools()
+		names, err := client.ToolNames()
+		if err != nil {
+			fatal(err)
+		}
+		fmt.Fprintf(os.Stderr, "Acting as %s (%d tools)\n", orNone(client.UserEmail), len(names))
+	case "tenant":
+		client.Tenant = strings.Join(words[1:], "")
+		fmt.Fprintf(os.Stderr, "Tenant: %s\n", orNone(client.Tenant))
+	default:
+		if isCommand(words[0]) {
+			dispatch(client, words)
+			break
+		}
+		if ok, _ := client.HasTool(words[0]); ok {
+			callToolWords(client, words[0], words[1:])
+			break
+		}
+		if path, n := findPlugin(words); path != "" {
+			runPlugin(client, path, words[n:])
+			break
+		}
+		fmt.Fprintf(os.Stderr, "Unknown command or tool: %s (type 'help')\n", words[0])
+		exit(ExitUsage)
+	}
+	return ExitOK
+}
+
+// callToolWords calls a tool with key=value arguments. Values that parse
+// as JSON (numbers, booleans, arrays, objects) are passed as such; anything
+// else is a string.
+func callToolWords(client *McpClient, tool string, words []string) {
+	args := map[string]interface{}{}
+	for _, w := range words {
+		key, value, ok := strings.Cut(w, "=")
+		if !ok || key == "" {
+			fmt.Fprintf(os.Stderr, "Error: expected key=value, got %q\n", w)
+			exit(ExitUsage)
+		}
+		var v interface{}
+		if err := json.Unmarshal([]byte(value), &v); err != nil {
+			v = value
+		}
+		args[key] = v
+	}
+	result, err := client.CallTool(tool, args)
+	if err != nil {
+		fatal(err)
+	}
+	printResult(result)
+}
+
+func isCommand(name string) bool {
+	for _, c := range commandNames {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+	return s
+}
+
+func shellPrompt(client *McpClient) string {
+	if client.Tenant != "" {
+		return "secman[" + client.Tenant + "]> "
+	}
+	return "secman> "
+}
+
+func shellHelp() {
+	fmt.Print(`Shell commands:
+  <command> [flags]       Any CLI command, e.g. assets --type SERVER
+  <tool> [key=value]...   Call a tool; values are JSON if they parse, else strings
+  tools                   List available tools
+  whoami                  Show server, delegated user and tenant
+  as <email>              Delegate to another user (empty to stop delegating)
+  tenant <name>           Switch tenant (empty to clear)
+  history                 Show command history
+  exit, quit              Leave the shell (or Ctrl-D)
+
+Tab completes commands, tool names and tool argument names.
+`)
+}
+
+// completeShell returns completion candidates for the word before the
+// cursor: commands and tools for the first word, tool names after "call",
+// and the tool's inputSchema properties (as "name=") after a tool name.
+func completeShell(client *McpClient, line string) (int, []string) {
+	runes := []rune(line)
+	start := len(runes)
+	for start > 0 && runes[start-1] != ' ' {
+		start--
+	}
+	word := string(runes[start:])
+	prev := strings.Fields(string(runes[:start]))
+
+	var options []string
+	switch {
+	case len(prev) == 0:
+		options = append(options, shellBuiltins...)
+		options = append(options, commandNames...)
+		options = append(options, toolNames(client)...)
+	case prev[0] == "call" && len(prev) == 1:
+		options = toolNames(client)
+	case !isCommand(prev[0]):
+		tool, ok, _ := client.Tool(prev[0])
+		if !ok || strings.Contains(word, "=") {
+			break
+		}
+		used := map[string]bool{}
+		for _, p := range prev[1:] {
+			key, _, _ := strings.Cut(p, "=")
+			used[key] = true
+		}
+		props, _ := tool.InputSchema["properties"].(map[string]interface{})
+		for name := range props {
+			if !used[name] {
+				options = append(options, name+"=")
+			}
+		}
+	}
+
+	var candidates []string
+	seen := map[string]bool{}
+	for _, o := range options {
+		if strings.HasPrefix(o, word) && !seen[o] {
+			seen[o] = true
+			candidates = append(candidates, o)
+		}
+	}
+	sort.Strings(candidates)
+	return start, candidates
+}
+
+func toolNames(client *McpClient) []string {
+	names, _ := client.CallableToolNames()
+	return names
+}
+
+// splitWords splits a shell line into words, honouring single and double
+// quotes and backslash escapes.
+func splitWords(line string) ([]string, error) {
+	var words []string
+	var cur strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+	for _, r := range line {
+		switch {
+		case escaped:
+			cur.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inWord = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		default:
+			cur.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inWord {
+		words = append(words, cur.String())
+	}
+	return words, nil
+}
+
+func defaultHistoryFile() string {
+	return statePath(".secman_history", "history")
+}
+
+// statePath returns name in the state directory, or the legacy dotfile in
+// the home directory where earlier versions kept it, if that exists.
+func statePath(legacy, name string) string {
+	if home, err := os.UserHomeDir(); err == nil {
+		if _, err := os.Stat(filepath.Join(home, legacy)); err == nil {
+			return filepath.Join(home, legacy)
+		}
+	}
+	dir, err := config.StateDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, name)
+}
+
+// readHistory loads the last historyLimit lines of the history file and
+// rewrites it when it has grown past twice that.
+func readHistory(path string) []string {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	text := strings.TrimRight(string(data), "\n")
+	if text == "" {
+		return nil
+	}
+	lines := strings.Split(text, "\n")
+	if len(lines) > historyLimit {
+		if len(lines) > 2*historyLimit {
+			lines = lines[len(lines)-historyLimit:]
+			writeStateFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600)
+		}
+		lines = lines[len(lines)-historyLimit:]
+	}
+	return lines
+}
+
+// appendHistory adds a line to the history file right away, so history
+// survives a killed session.
+func appendHistory(path, line string) {
+	if path == "" {
+		return
+	}
+	appendStateFile(path, []byte(line+"\n"), 0600)
+}
@@ -0,0 +1,449 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/schmalle/secman/scripts/mcp/config"
+)
+
+// Snapshots answer "what did we know on date X" without history on the
+// server. `snapshot take` stores what the read tools return, in the backup
+// format without attachments, in a local store. With the global --as-of
+// flag the read tools are then answered from the newest snapshot taken on
+// or before that date instead of the server, so the read commands work
+// unchanged; mutating tools are refused. Backup archives copied into the
+// store serve as snapshots too.
+
+// snapshotTimeLayout is the UTC time in snapshot file names:
+// snapshot-20241231-235900.tar.gz. Backups use the same suffix.
+const snapshotTimeLayout = "20060102-150405"
+
+func snapshotDir() string {
+	if dir := setting("SECMAN_SNAPSHOT_DIR"); dir != "" {
+		return dir
+	}
+	dir, err := config.Dir()
+	if err != nil {
+		return "secman-snapshots"
+	}
+	return filepath.Join(dir, "snapshots")
+}
+
+type snapshotFile struct {
+	Path  string    `json:"path"`
+	Taken time.Time `json:"taken"`
+}
+
+// listSnapshots returns the archives in dir whose name ends in a
+// timestamp, oldest first.
+func listSnapshots(dir string) ([]snapshotFile, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var out []snapshotFile
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".tar.gz") {
+			continue
+		}
+		base := strings.TrimSuffix(name, ".tar.gz")
+		if len(base) < len(snapshotTimeLayout) {
+			continue
+		}
+		t, err := time.Parse(snapshotTimeLayout, base[len(base)-len(snapshotTimeLayout):])
+		if err != nil {
+			continue
+		}
+		out = append(out, snapshotFile{Path: filepath.Join(dir, name), Taken: t})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Taken.Before(out[j].Taken) })
+	return out, nil
+}
+
+// parseAsOf reads an --as-of value: a date, meaning the end of that day in
+// UTC, or any other time expression (parseTimeExpr).
+func parseAsOf(s string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t.Add(24*time.Hour - time.Second), nil
+	}
+	t, err := parseTimeExpr(s, time.Now())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("--as-of: %w", err)
+	}
+	return t, nil
+}
+
+// snapshotStore answers read tools from one snapshot.
+type snapshotStore struct {
+	path     string
+	manifest *BackupManifest
+	sections map[string][]map[string]interface{}
+}
+
+// openSnapshotAsOf loads the newest snapshot in the store taken at or
+// before asOf.
+func openSnapshotAsOf(asOf time.Time) (*snapshotStore, error) {
+	dir := snapshotDir()
+	files, err := listSnapshots(dir)
+	if err != nil {
+		return nil, err
+	}
+	var pick *snapshotFile
+	for i := range files {
+		if !files[i].Taken.After(asOf) {
+			pick = &files[i]
+		}
+	}
+	if pick == nil {
+		if len(files) == 0 {
+			return nil, fmt.Errorf("no snapshots in %s; take them with `snapshot take`", dir)
+		}
+		return nil, fmt.Errorf("no snapshot taken on or before %s; the oldest in %s is from %s",
+			asOf.Format(time.RFC3339), dir, files[0].Taken.Format(time.RFC3339))
+	}
+	manifest, sections, _, err := readBackup(pick.Path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", pick.Path, err)
+	}
+	return &snapshotStore{path: pick.Path, manifest: manifest, sections: sections}, nil
+}
+
+// snapshotTools maps the read tools answered from a snapshot to their
+// section and list key.
+var snapshotTools = map[string]struct{ section, listKey string }{
+	"get_assets":                    {"assets", "assets"},
+	"get_vulnerabilities":           {"vulnerabilities", "vulnerabilities"},
+	"get_requirements":              {"requirements", "requirements"},
+	"get_assessments":               {"assessments", "assessments"},
+	"list_vulnerability_exceptions": {"exceptions", "exceptions"},
+	"list_releases":                 {"releases", "releases"},
+	"list_user_mappings":            {"user_mappings", "mappings"},
+}
+
+// paginatedSnapshotTools take page and pageSize.
+var paginatedSnapshotTools = map[string]bool{"get_assets": true, "get_vulnerabilities": true, "list_user_mappings": true}
+
+// tools returns the definitions of the tools the snapshot can answer,
+// standing in for the server's capabilities.
+func (s *snapshotStore) tools() map[string]ToolDefinition {
+	tools := map[string]ToolDefinition{}
+	for name, t := range snapshotTools {
+		if _, ok := s.sections[t.section]; !ok {
+			continue
+		}
+		props := map[string]interface{}{}
+		if paginatedSnapshotTools[name] {
+			props["page"] = map[string]interface{}{"type": "number"}
+			props["pageSize"] = map[string]interface{}{"type": "number"}
+		}
+		tools[name] = ToolDefinition{
+			Name:        name,
+			Description: "Answered from the snapshot of " + s.manifest.CreatedAt.Format(time.RFC3339),
+			InputSchema: map[string]interface{}{"type": "object", "properties": props},
+		}
+	}
+	return tools
+}
+
+func (s *snapshotStore) call(name string, args map[string]interface{}) (*ToolCallResult, error) {
+	if isMutatingTool(name) {
+		return nil, fmt.Errorf("%s changes data and cannot be called with --as-of", name)
+	}
+	t, ok := snapshotTools[name]
+	if !ok {
+		return nil, fmt.Errorf("%s cannot be answered from a snapshot; --as-of covers assets, vulnerabilities, requirements, assessments, exceptions, releases and user mappings", name)
+	}
+	items, ok := s.sections[t.section]
+	if !ok {
+		return nil, fmt.Errorf("the snapshot %s has no %s", s.path, t.section)
+	}
+
+	var matched []map[string]interface{}
+	for _, item := range items {
+		if snapshotMatches(name, item, args) {
+			matched = append(matched, item)
+		}
+	}
+	if matched == nil {
+		matched = []map[string]interface{}{}
+	}
+	content := map[string]interface{}{"asOf": s.manifest.CreatedAt.Format(time.RFC3339)}
+	switch {
+	case paginatedSnapshotTools[name]:
+		page, size := int(numberField(args, "page")), int(numberField(args, "pageSize"))
+		if size <= 0 {
+			size = int(numberField(args, "size"))
+		}
+		if size <= 0 {
+			size = 100
+		}
+		total := len(matched)
+		from := min(page*size, total)
+		content[t.listKey] = matched[from:min(from+size, total)]
+		content["total"] = total
+		content["page"] = page
+		content["pageSize"] = size
+		content["totalPages"] = int(math.Ceil(float64(total) / float64(size)))
+	case name == "get_requirements":
+		offset, limit := int(numberField(args, "offset")), int(numberField(args, "limit"))
+		if limit <= 0 {
+			limit = 50
+		}
+		total := len(matched)
+		from := min(offset, total)
+		content[t.listKey] = matched[from:min(from+limit, total)]
+		content["total"] = total
+		content["returned"] = min(from+limit, total) - from
+		content["limit"] = limit
+		content["offset"] = offset
+		content["hasMore"] = from+limit < total
+	default:
+		content[t.listKey] = matched
+		content["total"] = len(matched)
+	}
+	// Round-trip so that callers see the shapes a server response has.
+	var normalized interface{}
+	if err := remarshal(content, &normalized); err != nil {
+		return nil, err
+	}
+	return &ToolCallResult{Content: normalized}, nil
+}
+
+// snapshotMatches applies the filters of the read tools the way the server
+// does: partial matches are case-insensitive substrings.
+func snapshotMatches(tool string, item, args map[string]interface{}) bool {
+	contains := func(field, arg string) bool {
+		want := stringField(args, arg)
+		return want == "" || strings.Contains(strings.ToLower(stringField(item, field)), strings.ToLower(want))
+	}
+	equals := func(field, arg string) bool {
+		want := stringField(args, arg)
+		return want == "" || stringField(item, field) == want
+	}
+	inList := func(field, arg string) bool {
+		want := stringField(args, arg)
+		if want == "" {
+			return true
+		}
+		for _, v := range stringsField(item, field) {
+			if strings.EqualFold(v, want) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch tool {
+	case "get_assets":
+		return contains("name", "name") && equals("type", "type") && contains("ip", "ip") &&
+			equals("owner", "owner") && inList("groups", "group")
+	case "get_vulnerabilities":
+		if !contains("vulnerabilityId", "cveId") || !equals("assetId", "assetId") {
+			return false
+		}
+		if sevs, ok := args["severity"].([]interface{}); ok && len(sevs) > 0 {
+			found := false
+			for _, s := range sevs {
+				found = found || strings.EqualFold(fmt.Sprint(s), stringField(item, "cvssSeverity"))
+			}
+			if !found {
+				return false
+			}
+		}
+		scanned := stringField(item, "scanTimestamp")
+		if start := stringField(args, "startDate"); start != "" && scanned < start {
+			return false
+		}
+		if end := stringField(args, "endDate"); end != "" && scanned > end {
+			return false
+		}
+		return true
+	case "get_requirements":
+		if search := strings.ToLower(stringField(args, "search")); search != "" &&
+			!strings.Contains(strings.ToLower(stringField(item, "shortreq")+" "+stringField(item, "description")), search) {
+			return false
+		}
+		return inList("usecases", "usecase") && inList("norms", "norm") && contains("chapter", "chapter")
+	}
+	return true
+}
+
+func cmdSnapshot(client *McpClient, osArgs []string) {
+	if len(osArgs) < 1 {
+		fmt.Fprintf(os.Stderr, "Usage: %s snapshot <take|list> ...\n", progName())
+		exit(ExitUsage)
+	}
+	// Snapshots hold the severities the server has, not mapped ones.
+	client.severityMap = nil
+	switch osArgs[0] {
+	case "take":
+		cmdSnapshotTake(client, osArgs[1:])
+	case "list":
+		cmdSnapshotList(osArgs[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown snapshot subcommand: %s\n", osArgs[0])
+		exit(ExitUsage)
+	}
+}
+
+func cmdSnapshotTake(client *McpClient, osArgs []string) {
+	fs := flag.NewFlagSet("snapshot take", flag.ContinueOnError)
+	sections := fs.String("sections", "", "Comma-separated sections to include (default: all)")
+	keep := fs.Int("keep", 0, "Delete the oldest snapshots beyond this many (0: keep all)")
+	parseFlags(fs, osArgs)
+
+	if client.snapshot != nil {
+		fmt.Fprintln(os.Stderr, "Error: snapshot take cannot be used with --as-of")
+		exit(ExitUsage)
+	}
+	dir := snapshotDir()
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		fatal(err)
+	}
+	// The archive is written under another name and renamed once complete,
+	// so --as-of never reads one half written.
+	path := filepath.Join(dir, "snapshot-"+time.Now().UTC().Format(snapshotTimeLayout)+".tar.gz")
+	manifest, err := createBackup(client, path+".part", splitList(*sections), false)
+	if err != nil {
+		os.Remove(path + ".part")
+		fatal(err)
+	}
+	if err := os.Rename(path+".part", path); err != nil {
+		fatal(err)
+	}
+	status(path, "Snapshot written to %s\n", path)
+	for name, n := range manifest.Sections {
+		fmt.Printf("  %-18s %d\n", name, n)
+	}
+
+	if *keep > 0 {
+		// Another take pruning at the same time would count the same files.
+		unlock, err := lockState(dir, true)
+		if err != nil {
+			fatal(err)
+		}
+		defer unlock()
+		files, err := listSnapshots(dir)
+		if err != nil {
+			fatal(err)
+		}
+		for len(files) > *keep {
+			if err := os.Remove(files[0].Path); err != nil {
+				fatal(err)
+			}
+			status(nil, "Removed %s\n", files[0].Path)
+			files = files[1:]
+		}
+	}
+}
+
+func cmdSnapshotList(osArgs []string) {
+	fs := flag.NewFlagSet("snapshot list", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "Print the snapshots as JSON")
+	parseFlags(fs, osArgs)
+
+	dir := snapshotDir()
+	files, err := listSnapshots(dir)
+	if err != nil {
+		fatal(err)
+	}
+	if rawOutput(*asJSON) {
+		if files == nil {
+			files = []snapshotFile{}
+		}
+		printResult(map[string]interface{}{"directory": dir, "snapshots": files})
+		return
+	}
+	if len(files) == 0 {
+		status(nil, "No snapshots in %s\n", dir)
+		return
+	}
+	for _, f := range files {
+		fmt.Printf("%s  %s\n", f.Taken.Format(time.RFC3339), f.Path)
+	}
+}
+
+// resolvedFromSnapshots returns the findings that disappeared between two
+// consecutive snapshots, the later of which was taken within r. Each gets
+// "resolvedAt", the time of the first snapshot without it, and
+// "lastSeenOpen". The server keeps no resolved findings, so this is as
+// exact as the snapshot schedule.
+func resolvedFromSnapshots(r timeRange) ([]map[string]interface{}, error) {
+	dir := snapshotDir()
+	files, err := listSnapshots(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) < 2 {
+		return nil, fmt.Errorf("resolved findings are derived from at least two snapshots in %s; take them with `snapshot take`", dir)
+	}
+	open := func(f snapshotFile) (map[int64]map[string]interface{}, error) {
+		_, sections, _, err := readBackup(f.Path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Path, err)
+		}
+		vulns, ok := sections["vulnerabilities"]
+		if !ok {
+			return nil, nil
+		}
+		byID := make(map[int64]map[string]interface{}, len(vulns))
+		for _, v := range vulns {
+			byID[int64(numberField(v, "id"))] = v
+		}
+		return byID, nil
+	}
+
+	var resolved []map[string]interface{}
+	var prev map[int64]map[string]interface{}
+	prevFile := -1
+	for i := 1; i < len(files); i++ {
+		if !r.contains(files[i].Taken) {
+			continue
+		}
+		if prevFile != i-1 {
+			if prev, err = open(files[i-1]); err != nil {
+				return nil, err
+			}
+		}
+		cur, err := open(files[i])
+		if err != nil {
+			return nil, err
+		}
+		// A snapshot without the section says nothing about findings.
+		if prev != nil && cur != nil {
+			for id, v := range prev {
+				if _, still := cur[id]; still {
+					continue
+				}
+				item := make(map[string]interface{}, len(v)+2)
+				for k, val := range v {
+					item[k] = val
+				}
+				item["resolvedAt"] = files[i].Taken.Format(time.RFC3339)
+				item["lastSeenOpen"] = files[i-1].Taken.Format(time.RFC3339)
+				resolved = append(resolved, item)
+			}
+		}
+		prev, prevFile = cur, i
+	}
+	sort.Slice(resolved, func(i, j int) bool {
+		if a, b := stringField(resolved[i], "resolvedAt"), stringField(resolved[j], "resolvedAt"); a != b {
+			return a < b
+		}
+		return numberField(resolved[i], "id") < numberField(resolved[j], "id")
+	})
+	return resolved, nil
+}
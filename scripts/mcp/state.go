@@ -0,0 +1,494 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/schmalle/secman/scripts/mcp/config"
+)
+
+// Commands keep local state next to the config file and in the state
+// directory: checkpoints of watch and events, the record of uploaded scans,
+// campaigns, snapshots, the audit log and the shell history. A cron job
+// may write it while a watcher runs, or two CI steps on one runner at once,
+// so every change takes an exclusive lock on <file>.lock first. Files are
+// replaced through a temporary file of their own and renamed into place,
+// so a reader never sees half a file, and appends go in one write under
+// the lock. watch and events hold their state's lock while they run, so a
+// second watcher on the same state fails instead of alerting twice.
+//
+// Within a process the lock is reentrant: the saves of a watcher holding
+// its state's lock go through. Lock files are left in place; removing one
+// could let two processes lock different files of the same name.
+
+// errLocked is returned by tryLockFile when another process holds the lock.
+var errLocked = errors.New("locked by another process")
+
+// staleTempAge is how old a temporary file must be before state clean
+// takes it for the leftover of an interrupted write.
+const staleTempAge = time.Hour
+
+type heldStateLock struct {
+	f *os.File
+	n int
+}
+
+var (
+	stateLocksMu sync.Mutex
+	stateLocks   = map[string]*heldStateLock{}
+)
+
+// StateBusyError is returned when another process holds a state lock.
+type StateBusyError struct {
+	Path string
+	PID  int
+}
+
+func (e *StateBusyError) Error() string {
+	if e.PID > 0 {
+		return fmt.Sprintf("%s is in use by another process (pid %d)", e.Path, e.PID)
+	}
+	return fmt.Sprintf("%s is in use by another process", e.Path)
+}
+
+// lockState takes the lock of the state at path, waiting for it, or with
+// wait false failing with a *StateBusyError. The returned function releases
+// it.
+func lockState(path string, wait bool) (func(), error) {
+	key, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	release := func() {
+		stateLocksMu.Lock()
+		defer stateLocksMu.Unlock()
+		if l := stateLocks[key]; l != nil {
+			if l.n--; l.n == 0 {
+				unlockFile(l.f)
+				l.f.Close()
+				delete(stateLocks, key)
+			}
+		}
+	}
+	stateLocksMu.Lock()
+	if l := stateLocks[key]; l != nil {
+		l.n++
+		stateLocksMu.Unlock()
+		return release, nil
+	}
+	stateLocksMu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(key), 0o700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(key+".lock", os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if wait {
+		err = lockFile(f)
+	} else {
+		err = tryLockFile(f)
+	}
+	if errors.Is(err, errLocked) {
+		f.Close()
+		return nil, &StateBusyError{Path: path, PID: lockHolder(key)}
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("lock %s: %w", path, err)
+	}
+	// The holder's pid, for the error above and state show.
+	if f.Truncate(0) == nil {
+		f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+
+	stateLocksMu.Lock()
+	defer stateLocksMu.Unlock()
+	if l := stateLocks[key]; l != nil {
+		// Another goroutine of this process got it meanwhile.
+		unlockFile(f)
+		f.Close()
+		l.n++
+	} else {
+		stateLocks[key] = &heldStateLock{f: f, n: 1}
+	}
+	return release, nil
+}
+
+// holdState takes the state's lock for a command that keeps running, or
+// ends the command when another process has it.
+func holdState(path, flagName string) func() {
+	release, err := lockState(path, false)
+	var busy *StateBusyError
+	if errors.As(err, &busy) {
+		fmt.Fprintf(os.Stderr, "Error: %v; give each instance its own %s\n", err, flagName)
+		exit(ExitUsage)
+	}
+	if err != nil {
+		fatal(err)
+	}
+	return release
+}
+
+// lockHolder reads the pid recorded in the lock file of the state at
+// path, or 0.
+func lockHolder(path string) int {
+	data, err := os.ReadFile(path + ".lock")
+	if err != nil {
+		return 0
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	return pid
+}
+
+// writeStateFile replaces the file at path with data under its lock.
+func writeStateFile(path string, data []byte, perm os.FileMode) error {
+	unlock, err := lockState(path, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil && !errors.Is(err, errors.ErrUnsupported) {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// appendStateFile appends data to the file at path under its lock.
+func appendStateFile(path string, data []byte, perm os.FileMode) error {
+	unlock, err := lockState(path, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// stateItem is a piece of local state that state show lists and state
+// clean removes by name.
+type stateItem struct {
+	Name     string     `json:"name"`
+	Kind     string     `json:"kind"`
+	Path     string     `json:"path"`
+	Dir      bool       `json:"dir,omitempty"`
+	Exists   bool       `json:"exists"`
+	Files    int        `json:"files,omitempty"`
+	Size     int64      `json:"size"`
+	Modified *time.Time `json:"modified,omitempty"`
+	InUse    bool       `json:"inUse,omitempty"`
+	PID      int        `json:"pid,omitempty"`
+}
+
+// State kinds.
+const (
+	stateCheckpoint = "checkpoint"
+	stateRecord     = "record"
+	stateData       = "data"
+	stateSnapshots  = "snapshots"
+	stateLog        = "log"
+	stateHistory    = "history"
+)
+
+// stateItems returns the state at its configured paths; disabled state
+// (SECMAN_AUDIT_LOG=off) is left out.
+func stateItems() []stateItem {
+	items := []stateItem{
+		{Name: "watch-state", Kind: stateCheckpoint, Path: watchStatePath()},
+		{Name: "events-state", Kind: stateCheckpoint, Path: eventStatePath()},
+		{Name: "events-cursor", Kind: stateCheckpoint, Path: eventCursorPath()},
+		{Name: "scan-uploads", Kind: stateRecord, Path: scanStatePath()},
+		{Name: "defectdojo-map", Kind: stateRecord, Path: ddMapPath()},
+		{Name: "campaigns", Kind: stateData, Path: campaignDir(), Dir: true},
+		{Name: "applicability", Kind: stateData, Path: applicabilityPath()},
+		{Name: "control-tests", Kind: stateData, Path: controlTestPath()},
+		{Name: "snapshots", Kind: stateSnapshots, Path: snapshotDir(), Dir: true},
+		{Name: "audit-log", Kind: stateLog, Path: auditLogPath()},
+		{Name: "history", Kind: stateHistory, Path: defaultHistoryFile()},
+	}
+	kept := items[:0]
+	for _, item := range items {
+		if item.Path != "" {
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
+
+// stat fills in what is on disk.
+func (s *stateItem) stat() {
+	info, err := os.Stat(s.Path)
+	if err != nil {
+		return
+	}
+	s.Exists = true
+	modified := info.ModTime()
+	if !s.Dir {
+		s.Size = info.Size()
+	} else {
+		for _, f := range stateDirFiles(s.Path) {
+			s.Files++
+			s.Size += f.Size()
+			if f.ModTime().After(modified) {
+				modified = f.ModTime()
+			}
+		}
+	}
+	s.Modified = &modified
+	release, err := lockState(s.Path, false)
+	var busy *StateBusyError
+	switch {
+	case err == nil:
+		release()
+	case errors.As(err, &busy):
+		s.InUse, s.PID = true, busy.PID
+	}
+}
+
+// stateDirFiles returns the files of a state directory, without lock and
+// temporary files.
+func stateDirFiles(dir string) []fs.FileInfo {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var files []fs.FileInfo
+	for _, e := range entries {
+		if e.IsDir() || isStateScratch(e.Name()) {
+			continue
+		}
+		if info, err := e.Info(); err == nil {
+			files = append(files, info)
+		}
+	}
+	return files
+}
+
+// isStateScratch reports whether name is a lock file or the temporary file
+// of a write.
+func isStateScratch(name string) bool {
+	return strings.HasSuffix(name, ".lock") || strings.HasSuffix(name, ".tmp") || strings.HasSuffix(name, ".part")
+}
+
+// stateRoots are the directories state is kept in, for state show and
+// the leftovers state clean looks for.
+func stateRoots() []string {
+	var roots []string
+	if dir, err := config.Dir(); err == nil {
+		roots = append(roots, dir)
+	}
+	if dir, err := config.StateDir(); err == nil && !containsString(roots, dir) {
+		roots = append(roots, dir)
+	}
+	return roots
+}
+
+func cmdState(dryRun bool, osArgs []string) {
+	if len(osArgs) < 1 {
+		stateUsage()
+	}
+	switch osArgs[0] {
+	case "show":
+		cmdStateShow(osArgs[1:])
+	case "clean":
+		cmdStateClean(dryRun, osArgs[1:])
+	default:
+		stateUsage()
+	}
+}
+
+func stateUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s state show [--json] | clean [<name>...] [--older-than <age>] [--yes]\n", progName())
+	exit(ExitUsage)
+}
+
+func cmdStateShow(osArgs []string) {
+	fs := flag.NewFlagSet("state show", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "Print the state as JSON")
+	parseFlags(fs, osArgs)
+
+	items := stateItems()
+	for i := range items {
+		items[i].stat()
+	}
+	if rawOutput(*asJSON) {
+		printResult(map[string]interface{}{"directories": stateRoots(), "items": items})
+		return
+	}
+	fmt.Printf("Directories: %s\n\n", strings.Join(stateRoots(), ", "))
+	fmt.Printf("  %-15s %-11s %10s  %-16s  %s\n", "NAME", "KIND", "SIZE", "MODIFIED", "PATH")
+	for _, s := range items {
+		size, modified := "-", "-"
+		if s.Exists {
+			size = formatBytes(s.Size)
+			if s.Dir {
+				size = fmt.Sprintf("%d files, %s", s.Files, size)
+			}
+			modified = s.Modified.Local().Format("2006-01-02 15:04")
+		}
+		note := ""
+		switch {
+		case s.PID > 0:
+			note = fmt.Sprintf("  (in use by pid %d)", s.PID)
+		case s.InUse:
+			note = "  (in use)"
+		}
+		fmt.Printf("  %-15s %-11s %10s  %-16s  %s%s\n", s.Name, s.Kind, size, modified, s.Path, note)
+	}
+}
+
+func cmdStateClean(dryRun bool, osArgs []string) {
+	fs := flag.NewFlagSet("state clean", flag.ContinueOnError)
+	olderThan := fs.String("older-than", "", "Only remove what was last changed before this age or time (7d, 2025-01-01, ...)")
+	yes := addYesFlag(fs)
+	names := parseInterspersed(fs, osArgs)
+
+	cutoff := time.Now()
+	if *olderThan != "" {
+		t, err := parseTimeExpr(*olderThan, time.Now())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --older-than: %v\n", err)
+			exit(ExitUsage)
+		}
+		cutoff = t
+	}
+
+	byName := map[string]stateItem{}
+	var known []string
+	for _, item := range stateItems() {
+		byName[item.Name] = item
+		known = append(known, item.Name)
+	}
+	var targets []string
+	var summary []string
+	for _, name := range names {
+		item, ok := byName[name]
+		switch {
+		case name == "audit-log":
+			fmt.Fprintln(os.Stderr, "Error: the audit log is evidence of what was changed and is not cleaned; remove it by hand if you must")
+			exit(ExitUsage)
+		case !ok:
+			fmt.Fprintf(os.Stderr, "Error: unknown state %q (one of: %s)\n", name, strings.Join(known, ", "))
+			exit(ExitUsage)
+		}
+		files := stateCleanFiles(item, cutoff)
+		if len(files) == 0 {
+			continue
+		}
+		targets = append(targets, files...)
+		summary = append(summary, fmt.Sprintf("%s: %d file(s) in %s", name, len(files), item.Path))
+	}
+
+	// Temporary files left by interrupted writes go in any case.
+	var stale []string
+	for _, root := range append(stateRoots(), campaignDir(), snapshotDir()) {
+		entries, _ := os.ReadDir(root)
+		for _, e := range entries {
+			info, err := e.Info()
+			if err != nil || e.IsDir() || !(strings.HasSuffix(e.Name(), ".tmp") || strings.HasSuffix(e.Name(), ".part")) {
+				continue
+			}
+			if time.Since(info.ModTime()) > staleTempAge {
+				stale = append(stale, filepath.Join(root, e.Name()))
+			}
+		}
+	}
+	sort.Strings(stale)
+
+	if len(targets) == 0 && len(stale) == 0 {
+		status(nil, "Nothing to clean\n")
+		return
+	}
+	if len(targets) > 0 {
+		if err := confirm(&McpClient{dryRun: dryRun}, *yes, "remove local state", summary); err != nil {
+			fatal(err)
+		}
+	}
+	removed, failed := 0, 0
+	for _, path := range append(targets, stale...) {
+		if dryRun {
+			fmt.Printf("Would remove %s\n", path)
+			continue
+		}
+		if err := removeStateFile(path); err != nil {
+			warnf("Warning: %v\n", err)
+			failed++
+			continue
+		}
+		removed++
+	}
+	if !dryRun {
+		status(removed, "Removed %d file(s)\n", removed)
+	}
+	if failed > 0 {
+		exit(ExitPartial)
+	}
+}
+
+// stateCleanFiles returns the files of item last changed before cutoff.
+func stateCleanFiles(item stateItem, cutoff time.Time) []string {
+	if !item.Dir {
+		if info, err := os.Stat(item.Path); err == nil && info.ModTime().Before(cutoff) {
+			return []string{item.Path}
+		}
+		return nil
+	}
+	var files []string
+	for _, f := range stateDirFiles(item.Path) {
+		if f.ModTime().Before(cutoff) {
+			files = append(files, filepath.Join(item.Path, f.Name()))
+		}
+	}
+	return files
+}
+
+// removeStateFile removes a state file unless another process holds its
+// lock. Files of a state directory are covered by the directory's lock.
+func removeStateFile(path string) error {
+	lockPath := path
+	for _, item := range stateItems() {
+		if item.Dir && filepath.Dir(path) == filepath.Clean(item.Path) {
+			lockPath = item.Path
+		}
+	}
+	if !isStateScratch(filepath.Base(path)) {
+		release, err := lockState(lockPath, false)
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+	return os.Remove(path)
+}
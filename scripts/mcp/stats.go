@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/schmalle/secman/scripts/mcp/secman"
+)
+
+// Stats is the one-screen dashboard summary printed by the stats command.
+type Stats struct {
+	VulnsBySeverity map[string]int `json:"vulnerabilitiesBySeverity"`
+	AssetsByType    map[string]int `json:"assetsByType"`
+	TotalAssets     int            `json:"totalAssets"`
+	ScansLast30Days int            `json:"scansLast30Days"`
+	TopRiskyAssets  []RiskyAsset   `json:"topRiskyAssets"`
+	// AgeBuckets is set with --age-bucket.
+	AgeBuckets []ageBucketCount `json:"ageBuckets,omitempty"`
+}
+
+type RiskyAsset struct {
+	AssetID   int64  `json:"assetId"`
+	AssetName string `json:"assetName"`
+	AssetType string `json:"assetType,omitempty"`
+	Critical  int    `json:"critical"`
+	High      int    `json:"high"`
+	Medium    int    `json:"medium"`
+	Low       int    `json:"low"`
+	HeatLevel string `json:"heatLevel,omitempty"`
+}
+
+var severityOrder = []string{"CRITICAL", "HIGH", "MEDIUM", "LOW"}
+
+func cmdStats(client *McpClient, osArgs []string) {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	top := fs.Int("top", 10, "Number of riskiest assets to show")
+	asJSON := fs.Bool("json", false, "Print the summary as JSON")
+	ageBuckets := fs.Bool("age-bucket", false, "Add open findings by days open (0-7d, 8-30d, 31-90d, >90d); reads every finding")
+	noCharts := fs.Bool("no-charts", false, "Do not draw the trend sparklines and subnet heatmap on a terminal")
+	parseFlags(fs, osArgs)
+
+	stats, err := collectStats(client, *top)
+	if err != nil {
+		fatal(err)
+	}
+	if *ageBuckets {
+		if stats.AgeBuckets, err = collectAgeBuckets(client); err != nil {
+			fatal(err)
+		}
+	}
+
+	if rawOutput(*asJSON) {
+		printResult(stats)
+		return
+	}
+	printStats(stats)
+	if chartsEnabled() && !*noCharts {
+		printStatsCharts(client)
+	}
+}
+
+// printStatsCharts adds the severity trend of the newest snapshots, when
+// there are at least two, and the subnet risk heatmap.
+func printStatsCharts(client *McpClient) {
+	if trend, err := severityTrend(timeRange{}, 30); err != nil {
+		warnf("severity trend: %v", err)
+	} else if len(trend) > 1 {
+		fmt.Println()
+		printSeverityTrend(trend)
+	}
+	subnets, err := collectSubnetRisk(client)
+	if err != nil {
+		warnf("subnet heatmap: %v", err)
+		return
+	}
+	if len(subnets) > 0 {
+		fmt.Println()
+		printSubnetHeatmap(subnets, 10)
+	}
+}
+
+// collectStats prefers the server's get_dashboard_statistics tool and
+// otherwise aggregates client-side from the heatmap, asset and scan tools.
+func collectStats(client *McpClient, top int) (*Stats, error) {
+	if ok, err := client.HasTool("get_dashboard_statistics"); err == nil && ok {
+		stats, err := secman.CallToolAs[Stats](context.Background(), client, "get_dashboard_statistics", map[string]interface{}{"topN": top})
+		if err != nil {
+			return nil, err
+		}
+		return &stats, nil
+	}
+
+	stats := &Stats{
+		VulnsBySeverity: map[string]int{},
+		AssetsByType:    map[string]int{},
+	}
+
+	// The heatmap already carries per-asset severity counts for every
+	// accessible asset, which is far cheaper than paging all findings.
+	heatmap, err := client.callToolMap("get_vulnerability_heatmap", map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
+	entries, _ := heatmap["entries"].([]interface{})
+	for _, item := range entries {
+		e, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		a := RiskyAsset{
+			AssetID:   int64(numberField(e, "assetId")),
+			AssetName: stringField(e, "assetName"),
+			AssetType: stringField(e, "assetType"),
+			Critical:  int(numberField(e, "criticalCount")),
+			High:      int(numberField(e, "highCount")),
+			Medium:    int(numberField(e, "mediumCount")),
+			Low:       int(numberField(e, "lowCount")),
+			HeatLevel: stringField(e, "heatLevel"),
+		}
+		stats.VulnsBySeverity["CRITICAL"] += a.Critical
+		stats.VulnsBySeverity["HIGH"] += a.High
+		stats.VulnsBySeverity["MEDIUM"] += a.Medium
+		stats.VulnsBySeverity["LOW"] += a.Low
+		if a.Critical+a.High+a.Medium+a.Low > 0 {
+			stats.TopRiskyAssets = append(stats.TopRiskyAssets, a)
+		}
+	}
+	sort.SliceStable(stats.TopRiskyAssets, func(i, j int) bool {
+		a, b := stats.TopRiskyAssets[i], stats.TopRiskyAssets[j]
+		if a.Critical != b.Critical {
+			return a.Critical > b.Critical
+		}
+		if a.High != b.High {
+			return a.High > b.High
+		}
+		if a.Medium != b.Medium {
+			return a.Medium > b.Medium
+		}
+		return a.Low > b.Low
+	})
+	if len(stats.TopRiskyAssets) > top {
+		stats.TopRiskyAssets = stats.TopRiskyAssets[:top]
+	}
+
+	assets, err := listAll(client, "get_assets", "assets", nil, 500)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range assets {
+		if isDecommissioned(a) {
+			continue
+		}
+		stats.TotalAssets++
+		t := stringField(a, "type")
+		if t == "" {
+			t = "UNKNOWN"
+		}
+		stats.AssetsByType[t]++
+	}
+
+	scans, err := client.callToolMap("get_scans", map[string]interface{}{
+		"startDate": time.Now().AddDate(0, 0, -30).UTC().Format(time.RFC3339),
+		"page":      0,
+		"pageSize":  1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	stats.ScansLast30Days = int(numberField(scans, "total"))
+
+	return stats, nil
+}
+
+func printStats(s *Stats) {
+	fmt.Println("Open vulnerabilities by severity")
+	total := 0
+	for _, sev := range severityOrder {
+		total += s.VulnsBySeverity[sev]
+	}
+	for _, sev := range severityOrder {
+		fmt.Printf("  %s %8d  %s\n", severityCell(sev, 10), s.VulnsBySeverity[sev], paint(severityStyle(sev), bar(s.VulnsBySeverity[sev], total, 30)))
+	}
+	fmt.Printf("  %-10s %8d\n", "TOTAL", total)
+
+	if len(s.AgeBuckets) > 0 {
+		fmt.Println("\nOpen vulnerabilities by days open")
+		fmt.Printf("  %-10s %8s %6s %6s %6s %6s\n", "AGE", "TOTAL", "CRIT", "HIGH", "MED", "LOW")
+		for _, b := range s.AgeBuckets {
+			fmt.Printf("  %-10s %8d %s %s %6d %6d\n", b.Bucket, b.Total, countCell("CRITICAL", b.Critical), countCell("HIGH", b.High), b.Medium, b.Low)
+		}
+	}
+
+	fmt.Printf("\nAssets by type (%d total)\n", s.TotalAssets)
+	types := make([]string, 0, len(s.AssetsByType))
+	for t := range s.AssetsByType {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return s.AssetsByType[types[i]] > s.AssetsByType[types[j]] })
+	for _, t := range types {
+		fmt.Printf("  %-12s %8d\n", t, s.AssetsByType[t])
+	}
+
+	fmt.Printf("\nScans in the last 30 days: %d\n", s.ScansLast30Days)
+
+	fmt.Printf("\nTop %d riskiest assets\n", len(s.TopRiskyAssets))
+	fmt.Printf("  %-35s %6s %6s %6s %6s\n", "ASSET", "CRIT", "HIGH", "MED", "LOW")
+	for _, a := range s.TopRiskyAssets {
+		fmt.Printf("  %-35s %s %s %6d %6d\n", truncate(a.AssetName, 35), countCell("CRITICAL", a.Critical), countCell("HIGH", a.High), a.Medium, a.Low)
+	}
+}
+
+// countCell right-aligns a count in six columns, colored by severity when
+// it is not zero.
+func countCell(severity string, n int) string {
+	cell := fmt.Sprintf("%6d", n)
+	if n == 0 {
+		return cell
+	}
+	return paint(severityStyle(severity), cell)
+}
+
+// bar renders a proportional horizontal bar of at most width characters.
+func bar(value, total, width int) string {
+	if total == 0 || value == 0 {
+		return ""
+	}
+	n := value * width / total
+	if n == 0 {
+		n = 1
+	}
+	return strings.Repeat("#", n)
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n-1] + "~"
+}
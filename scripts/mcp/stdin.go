@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Bulk commands take their targets from stdin with --stdin, so queries can
+// be piped into actions:
+//
+//	go run . assets --type SERVER | go run . asset assign --to bob --stdin --yes
+//
+// Accepted input: the JSON printed by another command (tool results are
+// unwrapped to their list of records), a JSON array, one JSON object per
+// line, or plain IDs separated by whitespace or commas.
+
+// readStdinItems parses stdin into records. Plain IDs become {"id": n}.
+func readStdinItems(r io.Reader) ([]map[string]interface{}, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read stdin: %w", err)
+	}
+	trimmed := bytes.TrimSpace(trimBOM(data))
+	if len(trimmed) == 0 {
+		return nil, fmt.Errorf("no input on stdin")
+	}
+
+	if trimmed[0] != '{' && trimmed[0] != '[' {
+		var items []map[string]interface{}
+		for _, field := range strings.FieldsFunc(string(trimmed), func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\n' || r == '\t' || r == '\r'
+		}) {
+			id, err := strconv.ParseInt(field, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("stdin: %q is not an ID or JSON", field)
+			}
+			items = append(items, map[string]interface{}{"id": float64(id)})
+		}
+		return items, nil
+	}
+
+	// A single JSON document (array or object) ...
+	var doc interface{}
+	if err := json.Unmarshal(trimmed, &doc); err == nil {
+		return recordsFrom(doc), nil
+	}
+
+	// ... or one JSON value per line.
+	var items []map[string]interface{}
+	scanner := bufio.NewScanner(bytes.NewReader(trimmed))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16<<20)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var v interface{}
+		if err := json.Unmarshal([]byte(text), &v); err != nil {
+			return nil, fmt.Errorf("stdin line %d: %w", line, err)
+		}
+		items = append(items, recordsFrom(v)...)
+	}
+	return items, scanner.Err()
+}
+
+// recordsFrom unwraps a decoded JSON value to a list of records: arrays are
+// used as-is, tool results are unwrapped through "content", and an object
+// holding exactly one list of objects yields that list.
+func recordsFrom(v interface{}) []map[string]interface{} {
+	switch t := v.(type) {
+	case []interface{}:
+		var items []map[string]interface{}
+		for _, item := range t {
+			switch it := item.(type) {
+			case map[string]interface{}:
+				items = append(items, it)
+			case float64:
+				items = append(items, map[string]interface{}{"id": it})
+			}
+		}
+		return items
+	case map[string]interface{}:
+		if content, ok := t["content"].(map[string]interface{}); ok {
+			return recordsFrom(content)
+		}
+		var lists [][]interface{}
+		for _, val := range t {
+			if list, ok := val.([]interface{}); ok && len(list) > 0 {
+				if _, isObj := list[0].(map[string]interface{}); isObj {
+					lists = append(lists, list)
+				}
+			}
+		}
+		if len(lists) == 1 {
+			return recordsFrom(lists[0])
+		}
+		return []map[string]interface{}{t}
+	case float64:
+		return []map[string]interface{}{{"id": t}}
+	}
+	return nil
+}
+
+// recordIDs extracts numeric IDs from records, trying the given keys in
+// order (e.g. "assetId", "id").
+func recordIDs(items []map[string]interface{}, keys ...string) ([]int64, error) {
+	ids := make([]int64, 0, len(items))
+	for i, item := range items {
+		found := false
+		for _, k := range keys {
+			switch v := item[k].(type) {
+			case float64:
+				ids = append(ids, int64(v))
+				found = true
+			case string:
+				if id, err := strconv.ParseInt(v, 10, 64); err == nil {
+					ids = append(ids, id)
+					found = true
+				}
+			}
+			if found {
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("stdin record %d has no %s", i+1, strings.Join(keys, " or "))
+		}
+	}
+	return ids, nil
+}
+
+// utf8BOM is the byte order mark Notepad, Excel ("CSV UTF-8") and
+// PowerShell 5 put at the start of UTF-8 text on Windows. JSON decoders and
+// header matching trip over it, so input files are read without it.
+var utf8BOM = []byte("\ufeff")
+
+func trimBOM(data []byte) []byte {
+	return bytes.TrimPrefix(data, utf8BOM)
+}
+
+// readTextFile reads a file the user wrote, without a byte order mark.
+func readTextFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	return trimBOM(data), err
+}
+
+// skipBOM returns r without a leading byte order mark.
+func skipBOM(r io.Reader) io.Reader {
+	br := bufio.NewReader(r)
+	if head, err := br.Peek(len(utf8BOM)); err == nil && bytes.Equal(head, utf8BOM) {
+		br.Discard(len(utf8BOM))
+	}
+	return br
+}
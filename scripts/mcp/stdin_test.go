@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// windowsText turns lines into what Notepad or Excel's "CSV UTF-8" saves:
+// a byte order mark and CRLF line ends.
+func windowsText(lines ...string) string {
+	return string(utf8BOM) + strings.Join(lines, "\r\n") + "\r\n"
+}
+
+func TestReadStdinItemsWindowsText(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []float64
+	}{
+		{"ids", windowsText("12", "13,14"), []float64{12, 13, 14}},
+		{"json lines", windowsText(`{"id": 12}`, `{"id": 13}`), []float64{12, 13}},
+		{"json array", windowsText(`[{"id": 12},`, ` {"id": 13}]`), []float64{12, 13}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, err := readStdinItems(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(items) != len(tt.want) {
+				t.Fatalf("got %d items, want %d: %v", len(items), len(tt.want), items)
+			}
+			for i, want := range tt.want {
+				if items[i]["id"] != want {
+					t.Errorf("item %d: id = %v, want %v", i, items[i]["id"], want)
+				}
+			}
+		})
+	}
+}
+
+func TestReadAnswersCSVWindowsText(t *testing.T) {
+	input := windowsText(
+		"requirementId,answer,comment",
+		"101,YES,",
+		`102,NO,"two lines:`,
+		`patch pending"`,
+	)
+	answers, err := readAnswersCSV(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(answers) != 2 {
+		t.Fatalf("got %d answers, want 2: %+v", len(answers), answers)
+	}
+	if answers[0].RequirementID != 101 || answers[0].Answer != "YES" {
+		t.Errorf("first answer = %+v, want requirement 101 answered YES", answers[0])
+	}
+	if answers[1].Comment != "two lines:\npatch pending" {
+		t.Errorf("comment = %q, want the CRLF inside the quotes read as a newline", answers[1].Comment)
+	}
+}
+
+func TestReadTranslationCSVWindowsText(t *testing.T) {
+	units := []translationUnit{
+		{RequirementID: 7, Field: "shortreq", Source: "Patch monthly", Target: "Monatlich patchen"},
+		{RequirementID: 8, Field: "description", Source: "Log access", Target: "Zugriffe protokollieren"},
+	}
+	var buf bytes.Buffer
+	if err := writeTranslationCSV(&buf, units); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+
+	got, err := readTranslationCSV(strings.NewReader(windowsText(lines...)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(units) {
+		t.Fatalf("got %d units, want %d", len(got), len(units))
+	}
+	for i := range units {
+		if got[i] != units[i] {
+			t.Errorf("unit %d = %+v, want %+v", i, got[i], units[i])
+		}
+	}
+}
+
+func TestSkipBOM(t *testing.T) {
+	for _, input := range []string{string(utf8BOM) + "id\r\n", "id\r\n"} {
+		var buf bytes.Buffer
+		if _, err := buf.ReadFrom(skipBOM(strings.NewReader(input))); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != "id\r\n" {
+			t.Errorf("skipBOM(%q) = %q, want %q", input, buf.String(), "id\r\n")
+		}
+	}
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// serve-stdio speaks MCP over stdin and stdout, for LLM hosts such as
+// Claude Desktop or IDE agents that start their servers as a subprocess.
+// tools/list and tools/call are passed to the Secman server with the
+// CLI's settings, so the host needs no API key of its own.
+//
+// The tools the host sees are limited client-side: --allow and --deny take
+// tool names or patterns like get_*, and --read-only keeps only tools that
+// read. A tool outside the policy is not listed, and calling it anyway is
+// refused here, before anything is sent. Deny wins over allow. Results go
+// to the host as text, cut down when they are too large (see overflow.go).
+
+// mcpProtocolVersion is answered to hosts that do not ask for a version.
+const mcpProtocolVersion = "2024-11-05"
+
+// toolPolicy decides which tools the bridge exposes.
+type toolPolicy struct {
+	allow    []string
+	deny     []string
+	readOnly bool
+	// clientReadOnly hides the tools the client refuses in read-only mode.
+	clientReadOnly bool
+}
+
+// permits reports whether the policy lets the host use a tool, and if not,
+// why.
+func (p *toolPolicy) permits(name string) (bool, string) {
+	for _, pattern := range p.deny {
+		if matchTool(pattern, name) {
+			return false, "denied by " + pattern
+		}
+	}
+	if p.clientReadOnly && !isReadTool(name) {
+		return false, "not a read tool and the client is read-only"
+	}
+	if p.readOnly && !isReadTool(name) {
+		return false, "not a read tool and the bridge is read-only"
+	}
+	if len(p.allow) == 0 {
+		return true, ""
+	}
+	for _, pattern := range p.allow {
+		if matchTool(pattern, name) {
+			return true, ""
+		}
+	}
+	return false, "not in the allowlist"
+}
+
+func matchTool(pattern, name string) bool {
+	ok, err := path.Match(pattern, name)
+	return err == nil && ok
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// stdioRequest is a JSON-RPC request or notification from the host. Hosts
+// use numbers or strings as ids, which are echoed unchanged.
+type stdioRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type stdioResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *stdioError     `json:"error,omitempty"`
+}
+
+type stdioError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Standard JSON-RPC error codes.
+const (
+	rpcParseError     = -32700
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcInternalError  = -32603
+)
+
+// stdioBridge serves one host.
+type stdioBridge struct {
+	client   *McpClient
+	policy   *toolPolicy
+	overflow overflowPolicy
+
+	outMu sync.Mutex
+	out   *json.Encoder
+}
+
+func cmdServeStdio(client *McpClient, osArgs []string) {
+	fs := flag.NewFlagSet("serve-stdio", flag.ContinueOnError)
+	allow := fs.String("allow", setting("SECMAN_BRIDGE_ALLOW"), "Tools the host may use, comma-separated names or patterns like get_* (default: SECMAN_BRIDGE_ALLOW, else all)")
+	deny := fs.String("deny", setting("SECMAN_BRIDGE_DENY"), "Tools the host may not use, comma-separated names or patterns (default: SECMAN_BRIDGE_DENY)")
+	readOnlyDefault, err := strconv.ParseBool(settingOr("SECMAN_BRIDGE_READ_ONLY", "false"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error: SECMAN_BRIDGE_READ_ONLY must be true or false")
+		exit(ExitUsage)
+	}
+	readOnly := fs.Bool("read-only", readOnlyDefault, "Expose only tools that read (default: SECMAN_BRIDGE_READ_ONLY)")
+	maxOutput := fs.String("max-output", settingOr("SECMAN_BRIDGE_MAX_OUTPUT", "100KB"), "Largest result passed to the host; 0 for no limit (default: SECMAN_BRIDGE_MAX_OUTPUT, else 100KB)")
+	maxTokens := fs.Int("max-tokens", 0, "Largest result in tokens, at about 4 bytes a token; overrides --max-output (default: SECMAN_BRIDGE_MAX_TOKENS)")
+	overflow := fs.String("overflow", settingOr("SECMAN_BRIDGE_OVERFLOW", overflowSummarize), "What to do with a larger result: summarize or truncate (default: SECMAN_BRIDGE_OVERFLOW)")
+	list := fs.Bool("list", false, "Print which tools the policy exposes and exit")
+	shutdownTimeout := addShutdownFlag(fs)
+	if v := setting("SECMAN_BRIDGE_MAX_TOKENS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error: SECMAN_BRIDGE_MAX_TOKENS must be a number")
+			exit(ExitUsage)
+		}
+		*maxTokens = n
+	}
+	parseFlags(fs, osArgs)
+
+	policy := &toolPolicy{allow: splitList(*allow), deny: splitList(*deny), readOnly: *readOnly, clientReadOnly: client.readOnly}
+	for _, pattern := range append(append([]string{}, policy.allow...), policy.deny...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: bad tool pattern %q: %v\n", pattern, err)
+			exit(ExitUsage)
+		}
+	}
+	if *list {
+		printToolPolicy(client, policy)
+		return
+	}
+	if *overflow != overflowSummarize && *overflow != overflowTruncate {
+		fmt.Fprintf(os.Stderr, "Error: --overflow must be summarize or truncate, not %q\n", *overflow)
+		exit(ExitUsage)
+	}
+	maxBytes, err := parseByteSize(*maxOutput)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --max-output: %v\n", err)
+		exit(ExitUsage)
+	}
+	if *maxTokens > 0 {
+		maxBytes = int64(*maxTokens) * 4
+	}
+
+	b := &stdioBridge{client: client, policy: policy, overflow: overflowPolicy{maxBytes: int(maxBytes), mode: *overflow},
+		out: json.NewEncoder(os.Stdout)}
+	// stdout carries the protocol; notes go to stderr, which hosts log.
+	if !quiet {
+		fmt.Fprintf(os.Stderr, "secman-mcp %s: serving %s over stdio (%s)\n", version, client.BaseURL, policy)
+	}
+	g := newRunGroup(*shutdownTimeout)
+	g.Go(func(ctx context.Context) error { return b.serve(ctx, os.Stdin) })
+	if err := g.Wait(); err != nil {
+		fatal(err)
+	}
+}
+
+func (p *toolPolicy) String() string {
+	var parts []string
+	if p.readOnly {
+		parts = append(parts, "read-only")
+	}
+	if len(p.allow) > 0 {
+		parts = append(parts, "allow "+strings.Join(p.allow, ","))
+	}
+	if len(p.deny) > 0 {
+		parts = append(parts, "deny "+strings.Join(p.deny, ","))
+	}
+	if len(parts) == 0 {
+		return "all tools"
+	}
+	return strings.Join(parts, "; ")
+}
+
+// printToolPolicy shows the verdict on every tool, to check a policy
+// before handing it to a host.
+func printToolPolicy(client *McpClient, policy *toolPolicy) {
+	names, err := client.ToolNames()
+	if err != nil {
+		fatal(err)
+	}
+	type verdict struct {
+		Tool    string `json:"tool"`
+		Exposed bool   `json:"exposed"`
+		Reason  string `json:"reason,omitempty"`
+	}
+	verdicts := make([]verdict, len(names))
+	for i, name := range names {
+		ok, reason := policy.permits(name)
+		verdicts[i] = verdict{Tool: name, Exposed: ok, Reason: reason}
+	}
+	printResult(verdicts)
+}
+
+// serve handles requests until the host closes stdin or ctx is done. Tool
+// calls run concurrently, so a slow one does not hold up pings or listings;
+// once ctx is done no more requests are read, and the calls under way are
+// answered before serve returns.
+func (b *stdioBridge) serve(ctx context.Context, in io.Reader) error {
+	// The scanner cannot be interrupted, so it reads in its own goroutine;
+	// it is left blocked on stdin when serve returns early.
+	lines := make(chan []byte)
+	scanErr := make(chan error, 1)
+	go func() {
+		scanner := bufio.NewScanner(in)
+		scanner.Buffer(make([]byte, 64<<10), 16<<20)
+		for scanner.Scan() {
+			select {
+			case lines <- append([]byte(nil), scanner.Bytes()...):
+			case <-ctx.Done():
+				return
+			}
+		}
+		scanErr <- scanner.Err()
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		var line []byte
+		select {
+		case line = <-lines:
+		case err := <-scanErr:
+			return err
+		case <-ctx.Done():
+			return nil
+		}
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+		var req stdioRequest
+		if err := json.Unmarshal(line, &req); err != nil {
+			b.reply(json.RawMessage("null"), nil, &stdioError{Code: rpcParseError, Message: err.Error()})
+			continue
+		}
+		if req.Method == "tools/call" {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				b.handle(&req)
+			}()
+			continue
+		}
+		b.handle(&req)
+	}
+}
+
+func (b *stdioBridge) handle(req *stdioRequest) {
+	// Notifications (no id) get no answer.
+	notification := len(req.ID) == 0
+	result, rpcErr := b.dispatch(req)
+	if notification {
+		return
+	}
+	b.reply(req.ID, result, rpcErr)
+}
+
+func (b *stdioBridge) reply(id json.RawMessage, result interface{}, rpcErr *stdioError) {
+	resp := stdioResponse{JSONRPC: "2.0", ID: id, Result: result, Error: rpcErr}
+	if rpcErr == nil && result == nil {
+		resp.Result = struct{}{}
+	}
+	b.outMu.Lock()
+	defer b.outMu.Unlock()
+	if err := b.out.Encode(resp); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: write response: %v\n", err)
+	}
+}
+
+func (b *stdioBridge) dispatch(req *stdioRequest) (interface{}, *stdioError) {
+	switch req.Method {
+	case "initialize":
+		var params struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		_ = json.Unmarshal(req.Params, &params)
+		protocol := params.ProtocolVersion
+		if protocol == "" {
+			protocol = mcpProtocolVersion
+		}
+		return map[string]interface{}{
+			"protocolVersion": protocol,
+			"capabilities":    map[string]interface{}{"tools": map[string]interface{}{"listChanged": false}},
+			"serverInfo":      map[string]interface{}{"name": "secman", "version": version},
+		}, nil
+	case "ping":
+		return nil, nil
+	case "tools/list":
+		return b.listTools()
+	case "tools/call":
+		return b.callTool(req.Params)
+	}
+	if strings.HasPrefix(req.Method, "notifications/") {
+		return nil, nil
+	}
+	return nil, &stdioError{Code: rpcMethodNotFound, Message: "method not found: " + req.Method}
+}
+
+func (b *stdioBridge) listTools() (interface{}, *stdioError) {
+	names, err := b.client.ToolNames()
+	if err != nil {
+		return nil, &stdioError{Code: rpcInternalError, Message: redactString(err.Error())}
+	}
+	tools := []ToolDefinition{}
+	for _, name := range names {
+		if ok, _ := b.policy.permits(name); !ok {
+			continue
+		}
+		def, _, _ := b.client.Tool(name)
+		if def.InputSchema == nil {
+			def.InputSchema = map[string]interface{}{"type": "object"}
+		}
+		tools = append(tools, def)
+	}
+	return map[string]interface{}{"tools": tools}, nil
+}
+
+func (b *stdioBridge) callTool(raw json.RawMessage) (interface{}, *stdioError) {
+	var params ToolCallParams
+	if err := json.Unmarshal(raw, &params); err != nil || params.Name == "" {
+		return nil, &stdioError{Code: rpcInvalidParams, Message: "tools/call needs a tool name"}
+	}
+	started := time.Now()
+	if ok, reason := b.policy.permits(params.Name); !ok {
+		err := fmt.Errorf("tool %s is not available through this bridge: %s", params.Name, reason)
+		fmt.Fprintf(os.Stderr, "Refused: %v\n", err)
+		b.client.recordTranscript("refused", params.Name, params.Arguments, nil, err, started)
+		return nil, &stdioError{Code: rpcInvalidParams, Message: err.Error()}
+	}
+	if ok, err := b.client.HasTool(params.Name); err != nil {
+		return nil, &stdioError{Code: rpcInternalError, Message: redactString(err.Error())}
+	} else if !ok {
+		return nil, &stdioError{Code: rpcInvalidParams, Message: "unknown tool: " + params.Name}
+	}
+	result, err := b.client.CallTool(params.Name, params.Arguments)
+	if err != nil {
+		// A failed call is a tool error to the host, so the model sees why.
+		return map[string]interface{}{
+			"content": []map[string]string{{"type": "text", "text": redactString(err.Error())}},
+			"isError": true,
+		}, nil
+	}
+	return map[string]interface{}{
+		"content": b.overflow.shape(params.Name, result.Content),
+		"isError": result.IsError,
+	}, nil
+}
@@ -0,0 +1,469 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// summarize writes an executive summary and remediation suggestions for an
+// asset, a scan or a CVE. It gathers what the tools know about the subject
+// (the record, its open findings, and for a CVE the remediation record of
+// vuln remediation) and sends those facts to an LLM behind an
+// OpenAI-compatible chat completions API. SECMAN_LLM_URL is the API's base
+// URL, such as https://api.openai.com/v1 or http://localhost:11434/v1 for
+// a local Ollama; SECMAN_LLM_MODEL is the model and SECMAN_LLM_API_KEY its
+// key, if it needs one.
+//
+// Without SECMAN_LLM_URL, with --offline, or when the endpoint fails, the
+// summary is written from a template instead, so the command also works on
+// hosts that must not send data anywhere. --anonymize pseudonymizes
+// hostnames, IP addresses and e-mails before the facts leave, and puts
+// them back in the answer.
+
+const llmSystemPrompt = `You are a security analyst writing for managers.
+You get facts about one subject from a vulnerability management system as
+JSON. Write two sections in plain text:
+
+Executive summary: at most five sentences on the exposure, what makes it
+urgent or not, and how it compares with the SLA.
+
+Remediation: a numbered list of concrete steps, most urgent first.
+
+Use only the facts given. Do not invent CVEs, hosts, versions or dates.`
+
+// summaryFinding is a finding as summarize hands it on.
+type summaryFinding struct {
+	ID       string `json:"vulnerabilityId"`
+	Severity string `json:"severity"`
+	Asset    string `json:"assetName,omitempty"`
+	DaysOpen int    `json:"daysOpen"`
+	Overdue  bool   `json:"overdue"`
+	Versions string `json:"productVersions,omitempty"`
+}
+
+// summaryFacts are the facts a summary is written from.
+type summaryFacts struct {
+	Kind        string                 `json:"kind"`
+	Subject     string                 `json:"subject"`
+	Details     map[string]interface{} `json:"details,omitempty"`
+	Context     map[string]string      `json:"businessContext,omitempty"`
+	Open        int                    `json:"openFindings"`
+	Counts      map[string]int         `json:"severityCounts"`
+	Overdue     int                    `json:"overdueFindings"`
+	SLADays     int                    `json:"slaDays"`
+	Oldest      int                    `json:"oldestDaysOpen"`
+	Assets      int                    `json:"affectedAssets"`
+	Hosts       []string               `json:"hosts,omitempty"`
+	Findings    []summaryFinding       `json:"findings"`
+	Omitted     int                    `json:"omittedFindings,omitempty"`
+	Remediation *Remediation           `json:"remediation,omitempty"`
+}
+
+// summaryResult is the output of summarize.
+type summaryResult struct {
+	Kind    string        `json:"kind"`
+	Subject string        `json:"subject"`
+	Source  string        `json:"source"`
+	Model   string        `json:"model,omitempty"`
+	Text    string        `json:"text"`
+	Facts   *summaryFacts `json:"facts"`
+}
+
+// summaryDetailFields are the record fields passed on, by kind.
+var summaryDetailFields = map[string][]string{
+	"asset": {"name", "type", "ip", "owner", "description", "os", "lastSeen", "adDomain", "cloudAccountId"},
+	"scan":  {"scanType", "filename", "scanDate", "hostCount", "duration"},
+}
+
+func cmdSummarize(client *McpClient, osArgs []string) {
+	usage := "Usage: " + progName() + " summarize <asset|scan|cve> <name|id|CVE> [--offline] [--anonymize] [--model m] [--json]"
+	if len(osArgs) < 2 {
+		fmt.Fprintln(os.Stderr, "Error: subject kind and name required")
+		fmt.Fprintln(os.Stderr, usage)
+		exit(ExitUsage)
+	}
+	kind, target := strings.ToLower(osArgs[0]), osArgs[1]
+
+	fs := flag.NewFlagSet("summarize", flag.ContinueOnError)
+	offline := fs.Bool("offline", false, "Write the summary from the template; send nothing")
+	anonymize := fs.Bool("anonymize", false, "Pseudonymize hostnames, IPs and emails sent to the LLM")
+	model := fs.String("model", setting("SECMAN_LLM_MODEL"), "Model to ask (default: SECMAN_LLM_MODEL)")
+	maxFindings := fs.Int("max-findings", 50, "Pass on at most this many findings, the most severe and oldest first")
+	noNVD := fs.Bool("no-nvd", false, "Skip the NVD lookup for a CVE")
+	asJSON := fs.Bool("json", false, "Print the summary and the facts it was written from as JSON")
+	parseFlags(fs, osArgs[2:])
+
+	var facts *summaryFacts
+	var err error
+	switch kind {
+	case "asset":
+		facts, err = assetSummaryFacts(client, target)
+	case "scan":
+		facts, err = scanSummaryFacts(client, target)
+	case "cve":
+		facts, err = cveSummaryFacts(client, target, !*noNVD)
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown subject kind %q (asset, scan or cve)\n", kind)
+		fmt.Fprintln(os.Stderr, usage)
+		exit(ExitUsage)
+	}
+	if err != nil {
+		fatal(err)
+	}
+	if facts == nil {
+		fmt.Fprintf(os.Stderr, "Error: %s %s not found\n", kind, target)
+		exit(ExitNotFound)
+	}
+	facts.Omitted = max(len(facts.Findings)-*maxFindings, 0)
+	facts.Findings = facts.Findings[:len(facts.Findings)-facts.Omitted]
+
+	result := &summaryResult{Kind: kind, Subject: facts.Subject, Source: "template", Facts: facts}
+	endpoint := strings.TrimRight(setting("SECMAN_LLM_URL"), "/")
+	if !*offline && endpoint != "" {
+		if *model == "" {
+			fmt.Fprintln(os.Stderr, "Error: SECMAN_LLM_MODEL or --model is required with SECMAN_LLM_URL")
+			exit(ExitUsage)
+		}
+		text, err := llmSummary(client, endpoint, *model, facts, *anonymize)
+		if err == nil {
+			result.Source, result.Model, result.Text = "llm", *model, text
+		} else {
+			warnf("Warning: %v; writing the summary from the template\n", err)
+		}
+	}
+	if result.Text == "" {
+		if result.Text, err = templateSummary(facts); err != nil {
+			fatal(err)
+		}
+	}
+
+	if rawOutput(*asJSON) {
+		printResult(result)
+		return
+	}
+	fmt.Println(strings.TrimSpace(result.Text))
+	if result.Source == "llm" {
+		status(0, "\n(written by %s from %d finding(s); check it against the data)\n", result.Model, len(facts.Findings))
+	}
+}
+
+// assetSummaryFacts gathers an asset, given by id or name, and its open
+// findings.
+func assetSummaryFacts(client *McpClient, target string) (*summaryFacts, error) {
+	var asset map[string]interface{}
+	if id, err := strconv.ParseInt(target, 10, 64); err == nil {
+		assets, err := assetsByID(client)
+		if err != nil {
+			return nil, err
+		}
+		asset = assets[id]
+	} else if asset, err = findAssetByName(client, target); err != nil {
+		return nil, err
+	}
+	if asset == nil {
+		return nil, nil
+	}
+	findings, err := listAll(client, "get_vulnerabilities", "vulnerabilities", map[string]interface{}{"assetId": asset["id"]}, 500)
+	if err != nil {
+		return nil, err
+	}
+	facts := newSummaryFacts("asset", stringField(asset, "name"), asset, findings)
+	facts.Context = map[string]string{}
+	for k, v := range assetContext(asset) {
+		if v != "" {
+			facts.Context[k] = v
+		}
+	}
+	return facts, nil
+}
+
+// scanSummaryFacts gathers a scan, its hosts and the findings derived from
+// it.
+func scanSummaryFacts(client *McpClient, target string) (*summaryFacts, error) {
+	id, err := strconv.ParseInt(target, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("scan id must be a number, got %q", target)
+	}
+	content, err := getScan(client, id)
+	if err != nil {
+		return nil, err
+	}
+	scan, _ := content["scan"].(map[string]interface{})
+	if scan == nil {
+		scan = content
+	}
+	facts := newSummaryFacts("scan", "scan "+target, scan, mapsField(content, "findings"))
+	for _, h := range mapsField(content, "hosts") {
+		host := stringField(h, "ip")
+		if name := stringField(h, "hostname"); name != "" {
+			host = name + " (" + host + ")"
+		}
+		var open []string
+		for _, p := range mapsField(h, "ports") {
+			if state := stringField(p, "state"); state == "" || state == "open" {
+				open = append(open, strings.TrimSpace(stringField(p, "port")+"/"+stringField(p, "protocol")+" "+stringField(p, "service")))
+			}
+		}
+		if len(open) > 0 {
+			host += ": " + strings.Join(open, ", ")
+		}
+		facts.Hosts = append(facts.Hosts, host)
+	}
+	return facts, nil
+}
+
+// cveSummaryFacts gathers the findings of a CVE and its remediation
+// record.
+func cveSummaryFacts(client *McpClient, target string, nvd bool) (*summaryFacts, error) {
+	cve := strings.ToUpper(target)
+	if !cvePattern.MatchString(cve) {
+		return nil, fmt.Errorf("%q is not a CVE", target)
+	}
+	findings, err := findingsForTarget(client, cve)
+	if err != nil {
+		return nil, err
+	}
+	rem := buildRemediation(cve, findings)
+	if nvd {
+		if err := enrichFromNVD(rem); err != nil {
+			warnf("Warning: NVD lookup failed: %v\n", err)
+		}
+	}
+	rem.Summary = remediationSummary(rem)
+	// The findings are listed once, in the facts.
+	rem.AffectedAssets = nil
+	facts := newSummaryFacts("cve", cve, nil, findings)
+	facts.Remediation = rem
+	return facts, nil
+}
+
+// newSummaryFacts counts findings and keeps them most severe and oldest
+// first.
+func newSummaryFacts(kind, subject string, record map[string]interface{}, findings []map[string]interface{}) *summaryFacts {
+	facts := &summaryFacts{Kind: kind, Subject: subject, Counts: map[string]int{}, SLADays: overdueDays(), Findings: []summaryFinding{}}
+	if record != nil {
+		facts.Details = map[string]interface{}{}
+		for _, k := range summaryDetailFields[kind] {
+			if v, ok := record[k]; ok && v != nil && v != "" {
+				facts.Details[k] = v
+			}
+		}
+	}
+	assets := map[string]bool{}
+	for _, f := range findings {
+		days, _ := parseDays(stringField(f, "daysOpen"))
+		sf := summaryFinding{
+			ID:       stringField(f, "vulnerabilityId"),
+			Severity: strings.ToUpper(stringField(f, "cvssSeverity")),
+			Asset:    stringField(f, "assetName"),
+			DaysOpen: days,
+			Overdue:  isOverdue(f),
+			Versions: stringField(f, "vulnerableProductVersions"),
+		}
+		facts.Open++
+		facts.Counts[sf.Severity]++
+		facts.Oldest = max(facts.Oldest, days)
+		if sf.Overdue {
+			facts.Overdue++
+		}
+		assets[strings.ToLower(sf.Asset)] = true
+		facts.Findings = append(facts.Findings, sf)
+	}
+	facts.Assets = len(assets)
+	sort.SliceStable(facts.Findings, func(i, j int) bool {
+		a, b := facts.Findings[i], facts.Findings[j]
+		if ra, rb := severityRank(a.Severity), severityRank(b.Severity); ra != rb {
+			return ra > rb
+		}
+		return a.DaysOpen > b.DaysOpen
+	})
+	return facts
+}
+
+// llmSummary asks the chat completions API for the summary.
+func llmSummary(client *McpClient, endpoint, model string, facts *summaryFacts, anonymize bool) (string, error) {
+	data, err := json.Marshal(facts)
+	if err != nil {
+		return "", err
+	}
+	var a *Anonymizer
+	if anonymize {
+		if a, err = newAnonymizer(); err != nil {
+			return "", err
+		}
+		// Hostnames in free text, such as a scan's host list, are only
+		// found when the inventory is known.
+		if err := a.learnAssets(client); err != nil {
+			return "", err
+		}
+		var doc map[string]interface{}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return "", err
+		}
+		if facts.Kind == "asset" {
+			a.Pseudonym("host", facts.Subject)
+		}
+		a.Records([]map[string]interface{}{doc}, facts.Kind == "asset")
+		if data, err = json.Marshal(doc); err != nil {
+			return "", err
+		}
+	}
+
+	text, err := llmChat(client, endpoint, model, []llmMessage{
+		{Role: "system", Content: llmSystemPrompt},
+		{Role: "user", Content: "Summarize this " + facts.Kind + ":\n\n" + string(data)},
+	}, false)
+	if err != nil {
+		return "", err
+	}
+	if a != nil {
+		pairs := make([]string, 0, 2*len(a.known))
+		for original, pseudonym := range a.known {
+			pairs = append(pairs, pseudonym, original)
+		}
+		text = strings.NewReplacer(pairs...).Replace(text)
+	}
+	return text, nil
+}
+
+var summaryTemplate = template.Must(template.New("summary").Funcs(template.FuncMap{
+	"add1": func(i int) int { return i + 1 },
+}).Parse(`{{.Title}}
+
+Executive summary
+{{range .Summary}}  {{.}}
+{{end}}
+Remediation
+{{range $i, $s := .Steps}}  {{add1 $i}}. {{$s}}
+{{else}}  No open findings; nothing to do.
+{{end}}`))
+
+// templateSummary writes the summary without an LLM.
+func templateSummary(f *summaryFacts) (string, error) {
+	var title string
+	switch f.Kind {
+	case "asset":
+		title = "Asset " + f.Subject
+		if t := stringField(f.Details, "type"); t != "" {
+			title += " (" + t + ")"
+		}
+	case "scan":
+		title = strings.ToUpper(f.Subject[:1]) + f.Subject[1:]
+		if t := stringField(f.Details, "scanType"); t != "" {
+			title += " (" + t + ")"
+		}
+	default:
+		title = f.Subject
+		if f.Remediation != nil && f.Remediation.Severity != "" {
+			title += " (" + f.Remediation.Severity + ")"
+		}
+	}
+
+	var counts []string
+	for _, sev := range severityOrder {
+		if n := f.Counts[sev]; n > 0 {
+			counts = append(counts, fmt.Sprintf("%d %s", n, strings.ToLower(sev)))
+		}
+	}
+	var summary []string
+	switch f.Kind {
+	case "asset":
+		var about []string
+		for _, k := range []string{"environment", "criticality", "dataClassification"} {
+			if v := f.Context[k]; v != "" {
+				about = append(about, k+" "+strings.ToLower(v))
+			}
+		}
+		if owner := stringField(f.Details, "owner"); owner != "" {
+			about = append(about, "owned by "+owner)
+		}
+		if len(about) > 0 {
+			summary = append(summary, "The asset is "+strings.Join(about, ", ")+".")
+		}
+	case "scan":
+		s := fmt.Sprintf("The scan found %d host(s)", len(f.Hosts))
+		if d := stringField(f.Details, "scanDate"); d != "" {
+			s += " on " + d
+		}
+		summary = append(summary, s+".")
+	case "cve":
+		if f.Remediation != nil && f.Remediation.Description != "" {
+			summary = append(summary, truncate(f.Remediation.Description, 300))
+		}
+	}
+	if f.Open == 0 {
+		summary = append(summary, "There are no open findings.")
+	} else {
+		s := fmt.Sprintf("Open findings: %d (%s)", f.Open, strings.Join(counts, ", "))
+		if f.Kind != "asset" {
+			s += fmt.Sprintf(" on %d asset(s)", f.Assets)
+		}
+		summary = append(summary, s+".")
+		if f.Overdue > 0 {
+			summary = append(summary, fmt.Sprintf("Past the %d-day SLA: %d; the oldest has been open %d days.", f.SLADays, f.Overdue, f.Oldest))
+		} else {
+			summary = append(summary, fmt.Sprintf("All are within the %d-day SLA.", f.SLADays))
+		}
+	}
+
+	var steps []string
+	if f.Remediation != nil && f.Open > 0 {
+		steps = append(steps, f.Remediation.Summary)
+	}
+	for _, sev := range []string{"CRITICAL", "HIGH"} {
+		var ids []string
+		for _, fd := range f.Findings {
+			if fd.Severity == sev {
+				ids = append(ids, summaryFindingName(f, fd))
+			}
+		}
+		if len(ids) > 0 {
+			steps = append(steps, fmt.Sprintf("Fix the %s finding(s) first: %s.", strings.ToLower(sev), listWithMore(ids, 8)))
+		}
+	}
+	if f.Overdue > 0 {
+		var ids []string
+		for _, fd := range f.Findings {
+			if fd.Overdue {
+				ids = append(ids, summaryFindingName(f, fd))
+			}
+		}
+		steps = append(steps, fmt.Sprintf("Fix or request exceptions for the overdue finding(s): %s.", listWithMore(ids, 8)))
+	}
+	if f.Open > 0 && f.Counts["CRITICAL"]+f.Counts["HIGH"] < f.Open {
+		steps = append(steps, "Schedule the medium and low findings with the next regular patch cycle.")
+	}
+	if f.Omitted > 0 {
+		steps = append(steps, fmt.Sprintf("%d more finding(s) are not listed here; see the findings view.", f.Omitted))
+	}
+
+	var b strings.Builder
+	err := summaryTemplate.Execute(&b, map[string]interface{}{"Title": title, "Summary": summary, "Steps": steps})
+	return b.String(), err
+}
+
+// summaryFindingName names a finding in a list: by its id on an asset, and
+// with its asset elsewhere.
+func summaryFindingName(f *summaryFacts, fd summaryFinding) string {
+	switch {
+	case f.Kind == "asset" || fd.Asset == "":
+		return fd.ID
+	case f.Kind == "cve":
+		return fd.Asset
+	}
+	return fd.ID + " on " + fd.Asset
+}
+
+// listWithMore joins up to n items and says how many more there are.
+func listWithMore(items []string, n int) string {
+	if len(items) <= n {
+		return strings.Join(items, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(items[:n], ", "), len(items)-n)
+}
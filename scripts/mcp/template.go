@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// Templates given with the global --template flag render a command's
+// result. They see the same structure as the JSON output, so field names
+// are the JSON keys: {{range .content.assets}}.
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"join": func(sep string, v interface{}) string {
+		list, _ := v.([]interface{})
+		parts := make([]string, len(list))
+		for i, item := range list {
+			parts[i] = fmt.Sprint(item)
+		}
+		return strings.Join(parts, sep)
+	},
+	"upper":    strings.ToUpper,
+	"lower":    strings.ToLower,
+	"truncate": func(n int, s string) string { return truncate(s, n) },
+	"default": func(def, v interface{}) interface{} {
+		if v == nil || v == "" {
+			return def
+		}
+		return v
+	},
+}
+
+// parseOutputTemplate compiles the --template value. "@file" reads the
+// template from a file; \n and \t are unescaped so one-liners work in
+// single-quoted shell arguments.
+func parseOutputTemplate(text string) (*template.Template, error) {
+	if strings.HasPrefix(text, "@") {
+		data, err := readTextFile(text[1:])
+		if err != nil {
+			return nil, err
+		}
+		text = string(data)
+	} else {
+		text = strings.NewReplacer(`\n`, "\n", `\t`, "\t").Replace(text)
+	}
+	tmpl, err := template.New("output").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("--template: %w", err)
+	}
+	return tmpl, nil
+}
@@ -0,0 +1,23 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || windows)
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+type termState struct{}
+
+// makeRaw is not supported here; the shell falls back to line input.
+func makeRaw(fd int) (*termState, error) {
+	return nil, errors.New("raw terminal mode not supported on this platform")
+}
+
+func restoreTerm(fd int, state *termState) error {
+	return nil
+}
+
+// enableVirtualTerminal reports whether f understands ANSI escape
+// sequences, which is assumed here.
+func enableVirtualTerminal(f *os.File) bool { return true }
@@ -0,0 +1,49 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// termState is the terminal mode saved by makeRaw.
+type termState struct {
+	termios syscall.Termios
+}
+
+func ioctlTermios(fd int, req uintptr, t *syscall.Termios) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), req, uintptr(unsafe.Pointer(t))); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// makeRaw switches the terminal to byte-at-a-time input without echo and
+// returns the previous state. Output processing is left on so "\n" still
+// starts a new line.
+func makeRaw(fd int) (*termState, error) {
+	var old termState
+	if err := ioctlTermios(fd, ioctlGetTermios, &old.termios); err != nil {
+		return nil, err
+	}
+	raw := old.termios
+	raw.Iflag &^= syscall.ICRNL | syscall.IXON
+	raw.Lflag &^= syscall.ECHO | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err := ioctlTermios(fd, ioctlSetTermios, &raw); err != nil {
+		return nil, err
+	}
+	return &old, nil
+}
+
+// restoreTerm puts the terminal back into the state saved by makeRaw.
+func restoreTerm(fd int, state *termState) error {
+	return ioctlTermios(fd, ioctlSetTermios, &state.termios)
+}
+
+// enableVirtualTerminal reports whether f understands ANSI escape
+// sequences; terminals here do.
+func enableVirtualTerminal(f *os.File) bool { return true }
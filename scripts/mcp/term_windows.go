@@ -0,0 +1,73 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// The Windows console takes ANSI escape sequences, and sends them for the
+// arrow keys, once virtual terminal processing and input are switched on,
+// which Windows Terminal does and the classic console host does not.
+
+var (
+	kernel32           = syscall.NewLazyDLL("kernel32.dll")
+	procSetConsoleMode = kernel32.NewProc("SetConsoleMode")
+)
+
+// Console modes.
+const (
+	enableProcessedInput            = 0x0001
+	enableLineInput                 = 0x0002
+	enableEchoInput                 = 0x0004
+	enableVirtualTerminalInput      = 0x0200
+	enableVirtualTerminalProcessing = 0x0004
+)
+
+// termState is the console mode saved by makeRaw.
+type termState struct {
+	mode uint32
+}
+
+func setConsoleMode(h syscall.Handle, mode uint32) error {
+	if r, _, err := procSetConsoleMode.Call(uintptr(h), uintptr(mode)); r == 0 {
+		return err
+	}
+	return nil
+}
+
+// makeRaw switches the console to key-at-a-time input without echo, with
+// Ctrl-C read as a key, and returns the previous mode.
+func makeRaw(fd int) (*termState, error) {
+	h := syscall.Handle(fd)
+	var mode uint32
+	if err := syscall.GetConsoleMode(h, &mode); err != nil {
+		return nil, err
+	}
+	raw := mode&^(enableProcessedInput|enableLineInput|enableEchoInput) | enableVirtualTerminalInput
+	if err := setConsoleMode(h, raw); err != nil {
+		return nil, err
+	}
+	enableVirtualTerminal(os.Stdout)
+	return &termState{mode: mode}, nil
+}
+
+// restoreTerm puts the console back into the mode saved by makeRaw.
+func restoreTerm(fd int, state *termState) error {
+	return setConsoleMode(syscall.Handle(fd), state.mode)
+}
+
+// enableVirtualTerminal switches on escape sequence processing for the
+// console f and reports whether the console supports it.
+func enableVirtualTerminal(f *os.File) bool {
+	h := syscall.Handle(f.Fd())
+	var mode uint32
+	if err := syscall.GetConsoleMode(h, &mode); err != nil {
+		return false
+	}
+	if mode&enableVirtualTerminalProcessing != 0 {
+		return true
+	}
+	return setConsoleMode(h, mode|enableVirtualTerminalProcessing) == nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// -o tfdata writes assets and workgroups in a fixed, versioned schema for
+// Terraform data sources and providers:
+//
+//	{
+//	  "schema_version": "1.0",
+//	  "assets":     [{"id": "42", "name": "web-01", "type": "SERVER", ..., "tags": {"team": "payments"}}],
+//	  "workgroups": [{"id": "7", "name": "payments", "description": ""}]
+//	}
+//
+// Every field is always present: scalars are strings ("" when unset), tags
+// a map and the lists never null, so Terraform sees the same types on every
+// run. Records are sorted by id. Within a major version fields are only
+// added, never renamed, removed or retyped; anything else is a new major
+// version.
+//
+// Consumers name the major versions they understand with --tfdata-version
+// (or SECMAN_TFDATA_VERSION), e.g. "2,1"; the newest one this client also
+// writes is used, and none in common is an error. Without it the newest
+// version is written.
+
+// tfdataVersions are the schema versions this client writes, by major.
+var tfdataVersions = map[int]string{1: "1.0"}
+
+// negotiateTfdataVersion picks the schema version for the accepted
+// majors, a comma-separated list such as "2,1" or "1.0".
+func negotiateTfdataVersion(accepted string) (string, error) {
+	var supported []int
+	for major := range tfdataVersions {
+		supported = append(supported, major)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(supported)))
+	if strings.TrimSpace(accepted) == "" {
+		return tfdataVersions[supported[0]], nil
+	}
+
+	best := 0
+	for _, v := range splitList(accepted) {
+		majorText, _, _ := strings.Cut(strings.TrimPrefix(v, "v"), ".")
+		major, err := strconv.Atoi(majorText)
+		if err != nil {
+			return "", fmt.Errorf("--tfdata-version: %q is not a version", v)
+		}
+		if _, ok := tfdataVersions[major]; ok && major > best {
+			best = major
+		}
+	}
+	if best == 0 {
+		var have []string
+		for _, major := range supported {
+			have = append(have, tfdataVersions[major])
+		}
+		return "", fmt.Errorf("tfdata schema %s is not supported; this client writes %s", accepted, strings.Join(have, ", "))
+	}
+	return tfdataVersions[best], nil
+}
+
+type tfdataRenderer struct {
+	version string
+}
+
+func (r tfdataRenderer) Render(w io.Writer, v interface{}) error {
+	data, err := normalize(v)
+	if err != nil {
+		return err
+	}
+	m, _ := data.(map[string]interface{})
+	if content, ok := m["content"].(map[string]interface{}); ok {
+		if _, isResult := m["isError"]; isResult {
+			m = content
+		}
+	}
+	assets, hasAssets := m["assets"].([]interface{})
+	workgroups, hasWorkgroups := m["workgroups"].([]interface{})
+	if !hasAssets && !hasWorkgroups {
+		return fmt.Errorf("-o tfdata covers assets and workgroups; use it with the assets or workgroups command")
+	}
+
+	out := map[string]interface{}{
+		"schema_version": r.version,
+		"assets":         tfdataRecords(assets, tfdataAsset),
+		"workgroups":     tfdataRecords(workgroups, tfdataWorkgroup),
+	}
+	encoded, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(encoded))
+	return err
+}
+
+func tfdataRecords(items []interface{}, convert func(map[string]interface{}) map[string]interface{}) []map[string]interface{} {
+	out := make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		if rec, ok := item.(map[string]interface{}); ok {
+			out = append(out, convert(rec))
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		a, _ := strconv.ParseInt(out[i]["id"].(string), 10, 64)
+		b, _ := strconv.ParseInt(out[j]["id"].(string), 10, 64)
+		return a < b
+	})
+	return out
+}
+
+// tfdataAsset is an asset in schema 1.
+func tfdataAsset(a map[string]interface{}) map[string]interface{} {
+	ctx := assetContext(a)
+	tags := map[string]string{}
+	for _, t := range stringsField(a, "tags") {
+		if k, v, ok := strings.Cut(t, "="); ok {
+			tags[k] = v
+		}
+	}
+	return map[string]interface{}{
+		"id":                  stringField(a, "id"),
+		"name":                stringField(a, "name"),
+		"type":                stringField(a, "type"),
+		"owner":               stringField(a, "owner"),
+		"ip":                  stringField(a, "ip"),
+		"uri":                 stringField(a, "uri"),
+		"description":         stringField(a, "description"),
+		"criticality":         ctx["criticality"],
+		"environment":         ctx["environment"],
+		"data_classification": ctx["dataClassification"],
+		"business_owner":      ctx["businessOwner"],
+		"ad_domain":           stringField(a, "adDomain"),
+		"cloud_account_id":    stringField(a, "cloudAccountId"),
+		"last_seen":           stringField(a, "lastSeen"),
+		"tags":                tags,
+	}
+}
+
+// tfdataWorkgroup is a workgroup in schema 1.
+func tfdataWorkgroup(wg map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"id":          stringField(wg, "id"),
+		"name":        stringField(wg, "name"),
+		"description": stringField(wg, "description"),
+	}
+}
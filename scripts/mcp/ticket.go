@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// `ticket <system>` opens tickets for findings in ServiceNow or Azure
+// DevOps. Both group findings the same way, one ticket per finding or per
+// asset, and tag each ticket with a correlation id (secman:finding:<id> or
+// secman:asset:<id>) so a second run skips findings that already have an
+// open ticket.
+
+func cmdTicket(client *McpClient, osArgs []string) {
+	if len(osArgs) < 1 {
+		fmt.Fprintf(os.Stderr, "Usage: %s ticket <servicenow|azure-devops> [options]\n", progName())
+		exit(ExitUsage)
+	}
+	switch osArgs[0] {
+	case "servicenow":
+		cmdTicketServiceNow(client, osArgs[1:])
+	case "azure-devops":
+		cmdTicketAzureDevOps(client, osArgs[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown ticket system: %s (supported: servicenow, azure-devops)\n", osArgs[0])
+		exit(ExitUsage)
+	}
+}
+
+// findingTicket is one ticket to create: a single finding, or all findings
+// of an asset with --per asset.
+type findingTicket struct {
+	CorrelationID string                   `json:"correlationId"`
+	AssetName     string                   `json:"assetName"`
+	Findings      []map[string]interface{} `json:"-"`
+	Severity      string                   `json:"severity"`
+	Number        string                   `json:"number,omitempty"`
+	SysID         string                   `json:"sysId,omitempty"`
+	URL           string                   `json:"url,omitempty"`
+	Status        string                   `json:"status"`
+	Error         string                   `json:"error,omitempty"`
+}
+
+// ticketFindings fetches the findings selected by the ticket commands'
+// --severity, --cve and --asset-id flags.
+func ticketFindings(client *McpClient, severity, cve string, assetID int64) ([]map[string]interface{}, error) {
+	args := map[string]interface{}{}
+	if cve != "" {
+		args["cveId"] = cve
+	}
+	if assetID > 0 {
+		args["assetId"] = assetID
+	}
+	findings, err := listAll(client, "get_vulnerabilities", "vulnerabilities", args, 500)
+	if err != nil {
+		return nil, err
+	}
+	if severity != "" {
+		kept := findings[:0]
+		for _, f := range findings {
+			if strings.EqualFold(stringField(f, "cvssSeverity"), severity) {
+				kept = append(kept, f)
+			}
+		}
+		findings = kept
+	}
+	return findings, nil
+}
+
+// findingTickets groups findings into tickets, ordered by severity.
+func findingTickets(findings []map[string]interface{}, per string) []*findingTicket {
+	var tickets []*findingTicket
+	byAsset := map[int64]*findingTicket{}
+	for _, f := range findings {
+		sev := strings.ToUpper(stringField(f, "cvssSeverity"))
+		if per == "finding" {
+			tickets = append(tickets, &findingTicket{
+				CorrelationID: fmt.Sprintf("secman:finding:%d", int64(numberField(f, "id"))),
+				AssetName:     stringField(f, "assetName"),
+				Findings:      []map[string]interface{}{f},
+				Severity:      sev,
+			})
+			continue
+		}
+		id := int64(numberField(f, "assetId"))
+		t := byAsset[id]
+		if t == nil {
+			t = &findingTicket{CorrelationID: fmt.Sprintf("secman:asset:%d", id), AssetName: stringField(f, "assetName"), Severity: sev}
+			byAsset[id] = t
+			tickets = append(tickets, t)
+		}
+		t.Findings = append(t.Findings, f)
+		if severityFactor(sev) > severityFactor(t.Severity) {
+			t.Severity = sev
+		}
+	}
+	sort.SliceStable(tickets, func(i, j int) bool {
+		return severityFactor(tickets[i].Severity) > severityFactor(tickets[j].Severity)
+	})
+	return tickets
+}
+
+func (t *findingTicket) shortDescription() string {
+	if len(t.Findings) == 1 {
+		return fmt.Sprintf("%s on %s (%s)", stringField(t.Findings[0], "vulnerabilityId"), t.AssetName, t.Severity)
+	}
+	return fmt.Sprintf("%d vulnerabilities on %s (highest %s)", len(t.Findings), t.AssetName, t.Severity)
+}
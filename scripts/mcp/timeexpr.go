@@ -0,0 +1,186 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Time expressions are what the time filter flags accept:
+//
+//	2025-01-01             midnight UTC of that day
+//	2025-01-01T08:00:00Z   an RFC 3339 time (2025-01-01T08:00 is taken as UTC)
+//	7d, 12h, 2w, 3mo, 1y   that long before now; units combine, as in 1d12h
+//	now, today, yesterday  today and yesterday start at midnight UTC
+//
+// Ranges compare with After inclusive and Before exclusive, so
+// --created-after 2025-01-01 --created-before 2025-02-01 is January.
+
+// parseTimeExpr resolves a time expression relative to now.
+func parseTimeExpr(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	now = now.UTC()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	switch strings.ToLower(s) {
+	case "now":
+		return now, nil
+	case "today":
+		return midnight, nil
+	case "yesterday":
+		return midnight.AddDate(0, 0, -1), nil
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	if t, ok := parseRelativeTime(s, now); ok {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (use YYYY-MM-DD, RFC 3339 or an age such as 7d, 12h, 2w, 3mo)", s)
+}
+
+// parseRelativeTime subtracts an age such as 1d12h from now. Days, weeks,
+// months and years are calendar units.
+func parseRelativeTime(s string, now time.Time) (time.Time, bool) {
+	if s == "" {
+		return time.Time{}, false
+	}
+	t := now
+	for s != "" {
+		i := 0
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+		if i == 0 {
+			return time.Time{}, false
+		}
+		n, err := strconv.Atoi(s[:i])
+		if err != nil {
+			return time.Time{}, false
+		}
+		s = s[i:]
+		unit := s
+		for j := 0; j < len(s); j++ {
+			if s[j] >= '0' && s[j] <= '9' {
+				unit = s[:j]
+				break
+			}
+		}
+		s = s[len(unit):]
+		switch strings.ToLower(unit) {
+		case "s":
+			t = t.Add(-time.Duration(n) * time.Second)
+		case "m":
+			t = t.Add(-time.Duration(n) * time.Minute)
+		case "h":
+			t = t.Add(-time.Duration(n) * time.Hour)
+		case "d":
+			t = t.AddDate(0, 0, -n)
+		case "w":
+			t = t.AddDate(0, 0, -7*n)
+		case "mo":
+			t = t.AddDate(0, -n, 0)
+		case "y":
+			t = t.AddDate(-n, 0, 0)
+		default:
+			return time.Time{}, false
+		}
+	}
+	return t, true
+}
+
+// timeRange is a window of time; a zero bound is open.
+type timeRange struct {
+	After  time.Time `json:"after,omitempty"`
+	Before time.Time `json:"before,omitempty"`
+}
+
+func (r timeRange) set() bool {
+	return !r.After.IsZero() || !r.Before.IsZero()
+}
+
+func (r timeRange) contains(t time.Time) bool {
+	return (r.After.IsZero() || !t.Before(r.After)) && (r.Before.IsZero() || t.Before(r.Before))
+}
+
+// matches reports whether the first of fields that holds a server
+// timestamp lies in the range. A record with none of them does not match.
+func (r timeRange) matches(m map[string]interface{}, fields ...string) bool {
+	for _, f := range fields {
+		if t, ok := parseServerTime(stringField(m, f)); ok {
+			return r.contains(t)
+		}
+	}
+	return false
+}
+
+// filter keeps the records in the range, by the first of fields they have.
+func (r timeRange) filter(items []map[string]interface{}, fields ...string) []map[string]interface{} {
+	if !r.set() {
+		return items
+	}
+	out := make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		if r.matches(item, fields...) {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// timeRangeFlags holds the --<name>-after and --<name>-before flags of one
+// time field, and --since when the field has it as shorthand.
+type timeRangeFlags struct {
+	name          string
+	since         *string
+	after, before *string
+}
+
+// addTimeRangeFlags registers --<name>-after and --<name>-before, plus
+// --since for the command's main time field when withSince is set.
+func addTimeRangeFlags(fs *flag.FlagSet, name, what string, withSince bool) *timeRangeFlags {
+	f := &timeRangeFlags{name: name}
+	if withSince {
+		f.since = fs.String("since", "", "Only "+what+" since this time (same as --"+name+"-after)")
+	}
+	f.after = fs.String(name+"-after", "", "Only "+what+" at or after this time (YYYY-MM-DD, RFC 3339, or an age: 7d, 12h, 3mo)")
+	f.before = fs.String(name+"-before", "", "Only "+what+" before this time")
+	return f
+}
+
+// resolve parses the flags; it exits with a usage error on bad values.
+func (f *timeRangeFlags) resolve() timeRange {
+	now := time.Now()
+	var r timeRange
+	after := *f.after
+	if f.since != nil && *f.since != "" {
+		if after != "" {
+			fmt.Fprintf(os.Stderr, "Error: --since and --%s-after are the same filter; give one\n", f.name)
+			exit(ExitUsage)
+		}
+		after = *f.since
+	}
+	for _, p := range []struct {
+		flag, value string
+		dst         *time.Time
+	}{{f.name + "-after", after, &r.After}, {f.name + "-before", *f.before, &r.Before}} {
+		if p.value == "" {
+			continue
+		}
+		t, err := parseTimeExpr(p.value, now)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --%s: %v\n", p.flag, err)
+			exit(ExitUsage)
+		}
+		*p.dst = t
+	}
+	if !r.After.IsZero() && !r.Before.IsZero() && !r.After.Before(r.Before) {
+		fmt.Fprintf(os.Stderr, "Error: --%s-after must be earlier than --%s-before\n", f.name, f.name)
+		exit(ExitUsage)
+	}
+	return r
+}
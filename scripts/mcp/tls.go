@@ -0,0 +1,129 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Strict TLS mode, for deployments that must use approved cryptography:
+// TLS 1.2 or newer, ECDHE key exchange on the NIST curves P-256 and P-384
+// and AES-GCM cipher suites. Go picks the TLS 1.3 suites itself; build with
+// GOFIPS140 (Go 1.24+) to restrict those to approved ones as well.
+//
+// Certificates may additionally be pinned: SECMAN_TLS_PIN lists the
+// accepted public keys as sha256/<base64 of the SHA-256 of the
+// SubjectPublicKeyInfo>, the format used by curl --pinnedpubkey. A
+// connection is accepted when any certificate of the verified chain
+// matches, so pinning the issuing CA survives leaf renewals.
+
+var strictCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+}
+
+// WithStrictTLS enforces the strict TLS settings and, when pins are given,
+// certificate pinning. It can be combined with WithDebug in either order.
+func WithStrictTLS(pins []string) ClientOption {
+	return func(c *McpClient) {
+		c.strictTLS = true
+		c.tlsPins = pins
+		transport := strictTransport(pins)
+		if dt, ok := c.HTTP.Transport.(*debugTransport); ok {
+			dt.base = transport
+			return
+		}
+		c.HTTP.Transport = transport
+	}
+}
+
+func strictTransport(pins []string) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{
+		MinVersion:       tls.VersionTLS12,
+		CipherSuites:     strictCipherSuites,
+		CurvePreferences: []tls.CurveID{tls.CurveP256, tls.CurveP384},
+	}
+	if len(pins) > 0 {
+		transport.TLSClientConfig.VerifyConnection = verifyPins(pins)
+	}
+	return transport
+}
+
+// parsePins validates a comma-separated SECMAN_TLS_PIN value.
+func parsePins(spec string) ([]string, error) {
+	var pins []string
+	for _, pin := range splitList(spec) {
+		digest, ok := strings.CutPrefix(pin, "sha256/")
+		if raw, err := base64.StdEncoding.DecodeString(digest); !ok || err != nil || len(raw) != sha256.Size {
+			return nil, fmt.Errorf("invalid TLS pin %q (want sha256/<base64 SHA-256 of the public key>)", pin)
+		}
+		pins = append(pins, pin)
+	}
+	return pins, nil
+}
+
+func verifyPins(pins []string) func(tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		for _, chain := range cs.VerifiedChains {
+			for _, cert := range chain {
+				if pinMatches(pins, spkiPin(cert.RawSubjectPublicKeyInfo)) {
+					return nil
+				}
+			}
+		}
+		leaf := "no certificate"
+		if len(cs.PeerCertificates) > 0 {
+			leaf = spkiPin(cs.PeerCertificates[0].RawSubjectPublicKeyInfo)
+		}
+		return fmt.Errorf("certificate pin mismatch for %s: no certificate in the chain matches SECMAN_TLS_PIN (server key %s)", cs.ServerName, leaf)
+	}
+}
+
+func spkiPin(spki []byte) string {
+	sum := sha256.Sum256(spki)
+	return "sha256/" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func pinMatches(pins []string, pin string) bool {
+	for _, p := range pins {
+		if p == pin {
+			return true
+		}
+	}
+	return false
+}
+
+// strictTLSOption returns the WithStrictTLS option when strict mode is on,
+// by SECMAN_STRICT_TLS or because pins are configured, and nil otherwise.
+func strictTLSOption(baseURL, pinSpec string) (ClientOption, error) {
+	strict, err := strconv.ParseBool(settingOr("SECMAN_STRICT_TLS", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("SECMAN_STRICT_TLS must be true or false")
+	}
+	if !strict && pinSpec == "" {
+		return nil, nil
+	}
+	if err := checkStrictURL(baseURL); err != nil {
+		return nil, err
+	}
+	pins, err := parsePins(pinSpec)
+	if err != nil {
+		return nil, err
+	}
+	return WithStrictTLS(pins), nil
+}
+
+// checkStrictURL rejects plain-HTTP base URLs in strict mode.
+func checkStrictURL(baseURL string) error {
+	if !strings.HasPrefix(strings.ToLower(baseURL), "https://") {
+		return fmt.Errorf("--strict-tls requires an https:// base URL, got %s", baseURL)
+	}
+	return nil
+}
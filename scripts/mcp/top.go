@@ -0,0 +1,200 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// top ranks assets, CVEs or owners by one count over the open findings:
+//
+//	go run . top assets --by open-critical
+//	go run . top cves --by affected-assets -n 20
+//	go run . top owners --by overdue
+//
+// Every row carries all counts, so the ranking metric is only the sort
+// order. report risk-ranking ranks by a weighted risk score instead.
+
+// topMetrics are the --by values per subject.
+var topMetrics = map[string][]string{
+	"assets": {"open", "open-critical", "open-high", "overdue", "oldest"},
+	"cves":   {"affected-assets", "open", "open-critical", "overdue", "oldest"},
+	"owners": {"open", "open-critical", "open-high", "overdue", "affected-assets", "oldest"},
+}
+
+// topRow is one ranked asset, CVE or owner.
+type topRow struct {
+	Rank           int    `json:"rank"`
+	Name           string `json:"name"`
+	AssetID        int64  `json:"assetId,omitempty"`
+	Value          int    `json:"value"`
+	Open           int    `json:"open"`
+	Critical       int    `json:"critical"`
+	High           int    `json:"high"`
+	Overdue        int    `json:"overdue"`
+	AffectedAssets int    `json:"affectedAssets"`
+	OldestDays     int    `json:"oldestDays"`
+
+	assets map[int64]bool
+}
+
+func (r *topRow) metric(by string) int {
+	switch by {
+	case "open-critical":
+		return r.Critical
+	case "open-high":
+		return r.High
+	case "overdue":
+		return r.Overdue
+	case "affected-assets":
+		return r.AffectedAssets
+	case "oldest":
+		return r.OldestDays
+	}
+	return r.Open
+}
+
+// rankTop groups the findings by subject and sorts the groups by the
+// metric, then by critical and open findings and name. Groups where the
+// metric is zero are left out.
+func rankTop(findings []map[string]interface{}, assets map[int64]map[string]interface{}, subject, by string, now time.Time) []topRow {
+	groups := map[string]*topRow{}
+	for _, f := range findings {
+		assetID := findingAssetID(f)
+		var key string
+		switch subject {
+		case "assets":
+			key = fmt.Sprint(assetID)
+		case "cves":
+			key = strings.ToUpper(stringField(f, "vulnerabilityId"))
+		case "owners":
+			key = stringField(assets[assetID], "owner")
+			if key == "" {
+				key = "(no owner)"
+			}
+		}
+		if key == "" {
+			continue
+		}
+		r := groups[key]
+		if r == nil {
+			r = &topRow{Name: key, assets: map[int64]bool{}}
+			if subject == "assets" {
+				r.AssetID = assetID
+				if r.Name = stringField(f, "assetName"); r.Name == "" {
+					r.Name = stringField(assets[assetID], "name")
+				}
+			}
+			groups[key] = r
+		}
+		r.Open++
+		switch strings.ToUpper(stringField(f, "cvssSeverity")) {
+		case "CRITICAL":
+			r.Critical++
+		case "HIGH":
+			r.High++
+		}
+		if isOverdue(f) {
+			r.Overdue++
+		}
+		if days, ok := findingAge(f, now); ok && days > r.OldestDays {
+			r.OldestDays = days
+		}
+		r.assets[assetID] = true
+		r.AffectedAssets = len(r.assets)
+	}
+
+	rows := make([]topRow, 0, len(groups))
+	for _, r := range groups {
+		r.Value = r.metric(by)
+		if r.Value > 0 {
+			rows = append(rows, *r)
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if a.Value != b.Value {
+			return a.Value > b.Value
+		}
+		if a.Critical != b.Critical {
+			return a.Critical > b.Critical
+		}
+		if a.Open != b.Open {
+			return a.Open > b.Open
+		}
+		return a.Name < b.Name
+	})
+	for i := range rows {
+		rows[i].Rank = i + 1
+	}
+	return rows
+}
+
+func cmdTop(client *McpClient, osArgs []string) {
+	usage := "Usage: " + progName() + " top assets|cves|owners [--by metric] [-n 10] [--severity S] [--json]"
+	if len(osArgs) == 0 || topMetrics[osArgs[0]] == nil {
+		fmt.Fprintln(os.Stderr, "Error: what to rank is required: assets, cves or owners")
+		fmt.Fprintln(os.Stderr, usage)
+		exit(ExitUsage)
+	}
+	subject := osArgs[0]
+	metrics := topMetrics[subject]
+
+	fs := flag.NewFlagSet("top "+subject, flag.ContinueOnError)
+	by := fs.String("by", metrics[0], "Rank by: "+strings.Join(metrics, ", "))
+	n := fs.Int("n", 10, "Number of entries to show (0 for all)")
+	severity := fs.String("severity", "", "Only count findings of this severity (CRITICAL, HIGH, MEDIUM, LOW)")
+	business := addAssetContextFlags(fs, "asset-criticality")
+	asJSON := fs.Bool("json", false, "Print the ranking as JSON")
+	parseFlags(fs, osArgs[1:])
+
+	if !containsFold(metrics, *by) {
+		fmt.Fprintf(os.Stderr, "Error: top %s --by must be one of %s\n", subject, strings.Join(metrics, ", "))
+		exit(ExitUsage)
+	}
+	*by = strings.ToLower(*by)
+
+	args := map[string]interface{}{}
+	if *severity != "" {
+		args["severity"] = *severity
+	}
+	findings, err := listAll(client, "get_vulnerabilities", "vulnerabilities", args, 500)
+	if err != nil {
+		fatal(err)
+	}
+	var assets map[int64]map[string]interface{}
+	if subject == "owners" || business.active() {
+		if assets, err = assetsByID(client); err != nil {
+			fatal(err)
+		}
+	}
+	if business.active() {
+		kept := findings[:0]
+		for _, f := range findings {
+			if business.matches(assets[findingAssetID(f)]) {
+				kept = append(kept, f)
+			}
+		}
+		findings = kept
+	}
+
+	rows := rankTop(findings, assets, subject, *by, time.Now())
+	total := len(rows)
+	if *n > 0 && len(rows) > *n {
+		rows = rows[:*n]
+	}
+	if rawOutput(*asJSON) {
+		printResult(map[string]interface{}{"subject": subject, "by": *by, "ranking": rows, "totalElements": total})
+		return
+	}
+
+	fmt.Printf("Top %d of %d %s by %s\n\n", len(rows), total, subject, *by)
+	fmt.Printf("  %4s  %-40s %6s %6s %6s %7s %7s %7s\n", "#", strings.ToUpper(strings.TrimSuffix(subject, "s")), "OPEN", "CRIT", "HIGH", "OVERDUE", "ASSETS", "OLDEST")
+	for _, r := range rows {
+		fmt.Printf("  %4d  %-40s %6d %s %s %7d %7d %6dd\n", r.Rank, truncate(r.Name, 40), r.Open,
+			countCell("CRITICAL", r.Critical), countCell("HIGH", r.High), r.Overdue, r.AffectedAssets, r.OldestDays)
+	}
+}
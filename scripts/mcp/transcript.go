@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A transcript records a session for review: every tool call with its
+// arguments and result, and the exchanges with the LLM of ask and
+// summarize, so an AI-assisted investigation can be followed step by step
+// and repeated. Unlike the audit log it stores the content, so everything
+// passes through the redaction of --debug first. It is written only when
+// --transcript or SECMAN_TRANSCRIPT names a file; sessions are appended.
+
+// transcriptEntry is one line of a transcript.
+type transcriptEntry struct {
+	Session    string                 `json:"session"`
+	Seq        int                    `json:"seq"`
+	Time       string                 `json:"time"`
+	Kind       string                 `json:"kind"`
+	Command    string                 `json:"command,omitempty"`
+	Args       []string               `json:"args,omitempty"`
+	BaseURL    string                 `json:"baseUrl,omitempty"`
+	UserEmail  string                 `json:"userEmail,omitempty"`
+	Tenant     string                 `json:"tenant,omitempty"`
+	Source     string                 `json:"source,omitempty"`
+	Tool       string                 `json:"tool,omitempty"`
+	Arguments  map[string]interface{} `json:"arguments,omitempty"`
+	Result     interface{}            `json:"result,omitempty"`
+	IsError    bool                   `json:"isError,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+	DurationMs int64                  `json:"durationMs,omitempty"`
+	Model      string                 `json:"model,omitempty"`
+	Messages   []llmMessage           `json:"messages,omitempty"`
+	Answer     string                 `json:"answer,omitempty"`
+}
+
+const (
+	transcriptSession = "session"
+	transcriptTool    = "tool"
+	transcriptLLM     = "llm"
+)
+
+// transcript appends the entries of one session to a file.
+type transcript struct {
+	mu      sync.Mutex
+	path    string
+	session string
+	seq     int
+}
+
+// openTranscript starts a session in the file at path, recording how the
+// CLI was run.
+func openTranscript(c *McpClient, path string) (*transcript, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	t := &transcript{path: path, session: hex.EncodeToString(id)}
+	args := make([]string, len(os.Args)-1)
+	for i, a := range os.Args[1:] {
+		args[i] = redactString(a)
+	}
+	return t, t.append(&transcriptEntry{
+		Kind:      transcriptSession,
+		Args:      args,
+		BaseURL:   c.BaseURL,
+		UserEmail: c.UserEmail,
+		Tenant:    c.Tenant,
+	})
+}
+
+func (t *transcript) append(entry *transcriptEntry) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.seq++
+	entry.Session, entry.Seq = t.session, t.seq
+	entry.Time = time.Now().UTC().Format(time.RFC3339Nano)
+	if entry.Command == "" {
+		entry.Command = currentCommand
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(t.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := lockFile(f); err != nil {
+		return err
+	}
+	defer unlockFile(f)
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// record appends an entry; like the audit log, a transcript that cannot be
+// written is reported but does not fail the command.
+func (t *transcript) record(entry *transcriptEntry) {
+	if t == nil {
+		return
+	}
+	if err := t.append(entry); err != nil {
+		pauseProgress(func() { fmt.Fprintf(os.Stderr, "Warning: transcript: %v\n", err) })
+	}
+}
+
+// recordTranscript records a tool call. source says where the result came
+// from when it was not the server: "snapshot", "dry-run", or "refused" for
+// calls the serve-stdio policy stopped.
+func (c *McpClient) recordTranscript(source, tool string, args map[string]interface{}, result *ToolCallResult, callErr error, started time.Time) {
+	if c.transcript == nil {
+		return
+	}
+	entry := &transcriptEntry{
+		Kind:       transcriptTool,
+		Source:     source,
+		Tool:       tool,
+		DurationMs: time.Since(started).Milliseconds(),
+	}
+	if args != nil {
+		entry.Arguments = redactValue(args).(map[string]interface{})
+	}
+	if callErr != nil {
+		entry.Error = redactString(callErr.Error())
+	}
+	if result != nil {
+		entry.Result, entry.IsError = transcriptContent(result.Content), result.IsError
+	}
+	c.transcript.record(entry)
+}
+
+// recordLLM records a chat with the LLM.
+func (c *McpClient) recordLLM(model string, messages []llmMessage, answer string, callErr error, started time.Time) {
+	if c.transcript == nil {
+		return
+	}
+	entry := &transcriptEntry{
+		Kind:       transcriptLLM,
+		Model:      model,
+		Answer:     redactString(answer),
+		DurationMs: time.Since(started).Milliseconds(),
+	}
+	for _, m := range messages {
+		entry.Messages = append(entry.Messages, llmMessage{Role: m.Role, Content: redactString(m.Content)})
+	}
+	if callErr != nil {
+		entry.Error = redactString(callErr.Error())
+	}
+	c.transcript.record(entry)
+}
+
+// transcriptContent redacts a result. Text items holding JSON, which is
+// how the server answers, are stored decoded so sensitive fields are
+// caught and the transcript stays readable.
+func transcriptContent(content interface{}) interface{} {
+	items, ok := content.([]interface{})
+	if !ok {
+		return redactValue(content)
+	}
+	out := make([]interface{}, len(items))
+	for i, item := range items {
+		m, ok := item.(map[string]interface{})
+		text, isText := m["text"].(string)
+		if !ok || !isText {
+			out[i] = redactValue(item)
+			continue
+		}
+		var decoded interface{}
+		if err := json.Unmarshal([]byte(text), &decoded); err == nil {
+			out[i] = map[string]interface{}{"type": m["type"], "json": redactValue(decoded)}
+		} else {
+			out[i] = map[string]interface{}{"type": m["type"], "text": redactString(text)}
+		}
+	}
+	return out
+}
+
+func cmdTranscript(osArgs []string) {
+	usage := "Usage: " + progName() + " transcript show <file> [--session <id>] [--full]"
+	if len(osArgs) < 1 || osArgs[0] != "show" {
+		fmt.Fprintln(os.Stderr, "Error: transcript subcommand required")
+		fmt.Fprintln(os.Stderr, usage)
+		exit(ExitUsage)
+	}
+	fs := flag.NewFlagSet("transcript show", flag.ContinueOnError)
+	session := fs.String("session", "", "Show only this session (default: all)")
+	full := fs.Bool("full", false, "Print arguments, results and LLM answers in full")
+	asJSON := fs.Bool("json", false, "Print the entries as JSON")
+	words := parseInterspersed(fs, osArgs[1:])
+	path := setting("SECMAN_TRANSCRIPT")
+	if len(words) > 0 {
+		path = words[0]
+	}
+	if path == "" {
+		fmt.Fprintln(os.Stderr, "Error: transcript file required")
+		fmt.Fprintln(os.Stderr, usage)
+		exit(ExitUsage)
+	}
+
+	entries, err := readTranscript(path, *session)
+	if err != nil {
+		fatal(err)
+	}
+	if rawOutput(*asJSON) {
+		printResult(entries)
+		return
+	}
+	if len(entries) == 0 {
+		status(0, "No entries\n")
+		exit(ExitNotFound)
+	}
+	width := 160
+	if *full {
+		width = 0
+	}
+	clip := func(s string) string {
+		if width == 0 {
+			return s
+		}
+		return truncate(strings.Join(strings.Fields(s), " "), width)
+	}
+	for _, e := range entries {
+		switch e.Kind {
+		case transcriptSession:
+			fmt.Printf("\n=== session %s  %s\n  %s as %s", e.Session, e.Time,
+				orNone(e.BaseURL), orNone(e.UserEmail))
+			if e.Tenant != "" {
+				fmt.Printf(" (tenant %s)", e.Tenant)
+			}
+			fmt.Printf("\n  secman-mcp %s\n", strings.Join(e.Args, " "))
+		case transcriptTool:
+			args, _ := json.Marshal(e.Arguments)
+			outcome := paint(styleOK, "ok")
+			switch {
+			case e.Error != "":
+				outcome = paint(styleFail, "error: "+e.Error)
+			case e.IsError:
+				outcome = paint(styleFail, "tool error")
+			}
+			if e.Source != "" {
+				outcome += " (" + e.Source + ")"
+			}
+			fmt.Printf("%3d [%s] %s %s  %s %dms\n", e.Seq, e.Command, e.Tool, string(args), outcome, e.DurationMs)
+			if *full && e.Result != nil {
+				result, _ := json.MarshalIndent(e.Result, "      ", "  ")
+				fmt.Printf("      %s\n", result)
+			}
+		case transcriptLLM:
+			fmt.Printf("%3d [%s] llm %s  %dms\n", e.Seq, e.Command, e.Model, e.DurationMs)
+			if *full {
+				for _, m := range e.Messages {
+					fmt.Printf("      %s: %s\n", m.Role, clip(m.Content))
+				}
+			} else if n := len(e.Messages); n > 0 {
+				fmt.Printf("      %s: %s\n", e.Messages[n-1].Role, clip(e.Messages[n-1].Content))
+			}
+			if e.Error != "" {
+				fmt.Printf("      %s\n", paint(styleFail, "error: "+e.Error))
+			} else {
+				fmt.Printf("      answer: %s\n", clip(e.Answer))
+			}
+		}
+	}
+}
+
+// readTranscript parses the entries of a transcript, of one session when
+// session is set; a prefix of the id will do.
+func readTranscript(path, session string) ([]transcriptEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	entries := []transcriptEntry{}
+	scanner := bufio.NewScanner(f)
+	// Results of list tools make long lines.
+	scanner.Buffer(make([]byte, 64<<10), 64<<20)
+	for n := 1; scanner.Scan(); n++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var entry transcriptEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("%s: line %d: %w", path, n, err)
+		}
+		if session == "" || strings.HasPrefix(entry.Session, session) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
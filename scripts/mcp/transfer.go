@@ -0,0 +1,102 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// chunkedDownload reads a file exposed through a chunk tool (offset/length
+// in, base64 data and eof out) and writes it to w. The first chunk's
+// metadata (fileName, sha256, size, ...) is returned.
+func chunkedDownload(client *McpClient, tool string, args map[string]interface{}, chunkSize int, w io.Writer) (map[string]interface{}, error) {
+	if err := client.requireTool(tool); err != nil {
+		return nil, err
+	}
+
+	var meta map[string]interface{}
+	var offset int64
+	for {
+		chunkArgs := map[string]interface{}{"offset": offset, "length": chunkSize}
+		for k, v := range args {
+			chunkArgs[k] = v
+		}
+		chunk, err := client.callToolMap(tool, chunkArgs)
+		if err != nil {
+			return nil, err
+		}
+		if meta == nil {
+			meta = chunk
+		}
+
+		encoded, _ := chunk["data"].(string)
+		data, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("decode chunk at offset %d: %w", offset, err)
+		}
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		offset += int64(len(data))
+
+		if eof, _ := chunk["eof"].(bool); eof || len(data) == 0 {
+			return meta, nil
+		}
+	}
+}
+
+// downloadVerified streams fetch into a temporary file in dir, checks the
+// SHA-256 reported by fetch (if any) and only then renames the file to its
+// final name, so an interrupted or corrupted transfer never leaves a
+// plausible-looking file behind. An empty name uses the name from fetch.
+func downloadVerified(dir, name string, fetch func(w io.Writer) (fileName, checksum string, err error)) (string, error) {
+	if dir == "" {
+		dir = "."
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+
+	tmp, err := os.CreateTemp(dir, ".secman-download-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	fileName, checksum, err := fetch(io.MultiWriter(tmp, h))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	actual := hex.EncodeToString(h.Sum(nil))
+	if checksum != "" && !strings.EqualFold(checksum, actual) {
+		return "", fmt.Errorf("checksum mismatch: server reported %s, received %s", checksum, actual)
+	}
+
+	if name == "" {
+		name = fileName
+	}
+	if name == "" {
+		return "", fmt.Errorf("no output file name available")
+	}
+	// Never trust a server-supplied name to pick the directory.
+	path := filepath.Join(dir, filepath.Base(name))
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// dirAndBase splits a user-supplied output path for downloadVerified.
+func dirAndBase(path string) (string, string) {
+	return filepath.Dir(path), filepath.Base(path)
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Requirement texts are exchanged with localization vendors as one file per
+// target language, either XLIFF 1.2 or CSV. Each translation unit is keyed
+// "<requirementId>.<field>" so files survive reordering by vendor tools.
+//
+//	get_requirement_translations    language -> translations[] (requirementId, field, text)
+//	import_requirement_translations language, translations[]  -> updated count
+
+var translatableFields = []string{"shortreq", "description", "motivation", "example"}
+
+const translationImportBatch = 200
+
+type translationUnit struct {
+	RequirementID int64
+	Field         string
+	Source        string
+	Target        string
+}
+
+func (u translationUnit) key() string {
+	return fmt.Sprintf("%d.%s", u.RequirementID, u.Field)
+}
+
+func cmdTranslation(client *McpClient, osArgs []string) {
+	if len(osArgs) < 1 {
+		fmt.Fprintln(os.Stderr, "Error: translation subcommand required")
+		fmt.Fprintf(os.Stderr, "Usage: %s translation <export|import> ...\n", progName())
+		exit(ExitUsage)
+	}
+
+	switch osArgs[0] {
+	case "export":
+		cmdTranslationExport(client, osArgs[1:])
+	case "import":
+		cmdTranslationImport(client, osArgs[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown translation subcommand: %s\n", osArgs[0])
+		exit(ExitUsage)
+	}
+}
+
+func cmdTranslationExport(client *McpClient, osArgs []string) {
+	fs := flag.NewFlagSet("translation export", flag.ContinueOnError)
+	lang := fs.String("lang", "", "Target language code (e.g. de, fr)")
+	sourceLang := fs.String("source-lang", "en", "Source language code")
+	format := fs.String("format", "xliff", "File format: xliff or csv")
+	output := fs.String("output", "", "Output file (default: requirements.<lang>.<xlf|csv>)")
+	norm := fs.String("norm", "", "Only export requirements mapped to this norm")
+	usecase := fs.String("usecase", "", "Only export requirements for this use case")
+	sign := addSignFlag(fs)
+	dest := addDestinationFlags(fs)
+	parseFlags(fs, osArgs)
+
+	if *lang == "" {
+		fmt.Fprintln(os.Stderr, "Error: --lang is required")
+		exit(ExitUsage)
+	}
+
+	filter := map[string]interface{}{}
+	if *norm != "" {
+		filter["norm"] = *norm
+	}
+	if *usecase != "" {
+		filter["usecase"] = *usecase
+	}
+	requirements, err := listRequirements(client, filter)
+	if err != nil {
+		fatal(err)
+	}
+
+	existing, err := fetchTranslations(client, *lang)
+	if err != nil {
+		fatal(err)
+	}
+
+	var units []translationUnit
+	for _, r := range requirements {
+		id := int64(numberField(r, "id"))
+		for _, field := range translatableFields {
+			source := stringField(r, field)
+			if strings.TrimSpace(source) == "" {
+				continue
+			}
+			u := translationUnit{RequirementID: id, Field: field, Source: source}
+			u.Target = existing[u.key()]
+			units = append(units, u)
+		}
+	}
+
+	path := *output
+	if path == "" {
+		ext := "xlf"
+		if *format == "csv" {
+			ext = "csv"
+		}
+		path = fmt.Sprintf("requirements.%s.%s", *lang, ext)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		fatal(err)
+	}
+	switch *format {
+	case "xliff":
+		err = writeXLIFF(f, *sourceLang, *lang, units)
+	case "csv":
+		err = writeTranslationCSV(f, units)
+	default:
+		err = fmt.Errorf("unsupported format %q (use xliff or csv)", *format)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		fatal(err)
+	}
+
+	signOutput(client, path, *sign)
+	uploadOutput(client, path, *sign != "", dest)
+	status(path, "Exported %d translation unit(s) from %d requirement(s) to %s\n", len(units), len(requirements), path)
+}
+
+// fetchTranslations returns the existing translations keyed by unit key, or
+// an empty map when the server has no translation store.
+func fetchTranslations(client *McpClient, lang string) (map[string]string, error) {
+	existing := map[string]string{}
+	ok, err := client.HasTool("get_requirement_translations")
+	if err != nil || !ok {
+		return existing, err
+	}
+	content, err := client.callToolMap("get_requirement_translations", map[string]interface{}{"language": lang})
+	if err != nil {
+		return nil, err
+	}
+	items, _ := content["translations"].([]interface{})
+	for _, item := range items {
+		t, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		u := translationUnit{RequirementID: int64(numberField(t, "requirementId")), Field: stringField(t, "field")}
+		existing[u.key()] = stringField(t, "text")
+	}
+	return existing, nil
+}
+
+func cmdTranslationImport(client *McpClient, osArgs []string) {
+	if len(osArgs) < 1 {
+		fmt.Fprintln(os.Stderr, "Error: translation file required")
+		fmt.Fprintf(os.Stderr, "Usage: %s translation import <file.xlf|file.csv> [--lang de]\n", progName())
+		exit(ExitUsage)
+	}
+	path := osArgs[0]
+
+	fs := flag.NewFlagSet("translation import", flag.ContinueOnError)
+	lang := fs.String("lang", "", "Target language (default: from the XLIFF file)")
+	yes := addYesFlag(fs)
+	parseFlags(fs, osArgs[1:])
+
+	f, err := os.Open(path)
+	if err != nil {
+		fatal(err)
+	}
+	var units []translationUnit
+	fileLang := ""
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".xlf", ".xliff":
+		fileLang, units, err = readXLIFF(f)
+	case ".csv":
+		units, err = readTranslationCSV(f)
+	default:
+		err = fmt.Errorf("unsupported translation file %s (use .xlf, .xliff or .csv)", path)
+	}
+	f.Close()
+	if err != nil {
+		fatal(err)
+	}
+
+	target := *lang
+	if target == "" {
+		target = fileLang
+	}
+	if target == "" {
+		fmt.Fprintln(os.Stderr, "Error: --lang is required for CSV files")
+		exit(ExitUsage)
+	}
+	if fileLang != "" && *lang != "" && !strings.EqualFold(fileLang, *lang) {
+		fmt.Fprintf(os.Stderr, "Error: file is for language %q but --lang is %q\n", fileLang, *lang)
+		exit(ExitUsage)
+	}
+
+	var translations []map[string]interface{}
+	skipped := 0
+	for _, u := range units {
+		if strings.TrimSpace(u.Target) == "" {
+			skipped++
+			continue
+		}
+		translations = append(translations, map[string]interface{}{
+			"requirementId": u.RequirementID,
+			"field":         u.Field,
+			"text":          u.Target,
+		})
+	}
+
+	if err := client.requireTool("import_requirement_translations"); err != nil {
+		fatal(err)
+	}
+	if err := confirm(client, *yes, "overwrite requirement translations", []string{
+		fmt.Sprintf("%d %s translation(s) from %s", len(translations), target, path),
+	}); err != nil {
+		fatal(err)
+	}
+
+	updated := 0
+	progress := startProgress("Importing translations", "units", int64(len(translations)))
+	defer progress.Finish()
+	for start := 0; start < len(translations); start += translationImportBatch {
+		end := start + translationImportBatch
+		if end > len(translations) {
+			end = len(translations)
+		}
+		content, err := client.callToolMap("import_requirement_translations", map[string]interface{}{
+			"language":     target,
+			"translations": translations[start:end],
+		})
+		if err != nil {
+			progress.Warnf("Error: batch starting at unit %d: %v\n", start, err)
+			if start > 0 {
+				exit(ExitPartial)
+			}
+			exit(exitCode(err))
+		}
+		updated += int(numberField(content, "updated"))
+		progress.Add(int64(end - start))
+	}
+	progress.Finish()
+
+	status(len(translations), "Imported %d %s translation(s) (%d updated, %d untranslated unit(s) skipped)\n", len(translations), target, updated, skipped)
+}
+
+// --- XLIFF 1.2 ---
+
+type xliffDoc struct {
+	XMLName xml.Name  `xml:"urn:oasis:names:tc:xliff:document:1.2 xliff"`
+	Version string    `xml:"version,attr"`
+	File    xliffFile `xml:"file"`
+}
+
+type xliffFile struct {
+	Original       string      `xml:"original,attr"`
+	SourceLanguage string      `xml:"source-language,attr"`
+	TargetLanguage string      `xml:"target-language,attr"`
+	Datatype       string      `xml:"datatype,attr"`
+	Units          []xliffUnit `xml:"body>trans-unit"`
+}
+
+type xliffUnit struct {
+	ID     string `xml:"id,attr"`
+	Source string `xml:"source"`
+	Target string `xml:"target"`
+	Note   string `xml:"note,omitempty"`
+}
+
+func writeXLIFF(w io.Writer, sourceLang, targetLang string, units []translationUnit) error {
+	doc := xliffDoc{
+		Version: "1.2",
+		File: xliffFile{
+			Original:       "secman-requirements",
+			SourceLanguage: sourceLang,
+			TargetLanguage: targetLang,
+			Datatype:       "plaintext",
+		},
+	}
+	for _, u := range units {
+		doc.File.Units = append(doc.File.Units, xliffUnit{
+			ID:     u.key(),
+			Source: u.Source,
+			Target: u.Target,
+			Note:   "Requirement " + strconv.FormatInt(u.RequirementID, 10) + ", field " + u.Field,
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func readXLIFF(r io.Reader) (string, []translationUnit, error) {
+	var doc xliffDoc
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return "", nil, fmt.Errorf("parse xliff: %w", err)
+	}
+	units := make([]translationUnit, 0, len(doc.File.Units))
+	for _, xu := range doc.File.Units {
+		u, err := parseUnitKey(xu.ID)
+		if err != nil {
+			return "", nil, err
+		}
+		u.Source, u.Target = xu.Source, xu.Target
+		units = append(units, u)
+	}
+	return doc.File.TargetLanguage, units, nil
+}
+
+// --- CSV ---
+
+func writeTranslationCSV(w io.Writer, units []translationUnit) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "requirementId", "field", "source", "target"})
+	for _, u := range units {
+		cw.Write([]string{u.key(), strconv.FormatInt(u.RequirementID, 10), u.Field, u.Source, u.Target})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func readTranslationCSV(r io.Reader) ([]translationUnit, error) {
+	cr := csv.NewReader(skipBOM(r))
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("parse csv: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	cols := map[string]int{}
+	for i, h := range records[0] {
+		cols[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	idCol, ok1 := cols["id"]
+	targetCol, ok2 := cols["target"]
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf("csv header must contain id and target columns")
+	}
+
+	units := make([]translationUnit, 0, len(records)-1)
+	for i, rec := range records[1:] {
+		if idCol >= len(rec) || targetCol >= len(rec) {
+			return nil, fmt.Errorf("csv line %d: missing columns", i+2)
+		}
+		u, err := parseUnitKey(rec[idCol])
+		if err != nil {
+			return nil, fmt.Errorf("csv line %d: %w", i+2, err)
+		}
+		u.Target = rec[targetCol]
+		if c, ok := cols["source"]; ok && c < len(rec) {
+			u.Source = rec[c]
+		}
+		units = append(units, u)
+	}
+	return units, nil
+}
+
+func parseUnitKey(key string) (translationUnit, error) {
+	idStr, field, ok := strings.Cut(key, ".")
+	if !ok {
+		return translationUnit{}, fmt.Errorf("invalid translation unit id %q", key)
+	}
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return translationUnit{}, fmt.Errorf("invalid translation unit id %q", key)
+	}
+	for _, f := range translatableFields {
+		if f == field {
+			return translationUnit{RequirementID: id, Field: field}, nil
+		}
+	}
+	return translationUnit{}, fmt.Errorf("unknown field %q in translation unit %q", field, key)
+}
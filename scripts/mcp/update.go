@@ -0,0 +1,282 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// asset update and requirement update change fields of existing records.
+// They read the records first and print the change field by field, before
+// in red and after in green, then ask before sending anything unless --yes
+// is given. Records that already have the values are left alone, so a bulk
+// update script can be rerun and its review shows only what is left to do.
+
+// printFieldDiff prints the changes of one record.
+func printFieldDiff(label string, changes []fieldChange) {
+	status(nil, "~ %s\n", label)
+	for _, c := range changes {
+		status(nil, "    %s: %s -> %s\n", c.Field, paint(styleFail, strconv.Quote(c.Before)), paint(styleOK, strconv.Quote(c.After)))
+	}
+}
+
+// assetUpdateFields are the update_asset fields asset update sets, by flag.
+var assetUpdateFields = []struct{ flag, field, usage string }{
+	{"name", "name", "New name"},
+	{"type", "type", "New type (e.g. SERVER, WORKSTATION)"},
+	{"owner", "owner", "New owner"},
+	{"ip", "ip", "New IP address"},
+	{"uri", "uri", "New URI"},
+	{"description", "description", "New description"},
+	{"criticality", "criticality", "New criticality (CRITICAL, HIGH, MEDIUM, LOW, NA)"},
+	{"ad-domain", "adDomain", "New Active Directory domain"},
+}
+
+func cmdAssetUpdate(client *McpClient, osArgs []string) {
+	fs := flag.NewFlagSet("asset update", flag.ContinueOnError)
+	values := map[string]*string{}
+	for _, f := range assetUpdateFields {
+		values[f.field] = fs.String(f.flag, "", f.usage)
+	}
+	var tagArgs stringList
+	fs.Var(&tagArgs, "tag", "Set a tag as key=value; key= removes it (repeatable)")
+	// The field flags take the names the other asset commands select by, so
+	// assets are picked by id or from stdin, e.g. the output of assets.
+	sel := &assetSelection{
+		name: new(string), assetType: new(string), ip: new(string), owner: new(string),
+		stdin: fs.Bool("stdin", false, "Read asset ids or asset JSON from stdin"),
+	}
+	yes := addYesFlag(fs)
+	ids := parseInterspersed(fs, osArgs)
+
+	desired := map[string]interface{}{}
+	for _, f := range assetUpdateFields {
+		if v := *values[f.field]; v != "" {
+			desired[f.field] = v
+		}
+	}
+	if c := *values["criticality"]; c != "" && !containsFold(criticalityLevels, c) {
+		fmt.Fprintf(os.Stderr, "Error: --criticality must be one of %s\n", strings.Join(criticalityLevels, ", "))
+		exit(ExitUsage)
+	}
+	tags := map[string]interface{}{}
+	for _, t := range tagArgs {
+		key, value, ok := strings.Cut(t, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			fmt.Fprintf(os.Stderr, "Error: --tag takes key=value, not %q\n", t)
+			exit(ExitUsage)
+		}
+		tags[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	if len(tags) > 0 {
+		desired["tags"] = tags
+	}
+	if len(desired) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: nothing to update (use --name, --type, --owner, --ip, --uri, --description, --criticality, --ad-domain or --tag)")
+		exit(ExitUsage)
+	}
+
+	targets := sel.resolve(client, ids, progName()+" asset update <id>... | --stdin --name/--owner/--criticality/--tag k=v ... [--yes]")
+	if len(targets) == 0 {
+		status(0, "No matching assets\n")
+		return
+	}
+	if err := client.requireTool("update_asset"); err != nil {
+		fatal(err)
+	}
+	if len(tags) > 0 {
+		if ok, _ := client.toolAccepts("update_asset", "tags"); !ok {
+			fatal(fmt.Errorf("update_asset on %s does not take tags; the server needs updating to set tags", client.BaseURL))
+		}
+	}
+
+	// Targets given by id or on stdin carry no fields to diff against.
+	current, err := assetsByID(client)
+	if err != nil {
+		fatal(err)
+	}
+	type assetUpdate struct {
+		id   int64
+		args map[string]interface{}
+	}
+	var updates []assetUpdate
+	changed := 0
+	for _, a := range targets {
+		id := int64(numberField(a, "id"))
+		asset := current[id]
+		if asset == nil {
+			fmt.Fprintf(os.Stderr, "  asset %d: not found\n", id)
+			continue
+		}
+		changes := recordChanges("assets", desired, asset)
+		if len(changes) == 0 {
+			continue
+		}
+		printFieldDiff(fmt.Sprintf("asset %d %q", id, stringField(asset, "name")), changes)
+		args := map[string]interface{}{"assetId": id}
+		changedTags := map[string]interface{}{}
+		for _, c := range changes {
+			if key, ok := strings.CutPrefix(c.Field, "tag "); ok {
+				changedTags[key] = c.After
+				continue
+			}
+			args[c.Field] = c.After
+		}
+		if len(changedTags) > 0 {
+			args["tags"] = changedTags
+		}
+		updates = append(updates, assetUpdate{id, args})
+		changed += len(changes)
+	}
+	if len(updates) == 0 {
+		status(0, "No changes: %d asset(s) already up to date\n", len(targets))
+		return
+	}
+	if err := confirm(client, *yes, "update assets", []string{
+		fmt.Sprintf("%d field change(s) on %d asset(s); %d unchanged", changed, len(updates), len(targets)-len(updates)),
+	}); err != nil {
+		fatal(err)
+	}
+
+	updated, failed := 0, 0
+	progress := startProgress("Updating assets", "assets", int64(len(updates)))
+	defer progress.Finish()
+	for _, u := range updates {
+		_, err := client.callToolMap("update_asset", u.args)
+		progress.Add(1)
+		if err != nil {
+			progress.Warnf("  asset %d: %v\n", u.id, err)
+			failed++
+			continue
+		}
+		updated++
+	}
+	progress.Finish()
+
+	status(updated, "Updated %d asset(s)\n", updated)
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d update(s) failed\n", failed)
+		exit(ExitPartial)
+	}
+}
+
+// requirementUpdateFields are the requirement fields requirement update
+// sets; the flag is the field name.
+var requirementUpdateFields = []struct{ field, usage string }{
+	{"shortreq", "New short requirement text"},
+	{"details", "New details"},
+	{"motivation", "New motivation"},
+	{"example", "New example"},
+	{"norm", "New norm"},
+	{"usecase", "New use case"},
+	{"chapter", "New chapter"},
+}
+
+func cmdRequirementUpdate(client *McpClient, osArgs []string) {
+	fs := flag.NewFlagSet("requirement update", flag.ContinueOnError)
+	values := map[string]*string{}
+	for _, f := range requirementUpdateFields {
+		values[f.field] = fs.String(f.field, "", f.usage)
+	}
+	fromStdin := fs.Bool("stdin", false, "Read requirement ids or requirement JSON from stdin")
+	yes := addYesFlag(fs)
+	args := parseInterspersed(fs, osArgs)
+
+	desired := map[string]interface{}{}
+	for _, f := range requirementUpdateFields {
+		if v := *values[f.field]; v != "" {
+			desired[f.field] = v
+		}
+	}
+	if len(desired) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: nothing to update (use --shortreq, --details, --motivation, --example, --norm, --usecase or --chapter)")
+		exit(ExitUsage)
+	}
+
+	var ids []int64
+	switch {
+	case len(args) > 0 && *fromStdin:
+		fmt.Fprintln(os.Stderr, "Error: pass requirement ids or --stdin, not both")
+		exit(ExitUsage)
+	case *fromStdin:
+		items, err := readStdinItems(os.Stdin)
+		if err != nil {
+			fatal(err)
+		}
+		if ids, err = recordIDs(items, "requirementId", "id"); err != nil {
+			fatal(err)
+		}
+	default:
+		for _, arg := range args {
+			id, err := strconv.ParseInt(arg, 10, 64)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: invalid requirement id %q\n", arg)
+				exit(ExitUsage)
+			}
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: requirement ids or --stdin required")
+		fmt.Fprintf(os.Stderr, "Usage: %s requirement update <id>... | --stdin --shortreq/--details/... [--yes]\n", progName())
+		exit(ExitUsage)
+	}
+	if err := client.requireTool("update_requirement"); err != nil {
+		fatal(err)
+	}
+
+	reqs, err := listRequirements(client, map[string]interface{}{"detailed": true})
+	if err != nil {
+		fatal(err)
+	}
+	current := map[int64]map[string]interface{}{}
+	for _, r := range reqs {
+		current[int64(numberField(r, "id"))] = r
+	}
+	var updates []map[string]interface{}
+	changed := 0
+	for _, id := range ids {
+		req := current[id]
+		if req == nil {
+			fmt.Fprintf(os.Stderr, "  requirement %d: not found\n", id)
+			continue
+		}
+		changes := recordChanges("requirements", desired, req)
+		if len(changes) == 0 {
+			continue
+		}
+		printFieldDiff(fmt.Sprintf("requirement %d %q", id, truncate(stringField(req, "shortreq"), 60)), changes)
+		call := map[string]interface{}{"requirementId": id}
+		for _, c := range changes {
+			call[c.Field] = c.After
+		}
+		updates = append(updates, call)
+		changed += len(changes)
+	}
+	if len(updates) == 0 {
+		status(0, "No changes: %d requirement(s) already up to date\n", len(ids))
+		return
+	}
+	if err := confirm(client, *yes, "update requirements", []string{
+		fmt.Sprintf("%d field change(s) on %d requirement(s); %d unchanged", changed, len(updates), len(ids)-len(updates)),
+	}); err != nil {
+		fatal(err)
+	}
+
+	updated, failed := 0, 0
+	for _, call := range updates {
+		if _, err := client.callToolMap("update_requirement", call); err != nil {
+			fmt.Fprintf(os.Stderr, "  requirement %v: %v\n", call["requirementId"], err)
+			failed++
+			continue
+		}
+		updated++
+	}
+	status(updated, "Updated %d requirement(s)\n", updated)
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d update(s) failed\n", failed)
+		exit(ExitPartial)
+	}
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/schmalle/secman/scripts/mcp/secman"
+)
+
+var cvePattern = regexp.MustCompile(`(?i)^CVE-\d{4}-\d{4,}$`)
+
+const nvdCVEURL = "https://services.nvd.nist.gov/rest/json/cves/2.0"
+
+// Remediation is the aggregated remediation summary for a single CVE.
+type Remediation struct {
+	CVE              string              `json:"cve"`
+	Description      string              `json:"description,omitempty"`
+	Severity         string              `json:"severity,omitempty"`
+	FixedVersions    []string            `json:"fixedVersions,omitempty"`
+	AffectedVersions []string            `json:"affectedVersions,omitempty"`
+	AffectedAssets   []RemediationAsset  `json:"affectedAssets"`
+	Advisories       []RemediationSource `json:"advisories,omitempty"`
+	Patches          []RemediationSource `json:"patches,omitempty"`
+	References       []RemediationSource `json:"references,omitempty"`
+	Summary          string              `json:"summary"`
+}
+
+type RemediationAsset struct {
+	VulnerabilityID int64  `json:"vulnerabilityId"`
+	AssetID         int64  `json:"assetId"`
+	AssetName       string `json:"assetName"`
+	ProductVersions string `json:"productVersions,omitempty"`
+	DaysOpen        string `json:"daysOpen,omitempty"`
+	Overdue         bool   `json:"overdue"`
+}
+
+type RemediationSource struct {
+	URL    string   `json:"url"`
+	Source string   `json:"source,omitempty"`
+	Tags   []string `json:"tags,omitempty"`
+}
+
+func cmdVuln(client *McpClient, osArgs []string) {
+	if len(osArgs) < 1 {
+		fmt.Fprintln(os.Stderr, "Error: vuln subcommand required")
+		fmt.Fprintf(os.Stderr, "Usage: %s vuln remediation <id|CVE> [--write-back] [--no-nvd] [--json]\n", progName())
+		exit(ExitUsage)
+	}
+
+	switch osArgs[0] {
+	case "remediation":
+		cmdVulnRemediation(client, osArgs[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown vuln subcommand: %s\n", osArgs[0])
+		exit(ExitUsage)
+	}
+}
+
+func cmdVulnRemediation(client *McpClient, osArgs []string) {
+	if len(osArgs) < 1 {
+		fmt.Fprintln(os.Stderr, "Error: vulnerability id or CVE required")
+		fmt.Fprintf(os.Stderr, "Usage: %s vuln remediation <id|CVE> [--write-back] [--no-nvd] [--json]\n", progName())
+		exit(ExitUsage)
+	}
+
+	target := osArgs[0]
+
+	fs := flag.NewFlagSet("vuln remediation", flag.ContinueOnError)
+	writeBack := fs.Bool("write-back", false, "Store the remediation summary on the finding(s) via update_vulnerability")
+	noNVD := fs.Bool("no-nvd", false, "Skip the NVD lookup (offline mode)")
+	asJSON := fs.Bool("json", false, "Print the full remediation record as JSON")
+	parseFlags(fs, osArgs[1:])
+
+	findings, err := findingsForTarget(client, target)
+	if err != nil {
+		fatal(err)
+	}
+	if len(findings) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: no findings found for %s\n", target)
+		exit(ExitNotFound)
+	}
+
+	cve := strings.ToUpper(target)
+	if !cvePattern.MatchString(cve) {
+		cve, _ = findings[0]["vulnerabilityId"].(string)
+	}
+
+	rem := buildRemediation(cve, findings)
+	if !*noNVD && cvePattern.MatchString(cve) {
+		if err := enrichFromNVD(rem); err != nil {
+			warnf("Warning: NVD lookup failed: %v\n", err)
+		}
+	}
+	rem.Summary = remediationSummary(rem)
+
+	if *writeBack {
+		if err := writeBackRemediation(client, rem); err != nil {
+			fatal(err)
+		}
+	}
+
+	if rawOutput(*asJSON) {
+		printResult(rem)
+		return
+	}
+	printRemediation(rem)
+}
+
+// findingsForTarget resolves a CVE or numeric vulnerability id to the
+// matching findings. get_vulnerabilities has no id filter, so numeric ids
+// are located by paging through the accessible findings.
+func findingsForTarget(client *McpClient, target string) ([]map[string]interface{}, error) {
+	if cvePattern.MatchString(target) {
+		var findings []map[string]interface{}
+		vulns := secman.Vulnerabilities(context.Background(), client, map[string]interface{}{"cveId": strings.ToUpper(target)})
+		for vulns.Next() {
+			// cveId is a partial match, so CVE-2024-1234 would also return CVE-2024-12345.
+			if v := vulns.Item(); strings.EqualFold(stringField(v, "vulnerabilityId"), target) {
+				findings = append(findings, v)
+			}
+		}
+		return findings, vulns.Err()
+	}
+
+	id, err := strconv.ParseInt(target, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%q is neither a CVE nor a numeric vulnerability id", target)
+	}
+
+	vulns := secman.Vulnerabilities(context.Background(), client, nil)
+	for vulns.Next() {
+		if v := vulns.Item(); int64(numberField(v, "id")) == id {
+			return []map[string]interface{}{v}, nil
+		}
+	}
+	return nil, vulns.Err()
+}
+
+func buildRemediation(cve string, findings []map[string]interface{}) *Remediation {
+	rem := &Remediation{CVE: cve}
+	versions := map[string]bool{}
+
+	for _, f := range findings {
+		asset := RemediationAsset{
+			VulnerabilityID: int64(numberField(f, "id")),
+			AssetID:         int64(numberField(f, "assetId")),
+			AssetName:       stringField(f, "assetName"),
+			ProductVersions: stringField(f, "vulnerableProductVersions"),
+			DaysOpen:        stringField(f, "daysOpen"),
+			Overdue:         isOverdue(f),
+		}
+		rem.AffectedAssets = append(rem.AffectedAssets, asset)
+
+		if rem.Severity == "" {
+			rem.Severity = stringField(f, "cvssSeverity")
+		}
+		if asset.ProductVersions != "" {
+			versions[asset.ProductVersions] = true
+		}
+	}
+
+	for v := range versions {
+		rem.AffectedVersions = append(rem.AffectedVersions, v)
+	}
+	sort.Strings(rem.AffectedVersions)
+	return rem
+}
+
+// enrichFromNVD adds the description, fixed versions (versionEndExcluding of
+// vulnerable CPE matches) and tagged references from the NVD CVE API.
+func enrichFromNVD(rem *Remediation) error {
+	httpClient := &http.Client{Timeout: 30 * time.Second}
+	resp, err := httpClient.Get(nvdCVEURL + "?cveId=" + url.QueryEscape(rem.CVE))
+	if err != nil {
+		return fmt.Errorf("http request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
+	}
+
+	var nvd struct {
+		Vulnerabilities []struct {
+			CVE struct {
+				Descriptions []struct {
+					Lang  string `json:"lang"`
+					Value string `json:"value"`
+				} `json:"descriptions"`
+				References     []RemediationSource `json:"references"`
+				Configurations []struct {
+					Nodes []struct {
+						CPEMatch []struct {
+							Vulnerable          bool   `json:"vulnerable"`
+							Criteria            string `json:"criteria"`
+							VersionEndExcluding string `json:"versionEndExcluding"`
+						} `json:"cpeMatch"`
+					} `json:"nodes"`
+				} `json:"configurations"`
+			} `json:"cve"`
+		} `json:"vulnerabilities"`
+	}
+	if err := json.Unmarshal(body, &nvd); err != nil {
+		return fmt.Errorf("unmarshal NVD response: %w", err)
+	}
+	if len(nvd.Vulnerabilities) == 0 {
+		return nil
+	}
+
+	entry := nvd.Vulnerabilities[0].CVE
+	for _, d := range entry.Descriptions {
+		if d.Lang == "en" {
+			rem.Description = d.Value
+			break
+		}
+	}
+
+	fixed := map[string]bool{}
+	for _, cfg := range entry.Configurations {
+		for _, node := range cfg.Nodes {
+			for _, m := range node.CPEMatch {
+				if m.Vulnerable && m.VersionEndExcluding != "" {
+					fixed[cpeProduct(m.Criteria)+" "+m.VersionEndExcluding] = true
+				}
+			}
+		}
+	}
+	for v := range fixed {
+		rem.FixedVersions = append(rem.FixedVersions, v)
+	}
+	sort.Strings(rem.FixedVersions)
+
+	for _, ref := range entry.References {
+		switch {
+		case hasTag(ref.Tags, "Patch"):
+			rem.Patches = append(rem.Patches, ref)
+		case hasTag(ref.Tags, "Vendor Advisory"), hasTag(ref.Tags, "Mitigation"):
+			rem.Advisories = append(rem.Advisories, ref)
+		default:
+			rem.References = append(rem.References, ref)
+		}
+	}
+	return nil
+}
+
+// cpeProduct extracts "vendor:product" from a CPE 2.3 string.
+func cpeProduct(cpe string) string {
+	parts := strings.Split(cpe, ":")
+	if len(parts) < 5 {
+		return cpe
+	}
+	return parts[3] + ":" + parts[4]
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func remediationSummary(rem *Remediation) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s affects %d asset(s).", rem.CVE, len(rem.AffectedAssets))
+	if len(rem.FixedVersions) > 0 {
+		fmt.Fprintf(&b, " Upgrade to a fixed release: %s.", strings.Join(rem.FixedVersions, ", "))
+	} else if len(rem.Patches) > 0 {
+		fmt.Fprintf(&b, " Apply the vendor patch: %s.", rem.Patches[0].URL)
+	} else {
+		b.WriteString(" No fixed version is published; apply vendor mitigations or request an exception.")
+	}
+	if len(rem.Advisories) > 0 {
+		fmt.Fprintf(&b, " Advisory: %s.", rem.Advisories[0].URL)
+	}
+	return b.String()
+}
+
+// writeBackRemediation stores the summary on every affected finding. The
+// server must advertise update_vulnerability for this to work.
+func writeBackRemediation(client *McpClient, rem *Remediation) error {
+	if err := client.requireTool("update_vulnerability"); err != nil {
+		return fmt.Errorf("cannot write remediation back: %w", err)
+	}
+
+	for _, a := range rem.AffectedAssets {
+		_, err := client.callToolMap("update_vulnerability", map[string]interface{}{
+			"vulnerabilityId": a.VulnerabilityID,
+			"remediation":     rem.Summary,
+		})
+		if err != nil {
+			return fmt.Errorf("update vulnerability %d: %w", a.VulnerabilityID, err)
+		}
+	}
+	return nil
+}
+
+func printRemediation(rem *Remediation) {
+	fmt.Printf("%s", rem.CVE)
+	if rem.Severity != "" {
+		fmt.Printf(" (%s)", paint(severityStyle(rem.Severity), rem.Severity))
+	}
+	fmt.Println()
+	if rem.Description != "" {
+		fmt.Printf("\n%s\n", rem.Description)
+	}
+
+	fmt.Printf("\nRemediation:\n  %s\n", rem.Summary)
+
+	if len(rem.FixedVersions) > 0 {
+		fmt.Println("\nFixed versions:")
+		for _, v := range rem.FixedVersions {
+			fmt.Printf("  %s\n", v)
+		}
+	}
+	printSources("Patches", rem.Patches)
+	printSources("Vendor advisories", rem.Advisories)
+
+	fmt.Printf("\nAffected assets (%d):\n", len(rem.AffectedAssets))
+	for _, a := range rem.AffectedAssets {
+		age := a.DaysOpen
+		if days, ok := parseDays(a.DaysOpen); ok {
+			age = fmt.Sprintf("%d days open", days)
+		}
+		if a.Overdue {
+			age = paint(styleFail, age+" (overdue)")
+		}
+		fmt.Printf("  %-35s %-30s %s\n", a.AssetName, a.ProductVersions, age)
+	}
+}
+
+func printSources(title string, sources []RemediationSource) {
+	if len(sources) == 0 {
+		return
+	}
+	fmt.Printf("\n%s:\n", title)
+	for _, s := range sources {
+		fmt.Printf("  %s\n", s.URL)
+	}
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/schmalle/secman/scripts/mcp/config"
+)
+
+// `watch` polls the server for new findings of a severity (CRITICAL by
+// default) on the assets carrying a tag (environment=production by
+// default) and raises an alert through PagerDuty or Opsgenie for each CVE
+// that newly appears. One alert covers all watched assets with that CVE;
+// its dedup key is secman:<CVE>, so later findings of the same CVE do not
+// page again while the alert is open. When a CVE is no longer open on any
+// watched asset the alert is resolved, with --resolve, and forgotten, so a
+// recurrence pages again.
+//
+// The first poll records the open findings without alerting, unless
+// --alert-existing is given. The state is kept in a JSON file, so a
+// restarted watcher does not page for what it has already seen.
+
+type watchState struct {
+	Initialized bool                `json:"initialized"`
+	Seen        map[int64]time.Time `json:"seen"`     // finding id -> first seen
+	Alerted     map[string]string   `json:"alerted"`  // dedup key -> CVE
+	Baseline    map[string]bool     `json:"baseline"` // CVEs open at the first poll, not alerted
+}
+
+func watchStatePath() string {
+	if path := setting("SECMAN_WATCH_STATE"); path != "" {
+		return path
+	}
+	dir, err := config.Dir()
+	if err != nil {
+		return "secman-watch-state.json"
+	}
+	return filepath.Join(dir, "watch-state.json")
+}
+
+func loadWatchState(path string) (*watchState, error) {
+	s := &watchState{Seen: map[int64]time.Time{}, Alerted: map[string]string{}, Baseline: map[string]bool{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if s.Seen == nil {
+		s.Seen = map[int64]time.Time{}
+	}
+	if s.Alerted == nil {
+		s.Alerted = map[string]string{}
+	}
+	if s.Baseline == nil {
+		s.Baseline = map[string]bool{}
+	}
+	return s, nil
+}
+
+// save writes the state through a temporary file, so a watcher killed
+// mid-write does not lose what it has seen.
+func (s *watchState) save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeStateFile(path, append(data, '\n'), 0o644)
+}
+
+type watchOptions struct {
+	tag           string
+	severity      string
+	alertExisting bool
+	resolve       bool
+}
+
+// assetHasTag matches "key=value" against the asset's tags, and a bare
+// value against tag values and group names. Case is ignored.
+func assetHasTag(asset map[string]interface{}, tag string) bool {
+	key, value, hasKey := strings.Cut(tag, "=")
+	for _, t := range stringsField(asset, "tags") {
+		k, v, _ := strings.Cut(t, "=")
+		if hasKey && strings.EqualFold(k, key) && strings.EqualFold(v, value) {
+			return true
+		}
+		if !hasKey && strings.EqualFold(v, tag) {
+			return true
+		}
+	}
+	if !hasKey {
+		for _, g := range stringsField(asset, "groups") {
+			if strings.EqualFold(g, tag) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func stringsField(m map[string]interface{}, key string) []string {
+	items, _ := m[key].([]interface{})
+	out := make([]string, 0, len(items))
+	for _, item := range items {
+		out = append(out, fmt.Sprint(item))
+	}
+	return out
+}
+
+// watchResult summarizes one poll.
+type watchResult struct {
+	Assets   int
+	Open     int
+	New      int
+	Alerts   int
+	Resolved int
+	Failed   int
+}
+
+// poll fetches the watched assets' findings, alerts on new CVEs and
+// resolves alerts whose CVE is gone.
+func (o *watchOptions) poll(client *McpClient, sinks []alertSink, state *watchState) (watchResult, error) {
+	var r watchResult
+	assets, err := listAll(client, "get_assets", "assets", map[string]interface{}{}, 500)
+	if err != nil {
+		return r, err
+	}
+	var open []map[string]interface{}
+	for _, a := range assets {
+		if !assetHasTag(a, o.tag) {
+			continue
+		}
+		r.Assets++
+		findings, err := listAll(client, "get_vulnerabilities", "vulnerabilities", map[string]interface{}{"assetId": int64(numberField(a, "id"))}, 500)
+		if err != nil {
+			return r, err
+		}
+		for _, f := range findings {
+			if strings.EqualFold(stringField(f, "cvssSeverity"), o.severity) {
+				open = append(open, f)
+			}
+		}
+	}
+	r.Open = len(open)
+
+	now := time.Now().UTC()
+	openIDs := map[int64]bool{}
+	openCVEs := map[string]bool{}
+	byCVE := map[string][]map[string]interface{}{}
+	var cves []string
+	for _, f := range open {
+		id := int64(numberField(f, "id"))
+		cve := strings.ToUpper(stringField(f, "vulnerabilityId"))
+		openIDs[id] = true
+		if !openCVEs[cve] {
+			openCVEs[cve] = true
+			cves = append(cves, cve)
+		}
+		byCVE[cve] = append(byCVE[cve], f)
+		if _, seen := state.Seen[id]; !seen {
+			state.Seen[id] = now
+			r.New++
+		}
+	}
+	// Resolved findings and CVEs leave the state, so it does not grow
+	// without bound.
+	for id := range state.Seen {
+		if !openIDs[id] {
+			delete(state.Seen, id)
+		}
+	}
+	for cve := range state.Baseline {
+		if !openCVEs[cve] {
+			delete(state.Baseline, cve)
+		}
+	}
+
+	// Every open CVE that has neither been alerted nor been part of the
+	// baseline is alerted; one that failed is tried again on the next poll.
+	sort.Strings(cves)
+	for _, cve := range cves {
+		key := "secman:" + cve
+		if _, done := state.Alerted[key]; done || state.Baseline[cve] {
+			continue
+		}
+		if !state.Initialized && !o.alertExisting {
+			state.Baseline[cve] = true
+			continue
+		}
+		if sendAlert(sinks, watchAlert(key, cve, o.severity, byCVE[cve], o.tag)) {
+			state.Alerted[key] = cve
+			r.Alerts++
+		} else {
+			r.Failed++
+		}
+	}
+	state.Initialized = true
+
+	for key, cve := range state.Alerted {
+		if openCVEs[cve] {
+			continue
+		}
+		if o.resolve && !resolveAlert(sinks, key) {
+			r.Failed++
+			continue
+		}
+		delete(state.Alerted, key)
+		r.Resolved++
+	}
+	return r, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func watchAlert(key, cve, severity string, findings []map[string]interface{}, tag string) alert {
+	var assets []string
+	for _, f := range findings {
+		if name := stringField(f, "assetName"); name != "" && !containsString(assets, name) {
+			assets = append(assets, name)
+		}
+	}
+	sort.Strings(assets)
+	summary := fmt.Sprintf("%s %s on %s", strings.ToUpper(severity), cve, strings.Join(assets, ", "))
+	if len(assets) > 3 {
+		summary = fmt.Sprintf("%s %s on %s and %d more %s asset(s)", strings.ToUpper(severity), cve, strings.Join(assets[:3], ", "), len(assets)-3, tag)
+	}
+	return alert{
+		DedupKey: key,
+		Summary:  summary,
+		Severity: strings.ToUpper(severity),
+		CVE:      cve,
+		Assets:   assets,
+		Details:  map[string]interface{}{"findings": len(findings), "tag": tag},
+	}
+}
+
+// sendAlert triggers the alert on every sink and reports whether all of
+// them accepted it. A failed alert is retried on the next poll; sinks that
+// already accepted it fold the retry into the same incident.
+func sendAlert(sinks []alertSink, a alert) bool {
+	ok := true
+	for _, s := range sinks {
+		if err := s.Trigger(a); err != nil {
+			warnf("Warning: %s alert for %s failed: %v\n", s.Name(), a.CVE, err)
+			ok = false
+			continue
+		}
+		if _, dry := s.(*dryRunSink); !dry {
+			status(nil, "Alerted %s: %s\n", s.Name(), a.Summary)
+		}
+	}
+	return ok
+}
+
+func resolveAlert(sinks []alertSink, key string) bool {
+	ok := true
+	for _, s := range sinks {
+		if err := s.Resolve(key); err != nil {
+			warnf("Warning: %s resolve of %s failed: %v\n", s.Name(), key, err)
+			ok = false
+			continue
+		}
+		if _, dry := s.(*dryRunSink); !dry {
+			status(nil, "Resolved %s: %s\n", s.Name(), key)
+		}
+	}
+	return ok
+}
+
+func cmdWatch(client *McpClient, osArgs []string) {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	interval := fs.Duration("interval", 5*time.Minute, "Time between polls")
+	once := fs.Bool("once", false, "Poll once and exit (for cron)")
+	tag := fs.String("tag", settingOr("SECMAN_WATCH_TAG", "environment=production"), "Watch assets with this tag (key=value, or a value or group name)")
+	severity := fs.String("severity", "CRITICAL", "Severity that raises alerts")
+	sinkList := fs.String("alert", "", "Alert sinks: pagerduty, opsgenie (default: every configured one)")
+	alertExisting := fs.Bool("alert-existing", false, "Also alert on findings open at the first poll")
+	resolve := fs.Bool("resolve", false, "Resolve the alert when its CVE is no longer open on watched assets")
+	statePath := fs.String("state", watchStatePath(), "State file of seen findings and raised alerts")
+	shutdownTimeout := addShutdownFlag(fs)
+	parseFlags(fs, osArgs)
+
+	if *interval < 10*time.Second {
+		fmt.Fprintln(os.Stderr, "Error: --interval must be at least 10s")
+		exit(ExitUsage)
+	}
+	sinks, err := newAlertSinks(client, splitList(*sinkList))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(ExitUsage)
+	}
+	if !client.dryRun {
+		defer holdState(*statePath, "--state")()
+	}
+	state, err := loadWatchState(*statePath)
+	if err != nil {
+		fatal(err)
+	}
+	opts := &watchOptions{tag: *tag, severity: *severity, alertExisting: *alertExisting, resolve: *resolve}
+
+	var names []string
+	for _, s := range sinks {
+		names = append(names, s.Name())
+	}
+	status(nil, "Watching %s findings on assets tagged %s (alerts: %s)\n", strings.ToUpper(*severity), *tag, strings.Join(names, ", "))
+
+	// A stop signal lets the poll under way finish and save the state.
+	var failed int
+	g := newRunGroup(*shutdownTimeout)
+	g.Go(func(context.Context) error {
+		for {
+			r, err := opts.poll(client, sinks, state)
+			// A dry run leaves the state alone, so the next real poll still alerts.
+			if err == nil && !client.dryRun {
+				err = state.save(*statePath)
+			}
+			switch {
+			case err != nil && *once:
+				return err
+			case err != nil:
+				warnf("%s poll failed: %v\n", time.Now().Format("2006-01-02 15:04:05"), err)
+			default:
+				status(nil, "%s %d open on %d asset(s), %d new, %d alert(s), %d resolved\n",
+					time.Now().Format("2006-01-02 15:04:05"), r.Open, r.Assets, r.New, r.Alerts, r.Resolved)
+			}
+			if *once {
+				failed = r.Failed
+				return nil
+			}
+			if !g.Sleep(*interval) {
+				return nil
+			}
+		}
+	})
+	if err := g.Wait(); err != nil {
+		fatal(err)
+	}
+	if failed > 0 {
+		exit(ExitPartial)
+	}
+}
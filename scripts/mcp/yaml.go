@@ -0,0 +1,447 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A small YAML reader and writer covering the subset used by answer files and
+// manifests: block mappings and sequences, plain and quoted scalars, flow
+// sequences ([a, b]), literal (|) and folded (>) block scalars, and comments.
+// Anchors, tags and multi-document streams are not supported. Values decode
+// to the same shapes as encoding/json: map[string]interface{},
+// []interface{}, string, float64, bool and nil.
+
+type yamlLine struct {
+	num    int
+	indent int
+	text   string
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	raw   []string
+	pos   int
+}
+
+func parseYAML(data []byte) (interface{}, error) {
+	p := &yamlParser{raw: strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")}
+	for i, l := range p.raw {
+		text := stripYAMLComment(l)
+		trimmed := strings.TrimSpace(text)
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+		if lead := l[:len(l)-len(strings.TrimLeft(l, " \t"))]; strings.Contains(lead, "\t") {
+			return nil, fmt.Errorf("yaml line %d: tabs are not allowed for indentation", i+1)
+		}
+		p.lines = append(p.lines, yamlLine{num: i, indent: len(text) - len(strings.TrimLeft(text, " ")), text: strings.TrimRight(trimmed, " ")})
+	}
+	if len(p.lines) == 0 {
+		return nil, nil
+	}
+	v, err := p.parseBlock(p.lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		return nil, fmt.Errorf("yaml line %d: unexpected indentation", p.lines[p.pos].num+1)
+	}
+	return v, nil
+}
+
+// stripYAMLComment removes a trailing "# comment" that is not inside quotes.
+func stripYAMLComment(line string) string {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func (p *yamlParser) parseBlock(indent int) (interface{}, error) {
+	if p.pos >= len(p.lines) {
+		return nil, nil
+	}
+	line := p.lines[p.pos]
+	if line.text == "-" || strings.HasPrefix(line.text, "- ") {
+		return p.parseSequence(line.indent)
+	}
+	return p.parseMapping(indent)
+}
+
+func (p *yamlParser) parseSequence(indent int) (interface{}, error) {
+	seq := []interface{}{}
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent < indent {
+			break
+		}
+		if line.indent > indent {
+			return nil, fmt.Errorf("yaml line %d: unexpected indentation", line.num+1)
+		}
+		if line.text != "-" && !strings.HasPrefix(line.text, "- ") {
+			break
+		}
+
+		rest := strings.TrimSpace(strings.TrimPrefix(line.text, "-"))
+		if rest == "" {
+			p.pos++
+			if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+				v, err := p.parseBlock(p.lines[p.pos].indent)
+				if err != nil {
+					return nil, err
+				}
+				seq = append(seq, v)
+			} else {
+				seq = append(seq, nil)
+			}
+			continue
+		}
+
+		_, _, isKey := splitYAMLKey(rest)
+		if isKey || rest == "-" || strings.HasPrefix(rest, "- ") {
+			// "- key: value" opens a mapping (and "- - x" a nested sequence)
+			// whose entries are aligned with the text after the dash.
+			itemIndent := indent + (len(line.text) - len(rest))
+			p.lines[p.pos] = yamlLine{num: line.num, indent: itemIndent, text: rest}
+			v, err := p.parseBlock(itemIndent)
+			if err != nil {
+				return nil, err
+			}
+			seq = append(seq, v)
+			continue
+		}
+
+		v, err := p.parseInlineValue(rest, indent, line.num)
+		if err != nil {
+			return nil, err
+		}
+		seq = append(seq, v)
+	}
+	return seq, nil
+}
+
+func (p *yamlParser) parseMapping(indent int) (interface{}, error) {
+	m := map[string]interface{}{}
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent < indent {
+			break
+		}
+		if line.indent > indent {
+			return nil, fmt.Errorf("yaml line %d: unexpected indentation", line.num+1)
+		}
+		key, rest, ok := splitYAMLKey(line.text)
+		if !ok {
+			if line.text == "-" || strings.HasPrefix(line.text, "- ") {
+				break
+			}
+			return nil, fmt.Errorf("yaml line %d: expected \"key: value\"", line.num+1)
+		}
+
+		if rest == "" {
+			p.pos++
+			switch {
+			case p.pos < len(p.lines) && p.lines[p.pos].indent > indent:
+				v, err := p.parseBlock(p.lines[p.pos].indent)
+				if err != nil {
+					return nil, err
+				}
+				m[key] = v
+			case p.pos < len(p.lines) && p.lines[p.pos].indent == indent && strings.HasPrefix(p.lines[p.pos].text, "- "):
+				// Sequences may be written at the same indentation as their key.
+				v, err := p.parseSequence(indent)
+				if err != nil {
+					return nil, err
+				}
+				m[key] = v
+			default:
+				m[key] = nil
+			}
+			continue
+		}
+
+		v, err := p.parseInlineValue(rest, indent, line.num)
+		if err != nil {
+			return nil, err
+		}
+		m[key] = v
+	}
+	return m, nil
+}
+
+// parseInlineValue parses the value after "key:" or "- " and advances past
+// the line, consuming following lines for block scalars.
+func (p *yamlParser) parseInlineValue(text string, indent, num int) (interface{}, error) {
+	p.pos++
+	if text == "|" || text == "|-" || text == ">" || text == ">-" {
+		return p.parseBlockScalar(text, indent, num), nil
+	}
+	return parseYAMLScalar(text, num)
+}
+
+// parseBlockScalar reads the raw lines of a literal or folded scalar. Raw
+// lines are used because block content may contain '#' or blank lines.
+func (p *yamlParser) parseBlockScalar(style string, indent, num int) string {
+	var body []string
+	blockIndent := -1
+	i := num + 1
+	for ; i < len(p.raw); i++ {
+		l := p.raw[i]
+		if strings.TrimSpace(l) == "" {
+			body = append(body, "")
+			continue
+		}
+		ind := len(l) - len(strings.TrimLeft(l, " "))
+		if ind <= indent {
+			break
+		}
+		if blockIndent < 0 {
+			blockIndent = ind
+		}
+		if ind < blockIndent {
+			break
+		}
+		body = append(body, l[blockIndent:])
+	}
+	for len(body) > 0 && body[len(body)-1] == "" {
+		body = body[:len(body)-1]
+	}
+	for p.pos < len(p.lines) && p.lines[p.pos].num < i {
+		p.pos++
+	}
+
+	var s string
+	if strings.HasPrefix(style, ">") {
+		s = strings.Join(body, " ")
+	} else {
+		s = strings.Join(body, "\n")
+	}
+	if !strings.HasSuffix(style, "-") && s != "" {
+		s += "\n"
+	}
+	return s
+}
+
+// splitYAMLKey splits "key: value" and reports whether the text is a mapping entry.
+func splitYAMLKey(text string) (string, string, bool) {
+	if strings.HasPrefix(text, "\"") || strings.HasPrefix(text, "'") {
+		end := strings.IndexRune(text[1:], rune(text[0]))
+		if end < 0 {
+			return "", "", false
+		}
+		key := text[1 : end+1]
+		rest := text[end+2:]
+		if !strings.HasPrefix(rest, ":") {
+			return "", "", false
+		}
+		return key, strings.TrimSpace(rest[1:]), true
+	}
+	if strings.HasPrefix(text, "[") || strings.HasPrefix(text, "{") {
+		return "", "", false
+	}
+	idx := strings.Index(text, ": ")
+	if idx < 0 {
+		if strings.HasSuffix(text, ":") {
+			return strings.TrimSpace(text[:len(text)-1]), "", true
+		}
+		return "", "", false
+	}
+	return strings.TrimSpace(text[:idx]), strings.TrimSpace(text[idx+2:]), true
+}
+
+func parseYAMLScalar(text string, num int) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(text, "\""):
+		s, err := strconv.Unquote(text)
+		if err != nil {
+			return nil, fmt.Errorf("yaml line %d: invalid quoted string %s", num+1, text)
+		}
+		return s, nil
+	case strings.HasPrefix(text, "'"):
+		if len(text) < 2 || !strings.HasSuffix(text, "'") {
+			return nil, fmt.Errorf("yaml line %d: invalid quoted string %s", num+1, text)
+		}
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), nil
+	case strings.HasPrefix(text, "["):
+		if !strings.HasSuffix(text, "]") {
+			return nil, fmt.Errorf("yaml line %d: unterminated flow sequence", num+1)
+		}
+		inner := strings.TrimSpace(text[1 : len(text)-1])
+		seq := []interface{}{}
+		if inner == "" {
+			return seq, nil
+		}
+		for _, part := range splitFlowItems(inner) {
+			v, err := parseYAMLScalar(strings.TrimSpace(part), num)
+			if err != nil {
+				return nil, err
+			}
+			seq = append(seq, v)
+		}
+		return seq, nil
+	case text == "{}":
+		return map[string]interface{}{}, nil
+	}
+
+	switch text {
+	case "~", "null", "Null", "NULL":
+		return nil, nil
+	case "true", "True", "TRUE":
+		return true, nil
+	case "false", "False", "FALSE":
+		return false, nil
+	}
+	// JSON has no infinity or NaN. YAML's spellings are refused; Go's
+	// (inf, nan, Infinity) are not YAML numbers and stay strings.
+	switch strings.ToLower(strings.TrimLeft(text, "+-")) {
+	case ".inf", ".nan":
+		return nil, fmt.Errorf("yaml line %d: %s is not supported (no JSON equivalent)", num+1, text)
+	}
+	if f, err := strconv.ParseFloat(text, 64); err == nil && !strings.ContainsAny(text, "xXoObB_") && text != "." &&
+		!math.IsInf(f, 0) && !math.IsNaN(f) {
+		return f, nil
+	}
+	return text, nil
+}
+
+// splitFlowItems splits a flow sequence body on commas outside quotes.
+func splitFlowItems(s string) []string {
+	var parts []string
+	var quote rune
+	start := 0
+	for i, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == ',':
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// writeYAML writes a decoded JSON value as block YAML that parseYAML reads
+// back. Mapping keys are sorted; strings are double-quoted when they would
+// otherwise read as another type or break the block structure.
+func writeYAML(w io.Writer, v interface{}) error {
+	var b strings.Builder
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 {
+			b.WriteString("{}\n")
+		} else {
+			writeYAMLMapping(&b, v, 0, true)
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			b.WriteString("[]\n")
+		} else {
+			writeYAMLSequence(&b, v, 0)
+		}
+	default:
+		b.WriteString(yamlScalar(v) + "\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeYAMLMapping writes m at indent. padFirst is false when the first key
+// follows a "- " sequence marker on the same line.
+func writeYAMLMapping(b *strings.Builder, m map[string]interface{}, indent int, padFirst bool) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pad := strings.Repeat(" ", indent)
+	for i, k := range keys {
+		if i > 0 || padFirst {
+			b.WriteString(pad)
+		}
+		b.WriteString(yamlScalar(k) + ":")
+		writeYAMLNested(b, m[k], indent+2)
+	}
+}
+
+func writeYAMLSequence(b *strings.Builder, list []interface{}, indent int) {
+	pad := strings.Repeat(" ", indent)
+	for _, item := range list {
+		b.WriteString(pad + "-")
+		if m, ok := item.(map[string]interface{}); ok && len(m) > 0 {
+			b.WriteString(" ")
+			writeYAMLMapping(b, m, indent+2, false)
+			continue
+		}
+		writeYAMLNested(b, item, indent+2)
+	}
+}
+
+// writeYAMLNested writes the value after a "key:" or "-": non-empty
+// collections start on the next line, everything else stays on this one.
+func writeYAMLNested(b *strings.Builder, v interface{}, indent int) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if len(v) > 0 {
+			b.WriteString("\n")
+			writeYAMLMapping(b, v, indent, true)
+			return
+		}
+		b.WriteString(" {}\n")
+	case []interface{}:
+		if len(v) > 0 {
+			b.WriteString("\n")
+			writeYAMLSequence(b, v, indent)
+			return
+		}
+		b.WriteString(" []\n")
+	default:
+		b.WriteString(" " + yamlScalar(v) + "\n")
+	}
+}
+
+func yamlScalar(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		if yamlNeedsQuotes(v) {
+			return strconv.Quote(v)
+		}
+		return v
+	}
+	return strconv.Quote(fmt.Sprint(v))
+}
+
+func yamlNeedsQuotes(s string) bool {
+	if s == "" || s != strings.TrimSpace(s) || strings.ContainsAny(s, "\n\r\t\"") ||
+		strings.Contains(s, ": ") || strings.HasSuffix(s, ":") || strings.Contains(s, " #") ||
+		strings.ContainsRune("-?:,[]{}#&*!|>'%@`", rune(s[0])) {
+		return true
+	}
+	parsed, err := parseYAMLScalar(s, 0)
+	return err != nil || parsed != s
+}
@@ -108,7 +108,10 @@ open class McpController(
                 "version" to "1.0.0",
                 "protocol" to "mcp/1.0",
                 "delegationActive" to true,
-                "delegatedUser" to delegatedUserEmail
+                "delegatedUser" to delegatedUserEmail,
+                // Lets clients tell which listed tools the user's roles allow
+                "delegatedUserRoles" to (validationResult.user?.roles?.map { it.name }?.sorted() ?: emptyList<String>()),
+                "effectivePermissions" to effectivePermissions.map { it.name }.sorted()
             )
 
             val response = McpCapabilitiesResponse(
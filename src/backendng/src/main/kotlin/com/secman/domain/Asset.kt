@@ -60,6 +60,14 @@ data class Asset(
     @Size(max = 2048)
     var uri: String? = null,
 
+    /**
+     * Hardware serial number, used to match the asset with configuration
+     * items in external CMDBs such as ServiceNow.
+     */
+    @Column(name = "serial_number", length = 255)
+    @Size(max = 255)
+    var serialNumber: String? = null,
+
     /**
      * Numeric representation of IP address for efficient range queries
      * Feature: 020-i-want-to (IP Address Mapping)
@@ -3,6 +3,7 @@ package com.secman.mcp.tools
 import com.secman.domain.McpOperation
 import com.secman.dto.mcp.McpExecutionContext
 import com.secman.repository.AssetRepository
+import com.secman.repository.AssetTagRepository
 import io.micronaut.data.model.Pageable
 import jakarta.inject.Inject
 import jakarta.inject.Singleton
@@ -20,7 +21,8 @@ import jakarta.inject.Singleton
  */
 @Singleton
 class GetAssetsTool(
-    @Inject private val assetRepository: AssetRepository
+    @Inject private val assetRepository: AssetRepository,
+    @Inject private val assetTagRepository: AssetTagRepository
 ) : McpTool {
 
     override val name = "get_assets"
@@ -202,6 +204,12 @@ class GetAssetsTool(
                 )
             }
 
+            // Tags of the page's assets as key=value, in one query
+            val assetIds = resultPage.content.mapNotNull { it.id }
+            val tagsByAsset = if (assetIds.isEmpty()) emptyMap() else
+                assetTagRepository.findByAssetIdIn(assetIds)
+                    .groupBy({ it.asset.id }, { "${it.key}=${it.value}" })
+
             // Map assets to response format
             val assets: List<Map<String, Any?>> = resultPage.content.map { asset ->
                 mapOf(
@@ -210,13 +218,17 @@ class GetAssetsTool(
                     "type" to asset.type,
                     "ip" to asset.ip,
                     "uri" to asset.uri,
+                    "serialNumber" to asset.serialNumber,
                     "owner" to asset.owner,
                     "description" to asset.description,
                     "groups" to (asset.groups?.split(",")?.map { it.trim() } ?: emptyList<String>()),
+                    "tags" to (tagsByAsset[asset.id] ?: emptyList<String>()),
                     "cloudAccountId" to asset.cloudAccountId,
                     "cloudInstanceId" to asset.cloudInstanceId,
                     "adDomain" to asset.adDomain,
                     "osVersion" to asset.osVersion,
+                    "criticality" to asset.criticality?.name,
+                    "networkZone" to asset.networkZone?.name,
                     "lastSeen" to asset.lastSeen?.toString(),
                     "createdAt" to asset.createdAt?.toString(),
                     "updatedAt" to asset.updatedAt?.toString()
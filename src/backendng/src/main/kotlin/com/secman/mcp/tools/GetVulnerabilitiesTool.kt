@@ -217,6 +217,7 @@ open class GetVulnerabilitiesTool(
                     "assetName" to asset?.name,
                     "vulnerabilityId" to vuln.vulnerabilityId,
                     "cvssSeverity" to vuln.cvssSeverity,
+                    "source" to vuln.source,
                     "vulnerableProductVersions" to vuln.vulnerableProductVersions,
                     "daysOpen" to vuln.daysOpen,
                     "scanTimestamp" to vuln.scanTimestamp.toString(),
@@ -1,11 +1,14 @@
 package com.secman.mcp.tools
 
+import com.secman.domain.AssetTag
 import com.secman.domain.Criticality
 import com.secman.domain.McpOperation
 import com.secman.dto.mcp.McpExecutionContext
 import com.secman.repository.AssetRepository
+import com.secman.repository.AssetTagRepository
 import jakarta.inject.Inject
 import jakarta.inject.Singleton
+import jakarta.transaction.Transactional
 import java.net.URI
 
 /**
@@ -24,18 +27,21 @@ import java.net.URI
  * - type (optional): New asset type
  * - owner (optional): New owner username
  * - ip (optional): New IP address
+ * - serialNumber (optional): New hardware serial number
  * - description (optional): New description
  * - criticality (optional): New criticality (CRITICAL, HIGH, MEDIUM, LOW, NA)
  * - adDomain (optional): New Active Directory domain
+ * - tags (optional): Tags to set as key to value; an empty value removes the key
  *
  * Output:
- * - id, name, type, owner, ip, criticality, adDomain: Updated asset fields
+ * - id, name, type, owner, ip, criticality, adDomain, tags: Updated asset fields
  * - updatedFields: List of fields that were changed
  * - message: Success message
  */
 @Singleton
 class UpdateAssetTool(
-    @Inject private val assetRepository: AssetRepository
+    @Inject private val assetRepository: AssetRepository,
+    @Inject private val assetTagRepository: AssetTagRepository
 ) : McpTool {
 
     override val name = "update_asset"
@@ -72,6 +78,11 @@ class UpdateAssetTool(
                 "description" to "New asset URI (http, https, or urn)",
                 "maxLength" to 2048
             ),
+            "serialNumber" to mapOf(
+                "type" to "string",
+                "description" to "New hardware serial number (max 255 characters)",
+                "maxLength" to 255
+            ),
             "description" to mapOf(
                 "type" to "string",
                 "description" to "New asset description"
@@ -84,6 +95,11 @@ class UpdateAssetTool(
             "adDomain" to mapOf(
                 "type" to "string",
                 "description" to "New Active Directory domain"
+            ),
+            "tags" to mapOf(
+                "type" to "object",
+                "description" to "Tags to set, as key to value (e.g. environment, data-classification, business-owner); each key replaces the asset's tags with that key, an empty value removes them",
+                "additionalProperties" to mapOf("type" to "string")
             )
         ),
         "required" to listOf("assetId")
@@ -108,6 +124,7 @@ class UpdateAssetTool(
         return trimmed
     }
 
+    @Transactional
     override suspend fun execute(arguments: Map<String, Any>, context: McpExecutionContext): McpToolResult {
         // Require User Delegation for audit trail
         if (!context.hasDelegation()) {
@@ -134,89 +151,106 @@ class UpdateAssetTool(
             return McpToolResult.error("NOT_FOUND", "Asset with ID $assetId not found or access denied")
         }
 
-        try {
-            val asset = assetRepository.findById(assetId).orElse(null)
-                ?: return McpToolResult.error("NOT_FOUND", "Asset with ID $assetId not found")
-
-            val updatedFields = mutableListOf<String>()
-
-            // Apply partial updates matching AssetController.update() pattern
-            (arguments["name"] as? String)?.let { newName ->
-                val trimmed = newName.trim()
-                if (trimmed.isBlank()) {
-                    return McpToolResult.error("VALIDATION_ERROR", "Name cannot be empty")
-                }
-                if (trimmed.length > 255) {
-                    return McpToolResult.error("VALIDATION_ERROR", "Name must not exceed 255 characters")
-                }
-                asset.name = trimmed
-                updatedFields.add("name")
+        // Check every argument before the asset is loaded: once it is a managed
+        // entity, a change made to it is flushed with the transaction.
+        val newName = (arguments["name"] as? String)?.trim()?.also {
+            if (it.isBlank()) {
+                return McpToolResult.error("VALIDATION_ERROR", "Name cannot be empty")
             }
-
-            (arguments["type"] as? String)?.let { newType ->
-                val trimmed = newType.trim()
-                if (trimmed.isBlank()) {
-                    return McpToolResult.error("VALIDATION_ERROR", "Type cannot be empty")
-                }
-                asset.type = trimmed
-                updatedFields.add("type")
+            if (it.length > 255) {
+                return McpToolResult.error("VALIDATION_ERROR", "Name must not exceed 255 characters")
             }
-
-            (arguments["owner"] as? String)?.let { newOwner ->
-                val trimmed = newOwner.trim()
-                if (trimmed.isBlank()) {
-                    return McpToolResult.error("VALIDATION_ERROR", "Owner cannot be empty")
-                }
-                if (trimmed.length > 255) {
-                    return McpToolResult.error("VALIDATION_ERROR", "Owner must not exceed 255 characters")
-                }
-                asset.owner = trimmed
-                updatedFields.add("owner")
+        }
+        val type = (arguments["type"] as? String)?.trim()?.also {
+            if (it.isBlank()) {
+                return McpToolResult.error("VALIDATION_ERROR", "Type cannot be empty")
             }
-
-            (arguments["ip"] as? String)?.let { newIp ->
-                asset.ip = newIp.trim().takeIf { it.isNotBlank() }
-                updatedFields.add("ip")
+        }
+        val owner = (arguments["owner"] as? String)?.trim()?.also {
+            if (it.isBlank()) {
+                return McpToolResult.error("VALIDATION_ERROR", "Owner cannot be empty")
             }
-
-            (arguments["uri"] as? String)?.let { newUri ->
-                asset.uri = try {
-                    normalizeUri(newUri)
-                } catch (e: IllegalArgumentException) {
-                    return McpToolResult.error("VALIDATION_ERROR", e.message ?: "Invalid URI")
-                }
-                updatedFields.add("uri")
+            if (it.length > 255) {
+                return McpToolResult.error("VALIDATION_ERROR", "Owner must not exceed 255 characters")
             }
-
-            (arguments["description"] as? String)?.let { newDescription ->
-                asset.description = newDescription.trim().takeIf { it.isNotBlank() }
-                updatedFields.add("description")
+        }
+        val ip = (arguments["ip"] as? String)?.trim()
+        // A blank uri clears it, so whether it was given is kept apart.
+        val uriGiven = arguments["uri"] is String
+        val uri = try {
+            normalizeUri(arguments["uri"] as? String)
+        } catch (e: IllegalArgumentException) {
+            return McpToolResult.error("VALIDATION_ERROR", e.message ?: "Invalid URI")
+        }
+        val serialNumber = (arguments["serialNumber"] as? String)?.trim()?.also {
+            if (it.length > 255) {
+                return McpToolResult.error("VALIDATION_ERROR", "Serial number must not exceed 255 characters")
             }
-
-            (arguments["criticality"] as? String)?.let { critStr ->
-                val trimmed = critStr.trim().uppercase()
-                try {
-                    asset.criticality = Criticality.valueOf(trimmed)
-                    updatedFields.add("criticality")
-                } catch (e: IllegalArgumentException) {
-                    return McpToolResult.error(
-                        "VALIDATION_ERROR",
-                        "Invalid criticality: '$trimmed'. Must be one of: CRITICAL, HIGH, MEDIUM, LOW, NA"
-                    )
-                }
+        }
+        val newDescription = (arguments["description"] as? String)?.trim()
+        val criticality = (arguments["criticality"] as? String)?.let { critStr ->
+            val trimmed = critStr.trim().uppercase()
+            try {
+                Criticality.valueOf(trimmed)
+            } catch (e: IllegalArgumentException) {
+                return McpToolResult.error(
+                    "VALIDATION_ERROR",
+                    "Invalid criticality: '$trimmed'. Must be one of: CRITICAL, HIGH, MEDIUM, LOW, NA"
+                )
             }
-
-            (arguments["adDomain"] as? String)?.let { newAdDomain ->
-                asset.adDomain = newAdDomain.trim().takeIf { it.isNotBlank() }
-                updatedFields.add("adDomain")
+        }
+        val adDomain = (arguments["adDomain"] as? String)?.trim()
+        val tags = (arguments["tags"] as? Map<*, *>)?.entries?.associate { (k, v) ->
+            k.toString().trim() to (v?.toString()?.trim() ?: "")
+        }
+        tags?.forEach { (key, value) ->
+            if (key.isBlank() || key.length > 100) {
+                return McpToolResult.error("VALIDATION_ERROR", "Tag keys must be 1 to 100 characters")
             }
-
-            if (updatedFields.isEmpty()) {
-                return McpToolResult.error("VALIDATION_ERROR", "No valid fields to update were provided")
+            if (value.length > 255) {
+                return McpToolResult.error("VALIDATION_ERROR", "Tag '$key' must not exceed 255 characters")
             }
+        }
+
+        val updatedFields = mutableListOf<String>()
+        if (newName != null) updatedFields.add("name")
+        if (type != null) updatedFields.add("type")
+        if (owner != null) updatedFields.add("owner")
+        if (ip != null) updatedFields.add("ip")
+        if (uriGiven) updatedFields.add("uri")
+        if (serialNumber != null) updatedFields.add("serialNumber")
+        if (newDescription != null) updatedFields.add("description")
+        if (criticality != null) updatedFields.add("criticality")
+        if (adDomain != null) updatedFields.add("adDomain")
+        if (!tags.isNullOrEmpty()) updatedFields.add("tags")
+        if (updatedFields.isEmpty()) {
+            return McpToolResult.error("VALIDATION_ERROR", "No valid fields to update were provided")
+        }
+
+        try {
+            val asset = assetRepository.findById(assetId).orElse(null)
+                ?: return McpToolResult.error("NOT_FOUND", "Asset with ID $assetId not found")
+
+            // Apply partial updates matching AssetController.update() pattern
+            newName?.let { asset.name = it }
+            type?.let { asset.type = it }
+            owner?.let { asset.owner = it }
+            ip?.let { asset.ip = it.takeIf { v -> v.isNotBlank() } }
+            if (uriGiven) asset.uri = uri
+            serialNumber?.let { asset.serialNumber = it.takeIf { v -> v.isNotBlank() } }
+            newDescription?.let { asset.description = it.takeIf { v -> v.isNotBlank() } }
+            criticality?.let { asset.criticality = it }
+            adDomain?.let { asset.adDomain = it.takeIf { v -> v.isNotBlank() } }
 
             val savedAsset = assetRepository.save(asset)
 
+            tags?.forEach { (key, value) ->
+                assetTagRepository.deleteAll(assetTagRepository.findByAssetIdAndKey(assetId, key))
+                if (value.isNotEmpty()) {
+                    assetTagRepository.save(AssetTag(asset = savedAsset, key = key, value = value))
+                }
+            }
+
             val result = mapOf(
                 "id" to savedAsset.id,
                 "name" to savedAsset.name,
@@ -224,8 +258,10 @@ class UpdateAssetTool(
                 "owner" to savedAsset.owner,
                 "ip" to savedAsset.ip,
                 "uri" to savedAsset.uri,
+                "serialNumber" to savedAsset.serialNumber,
                 "criticality" to savedAsset.criticality?.name,
                 "adDomain" to savedAsset.adDomain,
+                "tags" to assetTagRepository.findByAssetId(assetId).map { "${it.key}=${it.value}" },
                 "updatedFields" to updatedFields,
                 "message" to "Asset '${savedAsset.name}' (id: ${savedAsset.id}) updated: ${updatedFields.joinToString(", ")}"
             )
@@ -233,7 +269,9 @@ class UpdateAssetTool(
             return McpToolResult.success(result)
 
         } catch (e: Exception) {
-            return McpToolResult.error("EXECUTION_ERROR", "Failed to update asset: ${e.message}")
+            // Rethrown so the transaction rolls back: the asset and the tags
+            // are saved together or not at all. The controller reports it.
+            throw IllegalStateException("Failed to update asset: ${e.message}", e)
         }
     }
 }
@@ -9,6 +9,8 @@ interface AssetTagRepository : JpaRepository<AssetTag, Long> {
 
     fun findByAssetId(assetId: Long): List<AssetTag>
 
+    fun findByAssetIdIn(assetIds: Collection<Long>): List<AssetTag>
+
     fun findByKey(key: String): List<AssetTag>
 
     fun findByKeyAndValue(key: String, value: String): List<AssetTag>
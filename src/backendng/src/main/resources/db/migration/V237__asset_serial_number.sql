@@ -0,0 +1,4 @@
+-- Add an optional hardware serial number so assets can be matched with
+-- configuration items in external CMDBs.
+ALTER TABLE asset
+    ADD COLUMN serial_number VARCHAR(255) NULL AFTER uri;